@@ -18,8 +18,10 @@ package cip
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"sigs.k8s.io/promo-tools/v3/legacy/cli"
@@ -37,10 +39,27 @@ Promote images from a staging registry to production
 	SilenceUsage:  true,
 	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.Wrap(
-			cli.RunPromoteCmd(runOpts),
-			"run `cip run`",
-		)
+		if err := cli.ApplyConfigFile(cmd.Flags(), runOpts.ConfigFile); err != nil {
+			return errors.Wrap(err, "applying config file")
+		}
+
+		err := cli.RunPromoteCmd(runOpts)
+		if errors.Is(err, cli.ErrGated) {
+			logrus.Info(err)
+			os.Exit(cli.GatedExitCode)
+		}
+
+		if errors.Is(err, cli.ErrDeadlineReached) {
+			logrus.Error(err)
+			os.Exit(cli.DeadlineExitCode)
+		}
+
+		if errors.Is(err, cli.ErrSelfVerification) {
+			logrus.Error(err)
+			os.Exit(cli.SelfVerifyExitCode)
+		}
+
+		return errors.Wrap(err, "run `cip run`")
 	},
 }
 
@@ -49,12 +68,29 @@ var runOpts = &cli.RunOptions{}
 // TODO: Function 'init' is too long (171 > 60) (funlen)
 // nolint: funlen
 func init() {
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.Mode,
+		cli.PromoterModeFlag,
+		runOpts.Mode,
+		fmt.Sprintf(`'%s' (the default) only shows what would be done and never
+changes any registry; '%s' initiates a PRODUCTION image promotion`,
+			cli.ModePlan,
+			cli.ModeApply,
+		),
+	)
+
 	CipCmd.PersistentFlags().BoolVar(
 		&runOpts.Confirm,
-		"confirm",
+		cli.PromoterConfirmFlag,
 		runOpts.Confirm,
 		"initiate a PRODUCTION image promotion",
 	)
+	if err := CipCmd.PersistentFlags().MarkDeprecated(
+		cli.PromoterConfirmFlag,
+		fmt.Sprintf("use --%s=%s instead", cli.PromoterModeFlag, cli.ModeApply),
+	); err != nil {
+		logrus.Error(errors.Wrapf(err, "deprecating flag %s", cli.PromoterConfirmFlag))
+	}
 
 	// TODO: Move this into a default options function in pkg/promobot
 	CipCmd.PersistentFlags().StringVar(
@@ -82,6 +118,22 @@ the 'images: ...' contents`,
 		"number of concurrent goroutines to use when talking to GCR",
 	)
 
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.ReadThreads,
+		cli.PromoterReadThreadsFlag,
+		runOpts.ReadThreads,
+		`number of concurrent goroutines to use when reading registries
+(defaults to --threads)`,
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.WriteThreads,
+		cli.PromoterWriteThreadsFlag,
+		runOpts.WriteThreads,
+		`number of concurrent goroutines to use when promoting images
+(defaults to --threads)`,
+	)
+
 	CipCmd.PersistentFlags().BoolVar(
 		&runOpts.JSONLogSummary,
 		"json-log-summary",
@@ -101,7 +153,9 @@ the 'images: ...' contents`,
 		"key-files",
 		runOpts.KeyFiles,
 		`CSV of service account key files that must be activated for the
-promotion (<json-key-file-path>,...)`,
+promotion (<json-key-file-path>,...); registries without a service account in
+the manifest use the key belonging to their GCP project (the first one, if
+several keys belong to it)`,
 	)
 
 	CipCmd.PersistentFlags().StringVar(
@@ -123,7 +177,8 @@ promotion (<json-key-file-path>,...)`,
 		"minimal-snapshot",
 		runOpts.MinimalSnapshot,
 		fmt.Sprintf(`(only works with '--%s' or '--%s') discard tagless images
-from snapshot output if they are referenced by a manifest list`,
+from snapshot output if they are referenced by a manifest list; such a snapshot
+is not sufficient for a byte-for-byte copy of the registry`,
 			cli.PromoterSnapshotFlag,
 			cli.PromoterManifestBasedSnapshotOfFlag,
 		),
@@ -165,6 +220,17 @@ network from a registry, it reads from the local manifests only`,
 		),
 	)
 
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.InspectImage,
+		cli.PromoterInspectImageFlag,
+		runOpts.InspectImage,
+		fmt.Sprintf(`read a single image repository (e.g.
+'gcr.io/foo/bar') and print every digest and tag found in it, along with the
+children of any manifest lists; the format is controlled by '--%s'`,
+			cli.PromoterOutputFlag,
+		),
+	)
+
 	CipCmd.PersistentFlags().BoolVar(
 		&runOpts.UseServiceAcct,
 		"use-service-account",
@@ -184,13 +250,1131 @@ network from a registry, it reads from the local manifests only`,
 		runOpts.MaxImageSize = 2048
 	}
 
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.TransformerPlugin,
+		cli.PromoterTransformerPluginFlag,
+		runOpts.TransformerPlugin,
+		`(DANGEROUS) command to pipe every image through before pushing it to
+the destination; the command receives the image as an OCI layout tarball on
+stdin and must write the transformed image as an OCI layout tarball to stdout;
+manifest lists are rejected (disabled by default; requires
+--transformed-digests-file with --mode=apply)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.TransformedDigestsFile,
+		cli.PromoterTransformedDigestsFileFlag,
+		runOpts.TransformedDigestsFile,
+		`YAML file recording the digest every transformed, converted or upgraded
+image was pushed as; it
+is read before the destinations are compared with the manifests, so that the
+transformed images are recognized as already promoted, and updated after the
+promotion`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.LockFile,
+		cli.PromoterLockFileFlag,
+		runOpts.LockFile,
+		`local path or 'gs://' object used as an advisory lock to prevent
+concurrent promotions (only used with '--mode=apply')`,
+	)
+
+	CipCmd.PersistentFlags().DurationVar(
+		&runOpts.LockTimeout,
+		"lock-timeout",
+		runOpts.LockTimeout,
+		fmt.Sprintf(
+			"how long to wait for the '--%s' to be released before failing",
+			cli.PromoterLockFileFlag,
+		),
+	)
+
 	CipCmd.PersistentFlags().IntVar(
 		&runOpts.SeverityThreshold,
-		"vuln-severity-threshold",
+		cli.PromoterSeverityThresholdFlag,
 		cli.PromoterDefaultSeverityThreshold,
 		`Using this flag will cause the promoter to only run the vulnerability
 check. Found vulnerabilities at or above this threshold will result in the
 vulnerability check failing [severity levels between 0 and 5; 0 - UNSPECIFIED,
 1 - MINIMAL, 2 - LOW, 3 - MEDIUM, 4 - HIGH, 5 - CRITICAL]`,
 	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.GitHubAnnotations,
+		"github-annotations",
+		runOpts.GitHubAnnotations,
+		`(only works with '--vuln-severity-threshold') print severe
+vulnerabilities as GitHub Actions '::error'/'::warning' workflow commands`,
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.SeverityMapping,
+		cli.PromoterSeverityMappingFlag,
+		runOpts.SeverityMapping,
+		fmt.Sprintf(`map the vulnerability severities reported by the scanner to
+CRITICAL, HIGH, MEDIUM or LOW before they are compared to --%s or reported
+by --%s, as 'LABEL=SEVERITY' (e.g. 'MINIMAL=LOW') or 'cvss:MIN-MAX=SEVERITY'
+(e.g. 'cvss:9.0-10=CRITICAL'); can be given multiple times`,
+			cli.PromoterSeverityThresholdFlag,
+			cli.PromoterOnlyVulnerableFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SeverityMappingDefault,
+		cli.PromoterSeverityMappingDefaultFlag,
+		cli.PromoterDefaultUnmappedSeverity,
+		fmt.Sprintf(`severity of the vulnerabilities not matched by --%s (each
+such label is logged)`,
+			cli.PromoterSeverityMappingFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.InventoryFromSnapshot,
+		cli.PromoterInventoryFromSnapshotFlag,
+		runOpts.InventoryFromSnapshot,
+		fmt.Sprintf(`load the registry inventory from a snapshot file (as
+produced by '--%s') instead of reading the registries over the network`,
+			cli.PromoterSnapshotFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.LayerConcurrency,
+		cli.PromoterLayerConcurrencyFlag,
+		runOpts.LayerConcurrency,
+		`number of layers of a single image to copy concurrently; the image
+manifest is only pushed once all of its layers are present (0 uses the default)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SnapshotBaseline,
+		cli.PromoterSnapshotBaselineFlag,
+		runOpts.SnapshotBaseline,
+		fmt.Sprintf(`previous snapshot to compare the output of '--%s' against;
+the run fails if the images changed by more than '--%s' percent`,
+			cli.PromoterSnapshotFlag,
+			cli.PromoterMaxSnapshotDeltaFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().Float64Var(
+		&runOpts.MaxSnapshotDelta,
+		cli.PromoterMaxSnapshotDeltaFlag,
+		runOpts.MaxSnapshotDelta,
+		fmt.Sprintf(`fail if the number of images added and removed versus
+'--%s' exceeds this percentage of the baseline size`,
+			cli.PromoterSnapshotBaselineFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.JUnitOutput,
+		cli.PromoterJUnitOutputFlag,
+		runOpts.JUnitOutput,
+		`write the result of every promotion to this file (or gs:// or s3:// URL)
+as a JUnit XML report`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.MarkdownSummary,
+		cli.PromoterMarkdownSummaryFlag,
+		runOpts.MarkdownSummary,
+		`write a summary of the promotion to this file (or gs:// or s3:// URL) as
+GitHub-flavored markdown, for attaching to release notes or pull requests`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.PostRunDiff,
+		cli.PromoterPostRunDiffFlag,
+		runOpts.PostRunDiff,
+		fmt.Sprintf(`write what the promotion changed in the destination repositories
+(added, moved and removed tags and digests) to this file (or gs:// or s3://
+URL), in the format chosen
+by --%s; the repositories are read before and after promoting. Skipped in dry
+runs, and if a repository cannot be read`,
+			cli.PromoterOutputFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.Slowest,
+		cli.PromoterSlowestFlag,
+		runOpts.Slowest,
+		`after promoting, print the N image copies with the lowest throughput
+(bytes per second, based on the image size); requests which moved no bytes,
+such as mounted blobs, are reported as N/A`,
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.RetryableErrorPatterns,
+		cli.PromoterRetryableErrorPatternsFlag,
+		runOpts.RetryableErrorPatterns,
+		`additional regular expressions matching registry errors which should be
+retried (rate limiting, server errors, timeouts and dropped or refused
+connections are always retried)`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.PrintConfig,
+		cli.PromoterPrintConfigFlag,
+		runOpts.PrintConfig,
+		"print the effective options to stderr as YAML before running",
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.TokenAuthUsername,
+		cli.PromoterTokenAuthUsernameFlag,
+		runOpts.TokenAuthUsername,
+		`username for registries with the 'token-auth' provider (leave empty
+for anonymous access)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.TokenAuthPassword,
+		cli.PromoterTokenAuthPasswordFlag,
+		os.Getenv("CIP_TOKEN_AUTH_PASSWORD"),
+		`password for registries with the 'token-auth' provider (defaults to
+the CIP_TOKEN_AUTH_PASSWORD environment variable)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ClientCertFile,
+		cli.PromoterClientCertFileFlag,
+		runOpts.ClientCertFile,
+		fmt.Sprintf(`PEM file with a TLS client certificate to present to registries
+which require mutual TLS, when snapshotting or promoting (requires --%s); the
+same certificate is used for all registries`,
+			cli.PromoterClientKeyFileFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ClientKeyFile,
+		cli.PromoterClientKeyFileFlag,
+		runOpts.ClientKeyFile,
+		fmt.Sprintf(`PEM file with the private key of --%s`,
+			cli.PromoterClientCertFileFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.AllowedHosts,
+		cli.PromoterAllowedHostsFlag,
+		runOpts.AllowedHosts,
+		`only let the promoter talk to these hosts when snapshotting or promoting,
+given as exact hosts (e.g. 'gcr.io') or wildcards matching their subdomains
+(e.g. '*.pkg.dev'); registries, pushgateways and CloudEvents sinks outside the
+list fail the run before it starts, and requests to other hosts (such as token endpoints or redirects) fail. Hosts
+contacted by subprocesses such as gcloud are not restricted`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.RequireSignedSource,
+		cli.PromoterRequireSignedSourceFlag,
+		runOpts.RequireSignedSource,
+		fmt.Sprintf(`only promote images which carry a valid cosign signature at
+the source, made with the key given by '--%s'`,
+			cli.PromoterSignaturePublicKeyFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SignaturePublicKey,
+		cli.PromoterSignaturePublicKeyFlag,
+		runOpts.SignaturePublicKey,
+		"PEM encoded public key to verify source image signatures with",
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.SelfVerify,
+		cli.PromoterSelfVerifyFlag,
+		runOpts.SelfVerify,
+		fmt.Sprintf(`refuse to run (with exit code %d) unless the version, and
+optionally the binary, of this promoter match the signed release attestation
+given with --%s`,
+			cli.SelfVerifyExitCode,
+			cli.PromoterSelfVerifyAttestationFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SelfVerifyAttestation,
+		cli.PromoterSelfVerifyAttestationFlag,
+		runOpts.SelfVerifyAttestation,
+		`JSON release attestation ('gitVersion', 'gitCommit' and optionally
+'binaries', the SHA-256 digests of the released binaries), whose detached
+signature from 'cosign sign-blob' is read from the same path with a '.sig'
+suffix`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SelfVerifyKey,
+		cli.PromoterSelfVerifyKeyFlag,
+		runOpts.SelfVerifyKey,
+		`PEM encoded public key to verify the release attestation with,
+instead of the key built into the promoter`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.DropUnsignedSource,
+		"drop-unsigned-source",
+		runOpts.DropUnsignedSource,
+		fmt.Sprintf(`with '--%s', skip unsigned images instead of failing the
+run`,
+			cli.PromoterRequireSignedSourceFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ManifestListReport,
+		cli.PromoterManifestListReportFlag,
+		runOpts.ManifestListReport,
+		fmt.Sprintf(`read a registry (e.g. 'gcr.io/foo') and print a report of
+every manifest list found in it: its tags, its digest and the child digest for
+each platform; the report is JSON if '--%s=json' is given, YAML otherwise`,
+			cli.PromoterOutputFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SelectionFile,
+		cli.PromoterSelectionFileFlag,
+		runOpts.SelectionFile,
+		`YAML file listing the image:tag pairs (e.g. 'foo:1.0') approved for
+promotion; only these are promoted, and entries not found in the manifests are
+an error`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.LockfilePath,
+		cli.PromoterDigestLockfileFlag,
+		runOpts.LockfilePath,
+		fmt.Sprintf(`YAML lockfile (e.g. 'promoter.lock') pinning the digests each
+destination image may be promoted with; the run fails before copying anything
+if the manifests would promote a digest it does not list (regenerate it with
+--%s; unrelated to --%s)`,
+			cli.PromoterUpdateLockFlag,
+			cli.PromoterLockFileFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.UpdateLock,
+		cli.PromoterUpdateLockFlag,
+		runOpts.UpdateLock,
+		fmt.Sprintf(`(only works with '--%s') write the digests of the manifests
+to the lockfile instead of promoting`,
+			cli.PromoterDigestLockfileFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SnapshotOutput,
+		cli.PromoterSnapshotOutputFlag,
+		runOpts.SnapshotOutput,
+		fmt.Sprintf(`(only works with '--%s' or '--%s') write the snapshot to
+this local file, 'gs://<bucket>/<object>' or 's3://<bucket>/<object>' instead
+of stdout`,
+			cli.PromoterSnapshotFlag,
+			cli.PromoterManifestBasedSnapshotOfFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SnapshotCheckpoint,
+		cli.PromoterSnapshotCheckpointFlag,
+		runOpts.SnapshotCheckpoint,
+		fmt.Sprintf(`(only works with '--%s') local file recording the repositories
+read so far; if the read fails, rerunning with the same file only reads the
+remaining repositories, and the file is removed once the snapshot is complete`,
+			cli.PromoterSnapshotFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.DryRunWithAuth,
+		cli.PromoterDryRunWithAuthFlag,
+		runOpts.DryRunWithAuth,
+		`(dry run only) activate the service accounts and check that every
+source repository can be read and every destination repository can be pushed
+to, without copying any images`,
+	)
+
+	CipCmd.PersistentFlags().StringArrayVar(
+		&runOpts.StorageGroups,
+		cli.PromoterStorageGroupFlag,
+		runOpts.StorageGroups,
+		`comma separated list of destination registries on the same host which
+share their backing storage (e.g. 'us.gcr.io/foo,us.gcr.io/foo/mirror'); a
+digest is copied into the group once and mounted from there by the others; can
+be given multiple times`,
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.DeprecatedMediaTypes,
+		cli.PromoterDeprecatedMediaTypesFlag,
+		runOpts.DeprecatedMediaTypes,
+		`additional manifest media types to warn about when promoting (Docker
+schema v1 is always considered deprecated)`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.RejectDeprecatedTypes,
+		cli.PromoterRejectDeprecatedTypesFlag,
+		runOpts.RejectDeprecatedTypes,
+		"fail instead of warning when source images use deprecated media types",
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.AllowedDestinations,
+		cli.PromoterAllowedDestinationsFlag,
+		runOpts.AllowedDestinations,
+		`glob patterns (e.g. '*.gcr.io/k8s-artifacts-prod'; '*' does not match
+'/') of the destination registries this run may promote to; the run fails
+before doing anything if a manifest names any other destination`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ManifestListMediaType,
+		cli.PromoterManifestListMediaTypeFlag,
+		runOpts.ManifestListMediaType,
+		`write manifest lists to the destination as 'docker' manifest lists or
+'oci' image indexes; by default the media type of the source is kept (a
+conversion changes the digest of the manifest list at the destination, so
+--transformed-digests-file is required with --mode=apply)`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.UpgradeSchemaV1,
+		cli.PromoterUpgradeSchemaV1Flag,
+		runOpts.UpgradeSchemaV1,
+		`convert Docker schema v1 source images to schema v2 while copying them,
+rebuilding their config from the v1 history (this changes the digest of the
+image at the destination; both digests are logged, and recorded in
+--transformed-digests-file, which is required with --mode=apply)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.PushgatewayURL,
+		cli.PromoterPushgatewayURLFlag,
+		runOpts.PushgatewayURL,
+		`URL of a Prometheus pushgateway which the final metrics of the run
+(edges promoted and failed, bytes copied, duration) are pushed to; failing to
+push them does not fail the run`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.Explain,
+		cli.PromoterExplainFlag,
+		runOpts.Explain,
+		`image to explain, as name[:tag|@digest] (the name may be the image name of
+the manifests, or a full source or destination repository): print a trace of
+how the promotion edges of the image are computed instead of promoting`,
+	)
+
+	CipCmd.PersistentFlags().Int64Var(
+		&runOpts.QuotaBytes,
+		cli.PromoterQuotaBytesFlag,
+		runOpts.QuotaBytes,
+		`storage quota (in bytes) of every destination registry; the projected
+storage usage after the promotion is reported against it, and the promotion
+fails if it would exceed the quota (0 disables the check)`,
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.QuotaWarnPercent,
+		cli.PromoterQuotaWarnPercentFlag,
+		cli.PromoterDefaultQuotaWarnPercent,
+		"percentage of --quota-bytes from which the projected storage usage is warned about",
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.IgnoreQuota,
+		cli.PromoterIgnoreQuotaFlag,
+		runOpts.IgnoreQuota,
+		"only warn instead of failing when the promotion would exceed --quota-bytes",
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ClearRepository,
+		cli.PromoterClearRepositoryFlag,
+		runOpts.ClearRepository,
+		`registry (e.g. gcr.io/foo/bar) to delete ALL images from; prints the
+images it would delete, and only deletes them with --mode=apply`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.LogCommands,
+		cli.PromoterLogCommandsFlag,
+		runOpts.LogCommands,
+		`log level (e.g. 'info' or 'debug') at which every external command is
+logged before it is run, with service accounts redacted; by default the
+commands are not logged`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.Lint,
+		cli.PromoterLintFlag,
+		runOpts.Lint,
+		`only parse the manifests and print best practice warnings about them
+(floating tags, missing service accounts, nested destinations, duplicate
+images); fails only with --strict`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.Strict,
+		cli.PromoterStrictFlag,
+		runOpts.Strict,
+		fmt.Sprintf(
+			"make --lint fail if it finds anything, and --%s fail if the quota cannot be looked up",
+			cli.PromoterCheckQuotaBeforeFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.DiagnosticsOutput,
+		cli.PromoterDiagnosticsOutputFlag,
+		runOpts.DiagnosticsOutput,
+		fmt.Sprintf(`when the options or manifests are invalid (or with --%s),
+also write the problems found to this local file as a JSON array of
+{severity, code, message, file, line} objects for tools such as review bots`,
+			cli.PromoterLintFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.DigestsOutput,
+		cli.PromoterDigestsOutputFlag,
+		runOpts.DigestsOutput,
+		`file (or gs:// or s3:// URL) to write a YAML map of every promoted
+destination image:tag to its digest reference at the destination to, for
+pinning deployments; only written with --mode=apply, and the run fails instead
+if a promoted tag no longer points to the promoted digest`,
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.SourceFallbacks,
+		cli.PromoterSourceFallbacksFlag,
+		runOpts.SourceFallbacks,
+		`comma separated list of alternate source registries (e.g. mirrors of the
+source registry), tried in order for images whose digest is missing from their
+source registry`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.GraphOutput,
+		cli.PromoterGraphOutputFlag,
+		runOpts.GraphOutput,
+		`file (or gs:// or s3:// URL) to write a Graphviz DOT graph of the
+snapshotted images to: tags point to their digests, and manifest lists to their
+child images; only used with --snapshot or --manifest-based-snapshot-of`,
+	)
+
+	CipCmd.PersistentFlags().Float64Var(
+		&runOpts.ErrorRateThreshold,
+		cli.PromoterErrorRateThresholdFlag,
+		runOpts.ErrorRateThreshold,
+		`fraction (between 0 and 1) of failed requests among the recent requests
+to a destination above which its concurrency is halved; a destination which
+keeps failing is aborted (0 disables the circuit breaker)`,
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.BatchSize,
+		cli.PromoterBatchSizeFlag,
+		runOpts.BatchSize,
+		fmt.Sprintf(`promote to each destination in batches of this many requests, which
+run concurrently; the next batch starts once the previous one has finished and
+--%s has passed (0 disables batching)`,
+			cli.PromoterBatchDelayFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().DurationVar(
+		&runOpts.BatchDelay,
+		cli.PromoterBatchDelayFlag,
+		runOpts.BatchDelay,
+		fmt.Sprintf(`time to wait between two batches of --%s to the same destination`,
+			cli.PromoterBatchSizeFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().DurationVar(
+		&runOpts.ConcurrencyRamp,
+		cli.PromoterConcurrencyRampFlag,
+		runOpts.ConcurrencyRamp,
+		fmt.Sprintf(`time over which the number of threads promoting images is ramped up
+linearly from 1 to --%s (or --threads), so that the registries can scale up
+before seeing the full load (0 starts all threads at once)`,
+			cli.PromoterWriteThreadsFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.PostPromotionCleanup,
+		cli.PromoterPostPromotionCleanupFlag,
+		runOpts.PostPromotionCleanup,
+		`YAML file of rules naming the tags superseded by a promoted tag (e.g.
+'stable-prev' by 'stable'); after a successful promotion, the superseded tags
+are removed from the destination once the promoted tag has been verified there
+(only with --mode=apply; otherwise the removals are only logged)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ConfigFile,
+		cli.PromoterConfigFlag,
+		runOpts.ConfigFile,
+		`YAML (or JSON) file of options keyed by flag name (e.g. 'threads: 20');
+flags given on the command line override the values in the file`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.CheckpointPath,
+		cli.PromoterCheckpointFlag,
+		runOpts.CheckpointPath,
+		`file to periodically write the promoted edges to (replaced atomically),
+so that a run which is killed can be restarted with --resume-from; the final
+checkpoint lists every edge promoted by the run`,
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.CheckpointEdges,
+		cli.PromoterCheckpointEdgesFlag,
+		cli.PromoterDefaultCheckpointEdges,
+		"number of promoted edges after which the checkpoint is written",
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ResumeFrom,
+		cli.PromoterResumeFromFlag,
+		runOpts.ResumeFrom,
+		`checkpoint written by an interrupted run (see --checkpoint); the edges
+it lists are not promoted again`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ReplayFrom,
+		cli.PromoterReplayFromFlag,
+		runOpts.ReplayFrom,
+		`checkpoint written by a past run (see --checkpoint) whose edges are
+promoted again, with the digests it recorded, instead of the edges of the
+manifests (which still provide the registries); edges whose source digest no
+longer exists are reported and fail the run`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.StateFile,
+		cli.PromoterStateFileFlag,
+		runOpts.StateFile,
+		`file recording a signature of the edges and source registries of the last
+successful promotion; if neither changed since, the run exits early without
+reading the destinations (changes made to the destinations by others are not
+detected)`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.RequireSBOM,
+		cli.PromoterRequireSBOMFlag,
+		runOpts.RequireSBOM,
+		`only promote images which have an SBOM attached at the source, either as
+an OCI referrer or with 'cosign attach sbom'`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.DropMissingSBOM,
+		"drop-missing-sbom",
+		runOpts.DropMissingSBOM,
+		fmt.Sprintf(`with '--%s', skip images without an SBOM instead of
+failing the run`,
+			cli.PromoterRequireSBOMFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.ShortDigests,
+		cli.PromoterShortDigestsFlag,
+		runOpts.ShortDigests,
+		`abbreviate digests to their first 12 hex characters in human-readable
+output (logged edges, captured requests and --explain); machine-readable output
+always has the full digests`,
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.ImageNameMap,
+		cli.PromoterImageNameMapFlag,
+		runOpts.ImageNameMap,
+		`rules of the form '<regexp>=<replacement>' rewriting source image names
+to the image names used at the destinations (e.g. 'old-org/(.*)=new-org/${1}');
+the first rule whose regexp matches the whole image name is applied, and images
+matched by no rule keep their name`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.NamingPolicyRegex,
+		cli.PromoterNamingPolicyRegexFlag,
+		runOpts.NamingPolicyRegex,
+		fmt.Sprintf(`regexp which the whole name of every destination image (after
+applying --%s) has to match, e.g. '(team-a|team-b)/[a-z0-9-]+'; the run fails
+before copying anything, listing the images which do not match (also checked
+with --parse-only)`,
+			cli.PromoterImageNameMapFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ArchTagPattern,
+		cli.PromoterArchTagPatternFlag,
+		runOpts.ArchTagPattern,
+		`regexp matching the whole of arch-suffixed tags, whose two capture groups
+are the tag shared by all architectures and the architecture, e.g.
+'(.+)-(amd64|arm64|ppc64le|s390x)'; the promoted tags are grouped into families
+and every family lacking an architecture which other families of the image
+have is reported`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.AssembleManifestList,
+		cli.PromoterAssembleManifestListFlag,
+		runOpts.AssembleManifestList,
+		fmt.Sprintf(`after promoting, tag a manifest list of each complete family of
+--%s with the shared tag (e.g. 'v1.2.3' for 'v1.2.3-amd64' and 'v1.2.3-arm64');
+a shared tag which already points to another digest is never moved`,
+			cli.PromoterArchTagPatternFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.AttachScanResults,
+		cli.PromoterAttachScanResultsFlag,
+		runOpts.AttachScanResults,
+		fmt.Sprintf(`(only works with '--%s') attach the vulnerability findings
+of every scanned source image to it as a cosign attestation of type 'vuln'
+(only with --mode=apply; otherwise the attestations are only logged)`,
+			cli.PromoterSeverityThresholdFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.AttestationKey,
+		cli.PromoterAttestationKeyFlag,
+		runOpts.AttestationKey,
+		`cosign key (file or KMS URI) to sign the scan result attestations with;
+without it, cosign signs keyless`,
+	)
+
+	CipCmd.PersistentFlags().DurationVar(
+		&runOpts.WatchInterval,
+		cli.PromoterWatchIntervalFlag,
+		runOpts.WatchInterval,
+		`if set, keep running and promote again after every interval, reading
+the manifests and registries anew each time so that only new or changed images
+are promoted; SIGINT or SIGTERM stop the watch after the current promotion`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ServeAddress,
+		cli.PromoterServeAddressFlag,
+		runOpts.ServeAddress,
+		fmt.Sprintf(`if set (e.g. ':8080'), keep running and serve an HTTP API
+instead: POST /promote and POST /snapshot queue a run with the given manifest
+or registry, and the options of the server overridden by the tuning options
+in the body (such as Mode or Threads; others are rejected), GET /runs/{id}
+returns its status and results for a day after it finished, and GET /healthz
+reports readiness; every request but the last needs the bearer token given by
+--%s`,
+			cli.PromoterServeTokenFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ServeToken,
+		cli.PromoterServeTokenFlag,
+		os.Getenv("CIP_SERVE_TOKEN"),
+		fmt.Sprintf(`bearer token which authenticates the requests to --%s
+(defaults to the CIP_SERVE_TOKEN environment variable)`,
+			cli.PromoterServeAddressFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.FindOrphanedAttachments,
+		cli.PromoterFindOrphanedAttachmentsFlag,
+		runOpts.FindOrphanedAttachments,
+		`registry (e.g. gcr.io/foo/bar) to report the cosign signatures,
+attestations and SBOMs of, whose images no longer exist; the orphaned
+attachments are only deleted with --mode=apply`,
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.CompareRegistries,
+		cli.PromoterCompareRegistriesFlag,
+		runOpts.CompareRegistries,
+		fmt.Sprintf(`two or more registries (e.g. 'us.gcr.io/foo,eu.gcr.io/foo')
+which mirror each other, to report the tags which point to different digests
+in them; the report is JSON if '--%s=json' is given, YAML otherwise`,
+			cli.PromoterOutputFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringSliceVar(
+		&runOpts.RegistryDelta,
+		cli.PromoterRegistryDeltaFlag,
+		runOpts.RegistryDelta,
+		fmt.Sprintf(`a source and a destination registry (e.g.
+'gcr.io/foo-staging,us.gcr.io/foo') to report what is in the source but not
+the destination (the promotion backlog) and what is in the destination but
+not the source (drift), without reading any manifest; the report is JSON if
+'--%s=json' is given, YAML otherwise`,
+			cli.PromoterOutputFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.LogSampleRate,
+		cli.PromoterLogSampleRateFlag,
+		cli.PromoterDefaultLogSampleRate,
+		`only log the routine progress of 1 in this many promotion edges
+(always the same ones for a given destination and digest; 0 and 1 log every
+edge); warnings, errors and summaries are always logged in full`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.TraceEdge,
+		cli.PromoterTraceEdgeFlag,
+		runOpts.TraceEdge,
+		fmt.Sprintf(`log every step of promoting the edges selected by a comma-separated
+list of 'src=<image>', 'dst=<image>' and 'digest=<digest prefix>' (images as
+'registry/image' or 'registry/image:tag'), and drop the routine logs of all
+other edges (replaces --%s); warnings, errors and summaries are always logged`,
+			cli.PromoterLogSampleRateFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ManifestPublicKey,
+		cli.PromoterManifestPublicKeyFlag,
+		runOpts.ManifestPublicKey,
+		`PEM encoded public key (as written by 'cosign generate-key-pair') which
+every manifest file must be signed with; the signature of a file is read from
+the file of the same name with a '.sig' suffix (as written by
+'cosign sign-blob --output-signature'), and the promoter refuses to run if any
+signature is missing or invalid`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.SnapshotHash,
+		cli.PromoterSnapshotHashFlag,
+		runOpts.SnapshotHash,
+		fmt.Sprintf(`(only works with '--%s' or '--%s') print the sha256 digest of
+the snapshot instead of the snapshot itself; it only changes if an image, digest
+or tag is added or removed, so it can be compared across runs to detect changes`,
+			cli.PromoterSnapshotFlag,
+			cli.PromoterManifestBasedSnapshotOfFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.SnapshotByTag,
+		cli.PromoterSnapshotByTagFlag,
+		runOpts.SnapshotByTag,
+		fmt.Sprintf(`(only works with '--%s' or '--%s') key the snapshot by tag
+instead of by digest, mapping every tag of an image to its digest and listing
+untagged digests separately; tags pointing to the same digest each appear`,
+			cli.PromoterSnapshotFlag,
+			cli.PromoterManifestBasedSnapshotOfFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.InUseImagesFile,
+		cli.PromoterInUseImagesFileFlag,
+		runOpts.InUseImagesFile,
+		`file listing the images running in production clusters, one
+'<registry>/<image>[:<tag>]@<digest>' reference per line (e.g. gathered from
+pod specs); instead of the images in the manifests, exactly the listed images
+of the manifests' source registries are promoted to their destinations, pinned
+to their running digests`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.SnapshotDiff,
+		cli.PromoterSnapshotDiffFlag,
+		runOpts.SnapshotDiff,
+		fmt.Sprintf(`(only works with '--%s' or '--%s') earlier snapshot to compare
+the snapshot to; instead of the snapshot, every change is printed, classified as
+an added, removed or moved tag, or a new or removed digest`,
+			cli.PromoterSnapshotFlag,
+			cli.PromoterManifestBasedSnapshotOfFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.RetryBudget,
+		cli.PromoterRetryBudgetFlag,
+		runOpts.RetryBudget,
+		`total number of retries of failed registry reads allowed across the
+whole run; once exhausted, failures are no longer retried and the run is
+aborted (0 means unlimited)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.CredentialSource,
+		cli.PromoterCredentialSourceFlag,
+		runOpts.CredentialSource,
+		`CSV of secret manager URIs holding the JSON service account keys to
+activate, instead of --key-files (gcpsm://<secret>,vault://<path>[#<field>],...);
+requires --use-service-account or --dry-run-with-auth. The keys are only held
+in memory: registries are accessed with access tokens minted from them, and
+gcloud is only handed short-lived access tokens, which are removed at the end
+of the run`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.DestCheckMode,
+		cli.PromoterDestCheckModeFlag,
+		cli.PromoterDefaultDestCheckMode,
+		`how to find the destinations which already exist: 'inventory' reads
+every destination repository, 'per-edge' sends a HEAD request for the
+destination of each edge instead (faster for sparse promotions into huge
+registries)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ExtraTagPolicy,
+		cli.PromoterExtraTagPolicyFlag,
+		cli.PromoterDefaultExtraTagPolicy,
+		`what to do about the tags of destination images which no manifest
+declares: 'ignore' them, 'warn' about each of them, or 'report' them in the
+output and the JSON summary (they are never changed; requires
+--dest-check-mode=inventory)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.MultiTagPolicy,
+		cli.PromoterMultiTagPolicyFlag,
+		cli.PromoterDefaultMultiTagPolicy,
+		fmt.Sprintf(`which tags of a digest with several tags to promote: 'all' of
+them (along with any --%s), only the tags written in the manifests
+('manifest-only'), or only the 'primary' one, which is the highest version (or
+else lexicographically highest) tag; --parse-only prints the resulting tags
+unless the policy is 'all'`,
+			cli.PromoterTagAliasesFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.GateURL,
+		cli.PromoterGateURLFlag,
+		runOpts.GateURL,
+		fmt.Sprintf(`URL of a gate (e.g. a change-freeze API) which has to allow a
+promotion with --%s=%s: it is queried with an HTTP GET right before
+promoting, and only a 200 OK response allows the promotion; otherwise
+nothing is promoted and the exit code is %d`,
+			cli.PromoterModeFlag,
+			cli.ModeApply,
+			cli.GatedExitCode,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.GateBodyMatch,
+		cli.PromoterGateBodyMatchFlag,
+		runOpts.GateBodyMatch,
+		fmt.Sprintf(`regular expression the body of the response of --%s has
+to match as well for the promotion to be allowed`,
+			cli.PromoterGateURLFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.OnlyVulnerable,
+		cli.PromoterOnlyVulnerableFlag,
+		runOpts.OnlyVulnerable,
+		fmt.Sprintf(`with --%s, only output the images which have at least one
+vulnerability finding, annotated with their highest severity`,
+			cli.PromoterSnapshotFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.IncludeAttachmentStatus,
+		cli.PromoterIncludeAttachmentStatusFlag,
+		runOpts.IncludeAttachmentStatus,
+		fmt.Sprintf(`with --%s, output every image annotated with whether it has a
+signature, an SBOM and a vulnerability scan attestation (with the cosign tag
+scheme or as referrers)`,
+			cli.PromoterSnapshotFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.GenerateManifest,
+		cli.PromoterGenerateManifestFlag,
+		runOpts.GenerateManifest,
+		fmt.Sprintf(`with --%s, output a promoter manifest promoting all images of
+the registry, pinned to their current digests, to a placeholder destination
+registry which has to be replaced`,
+			cli.PromoterSnapshotFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.GenerateManifestPrefix,
+		cli.PromoterGenerateManifestPrefixFlag,
+		runOpts.GenerateManifestPrefix,
+		fmt.Sprintf(`with --%s, only include the images whose name starts with
+this prefix`,
+			cli.PromoterGenerateManifestFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.CheckQuotaBefore,
+		cli.PromoterCheckQuotaBeforeFlag,
+		runOpts.CheckQuotaBefore,
+		fmt.Sprintf(`before promoting, look up the usage of --%s in the GCP project of
+every destination registry with the Cloud Monitoring API, and abort if less
+than --%s of its limit is left; if the quota cannot be looked up,
+only a warning is logged, unless --%s is given`,
+			cli.PromoterQuotaMetricFlag,
+			cli.PromoterQuotaHeadroomPercentFlag,
+			cli.PromoterStrictFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.QuotaMetric,
+		cli.PromoterQuotaMetricFlag,
+		runOpts.QuotaMetric,
+		fmt.Sprintf(`quota metric checked by --%s, as named in the Service Usage
+API (e.g. artifactregistry.googleapis.com/project_region_requests)`,
+			cli.PromoterCheckQuotaBeforeFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().IntVar(
+		&runOpts.QuotaHeadroomPercent,
+		cli.PromoterQuotaHeadroomPercentFlag,
+		cli.PromoterDefaultQuotaHeadroomPercent,
+		fmt.Sprintf(`percentage of the quota limit which has to be left for --%s`,
+			cli.PromoterCheckQuotaBeforeFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.IsolateManifests,
+		cli.PromoterIsolateManifestsFlag,
+		runOpts.IsolateManifests,
+		`check the edges of each manifest on its own, so that a manifest which
+fails edge filtering (e.g. because of a tag move) only stops its own edges
+from being promoted; the results are reported grouped by manifest`,
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.EstimateCost,
+		cli.PromoterEstimateCostFlag,
+		runOpts.EstimateCost,
+		fmt.Sprintf(`print an estimate of the egress cost of the promotion, per
+destination registry, by pricing the bytes it copies at --%s; this is a
+planning aid, not billing-accurate`,
+			cli.PromoterEgressRateFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().Float64Var(
+		&runOpts.EgressRate,
+		cli.PromoterEgressRateFlag,
+		runOpts.EgressRate,
+		fmt.Sprintf(`egress rate per GiB used by --%s`,
+			cli.PromoterEstimateCostFlag,
+		),
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.Deadline,
+		cli.PromoterDeadlineFlag,
+		runOpts.Deadline,
+		fmt.Sprintf(`deadline for the whole run, as an RFC 3339 time (e.g.
+2021-12-01T18:00:00Z) or a duration from the start of the run (e.g. 45m); once
+it passes, no new edges are promoted, the ones in flight are finished, the
+remaining ones are listed and the exit code is %d`,
+			cli.DeadlineExitCode,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.ReverifyBeforeCopy,
+		cli.PromoterReverifyBeforeCopyFlag,
+		runOpts.ReverifyBeforeCopy,
+		`resolve the source tag of every edge again right before copying it, and
+abort the edge if the tag no longer points to the digest in the manifest`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.TagAliases,
+		cli.PromoterTagAliasesFlag,
+		runOpts.TagAliases,
+		`YAML file of rules deriving alias tags from a promoted tag (e.g. 'v1.2' and
+'v1' from 'v1.2.3'); after a successful promotion, the aliases are added to the
+promoted digest in the destination, without copying it again, once the promoted
+tag has been verified there (only with --mode=apply; otherwise the aliases are
+only logged). Aliases already pointing to another digest are reported as
+conflicts and left alone`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.TargetEnvironment,
+		cli.PromoterTargetEnvironmentFlag,
+		runOpts.TargetEnvironment,
+		`environment (e.g. staging or prod) to promote for; images whose
+'environments' field in the manifest does not list it are skipped, while
+images without the field are promoted for every environment`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.CloudEventsSink,
+		cli.PromoterCloudEventsSinkFlag,
+		runOpts.CloudEventsSink,
+		fmt.Sprintf(`URL of a CloudEvents sink, to which a %s event is POSTed
+for every image promoted by the run (at the end of the run); events which
+cannot be delivered are logged and counted, but do not fail the run`,
+			cli.PromotedImageEventType,
+		),
+	)
+
+	CipCmd.PersistentFlags().BoolVar(
+		&runOpts.MoveMode,
+		cli.PromoterMoveModeFlag,
+		runOpts.MoveMode,
+		`move instead of copy: after a successful promotion, remove the source
+tags of the images copied by this run, once every destination has been verified
+to hold the promoted digest; a source tag is kept while any edge declared from
+it is not at its destination, and a source digest left without tags is deleted
+too, unless it is part of a manifest list (only with --mode=apply; otherwise the
+removals are only logged; cannot be used with --isolate-manifests,
+--target-environment or --in-use-images-file)`,
+	)
+
+	CipCmd.PersistentFlags().StringVar(
+		&runOpts.ShadowCommand,
+		cli.PromoterShadowCommandFlag,
+		runOpts.ShadowCommand,
+		`command which copies every image in place of the promoter, to compare
+an alternative copier with it (e.g. "crane copy {src} {dst}"); {src} is
+replaced with the source image, {dst} with the destination image and {digest}
+with the digest, and the digest found at the destination afterwards is checked
+against the manifest (only with --mode=apply; cannot be used with --checkpoint)`,
+	)
+
+	CipCmd.PersistentFlags().DurationVar(
+		&runOpts.PruneMinAge,
+		cli.PromoterPruneMinAgeFlag,
+		runOpts.PruneMinAge,
+		`grace period during which images are never deleted: digests pushed to
+a registry less than this long ago are kept by --clear-repository, and each
+skip is logged (0 deletes images of any age)`,
+	)
 }
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// runClearRepository deletes every image of the registry named by
+// opts.ClearRepository. Without '--mode=apply' it only prints the deletion plan,
+// as JSON if '--output json' is given, and as YAML otherwise.
+func runClearRepository(opts *RunOptions) error {
+	registry := reg.RegistryContext{
+		Name:           reg.RegistryName(opts.ClearRepository),
+		ServiceAccount: opts.SnapshotSvcAcct,
+	}
+
+	sc, err := makeSyncContext(
+		[]reg.Manifest{
+			{
+				Registries: []reg.RegistryContext{registry},
+			},
+		},
+		opts,
+	)
+	if err != nil {
+		return errors.Wrap(err, "creating sync context")
+	}
+
+	sc.Out = opts.Out
+
+	// Read the registry recursively, as every image found in it is deleted. A
+	// partial read would leave images behind, so it fails the run.
+	if err := readReportRegistries(
+		&sc,
+		[]reg.RegistryContext{registry},
+	); err != nil {
+		return errors.Wrap(err, "reading registry")
+	}
+
+	plan := sc.ClearRepositoryPlan(registry.Name)
+
+	var b []byte
+	if strings.EqualFold(opts.OutputFormat, "json") {
+		b, err = json.MarshalIndent(plan, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(plan)
+	}
+	if err != nil {
+		return errors.Wrap(err, "serializing deletion plan")
+	}
+
+	fmt.Fprint(opts.out(), string(b))
+
+	if !opts.Confirm {
+		logrus.Infof(
+			"Dry run: not deleting the %d images of %s (use --mode=apply to delete them)",
+			len(plan.Images),
+			registry.Name,
+		)
+		return nil
+	}
+
+	logrus.Warnf(
+		"CLEARING REPOSITORY %s: deleting all of its %d images",
+		registry.Name,
+		len(plan.Images),
+	)
+
+	mkDeletionCmd := func(
+		dest reg.RegistryContext,
+		imageName reg.ImageName,
+		digest reg.Digest,
+	) stream.Producer {
+		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
+		sp.CmdInvocation = reg.GetDeleteCmd(
+			dest,
+			sc.UseServiceAccount,
+			imageName,
+			digest,
+			true,
+		)
+		return &sp
+	}
+
+	if err := sc.ClearRepository(registry.Name, mkDeletionCmd, nil); err != nil {
+		return errors.Wrap(err, "clearing repository")
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ApplyConfigFile sets the flags named in the YAML (or JSON) config file at
+// path, keyed by flag name. Flags given explicitly on the command line take
+// precedence over the file, which in turn takes precedence over the flag
+// defaults. An empty path is ignored.
+func ApplyConfigFile(flags *pflag.FlagSet, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "reading config file")
+	}
+
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return errors.Wrapf(err, "parsing config file %s", path)
+	}
+
+	// Apply the options in a stable order, so that errors are reproducible.
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == PromoterConfigFlag {
+			return errors.Errorf("config file %s must not set --%s", path, name)
+		}
+
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return errors.Errorf("config file %s sets unknown option %q", path, name)
+		}
+
+		if flag.Changed {
+			continue
+		}
+
+		if err := setFlag(flags, flag, config[name]); err != nil {
+			return errors.Wrapf(err, "setting %q from config file %s", name, path)
+		}
+	}
+
+	return nil
+}
+
+// setFlag sets the flag to the value read from a config file. Lists are only
+// accepted by flags holding a list of values.
+func setFlag(flags *pflag.FlagSet, flag *pflag.Flag, value interface{}) error {
+	list, isList := value.([]interface{})
+	sliceValue, isSlice := flag.Value.(pflag.SliceValue)
+
+	switch {
+	case isList && isSlice:
+		values := make([]string, 0, len(list))
+		for _, v := range list {
+			values = append(values, fmt.Sprint(v))
+		}
+		return sliceValue.Replace(values)
+	case isList:
+		return errors.New("a list is not accepted")
+	case value == nil:
+		return errors.New("a value is required")
+	default:
+		return flags.Set(flag.Name, fmt.Sprint(value))
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// DeadlineExitCode is the exit code of a promotion which was cut short by the
+// deadline given with --deadline.
+const DeadlineExitCode = 4
+
+// ErrDeadlineReached is returned by RunPromoteCmd if the deadline passed
+// before every edge was promoted. The edges left over are logged, and a
+// follow-up run (e.g. with --resume-from) promotes them.
+var ErrDeadlineReached = reg.ErrDeadlineReached
+
+// parseDeadline parses the value of --deadline, which is either an absolute
+// time in RFC 3339 format or a duration counted from now. An empty value
+// means no deadline, and yields the zero time.
+func parseDeadline(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if deadline, err := time.Parse(time.RFC3339, value); err == nil {
+		return deadline, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, errors.Errorf(
+			"--%s must be an RFC 3339 time or a duration, not %q",
+			PromoterDeadlineFlag,
+			value,
+		)
+	}
+	if d <= 0 {
+		return time.Time{}, errors.Errorf(
+			"--%s must be a positive duration", PromoterDeadlineFlag,
+		)
+	}
+
+	return now.Add(d), nil
+}
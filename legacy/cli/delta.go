@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// runRegistryDelta reads the source and destination registries named by
+// opts.RegistryDelta and prints what is in the source but not the destination
+// (the promotion backlog) and what is in the destination but not the source
+// (drift), as JSON if '--output json' is given, and as YAML otherwise. No
+// promoter manifest is involved.
+func runRegistryDelta(opts *RunOptions) error {
+	src := reg.RegistryName(opts.RegistryDelta[0])
+	dst := reg.RegistryName(opts.RegistryDelta[1])
+	registries := []reg.RegistryContext{
+		{
+			Name:           src,
+			ServiceAccount: opts.SnapshotSvcAcct,
+			Src:            true,
+		},
+		{
+			Name:           dst,
+			ServiceAccount: opts.SnapshotSvcAcct,
+		},
+	}
+
+	sc, err := makeSyncContext(
+		[]reg.Manifest{
+			{
+				Registries: registries,
+			},
+		},
+		opts,
+	)
+	if err != nil {
+		return errors.Wrap(err, "creating sync context")
+	}
+
+	// Nothing is written to the registries.
+	sc.Confirm = false
+
+	if err := readReportRegistries(&sc, registries); err != nil {
+		return err
+	}
+
+	delta := sc.RegistryDelta(src, dst)
+	if err := writeReport(opts, delta); err != nil {
+		return errors.Wrap(err, "serializing registry delta")
+	}
+
+	logrus.Infof(
+		"%s has %d images not yet in %s; %s has %d images not in %s",
+		src, len(delta.Backlog), dst,
+		dst, len(delta.Drift), src,
+	)
+
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// runCompareRegistries reads the registries named by opts.CompareRegistries,
+// which should mirror each other, and prints every tag which points to
+// different digests in them, as JSON if '--output json' is given, and as YAML
+// otherwise. Each drifted tag is also logged as a warning.
+func runCompareRegistries(opts *RunOptions) error {
+	registries := make([]reg.RegistryContext, 0, len(opts.CompareRegistries))
+	regNames := make([]reg.RegistryName, 0, len(opts.CompareRegistries))
+	for _, name := range opts.CompareRegistries {
+		registries = append(registries, reg.RegistryContext{
+			Name:           reg.RegistryName(name),
+			ServiceAccount: opts.SnapshotSvcAcct,
+		})
+		regNames = append(regNames, reg.RegistryName(name))
+	}
+
+	sc, err := makeSyncContext(
+		[]reg.Manifest{
+			{
+				Registries: registries,
+			},
+		},
+		opts,
+	)
+	if err != nil {
+		return errors.Wrap(err, "creating sync context")
+	}
+
+	// Nothing is written to the registries.
+	sc.Confirm = false
+
+	if err := readReportRegistries(&sc, registries); err != nil {
+		return err
+	}
+
+	report := sc.FindDigestDrift(regNames)
+	if err := writeReport(opts, report); err != nil {
+		return errors.Wrap(err, "serializing digest drift report")
+	}
+
+	for _, drift := range report.Drifts {
+		digests := make([]string, 0, len(drift.Digests))
+		for _, regName := range regNames {
+			if digest, ok := drift.Digests[regName]; ok {
+				digests = append(digests, fmt.Sprintf("%s=%s", regName, digest))
+			}
+		}
+
+		logrus.Warnf(
+			"Digest drift of %s:%s: %s",
+			drift.Image,
+			drift.Tag,
+			strings.Join(digests, ", "),
+		)
+	}
+
+	logrus.Infof(
+		"Found %d drifted tags across %d registries",
+		len(report.Drifts),
+		len(regNames),
+	)
+
+	return nil
+}
+
+// readReportRegistries reads the registries recursively for a report. A
+// repository missing from the inventory would make the report wrong, so it
+// fails unless every repository was read.
+func readReportRegistries(sc *reg.SyncContext, registries []reg.RegistryContext) error {
+	if err := sc.ReadRegistries(registries, true, reg.MkReadRepositoryCmdReal); err != nil {
+		return err
+	}
+
+	if len(sc.Logs.Errors) > 0 {
+		return errors.Errorf(
+			"reading %d repositories failed",
+			len(sc.Logs.Errors),
+		)
+	}
+
+	return nil
+}
+
+// writeReport prints the report as JSON if '--output json' is given, and as
+// YAML otherwise.
+func writeReport(opts *RunOptions, report interface{}) error {
+	var b []byte
+	var err error
+	if strings.EqualFold(opts.OutputFormat, "json") {
+		b, err = json.MarshalIndent(report, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(report)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(opts.out(), string(b))
+	return nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// GatedExitCode is the exit code of a promotion which was not allowed by the
+// gate given with --gate-url.
+const GatedExitCode = 3
+
+// ErrGated is returned by RunPromoteCmd if the gate did not allow the
+// promotion. Nothing was promoted, but nothing failed either.
+var ErrGated = errors.New("promotion not allowed by the gate")
+
+// gateTimeout bounds the request to the gate.
+const gateTimeout = 30 * time.Second
+
+// checkGate asks the gate at opts.GateURL whether the promotion may proceed.
+// It is allowed if the gate responds with 200 OK and (if opts.GateBodyMatch is
+// set) a body matching that regular expression; otherwise ErrGated is
+// returned. An unreachable gate is an error, so that a promotion never
+// proceeds without the gate's consent. The gate is queried with transport (or
+// http.DefaultTransport, if nil), so that it is subject to --allowed-hosts.
+func checkGate(opts *RunOptions, transport http.RoundTripper) error {
+	if opts.GateURL == "" {
+		return nil
+	}
+
+	// Only the redacted URL is logged, as it may carry credentials.
+	gate := redactURL(opts.GateURL)
+
+	client := &http.Client{Transport: transport, Timeout: gateTimeout}
+	resp, err := client.Get(opts.GateURL)
+	if err != nil {
+		return errors.Wrapf(err, "querying gate %s", gate)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "reading response of gate %s", gate)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logrus.Warnf(
+			"Gate %s responded with %s; not promoting",
+			gate,
+			resp.Status,
+		)
+		return ErrGated
+	}
+
+	if opts.GateBodyMatch != "" {
+		re, err := regexp.Compile(opts.GateBodyMatch)
+		if err != nil {
+			return errors.Wrapf(err, "compiling --%s", PromoterGateBodyMatchFlag)
+		}
+
+		if !re.Match(body) {
+			logrus.Warnf(
+				"Response of gate %s does not match %q; not promoting",
+				gate,
+				opts.GateBodyMatch,
+			)
+			return ErrGated
+		}
+	}
+
+	logrus.Infof("Gate %s allows the promotion", gate)
+	return nil
+}
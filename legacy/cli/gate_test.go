@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestCheckGate(t *testing.T) {
+	gate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "open")
+	}))
+	defer gate.Close()
+
+	opts := &RunOptions{GateURL: gate.URL, GateBodyMatch: "^open$"}
+	require.Nil(t, checkGate(opts, nil))
+
+	opts.GateBodyMatch = "^closed$"
+	require.Equal(t, ErrGated, checkGate(opts, nil))
+
+	// A gate which is not in the allowlist is never queried.
+	allowlist, err := reg.ParseHostAllowlist([]string{"gcr.io"})
+	require.Nil(t, err)
+	opts.GateBodyMatch = ""
+	err = checkGate(opts, reg.NewAllowlistTransport(allowlist, nil))
+	require.Error(t, err)
+	require.ErrorIs(t, err, reg.ErrHostNotAllowed)
+
+	// The credentials of the gate are not part of the error.
+	opts.GateURL = strings.Replace(gate.URL, "http://", "http://user:secret@", 1)
+	err = checkGate(opts, reg.NewAllowlistTransport(allowlist, nil))
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "secret")
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// runInspectImage reads the single repository named by opts.InspectImage and
+// prints every digest and tag found in it, followed by the children of any
+// manifest lists.
+func runInspectImage(opts *RunOptions) error {
+	i := strings.LastIndex(opts.InspectImage, "/")
+	if i <= 0 || i == len(opts.InspectImage)-1 {
+		return errors.Errorf(
+			"invalid value %q for '--%s'; expected <registry>/<image>",
+			opts.InspectImage,
+			PromoterInspectImageFlag,
+		)
+	}
+
+	registryName := reg.RegistryName(opts.InspectImage[:i])
+	imageName := reg.ImageName(opts.InspectImage[i+1:])
+
+	srcRegistry := reg.RegistryContext{
+		Name:           registryName,
+		ServiceAccount: opts.SnapshotSvcAcct,
+		Src:            true,
+	}
+
+	sc, err := makeSyncContext(
+		[]reg.Manifest{
+			{
+				Registries: []reg.RegistryContext{srcRegistry},
+			},
+		},
+		opts,
+	)
+	if err != nil {
+		return errors.Wrap(err, "creating sync context")
+	}
+
+	// Nothing is written to the registries.
+	sc.Confirm = false
+
+	// Only read the one repository we were asked about, instead of the whole
+	// registry.
+	if err := sc.ReadRegistries(
+		[]reg.RegistryContext{
+			{
+				Name:           reg.RegistryName(opts.InspectImage),
+				ServiceAccount: opts.SnapshotSvcAcct,
+			},
+		},
+		false,
+		reg.MkReadRepositoryCmdReal,
+	); err != nil {
+		return errors.Wrapf(err, "reading %s", opts.InspectImage)
+	}
+
+	// An unreadable repository would look like one without any digests.
+	if len(sc.Logs.Errors) > 0 {
+		return errors.Errorf("reading %s failed", opts.InspectImage)
+	}
+
+	rii := make(reg.RegInvImage)
+	if digestTags, ok := sc.Inv[registryName][imageName]; ok {
+		rii[imageName] = digestTags
+	}
+
+	if len(rii) == 0 {
+		logrus.Warnf("No digests found for %s", opts.InspectImage)
+		return nil
+	}
+
+	sc.ReadGCRManifestLists(reg.MkReadManifestListCmdReal)
+	if len(sc.Logs.Errors) > 0 {
+		return errors.Errorf(
+			"reading the manifest lists of %s failed",
+			opts.InspectImage,
+		)
+	}
+
+	fmt.Fprint(opts.out(), renderSnapshot(rii, opts.OutputFormat))
+	fmt.Fprint(
+		opts.out(),
+		renderManifestListChildren(
+			imageName,
+			sc.ManifestListChildren(rii),
+			opts.OutputFormat,
+		),
+	)
+
+	return nil
+}
+
+// renderManifestListChildren serializes the child digests of each manifest
+// list in the given output format.
+func renderManifestListChildren(
+	imageName reg.ImageName,
+	children map[reg.Digest][]reg.Digest,
+	outputFormat string,
+) string {
+	if len(children) == 0 {
+		return ""
+	}
+
+	lists := make([]reg.Digest, 0, len(children))
+	for list := range children {
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i] < lists[j] })
+
+	var b strings.Builder
+	if strings.EqualFold(outputFormat, "csv") {
+		for _, list := range lists {
+			for _, child := range children[list] {
+				fmt.Fprintf(&b, "%s@%s,%s@%s\n", imageName, list, imageName, child)
+			}
+		}
+
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "---\n")
+	for _, list := range lists {
+		fmt.Fprintf(&b, "- list: %q\n", list)
+		fmt.Fprintf(&b, "  children:\n")
+		for _, child := range children[list] {
+			fmt.Fprintf(&b, "  - %q\n", child)
+		}
+	}
+
+	return b.String()
+}
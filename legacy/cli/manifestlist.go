@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// runManifestListReport reads the registry named by opts.ManifestListReport
+// and prints, for every manifest list found in it, its tags, its digest and
+// the child digest for each platform. The report is written as JSON if
+// '--output json' is given, and as YAML otherwise.
+func runManifestListReport(opts *RunOptions) error {
+	srcRegistry := reg.RegistryContext{
+		Name:           reg.RegistryName(opts.ManifestListReport),
+		ServiceAccount: opts.SnapshotSvcAcct,
+		Src:            true,
+	}
+
+	sc, err := makeSyncContext(
+		[]reg.Manifest{
+			{
+				Registries: []reg.RegistryContext{srcRegistry},
+			},
+		},
+		opts,
+	)
+	if err != nil {
+		return errors.Wrap(err, "creating sync context")
+	}
+
+	// Nothing is written to the registries.
+	sc.Confirm = false
+
+	if err := readReportRegistries(
+		&sc,
+		[]reg.RegistryContext{srcRegistry},
+	); err != nil {
+		return errors.Wrap(err, "reading registry")
+	}
+
+	sc.ReadGCRManifestLists(reg.MkReadManifestListCmdReal)
+	if len(sc.Logs.Errors) > 0 {
+		return errors.Errorf(
+			"reading %d manifest lists failed",
+			len(sc.Logs.Errors),
+		)
+	}
+
+	reports := sc.ManifestListReports(sc.Inv[srcRegistry.Name])
+
+	var b []byte
+	if strings.EqualFold(opts.OutputFormat, "json") {
+		b, err = json.MarshalIndent(reports, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(reports)
+	}
+	if err != nil {
+		return errors.Wrap(err, "serializing manifest list report")
+	}
+
+	fmt.Fprint(opts.out(), string(b))
+	return nil
+}
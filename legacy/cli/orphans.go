@@ -0,0 +1,105 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// runFindOrphanedAttachments reports the cosign attachments in the registry
+// named by opts.FindOrphanedAttachments whose images no longer exist, as JSON
+// if '--output json' is given, and as YAML otherwise. With '--mode=apply', the
+// orphaned attachments are deleted.
+func runFindOrphanedAttachments(opts *RunOptions) error {
+	registry := reg.RegistryContext{
+		Name:           reg.RegistryName(opts.FindOrphanedAttachments),
+		ServiceAccount: opts.SnapshotSvcAcct,
+	}
+
+	sc, err := makeSyncContext(
+		[]reg.Manifest{
+			{
+				Registries: []reg.RegistryContext{registry},
+			},
+		},
+		opts,
+	)
+	if err != nil {
+		return errors.Wrap(err, "creating sync context")
+	}
+
+	// An image missing from a partial read would make its attachments look
+	// orphaned, so the registry must be read in full.
+	if err := readReportRegistries(
+		&sc,
+		[]reg.RegistryContext{registry},
+	); err != nil {
+		return errors.Wrap(err, "reading registry")
+	}
+
+	report := sc.FindOrphanedAttachments(registry.Name)
+
+	var b []byte
+	if strings.EqualFold(opts.OutputFormat, "json") {
+		b, err = json.MarshalIndent(report, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(report)
+	}
+	if err != nil {
+		return errors.Wrap(err, "serializing orphaned attachments")
+	}
+
+	fmt.Fprint(opts.out(), string(b))
+
+	logrus.Infof(
+		"Found %d orphaned attachments in %s",
+		len(report.Orphans),
+		registry.Name,
+	)
+
+	mkDeletionCmd := func(
+		dest reg.RegistryContext,
+		imageName reg.ImageName,
+		digest reg.Digest,
+	) stream.Producer {
+		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
+		sp.CmdInvocation = reg.GetDeleteCmd(
+			dest,
+			sc.UseServiceAccount,
+			imageName,
+			digest,
+			true,
+		)
+		return &sp
+	}
+
+	return errors.Wrap(
+		sc.DeleteOrphanedAttachments(report, mkDeletionCmd),
+		"deleting orphaned attachments",
+	)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
+)
+
+// writePostRunDiff snapshots the destinations of the edges after the
+// promotion, and writes what changed since before (their snapshot taken ahead
+// of the promotion) to opts.PostRunDiff, as JSON if opts.OutputFormat is
+// "json", and as YAML otherwise.
+func writePostRunDiff(
+	opts *RunOptions,
+	sc *reg.SyncContext,
+	edges map[reg.PromotionEdge]interface{},
+	before reg.MasterInventory,
+) error {
+	after, err := sc.DestinationSnapshot(edges, reg.MkReadRepositoryCmdReal)
+	if err != nil {
+		return errors.Wrap(err, "snapshotting the destinations after the promotion")
+	}
+
+	diff := reg.DiffDestinations(before, after)
+
+	var b []byte
+	if strings.EqualFold(opts.OutputFormat, "json") {
+		b, err = json.MarshalIndent(diff, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(diff)
+	}
+	if err != nil {
+		return errors.Wrap(err, "serializing post-run diff")
+	}
+
+	return upload.Write(opts.PostRunDiff, b)
+}
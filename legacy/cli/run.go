@@ -17,15 +17,33 @@ limitations under the License.
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	cr "github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
 
+	"sigs.k8s.io/promo-tools/v3/internal/version"
+	"sigs.k8s.io/promo-tools/v3/legacy/cloudevents"
 	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
 	"sigs.k8s.io/promo-tools/v3/legacy/gcloud"
+	"sigs.k8s.io/promo-tools/v3/legacy/lock"
+	"sigs.k8s.io/promo-tools/v3/legacy/metrics"
 	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
 )
 
 type RunOptions struct {
@@ -37,21 +55,163 @@ type RunOptions struct {
 	OutputFormat            string
 	SnapshotSvcAcct         string
 	ManifestBasedSnapshotOf string
+	TransformerPlugin       string
+	InspectImage            string
+	LockFile                string
+	InventoryFromSnapshot   string
+	SnapshotBaseline        string
+	JUnitOutput             string
+	TokenAuthUsername       string
+	TokenAuthPassword       string
+	SignaturePublicKey      string
+	ManifestListReport      string
+	SelectionFile           string
+	SnapshotOutput          string
+	ManifestListMediaType   string
+	PushgatewayURL          string
+	Explain                 string
+	ClearRepository         string
+	LogCommands             string
+	DigestsOutput           string
+	GraphOutput             string
+	PostPromotionCleanup    string
+	ConfigFile              string
+	CheckpointPath          string
+	ResumeFrom              string
+	AttestationKey          string
+	FindOrphanedAttachments string
+	ManifestPublicKey       string
+	InUseImagesFile         string
+	SnapshotDiff            string
+	Mode                    string
+	CredentialSource        string
+	DestCheckMode           string
+	GateURL                 string
+	GateBodyMatch           string
+	GenerateManifestPrefix  string
+	QuotaMetric             string
+	Deadline                string
+	TagAliases              string
+	TargetEnvironment       string
+	CloudEventsSink         string
+	ShadowCommand           string
+	ExtraTagPolicy          string
+	NamingPolicyRegex       string
+	SnapshotCheckpoint      string
+	LockfilePath            string
+	DiagnosticsOutput       string
+	MultiTagPolicy          string
+	ServeAddress            string
+	ServeToken              string
+	ClientCertFile          string
+	ClientKeyFile           string
+	MarkdownSummary         string
+	ArchTagPattern          string
+	TraceEdge               string
+	SelfVerifyAttestation   string
+	SelfVerifyKey           string
+	StateFile               string
+	SeverityMappingDefault  string
+	ReplayFrom              string
+	PostRunDiff             string
+	TransformedDigestsFile  string
+	LockTimeout             time.Duration
+	WatchInterval           time.Duration
+	BatchDelay              time.Duration
+	ConcurrencyRamp         time.Duration
+	PruneMinAge             time.Duration
 	Threads                 int
 	MaxImageSize            int
 	SeverityThreshold       int
+	LayerConcurrency        int
+	QuotaWarnPercent        int
+	CheckpointEdges         int
+	LogSampleRate           int
+	RetryBudget             int
+	QuotaHeadroomPercent    int
+	ReadThreads             int
+	WriteThreads            int
+	BatchSize               int
+	Slowest                 int
 	Confirm                 bool
 	JSONLogSummary          bool
 	ParseOnly               bool
 	MinimalSnapshot         bool
 	UseServiceAcct          bool
+	GitHubAnnotations       bool
+	PrintConfig             bool
+	RequireSignedSource     bool
+	DropUnsignedSource      bool
+	DryRunWithAuth          bool
+	RejectDeprecatedTypes   bool
+	IgnoreQuota             bool
+	Lint                    bool
+	Strict                  bool
+	RequireSBOM             bool
+	DropMissingSBOM         bool
+	ShortDigests            bool
+	AttachScanResults       bool
+	SnapshotHash            bool
+	OnlyVulnerable          bool
+	GenerateManifest        bool
+	CheckQuotaBefore        bool
+	IsolateManifests        bool
+	EstimateCost            bool
+	ReverifyBeforeCopy      bool
+	MoveMode                bool
+	IncludeAttachmentStatus bool
+	UpdateLock              bool
+	AssembleManifestList    bool
+	SelfVerify              bool
+	SnapshotByTag           bool
+	UpgradeSchemaV1         bool
+	MaxSnapshotDelta        float64
+	ErrorRateThreshold      float64
+	EgressRate              float64
+	RetryableErrorPatterns  []string
+	StorageGroups           []string
+	DeprecatedMediaTypes    []string
+	AllowedDestinations     []string
+	SourceFallbacks         []string
+	ImageNameMap            []string
+	CompareRegistries       []string
+	RegistryDelta           []string
+	SeverityMapping         []string
+	AllowedHosts            []string
+	QuotaBytes              int64
+
+	// Out receives the output of the command, such as snapshots, reports
+	// and dry-run plans. If nil, it is written to stdout. It is not a flag:
+	// it lets library callers capture the output in memory.
+	Out io.Writer `json:"-" yaml:"-"`
+
+	// ResultsHook, if set, receives the results of the promotion once the
+	// command returns. Like Out, it is not a flag.
+	ResultsHook func([]reg.PromotionResult) `json:"-" yaml:"-"`
+}
+
+// out returns the writer receiving the output of the command.
+func (o *RunOptions) out() io.Writer {
+	if o.Out != nil {
+		return o.Out
+	}
+
+	return os.Stdout
 }
 
 const (
-	PromoterDefaultThreads           = 10
-	PromoterDefaultOutputFormat      = "yaml"
-	PromoterDefaultMaxImageSize      = 2048
-	PromoterDefaultSeverityThreshold = -1
+	PromoterDefaultThreads              = 10
+	PromoterDefaultOutputFormat         = "yaml"
+	PromoterDefaultMaxImageSize         = 2048
+	PromoterDefaultSeverityThreshold    = -1
+	PromoterDefaultUnmappedSeverity     = "LOW"
+	PromoterDefaultQuotaWarnPercent     = 80
+	PromoterDefaultCheckpointEdges      = 10
+	PromoterDefaultLogSampleRate        = 1
+	PromoterDefaultDestCheckMode        = reg.DestCheckInventory
+	PromoterDefaultQuotaHeadroomPercent = 10
+	PromoterDefaultExtraTagPolicy       = reg.ExtraTagPolicyIgnore
+	PromoterDefaultMultiTagPolicy       = reg.MultiTagPolicyAll
 
 	// flags.
 	PromoterManifestFlag                = "manifest"
@@ -59,8 +219,133 @@ const (
 	PromoterSnapshotFlag                = "snapshot"
 	PromoterManifestBasedSnapshotOfFlag = "manifest-based-snapshot-of"
 	PromoterOutputFlag                  = "output"
+	PromoterTransformerPluginFlag       = "transformer-plugin"
+	PromoterInspectImageFlag            = "inspect-image"
+	PromoterLockFileFlag                = "lock-file"
+	PromoterInventoryFromSnapshotFlag   = "inventory-from-snapshot"
+	PromoterLayerConcurrencyFlag        = "layer-concurrency"
+	PromoterSnapshotBaselineFlag        = "snapshot-baseline"
+	PromoterMaxSnapshotDeltaFlag        = "max-snapshot-delta"
+	PromoterJUnitOutputFlag             = "junit-output"
+	PromoterRetryableErrorPatternsFlag  = "retryable-error-patterns"
+	PromoterPrintConfigFlag             = "print-config"
+	PromoterTokenAuthUsernameFlag       = "token-auth-username"
+	PromoterTokenAuthPasswordFlag       = "token-auth-password"
+	PromoterRequireSignedSourceFlag     = "require-signed-source"
+	PromoterSignaturePublicKeyFlag      = "signature-public-key"
+	PromoterManifestListReportFlag      = "manifest-list-report"
+	PromoterSelectionFileFlag           = "selection-file"
+	PromoterSnapshotOutputFlag          = "snapshot-output"
+	PromoterDryRunWithAuthFlag          = "dry-run-with-auth"
+	PromoterStorageGroupFlag            = "storage-group"
+	PromoterDeprecatedMediaTypesFlag    = "deprecated-media-types"
+	PromoterRejectDeprecatedTypesFlag   = "reject-deprecated-media-types"
+	PromoterAllowedDestinationsFlag     = "allowed-destinations"
+	PromoterManifestListMediaTypeFlag   = "manifest-list-media-type"
+	PromoterPushgatewayURLFlag          = "pushgateway-url"
+	PromoterExplainFlag                 = "explain"
+	PromoterQuotaBytesFlag              = "quota-bytes"
+	PromoterQuotaWarnPercentFlag        = "quota-warn-percent"
+	PromoterIgnoreQuotaFlag             = "ignore-quota"
+	PromoterClearRepositoryFlag         = "clear-repository"
+	PromoterLogCommandsFlag             = "log-commands"
+	PromoterLintFlag                    = "lint"
+	PromoterStrictFlag                  = "strict"
+	PromoterDigestsOutputFlag           = "digests-output"
+	PromoterSourceFallbacksFlag         = "source-fallbacks"
+	PromoterGraphOutputFlag             = "graph-output"
+	PromoterErrorRateThresholdFlag      = "error-rate-threshold"
+	PromoterPostPromotionCleanupFlag    = "post-promotion-cleanup"
+	PromoterConfigFlag                  = "config"
+	PromoterCheckpointFlag              = "checkpoint"
+	PromoterCheckpointEdgesFlag         = "checkpoint-edges"
+	PromoterResumeFromFlag              = "resume-from"
+	PromoterRequireSBOMFlag             = "require-sbom"
+	PromoterShortDigestsFlag            = "short-digests"
+	PromoterImageNameMapFlag            = "image-name-map"
+	PromoterAttachScanResultsFlag       = "attach-scan-results"
+	PromoterAttestationKeyFlag          = "attestation-key"
+	PromoterSeverityThresholdFlag       = "vuln-severity-threshold"
+	PromoterWatchIntervalFlag           = "watch-interval"
+	PromoterFindOrphanedAttachmentsFlag = "find-orphaned-attachments"
+	PromoterLogSampleRateFlag           = "log-sample-rate"
+	PromoterManifestPublicKeyFlag       = "manifest-public-key"
+	PromoterSnapshotHashFlag            = "snapshot-hash"
+	PromoterInUseImagesFileFlag         = "in-use-images-file"
+	PromoterSnapshotDiffFlag            = "snapshot-diff"
+	PromoterModeFlag                    = "mode"
+	PromoterConfirmFlag                 = "confirm"
+	PromoterRetryBudgetFlag             = "retry-budget"
+	PromoterCredentialSourceFlag        = "credential-source"
+	PromoterDestCheckModeFlag           = "dest-check-mode"
+	PromoterGateURLFlag                 = "gate-url"
+	PromoterGateBodyMatchFlag           = "gate-body-match"
+	PromoterOnlyVulnerableFlag          = "only-vulnerable"
+	PromoterGenerateManifestFlag        = "generate-manifest"
+	PromoterGenerateManifestPrefixFlag  = "generate-manifest-prefix"
+	PromoterCheckQuotaBeforeFlag        = "check-quota-before"
+	PromoterQuotaMetricFlag             = "quota-metric"
+	PromoterQuotaHeadroomPercentFlag    = "quota-headroom-percent"
+	PromoterIsolateManifestsFlag        = "isolate-manifests"
+	PromoterEstimateCostFlag            = "estimate-cost"
+	PromoterEgressRateFlag              = "egress-rate"
+	PromoterDeadlineFlag                = "deadline"
+	PromoterReverifyBeforeCopyFlag      = "reverify-before-copy"
+	PromoterTagAliasesFlag              = "tag-aliases"
+	PromoterTargetEnvironmentFlag       = "target-environment"
+	PromoterCloudEventsSinkFlag         = "cloudevents-sink"
+	PromoterMoveModeFlag                = "move-mode"
+	PromoterReadThreadsFlag             = "read-threads"
+	PromoterWriteThreadsFlag            = "write-threads"
+	PromoterShadowCommandFlag           = "shadow-command"
+	PromoterIncludeAttachmentStatusFlag = "include-attachment-status"
+	PromoterExtraTagPolicyFlag          = "extra-tag-policy"
+	PromoterNamingPolicyRegexFlag       = "naming-policy-regex"
+	PromoterSnapshotCheckpointFlag      = "snapshot-checkpoint"
+	PromoterDigestLockfileFlag          = "digest-lockfile"
+	PromoterUpdateLockFlag              = "update-lock"
+	PromoterDiagnosticsOutputFlag       = "diagnostics-output"
+	PromoterMultiTagPolicyFlag          = "multi-tag-policy"
+	PromoterServeAddressFlag            = "serve-address"
+	PromoterServeTokenFlag              = "serve-token"
+	PromoterClientCertFileFlag          = "client-cert-file"
+	PromoterClientKeyFileFlag           = "client-key-file"
+	PromoterMarkdownSummaryFlag         = "markdown-summary"
+	PromoterCompareRegistriesFlag       = "compare-registries"
+	PromoterArchTagPatternFlag          = "arch-tag-pattern"
+	PromoterAssembleManifestListFlag    = "assemble-manifest-list"
+	PromoterTraceEdgeFlag               = "trace-edge"
+	PromoterBatchSizeFlag               = "batch-size"
+	PromoterBatchDelayFlag              = "batch-delay"
+	PromoterSelfVerifyFlag              = "self-verify"
+	PromoterSelfVerifyAttestationFlag   = "self-verify-attestation"
+	PromoterSelfVerifyKeyFlag           = "self-verify-key"
+	PromoterRegistryDeltaFlag           = "registry-delta"
+	PromoterConcurrencyRampFlag         = "concurrency-ramp"
+	PromoterSnapshotByTagFlag           = "snapshot-by-tag"
+	PromoterUpgradeSchemaV1Flag         = "upgrade-schema-v1"
+	PromoterSlowestFlag                 = "slowest"
+	PromoterStateFileFlag               = "state-file"
+	PromoterSeverityMappingFlag         = "severity-mapping"
+	PromoterSeverityMappingDefaultFlag  = "severity-mapping-default"
+	PromoterAllowedHostsFlag            = "allowed-hosts"
+	PromoterReplayFromFlag              = "replay-from"
+	PromoterPostRunDiffFlag             = "post-run-diff"
+	PromoterTransformedDigestsFileFlag  = "transformed-digests-file"
+	PromoterPruneMinAgeFlag             = "prune-min-age"
+)
+
+// The values of --mode. A plan never changes any registry, while apply
+// performs the promotion.
+const (
+	ModePlan  = "plan"
+	ModeApply = "apply"
 )
 
+// redactedValue replaces the value of secret-bearing options in printed
+// configuration.
+const redactedValue = "<redacted>"
+
 var PromoterAllowedOutputFormats = []string{
 	"csv",
 	"yaml",
@@ -69,16 +354,94 @@ var PromoterAllowedOutputFormats = []string{
 // TODO: Function 'runPromoteCmd' has too many statements (97 > 40) (funlen)
 // nolint: funlen,gocognit,gocyclo
 func RunPromoteCmd(opts *RunOptions) error {
+	if err := resolveMode(opts); err != nil {
+		writeDiagnostics(opts, []reg.Diagnostic{
+			reg.DiagnoseError(reg.DiagnosticInvalidOption, "", err),
+		})
+		return errors.Wrap(err, "resolving mode")
+	}
+
 	if err := validateImageOptions(opts); err != nil {
+		writeDiagnostics(opts, []reg.Diagnostic{
+			reg.DiagnoseError(reg.DiagnosticInvalidOption, "", err),
+		})
 		return errors.Wrap(err, "validating image options")
 	}
 
-	// Activate service accounts.
-	if opts.UseServiceAcct && opts.KeyFiles != "" {
-		if err := gcloud.ActivateServiceAccounts(opts.KeyFiles); err != nil {
+	// Nothing else is done before the promoter has verified itself.
+	if opts.SelfVerify {
+		if err := selfVerify(opts); err != nil {
+			return err
+		}
+	}
+
+	if opts.PrintConfig {
+		if err := printConfig(opts); err != nil {
+			return errors.Wrap(err, "printing effective options")
+		}
+	}
+
+	if opts.WatchInterval > 0 {
+		return runWatch(opts)
+	}
+
+	if opts.ServeAddress != "" {
+		return runServe(opts)
+	}
+
+	// Activate service accounts. A dry run with authentication activates
+	// them as well, so that broken key files are found before a real run.
+	// Registries without a service account use the one activated for their
+	// GCP project.
+	var accountsByProject map[string]string
+	if (opts.UseServiceAcct || opts.DryRunWithAuth) && opts.KeyFiles != "" {
+		var err error
+		accountsByProject, err = gcloud.ActivateServiceAccounts(opts.KeyFiles)
+		if err != nil {
 			return errors.Wrap(err, "activating service accounts")
 		}
 	}
+	if (opts.UseServiceAcct || opts.DryRunWithAuth) && opts.CredentialSource != "" {
+		var (
+			cleanup func() error
+			err     error
+		)
+		accountsByProject, cleanup, err = gcloud.LoadServiceAccountsFromSources(
+			opts.CredentialSource,
+		)
+		if err != nil {
+			return errors.Wrap(err, "loading service accounts")
+		}
+		defer func() {
+			if err := cleanup(); err != nil {
+				logrus.Warnf("removing the service account access tokens: %v", err)
+			}
+		}()
+	}
+
+	if opts.InspectImage != "" {
+		return runInspectImage(opts)
+	}
+
+	if opts.ManifestListReport != "" {
+		return runManifestListReport(opts)
+	}
+
+	if opts.ClearRepository != "" {
+		return runClearRepository(opts)
+	}
+
+	if opts.FindOrphanedAttachments != "" {
+		return runFindOrphanedAttachments(opts)
+	}
+
+	if len(opts.CompareRegistries) > 0 {
+		return runCompareRegistries(opts)
+	}
+
+	if len(opts.RegistryDelta) > 0 {
+		return runRegistryDelta(opts)
+	}
 
 	var (
 		mfest       reg.Manifest
@@ -89,8 +452,33 @@ func RunPromoteCmd(opts *RunOptions) error {
 
 	promotionEdges := make(map[reg.PromotionEdge]interface{})
 	sc := reg.SyncContext{}
+	var explainer *reg.Explainer
+	var origins reg.ManifestOrigins
 	mi := make(reg.MasterInventory)
 
+	// A deadline given as a duration counts from the start of the run.
+	deadline, err := parseDeadline(opts.Deadline, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if opts.PushgatewayURL != "" {
+		start := time.Now()
+		defer func() {
+			pushMetrics(opts, &sc, time.Since(start))
+		}()
+	}
+
+	if opts.CloudEventsSink != "" {
+		defer emitCloudEvents(opts, &sc)
+	}
+
+	if opts.ResultsHook != nil {
+		defer func() {
+			opts.ResultsHook(sc.PromotionResults)
+		}()
+	}
+
 	// TODO: Move this into the validation function
 	if opts.Snapshot != "" || opts.ManifestBasedSnapshotOf != "" {
 		if opts.Snapshot != "" {
@@ -124,6 +512,14 @@ func RunPromoteCmd(opts *RunOptions) error {
 		)
 	}
 
+	// The manifests dictate what is promoted, so they are authenticated
+	// before they are parsed.
+	if opts.ManifestPublicKey != "" {
+		if err := verifyManifestSignatures(opts); err != nil {
+			return errors.Wrap(err, "verifying manifest signatures")
+		}
+	}
+
 	doingPromotion := false
 
 	// TODO: is deeply nested (complexity: 5) (nestif)
@@ -131,6 +527,12 @@ func RunPromoteCmd(opts *RunOptions) error {
 	if opts.Manifest != "" {
 		mfest, err = reg.ParseManifestFromFile(opts.Manifest)
 		if err != nil {
+			writeManifestDiagnostics(
+				opts,
+				reg.DiagnoseManifestFile(opts.Manifest),
+				opts.Manifest,
+				err,
+			)
 			logrus.Fatal(err)
 		}
 
@@ -139,29 +541,48 @@ func RunPromoteCmd(opts *RunOptions) error {
 			mi[registry.Name] = nil
 		}
 
-		sc, err = reg.MakeSyncContext(
-			mfests,
-			opts.Threads,
-			opts.Confirm,
-			opts.UseServiceAcct,
-		)
+		if err := checkAllowedDestinations(mfests, opts); err != nil {
+			return err
+		}
+
+		if len(accountsByProject) > 0 {
+			if err := reg.ResolveServiceAccounts(mfests, accountsByProject); err != nil {
+				return errors.Wrap(err, "resolving service accounts")
+			}
+		}
+
+		sc, err = makeSyncContext(mfests, opts)
 		if err != nil {
 			logrus.Fatal(err)
 		}
 
 		doingPromotion = true
 	} else if opts.ThinManifestDir != "" {
-		mfests, err = reg.ParseThinManifestsFromDir(opts.ThinManifestDir)
+		mfests, err = reg.ParseThinManifestsFromDirConcurrently(
+			opts.ThinManifestDir,
+			opts.Threads,
+		)
 		if err != nil {
+			writeManifestDiagnostics(
+				opts,
+				reg.DiagnoseThinManifests(opts.ThinManifestDir),
+				opts.ThinManifestDir,
+				err,
+			)
 			return errors.Wrap(err, "parsing thin manifest directory")
 		}
 
-		sc, err = reg.MakeSyncContext(
-			mfests,
-			opts.Threads,
-			opts.Confirm,
-			opts.UseServiceAcct,
-		)
+		if err := checkAllowedDestinations(mfests, opts); err != nil {
+			return err
+		}
+
+		if len(accountsByProject) > 0 {
+			if err := reg.ResolveServiceAccounts(mfests, accountsByProject); err != nil {
+				return errors.Wrap(err, "resolving service accounts")
+			}
+		}
+
+		sc, err = makeSyncContext(mfests, opts)
 		if err != nil {
 			logrus.Fatal(err)
 		}
@@ -169,22 +590,287 @@ func RunPromoteCmd(opts *RunOptions) error {
 		doingPromotion = true
 	}
 
+	// The checkpoint of an earlier, interrupted run.
+	var resumed *reg.Checkpoint
+
+	if doingPromotion {
+		sc.RetryClassifier, err = stream.NewRetryClassifier(
+			opts.RetryableErrorPatterns,
+		)
+		if err != nil {
+			return errors.Wrap(err, "parsing retryable error patterns")
+		}
+
+		sc.RetryBudget = stream.NewRetryBudget(opts.RetryBudget)
+		if sc.RetryBudget != nil {
+			logrus.Infof("Allowing at most %d retries in total", opts.RetryBudget)
+		}
+
+		sc.TokenAuth = reg.NewTokenAuth(
+			opts.TokenAuthUsername,
+			opts.TokenAuthPassword,
+		)
+		if sc.Transport != nil {
+			sc.TokenAuth.Client = &http.Client{Transport: sc.Transport}
+		}
+
+		sc.StorageGroups, err = reg.ParseStorageGroups(opts.StorageGroups)
+		if err != nil {
+			return errors.Wrap(err, "parsing storage groups")
+		}
+
+		sc.ManifestListMediaType = reg.ManifestListMediaTypes[opts.ManifestListMediaType]
+		sc.UpgradeSchemaV1 = opts.UpgradeSchemaV1
+
+		sourceFallbacks := make([]reg.RegistryName, 0, len(opts.SourceFallbacks))
+		for _, name := range opts.SourceFallbacks {
+			sourceFallbacks = append(sourceFallbacks, reg.RegistryName(name))
+		}
+		if err := sc.AddSourceFallbacks(sourceFallbacks, accountsByProject); err != nil {
+			return errors.Wrap(err, "adding source fallbacks")
+		}
+
+		if opts.ErrorRateThreshold > 0 {
+			sc.Breaker = reg.NewDestinationBreaker(opts.ErrorRateThreshold, sc.EffectiveWriteThreads())
+		}
+
+		if opts.BatchSize > 0 {
+			sc.Batcher = reg.NewDestinationBatcher(opts.BatchSize, opts.BatchDelay)
+		}
+
+		sc.ConcurrencyRamp = opts.ConcurrencyRamp
+
+		sc.ShortDigests = opts.ShortDigests
+
+		sc.Out = opts.Out
+		sc.LogSampleRate = opts.LogSampleRate
+		sc.DestCheckMode = opts.DestCheckMode
+		if opts.TraceEdge != "" {
+			sc.TraceEdge, err = reg.ParseEdgeSelector(opts.TraceEdge)
+			if err != nil {
+				return errors.Wrap(err, "parsing edge to trace")
+			}
+			logrus.Infof("Only logging the progress of edges matching %s", opts.TraceEdge)
+		} else if sc.LogSampleRate > 1 {
+			logrus.Infof("Logging the progress of 1 in %d edges", sc.LogSampleRate)
+		}
+
+		if opts.ResumeFrom != "" {
+			resumed, err = reg.ReadCheckpoint(opts.ResumeFrom)
+			if err != nil {
+				return errors.Wrap(err, "reading checkpoint to resume from")
+			}
+		}
+
+		sc.Deadline = deadline
+		sc.ReverifyBeforeCopy = opts.ReverifyBeforeCopy
+
+		if opts.CheckpointPath != "" {
+			sc.Checkpointer = reg.NewCheckpointer(
+				opts.CheckpointPath,
+				opts.CheckpointEdges,
+				resumed,
+			)
+		}
+	}
+
+	if doingPromotion && opts.InventoryFromSnapshot != "" {
+		if err := sc.LoadInventoryFromSnapshot(
+			opts.InventoryFromSnapshot,
+			mfests,
+		); err != nil {
+			return errors.Wrap(err, "loading inventory from snapshot")
+		}
+	}
+
+	if opts.Lint {
+		return lintManifests(mfests, opts)
+	}
+
+	if opts.TargetEnvironment != "" {
+		removed := reg.SelectEnvironment(mfests, opts.TargetEnvironment)
+		logrus.Infof(
+			"Promoting for environment %s; skipping %d images restricted to other environments",
+			opts.TargetEnvironment,
+			len(removed),
+		)
+		for _, image := range removed {
+			logrus.Debugf("Skipping %s", image)
+		}
+	}
+
+	// Promote exactly the images running in the clusters, instead of the
+	// images listed in the manifests.
+	var inUseImages []reg.InUseImage
+	if opts.InUseImagesFile != "" {
+		inUseImages, err = reg.ParseInUseImagesFromFile(opts.InUseImagesFile)
+		if err != nil {
+			return errors.Wrap(err, "parsing in-use images file")
+		}
+
+		if ignored := reg.UseInUseImages(mfests, inUseImages); len(ignored) > 0 {
+			logrus.Infof(
+				"Ignoring %d in-use images outside of the source registries: %s",
+				len(ignored),
+				strings.Join(ignored, ", "),
+			)
+		}
+	}
+
+	imageNameMap, err := reg.ParseImageNameMap(opts.ImageNameMap)
+	if err != nil {
+		return errors.Wrap(err, "parsing image name map")
+	}
+
+	var namingPolicy *reg.NamingPolicy
+	if opts.NamingPolicyRegex != "" {
+		namingPolicy, err = reg.ParseNamingPolicy(opts.NamingPolicyRegex)
+		if err != nil {
+			return errors.Wrap(err, "parsing naming policy")
+		}
+	}
+
+	var severityMapping *reg.SeverityMapping
+	if len(opts.SeverityMapping) > 0 {
+		severityMapping, err = reg.ParseSeverityMapping(
+			opts.SeverityMapping,
+			opts.SeverityMappingDefault,
+		)
+		if err != nil {
+			return errors.Wrap(err, "parsing severity mapping")
+		}
+	}
+
+	var archTagPattern *reg.ArchTagPattern
+	if opts.ArchTagPattern != "" {
+		archTagPattern, err = reg.ParseArchTagPattern(opts.ArchTagPattern)
+		if err != nil {
+			return errors.Wrap(err, "parsing arch tag pattern")
+		}
+	}
+
 	if opts.ParseOnly {
+		if namingPolicy != nil {
+			edges, err := rewrittenEdges(mfests, imageNameMap)
+			if err != nil {
+				return err
+			}
+
+			if err := namingPolicy.Check(edges); err != nil {
+				return errors.Wrap(err, "checking naming policy")
+			}
+		}
+
+		if len(imageNameMap) > 0 {
+			if err := printImageNameRewrites(opts.out(), mfests, imageNameMap); err != nil {
+				return err
+			}
+		}
+
+		if opts.MultiTagPolicy != "" && opts.MultiTagPolicy != reg.MultiTagPolicyAll {
+			edges, err := rewrittenEdges(mfests, imageNameMap)
+			if err != nil {
+				return err
+			}
+
+			printPromotedTags(
+				opts.out(),
+				reg.ApplyMultiTagPolicy(edges, opts.MultiTagPolicy),
+			)
+		}
 		return nil
 	}
 
+	// The signature of the inputs of the promotion, recorded in
+	// opts.StateFile once it succeeds.
+	var promotionSignature string
+
 	// If there are no images in the manifest, it may be a stub manifest file
 	// (such as for brand new registries that would be watched by the promoter
 	// for the very first time).
 	// TODO: is deeply nested (complexity: 6) (nestif)
 	// nolint: nestif
 	if doingPromotion && opts.ManifestBasedSnapshotOf == "" {
-		promotionEdges, err = reg.ToPromotionEdges(mfests)
-		if err != nil {
-			return errors.Wrap(
-				err,
-				"converting list of manifests to edges for promotion",
+		if opts.ReplayFrom != "" {
+			// The manifests only provide the registries (and their
+			// credentials); the edges are those promoted by the past run.
+			replayed, err := reg.ReadCheckpoint(opts.ReplayFrom)
+			if err != nil {
+				return errors.Wrap(err, "reading checkpoint to replay")
+			}
+
+			promotionEdges, err = sc.ReplayEdges(replayed)
+			if err != nil {
+				return errors.Wrap(err, "reconstructing the edges to replay")
+			}
+			logrus.Infof(
+				"Replaying %d edges from %s",
+				len(promotionEdges),
+				opts.ReplayFrom,
 			)
+		} else {
+			promotionEdges, err = rewrittenEdges(mfests, imageNameMap)
+			if err != nil {
+				return err
+			}
+			promotionEdges = reg.ApplyMultiTagPolicy(promotionEdges, opts.MultiTagPolicy)
+		}
+
+		if namingPolicy != nil {
+			if err := namingPolicy.Check(promotionEdges); err != nil {
+				return errors.Wrap(err, "checking naming policy")
+			}
+		}
+
+		if opts.UpdateLock {
+			if err := reg.LockfileFromEdges(promotionEdges).WriteToFile(
+				opts.LockfilePath,
+			); err != nil {
+				return errors.Wrap(err, "writing lockfile")
+			}
+
+			logrus.Infof("Updated lockfile %s", opts.LockfilePath)
+			return nil
+		}
+
+		if opts.LockfilePath != "" {
+			lockfile, err := reg.ParseLockfileFromFile(opts.LockfilePath)
+			if err != nil {
+				return errors.Wrap(err, "parsing lockfile")
+			}
+
+			if err := lockfile.Check(promotionEdges); err != nil {
+				return errors.Wrap(err, "checking lockfile")
+			}
+		}
+
+		if opts.IsolateManifests {
+			origins, err = reg.NewManifestOrigins(mfests, imageNameMap)
+			if err != nil {
+				return errors.Wrap(err, "recording the manifest of every edge")
+			}
+		}
+
+		if opts.Explain != "" {
+			explainer = reg.NewExplainer(opts.Explain)
+			explainer.ShortDigests = opts.ShortDigests
+			explainer.Manifests(promotionEdges)
+		}
+
+		if opts.SelectionFile != "" {
+			selection, err := reg.ParseSelectionFromFile(opts.SelectionFile)
+			if err != nil {
+				return errors.Wrap(err, "parsing selection file")
+			}
+
+			promotionEdges, err = reg.SelectPromotionEdges(promotionEdges, selection)
+			if err != nil {
+				return errors.Wrap(err, "applying selection file")
+			}
+
+			if explainer != nil {
+				explainer.Stage("the selection file", promotionEdges)
+			}
 		}
 
 		imagesInManifests := false
@@ -194,11 +880,26 @@ func RunPromoteCmd(opts *RunOptions) error {
 				break
 			}
 		}
-		if !imagesInManifests {
+		if !imagesInManifests && opts.ReplayFrom == "" {
 			logrus.Info("No images in manifest(s) --- nothing to do.")
 			return nil
 		}
 
+		if opts.StateFile != "" {
+			work, signature, err := hasWork(opts, &sc, promotionEdges)
+			if err != nil {
+				return errors.Wrap(err, "checking for changes since the last promotion")
+			}
+			if !work {
+				logrus.Infof(
+					"Nothing changed since the last promotion recorded in %s --- nothing to do.",
+					opts.StateFile,
+				)
+				return nil
+			}
+			promotionSignature = signature
+		}
+
 		// Print version to make Prow logs more self-explanatory.
 		printVersion()
 
@@ -237,33 +938,45 @@ necessarily mean that a new version of the image layer is available.`,
 			)
 
 			if opts.MinimalSnapshot {
-				sc.ReadRegistries(
+				if err := sc.ReadRegistries(
 					[]reg.RegistryContext{*srcRegistry},
 					true,
 					reg.MkReadRepositoryCmdReal,
-				)
+				); err != nil {
+					return err
+				}
 
 				sc.ReadGCRManifestLists(reg.MkReadManifestListCmdReal)
 				rii = sc.RemoveChildDigestEntries(rii)
 			}
 		} else {
-			sc, err = reg.MakeSyncContext(
-				mfests,
-				opts.Threads,
-				opts.Confirm,
-				opts.UseServiceAcct,
-			)
+			sc, err = makeSyncContext(mfests, opts)
 			if err != nil {
 				logrus.Fatal(err)
 			}
 
-			sc.ReadRegistries(
+			if opts.SnapshotCheckpoint != "" {
+				sc.SnapshotCheckpointer, err = reg.NewSnapshotCheckpointer(
+					opts.SnapshotCheckpoint,
+				)
+				if err != nil {
+					return errors.Wrap(err, "reading snapshot checkpoint")
+				}
+			}
+
+			if err := sc.ReadRegistries(
 				[]reg.RegistryContext{*srcRegistry},
 				// Read all registries recursively, because we want to produce a
 				// complete snapshot.
 				true,
 				reg.MkReadRepositoryCmdReal,
-			)
+			); err != nil {
+				return err
+			}
+
+			if err := finishSnapshotCheckpoint(&sc, opts); err != nil {
+				return err
+			}
 
 			rii = sc.Inv[mfests[0].Registries[0].Name]
 			if opts.SnapshotTag != "" {
@@ -277,24 +990,89 @@ necessarily mean that a new version of the image layer is available.`,
 			}
 		}
 
+		if opts.GraphOutput != "" {
+			if err := writeGraph(opts.GraphOutput, &sc, srcRegistry, rii); err != nil {
+				return errors.Wrap(err, "writing dependency graph")
+			}
+		}
+
+		if opts.SnapshotBaseline != "" {
+			if err := checkSnapshotDelta(
+				rii,
+				srcRegistry.Name,
+				opts.SnapshotBaseline,
+				opts.MaxSnapshotDelta,
+			); err != nil {
+				return errors.Wrap(err, "comparing snapshot to baseline")
+			}
+		}
+
+		// Pick the renderer first, so that the snapshot is only rendered once.
+		// The renderers are listed by precedence.
 		var snapshot string
-		switch strings.ToLower(opts.OutputFormat) {
-		case "csv":
-			snapshot = rii.ToCSV()
-		case "yaml":
-			snapshot = rii.ToYAML(reg.YamlMarshalingOpts{})
-		default:
-			logrus.Errorf(
-				"invalid value %s for '--%s'; defaulting to %s",
+		switch {
+		case opts.GenerateManifest:
+			snapshot, err = renderGeneratedManifest(
+				rii,
+				srcRegistry.Name,
+				opts.GenerateManifestPrefix,
+			)
+			if err != nil {
+				return errors.Wrap(err, "generating manifest")
+			}
+		case opts.IncludeAttachmentStatus:
+			snapshot, err = renderAttachmentStatus(
+				&sc,
+				rii,
+				srcRegistry.Name,
+				opts.OutputFormat,
+			)
+			if err != nil {
+				return errors.Wrap(err, "checking attachments")
+			}
+		case opts.OnlyVulnerable:
+			sc.SeverityMapping = severityMapping
+			snapshot, err = renderVulnerableImages(
+				&sc,
+				rii,
+				srcRegistry.Name,
+				opts.OutputFormat,
+			)
+			if err != nil {
+				return errors.Wrap(err, "finding vulnerable images")
+			}
+		case opts.SnapshotDiff != "":
+			snapshot, err = renderSnapshotDiff(
+				rii,
+				srcRegistry.Name,
+				opts.SnapshotDiff,
 				opts.OutputFormat,
-				PromoterOutputFlag,
-				PromoterDefaultOutputFormat,
 			)
+			if err != nil {
+				return errors.Wrap(err, "comparing snapshot")
+			}
+		case opts.SnapshotHash:
+			hash, err := reg.SnapshotHash(rii)
+			if err != nil {
+				return errors.Wrap(err, "hashing snapshot")
+			}
+
+			snapshot = hash + "\n"
+		case opts.SnapshotByTag:
+			snapshot = renderTagSnapshot(rii, opts.OutputFormat)
+		default:
+			snapshot = renderSnapshot(rii, opts.OutputFormat)
+		}
+		if opts.SnapshotOutput != "" {
+			if err := upload.Write(opts.SnapshotOutput, []byte(snapshot)); err != nil {
+				return errors.Wrap(err, "writing snapshot")
+			}
 
-			snapshot = rii.ToYAML(reg.YamlMarshalingOpts{})
+			logrus.Infof("Wrote snapshot to %s", opts.SnapshotOutput)
+			return nil
 		}
 
-		fmt.Print(snapshot)
+		fmt.Fprint(opts.out(), snapshot)
 		return nil
 	}
 
@@ -319,6 +1097,7 @@ necessarily mean that a new version of the image layer is available.`,
 		digest reg.Digest, tag reg.Tag, tp reg.TagOp,
 	) stream.Producer {
 		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
 		sp.CmdInvocation = reg.GetWriteCmd(
 			destRC,
 			sc.UseServiceAccount,
@@ -333,36 +1112,457 @@ necessarily mean that a new version of the image layer is available.`,
 		return &sp
 	}
 
-	promotionEdges, ok := sc.FilterPromotionEdges(promotionEdges, true)
-	// If any funny business was detected during a comparison of the manifests
-	// with the state of the registries, then exit immediately.
-	if !ok {
-		return errors.New("encountered errors during edge filtering")
-	}
-
-	if opts.SeverityThreshold >= 0 {
-		err = sc.RunChecks(
-			[]reg.PreCheck{
-				reg.MKImageVulnCheck(
-					&sc,
-					promotionEdges,
-					opts.SeverityThreshold,
-					nil,
-				),
-			},
+	if opts.TransformedDigestsFile != "" {
+		sc.TransformedDigest, err = reg.ParseTransformedDigestFromFile(
+			opts.TransformedDigestsFile,
 		)
 		if err != nil {
-			return errors.Wrap(err, "checking image vulnerabilities")
-		}
-	} else {
-		err = sc.Promote(promotionEdges, mkProducer, nil)
-		if err != nil {
-			return errors.Wrap(err, "promoting images")
+			return errors.Wrap(err, "parsing transformed digests")
 		}
 	}
 
-	if opts.SeverityThreshold >= 0 {
-		logrus.Info("********** FINISHED (VULN CHECK) **********")
+	if opts.TransformerPlugin != "" {
+		sc.TransformerPlugin = strings.Fields(opts.TransformerPlugin)
+		logrus.Warnf(
+			"Images will be rewritten by the transformer plugin %q before "+
+				"being pushed; destination digests will differ from the manifest",
+			opts.TransformerPlugin,
+		)
+	}
+
+	if opts.ShadowCommand != "" {
+		sc.ShadowCommand, err = reg.ParseShadowCommand(opts.ShadowCommand)
+		if err != nil {
+			return errors.Wrap(err, "parsing shadow command")
+		}
+		logrus.Warnf(
+			"Images will be copied by the shadow command %q instead of the promoter",
+			opts.ShadowCommand,
+		)
+	}
+
+	if opts.LayerConcurrency < 0 {
+		return errors.Errorf(
+			"--%s must not be negative", PromoterLayerConcurrencyFlag,
+		)
+	}
+	sc.LayerConcurrency = opts.LayerConcurrency
+
+	// Probe every route of the manifests (not only the edges still to be
+	// promoted), as any of them may be needed by the next real run.
+	if opts.DryRunWithAuth {
+		if err := sc.ProbeAuth(promotionEdges); err != nil {
+			return errors.Wrap(err, "probing registry authentication")
+		}
+	}
+
+	// Serialize promotions against the same destination(s). The lock is
+	// taken before reading the destination state, so that the edges computed
+	// below cannot be invalidated by a concurrent run.
+	if opts.LockFile != "" && opts.Confirm {
+		l, err := lock.New(opts.LockFile)
+		if err != nil {
+			return errors.Wrap(err, "creating promotion lock")
+		}
+
+		if err := l.Acquire(opts.LockTimeout); err != nil {
+			return errors.Wrap(err, "acquiring promotion lock")
+		}
+
+		defer func() {
+			if err := l.Release(); err != nil {
+				logrus.Errorf("Unable to release promotion lock: %v", err)
+			}
+		}()
+	}
+
+	// Extra destination tags are found against all the declared edges, not
+	// only the ones still to be promoted.
+	declaredEdges := promotionEdges
+
+	// If the inventory was loaded from a snapshot, do not read the registries
+	// again.
+	var (
+		ok       bool
+		failures reg.ManifestFailures
+	)
+	if opts.IsolateManifests {
+		promotionEdges, failures, ok = sc.FilterPromotionEdgesIsolated(
+			promotionEdges,
+			opts.InventoryFromSnapshot == "",
+			origins,
+		)
+		for _, name := range failures.Names() {
+			logrus.Errorf("Skipping all edges of %s: %s", name, failures[name])
+		}
+	} else {
+		promotionEdges, ok = sc.FilterPromotionEdges(
+			promotionEdges,
+			opts.InventoryFromSnapshot == "",
+		)
+	}
+
+	if explainer != nil {
+		explainer.Inventory(&sc)
+		explainer.Stage("edge filtering", promotionEdges)
+		fmt.Fprint(opts.out(), explainer.String())
+		return nil
+	}
+
+	// If any funny business was detected during a comparison of the manifests
+	// with the state of the registries, then exit immediately.
+	if !ok {
+		// An exhausted retry budget is reported as such, so that callers can
+		// tell it apart with errors.Is.
+		if err := sc.RetryBudget.Err(); err != nil {
+			return errors.Wrap(err, "reading registries")
+		}
+
+		return errors.New("encountered errors during edge filtering")
+	}
+
+	// The edges of a replay whose source is gone are reported, and fail the
+	// run once the others are promoted.
+	var lostSources []reg.CheckpointEntry
+	if opts.ReplayFrom != "" {
+		lostSources = sc.MissingSources(declaredEdges)
+		for _, entry := range lostSources {
+			logrus.Errorf(
+				"Cannot replay %s -> %s: the source digest no longer exists",
+				entry.Source,
+				entry.Destination,
+			)
+		}
+	}
+
+	if opts.ExtraTagPolicy != "" && opts.ExtraTagPolicy != reg.ExtraTagPolicyIgnore {
+		sc.HandleExtraTags(sc.FindExtraTags(declaredEdges), opts.ExtraTagPolicy)
+	}
+
+	var archFamilies []reg.ArchFamily
+	if archTagPattern != nil {
+		archFamilies = archTagPattern.Families(declaredEdges)
+		reportArchFamilies(archFamilies)
+	}
+
+	if missing := reg.MissingInUseImages(mfests, inUseImages, sc.Inv); len(missing) > 0 {
+		logrus.Warnf(
+			"%d in-use images were not found in their source registry: %s",
+			len(missing),
+			strings.Join(missing, ", "),
+		)
+	}
+
+	if resumed != nil {
+		promotionEdges = resumed.FilterEdges(promotionEdges)
+	}
+
+	deprecatedMediaTypes := make([]cr.MediaType, 0, len(opts.DeprecatedMediaTypes))
+	for _, mediaType := range opts.DeprecatedMediaTypes {
+		deprecatedMediaTypes = append(deprecatedMediaTypes, cr.MediaType(mediaType))
+	}
+	if err := sc.CheckDeprecatedMediaTypes(
+		promotionEdges,
+		deprecatedMediaTypes,
+		opts.RejectDeprecatedTypes,
+	); err != nil {
+		return errors.Wrap(err, "checking source image media types")
+	}
+
+	if opts.RequireSignedSource {
+		verifier, err := reg.NewSignatureVerifierFromFile(
+			opts.SignaturePublicKey,
+		)
+		if err != nil {
+			return errors.Wrap(err, "loading signature public key")
+		}
+
+		promotionEdges, err = sc.FilterSignedEdges(
+			promotionEdges,
+			verifier,
+			opts.DropUnsignedSource,
+		)
+		if err != nil {
+			return errors.Wrap(err, "verifying source image signatures")
+		}
+	}
+
+	if opts.RequireSBOM {
+		promotionEdges, err = sc.FilterEdgesWithSBOM(
+			promotionEdges,
+			reg.NewSBOMChecker(),
+			opts.DropMissingSBOM,
+		)
+		if err != nil {
+			return errors.Wrap(err, "checking source image SBOMs")
+		}
+	}
+
+	if opts.QuotaBytes > 0 {
+		if err := reg.CheckQuota(
+			sc.ProjectStorage(promotionEdges),
+			opts.QuotaBytes,
+			opts.QuotaWarnPercent,
+			opts.IgnoreQuota,
+		); err != nil {
+			return errors.Wrap(err, "checking storage quota")
+		}
+	}
+
+	if opts.CheckQuotaBefore {
+		// Like a quota which cannot be looked up, a client which cannot be
+		// created only fails the run with --strict.
+		producer, err := reg.MkMonitoringQuotaProducer(context.Background())
+		switch {
+		case err != nil && opts.Strict:
+			return errors.Wrap(err, "checking quota headroom")
+		case err != nil:
+			logrus.Warnf("Not checking quota headroom: %v", err)
+		default:
+			if err := reg.CheckQuotaHeadroom(
+				reg.DestinationProjects(promotionEdges),
+				opts.QuotaMetric,
+				opts.QuotaHeadroomPercent,
+				opts.Strict,
+				producer,
+			); err != nil {
+				return errors.Wrap(err, "checking quota headroom")
+			}
+		}
+	}
+
+	if opts.EstimateCost {
+		reg.WriteEgressEstimate(
+			opts.out(),
+			reg.EstimateEgressCost(
+				sc.ProjectStorage(promotionEdges),
+				opts.EgressRate,
+			),
+			opts.EgressRate,
+		)
+	}
+
+	if opts.SeverityThreshold >= 0 {
+		sc.SeverityMapping = severityMapping
+		vulnCheck := reg.MKImageVulnCheck(
+			&sc,
+			promotionEdges,
+			opts.SeverityThreshold,
+			nil,
+		)
+		vulnCheck.GitHubAnnotations = opts.GitHubAnnotations
+
+		err = sc.RunChecks([]reg.PreCheck{vulnCheck})
+
+		// Attach the findings even if the check failed, so that they are
+		// available to the policy engine either way.
+		if opts.AttachScanResults {
+			if attachErr := attachScanResults(opts, &sc, vulnCheck.Results); attachErr != nil {
+				logrus.Errorf("Unable to attach scan results: %v", attachErr)
+				if err == nil {
+					err = attachErr
+				}
+			}
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "checking image vulnerabilities")
+		}
+	} else {
+		// Only a real promotion has to be allowed by the gate.
+		if opts.Confirm {
+			if err := checkGate(opts, sc.Transport); err != nil {
+				return err
+			}
+		}
+
+		var cleanupRules []reg.CleanupRule
+		if opts.PostPromotionCleanup != "" {
+			cleanupRules, err = reg.ParseCleanupRulesFromFile(
+				opts.PostPromotionCleanup,
+			)
+			if err != nil {
+				return errors.Wrap(err, "parsing post-promotion cleanup rules")
+			}
+		}
+
+		var aliasRules []reg.TagAliasRule
+		if opts.TagAliases != "" {
+			aliasRules, err = reg.ParseTagAliasRulesFromFile(opts.TagAliases)
+			if err != nil {
+				return errors.Wrap(err, "parsing tag alias rules")
+			}
+		}
+
+		if !sc.Confirm {
+			sc.ReportPlan(promotionEdges)
+		}
+
+		// The snapshot of the destinations before the promotion, if the
+		// changes it makes are written to opts.PostRunDiff.
+		var preRunSnapshot reg.MasterInventory
+		if opts.PostRunDiff != "" {
+			if opts.Confirm {
+				preRunSnapshot, err = sc.DestinationSnapshot(
+					promotionEdges,
+					reg.MkReadRepositoryCmdReal,
+				)
+				if err != nil {
+					logrus.Errorf(
+						"Unable to snapshot the destinations before the promotion, not writing --%s: %v",
+						PromoterPostRunDiffFlag,
+						err,
+					)
+				}
+			} else {
+				logrus.Infof(
+					"Not writing --%s in a dry run, as nothing changes",
+					PromoterPostRunDiffFlag,
+				)
+			}
+		}
+
+		promotionStart := time.Now()
+		err = sc.Promote(promotionEdges, mkProducer, nil)
+
+		// The digests are recorded even if the promotion failed, so that the
+		// images which were transformed are not promoted again.
+		if opts.TransformedDigestsFile != "" && opts.Confirm {
+			if writeErr := sc.TransformedDigest.WriteToFile(
+				opts.TransformedDigestsFile,
+			); writeErr != nil && err == nil {
+				err = errors.Wrap(writeErr, "writing transformed digests")
+			}
+		}
+
+		if moves := sc.SourceTagMoves(); len(moves) > 0 {
+			logrus.Warnf(
+				"%d edges were aborted because their source tag moved:",
+				len(moves),
+			)
+			for _, move := range moves {
+				logrus.Warnf("  %s", move)
+			}
+		}
+
+		if len(sc.ShadowCommand) > 0 {
+			logShadowOutcomes(sc.PromotionResults)
+		}
+
+		if opts.IsolateManifests {
+			sc.ReportResultsByManifest(origins, failures)
+		}
+
+		// Write the report even if the promotion failed, as that is when
+		// it is needed the most.
+		if opts.JUnitOutput != "" {
+			if junitErr := writeJUnit(
+				opts.JUnitOutput,
+				sc.PromotionResults,
+			); junitErr != nil {
+				logrus.Errorf("Unable to write JUnit report: %v", junitErr)
+			}
+		}
+
+		if preRunSnapshot != nil {
+			if diffErr := writePostRunDiff(
+				opts,
+				&sc,
+				promotionEdges,
+				preRunSnapshot,
+			); diffErr != nil {
+				logrus.Errorf("Unable to write post-run diff: %v", diffErr)
+			}
+		}
+
+		if opts.MarkdownSummary != "" {
+			if summaryErr := writeMarkdownSummary(
+				opts.MarkdownSummary,
+				sc.PromotionResults,
+				time.Since(promotionStart),
+			); summaryErr != nil {
+				logrus.Errorf("Unable to write markdown summary: %v", summaryErr)
+			}
+		}
+
+		if opts.Slowest > 0 && opts.Confirm {
+			reg.WriteSlowestCopies(opts.out(), sc.PromotionResults, opts.Slowest)
+		}
+
+		if err != nil {
+			return errors.Wrap(err, "promoting images")
+		}
+
+		if opts.DigestsOutput != "" && opts.Confirm {
+			if err := writeDigests(opts.DigestsOutput, &sc); err != nil {
+				return errors.Wrap(err, "writing promoted digests")
+			}
+		}
+
+		if aliasRules != nil {
+			if err := addTagAliases(opts, &sc, aliasRules); err != nil {
+				return errors.Wrap(err, "adding tag aliases")
+			}
+		}
+
+		if opts.AssembleManifestList {
+			if err := sc.AssembleManifestLists(archFamilies); err != nil {
+				return errors.Wrap(err, "assembling manifest lists")
+			}
+		}
+
+		if len(failures) > 0 {
+			return errors.Errorf(
+				"the edges of %d manifest(s) were not promoted",
+				len(failures),
+			)
+		}
+
+		if opts.MoveMode {
+			if err := removeSourceTags(opts, &sc, declaredEdges); err != nil {
+				return errors.Wrap(err, "removing moved source tags")
+			}
+		}
+
+		if cleanupRules != nil {
+			if err := cleanupTags(opts, &sc, cleanupRules); err != nil {
+				return errors.Wrap(err, "cleaning up superseded tags")
+			}
+		}
+
+		if len(lostSources) > 0 {
+			return errors.Errorf(
+				"%d replayed edges were not promoted as their source digest no longer exists",
+				len(lostSources),
+			)
+		}
+
+		// The state would let the next run skip the edges which were
+		// ignored or failed without failing this run, so it is only written
+		// once everything was promoted.
+		if promotionSignature != "" && opts.Confirm {
+			if len(sc.Logs.Errors) > 0 || len(sc.InvIgnore) > 0 {
+				logrus.Warnf(
+					"Not writing the promotion state, as %d errors were encountered and %d images were ignored",
+					len(sc.Logs.Errors),
+					len(sc.InvIgnore),
+				)
+			} else {
+				state := reg.PromotionState{
+					Signature: promotionSignature,
+					Promoted:  time.Now(),
+				}
+				if err := state.WriteToFile(opts.StateFile); err != nil {
+					return errors.Wrap(err, "writing promotion state")
+				}
+			}
+		}
+	}
+
+	sc.LogTimings()
+
+	if opts.SeverityThreshold >= 0 {
+		logrus.Info("********** FINISHED (VULN CHECK) **********")
 	} else if opts.Confirm {
 		logrus.Info("********** FINISHED **********")
 	} else {
@@ -372,7 +1572,1514 @@ necessarily mean that a new version of the image layer is available.`,
 	return nil
 }
 
-func validateImageOptions(o *RunOptions) error {
-	// TODO: Validate options
+// finishSnapshotCheckpoint removes the snapshot checkpoint once the registry
+// was read completely. Otherwise, the snapshot would be incomplete, so the
+// checkpoint is written for a rerun to resume from, and an error is returned.
+func finishSnapshotCheckpoint(sc *reg.SyncContext, opts *RunOptions) error {
+	if sc.SnapshotCheckpointer == nil {
+		return nil
+	}
+
+	if len(sc.Logs.Errors) > 0 {
+		if err := sc.SnapshotCheckpointer.Flush(); err != nil {
+			logrus.Errorf("Unable to write snapshot checkpoint: %v", err)
+		}
+
+		return errors.Errorf(
+			"reading %d repositories failed; rerun to resume from %s",
+			len(sc.Logs.Errors),
+			opts.SnapshotCheckpoint,
+		)
+	}
+
+	return errors.Wrap(
+		sc.SnapshotCheckpointer.Remove(),
+		"removing snapshot checkpoint",
+	)
+}
+
+// renderSnapshot serializes rii in the given output format, falling back to
+// YAML for unknown formats.
+func renderSnapshot(rii reg.RegInvImage, outputFormat string) string {
+	switch strings.ToLower(outputFormat) {
+	case "csv":
+		return rii.ToCSV()
+	case "yaml":
+		return rii.ToYAML(reg.YamlMarshalingOpts{})
+	default:
+		logrus.Errorf(
+			"invalid value %s for '--%s'; defaulting to %s",
+			outputFormat,
+			PromoterOutputFlag,
+			PromoterDefaultOutputFormat,
+		)
+
+		return rii.ToYAML(reg.YamlMarshalingOpts{})
+	}
+}
+
+// renderTagSnapshot is renderSnapshot, but with the snapshot keyed by tag.
+func renderTagSnapshot(rii reg.RegInvImage, outputFormat string) string {
+	snapshot := rii.ToTagSnapshot()
+	if strings.EqualFold(outputFormat, "csv") {
+		return snapshot.ToCSV()
+	}
+
+	return snapshot.ToYAML()
+}
+
+// printConfig writes the effective options (including those read from a config
+// file) to stderr as YAML. Options which may point to credentials, or carry
+// them, are redacted.
+func printConfig(opts *RunOptions) error {
+	redacted := *opts
+	if redacted.KeyFiles != "" {
+		redacted.KeyFiles = redactedValue
+	}
+	if redacted.TokenAuthPassword != "" {
+		redacted.TokenAuthPassword = redactedValue
+	}
+	if redacted.ServeToken != "" {
+		redacted.ServeToken = redactedValue
+	}
+	redacted.PushgatewayURL = redactURL(redacted.PushgatewayURL)
+	redacted.GateURL = redactURL(redacted.GateURL)
+	redacted.CloudEventsSink = redactURL(redacted.CloudEventsSink)
+
+	b, err := yaml.Marshal(&redacted)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Effective options:\n%s", b)
+	return nil
+}
+
+// redactURL replaces the password of the URL, if any, so that it can be
+// logged.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return u.Redacted()
+}
+
+// verifyManifestSignatures checks the detached signatures of the manifest
+// files given by opts against opts.ManifestPublicKey.
+func verifyManifestSignatures(opts *RunOptions) error {
+	verifier, err := reg.NewSignatureVerifierFromFile(opts.ManifestPublicKey)
+	if err != nil {
+		return errors.Wrap(err, "loading manifest public key")
+	}
+
+	var files []string
+	if opts.Manifest != "" {
+		files = []string{opts.Manifest}
+	} else {
+		files, err = reg.ThinManifestFiles(opts.ThinManifestDir)
+		if err != nil {
+			return errors.Wrap(err, "listing thin manifest files")
+		}
+	}
+
+	if err := reg.VerifyManifestFiles(verifier, files); err != nil {
+		return err
+	}
+
+	logrus.Infof("Verified the signatures of %d manifest files", len(files))
+	return nil
+}
+
+// attachScanResults attaches the vulnerability scan results to the scanned
+// images as cosign attestations.
+func attachScanResults(
+	opts *RunOptions,
+	sc *reg.SyncContext,
+	results []reg.ScanResult,
+) error {
+	mkAttestCmd := func(fqin, predicateFile string) stream.Producer {
+		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
+		sp.CmdInvocation = reg.GetAttestCmd(fqin, predicateFile, opts.AttestationKey)
+		return &sp
+	}
+
+	return sc.AttachScanResults(results, mkAttestCmd)
+}
+
+// rewrittenEdges returns the promotion edges of the manifests, with the
+// destination image names rewritten by the image name map.
+func rewrittenEdges(
+	mfests []reg.Manifest,
+	imageNameMap reg.ImageNameMap,
+) (map[reg.PromotionEdge]interface{}, error) {
+	edges, err := reg.ToPromotionEdges(mfests)
+	if err != nil {
+		return nil, errors.Wrap(err, "converting list of manifests to edges for promotion")
+	}
+
+	edges, err = imageNameMap.RewriteEdges(edges)
+	if err != nil {
+		return nil, errors.Wrap(err, "rewriting destination image names")
+	}
+
+	return edges, nil
+}
+
+// printImageNameRewrites prints the destination image names which differ from
+// their source image names after applying the image name map.
+func printImageNameRewrites(
+	w io.Writer,
+	mfests []reg.Manifest,
+	imageNameMap reg.ImageNameMap,
+) error {
+	edges, err := rewrittenEdges(mfests, imageNameMap)
+	if err != nil {
+		return err
+	}
+
+	rewrites := make(map[string]interface{})
+	for edge := range edges {
+		if edge.SrcImageTag.ImageName == edge.DstImageTag.ImageName {
+			continue
+		}
+
+		rewrites[fmt.Sprintf(
+			"%s -> %s",
+			reg.ToLQIN(edge.SrcRegistry.Name, edge.SrcImageTag.ImageName),
+			reg.ToLQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName),
+		)] = nil
+	}
+
+	lines := make([]string, 0, len(rewrites))
+	for rewrite := range rewrites {
+		lines = append(lines, rewrite)
+	}
+	sort.Strings(lines)
+
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+
+	return nil
+}
+
+// printPromotedTags prints the destination tags which the edges create, along
+// with their digests.
+func printPromotedTags(w io.Writer, edges map[reg.PromotionEdge]interface{}) {
+	lines := make([]string, 0, len(edges))
+	for edge := range edges {
+		lines = append(lines, fmt.Sprintf(
+			"%s (at %s)",
+			reg.ToPQIN(
+				edge.DstRegistry.Name,
+				edge.DstImageTag.ImageName,
+				edge.DstImageTag.Tag,
+			),
+			edge.Digest,
+		))
+	}
+	sort.Strings(lines)
+
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// lintManifests prints the best practice violations found in the manifests.
+// They only fail the run with --strict.
+func lintManifests(mfests []reg.Manifest, opts *RunOptions) error {
+	findings := reg.LintManifests(mfests, opts.UseServiceAcct)
+	for _, finding := range findings {
+		fmt.Fprintln(opts.out(), finding)
+	}
+
+	writeDiagnostics(opts, reg.DiagnoseLintFindings(findings))
+
+	if opts.Strict && len(findings) > 0 {
+		return errors.Errorf("found %d manifest lint issues", len(findings))
+	}
+
+	return nil
+}
+
+// writeDiagnostics writes the problems found while validating to
+// --diagnostics-output, if it is set. A failure to write them is only logged,
+// so that it does not hide the problems themselves.
+func writeDiagnostics(opts *RunOptions, diagnostics []reg.Diagnostic) {
+	if opts.DiagnosticsOutput == "" {
+		return
+	}
+
+	if err := reg.WriteDiagnostics(opts.DiagnosticsOutput, diagnostics); err != nil {
+		logrus.Errorf("Unable to write diagnostics: %v", err)
+	}
+}
+
+// writeManifestDiagnostics writes the diagnostics of manifests which could not
+// be parsed. If none of the problems could be pinned down, the parse error
+// itself is written.
+func writeManifestDiagnostics(
+	opts *RunOptions,
+	diagnostics []reg.Diagnostic,
+	file string,
+	err error,
+) {
+	if len(diagnostics) == 0 {
+		diagnostics = []reg.Diagnostic{
+			reg.DiagnoseError(reg.DiagnosticInvalidManifest, file, err),
+		}
+	}
+
+	writeDiagnostics(opts, diagnostics)
+}
+
+// commandLogLevel returns the level at which external commands are logged,
+// or nil if they are not.
+func commandLogLevel(opts *RunOptions) *logrus.Level {
+	if opts.LogCommands == "" {
+		return nil
+	}
+
+	// The level has already been validated.
+	level, _ := logrus.ParseLevel(opts.LogCommands)
+	return &level
+}
+
+// checkAllowedDestinations fails if any destination registry of the
+// manifests is not matched by opts.AllowedDestinations. An empty allowlist
+// allows every destination.
+func checkAllowedDestinations(mfests []reg.Manifest, opts *RunOptions) error {
+	if len(opts.AllowedDestinations) == 0 {
+		return nil
+	}
+
+	return errors.Wrap(
+		reg.CheckAllowedDestinations(mfests, opts.AllowedDestinations),
+		"checking destination registries",
+	)
+}
+
+// manifestListMediaTypeNames returns the accepted values of
+// --manifest-list-media-type, sorted.
+func manifestListMediaTypeNames() []string {
+	names := make([]string, 0, len(reg.ManifestListMediaTypes))
+	for name := range reg.ManifestListMediaTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+const (
+	// PromotedImageEventType is the type of the CloudEvents sent for every
+	// promoted image.
+	PromotedImageEventType = "dev.kpromo.image.promoted"
+
+	// PromotedImageEventSource is the source of the CloudEvents sent by cip.
+	PromotedImageEventSource = "/kpromo/cip"
+)
+
+// emitCloudEvents sends a CloudEvent for every image promoted by sc to
+// opts.CloudEventsSink. Failures are logged, but do not fail the run.
+func emitCloudEvents(opts *RunOptions, sc *reg.SyncContext) {
+	images := sc.PromotedImages()
+	if len(images) == 0 {
+		return
+	}
+
+	events := make([]cloudevents.Event, 0, len(images))
+	for i := range images {
+		events = append(events, cloudevents.New(
+			PromotedImageEventType,
+			PromotedImageEventSource,
+			images[i].Destination+"@"+string(images[i].Digest),
+			images[i],
+		))
+	}
+
+	undelivered, err := cloudevents.Send(
+		opts.CloudEventsSink,
+		events,
+		sc.Transport,
+	)
+	if err != nil {
+		logrus.Errorf("Unable to send CloudEvents: %v", err)
+	}
+
+	logrus.Infof(
+		"CloudEvents: %d delivered, %d undelivered",
+		len(events)-undelivered,
+		undelivered,
+	)
+}
+
+// pushMetrics pushes the final metrics of the run to the pushgateway at
+// opts.PushgatewayURL. Failures are logged, but do not fail the run.
+func pushMetrics(opts *RunOptions, sc *reg.SyncContext, duration time.Duration) {
+	var promoted, failed, promotedBytes float64
+	for _, result := range sc.PromotionResults {
+		switch {
+		case result.Skipped:
+		case len(result.Errors) > 0:
+			failed++
+		default:
+			promoted++
+			promotedBytes += float64(sc.DigestImageSize[result.Request.Digest])
+		}
+	}
+
+	gauges := []metrics.Gauge{
+		{
+			Name:  "cip_edges_promoted",
+			Help:  "Number of promotion edges copied successfully.",
+			Value: promoted,
+		},
+		{
+			Name:  "cip_edges_failed",
+			Help:  "Number of promotion edges which failed to copy.",
+			Value: failed,
+		},
+		{
+			Name:  "cip_promoted_bytes",
+			Help:  "Total size of the images copied successfully.",
+			Value: promotedBytes,
+		},
+		{
+			Name:  "cip_run_duration_seconds",
+			Help:  "Duration of the run.",
+			Value: duration.Seconds(),
+		},
+	}
+
+	if err := metrics.Push(
+		opts.PushgatewayURL,
+		pushgatewayJob(opts),
+		gauges,
+		sc.Transport,
+	); err != nil {
+		logrus.Errorf("Unable to push metrics: %v", err)
+	}
+}
+
+// pushgatewayJob names the pushgateway job after the kind of run.
+func pushgatewayJob(opts *RunOptions) string {
+	switch {
+	case opts.Snapshot != "" || opts.ManifestBasedSnapshotOf != "":
+		return "cip_snapshot"
+	case opts.Confirm:
+		return "cip_promotion"
+	default:
+		return "cip_dry_run"
+	}
+}
+
+// writeJUnit writes the promotion results to filePath as a JUnit XML report.
+func writeJUnit(filePath string, results []reg.PromotionResult) error {
+	var b bytes.Buffer
+	if err := reg.WriteJUnit(&b, results); err != nil {
+		return errors.Wrap(err, "writing JUnit report")
+	}
+
+	return errors.Wrap(upload.Write(filePath, b.Bytes()), "writing JUnit report")
+}
+
+// writeMarkdownSummary writes the promotion results to filePath as a
+// markdown summary.
+func writeMarkdownSummary(
+	filePath string,
+	results []reg.PromotionResult,
+	duration time.Duration,
+) error {
+	var b bytes.Buffer
+	if err := reg.WriteMarkdownSummary(
+		&b,
+		results,
+		duration,
+		version.Get().GitVersion,
+	); err != nil {
+		return errors.Wrap(err, "writing markdown summary")
+	}
+
+	return errors.Wrap(
+		upload.Write(filePath, b.Bytes()),
+		"writing markdown summary",
+	)
+}
+
+// writeDigests writes the destination digest references of the images
+// promoted by sc to location.
+func writeDigests(location string, sc *reg.SyncContext) error {
+	digests, err := sc.PromotedDigests()
+	if err != nil {
+		return err
+	}
+
+	b, err := yaml.Marshal(digests)
+	if err != nil {
+		return err
+	}
+
+	if err := upload.Write(location, b); err != nil {
+		return err
+	}
+
+	logrus.Infof("Wrote %d promoted digests to %s", len(digests), location)
+	return nil
+}
+
+// cleanupTags deletes the tags superseded by the images promoted by sc, as
+// named by the rules.
+func cleanupTags(
+	opts *RunOptions,
+	sc *reg.SyncContext,
+	rules []reg.CleanupRule,
+) error {
+	cleanups := sc.PlanTagCleanup(rules)
+	logrus.Infof("Found %d superseded tags to clean up", len(cleanups))
+
+	// Only the superseded tag is removed; deleting its digest would also
+	// remove any other tags still pointing to it.
+	mkUntagCmd := func(cleanup reg.TagCleanup) stream.Producer {
+		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
+		sp.CmdInvocation = reg.GetWriteCmd(
+			cleanup.Registry,
+			sc.UseServiceAccount,
+			"",
+			"",
+			cleanup.ImageName,
+			cleanup.Digest,
+			cleanup.Tag,
+			reg.Delete,
+		)
+		return &sp
+	}
+
+	return sc.CleanupTags(cleanups, mkUntagCmd)
+}
+
+// addTagAliases adds the alias tags derived by the rules from the tags
+// promoted by sc. Conflicting aliases are reported, and fail the run once the
+// other aliases have been added.
+func addTagAliases(
+	opts *RunOptions,
+	sc *reg.SyncContext,
+	rules []reg.TagAliasRule,
+) error {
+	aliases, conflicts, err := sc.PlanTagAliases(rules)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Found %d tag aliases to add", len(aliases))
+
+	for _, conflict := range conflicts {
+		logrus.Errorf("Conflicting tag alias %s", conflict)
+	}
+
+	mkAddTagCmd := func(alias reg.TagAlias) stream.Producer {
+		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
+		sp.CmdInvocation = reg.GetWriteCmd(
+			alias.Registry,
+			sc.UseServiceAccount,
+			"",
+			"",
+			alias.ImageName,
+			alias.Digest,
+			alias.Tag,
+			reg.Add,
+		)
+		return &sp
+	}
+
+	if err := sc.CreateTagAliases(aliases, mkAddTagCmd); err != nil {
+		return err
+	}
+
+	if len(conflicts) > 0 {
+		return errors.Errorf(
+			"%d tag aliases conflict with other tags: %s",
+			len(conflicts),
+			strings.Join(conflicts, "; "),
+		)
+	}
+
+	return nil
+}
+
+// reportArchFamilies logs how many arch tag families were found, and warns
+// about the incomplete ones.
+func reportArchFamilies(families []reg.ArchFamily) {
+	incomplete := 0
+	for i := range families {
+		if len(families[i].Missing) == 0 {
+			continue
+		}
+
+		incomplete++
+		logrus.Warnf(
+			"Incomplete arch tag family %s: missing %s",
+			&families[i],
+			strings.Join(families[i].Missing, ", "),
+		)
+	}
+
+	logrus.Infof(
+		"Found %d arch tag families (%d incomplete)",
+		len(families),
+		incomplete,
+	)
+}
+
+// logShadowOutcomes logs how many requests executed by the shadow command
+// had the expected outcome, and the details of the others.
+func logShadowOutcomes(results []reg.PromotionResult) {
+	total, mismatched := 0, 0
+	for _, result := range results {
+		if result.Shadow == nil {
+			continue
+		}
+
+		total++
+		if result.Shadow.Error != nil {
+			mismatched++
+			logrus.Warnf(
+				"Shadow command differs from the promoter for %s: %v\n%s",
+				result.Request.PrettyValue(),
+				result.Shadow.Error,
+				result.Shadow.Output,
+			)
+		}
+	}
+
+	logrus.Infof(
+		"Shadow command matched the promoter for %d of %d requests",
+		total-mismatched,
+		total,
+	)
+}
+
+// makeSyncContext creates the SyncContext of a run. Its ReadThreads and
+// WriteThreads default to Threads, see reg.SyncContext. Every mode creates its
+// SyncContext with it, so that all of them talk to the registries through the
+// client certificate and the --allowed-hosts allowlist.
+func makeSyncContext(mfests []reg.Manifest, opts *RunOptions) (reg.SyncContext, error) {
+	sc, err := reg.MakeSyncContext(
+		mfests,
+		opts.Threads,
+		opts.Confirm,
+		opts.UseServiceAcct,
+	)
+	if err != nil {
+		return reg.SyncContext{}, err
+	}
+
+	sc.ReadThreads = opts.ReadThreads
+	sc.WriteThreads = opts.WriteThreads
+	sc.PruneMinAge = opts.PruneMinAge
+
+	if opts.ClientCertFile != "" {
+		sc.Transport, err = reg.NewClientCertTransport(
+			opts.ClientCertFile,
+			opts.ClientKeyFile,
+		)
+		if err != nil {
+			return reg.SyncContext{}, err
+		}
+	}
+
+	if len(opts.AllowedHosts) > 0 {
+		allowlist, err := reg.ParseHostAllowlist(opts.AllowedHosts)
+		if err != nil {
+			return reg.SyncContext{}, err
+		}
+
+		if err := allowlist.CheckRegistries(sc.RegistryContexts); err != nil {
+			return reg.SyncContext{}, err
+		}
+
+		if err := allowlist.CheckURLs(
+			opts.PushgatewayURL,
+			opts.CloudEventsSink,
+		); err != nil {
+			return reg.SyncContext{}, err
+		}
+
+		sc.Transport = reg.NewAllowlistTransport(allowlist, sc.Transport)
+		if opts.UseServiceAcct {
+			logrus.Warnf(
+				"The hosts gcloud talks to when fetching access tokens are not restricted by --%s",
+				PromoterAllowedHostsFlag,
+			)
+		}
+	}
+
+	return sc, nil
+}
+
+// removeSourceTags removes the source tags of the images moved by sc, which
+// are no longer needed by any of the declared edges.
+func removeSourceTags(
+	opts *RunOptions,
+	sc *reg.SyncContext,
+	declared map[reg.PromotionEdge]interface{},
+) error {
+	removals := sc.PlanSourceTagRemovals(declared)
+	logrus.Infof("Found %d source images to remove tags from", len(removals))
+
+	mkUntagCmd := func(removal reg.SourceTagRemoval, tag reg.Tag) stream.Producer {
+		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
+		sp.CmdInvocation = reg.GetWriteCmd(
+			removal.Registry,
+			sc.UseServiceAccount,
+			"",
+			"",
+			removal.ImageName,
+			removal.Digest,
+			tag,
+			reg.Delete,
+		)
+		return &sp
+	}
+
+	// The digest is deleted without its tags, so that it is kept if it was
+	// tagged again in the meantime.
+	mkDeleteCmd := func(removal reg.SourceTagRemoval) stream.Producer {
+		var sp stream.Subprocess
+		sp.LogLevel = commandLogLevel(opts)
+		sp.CmdInvocation = reg.GetDeleteCmd(
+			removal.Registry,
+			sc.UseServiceAccount,
+			removal.ImageName,
+			removal.Digest,
+			false,
+		)
+		return &sp
+	}
+
+	return sc.RemoveSourceTags(removals, mkUntagCmd, mkDeleteCmd)
+}
+
+// writeGraph writes the dependency graph of the images in rii, which were
+// read from srcRegistry, to location.
+func writeGraph(
+	location string,
+	sc *reg.SyncContext,
+	srcRegistry *reg.RegistryContext,
+	rii reg.RegInvImage,
+) error {
+	// A snapshot based on the manifests alone does not read the registry,
+	// but the media types found in it are needed to find manifest lists.
+	if _, ok := sc.Inv[srcRegistry.Name]; !ok {
+		if err := sc.ReadRegistries(
+			[]reg.RegistryContext{*srcRegistry},
+			true,
+			reg.MkReadRepositoryCmdReal,
+		); err != nil {
+			return err
+		}
+	}
+
+	if len(sc.ListPlatforms) == 0 {
+		sc.ReadGCRManifestLists(reg.MkReadManifestListCmdReal)
+	}
+
+	if err := upload.Write(location, []byte(sc.DependencyGraph(rii))); err != nil {
+		return err
+	}
+
+	logrus.Infof("Wrote dependency graph to %s", location)
+	return nil
+}
+
+// checkSnapshotDelta compares rii, the snapshot of registryName, to the
+// snapshot stored in baselineFile.
+func checkSnapshotDelta(
+	rii reg.RegInvImage,
+	registryName reg.RegistryName,
+	baselineFile string,
+	maxDelta float64,
+) error {
+	baseline, err := readSnapshotBaseline(registryName, baselineFile)
+	if err != nil {
+		return err
+	}
+
+	return reg.CheckSnapshotDelta(baseline, rii, maxDelta)
+}
+
+// readSnapshotBaseline reads the snapshot of registryName stored in
+// baselineFile. A snapshot without registry information is assumed to be of
+// registryName.
+func readSnapshotBaseline(
+	registryName reg.RegistryName,
+	baselineFile string,
+) (reg.RegInvImage, error) {
+	b, err := ioutil.ReadFile(baselineFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading snapshot baseline")
+	}
+
+	mi, err := reg.ParseSnapshotYAML(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing snapshot baseline %s", baselineFile)
+	}
+
+	baseline, ok := mi[registryName]
+	if !ok {
+		baseline, ok = mi[""]
+	}
+	if !ok {
+		return nil, errors.Errorf(
+			"snapshot baseline %s does not contain %s",
+			baselineFile,
+			registryName,
+		)
+	}
+
+	return baseline, nil
+}
+
+// renderSnapshotDiff classifies the changes between the snapshot stored in
+// baselineFile and rii, the current snapshot of registryName. They are
+// rendered as JSON if outputFormat is "json", and as YAML otherwise.
+func renderSnapshotDiff(
+	rii reg.RegInvImage,
+	registryName reg.RegistryName,
+	baselineFile string,
+	outputFormat string,
+) (string, error) {
+	baseline, err := readSnapshotBaseline(registryName, baselineFile)
+	if err != nil {
+		return "", err
+	}
+
+	changes := reg.DiffSnapshots(baseline, rii)
+	for _, change := range changes {
+		if change.Kind == reg.TagMoved {
+			logrus.Warnf("Tag moved: %s", change)
+		}
+	}
+
+	var b []byte
+	if strings.EqualFold(outputFormat, "json") {
+		b, err = json.MarshalIndent(changes, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(changes)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "serializing snapshot changes")
+	}
+
+	return string(b), nil
+}
+
+// renderVulnerableImages renders the images of the snapshot rii of
+// registryName which have at least one vulnerability finding, annotated with
+// their highest severity, as JSON (if outputFormat is "json") or YAML.
+func renderVulnerableImages(
+	sc *reg.SyncContext,
+	rii reg.RegInvImage,
+	registryName reg.RegistryName,
+	outputFormat string,
+) (string, error) {
+	vulnerable, err := sc.FindVulnerableImages(registryName, rii, nil)
+	if err != nil {
+		return "", err
+	}
+
+	logrus.Infof("Found %d vulnerable images", len(vulnerable))
+
+	var b []byte
+	if strings.EqualFold(outputFormat, "json") {
+		b, err = json.MarshalIndent(vulnerable, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(vulnerable)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "serializing vulnerable images")
+	}
+
+	return string(b), nil
+}
+
+// renderAttachmentStatus renders the images of the snapshot rii of
+// registryName, annotated with the attachments they have.
+func renderAttachmentStatus(
+	sc *reg.SyncContext,
+	rii reg.RegInvImage,
+	registryName reg.RegistryName,
+	outputFormat string,
+) (string, error) {
+	images, err := sc.FindAttachmentStatus(
+		registryName,
+		rii,
+		reg.NewAttachmentChecker(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := 0
+	for _, image := range images {
+		if !image.HasSignature {
+			unsigned++
+		}
+	}
+	logrus.Infof("Checked %d images, %d of them unsigned", len(images), unsigned)
+
+	var b []byte
+	if strings.EqualFold(outputFormat, "json") {
+		b, err = json.MarshalIndent(images, "", "  ")
+		b = append(b, '\n')
+	} else {
+		b, err = yaml.Marshal(images)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "serializing attachment status")
+	}
+
+	return string(b), nil
+}
+
+// renderGeneratedManifest renders a promoter manifest for the images of the
+// snapshot rii of registryName (whose name starts with prefix), with a
+// placeholder destination registry.
+func renderGeneratedManifest(
+	rii reg.RegInvImage,
+	registryName reg.RegistryName,
+	prefix string,
+) (string, error) {
+	m, err := reg.GenerateManifest(registryName, rii, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := m.ToYAML()
+	if err != nil {
+		return "", errors.Wrap(err, "serializing manifest")
+	}
+
+	logrus.Infof(
+		"Generated a manifest with %d images; replace the destination registry %s before using it",
+		len(m.Images),
+		reg.PlaceholderDestRegistry,
+	)
+
+	return fmt.Sprintf(
+		"# Generated from %s. Replace %s with the\n# destination registries before using this manifest.\n%s",
+		registryName,
+		reg.PlaceholderDestRegistry,
+		out,
+	), nil
+}
+
+// resolveMode reconciles opts.Mode with the deprecated opts.Confirm, which
+// is an alias of the apply mode. Afterwards, opts.Confirm is set if and only
+// if the mode is apply.
+func resolveMode(o *RunOptions) error {
+	switch o.Mode {
+	case "":
+		o.Mode = ModePlan
+		if o.Confirm {
+			o.Mode = ModeApply
+		}
+	case ModePlan:
+		if o.Confirm {
+			return errors.Errorf(
+				"--%s=%s cannot be used with --%s",
+				PromoterModeFlag,
+				ModePlan,
+				PromoterConfirmFlag,
+			)
+		}
+	case ModeApply:
+		o.Confirm = true
+	default:
+		return errors.Errorf(
+			"invalid value %q for --%s; expected %q or %q",
+			o.Mode,
+			PromoterModeFlag,
+			ModePlan,
+			ModeApply,
+		)
+	}
+
+	return nil
+}
+
+func validateImageOptions(o *RunOptions) error {
+	if o.SnapshotBaseline != "" &&
+		o.Snapshot == "" && o.ManifestBasedSnapshotOf == "" {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterSnapshotBaselineFlag,
+			PromoterSnapshotFlag,
+			PromoterManifestBasedSnapshotOfFlag,
+		)
+	}
+
+	if o.SnapshotDiff != "" &&
+		o.Snapshot == "" && o.ManifestBasedSnapshotOf == "" {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterSnapshotDiffFlag,
+			PromoterSnapshotFlag,
+			PromoterManifestBasedSnapshotOfFlag,
+		)
+	}
+
+	if o.GenerateManifestPrefix != "" && !o.GenerateManifest {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterGenerateManifestPrefixFlag,
+			PromoterGenerateManifestFlag,
+		)
+	}
+
+	if o.GenerateManifest && o.Snapshot == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterGenerateManifestFlag,
+			PromoterSnapshotFlag,
+		)
+	}
+
+	if o.GenerateManifest &&
+		(o.SnapshotDiff != "" || o.SnapshotHash || o.OnlyVulnerable) {
+		return errors.Errorf(
+			"--%s cannot be used with --%s, --%s or --%s",
+			PromoterGenerateManifestFlag,
+			PromoterSnapshotDiffFlag,
+			PromoterSnapshotHashFlag,
+			PromoterOnlyVulnerableFlag,
+		)
+	}
+
+	if o.OnlyVulnerable && o.Snapshot == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterOnlyVulnerableFlag,
+			PromoterSnapshotFlag,
+		)
+	}
+
+	if o.OnlyVulnerable && (o.SnapshotDiff != "" || o.SnapshotHash) {
+		return errors.Errorf(
+			"--%s cannot be used with --%s or --%s",
+			PromoterOnlyVulnerableFlag,
+			PromoterSnapshotDiffFlag,
+			PromoterSnapshotHashFlag,
+		)
+	}
+
+	if o.SnapshotCheckpoint != "" && o.Snapshot == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterSnapshotCheckpointFlag,
+			PromoterSnapshotFlag,
+		)
+	}
+
+	if o.UpdateLock && o.LockfilePath == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterUpdateLockFlag,
+			PromoterDigestLockfileFlag,
+		)
+	}
+
+	if o.IncludeAttachmentStatus && o.Snapshot == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterIncludeAttachmentStatusFlag,
+			PromoterSnapshotFlag,
+		)
+	}
+
+	if o.IncludeAttachmentStatus &&
+		(o.SnapshotDiff != "" || o.SnapshotHash || o.OnlyVulnerable || o.GenerateManifest) {
+		return errors.Errorf(
+			"--%s cannot be used with --%s, --%s, --%s or --%s",
+			PromoterIncludeAttachmentStatusFlag,
+			PromoterSnapshotDiffFlag,
+			PromoterSnapshotHashFlag,
+			PromoterOnlyVulnerableFlag,
+			PromoterGenerateManifestFlag,
+		)
+	}
+
+	if o.SnapshotByTag &&
+		o.Snapshot == "" && o.ManifestBasedSnapshotOf == "" {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterSnapshotByTagFlag,
+			PromoterSnapshotFlag,
+			PromoterManifestBasedSnapshotOfFlag,
+		)
+	}
+
+	if o.SnapshotByTag &&
+		(o.SnapshotDiff != "" || o.SnapshotHash || o.OnlyVulnerable ||
+			o.IncludeAttachmentStatus || o.GenerateManifest) {
+		return errors.Errorf(
+			"--%s cannot be used with --%s, --%s, --%s, --%s or --%s",
+			PromoterSnapshotByTagFlag,
+			PromoterSnapshotDiffFlag,
+			PromoterSnapshotHashFlag,
+			PromoterOnlyVulnerableFlag,
+			PromoterIncludeAttachmentStatusFlag,
+			PromoterGenerateManifestFlag,
+		)
+	}
+
+	if o.SnapshotDiff != "" && o.SnapshotHash {
+		return errors.Errorf(
+			"--%s and --%s are mutually exclusive",
+			PromoterSnapshotDiffFlag,
+			PromoterSnapshotHashFlag,
+		)
+	}
+
+	if o.SnapshotHash &&
+		o.Snapshot == "" && o.ManifestBasedSnapshotOf == "" {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterSnapshotHashFlag,
+			PromoterSnapshotFlag,
+			PromoterManifestBasedSnapshotOfFlag,
+		)
+	}
+
+	if o.MaxSnapshotDelta < 0 {
+		return errors.Errorf(
+			"--%s must not be negative", PromoterMaxSnapshotDeltaFlag,
+		)
+	}
+
+	// Keyless verification would need a Fulcio root and a Rekor client.
+	if o.RequireSignedSource && o.SignaturePublicKey == "" {
+		return errors.Errorf(
+			"--%s requires --%s (keyless verification is not supported)",
+			PromoterRequireSignedSourceFlag,
+			PromoterSignaturePublicKeyFlag,
+		)
+	}
+
+	if err := reg.ValidateDestinationPatterns(o.AllowedDestinations); err != nil {
+		return errors.Wrapf(err, "parsing --%s", PromoterAllowedDestinationsFlag)
+	}
+
+	if o.ManifestListMediaType != "" {
+		if _, ok := reg.ManifestListMediaTypes[o.ManifestListMediaType]; !ok {
+			return errors.Errorf(
+				"invalid value %q for --%s; expected one of %q",
+				o.ManifestListMediaType,
+				PromoterManifestListMediaTypeFlag,
+				manifestListMediaTypeNames(),
+			)
+		}
+	}
+
+	if o.DryRunWithAuth && o.Confirm {
+		return errors.Errorf(
+			"--%s only applies to dry runs and cannot be used with --%s=%s",
+			PromoterDryRunWithAuthFlag,
+			PromoterModeFlag,
+			ModeApply,
+		)
+	}
+
+	if o.Explain != "" && (o.Snapshot != "" || o.ManifestBasedSnapshotOf != "") {
+		return errors.Errorf(
+			"--%s cannot be used with snapshots",
+			PromoterExplainFlag,
+		)
+	}
+
+	if o.QuotaBytes < 0 {
+		return errors.Errorf(
+			"--%s must not be negative", PromoterQuotaBytesFlag,
+		)
+	}
+
+	if o.QuotaWarnPercent < 0 || o.QuotaWarnPercent > 100 {
+		return errors.Errorf(
+			"--%s must be between 0 and 100", PromoterQuotaWarnPercentFlag,
+		)
+	}
+
+	if o.LogCommands != "" {
+		if _, err := logrus.ParseLevel(o.LogCommands); err != nil {
+			return errors.Wrapf(err, "parsing --%s", PromoterLogCommandsFlag)
+		}
+	}
+
+	if o.Strict && !o.Lint && !o.CheckQuotaBefore {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterStrictFlag,
+			PromoterLintFlag,
+			PromoterCheckQuotaBeforeFlag,
+		)
+	}
+
+	if o.CheckQuotaBefore && o.QuotaMetric == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterCheckQuotaBeforeFlag,
+			PromoterQuotaMetricFlag,
+		)
+	}
+
+	if o.QuotaHeadroomPercent < 0 || o.QuotaHeadroomPercent > 100 {
+		return errors.Errorf(
+			"--%s must be between 0 and 100", PromoterQuotaHeadroomPercentFlag,
+		)
+	}
+
+	if _, err := parseDeadline(o.Deadline, time.Now()); err != nil {
+		return err
+	}
+
+	if o.TraceEdge != "" {
+		if _, err := reg.ParseEdgeSelector(o.TraceEdge); err != nil {
+			return errors.Wrapf(err, "--%s", PromoterTraceEdgeFlag)
+		}
+	}
+
+	if o.TargetEnvironment != "" {
+		if err := reg.ValidateEnvironment(o.TargetEnvironment); err != nil {
+			return errors.Wrapf(err, "parsing --%s", PromoterTargetEnvironmentFlag)
+		}
+	}
+
+	if o.EstimateCost && o.EgressRate <= 0 {
+		return errors.Errorf(
+			"--%s requires a positive --%s",
+			PromoterEstimateCostFlag,
+			PromoterEgressRateFlag,
+		)
+	}
+
+	if o.GraphOutput != "" && o.Snapshot == "" && o.ManifestBasedSnapshotOf == "" {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterGraphOutputFlag,
+			PromoterSnapshotFlag,
+			PromoterManifestBasedSnapshotOfFlag,
+		)
+	}
+
+	// Without the transformed digests, the destination images would not be
+	// recognized, and would be transformed and pushed again by every run.
+	if (o.TransformerPlugin != "" || o.ManifestListMediaType != "" || o.UpgradeSchemaV1) &&
+		o.Confirm && o.TransformedDigestsFile == "" {
+		return errors.Errorf(
+			"--%s, --%s and --%s require --%s with --%s=%s",
+			PromoterTransformerPluginFlag,
+			PromoterManifestListMediaTypeFlag,
+			PromoterUpgradeSchemaV1Flag,
+			PromoterTransformedDigestsFileFlag,
+			PromoterModeFlag,
+			ModeApply,
+		)
+	}
+
+	if o.ShadowCommand != "" {
+		if _, err := reg.ParseShadowCommand(o.ShadowCommand); err != nil {
+			return errors.Wrapf(err, "parsing --%s", PromoterShadowCommandFlag)
+		}
+
+		if o.TransformerPlugin != "" || o.ManifestListMediaType != "" || o.UpgradeSchemaV1 {
+			return errors.Errorf(
+				"--%s cannot be combined with --%s, --%s or --%s",
+				PromoterShadowCommandFlag,
+				PromoterTransformerPluginFlag,
+				PromoterManifestListMediaTypeFlag,
+				PromoterUpgradeSchemaV1Flag,
+			)
+		}
+
+		if o.CheckpointPath != "" {
+			return errors.Errorf(
+				"--%s cannot be used with --%s, as the shadowed edges are not promoted",
+				PromoterShadowCommandFlag,
+				PromoterCheckpointFlag,
+			)
+		}
+	}
+
+	if o.ReadThreads < 0 || o.WriteThreads < 0 {
+		return errors.Errorf(
+			"--%s and --%s must not be negative",
+			PromoterReadThreadsFlag,
+			PromoterWriteThreadsFlag,
+		)
+	}
+
+	if o.ErrorRateThreshold < 0 || o.ErrorRateThreshold > 1 {
+		return errors.Errorf(
+			"--%s must be between 0 and 1", PromoterErrorRateThresholdFlag,
+		)
+	}
+
+	if o.CheckpointPath != "" && o.CheckpointEdges < 1 {
+		return errors.Errorf(
+			"--%s must be at least 1", PromoterCheckpointEdgesFlag,
+		)
+	}
+
+	if o.AttachScanResults && o.SeverityThreshold < 0 {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterAttachScanResultsFlag,
+			PromoterSeverityThresholdFlag,
+		)
+	}
+
+	if o.WatchInterval < 0 {
+		return errors.Errorf("--%s must not be negative", PromoterWatchIntervalFlag)
+	}
+
+	if o.InUseImagesFile != "" && o.Manifest == "" && o.ThinManifestDir == "" {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterInUseImagesFileFlag,
+			PromoterManifestFlag,
+			PromoterThinManifestDirFlag,
+		)
+	}
+
+	// Only a promotion can be repeated.
+	if o.WatchInterval > 0 && o.Manifest == "" && o.ThinManifestDir == "" {
+		return errors.Errorf(
+			"--%s requires --%s or --%s",
+			PromoterWatchIntervalFlag,
+			PromoterManifestFlag,
+			PromoterThinManifestDirFlag,
+		)
+	}
+
+	if o.ServeAddress != "" {
+		if o.ServeToken == "" {
+			return errors.Errorf(
+				"--%s requires --%s",
+				PromoterServeAddressFlag,
+				PromoterServeTokenFlag,
+			)
+		}
+
+		if o.WatchInterval > 0 {
+			return errors.Errorf(
+				"--%s cannot be used with --%s",
+				PromoterServeAddressFlag,
+				PromoterWatchIntervalFlag,
+			)
+		}
+	}
+
+	if o.SelfVerify && o.SelfVerifyAttestation == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterSelfVerifyFlag,
+			PromoterSelfVerifyAttestationFlag,
+		)
+	}
+
+	if o.BatchSize < 0 {
+		return errors.Errorf("--%s must not be negative", PromoterBatchSizeFlag)
+	}
+
+	if o.Slowest < 0 {
+		return errors.Errorf("--%s must not be negative", PromoterSlowestFlag)
+	}
+
+	if o.ConcurrencyRamp < 0 {
+		return errors.Errorf("--%s must not be negative", PromoterConcurrencyRampFlag)
+	}
+
+	if o.BatchDelay != 0 && o.BatchSize == 0 {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterBatchDelayFlag,
+			PromoterBatchSizeFlag,
+		)
+	}
+
+	if o.AssembleManifestList && o.ArchTagPattern == "" {
+		return errors.Errorf(
+			"--%s requires --%s",
+			PromoterAssembleManifestListFlag,
+			PromoterArchTagPatternFlag,
+		)
+	}
+
+	if len(o.CompareRegistries) == 1 {
+		return errors.Errorf(
+			"--%s needs at least two registries to compare",
+			PromoterCompareRegistriesFlag,
+		)
+	}
+
+	if len(o.RegistryDelta) > 0 && len(o.RegistryDelta) != 2 {
+		return errors.Errorf(
+			"--%s takes exactly two registries, the source and the destination",
+			PromoterRegistryDeltaFlag,
+		)
+	}
+
+	if (o.ClientCertFile == "") != (o.ClientKeyFile == "") {
+		return errors.Errorf(
+			"--%s and --%s must be used together",
+			PromoterClientCertFileFlag,
+			PromoterClientKeyFileFlag,
+		)
+	}
+
+	if o.PruneMinAge < 0 {
+		return errors.Errorf("--%s must not be negative", PromoterPruneMinAgeFlag)
+	}
+
+	if o.KeyFiles != "" && o.CredentialSource != "" {
+		return errors.Errorf(
+			"--%s cannot be used with --key-files",
+			PromoterCredentialSourceFlag,
+		)
+	}
+
+	if o.CredentialSource != "" && !o.UseServiceAcct && !o.DryRunWithAuth {
+		return errors.Errorf(
+			"--%s requires --use-service-account or --%s",
+			PromoterCredentialSourceFlag,
+			PromoterDryRunWithAuthFlag,
+		)
+	}
+
+	if o.DestCheckMode != "" {
+		valid := false
+		for _, mode := range reg.DestCheckModes {
+			if o.DestCheckMode == mode {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.Errorf(
+				"invalid value %q for --%s; expected one of %s",
+				o.DestCheckMode,
+				PromoterDestCheckModeFlag,
+				strings.Join(reg.DestCheckModes, ", "),
+			)
+		}
+	}
+
+	if o.ExtraTagPolicy != "" {
+		valid := false
+		for _, policy := range reg.ExtraTagPolicies {
+			if o.ExtraTagPolicy == policy {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.Errorf(
+				"invalid value %q for --%s; expected one of %s",
+				o.ExtraTagPolicy,
+				PromoterExtraTagPolicyFlag,
+				strings.Join(reg.ExtraTagPolicies, ", "),
+			)
+		}
+
+		// Per-edge destination checks do not read the other tags of the
+		// destination images.
+		if o.ExtraTagPolicy != reg.ExtraTagPolicyIgnore &&
+			o.DestCheckMode == reg.DestCheckPerEdge {
+			return errors.Errorf(
+				"--%s=%s cannot be used with --%s=%s",
+				PromoterExtraTagPolicyFlag,
+				o.ExtraTagPolicy,
+				PromoterDestCheckModeFlag,
+				reg.DestCheckPerEdge,
+			)
+		}
+	}
+
+	if o.MultiTagPolicy != "" {
+		valid := false
+		for _, policy := range reg.MultiTagPolicies {
+			if o.MultiTagPolicy == policy {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.Errorf(
+				"invalid value %q for --%s; expected one of %s",
+				o.MultiTagPolicy,
+				PromoterMultiTagPolicyFlag,
+				strings.Join(reg.MultiTagPolicies, ", "),
+			)
+		}
+
+		// Tag aliases are tags which no manifest names.
+		if o.MultiTagPolicy != reg.MultiTagPolicyAll && o.TagAliases != "" {
+			return errors.Errorf(
+				"--%s requires --%s=%s",
+				PromoterTagAliasesFlag,
+				PromoterMultiTagPolicyFlag,
+				reg.MultiTagPolicyAll,
+			)
+		}
+	}
+
+	if o.GateBodyMatch != "" {
+		if o.GateURL == "" {
+			return errors.Errorf(
+				"--%s requires --%s",
+				PromoterGateBodyMatchFlag,
+				PromoterGateURLFlag,
+			)
+		}
+
+		if _, err := regexp.Compile(o.GateBodyMatch); err != nil {
+			return errors.Wrapf(err, "compiling --%s", PromoterGateBodyMatchFlag)
+		}
+	}
+
+	if o.RetryBudget < 0 {
+		return errors.Errorf("--%s must not be negative", PromoterRetryBudgetFlag)
+	}
+
+	if o.LogSampleRate < 0 {
+		return errors.Errorf("--%s must not be negative", PromoterLogSampleRateFlag)
+	}
+
+	if o.ReplayFrom != "" && o.ResumeFrom != "" {
+		return errors.Errorf(
+			"--%s and --%s are mutually exclusive",
+			PromoterReplayFromFlag,
+			PromoterResumeFromFlag,
+		)
+	}
+
+	// These drop edges from the manifests without failing the run, so the
+	// source tags they still need would be removed.
+	if o.MoveMode &&
+		(o.IsolateManifests || o.TargetEnvironment != "" || o.InUseImagesFile != "") {
+		return errors.Errorf(
+			"--%s cannot be used with --%s, --%s or --%s",
+			PromoterMoveModeFlag,
+			PromoterIsolateManifestsFlag,
+			PromoterTargetEnvironmentFlag,
+			PromoterInUseImagesFileFlag,
+		)
+	}
+
+	// TODO: Validate remaining options
 	return nil
 }
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/promo-tools/v3/internal/version"
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// SelfVerifyExitCode is the exit code of a run which was refused because
+// --self-verify could not verify the provenance of the promoter.
+const SelfVerifyExitCode = 5
+
+// ErrSelfVerification is returned by RunPromoteCmd if --self-verify could not
+// verify the provenance of the running promoter. Nothing was done.
+var ErrSelfVerification = errors.New("unable to verify the provenance of the promoter")
+
+// selfVerifyKey is the PEM encoded public key which --self-verify checks the
+// release attestation with, unless --self-verify-key is given. It is empty
+// unless set at build time, with
+// '-ldflags "-X sigs.k8s.io/promo-tools/v3/legacy/cli.selfVerifyKey=..."'.
+var selfVerifyKey string
+
+// selfAttestation is the signed statement about a release of the promoter,
+// which --self-verify checks the running promoter against.
+type selfAttestation struct {
+	GitVersion string `json:"gitVersion"`
+	GitCommit  string `json:"gitCommit"`
+	// Binaries are the hex encoded SHA-256 digests of the released
+	// binaries, e.g. one per platform. If empty, only the version of the
+	// running promoter is checked, not its binary.
+	Binaries []string `json:"binaries,omitempty"`
+}
+
+// selfVerify checks that the running promoter is the release described by the
+// attestation at opts.SelfVerifyAttestation, whose detached signature (as
+// written by 'cosign sign-blob') is read from the same path with a '.sig'
+// suffix. Any failure is reported as ErrSelfVerification.
+func selfVerify(opts *RunOptions) error {
+	if err := verifySelf(opts); err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfVerification, err)
+	}
+
+	logrus.Infof("Verified the provenance of promoter %s", version.Get().GitVersion)
+	return nil
+}
+
+func verifySelf(opts *RunOptions) error {
+	var (
+		verifier *reg.SignatureVerifier
+		err      error
+	)
+	switch {
+	case opts.SelfVerifyKey != "":
+		verifier, err = reg.NewSignatureVerifierFromFile(opts.SelfVerifyKey)
+	case selfVerifyKey != "":
+		verifier, err = reg.NewSignatureVerifier([]byte(selfVerifyKey))
+	default:
+		return errors.Errorf(
+			"no public key was built in, and --%s is not set",
+			PromoterSelfVerifyKeyFlag,
+		)
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading public key")
+	}
+
+	b, err := ioutil.ReadFile(opts.SelfVerifyAttestation)
+	if err != nil {
+		return errors.Wrap(err, "reading attestation")
+	}
+
+	if err := verifier.VerifyDetached(
+		b,
+		opts.SelfVerifyAttestation+reg.ManifestSignatureSuffix,
+	); err != nil {
+		return errors.Wrap(err, "verifying the signature of the attestation")
+	}
+
+	var attestation selfAttestation
+	if err := json.Unmarshal(b, &attestation); err != nil {
+		return errors.Wrap(err, "parsing attestation")
+	}
+
+	info := version.Get()
+	if info.GitVersion == "" || info.GitCommit == "" {
+		return errors.New("the promoter was built without version information")
+	}
+
+	if attestation.GitVersion != info.GitVersion ||
+		attestation.GitCommit != info.GitCommit {
+		return errors.Errorf(
+			"the attestation is for %s (%s), but this promoter is %s (%s)",
+			attestation.GitVersion,
+			attestation.GitCommit,
+			info.GitVersion,
+			info.GitCommit,
+		)
+	}
+
+	if len(attestation.Binaries) == 0 {
+		return nil
+	}
+
+	path, digest, err := executableDigest()
+	if err != nil {
+		return errors.Wrap(err, "hashing the promoter binary")
+	}
+
+	for _, attested := range attestation.Binaries {
+		if attested == digest {
+			return nil
+		}
+	}
+
+	return errors.Errorf(
+		"the SHA-256 digest %s of %s is not one of the attested binaries",
+		digest,
+		path,
+	)
+}
+
+// executableDigest returns the path of the running binary and the hex encoded
+// SHA-256 digest of its contents.
+func executableDigest() (path, digest string, err error) {
+	path, err = os.Executable()
+	if err != nil {
+		return "", "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", "", err
+	}
+
+	return path, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,538 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	guuid "github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// The paths of the HTTP API served with --serve-address.
+const (
+	serveHealthPath   = "/healthz"
+	servePromotePath  = "/promote"
+	serveSnapshotPath = "/snapshot"
+	serveRunsPath     = "/runs/"
+)
+
+// The states of a run of the HTTP API.
+const (
+	serveRunQueued    = "queued"
+	serveRunRunning   = "running"
+	serveRunSucceeded = "succeeded"
+	serveRunFailed    = "failed"
+)
+
+const (
+	// serveQueueSize bounds the runs waiting for the one being executed.
+	serveQueueSize = 64
+	// serveMaxBodyBytes bounds the size of a request body.
+	serveMaxBodyBytes = 10 << 20
+	// serveShutdownTimeout bounds the time to finish the pending requests
+	// when the server is stopped.
+	serveShutdownTimeout = 30 * time.Second
+	// serveRunTTL is how long a finished run (and its output) can be polled
+	// before it is forgotten.
+	serveRunTTL = 24 * time.Hour
+)
+
+// serveRequest is the body of POST /promote and POST /snapshot.
+type serveRequest struct {
+	// Manifest is the YAML of the manifest to promote (for /promote).
+	Manifest string `json:"manifest"`
+	// Registry is the registry to snapshot (for /snapshot).
+	Registry string `json:"registry"`
+	// Options override some of the options the server was started with
+	// (see serveOptions), e.g. {"Mode": "apply"}.
+	Options json.RawMessage `json:"options"`
+}
+
+// serveOptions are the options a request may override, named like the fields
+// of RunOptions. They only tune the run: options which run commands, read or
+// write files of the server, or change registries beyond promoting the
+// manifest (such as TransformerPlugin, ShadowCommand, ClearRepository or
+// JUnitOutput) can only be set when starting the server.
+type serveOptions struct {
+	Mode              *string
+	DestCheckMode     *string
+	MultiTagPolicy    *string
+	OutputFormat      *string
+	SnapshotTag       *string
+	Threads           *int
+	ReadThreads       *int
+	WriteThreads      *int
+	LayerConcurrency  *int
+	MaxImageSize      *int
+	SeverityThreshold *int
+	MinimalSnapshot   *bool
+	ShortDigests      *bool
+}
+
+// applyTo sets the options of the request in opts.
+func (o *serveOptions) applyTo(opts *RunOptions) {
+	for _, s := range []struct {
+		from *string
+		to   *string
+	}{
+		{o.Mode, &opts.Mode},
+		{o.DestCheckMode, &opts.DestCheckMode},
+		{o.MultiTagPolicy, &opts.MultiTagPolicy},
+		{o.OutputFormat, &opts.OutputFormat},
+		{o.SnapshotTag, &opts.SnapshotTag},
+	} {
+		if s.from != nil {
+			*s.to = *s.from
+		}
+	}
+
+	for _, i := range []struct {
+		from *int
+		to   *int
+	}{
+		{o.Threads, &opts.Threads},
+		{o.ReadThreads, &opts.ReadThreads},
+		{o.WriteThreads, &opts.WriteThreads},
+		{o.LayerConcurrency, &opts.LayerConcurrency},
+		{o.MaxImageSize, &opts.MaxImageSize},
+		{o.SeverityThreshold, &opts.SeverityThreshold},
+	} {
+		if i.from != nil {
+			*i.to = *i.from
+		}
+	}
+
+	if o.MinimalSnapshot != nil {
+		opts.MinimalSnapshot = *o.MinimalSnapshot
+	}
+	if o.ShortDigests != nil {
+		opts.ShortDigests = *o.ShortDigests
+	}
+}
+
+// serveResult is a PromotionResult as returned by GET /runs/{id}.
+type serveResult struct {
+	Request  string   `json:"request"`
+	Duration string   `json:"duration"`
+	Skipped  bool     `json:"skipped,omitempty"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// serveRun is a promotion or snapshot requested through the HTTP API.
+type serveRun struct {
+	ID       string        `json:"id"`
+	Kind     string        `json:"kind"`
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Created  time.Time     `json:"created"`
+	Started  *time.Time    `json:"started,omitempty"`
+	Finished *time.Time    `json:"finished,omitempty"`
+	Output   string        `json:"output,omitempty"`
+	Results  []serveResult `json:"results,omitempty"`
+
+	opts RunOptions
+	dir  string
+}
+
+// promotionServer executes the runs requested through the HTTP API one at a
+// time, as RunPromoteCmd changes process-wide state such as the activated
+// service accounts.
+type promotionServer struct {
+	base  RunOptions
+	token string
+	queue chan *serveRun
+	// ttl is how long finished runs are kept.
+	ttl time.Duration
+
+	mutex sync.Mutex
+	runs  map[string]*serveRun
+}
+
+// runServe serves the HTTP API on opts.ServeAddress until it receives SIGINT
+// or SIGTERM. Every promotion or snapshot requested is a complete run with
+// the options of the server, overridden by those of the request, and is
+// executed asynchronously; its status and results are polled with
+// GET /runs/{id}. A signal stops the server once the current run has
+// finished; queued runs are not started anymore.
+func runServe(opts *RunOptions) error {
+	base := *opts
+	base.ServeAddress = ""
+	base.ServeToken = ""
+	base.PrintConfig = false
+	// Let every run derive it from its mode again.
+	base.Confirm = false
+
+	server := &promotionServer{
+		base:  base,
+		token: opts.ServeToken,
+		queue: make(chan *serveRun, serveQueueSize),
+		ttl:   serveRunTTL,
+		runs:  make(map[string]*serveRun),
+	}
+
+	httpServer := &http.Server{
+		Addr:              opts.ServeAddress,
+		Handler:           server.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.work(ctx)
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logrus.Infof("Serving the promoter API on %s", opts.ServeAddress)
+		serveErr <- httpServer.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case sig := <-sigs:
+		logrus.Infof("Received %s; stopping the promoter API", sig)
+	case err = <-serveErr:
+		err = errors.Wrap(err, "serving the promoter API")
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(
+		context.Background(),
+		serveShutdownTimeout,
+	)
+	defer cancelShutdown()
+	if shutdownErr := httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+		logrus.Errorf("Unable to stop the promoter API: %v", shutdownErr)
+	}
+
+	// No handler is running anymore, so nothing is queued after this.
+	cancel()
+	close(server.queue)
+	<-done
+
+	return err
+}
+
+// handler routes the requests of the HTTP API.
+func (s *promotionServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(serveHealthPath, s.health)
+	mux.HandleFunc(servePromotePath, s.authenticated(s.promote))
+	mux.HandleFunc(serveSnapshotPath, s.authenticated(s.snapshot))
+	mux.HandleFunc(serveRunsPath, s.authenticated(s.status))
+
+	return mux
+}
+
+// work executes the queued runs until ctx is canceled, after which the
+// remaining runs are failed without being started.
+func (s *promotionServer) work(ctx context.Context) {
+	for run := range s.queue {
+		if ctx.Err() != nil {
+			if run.dir != "" {
+				os.RemoveAll(run.dir)
+			}
+			s.finish(run, errors.New("the server stopped before the run started"), nil)
+			continue
+		}
+
+		s.execute(run)
+	}
+}
+
+// execute performs a run with RunPromoteCmd.
+func (s *promotionServer) execute(run *serveRun) {
+	s.mutex.Lock()
+	started := time.Now()
+	run.Status = serveRunRunning
+	run.Started = &started
+	s.mutex.Unlock()
+
+	logrus.Infof("Starting %s run %s", run.Kind, run.ID)
+
+	var output bytes.Buffer
+	var results []reg.PromotionResult
+	run.opts.Out = &output
+	run.opts.ResultsHook = func(r []reg.PromotionResult) {
+		results = r
+	}
+
+	err := RunPromoteCmd(&run.opts)
+	if run.dir != "" {
+		os.RemoveAll(run.dir)
+	}
+
+	s.mutex.Lock()
+	run.Output = output.String()
+	s.mutex.Unlock()
+
+	s.finish(run, err, results)
+}
+
+// finish records the outcome of a run.
+func (s *promotionServer) finish(
+	run *serveRun,
+	err error,
+	results []reg.PromotionResult,
+) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	finished := time.Now()
+	run.Finished = &finished
+	run.Status = serveRunSucceeded
+	if err != nil {
+		run.Status = serveRunFailed
+		run.Error = err.Error()
+		logrus.Errorf("%s run %s failed: %v", run.Kind, run.ID, err)
+	} else {
+		logrus.Infof("Finished %s run %s", run.Kind, run.ID)
+	}
+
+	run.Results = make([]serveResult, 0, len(results))
+	for i := range results {
+		result := serveResult{
+			Request:  results[i].Request.PrettyValue(),
+			Duration: results[i].Duration.String(),
+			Skipped:  results[i].Skipped,
+		}
+		for _, e := range results[i].Errors {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", e.Context, e.Error))
+		}
+
+		run.Results = append(run.Results, result)
+	}
+}
+
+// health reports that the server is up and ready to accept runs.
+func (s *promotionServer) health(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// authenticated only passes requests with the bearer token of the server on
+// to handler.
+func (s *promotionServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// promote queues a promotion of the manifest in the request.
+func (s *promotionServer) promote(w http.ResponseWriter, r *http.Request) {
+	req, opts, ok := s.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	mfest, err := reg.ParseManifestYAML([]byte(req.Manifest))
+	if err == nil {
+		err = mfest.Finalize()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid manifest: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "promoter-run-")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	opts.Manifest = filepath.Join(dir, "promoter-manifest.yaml")
+	if err := ioutil.WriteFile(opts.Manifest, []byte(req.Manifest), 0o600); err != nil {
+		os.RemoveAll(dir)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.enqueue(w, &serveRun{Kind: "promote", opts: opts, dir: dir})
+}
+
+// snapshot queues a snapshot of the registry in the request.
+func (s *promotionServer) snapshot(w http.ResponseWriter, r *http.Request) {
+	req, opts, ok := s.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.Registry == "" {
+		http.Error(w, "registry is required", http.StatusBadRequest)
+		return
+	}
+
+	opts.Snapshot = req.Registry
+	s.enqueue(w, &serveRun{Kind: "snapshot", opts: opts})
+}
+
+// status returns the run named by the path.
+func (s *promotionServer) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, serveRunsPath)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.evict(time.Now())
+	run, ok := s.runs[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown run %q", id), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, run)
+}
+
+// parseRequest parses the body of a POST request and returns the options of
+// the run it requests. They neither promote nor snapshot anything yet; the
+// caller sets what to do.
+func (s *promotionServer) parseRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+) (serveRequest, RunOptions, bool) {
+	var req serveRequest
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return req, RunOptions{}, false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return req, RunOptions{}, false
+	}
+
+	opts := s.base
+	if len(req.Options) > 0 {
+		var overrides serveOptions
+		dec := json.NewDecoder(bytes.NewReader(req.Options))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&overrides); err != nil {
+			http.Error(w, fmt.Sprintf("invalid options: %v", err), http.StatusBadRequest)
+			return req, RunOptions{}, false
+		}
+		overrides.applyTo(&opts)
+	}
+
+	// A run never serves, watches or reads manifests from the local disk.
+	opts.ServeAddress = ""
+	opts.ServeToken = ""
+	opts.WatchInterval = 0
+	opts.PrintConfig = false
+	opts.Manifest = ""
+	opts.ThinManifestDir = ""
+	opts.Snapshot = ""
+	opts.ManifestBasedSnapshotOf = ""
+
+	return req, opts, true
+}
+
+// enqueue validates the options of a run, then registers and queues it,
+// responding with its id.
+func (s *promotionServer) enqueue(w http.ResponseWriter, run *serveRun) {
+	check := run.opts
+	err := resolveMode(&check)
+	if err == nil {
+		err = validateImageOptions(&check)
+	}
+	if err != nil {
+		if run.dir != "" {
+			os.RemoveAll(run.dir)
+		}
+		http.Error(w, fmt.Sprintf("invalid options: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	run.ID = guuid.NewString()
+	run.Status = serveRunQueued
+	run.Created = time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.evict(run.Created)
+
+	select {
+	case s.queue <- run:
+	default:
+		if run.dir != "" {
+			os.RemoveAll(run.dir)
+		}
+		http.Error(w, "too many queued runs", http.StatusServiceUnavailable)
+		return
+	}
+
+	s.runs[run.ID] = run
+	logrus.Infof("Queued %s run %s", run.Kind, run.ID)
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": run.ID})
+}
+
+// evict forgets the runs which finished more than s.ttl before now. The caller
+// holds s.mutex.
+func (s *promotionServer) evict(now time.Time) {
+	for id, run := range s.runs {
+		if run.Finished != nil && now.Sub(*run.Finished) > s.ttl {
+			delete(s.runs, id)
+		}
+	}
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("Unable to write response: %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testServeToken = "secret"
+
+const testServeManifest = `registries:
+- name: gcr.io/foo
+  src: true
+- name: gcr.io/bar
+images:
+- name: a
+  dmap:
+    "sha256:0000000000000000000000000000000000000000000000000000000000000000": ["1.0"]
+`
+
+func newTestServer(queueSize int) *promotionServer {
+	return &promotionServer{
+		base: RunOptions{
+			Threads:         PromoterDefaultThreads,
+			CheckpointEdges: PromoterDefaultCheckpointEdges,
+			LogSampleRate:   PromoterDefaultLogSampleRate,
+		},
+		token: testServeToken,
+		queue: make(chan *serveRun, queueSize),
+		ttl:   time.Hour,
+		runs:  make(map[string]*serveRun),
+	}
+}
+
+// serveTestRequest sends a request to the server, with the token if it is
+// not empty, and returns the response.
+func serveTestRequest(
+	t *testing.T,
+	s *promotionServer,
+	method, path, token, body string,
+) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+// promoteBody returns the body of a POST /promote with the options.
+func promoteBody(t *testing.T, options string) string {
+	t.Helper()
+
+	body := map[string]interface{}{"manifest": testServeManifest}
+	if options != "" {
+		body["options"] = json.RawMessage(options)
+	}
+
+	b, err := json.Marshal(body)
+	require.Nil(t, err)
+	return string(b)
+}
+
+func TestServeAuthentication(t *testing.T) {
+	s := newTestServer(1)
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		expected int
+	}{
+		{
+			name:     "health needs no token",
+			path:     serveHealthPath,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "missing token",
+			path:     serveRunsPath + "unknown",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong token",
+			path:     serveRunsPath + "unknown",
+			token:    "guess",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "valid token",
+			path:     serveRunsPath + "unknown",
+			token:    testServeToken,
+			expected: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		rec := serveTestRequest(t, s, http.MethodGet, test.path, test.token, "")
+		require.Equal(t, test.expected, rec.Code, test.name)
+	}
+}
+
+func TestServeOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     string
+		expectedErr string
+		check       func(*RunOptions)
+	}{
+		{
+			name:    "tuning options",
+			options: `{"Mode": "apply", "Threads": 3, "DestCheckMode": "per-edge"}`,
+			check: func(opts *RunOptions) {
+				require.Equal(t, ModeApply, opts.Mode)
+				require.Equal(t, 3, opts.Threads)
+				require.Equal(t, "per-edge", opts.DestCheckMode)
+				require.Equal(t, PromoterDefaultLogSampleRate, opts.LogSampleRate)
+			},
+		},
+		{
+			name:        "command",
+			options:     `{"ShadowCommand": "sh -c 'rm -rf /'"}`,
+			expectedErr: `unknown field "ShadowCommand"`,
+		},
+		{
+			name:        "plugin",
+			options:     `{"TransformerPlugin": "/bin/sh"}`,
+			expectedErr: `unknown field "TransformerPlugin"`,
+		},
+		{
+			name:        "repository removal",
+			options:     `{"ClearRepository": "gcr.io/bar/a"}`,
+			expectedErr: `unknown field "ClearRepository"`,
+		},
+		{
+			name:        "server path",
+			options:     `{"JUnitOutput": "/etc/passwd"}`,
+			expectedErr: `unknown field "JUnitOutput"`,
+		},
+		{
+			name:        "invalid value",
+			options:     `{"Mode": "yolo"}`,
+			expectedErr: `invalid value "yolo"`,
+		},
+	}
+
+	for _, test := range tests {
+		s := newTestServer(1)
+		rec := serveTestRequest(
+			t,
+			s,
+			http.MethodPost,
+			servePromotePath,
+			testServeToken,
+			promoteBody(t, test.options),
+		)
+
+		if test.expectedErr != "" {
+			require.Equal(t, http.StatusBadRequest, rec.Code, test.name)
+			require.Contains(t, rec.Body.String(), test.expectedErr, test.name)
+			require.Empty(t, s.runs, test.name)
+			continue
+		}
+
+		require.Equal(t, http.StatusAccepted, rec.Code, test.name)
+		run := <-s.queue
+		test.check(&run.opts)
+		require.NotEmpty(t, run.opts.Manifest, test.name)
+		require.Nil(t, os.RemoveAll(run.dir), test.name)
+	}
+}
+
+func TestServeQueue(t *testing.T) {
+	s := newTestServer(1)
+
+	rec := serveTestRequest(t, s, http.MethodPost, servePromotePath, testServeToken, promoteBody(t, ""))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	var queued map[string]string
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &queued))
+	require.NotEmpty(t, queued["id"])
+
+	// The queue is full.
+	rec = serveTestRequest(t, s, http.MethodPost, servePromotePath, testServeToken, promoteBody(t, ""))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = serveTestRequest(t, s, http.MethodGet, serveRunsPath+queued["id"], testServeToken, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var run serveRun
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &run))
+	require.Equal(t, serveRunQueued, run.Status)
+	require.Equal(t, "promote", run.Kind)
+
+	// A stopped server fails the queued runs without starting them.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	close(s.queue)
+	s.work(ctx)
+
+	rec = serveTestRequest(t, s, http.MethodGet, serveRunsPath+queued["id"], testServeToken, "")
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &run))
+	require.Equal(t, serveRunFailed, run.Status)
+	require.Contains(t, run.Error, "the server stopped before the run started")
+	require.NoDirExists(t, s.runs[queued["id"]].dir)
+}
+
+func TestServeMethods(t *testing.T) {
+	s := newTestServer(1)
+
+	rec := serveTestRequest(t, s, http.MethodGet, servePromotePath, testServeToken, "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = serveTestRequest(t, s, http.MethodPost, serveRunsPath+"id", testServeToken, "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	rec = serveTestRequest(t, s, http.MethodPost, serveSnapshotPath, testServeToken, `{}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), "registry is required")
+}
+
+func TestServeEvictsFinishedRuns(t *testing.T) {
+	s := newTestServer(1)
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	recent := now.Add(-time.Minute)
+
+	s.runs = map[string]*serveRun{
+		"old":     {ID: "old", Status: serveRunSucceeded, Finished: &old},
+		"recent":  {ID: "recent", Status: serveRunFailed, Finished: &recent},
+		"running": {ID: "running", Status: serveRunRunning},
+	}
+
+	s.evict(now)
+
+	require.Len(t, s.runs, 2)
+	require.Contains(t, s.runs, "recent")
+	require.Contains(t, s.runs, "running")
+}
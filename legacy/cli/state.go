@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// hasWork reads the source repositories of the edges and compares the
+// resulting PromotionSignature to the one recorded in opts.StateFile by the
+// last successful promotion. It returns true if they differ, i.e. if there
+// may be something to promote, along with the new signature. Only the source
+// repositories of the edges are read, so this is much cheaper than a full
+// promotion run.
+func hasWork(
+	opts *RunOptions,
+	sc *reg.SyncContext,
+	edges map[reg.PromotionEdge]interface{},
+) (work bool, signature string, err error) {
+	state, err := reg.ParsePromotionStateFromFile(opts.StateFile)
+	if err != nil {
+		return false, "", err
+	}
+
+	if err := sc.ReadRegistries(
+		reg.SourceRepositories(edges),
+		false,
+		reg.MkReadRepositoryCmdReal,
+	); err != nil {
+		return false, "", errors.Wrap(err, "reading source repositories")
+	}
+
+	// An unreadable repository would change the signature, and look like work.
+	if len(sc.Logs.Errors) > 0 {
+		return false, "", errors.Errorf(
+			"reading %d source repositories failed",
+			len(sc.Logs.Errors),
+		)
+	}
+
+	signature, err = sc.PromotionSignature(edges)
+	if err != nil {
+		return false, "", err
+	}
+
+	if state == nil {
+		logrus.Infof("No previous promotion recorded in %s", opts.StateFile)
+		return true, signature, nil
+	}
+
+	if state.Signature != signature {
+		logrus.Infof(
+			"Promotion inputs changed since the last promotion at %s",
+			state.Promoted.Format(time.RFC3339),
+		)
+		return true, signature, nil
+	}
+
+	return false, signature, nil
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runWatch promotes every opts.WatchInterval until it receives SIGINT or
+// SIGTERM. Each cycle is a complete run, which reads the manifests and the
+// registries again, so that only the images which are new or changed since
+// the last cycle are promoted. A signal received during a cycle stops the
+// watch once the cycle has finished. A failed or gated cycle is logged and
+// does not stop the watch.
+func runWatch(opts *RunOptions) error {
+	once := *opts
+	once.WatchInterval = 0
+	once.PrintConfig = false
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	for cycle := 1; ; cycle++ {
+		logrus.Infof("Starting promotion cycle %d", cycle)
+
+		start := time.Now()
+		if err := RunPromoteCmd(&once); errors.Is(err, ErrGated) {
+			logrus.Infof("Promotion cycle %d was not allowed by the gate", cycle)
+		} else if err != nil {
+			logrus.Errorf("Promotion cycle %d failed: %v", cycle, err)
+		} else {
+			logrus.Infof(
+				"Finished promotion cycle %d in %s",
+				cycle,
+				time.Since(start).Round(time.Second),
+			)
+		}
+
+		logrus.Infof("Next promotion cycle in %s", opts.WatchInterval)
+
+		select {
+		case sig := <-sigs:
+			logrus.Infof("Received %s; stopping after promotion cycle %d", sig, cycle)
+			return nil
+		case <-time.After(opts.WatchInterval):
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SpecVersion is the version of the CloudEvents specification the events
+// conform to.
+const SpecVersion = "1.0"
+
+// sendTimeout bounds how long sending a single event may take.
+const sendTimeout = 10 * time.Second
+
+// Event is a CloudEvent, serialized in the structured JSON format.
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// New creates an event of the given type, with a unique ID and the current
+// time. The data is sent as JSON.
+func New(eventType, source, subject string, data interface{}) Event {
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
+
+// Send POSTs every event to the sink, one request per event. All events are
+// attempted; the number of events which could not be delivered is returned,
+// along with an error describing why. The requests are sent with transport (or
+// http.DefaultTransport if nil).
+func Send(
+	sink string,
+	events []Event,
+	transport http.RoundTripper,
+) (int, error) {
+	client := http.Client{Timeout: sendTimeout, Transport: transport}
+	failures := make([]string, 0)
+
+	for i := range events {
+		if err := send(&client, sink, &events[i]); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", events[i].ID, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		// The sink may carry credentials, which must not be logged.
+		redacted := sink
+		if u, err := url.Parse(sink); err == nil {
+			redacted = u.Redacted()
+		}
+
+		return len(failures), fmt.Errorf(
+			"unable to deliver %d events to %s: %s",
+			len(failures),
+			redacted,
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return 0, nil
+}
+
+// send POSTs the event to the sink.
+func send(client *http.Client, sink string, event *Event) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sink, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cloudevents_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/cloudevents"
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestSend(t *testing.T) {
+	var (
+		gotContentType string
+		gotEvents      []map[string]interface{}
+	)
+
+	sink := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			b, err := ioutil.ReadAll(r.Body)
+			require.Nil(t, err)
+
+			var event map[string]interface{}
+			require.Nil(t, json.Unmarshal(b, &event))
+
+			gotContentType = r.Header.Get("Content-Type")
+			gotEvents = append(gotEvents, event)
+		},
+	))
+	defer sink.Close()
+
+	events := []cloudevents.Event{
+		cloudevents.New("dev.example.a", "/test", "a", map[string]string{"n": "1"}),
+		cloudevents.New("dev.example.b", "/test", "", map[string]string{"n": "2"}),
+	}
+	require.NotEqual(t, events[0].ID, events[1].ID)
+
+	undelivered, err := cloudevents.Send(sink.URL, events, nil)
+	require.Nil(t, err)
+	require.Equal(t, 0, undelivered)
+
+	require.Equal(t, "application/cloudevents+json; charset=utf-8", gotContentType)
+	require.Len(t, gotEvents, 2)
+	require.Equal(t, "1.0", gotEvents[0]["specversion"])
+	require.Equal(t, events[0].ID, gotEvents[0]["id"])
+	require.Equal(t, "/test", gotEvents[0]["source"])
+	require.Equal(t, "dev.example.a", gotEvents[0]["type"])
+	require.Equal(t, "a", gotEvents[0]["subject"])
+	require.Equal(t, "application/json", gotEvents[0]["datacontenttype"])
+	require.Equal(t, map[string]interface{}{"n": "1"}, gotEvents[0]["data"])
+	require.NotContains(t, gotEvents[1], "subject")
+}
+
+func TestSendError(t *testing.T) {
+	calls := 0
+	sink := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				http.Error(w, "bad event", http.StatusBadRequest)
+			}
+		},
+	))
+	defer sink.Close()
+
+	events := []cloudevents.Event{
+		cloudevents.New("dev.example.a", "/test", "", nil),
+		cloudevents.New("dev.example.a", "/test", "", nil),
+	}
+
+	// A failed event does not stop the others from being sent.
+	undelivered, err := cloudevents.Send(sink.URL, events, nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "bad event")
+	require.Equal(t, 1, undelivered)
+	require.Equal(t, 2, calls)
+}
+
+func TestSendAllowlist(t *testing.T) {
+	calls := 0
+	sink := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		},
+	))
+	defer sink.Close()
+
+	events := []cloudevents.Event{
+		cloudevents.New("dev.example.a", "/test", "", nil),
+	}
+
+	// A sink which is not in the allowlist is never sent events.
+	allowlist, err := reg.ParseHostAllowlist([]string{"gcr.io"})
+	require.Nil(t, err)
+	undelivered, err := cloudevents.Send(
+		sink.URL,
+		events,
+		reg.NewAllowlistTransport(allowlist, nil),
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), reg.ErrHostNotAllowed.Error())
+	require.Equal(t, 1, undelivered)
+	require.Equal(t, 0, calls)
+}
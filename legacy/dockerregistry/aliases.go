@@ -0,0 +1,330 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// TagAliasRule names the additional tags which are pointed at a digest
+// whenever it is promoted with a tag matching Promoted, such as 'v1.2' and
+// 'v1' for 'v1.2.3'.
+type TagAliasRule struct {
+	// Image restricts the rule to a single image; by default, the rule
+	// applies to every image.
+	Image ImageName `yaml:"image,omitempty"`
+	// Promoted is a regular expression matching the whole promoted tag.
+	Promoted string `yaml:"promoted"`
+	// Aliases are the tags to add. They may refer to the capture groups of
+	// Promoted (as in '${1}').
+	Aliases []string `yaml:"aliases"`
+
+	pattern *regexp.Regexp
+}
+
+// TagAlias is an additional tag to add to a promoted destination image.
+type TagAlias struct {
+	Registry  RegistryContext
+	ImageName ImageName
+	Tag       Tag
+	// Digest is the promoted digest the alias points to.
+	Digest Digest
+	// Primary is the promoted tag (as a PQIN) the alias is derived from. It
+	// must point to Digest before the alias is added.
+	Primary string
+}
+
+// ParseTagAliasRulesYAML parses a YAML list of TagAliasRules.
+func ParseTagAliasRulesYAML(b []byte) ([]TagAliasRule, error) {
+	var rules []TagAliasRule
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		pattern, err := regexp.Compile("^(?:" + rules[i].Promoted + ")$")
+		if err != nil {
+			return nil, fmt.Errorf(
+				"invalid tag alias rule %q: %w",
+				rules[i].Promoted,
+				err,
+			)
+		}
+		rules[i].pattern = pattern
+
+		if len(rules[i].Aliases) == 0 {
+			return nil, fmt.Errorf(
+				"invalid tag alias rule %q: no aliases",
+				rules[i].Promoted,
+			)
+		}
+	}
+
+	return rules, nil
+}
+
+// ParseTagAliasRulesFromFile parses the TagAliasRules stored in filePath.
+func ParseTagAliasRulesFromFile(filePath string) ([]TagAliasRule, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseTagAliasRulesYAML(b)
+}
+
+// PlanTagAliases derives the alias tags of the tags promoted by the run from
+// the rules. A dry run previews the aliases of its captured requests instead;
+// failed requests, and requests cut off by the deadline, get no aliases.
+// Aliases which already point to the promoted digest, according to the
+// destination inventory read before the promotion or to the promotion itself,
+// are left out. An alias which points to another digest (or which two
+// promoted digests both claim) is never moved; it is reported as a conflict
+// instead.
+func (sc *SyncContext) PlanTagAliases(
+	rules []TagAliasRule,
+) ([]TagAlias, []string, error) {
+	// Only promotions with a tag have aliases.
+	reqs := make([]PromotionRequest, 0)
+	promoted := make(map[string]Digest)
+	for _, result := range sc.PromotionResults {
+		req := result.Request
+		if len(result.Errors) > 0 || result.DeadlineReached ||
+			(result.Skipped && sc.Confirm) ||
+			req.TagOp != Add || req.Tag == "" {
+			continue
+		}
+
+		reqs = append(reqs, req)
+		promoted[ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag)] = sc.promotedDigest(req)
+	}
+
+	planned := make(map[string]TagAlias)
+	conflicting := make(map[string]string)
+	for _, req := range reqs {
+		digest := sc.promotedDigest(req)
+		primary := ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag)
+
+		for _, rule := range rules {
+			if (rule.Image != "" && rule.Image != req.ImageNameDest) ||
+				!rule.pattern.MatchString(string(req.Tag)) {
+				continue
+			}
+
+			for _, template := range rule.Aliases {
+				tag := Tag(rule.pattern.ReplaceAllString(string(req.Tag), template))
+				if err := ValidateTag(tag); err != nil {
+					return nil, nil, fmt.Errorf(
+						"alias of %s: %w",
+						primary,
+						err,
+					)
+				}
+
+				pqin := ToPQIN(req.RegistryDest, req.ImageNameDest, tag)
+				if _, ok := conflicting[pqin]; ok {
+					continue
+				}
+
+				if other, ok := promoted[pqin]; ok {
+					if other != digest {
+						conflicting[pqin] = fmt.Sprintf(
+							"%s: wanted for %s by %s, but promoted to %s",
+							pqin, digest, primary, other,
+						)
+					}
+					continue
+				}
+
+				if existing := sc.digestOfTag(req.RegistryDest, req.ImageNameDest, tag); existing != "" {
+					if existing != digest {
+						conflicting[pqin] = fmt.Sprintf(
+							"%s: wanted for %s by %s, but points to %s",
+							pqin, digest, primary, existing,
+						)
+					}
+					continue
+				}
+
+				if alias, ok := planned[pqin]; ok {
+					if alias.Digest != digest {
+						delete(planned, pqin)
+						conflicting[pqin] = fmt.Sprintf(
+							"%s: wanted for both %s (by %s) and %s (by %s)",
+							pqin, alias.Digest, alias.Primary, digest, primary,
+						)
+					}
+					continue
+				}
+
+				planned[pqin] = TagAlias{
+					Registry: RegistryContext{
+						Name:           req.RegistryDest,
+						ServiceAccount: req.ServiceAccount,
+					},
+					ImageName: req.ImageNameDest,
+					Tag:       tag,
+					Digest:    digest,
+					Primary:   primary,
+				}
+			}
+		}
+	}
+
+	aliases := make([]TagAlias, 0, len(planned))
+	for _, alias := range planned {
+		aliases = append(aliases, alias)
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		return aliases[i].String() < aliases[j].String()
+	})
+
+	conflicts := make([]string, 0, len(conflicting))
+	for _, conflict := range conflicting {
+		conflicts = append(conflicts, conflict)
+	}
+	sort.Strings(conflicts)
+
+	return aliases, conflicts, nil
+}
+
+// promotedDigest returns the digest the request actually wrote to its
+// destination, which differs from the requested digest if the image was
+// rewritten while being promoted.
+func (sc *SyncContext) promotedDigest(req PromotionRequest) Digest {
+	if transformed, ok := sc.TransformedDigest[req.Digest]; ok {
+		return transformed
+	}
+
+	return req.Digest
+}
+
+// digestOfTag returns the digest the tag of the image pointed to when the
+// destination was read, or an empty digest if the tag did not exist.
+func (sc *SyncContext) digestOfTag(
+	registry RegistryName,
+	image ImageName,
+	tag Tag,
+) Digest {
+	for digest, tags := range sc.Inv[registry][image] {
+		if _, ok := tags.ToTagSet()[tag]; ok {
+			return digest
+		}
+	}
+
+	return ""
+}
+
+// String describes the alias.
+func (a TagAlias) String() string {
+	return fmt.Sprintf(
+		"%s (at %s, alias of %s)",
+		ToPQIN(a.Registry.Name, a.ImageName, a.Tag),
+		a.Digest,
+		a.Primary,
+	)
+}
+
+// CreateTagAliases adds the aliases, each with the command produced by
+// mkProducer, which only adds a tag and copies no image data. An alias is
+// only added once its primary tag has been verified to point to the promoted
+// digest, and the alias itself not to exist yet; an alias which already
+// points to another digest is reported instead. Without sc.Confirm, the
+// aliases are only logged.
+func (sc *SyncContext) CreateTagAliases(
+	aliases []TagAlias,
+	mkProducer func(TagAlias) stream.Producer,
+) error {
+	failures := make([]string, 0)
+
+	for _, alias := range aliases {
+		// Nothing was promoted during a dry run, so there is nothing to
+		// verify either.
+		if !sc.Confirm {
+			logrus.Infof("Dry run: would add tag alias %s", alias)
+			continue
+		}
+
+		actual, err := crane.Digest(alias.Primary, sc.copyOptions()...)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: verifying %s: %v", alias, alias.Primary, err))
+			continue
+		}
+
+		if Digest(actual) != alias.Digest {
+			failures = append(failures, fmt.Sprintf(
+				"%s: %s points to %s, not the promoted %s",
+				alias,
+				alias.Primary,
+				actual,
+				alias.Digest,
+			))
+			continue
+		}
+
+		// The destination inventory may not hold the alias (it is not read
+		// with per-edge destination checks, for example), so the alias is
+		// looked up before it is added, as it must never be moved.
+		pqin := ToPQIN(alias.Registry.Name, alias.ImageName, alias.Tag)
+		existing, err := crane.Digest(pqin, sc.copyOptions()...)
+		if err != nil && !isNotFound(err) {
+			failures = append(failures, fmt.Sprintf("%s: checking %s: %v", alias, pqin, err))
+			continue
+		}
+
+		if err == nil {
+			if Digest(existing) != alias.Digest {
+				failures = append(failures, fmt.Sprintf(
+					"%s: %s already points to %s",
+					alias,
+					pqin,
+					existing,
+				))
+			} else {
+				logrus.Infof("Tag alias %s already exists", alias)
+			}
+			continue
+		}
+
+		if err := runProducer(mkProducer(alias)); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", alias, err))
+			continue
+		}
+
+		logrus.Infof("Added tag alias %s", alias)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"unable to add %d tag aliases: %s",
+			len(failures),
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+func TestParseTagAliasRulesYAML(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expectErr bool
+	}{
+		{
+			"Valid rules",
+			`- promoted: 'v(\d+)\.(\d+)\.\d+'
+  aliases: ['v${1}.${2}', 'v${1}', latest]
+- image: foo
+  promoted: stable
+  aliases: [current]
+`,
+			false,
+		},
+		{
+			"No aliases",
+			`- promoted: stable
+`,
+			true,
+		},
+		{
+			"Invalid pattern",
+			`- promoted: 'v(\d+'
+  aliases: [latest]
+`,
+			true,
+		},
+		{
+			"Unknown field",
+			`- promoted: stable
+  aliases: [current]
+  digest: sha256:0000000000000000000000000000000000000000000000000000000000000000
+`,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := reg.ParseTagAliasRulesYAML([]byte(test.input))
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+	}
+}
+
+func TestTagAliases(t *testing.T) {
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	dstName := reg.RegistryName(strings.TrimPrefix(dst.URL, "http://"))
+
+	img, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	digest, err := img.Digest()
+	require.Nil(t, err)
+
+	ref, err := name.ParseReference(string(dstName) + "/foo:v1.2.3")
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(ref, img))
+
+	newDigest := reg.Digest(digest.String())
+	oldDigest := reg.Digest("sha256:" + strings.Repeat("0", 64))
+	otherDigest := reg.Digest("sha256:" + strings.Repeat("1", 64))
+
+	mkResult := func(
+		image reg.ImageName,
+		digest reg.Digest,
+		tag reg.Tag,
+	) reg.PromotionResult {
+		return reg.PromotionResult{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/src",
+				RegistryDest:  dstName,
+				ImageNameSrc:  image,
+				ImageNameDest: image,
+				Digest:        digest,
+				Tag:           tag,
+			},
+		}
+	}
+
+	failed := mkResult("baz", newDigest, "v3.0.0")
+	failed.Errors = reg.Errors{{Context: "copy", Error: nil}}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			dstName: reg.RegInvImage{
+				"foo": reg.DigestTags{
+					oldDigest: reg.TagSlice{"v1.1.0", "latest"},
+				},
+			},
+		},
+		PromotionResults: []reg.PromotionResult{
+			mkResult("foo", newDigest, "v1.2.3"),
+			// Both want the alias v2.
+			mkResult("bar", newDigest, "v2.0.0"),
+			mkResult("bar", otherDigest, "v2.1.0"),
+			failed,
+		},
+	}
+
+	rules, err := reg.ParseTagAliasRulesYAML([]byte(
+		`- promoted: 'v(\d+)\.(\d+)\.\d+'
+  aliases: ['v${1}.${2}', 'v${1}', latest]
+`))
+	require.Nil(t, err)
+
+	aliases, conflicts, err := sc.PlanTagAliases(rules)
+	require.Nil(t, err)
+
+	mkAlias := func(
+		image reg.ImageName,
+		tag reg.Tag,
+		digest reg.Digest,
+		primary reg.Tag,
+	) reg.TagAlias {
+		return reg.TagAlias{
+			Registry:  reg.RegistryContext{Name: dstName},
+			ImageName: image,
+			Tag:       tag,
+			Digest:    digest,
+			Primary:   reg.ToPQIN(dstName, image, primary),
+		}
+	}
+	require.Equal(t, []reg.TagAlias{
+		mkAlias("bar", "v2.0", newDigest, "v2.0.0"),
+		mkAlias("bar", "v2.1", otherDigest, "v2.1.0"),
+		mkAlias("foo", "v1", newDigest, "v1.2.3"),
+		mkAlias("foo", "v1.2", newDigest, "v1.2.3"),
+	}, aliases)
+
+	// The latest tags of bar are claimed by both digests, and the latest tag
+	// of foo points to another digest already.
+	require.Len(t, conflicts, 3)
+	require.True(t, strings.HasPrefix(conflicts[0], reg.ToPQIN(dstName, "bar", "latest")+": "))
+	require.True(t, strings.HasPrefix(conflicts[1], reg.ToPQIN(dstName, "bar", "v2")+": "))
+	require.True(t, strings.HasPrefix(conflicts[2], reg.ToPQIN(dstName, "foo", "latest")+": "))
+
+	var added []reg.Tag
+	mkProducer := func(alias reg.TagAlias) stream.Producer {
+		added = append(added, alias.Tag)
+		var sr stream.Fake
+		return &sr
+	}
+
+	// Dry run.
+	fooAliases := aliases[2:]
+	require.Nil(t, sc.CreateTagAliases(fooAliases, mkProducer))
+	require.Empty(t, added)
+
+	sc.Confirm = true
+	require.Nil(t, sc.CreateTagAliases(fooAliases, mkProducer))
+	require.Equal(t, []reg.Tag{"v1", "v1.2"}, added)
+
+	// The aliases are not added if the primary tag points elsewhere.
+	added = nil
+	fooAliases[0].Digest = otherDigest
+	require.Error(t, sc.CreateTagAliases(fooAliases[:1], mkProducer))
+	require.Empty(t, added)
+	fooAliases[0].Digest = newDigest
+
+	// Aliases missing from the destination inventory are looked up in the
+	// registry: an alias pointing to another image is not moved, and one
+	// already pointing to the promoted digest is left alone.
+	other, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	ref, err = name.ParseReference(string(dstName) + "/foo:v1")
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(ref, other))
+	ref, err = name.ParseReference(string(dstName) + "/foo:v1.2")
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(ref, img))
+
+	err = sc.CreateTagAliases(fooAliases, mkProducer)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), reg.ToPQIN(dstName, "foo", "v1")+" already points to")
+	require.Empty(t, added)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrHostNotAllowed is returned for requests to hosts which are not in the
+// HostAllowlist.
+var ErrHostNotAllowed = errors.New("host not in the allowlist")
+
+// wildcardPrefix marks a HostAllowlist pattern which matches the subdomains
+// of a domain.
+const wildcardPrefix = "*."
+
+// HostAllowlist is the set of hosts the promoter may talk to. A pattern is
+// either an exact host (e.g. 'gcr.io') or a wildcard (e.g. '*.pkg.dev')
+// matching every subdomain of a domain, but not the domain itself. Hosts are
+// matched without their port, ignoring case.
+type HostAllowlist []string
+
+// ParseHostAllowlist validates and normalizes the patterns of a
+// HostAllowlist.
+func ParseHostAllowlist(patterns []string) (HostAllowlist, error) {
+	allowlist := make(HostAllowlist, 0, len(patterns))
+	for _, pattern := range patterns {
+		host := strings.ToLower(strings.TrimSpace(pattern))
+		domain := strings.TrimPrefix(host, wildcardPrefix)
+		if domain == "" ||
+			strings.ContainsAny(domain, "*/:@ ") ||
+			strings.HasPrefix(domain, ".") ||
+			strings.HasSuffix(domain, ".") {
+			return nil, fmt.Errorf(
+				"allowed host %q is not a host or a %sDOMAIN wildcard",
+				pattern,
+				wildcardPrefix,
+			)
+		}
+
+		allowlist = append(allowlist, host)
+	}
+
+	return allowlist, nil
+}
+
+// Allows returns true if the host (which may carry a port) matches a pattern
+// of the allowlist.
+func (a HostAllowlist) Allows(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, pattern := range a {
+		if strings.HasPrefix(pattern, wildcardPrefix) {
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+			continue
+		}
+
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckRegistries returns an error naming the registries whose host is not
+// allowed, so that a run which would be refused fails before talking to any
+// of them.
+func (a HostAllowlist) CheckRegistries(rcs []RegistryContext) error {
+	refused := make([]string, 0)
+	for _, rc := range rcs {
+		_, domain, _ := GetTokenKeyDomainRepoPath(rc.Name)
+		if !a.Allows(domain) {
+			refused = append(refused, string(rc.Name))
+		}
+	}
+
+	if len(refused) > 0 {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, strings.Join(refused, ", "))
+	}
+
+	return nil
+}
+
+// CheckURLs is like CheckRegistries, but for the hosts of the given URLs
+// (such as the endpoints reports are sent to). Empty URLs are ignored.
+func (a HostAllowlist) CheckURLs(urls ...string) error {
+	refused := make([]string, 0)
+	for _, rawURL := range urls {
+		if rawURL == "" {
+			continue
+		}
+
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return fmt.Errorf("parsing URL: %w", err)
+		}
+
+		if !a.Allows(u.Host) {
+			refused = append(refused, u.Host)
+		}
+	}
+
+	if len(refused) > 0 {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, strings.Join(refused, ", "))
+	}
+
+	return nil
+}
+
+// NewAllowlistTransport returns an HTTP transport which refuses requests to
+// hosts not in the allowlist, and sends the others with base (or
+// http.DefaultTransport if nil). As redirects and token exchanges are sent
+// with the same transport, they are refused too.
+func NewAllowlistTransport(
+	allowlist HostAllowlist,
+	base http.RoundTripper,
+) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &allowlistTransport{allowlist: allowlist, base: base}
+}
+
+type allowlistTransport struct {
+	allowlist HostAllowlist
+	base      http.RoundTripper
+}
+
+func (t *allowlistTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.allowlist.Allows(req.URL.Host) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, req.URL.Host)
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,328 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	cr "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ArchTagPattern recognizes the tags of images which are published once per
+// architecture under a suffixed tag (such as 'v1.2.3-amd64'), instead of as a
+// manifest list.
+type ArchTagPattern struct {
+	pattern *regexp.Regexp
+}
+
+// ParseArchTagPattern parses a regular expression which must match the whole
+// tag, and whose two capture groups are the tag shared by all architectures
+// and the architecture, as in '(.+)-(amd64|arm64|ppc64le|s390x)'. Any other
+// groups have to be non-capturing.
+func ParseArchTagPattern(s string) (*ArchTagPattern, error) {
+	pattern, err := regexp.Compile("^(?:" + s + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid arch tag pattern %q: %w", s, err)
+	}
+
+	if pattern.NumSubexp() != 2 {
+		return nil, fmt.Errorf(
+			"arch tag pattern %q must have 2 capture groups (the tag and the architecture), not %d",
+			s,
+			pattern.NumSubexp(),
+		)
+	}
+
+	return &ArchTagPattern{pattern: pattern}, nil
+}
+
+// Match splits an arch-suffixed tag into the tag shared by all architectures
+// and the architecture. It returns false if the tag is not arch-suffixed.
+func (p *ArchTagPattern) Match(tag Tag) (Tag, string, bool) {
+	match := p.pattern.FindStringSubmatch(string(tag))
+	if match == nil || match[1] == "" || match[2] == "" {
+		return "", "", false
+	}
+
+	return Tag(match[1]), match[2], true
+}
+
+// ArchFamily is a group of arch-suffixed tags of a destination image which
+// share the same tag apart from the architecture.
+type ArchFamily struct {
+	Registry  RegistryContext
+	ImageName ImageName
+	// Tag is the tag shared by all architectures, which a manifest list
+	// assembled from the family is tagged with.
+	Tag Tag
+	// Members are the digests of the family, keyed by architecture.
+	Members map[string]Digest
+	// Missing are the architectures which other families of the image have,
+	// but this one lacks.
+	Missing []string
+}
+
+// String describes the family.
+func (f *ArchFamily) String() string {
+	archs := make([]string, 0, len(f.Members))
+	for arch := range f.Members {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+
+	return fmt.Sprintf(
+		"%s (%s)",
+		ToPQIN(f.Registry.Name, f.ImageName, f.Tag),
+		strings.Join(archs, ", "),
+	)
+}
+
+// Families groups the destination tags of the edges matched by the pattern
+// into arch families. A family is incomplete if it lacks an architecture
+// which any other family of the same image has. Tags whose shared tag is
+// promoted itself are left out, as the manifests already decide what it
+// points to.
+func (p *ArchTagPattern) Families(
+	edges map[PromotionEdge]interface{},
+) []ArchFamily {
+	type imageKey struct {
+		registry RegistryName
+		image    ImageName
+	}
+	type familyKey struct {
+		imageKey
+		tag Tag
+	}
+
+	declared := make(map[familyKey]struct{})
+	for edge := range edges {
+		declared[familyKey{
+			imageKey{edge.DstRegistry.Name, edge.DstImageTag.ImageName},
+			edge.DstImageTag.Tag,
+		}] = struct{}{}
+	}
+
+	families := make(map[familyKey]*ArchFamily)
+	archsOfImage := make(map[imageKey]map[string]struct{})
+	for edge := range edges {
+		tag, arch, ok := p.Match(edge.DstImageTag.Tag)
+		if !ok {
+			continue
+		}
+
+		image := imageKey{edge.DstRegistry.Name, edge.DstImageTag.ImageName}
+		key := familyKey{image, tag}
+		if _, ok := declared[key]; ok {
+			continue
+		}
+
+		family, ok := families[key]
+		if !ok {
+			family = &ArchFamily{
+				Registry:  edge.DstRegistry,
+				ImageName: edge.DstImageTag.ImageName,
+				Tag:       tag,
+				Members:   make(map[string]Digest),
+			}
+			families[key] = family
+		}
+		family.Members[arch] = edge.Digest
+
+		if archsOfImage[image] == nil {
+			archsOfImage[image] = make(map[string]struct{})
+		}
+		archsOfImage[image][arch] = struct{}{}
+	}
+
+	result := make([]ArchFamily, 0, len(families))
+	for key, family := range families {
+		for arch := range archsOfImage[key.imageKey] {
+			if _, ok := family.Members[arch]; !ok {
+				family.Missing = append(family.Missing, arch)
+			}
+		}
+		sort.Strings(family.Missing)
+
+		result = append(result, *family)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].String() < result[j].String()
+	})
+
+	return result
+}
+
+// AssembleManifestLists tags a manifest list of the members of every
+// complete family with the family's shared tag, at the destination of the
+// family. The platform of each member is read from its image config, and has
+// to agree with the architecture in its tag. A shared tag which already
+// points to another digest is never moved. Without sc.Confirm, the manifest
+// lists are only logged.
+func (sc *SyncContext) AssembleManifestLists(families []ArchFamily) error {
+	failures := make([]string, 0)
+
+	for i := range families {
+		family := &families[i]
+		if len(family.Missing) > 0 {
+			logrus.Warnf(
+				"Not assembling a manifest list of the incomplete family %s",
+				family,
+			)
+			continue
+		}
+
+		if !sc.Confirm {
+			logrus.Infof("Dry run: would assemble manifest list %s", family)
+			continue
+		}
+
+		digest, err := sc.assembleManifestList(family)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", family, err))
+			continue
+		}
+
+		logrus.Infof("Assembled manifest list %s at %s", family, digest)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"unable to assemble %d manifest lists: %s",
+			len(failures),
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return nil
+}
+
+// assembleManifestList writes the manifest list of a complete family and
+// returns its digest.
+func (sc *SyncContext) assembleManifestList(family *ArchFamily) (Digest, error) {
+	o := crane.GetOptions(sc.copyOptions()...)
+
+	archs := make([]string, 0, len(family.Members))
+	for arch := range family.Members {
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+
+	mediaType := cr.DockerManifestList
+	adds := make([]mutate.IndexAddendum, 0, len(archs))
+	for _, arch := range archs {
+		digest := family.Members[arch]
+		if transformed, ok := sc.TransformedDigest[digest]; ok {
+			digest = transformed
+		}
+
+		ref, err := name.ParseReference(
+			ToFQIN(family.Registry.Name, family.ImageName, digest),
+			o.Name...,
+		)
+		if err != nil {
+			return "", err
+		}
+
+		desc, err := remote.Get(ref, o.Remote...)
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", ref, err)
+		}
+		if desc.MediaType.IsIndex() {
+			return "", fmt.Errorf("%s is a manifest list already", ref)
+		}
+		if desc.MediaType == cr.OCIManifestSchema1 {
+			mediaType = cr.OCIImageIndex
+		}
+
+		img, err := desc.Image()
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", ref, err)
+		}
+		config, err := img.ConfigFile()
+		if err != nil {
+			return "", fmt.Errorf("reading the config of %s: %w", ref, err)
+		}
+		if arch != config.Architecture {
+			return "", fmt.Errorf(
+				"%s is tagged for %s, but built for %s",
+				ref,
+				arch,
+				config.Architecture,
+			)
+		}
+
+		adds = append(adds, mutate.IndexAddendum{
+			Add: img,
+			Descriptor: v1.Descriptor{
+				MediaType: desc.MediaType,
+				Platform: &v1.Platform{
+					OS:           config.OS,
+					Architecture: config.Architecture,
+				},
+			},
+		})
+	}
+
+	idx := mutate.IndexMediaType(
+		mutate.AppendManifests(empty.Index, adds...),
+		mediaType,
+	)
+	indexDigest, err := idx.Digest()
+	if err != nil {
+		return "", err
+	}
+	digest := Digest(indexDigest.String())
+
+	ref, err := name.ParseReference(
+		ToPQIN(family.Registry.Name, family.ImageName, family.Tag),
+		o.Name...,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	// The shared tag is looked up in the registry, as the destination
+	// inventory may not hold it (with per-edge destination checks, for
+	// example), and it must never be moved.
+	existing, err := remote.Head(ref, o.Remote...)
+	if err != nil && !isNotFound(err) {
+		return "", fmt.Errorf("checking %s: %w", ref, err)
+	}
+	if err == nil {
+		if Digest(existing.Digest.String()) == digest {
+			return digest, nil
+		}
+
+		return "", fmt.Errorf("%s points to %s already", ref, existing.Digest)
+	}
+
+	if err := remote.WriteIndex(ref, idx, o.Remote...); err != nil {
+		return "", fmt.Errorf("writing manifest list %s: %w", ref, err)
+	}
+
+	return digest, nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestParseArchTagPattern(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		tag       reg.Tag
+		base      reg.Tag
+		arch      string
+		ok        bool
+		expectErr bool
+	}{
+		{`(.+)-(amd64|arm64)`, "v1.2.3-amd64", "v1.2.3", "amd64", true, false},
+		{`(.+)-(amd64|arm64)`, "v1.2.3-arm64", "v1.2.3", "arm64", true, false},
+		{`(.+)-(amd64|arm64)`, "v1.2.3", "", "", false, false},
+		// The pattern must match the whole tag.
+		{`(.+)-(amd64|arm64)`, "v1.2.3-amd64-debug", "", "", false, false},
+		{`(.+)_(?:linux-)?(amd64|arm64)`, "v1_linux-arm64", "v1", "arm64", true, false},
+		{`(.+)-amd64`, "", "", "", false, true},
+		{`(.+)-(amd64|arm64`, "", "", "", false, true},
+	}
+
+	for _, test := range tests {
+		pattern, err := reg.ParseArchTagPattern(test.pattern)
+		if test.expectErr {
+			require.Error(t, err, test.pattern)
+			continue
+		}
+		require.NoError(t, err, test.pattern)
+
+		base, arch, ok := pattern.Match(test.tag)
+		require.Equal(t, test.ok, ok, string(test.tag))
+		require.Equal(t, test.base, base, string(test.tag))
+		require.Equal(t, test.arch, arch, string(test.tag))
+	}
+}
+
+func TestArchFamilies(t *testing.T) {
+	dstRC := reg.RegistryContext{Name: "gcr.io/dst"}
+	mkEdge := func(image reg.ImageName, digest reg.Digest, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src", Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      digest,
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	pattern, err := reg.ParseArchTagPattern(`(.+)-(amd64|arm64|s390x)`)
+	require.Nil(t, err)
+
+	families := pattern.Families(map[reg.PromotionEdge]interface{}{
+		mkEdge("foo", "sha256:111", "v1.0-amd64"): nil,
+		mkEdge("foo", "sha256:222", "v1.0-arm64"): nil,
+		mkEdge("foo", "sha256:333", "v1.1-amd64"): nil,
+		mkEdge("foo", "sha256:444", "latest"):     nil,
+		// Other images expect other architectures.
+		mkEdge("bar", "sha256:555", "v1.0-s390x"): nil,
+		// The shared tag is promoted itself.
+		mkEdge("baz", "sha256:666", "v1.0-amd64"): nil,
+		mkEdge("baz", "sha256:777", "v1.0"):       nil,
+	})
+
+	require.Equal(t, []reg.ArchFamily{
+		{
+			Registry:  dstRC,
+			ImageName: "bar",
+			Tag:       "v1.0",
+			Members:   map[string]reg.Digest{"s390x": "sha256:555"},
+		},
+		{
+			Registry:  dstRC,
+			ImageName: "foo",
+			Tag:       "v1.0",
+			Members: map[string]reg.Digest{
+				"amd64": "sha256:111",
+				"arm64": "sha256:222",
+			},
+		},
+		{
+			Registry:  dstRC,
+			ImageName: "foo",
+			Tag:       "v1.1",
+			Members:   map[string]reg.Digest{"amd64": "sha256:333"},
+			Missing:   []string{"arm64"},
+		},
+	}, families)
+}
+
+func TestAssembleManifestLists(t *testing.T) {
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	dstName := reg.RegistryName(strings.TrimPrefix(dst.URL, "http://"))
+
+	push := func(tag, arch string) reg.Digest {
+		img, err := random.Image(1024, 1)
+		require.Nil(t, err)
+		config, err := img.ConfigFile()
+		require.Nil(t, err)
+		config.OS = "linux"
+		config.Architecture = arch
+		img, err = mutate.ConfigFile(img, config)
+		require.Nil(t, err)
+
+		ref, err := name.ParseReference(string(dstName) + "/foo:" + tag)
+		require.Nil(t, err)
+		require.Nil(t, remote.Write(ref, img))
+
+		digest, err := img.Digest()
+		require.Nil(t, err)
+		return reg.Digest(digest.String())
+	}
+
+	family := reg.ArchFamily{
+		Registry:  reg.RegistryContext{Name: dstName},
+		ImageName: "foo",
+		Tag:       "v1.0",
+		Members: map[string]reg.Digest{
+			"amd64": push("v1.0-amd64", "amd64"),
+			"arm64": push("v1.0-arm64", "arm64"),
+		},
+	}
+	mislabeled := reg.ArchFamily{
+		Registry:  reg.RegistryContext{Name: dstName},
+		ImageName: "foo",
+		Tag:       "v2.0",
+		Members: map[string]reg.Digest{
+			"amd64": push("v2.0-amd64", "arm64"),
+		},
+	}
+	incomplete := reg.ArchFamily{
+		Registry:  reg.RegistryContext{Name: dstName},
+		ImageName: "foo",
+		Tag:       "v3.0",
+		Members: map[string]reg.Digest{
+			"amd64": push("v3.0-amd64", "amd64"),
+		},
+		Missing: []string{"arm64"},
+	}
+
+	sc := reg.SyncContext{Confirm: true}
+	err := sc.AssembleManifestLists([]reg.ArchFamily{family, mislabeled, incomplete})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "tagged for amd64, but built for arm64")
+
+	ref, err := name.ParseReference(string(dstName) + "/foo:v1.0")
+	require.Nil(t, err)
+	idx, err := remote.Index(ref)
+	require.Nil(t, err)
+	manifest, err := idx.IndexManifest()
+	require.Nil(t, err)
+
+	platforms := make(map[string]reg.Digest)
+	for _, desc := range manifest.Manifests {
+		platforms[desc.Platform.OS+"/"+desc.Platform.Architecture] = reg.Digest(desc.Digest.String())
+	}
+	require.Equal(t, map[string]reg.Digest{
+		"linux/amd64": family.Members["amd64"],
+		"linux/arm64": family.Members["arm64"],
+	}, platforms)
+
+	for _, tag := range []string{"v2.0", "v3.0"} {
+		ref, err := name.ParseReference(string(dstName) + "/foo:" + tag)
+		require.Nil(t, err)
+		_, err = remote.Head(ref)
+		require.Error(t, err, tag)
+	}
+
+	// Assembling the same manifest list again changes nothing.
+	require.Nil(t, sc.AssembleManifestLists([]reg.ArchFamily{family}))
+
+	// A shared tag pointing to another digest is not moved, even if the
+	// destination inventory does not hold it.
+	other := push("v1.0", "amd64")
+	err = sc.AssembleManifestLists([]reg.ArchFamily{family})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "points to "+string(other)+" already")
+}
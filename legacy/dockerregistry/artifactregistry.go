@@ -0,0 +1,220 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	ggcrV1Google "github.com/google/go-containerregistry/pkg/v1/google"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/gcloud"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// ArtifactRegistryDomainSuffix is the suffix of the Docker endpoints of
+// Google Artifact Registry, which are named LOCATION-docker.pkg.dev.
+const ArtifactRegistryDomainSuffix = "docker.pkg.dev"
+
+// IsArtifactRegistry returns true if the registry (or image) name points to a
+// Google Artifact Registry endpoint such as
+// "us-central1-docker.pkg.dev/project/repository".
+//
+// Unlike GCR, where the GCP project is the root repository, Artifact Registry
+// scopes images (and their IAM bindings) to a repository within the project,
+// so the root repository spans three path components instead of two.
+func IsArtifactRegistry(registryName RegistryName) bool {
+	domain := string(registryName)
+	if i := strings.IndexByte(domain, '/'); i >= 0 {
+		domain = domain[:i]
+	}
+
+	return domain == ArtifactRegistryDomainSuffix ||
+		strings.HasSuffix(domain, "-"+ArtifactRegistryDomainSuffix)
+}
+
+// rootRepoDepth returns the number of path components (including the domain)
+// making up the root repository of the registry name.
+func rootRepoDepth(registryName RegistryName) int {
+	if IsArtifactRegistry(registryName) {
+		return 3
+	}
+
+	return 2
+}
+
+// isRegistryName returns true if the name is one of the registries of the
+// SyncContext, as opposed to one of their images.
+func (sc *SyncContext) isRegistryName(name RegistryName) bool {
+	for _, rc := range sc.RegistryContexts {
+		if rc.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// artifactRegistryAPI is the base URL of the Artifact Registry REST API.
+const artifactRegistryAPI = "https://artifactregistry.googleapis.com/v1"
+
+// artifactRegistryListProducer discovers the images below an Artifact
+// Registry registry name. Artifact Registry's tags/list response lacks GCR's
+// "child" field, so the images are listed with the Artifact Registry API
+// instead and presented as the children of an otherwise empty GCR tags/list
+// response, for ReadRegistries to recurse into. Every image below the
+// registry name is listed as a direct child, however deeply it is nested.
+type artifactRegistryListProducer struct {
+	transport http.RoundTripper
+	token     gcloud.Token
+	// registryName is the name being listed, which may be deeper than the
+	// root repository (e.g. "us-docker.pkg.dev/project/repository/foo").
+	registryName RegistryName
+}
+
+// artifactRegistryImages is a page of the dockerImages.list response.
+type artifactRegistryImages struct {
+	DockerImages []struct {
+		URI string `json:"uri"`
+	} `json:"dockerImages"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// Produce implements stream.Producer.
+func (p *artifactRegistryListProducer) Produce() (stdOut, stdErr io.Reader, err error) {
+	parts := strings.Split(string(p.registryName), "/")
+	location := strings.TrimSuffix(parts[0], "-"+ArtifactRegistryDomainSuffix)
+	if len(parts) < rootRepoDepth(p.registryName) || location == parts[0] {
+		return nil, nil, fmt.Errorf(
+			"cannot list images of %s: Artifact Registry names must be of the form LOCATION-%s/PROJECT/REPOSITORY",
+			p.registryName,
+			ArtifactRegistryDomainSuffix,
+		)
+	}
+
+	endpoint := fmt.Sprintf(
+		"%s/projects/%s/locations/%s/repositories/%s/dockerImages",
+		artifactRegistryAPI,
+		parts[1],
+		location,
+		parts[2],
+	)
+	prefix := string(p.registryName) + "/"
+
+	children := map[string]bool{}
+	pageToken := ""
+	for {
+		page, err := p.listPage(endpoint, pageToken)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, image := range page.DockerImages {
+			uri := image.URI
+			if i := strings.IndexByte(uri, '@'); i >= 0 {
+				uri = uri[:i]
+			}
+			if strings.HasPrefix(uri, prefix) {
+				children[strings.TrimPrefix(uri, prefix)] = true
+			}
+		}
+
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	result := ggcrV1Google.Tags{
+		Name:      strings.Join(parts[1:], "/"),
+		Children:  []string{},
+		Manifests: map[string]ggcrV1Google.ManifestInfo{},
+		Tags:      []string{},
+	}
+	for child := range children {
+		result.Children = append(result.Children, child)
+	}
+	sort.Strings(result.Children)
+
+	b, err := json.Marshal(&result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bytes.NewReader(b), strings.NewReader(""), nil
+}
+
+// listPage reads a single page of the dockerImages.list response.
+func (p *artifactRegistryListProducer) listPage(
+	endpoint, pageToken string,
+) (*artifactRegistryImages, error) {
+	query := url.Values{}
+	query.Set("pageSize", "1000")
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+string(p.token))
+	}
+
+	client := http.Client{Transport: p.transport}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"problems encountered: unexpected response code %d listing images of %s; body: %s",
+			res.StatusCode,
+			p.registryName,
+			body,
+		)
+	}
+
+	page := artifactRegistryImages{}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, fmt.Errorf("parsing images of %s: %w", p.registryName, err)
+	}
+
+	return &page, nil
+}
+
+// Close implements stream.Producer.
+func (p *artifactRegistryListProducer) Close() error {
+	return nil
+}
+
+var _ stream.Producer = &artifactRegistryListProducer{}
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestIsArtifactRegistry(t *testing.T) {
+	tests := []struct {
+		input    reg.RegistryName
+		expected bool
+	}{
+		{"us-central1-docker.pkg.dev/foo/bar", true},
+		{"europe-docker.pkg.dev/foo/bar/baz", true},
+		{"docker.pkg.dev/foo/bar", true},
+		{"us-docker.pkg.dev", true},
+		{"gcr.io/foo", false},
+		{"us.gcr.io/foo/bar", false},
+		{"k8s.gcr.io/foo", false},
+		{"registry.k8s.io/foo", false},
+		{"example.com/docker.pkg.dev/foo", false},
+		{"us-maven.pkg.dev/foo/bar", false},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, reg.IsArtifactRegistry(test.input), test.input)
+	}
+}
+
+// fakeAPITransport serves canned JSON responses keyed by request URL.
+type fakeAPITransport map[string]string
+
+func (t fakeAPITransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, ok := t[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestReadRegistriesListsArtifactRegistryImages(t *testing.T) {
+	const (
+		fakeRegName reg.RegistryName = "us-docker.pkg.dev/foo/bar/staging"
+		api                          = "https://artifactregistry.googleapis.com/v1/projects/foo/locations/us/repositories/bar/dockerImages?pageSize=1000"
+		pause                        = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+		coredns                      = "sha256:0000000000000000000000000000000000000000000000000000000000000002"
+	)
+
+	transport := fakeAPITransport{
+		api: `{
+  "dockerImages": [
+    {"uri": "us-docker.pkg.dev/foo/bar/staging/pause@` + pause + `"},
+    {"uri": "us-docker.pkg.dev/foo/bar/unrelated@` + pause + `"}
+  ],
+  "nextPageToken": "page2"
+}`,
+		api + "&pageToken=page2": `{
+  "dockerImages": [
+    {"uri": "us-docker.pkg.dev/foo/bar/staging/nested/coredns@` + coredns + `"},
+    {"uri": "us-docker.pkg.dev/foo/bar/staging/pause@` + coredns + `"}
+  ]
+}`,
+		"https://us-docker.pkg.dev/v2/foo/bar/staging/pause/tags/list": `{
+  "manifest": {
+    "` + pause + `": {
+      "imageSizeBytes": "1",
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "tag": ["1.0"],
+      "timeCreatedMs": "0",
+      "timeUploadedMs": "0"
+    }
+  },
+  "name": "foo/bar/staging/pause",
+  "tags": ["1.0"]
+}`,
+		"https://us-docker.pkg.dev/v2/foo/bar/staging/nested/coredns/tags/list": `{
+  "manifest": {
+    "` + coredns + `": {
+      "imageSizeBytes": "1",
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "tag": ["1.7"],
+      "timeCreatedMs": "0",
+      "timeUploadedMs": "0"
+    }
+  },
+  "name": "foo/bar/staging/nested/coredns",
+  "tags": ["1.7"]
+}`,
+	}
+
+	rcs := []reg.RegistryContext{{Name: fakeRegName}}
+	sc := reg.SyncContext{
+		RegistryContexts: rcs,
+		Inv:              map[reg.RegistryName]reg.RegInvImage{fakeRegName: nil},
+		DigestMediaType:  make(reg.DigestMediaType),
+		DigestImageSize:  make(reg.DigestImageSize),
+		DigestUploaded:   make(reg.DigestUploaded),
+		Transport:        transport,
+	}
+
+	err := sc.ReadRegistries(rcs, true, reg.MkReadRepositoryCmdReal)
+	require.Nil(t, err)
+	require.Empty(t, sc.Logs.Errors)
+	require.Equal(t, reg.RegInvImage{
+		"pause":          reg.DigestTags{pause: reg.TagSlice{"1.0"}},
+		"nested/coredns": reg.DigestTags{coredns: reg.TagSlice{"1.7"}},
+	}, sc.Inv[fakeRegName])
+}
+
+func TestReadRegistriesRejectsArtifactRegistryWithoutRepository(t *testing.T) {
+	const fakeRegName reg.RegistryName = "us-docker.pkg.dev/foo"
+
+	rcs := []reg.RegistryContext{{Name: fakeRegName}}
+	sc := reg.SyncContext{
+		RegistryContexts: rcs,
+		Inv:              map[reg.RegistryName]reg.RegInvImage{fakeRegName: nil},
+		DigestMediaType:  make(reg.DigestMediaType),
+		DigestImageSize:  make(reg.DigestImageSize),
+		DigestUploaded:   make(reg.DigestUploaded),
+		Transport:        fakeAPITransport{},
+	}
+
+	err := sc.ReadRegistries(rcs, true, reg.MkReadRepositoryCmdReal)
+	require.Nil(t, err)
+	require.Len(t, sc.Logs.Errors, 1)
+	require.Contains(t, sc.Logs.Errors[0].Error.Error(), "must be of the form")
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	ggcrV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// cosignAttestationTagSuffix is appended to the digest of an image
+	// (with the ':' replaced by a '-') to get the tag of its attestations.
+	cosignAttestationTagSuffix = ".att"
+
+	// cosignSignatureArtifactType is the artifact type of cosign signatures
+	// stored as referrers.
+	cosignSignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
+
+	// cosignPredicateTypeAnnotation holds the predicate type of each layer
+	// of a cosign attestation image, and
+	// sigstorePredicateTypeAnnotation the one of an attestation stored as a
+	// referrer.
+	cosignPredicateTypeAnnotation   = "predicateType"
+	sigstorePredicateTypeAnnotation = "dev.sigstore.bundle.predicateType"
+)
+
+// AttachmentStatus records which supply-chain attachments an image of a
+// snapshot has.
+type AttachmentStatus struct {
+	Image              ImageName `json:"image" yaml:"image"`
+	Digest             Digest    `json:"digest" yaml:"digest"`
+	Tags               TagSlice  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	HasSignature       bool      `json:"hasSignature" yaml:"hasSignature"`
+	HasSBOM            bool      `json:"hasSBOM" yaml:"hasSBOM"`
+	HasScanAttestation bool      `json:"hasScanAttestation" yaml:"hasScanAttestation"`
+}
+
+// AttachmentChecker checks which attachments images have, either as
+// referrers (found through the referrers tag schema), or with the cosign tag
+// scheme. A scan attestation is an attestation with the VulnPredicateType.
+// The result of each image is cached for the lifetime of the
+// AttachmentChecker.
+type AttachmentChecker struct {
+	mutex sync.Mutex
+	cache map[string]AttachmentStatus
+}
+
+// NewAttachmentChecker creates an AttachmentChecker.
+func NewAttachmentChecker() *AttachmentChecker {
+	return &AttachmentChecker{cache: make(map[string]AttachmentStatus)}
+}
+
+// Check returns the attachments of the image. Missing attachments are not an
+// error, but failing to look them up is.
+func (c *AttachmentChecker) Check(
+	registryName RegistryName,
+	imageName ImageName,
+	digest Digest,
+	opts ...crane.Option,
+) (AttachmentStatus, error) {
+	key := ToFQIN(registryName, imageName, digest)
+
+	c.mutex.Lock()
+	status, ok := c.cache[key]
+	c.mutex.Unlock()
+	if ok {
+		return status, nil
+	}
+
+	status, err := checkAttachments(registryName, imageName, digest, opts...)
+	if err != nil {
+		return AttachmentStatus{}, err
+	}
+
+	c.mutex.Lock()
+	c.cache[key] = status
+	c.mutex.Unlock()
+
+	return status, nil
+}
+
+func checkAttachments(
+	registryName RegistryName,
+	imageName ImageName,
+	digest Digest,
+	opts ...crane.Option,
+) (AttachmentStatus, error) {
+	status := AttachmentStatus{Image: imageName, Digest: digest}
+	digestTag := strings.Replace(string(digest), ":", "-", 1)
+	pqin := func(suffix string) string {
+		return ToPQIN(registryName, imageName, Tag(digestTag+suffix))
+	}
+
+	// Referrers of the image, as stored by registries without the referrers
+	// API.
+	b, err := crane.Manifest(pqin(""), opts...)
+	if err != nil && !isNotFound(err) {
+		return status, fmt.Errorf("reading referrers of %s: %w", digest, err)
+	}
+	if err == nil {
+		var index referrersIndex
+		if err := json.Unmarshal(b, &index); err != nil {
+			logrus.Debugf("malformed referrers index for %s: %v", digest, err)
+		}
+
+		for _, manifest := range index.Manifests {
+			switch {
+			case manifest.ArtifactType == cosignSignatureArtifactType:
+				status.HasSignature = true
+			case isSBOMArtifactType(manifest.ArtifactType):
+				status.HasSBOM = true
+			case manifest.Annotations[sigstorePredicateTypeAnnotation] == VulnPredicateType:
+				status.HasScanAttestation = true
+			}
+		}
+	}
+
+	if !status.HasSignature {
+		status.HasSignature, err = tagExists(pqin(cosignSignatureTagSuffix), opts...)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	if !status.HasSBOM {
+		status.HasSBOM, err = tagExists(pqin(cosignSBOMTagSuffix), opts...)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	if !status.HasScanAttestation {
+		status.HasScanAttestation, err = hasCosignAttestation(
+			pqin(cosignAttestationTagSuffix),
+			VulnPredicateType,
+			opts...,
+		)
+		if err != nil {
+			return status, err
+		}
+	}
+
+	return status, nil
+}
+
+// isSBOMArtifactType returns true if artifactType is one of the
+// SBOMArtifactTypes.
+func isSBOMArtifactType(artifactType string) bool {
+	for _, sbomType := range SBOMArtifactTypes {
+		if artifactType == sbomType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tagExists returns true if the image pqin exists.
+func tagExists(pqin string, opts ...crane.Option) (bool, error) {
+	if _, err := crane.Head(pqin, opts...); err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("reading %s: %w", pqin, err)
+	}
+
+	return true, nil
+}
+
+// hasCosignAttestation returns true if the cosign attestation image pqin
+// holds an attestation of the predicate type.
+func hasCosignAttestation(
+	pqin, predicateType string,
+	opts ...crane.Option,
+) (bool, error) {
+	b, err := crane.Manifest(pqin, opts...)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("reading %s: %w", pqin, err)
+	}
+
+	manifest, err := ggcrV1.ParseManifest(bytes.NewReader(b))
+	if err != nil {
+		return false, fmt.Errorf("parsing %s: %w", pqin, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		if layer.Annotations[cosignPredicateTypeAnnotation] == predicateType {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// FindAttachmentStatus checks the attachments of every image in the snapshot
+// rii of registryName concurrently, with checker. The images holding the
+// attachments themselves (all of whose tags are cosign attachment tags) are
+// left out. The result is sorted by image and digest. All failed checks are
+// reported together.
+func (sc *SyncContext) FindAttachmentStatus(
+	registryName RegistryName,
+	rii RegInvImage,
+	checker *AttachmentChecker,
+) ([]AttachmentStatus, error) {
+	images := make([]AttachmentStatus, 0)
+	for imageName, digestTags := range rii {
+		for digest, tags := range digestTags {
+			if isAttachment(tags) {
+				continue
+			}
+
+			images = append(images, AttachmentStatus{
+				Image:  imageName,
+				Digest: digest,
+				Tags:   tags,
+			})
+		}
+	}
+
+	errs := make([]error, len(images))
+	forEachConcurrently(sc.EffectiveReadThreads(), len(images), func(i int) {
+		status, err := checker.Check(
+			registryName,
+			images[i].Image,
+			images[i].Digest,
+			sc.copyOptions()...,
+		)
+		if err != nil {
+			errs[i] = err
+			return
+		}
+
+		images[i].HasSignature = status.HasSignature
+		images[i].HasSBOM = status.HasSBOM
+		images[i].HasScanAttestation = status.HasScanAttestation
+	})
+
+	failed := make([]string, 0)
+	for i, image := range images {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf(
+				"%s (%v)",
+				ToFQIN(registryName, image.Image, image.Digest),
+				errs[i],
+			))
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return nil, fmt.Errorf(
+			"checking the attachments of %d images: %s",
+			len(failed),
+			strings.Join(failed, ", "),
+		)
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Image != images[j].Image {
+			return images[i].Image < images[j].Image
+		}
+		return images[i].Digest < images[j].Digest
+	})
+
+	return images, nil
+}
+
+// isAttachment returns true if all the tags are cosign attachment tags.
+func isAttachment(tags TagSlice) bool {
+	if len(tags) == 0 {
+		return false
+	}
+
+	for _, tag := range tags {
+		if _, ok := CosignAttachmentSubject(tag); !ok {
+			return false
+		}
+	}
+
+	return true
+}
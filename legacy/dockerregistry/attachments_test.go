@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// pushAttestation attaches an attestation of the predicate type to the image
+// of repo with the cosign tag scheme.
+func pushAttestation(t *testing.T, repo string, digest reg.Digest, predicateType string) {
+	layer, err := random.Layer(128, "application/vnd.dsse.envelope.v1+json")
+	require.Nil(t, err)
+
+	att, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       layer,
+		Annotations: map[string]string{"predicateType": predicateType},
+	})
+	require.Nil(t, err)
+
+	digestTag := strings.Replace(string(digest), ":", "-", 1)
+	require.Nil(t, crane.Push(att, repo+":"+digestTag+".att"))
+}
+
+func TestFindAttachmentStatus(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	regName := reg.RegistryName(
+		strings.TrimPrefix(server.URL, "http://") + "/staging",
+	)
+
+	// foo has an SBOM (as a referrer), a signature and a scan attestation
+	// (with the cosign tag scheme).
+	foo := pushImageWithSBOM(t, server, string(regName)+"/foo", "referrers")
+	sig, err := random.Image(128, 1)
+	require.Nil(t, err)
+	sigTag := reg.Tag(strings.Replace(string(foo), ":", "-", 1) + ".sig")
+	require.Nil(t, crane.Push(sig, string(regName)+"/foo:"+string(sigTag)))
+	sigDigest, err := sig.Digest()
+	require.Nil(t, err)
+	pushAttestation(t, string(regName)+"/foo", foo, reg.VulnPredicateType)
+
+	// bar only has an attestation of another type.
+	bar := pushImageWithSBOM(t, server, string(regName)+"/bar", "")
+	pushAttestation(t, string(regName)+"/bar", bar, "https://slsa.dev/provenance/v0.2")
+
+	rii := reg.RegInvImage{
+		"foo": reg.DigestTags{
+			foo:                            reg.TagSlice{"latest"},
+			reg.Digest(sigDigest.String()): reg.TagSlice{sigTag},
+		},
+		"bar": reg.DigestTags{
+			bar: reg.TagSlice{"latest"},
+		},
+	}
+
+	sc := reg.SyncContext{}
+	got, err := sc.FindAttachmentStatus(regName, rii, reg.NewAttachmentChecker())
+	require.Nil(t, err)
+	require.Equal(t, []reg.AttachmentStatus{
+		{
+			Image:  "bar",
+			Digest: bar,
+			Tags:   reg.TagSlice{"latest"},
+		},
+		{
+			Image:              "foo",
+			Digest:             foo,
+			Tags:               reg.TagSlice{"latest"},
+			HasSignature:       true,
+			HasSBOM:            true,
+			HasScanAttestation: true,
+		},
+	}, got)
+}
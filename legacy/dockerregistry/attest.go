@@ -0,0 +1,250 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	grafeaspb "google.golang.org/genproto/googleapis/grafeas/v1"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+const (
+	// VulnPredicateType is the in-toto predicate type of cosign vulnerability
+	// scan attestations.
+	VulnPredicateType = "https://cosign.sigstore.dev/attestation/vuln/v1"
+
+	// containerAnalysisURI identifies the scanner in the attestations.
+	containerAnalysisURI = "https://cloud.google.com/container-analysis"
+)
+
+// ScanResult is the outcome of scanning the source image of an edge for
+// vulnerabilities. Err is set if the scan failed.
+type ScanResult struct {
+	Edge        PromotionEdge
+	Occurrences []*grafeaspb.Occurrence
+	Err         error
+	StartedOn   time.Time
+	FinishedOn  time.Time
+}
+
+// VulnPredicate is the predicate of a cosign vulnerability scan attestation.
+type VulnPredicate struct {
+	Invocation VulnInvocation `json:"invocation"`
+	Scanner    VulnScanner    `json:"scanner"`
+	Metadata   VulnMetadata   `json:"metadata"`
+}
+
+// VulnInvocation describes how the scan was run.
+type VulnInvocation struct {
+	Parameters interface{} `json:"parameters"`
+	URI        string      `json:"uri"`
+	EventID    string      `json:"event_id"`
+	BuilderID  string      `json:"builder.id"`
+}
+
+// VulnScanner describes the scanner and holds its findings.
+type VulnScanner struct {
+	URI     string        `json:"uri"`
+	Version string        `json:"version"`
+	DB      VulnDB        `json:"db"`
+	Result  []VulnFinding `json:"result"`
+}
+
+// VulnDB describes the vulnerability database of the scanner.
+type VulnDB struct {
+	URI     string `json:"uri"`
+	Version string `json:"version"`
+}
+
+// VulnMetadata holds the time the scan ran.
+type VulnMetadata struct {
+	ScanStartedOn  time.Time `json:"scanStartedOn"`
+	ScanFinishedOn time.Time `json:"scanFinishedOn"`
+}
+
+// VulnFinding is a single vulnerability found in the image.
+type VulnFinding struct {
+	ID               string  `json:"id"`
+	Severity         string  `json:"severity"`
+	CVSSScore        float32 `json:"cvssScore"`
+	FixAvailable     bool    `json:"fixAvailable"`
+	ShortDescription string  `json:"shortDescription,omitempty"`
+}
+
+// NewVulnPredicate wraps the findings of a successful scan in a predicate.
+func NewVulnPredicate(result *ScanResult) VulnPredicate {
+	findings := make([]VulnFinding, 0, len(result.Occurrences))
+	for _, occ := range result.Occurrences {
+		vuln := occ.GetVulnerability()
+		findings = append(findings, VulnFinding{
+			ID:               path.Base(occ.GetNoteName()),
+			Severity:         vuln.GetSeverity().String(),
+			CVSSScore:        vuln.GetCvssScore(),
+			FixAvailable:     vuln.GetFixAvailable(),
+			ShortDescription: vuln.GetShortDescription(),
+		})
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].ID < findings[j].ID
+	})
+
+	return VulnPredicate{
+		Scanner: VulnScanner{
+			URI:     containerAnalysisURI,
+			Version: "v1",
+			DB:      VulnDB{URI: containerAnalysisURI},
+			Result:  findings,
+		},
+		Metadata: VulnMetadata{
+			ScanStartedOn:  result.StartedOn.UTC(),
+			ScanFinishedOn: result.FinishedOn.UTC(),
+		},
+	}
+}
+
+// GetAttestCmd returns the command attaching the predicate stored in
+// predicateFile to the image as a signed cosign attestation of type vuln. If
+// key is empty, cosign signs without a key.
+func GetAttestCmd(fqin, predicateFile, key string) []string {
+	cmd := []string{
+		"cosign",
+		"attest",
+		"--type",
+		"vuln",
+		"--predicate",
+		predicateFile,
+	}
+
+	if key != "" {
+		cmd = append(cmd, "--key", key)
+	}
+
+	return append(cmd, fqin)
+}
+
+// AttachScanResults attaches the findings of every successful scan to the
+// scanned source image, with the command produced by mkProducer for the image
+// (as an FQIN) and the file holding its predicate. Images without a successful
+// scan are skipped and reported together. Without sc.Confirm, the
+// attestations are only logged.
+func (sc *SyncContext) AttachScanResults(
+	results []ScanResult,
+	mkProducer func(fqin, predicateFile string) stream.Producer,
+) error {
+	sorted := make([]ScanResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool {
+		return scanResultFQIN(&sorted[i]) < scanResultFQIN(&sorted[j])
+	})
+
+	unscanned := make([]string, 0)
+	failures := make([]string, 0)
+
+	for i := range sorted {
+		result := &sorted[i]
+		fqin := scanResultFQIN(result)
+
+		if result.Err != nil {
+			unscanned = append(unscanned, fmt.Sprintf("%s (%v)", fqin, result.Err))
+			continue
+		}
+
+		if !sc.Confirm {
+			logrus.Infof(
+				"Dry run: would attach %d scan findings to %s",
+				len(result.Occurrences),
+				fqin,
+			)
+			continue
+		}
+
+		if err := attachScanResult(result, fqin, mkProducer); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", fqin, err))
+			continue
+		}
+
+		logrus.Infof("Attached %d scan findings to %s", len(result.Occurrences), fqin)
+	}
+
+	if len(unscanned) > 0 {
+		logrus.Warnf(
+			"Not attaching scan results to %d images without a successful scan: %s",
+			len(unscanned),
+			strings.Join(unscanned, ", "),
+		)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"unable to attach scan results to %d images: %s",
+			len(failures),
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return nil
+}
+
+// attachScanResult writes the predicate of the scan result to a temporary file
+// and runs the command attaching it.
+func attachScanResult(
+	result *ScanResult,
+	fqin string,
+	mkProducer func(fqin, predicateFile string) stream.Producer,
+) error {
+	b, err := json.Marshal(NewVulnPredicate(result))
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile("", "cip-vuln-predicate-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return runProducer(mkProducer(fqin, f.Name()))
+}
+
+// scanResultFQIN returns the scanned source image.
+func scanResultFQIN(result *ScanResult) string {
+	return ToFQIN(
+		result.Edge.SrcRegistry.Name,
+		result.Edge.SrcImageTag.ImageName,
+		result.Edge.Digest,
+	)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	grafeaspb "google.golang.org/genproto/googleapis/grafeas/v1"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+func TestNewVulnPredicate(t *testing.T) {
+	started := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	result := reg.ScanResult{
+		Occurrences: []*grafeaspb.Occurrence{
+			{
+				NoteName: "projects/goog-vulnz/notes/CVE-2021-2",
+				Details: &grafeaspb.Occurrence_Vulnerability{
+					Vulnerability: &grafeaspb.VulnerabilityOccurrence{
+						Severity:  grafeaspb.Severity_LOW,
+						CvssScore: 3.5,
+					},
+				},
+			},
+			{
+				NoteName: "projects/goog-vulnz/notes/CVE-2021-1",
+				Details: &grafeaspb.Occurrence_Vulnerability{
+					Vulnerability: &grafeaspb.VulnerabilityOccurrence{
+						Severity:         grafeaspb.Severity_CRITICAL,
+						CvssScore:        9.8,
+						FixAvailable:     true,
+						ShortDescription: "remote code execution",
+					},
+				},
+			},
+		},
+		StartedOn:  started,
+		FinishedOn: started.Add(time.Minute),
+	}
+
+	predicate := reg.NewVulnPredicate(&result)
+	require.Equal(t, []reg.VulnFinding{
+		{
+			ID:               "CVE-2021-1",
+			Severity:         "CRITICAL",
+			CVSSScore:        9.8,
+			FixAvailable:     true,
+			ShortDescription: "remote code execution",
+		},
+		{
+			ID:        "CVE-2021-2",
+			Severity:  "LOW",
+			CVSSScore: 3.5,
+		},
+	}, predicate.Scanner.Result)
+	require.Equal(t, started, predicate.Metadata.ScanStartedOn)
+	require.Equal(t, started.Add(time.Minute), predicate.Metadata.ScanFinishedOn)
+}
+
+func TestGetAttestCmd(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		expected []string
+	}{
+		{
+			"Keyless",
+			"",
+			[]string{
+				"cosign", "attest", "--type", "vuln",
+				"--predicate", "/tmp/predicate",
+				"gcr.io/foo/bar@sha256:000",
+			},
+		},
+		{
+			"With key",
+			"gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/k",
+			[]string{
+				"cosign", "attest", "--type", "vuln",
+				"--predicate", "/tmp/predicate",
+				"--key", "gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/k",
+				"gcr.io/foo/bar@sha256:000",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(
+			t,
+			test.expected,
+			reg.GetAttestCmd("gcr.io/foo/bar@sha256:000", "/tmp/predicate", test.key),
+			test.name,
+		)
+	}
+}
+
+func TestAttachScanResults(t *testing.T) {
+	mkResult := func(image reg.ImageName, digest reg.Digest, err error) reg.ScanResult {
+		return reg.ScanResult{
+			Edge: reg.PromotionEdge{
+				SrcRegistry: reg.RegistryContext{Name: "gcr.io/src"},
+				SrcImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+				Digest:      digest,
+			},
+			Occurrences: []*grafeaspb.Occurrence{
+				{NoteName: "projects/goog-vulnz/notes/CVE-2021-1"},
+			},
+			Err: err,
+		}
+	}
+
+	results := []reg.ScanResult{
+		mkResult("foo", "sha256:000", nil),
+		mkResult("bar", "sha256:111", errors.New("scan failed")),
+		mkResult("baz", "sha256:222", nil),
+	}
+
+	attached := []string{}
+	predicates := []reg.VulnPredicate{}
+	mkProducer := func(fqin, predicateFile string) stream.Producer {
+		attached = append(attached, fqin)
+
+		b, err := ioutil.ReadFile(predicateFile)
+		require.Nil(t, err)
+		var predicate reg.VulnPredicate
+		require.Nil(t, json.Unmarshal(b, &predicate))
+		predicates = append(predicates, predicate)
+
+		var sr stream.Fake
+		return &sr
+	}
+
+	var sc reg.SyncContext
+
+	// Dry run.
+	require.Nil(t, sc.AttachScanResults(results, mkProducer))
+	require.Empty(t, attached)
+
+	// The image without a successful scan is skipped.
+	sc.Confirm = true
+	require.Nil(t, sc.AttachScanResults(results, mkProducer))
+	require.Equal(t, []string{
+		"gcr.io/src/baz@sha256:222",
+		"gcr.io/src/foo@sha256:000",
+	}, attached)
+	require.Len(t, predicates, 2)
+	require.Equal(t, "CVE-2021-1", predicates[0].Scanner.Result[0].ID)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sirupsen/logrus"
+)
+
+// ProbeAuth checks that the credentials used for promotion work, without
+// copying anything. For every source repository the manifest of one image is
+// fetched with a HEAD request, and in every destination repository a blob
+// upload is started and cancelled again, which requires push access. All
+// failures are reported together.
+func (sc *SyncContext) ProbeAuth(edges map[PromotionEdge]interface{}) error {
+	kc := sc.keychain()
+
+	srcProbes := make(map[string]string)
+	dstProbes := make(map[string]interface{})
+	for edge := range edges {
+		srcRepo := ToLQIN(edge.SrcRegistry.Name, edge.SrcImageTag.ImageName)
+		if _, ok := srcProbes[srcRepo]; !ok {
+			srcProbes[srcRepo] = ToFQIN(
+				edge.SrcRegistry.Name,
+				edge.SrcImageTag.ImageName,
+				edge.Digest,
+			)
+		}
+
+		dstProbes[ToLQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName)] = nil
+	}
+
+	// Probe all repositories concurrently; each probe records its failure
+	// (if any) in its own slot.
+	type probe struct {
+		repo  string
+		write bool
+		ref   string
+	}
+
+	probes := make([]probe, 0, len(srcProbes)+len(dstProbes))
+	for srcRepo, fqin := range srcProbes {
+		probes = append(probes, probe{repo: srcRepo, ref: fqin})
+	}
+	for dstRepo := range dstProbes {
+		probes = append(probes, probe{repo: dstRepo, write: true, ref: dstRepo})
+	}
+
+	results := make([]string, len(probes))
+	sc.forEachConcurrently(len(probes), func(i int) {
+		p := probes[i]
+		if p.write {
+			logrus.Debugf("probing write access to %s", p.repo)
+			if err := probeWrite(p.ref, kc, sc.transport()); err != nil {
+				results[i] = fmt.Sprintf("write %s: %v", p.repo, err)
+			}
+			return
+		}
+
+		logrus.Debugf("probing read access to %s", p.repo)
+		if err := probeRead(p.ref, kc, sc.transport()); err != nil {
+			results[i] = fmt.Sprintf("read %s: %v", p.repo, err)
+		}
+	})
+
+	failures := make([]string, 0)
+	for _, failure := range results {
+		if failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return fmt.Errorf(
+			"authentication probes failed: %s",
+			strings.Join(failures, "; "),
+		)
+	}
+
+	logrus.Infof(
+		"Authentication probes succeeded for %d source and %d destination repositories",
+		len(srcProbes),
+		len(dstProbes),
+	)
+
+	return nil
+}
+
+// probeRead fetches the manifest descriptor of the image at fqin.
+func probeRead(fqin string, kc authn.Keychain, transport http.RoundTripper) error {
+	ref, err := name.ParseReference(fqin)
+	if err != nil {
+		return err
+	}
+
+	_, err = remote.Head(
+		ref,
+		remote.WithAuthFromKeychain(kc),
+		remote.WithTransport(transport),
+	)
+	return err
+}
+
+// probeWrite checks that blobs can be pushed to the repository.
+func probeWrite(repo string, kc authn.Keychain, transport http.RoundTripper) error {
+	ref, err := name.ParseReference(repo)
+	if err != nil {
+		return err
+	}
+
+	return remote.CheckPushPermission(ref, kc, transport)
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestProbeAuth(t *testing.T) {
+	src := httptest.NewServer(registry.New())
+	defer src.Close()
+
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	// Rejects every request, like a registry we have no access to.
+	denied := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		},
+	))
+	defer denied.Close()
+
+	srcName := reg.RegistryName(strings.TrimPrefix(src.URL, "http://"))
+	dstName := reg.RegistryName(strings.TrimPrefix(dst.URL, "http://"))
+	deniedName := reg.RegistryName(strings.TrimPrefix(denied.URL, "http://"))
+
+	img, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	digest, err := img.Digest()
+	require.Nil(t, err)
+
+	srcRef, err := name.ParseReference(string(srcName) + "/foo:1.0")
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(srcRef, img))
+
+	mkEdge := func(srcName, dstName reg.RegistryName) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: srcName, Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: "1.0"},
+			Digest:      reg.Digest(digest.String()),
+			DstRegistry: reg.RegistryContext{Name: dstName},
+			DstImageTag: reg.ImageTag{ImageName: "foo", Tag: "1.0"},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		edges     map[reg.PromotionEdge]interface{}
+		expectErr string
+	}{
+		{
+			"Readable source, writable destination",
+			map[reg.PromotionEdge]interface{}{
+				mkEdge(srcName, dstName): nil,
+			},
+			"",
+		},
+		{
+			"Unwritable destination",
+			map[reg.PromotionEdge]interface{}{
+				mkEdge(srcName, deniedName): nil,
+			},
+			"write " + string(deniedName) + "/foo",
+		},
+		{
+			"Unreadable source",
+			map[reg.PromotionEdge]interface{}{
+				mkEdge(deniedName, dstName): nil,
+			},
+			"read " + string(deniedName) + "/foo",
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{}
+		err := sc.ProbeAuth(test.edges)
+		if test.expectErr == "" {
+			require.Nil(t, err, test.name)
+			continue
+		}
+
+		require.NotNil(t, err, test.name)
+		require.Contains(t, err.Error(), test.expectErr, test.name)
+	}
+}
+
+func TestProbeAuthDeterministic(t *testing.T) {
+	// Rejects every request, like a registry we have no access to.
+	denied := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		},
+	))
+	defer denied.Close()
+
+	deniedName := reg.RegistryName(strings.TrimPrefix(denied.URL, "http://"))
+
+	edges := make(map[reg.PromotionEdge]interface{})
+	for _, image := range []reg.ImageName{"a", "b", "c", "d"} {
+		edges[reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: deniedName, Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+			Digest:      "sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			DstRegistry: reg.RegistryContext{Name: deniedName},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+		}] = nil
+	}
+
+	// The probes run concurrently, but their failures are always reported in
+	// the same order.
+	sc := reg.SyncContext{Threads: 4}
+	first := sc.ProbeAuth(edges)
+	require.NotNil(t, first)
+	require.True(
+		t,
+		strings.Index(first.Error(), "read "+string(deniedName)+"/a") <
+			strings.Index(first.Error(), "read "+string(deniedName)+"/d"),
+	)
+
+	for i := 0; i < 5; i++ {
+		require.Equal(t, first.Error(), sc.ProbeAuth(edges).Error())
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DestinationBatcher paces the requests to every destination in batches:
+// once a batch of size requests to a destination has been started, the next
+// batch only starts after all of them have finished and delay has passed.
+// Within a batch, the requests run with the usual concurrency. A nil
+// *DestinationBatcher never interferes.
+type DestinationBatcher struct {
+	size  int
+	delay time.Duration
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+	dests map[RegistryName]*batchState
+}
+
+// batchState is the progress of the batches to one destination.
+type batchState struct {
+	batch     int // the current batch, counted from 1
+	batches   int // the expected number of batches, or 0 if unknown
+	started   int
+	inFlight  int
+	nextStart time.Time
+}
+
+// NewDestinationBatcher creates a DestinationBatcher which sends batches of
+// size requests to each destination, with delay between the batches.
+func NewDestinationBatcher(size int, delay time.Duration) *DestinationBatcher {
+	if size < 1 {
+		size = 1
+	}
+
+	b := &DestinationBatcher{
+		size:  size,
+		delay: delay,
+		dests: make(map[RegistryName]*batchState),
+	}
+	b.cond = sync.NewCond(&b.mutex)
+
+	return b
+}
+
+func (b *DestinationBatcher) state(dest RegistryName) *batchState {
+	s, ok := b.dests[dest]
+	if !ok {
+		s = &batchState{batch: 1}
+		b.dests[dest] = s
+	}
+
+	return s
+}
+
+// expect records how many requests will be sent to each destination of the
+// edges, so that the progress of the batches can be logged.
+func (b *DestinationBatcher) expect(edges map[PromotionEdge]interface{}) {
+	if b == nil {
+		return
+	}
+
+	counts := make(map[RegistryName]int)
+	for edge := range edges {
+		counts[edge.DstRegistry.Name]++
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for dest, count := range counts {
+		b.state(dest).batches = (count + b.size - 1) / b.size
+	}
+}
+
+// Acquire waits until another request may be sent to dest, which is when the
+// current batch of dest is not full yet, or when the next batch may start.
+func (b *DestinationBatcher) Acquire(dest RegistryName) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	s := b.state(dest)
+	for {
+		if s.started < b.size {
+			if wait := time.Until(s.nextStart); wait > 0 {
+				b.mutex.Unlock()
+				time.Sleep(wait)
+				b.mutex.Lock()
+				continue
+			}
+
+			if s.started == 0 {
+				logrus.Infof("Starting %s to %s", s.describe(), dest)
+			}
+			s.started++
+			s.inFlight++
+			return
+		}
+
+		b.cond.Wait()
+	}
+}
+
+// Release records that a request to dest acquired with Acquire has finished.
+func (b *DestinationBatcher) Release(dest RegistryName) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.cond.Broadcast()
+
+	s := b.state(dest)
+	s.inFlight--
+
+	// The batch is complete once all of its requests have finished.
+	if s.started == b.size && s.inFlight == 0 {
+		logrus.Infof("Finished %s to %s", s.describe(), dest)
+		s.batch++
+		s.started = 0
+		s.nextStart = time.Now().Add(b.delay)
+	}
+}
+
+// describe names the current batch, e.g. "batch 2 of 5".
+func (s *batchState) describe() string {
+	if s.batches == 0 {
+		return fmt.Sprintf("batch %d", s.batch)
+	}
+
+	return fmt.Sprintf("batch %d of %d", s.batch, s.batches)
+}
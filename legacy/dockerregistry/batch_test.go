@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestDestinationBatcher(t *testing.T) {
+	var disabled *reg.DestinationBatcher
+	disabled.Acquire("gcr.io/foo")
+	disabled.Release("gcr.io/foo")
+
+	const delay = 50 * time.Millisecond
+	b := reg.NewDestinationBatcher(2, delay)
+
+	var (
+		mutex    sync.Mutex
+		inFlight int
+		peak     int
+		starts   []time.Time
+		ends     []time.Time
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			b.Acquire("gcr.io/foo")
+			mutex.Lock()
+			starts = append(starts, time.Now())
+			inFlight++
+			if inFlight > peak {
+				peak = inFlight
+			}
+			mutex.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mutex.Lock()
+			inFlight--
+			ends = append(ends, time.Now())
+			mutex.Unlock()
+			b.Release("gcr.io/foo")
+		}()
+	}
+
+	// Other destinations have batches of their own.
+	start := time.Now()
+	b.Acquire("gcr.io/bar")
+	b.Acquire("gcr.io/bar")
+	require.Less(t, int64(time.Since(start)), int64(delay))
+	b.Release("gcr.io/bar")
+	b.Release("gcr.io/bar")
+
+	wg.Wait()
+
+	// Within a batch the requests run concurrently, but every batch starts
+	// only after the previous one has finished and the delay has passed.
+	require.Equal(t, 2, peak)
+	require.Len(t, starts, 5)
+	for _, i := range []int{2, 4} {
+		require.GreaterOrEqual(
+			t,
+			int64(starts[i].Sub(ends[i-1])),
+			int64(delay),
+			"batch starting with request %d",
+			i,
+		)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// breakerWindow is the number of most recent requests to a destination whose
+// error rate is considered.
+const breakerWindow = 10
+
+// DestinationBreaker applies backpressure to destinations which keep failing.
+// Once the error rate of the recent requests to a destination exceeds the
+// threshold, the number of concurrent requests to it is halved. A destination
+// which still fails with a single request in flight is aborted: all its
+// remaining requests fail immediately. A destination which recovers gets its
+// concurrency back step by step. A nil *DestinationBreaker never interferes.
+type DestinationBreaker struct {
+	threshold      float64
+	maxConcurrency int
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+	dests map[RegistryName]*destinationState
+}
+
+// destinationState is the recent history of the requests to one destination.
+type destinationState struct {
+	outcomes []bool // true for failed requests
+	inFlight int
+	limit    int
+	aborted  bool
+}
+
+// NewDestinationBreaker creates a DestinationBreaker which trips when more
+// than threshold (between 0 and 1) of the recent requests to a destination
+// failed. Destinations start with maxConcurrency concurrent requests.
+func NewDestinationBreaker(threshold float64, maxConcurrency int) *DestinationBreaker {
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+
+	b := &DestinationBreaker{
+		threshold:      threshold,
+		maxConcurrency: maxConcurrency,
+		dests:          make(map[RegistryName]*destinationState),
+	}
+	b.cond = sync.NewCond(&b.mutex)
+
+	return b
+}
+
+func (b *DestinationBreaker) state(dest RegistryName) *destinationState {
+	s, ok := b.dests[dest]
+	if !ok {
+		s = &destinationState{limit: b.maxConcurrency}
+		b.dests[dest] = s
+	}
+
+	return s
+}
+
+// Acquire waits until another request may be sent to dest. It returns an
+// error if dest has been aborted.
+func (b *DestinationBreaker) Acquire(dest RegistryName) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	s := b.state(dest)
+	for !s.aborted && s.inFlight >= s.limit {
+		b.cond.Wait()
+	}
+
+	if s.aborted {
+		return fmt.Errorf(
+			"promotions to %s were aborted after persistent errors",
+			dest,
+		)
+	}
+
+	s.inFlight++
+	return nil
+}
+
+// Release records the outcome of a request to dest acquired with Acquire, and
+// adjusts the concurrency of dest to its error rate.
+func (b *DestinationBreaker) Release(dest RegistryName, failed bool) {
+	if b == nil {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.cond.Broadcast()
+
+	s := b.state(dest)
+	s.inFlight--
+	s.outcomes = append(s.outcomes, failed)
+
+	if len(s.outcomes) < breakerWindow {
+		return
+	}
+
+	failures := 0
+	for _, outcome := range s.outcomes {
+		if outcome {
+			failures++
+		}
+	}
+	rate := float64(failures) / float64(len(s.outcomes))
+	s.outcomes = nil
+
+	switch {
+	case rate > b.threshold && s.limit == 1:
+		s.aborted = true
+		logrus.Errorf(
+			"Circuit breaker: aborting promotions to %s, %.0f%% of the last %d requests failed",
+			dest,
+			rate*100,
+			breakerWindow,
+		)
+	case rate > b.threshold:
+		s.limit /= 2
+		if s.limit < 1 {
+			s.limit = 1
+		}
+		logrus.Warnf(
+			"Circuit breaker: reducing concurrency to %s to %d, %.0f%% of the last %d requests failed",
+			dest,
+			s.limit,
+			rate*100,
+			breakerWindow,
+		)
+	case s.limit < b.maxConcurrency:
+		s.limit *= 2
+		if s.limit > b.maxConcurrency {
+			s.limit = b.maxConcurrency
+		}
+		logrus.Infof(
+			"Circuit breaker: restoring concurrency to %s to %d",
+			dest,
+			s.limit,
+		)
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestDestinationBreaker(t *testing.T) {
+	var disabled *reg.DestinationBreaker
+	require.Nil(t, disabled.Acquire("gcr.io/foo"))
+	disabled.Release("gcr.io/foo", true)
+
+	// send runs n requests to dest, which fail if failed is true, and returns
+	// the first error returned by Acquire.
+	send := func(b *reg.DestinationBreaker, dest reg.RegistryName, n int, failed bool) error {
+		for i := 0; i < n; i++ {
+			if err := b.Acquire(dest); err != nil {
+				return err
+			}
+			b.Release(dest, failed)
+		}
+		return nil
+	}
+
+	b := reg.NewDestinationBreaker(0.5, 2)
+
+	// Errors below the threshold are tolerated.
+	require.Nil(t, send(b, "gcr.io/foo", 5, true))
+	require.Nil(t, send(b, "gcr.io/foo", 5, false))
+
+	// The first window of failures halves the concurrency, the second one
+	// aborts the destination.
+	require.Nil(t, send(b, "gcr.io/foo", 10, true))
+	require.Nil(t, send(b, "gcr.io/foo", 10, true))
+	require.Error(t, b.Acquire("gcr.io/foo"))
+
+	// Other destinations are unaffected.
+	require.Nil(t, send(b, "gcr.io/bar", 20, false))
+
+	// A destination which recovers is not aborted.
+	require.Nil(t, send(b, "gcr.io/baz", 10, true))
+	require.Nil(t, send(b, "gcr.io/baz", 10, false))
+	require.Nil(t, send(b, "gcr.io/baz", 10, true))
+	require.Nil(t, b.Acquire("gcr.io/baz"))
+}
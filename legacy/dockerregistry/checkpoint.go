@@ -0,0 +1,213 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
+)
+
+// Checkpoint lists the edges promoted so far by a run, so that a restarted run
+// can skip them instead of starting over.
+type Checkpoint struct {
+	Completed []CheckpointEntry `json:"completed"`
+}
+
+// CheckpointEntry identifies a promoted edge by its source image (FQIN) and
+// its destination (a PQIN, or an FQIN for tagless promotions).
+type CheckpointEntry struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+}
+
+// checkpointEntry returns the CheckpointEntry of a PromotionRequest.
+func checkpointEntry(req PromotionRequest) CheckpointEntry {
+	entry := CheckpointEntry{
+		Source: ToFQIN(req.RegistrySrc, req.ImageNameSrc, req.Digest),
+	}
+
+	if len(req.Tag) > 0 {
+		entry.Destination = ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag)
+	} else {
+		entry.Destination = ToFQIN(req.RegistryDest, req.ImageNameDest, req.Digest)
+	}
+
+	return entry
+}
+
+// ReadCheckpoint reads the Checkpoint written to path by a Checkpointer.
+func ReadCheckpoint(path string) (*Checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint %s: %w", path, err)
+	}
+
+	return &cp, nil
+}
+
+// FilterEdges returns the edges which were not yet promoted according to the
+// checkpoint.
+func (cp *Checkpoint) FilterEdges(
+	edges map[PromotionEdge]interface{},
+) map[PromotionEdge]interface{} {
+	completed := make(map[CheckpointEntry]interface{}, len(cp.Completed))
+	for _, entry := range cp.Completed {
+		completed[entry] = nil
+	}
+
+	filtered := make(map[PromotionEdge]interface{})
+	for edge := range edges {
+		entry := checkpointEntry(PromotionRequest{
+			RegistrySrc:   edge.SrcRegistry.Name,
+			RegistryDest:  edge.DstRegistry.Name,
+			ImageNameSrc:  edge.SrcImageTag.ImageName,
+			ImageNameDest: edge.DstImageTag.ImageName,
+			Digest:        edge.Digest,
+			Tag:           edge.DstImageTag.Tag,
+		})
+		if _, ok := completed[entry]; ok {
+			logrus.Infof("Skipping %s: already promoted before the restart", entry.Destination)
+			continue
+		}
+
+		filtered[edge] = nil
+	}
+
+	return filtered
+}
+
+// Checkpointer records the successfully promoted edges and writes them as a
+// Checkpoint after every interval edges, so that a run which is killed loses
+// at most interval edges of progress. The checkpoint is written to a temporary
+// file which is then renamed, so a kill never leaves a truncated checkpoint
+// behind.
+//
+// Promote writes the checkpoint a final time when it finishes, so that it
+// lists every edge promoted by the run (and by the runs it resumed). The
+// checkpoint is kept afterwards: it is the complete record of what the run
+// promoted, and resuming from it again promotes nothing twice. A nil
+// *Checkpointer records nothing.
+type Checkpointer struct {
+	path     string
+	interval int
+
+	mutex     sync.Mutex
+	completed map[CheckpointEntry]interface{}
+	pending   int
+}
+
+// NewCheckpointer creates a Checkpointer writing to path every interval
+// edges. The entries of previous (which may be nil), read from the checkpoint
+// of an earlier run, are carried over.
+func NewCheckpointer(path string, interval int, previous *Checkpoint) *Checkpointer {
+	if interval < 1 {
+		interval = 1
+	}
+
+	c := &Checkpointer{
+		path:      path,
+		interval:  interval,
+		completed: make(map[CheckpointEntry]interface{}),
+	}
+
+	if previous != nil {
+		for _, entry := range previous.Completed {
+			c.completed[entry] = nil
+		}
+	}
+
+	return c
+}
+
+// Record marks the request as successfully promoted, and writes the checkpoint
+// if interval edges were recorded since it was last written. A failure to
+// write the checkpoint does not fail the promotion; it is only logged.
+func (c *Checkpointer) Record(req PromotionRequest) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.completed[checkpointEntry(req)] = nil
+	c.pending++
+
+	if c.pending < c.interval {
+		return
+	}
+
+	if err := c.write(); err != nil {
+		logrus.Warnf("Unable to write checkpoint %s: %v", c.path, err)
+	}
+}
+
+// Flush writes the checkpoint if any edges were recorded since it was last
+// written.
+func (c *Checkpointer) Flush() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.pending == 0 {
+		return nil
+	}
+
+	return c.write()
+}
+
+// write writes the checkpoint. The caller must hold the mutex.
+func (c *Checkpointer) write() error {
+	cp := Checkpoint{Completed: make([]CheckpointEntry, 0, len(c.completed))}
+	for entry := range c.completed {
+		cp.Completed = append(cp.Completed, entry)
+	}
+
+	sort.Slice(cp.Completed, func(i, j int) bool {
+		if cp.Completed[i].Destination != cp.Completed[j].Destination {
+			return cp.Completed[i].Destination < cp.Completed[j].Destination
+		}
+		return cp.Completed[i].Source < cp.Completed[j].Source
+	})
+
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := upload.Write(c.path, b); err != nil {
+		return err
+	}
+
+	c.pending = 0
+	return nil
+}
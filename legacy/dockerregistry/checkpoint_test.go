@@ -0,0 +1,113 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestCheckpointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cip-checkpoint-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "checkpoint.json")
+
+	digest := reg.Digest("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	mkRequest := func(tag reg.Tag) reg.PromotionRequest {
+		return reg.PromotionRequest{
+			TagOp:         reg.Add,
+			RegistrySrc:   "gcr.io/src",
+			RegistryDest:  "gcr.io/dst",
+			ImageNameSrc:  "foo",
+			ImageNameDest: "foo",
+			Digest:        digest,
+			Tag:           tag,
+		}
+	}
+	mkEdge := func(tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src"},
+			SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/dst"},
+			DstImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+		}
+	}
+
+	c := reg.NewCheckpointer(path, 2, nil)
+
+	// Nothing is written until the interval is reached.
+	c.Record(mkRequest("1.0"))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	c.Record(mkRequest("2.0"))
+	cp, err := reg.ReadCheckpoint(path)
+	require.Nil(t, err)
+	require.Equal(t, []reg.CheckpointEntry{
+		{
+			Source:      "gcr.io/src/foo@" + string(digest),
+			Destination: "gcr.io/dst/foo:1.0",
+		},
+		{
+			Source:      "gcr.io/src/foo@" + string(digest),
+			Destination: "gcr.io/dst/foo:2.0",
+		},
+	}, cp.Completed)
+
+	// The final flush writes the remaining edges.
+	c.Record(mkRequest(""))
+	require.Nil(t, c.Flush())
+	cp, err = reg.ReadCheckpoint(path)
+	require.Nil(t, err)
+	require.Len(t, cp.Completed, 3)
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 1)
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("1.0"): nil,
+		mkEdge("3.0"): nil,
+		mkEdge(""):    nil,
+	}
+	require.Equal(t, map[reg.PromotionEdge]interface{}{
+		mkEdge("3.0"): nil,
+	}, cp.FilterEdges(edges))
+
+	// A resumed run carries over the edges of the checkpoint it resumed.
+	resumed := reg.NewCheckpointer(path, 10, cp)
+	resumed.Record(mkRequest("3.0"))
+	require.Nil(t, resumed.Flush())
+	cp, err = reg.ReadCheckpoint(path)
+	require.Nil(t, err)
+	require.Len(t, cp.Completed, 4)
+
+	// A nil Checkpointer records nothing.
+	var none *reg.Checkpointer
+	none.Record(mkRequest("4.0"))
+	require.Nil(t, none.Flush())
+}
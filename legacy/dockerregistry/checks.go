@@ -26,6 +26,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	containeranalysis "cloud.google.com/go/containeranalysis/apiv1"
 	"github.com/sirupsen/logrus"
@@ -266,10 +267,10 @@ func MKImageVulnCheck(
 	fakeVulnProducer ImageVulnProducer,
 ) *ImageVulnCheck {
 	return &ImageVulnCheck{
-		*syncContext,
-		newPullEdges,
-		severityThreshold,
-		fakeVulnProducer,
+		SyncContext:       *syncContext,
+		PullEdges:         newPullEdges,
+		SeverityThreshold: severityThreshold,
+		FakeVulnProducer:  fakeVulnProducer,
 	}
 }
 
@@ -316,6 +317,9 @@ func (check *ImageVulnCheck) Run() error {
 	}
 
 	vulnerableImages := make([]string, 0)
+	// The annotations are only written once all workers are done, so that
+	// they are not interleaved with each other.
+	annotations := make([]string, 0)
 	var processRequest ProcessRequest = func(
 		sc *SyncContext,
 		reqs chan stream.ExternalRequest,
@@ -331,7 +335,19 @@ func (check *ImageVulnCheck) Run() error {
 				logrus.Errorf("invalid type for promotion edge: %v", edge)
 			}
 
+			startedOn := time.Now()
 			occurrences, err := vulnProducer(edge)
+
+			mutex.Lock()
+			check.Results = append(check.Results, ScanResult{
+				Edge:        edge,
+				Occurrences: occurrences,
+				Err:         err,
+				StartedOn:   startedOn,
+				FinishedOn:  time.Now(),
+			})
+			mutex.Unlock()
+
 			if err != nil {
 				errs = append(
 					errs,
@@ -343,6 +359,7 @@ func (check *ImageVulnCheck) Run() error {
 			}
 
 			fixableSevereOccurrences := 0
+			edgeAnnotations := make([]string, 0)
 			for _, occ := range occurrences {
 				vuln := occ.GetVulnerability()
 				vulnErr := ImageVulnError{
@@ -354,17 +371,34 @@ func (check *ImageVulnCheck) Run() error {
 				// The vulnerability check should only reject a PR if it finds
 				// vulnerabilities that are both fixable and severe
 				if vuln.GetFixAvailable() &&
-					IsSevereOccurrence(vuln, check.SeverityThreshold) {
+					check.isSevere(vuln) {
 					errs = append(errs, Error{
 						Context: "Vulnerability Occurrence w/ Fix Available",
 						Error:   vulnErr,
 					})
 					fixableSevereOccurrences++
+
+					if check.GitHubAnnotations {
+						edgeAnnotations = append(
+							edgeAnnotations,
+							GitHubAnnotation("error", occ, &edge),
+						)
+					}
 				} else {
 					logrus.Error(vulnErr)
+
+					if check.GitHubAnnotations &&
+						check.isSevere(vuln) {
+						edgeAnnotations = append(
+							edgeAnnotations,
+							GitHubAnnotation("warning", occ, &edge),
+						)
+					}
 				}
 			}
 
+			mutex.Lock()
+			annotations = append(annotations, edgeAnnotations...)
 			if fixableSevereOccurrences > 0 {
 				vulnerableImages = append(vulnerableImages,
 					fmt.Sprintf("%v@%v [%v fixable severe vulnerabilities, "+
@@ -374,6 +408,7 @@ func (check *ImageVulnCheck) Run() error {
 						fixableSevereOccurrences,
 						len(occurrences)))
 			}
+			mutex.Unlock()
 
 			reqRes.Errors = errs
 			requestResults <- reqRes
@@ -384,6 +419,12 @@ func (check *ImageVulnCheck) Run() error {
 		populateRequests,
 		processRequest,
 	)
+
+	sort.Strings(annotations)
+	for _, annotation := range annotations {
+		fmt.Fprintln(check.SyncContext.out(), annotation)
+	}
+
 	if err != nil {
 		sort.Strings(vulnerableImages)
 		return fmt.Errorf("VulnerabilityCheck: "+
@@ -401,6 +442,14 @@ func (err ImageVulnError) Error() string {
 	return string(vulnJSON)
 }
 
+// isSevere checks if a vulnerability is a high enough severity to fail the
+// ImageVulnCheck, after normalizing its severity with the SeverityMapping of
+// the SyncContext.
+func (check *ImageVulnCheck) isSevere(vuln *grafeaspb.VulnerabilityOccurrence) bool {
+	severity := check.SyncContext.SeverityMapping.Normalize(vuln)
+	return int(severity) >= check.SeverityThreshold
+}
+
 // IsSevereOccurrence checks if a vulnerability is a high enough severity to
 // fail the ImageVulnCheck.
 func IsSevereOccurrence(
@@ -411,6 +460,64 @@ func IsSevereOccurrence(
 	return int(severityLevel) >= severityThreshold
 }
 
+// GitHubAnnotation formats a vulnerability occurrence as a GitHub Actions
+// workflow command of the given level ("error" or "warning").
+func GitHubAnnotation(
+	level string,
+	occ *grafeaspb.Occurrence,
+	edge *PromotionEdge,
+) string {
+	vuln := occ.GetVulnerability()
+
+	title := fmt.Sprintf(
+		"%s in %s@%s",
+		path.Base(occ.GetNoteName()),
+		edge.SrcImageTag.ImageName,
+		edge.Digest,
+	)
+
+	fix := "no fix available"
+	if vuln.GetFixAvailable() {
+		fix = "fix available"
+	}
+
+	message := fmt.Sprintf(
+		"%s vulnerability (%s): %s",
+		vuln.GetSeverity(),
+		fix,
+		vuln.GetShortDescription(),
+	)
+
+	return fmt.Sprintf(
+		"::%s title=%s::%s",
+		level,
+		escapeGitHubProperty(title),
+		escapeGitHubData(message),
+	)
+}
+
+// escapeGitHubData escapes the message part of a GitHub Actions workflow
+// command.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+	).Replace(s)
+}
+
+// escapeGitHubProperty escapes a property value of a GitHub Actions workflow
+// command.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer(
+		"%", "%25",
+		"\r", "%0D",
+		"\n", "%0A",
+		":", "%3A",
+		",", "%2C",
+	).Replace(s)
+}
+
 func parseImageProjectID(edge *PromotionEdge) (string, error) {
 	const projectIDIndex = 1
 	splitName := strings.Split(string(edge.SrcRegistry.Name), "/")
@@ -17,6 +17,7 @@ limitations under the License.
 package inventory_test
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 
@@ -571,3 +572,112 @@ func TestImageVulnCheck(t *testing.T) {
 		require.Equal(t, test.expected, got)
 	}
 }
+
+func TestImageVulnCheckGitHubAnnotations(t *testing.T) {
+	mkEdge := func(image reg.ImageName, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcImageTag: reg.ImageTag{ImageName: image},
+			Digest:      digest,
+			DstImageTag: reg.ImageTag{ImageName: image},
+		}
+	}
+	mkOccurrence := func(
+		cve string,
+		severity grafeaspb.Severity,
+		fixAvailable bool,
+	) *grafeaspb.Occurrence {
+		return &grafeaspb.Occurrence{
+			NoteName: "projects/goog-vulnz/notes/" + cve,
+			Details: &grafeaspb.Occurrence_Vulnerability{
+				Vulnerability: &grafeaspb.VulnerabilityOccurrence{
+					Severity:         severity,
+					FixAvailable:     fixAvailable,
+					ShortDescription: "bad",
+				},
+			},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("foo", "sha256:000"): nil,
+		mkEdge("bar", "sha256:111"): nil,
+	}
+	vulnerabilities := map[reg.Digest][]*grafeaspb.Occurrence{
+		"sha256:000": {
+			mkOccurrence("CVE-2021-0001", grafeaspb.Severity_CRITICAL, true),
+			mkOccurrence("CVE-2021-0002", grafeaspb.Severity_LOW, true),
+		},
+		"sha256:111": {
+			mkOccurrence("CVE-2021-0003", grafeaspb.Severity_HIGH, false),
+		},
+	}
+
+	var out bytes.Buffer
+	sc := reg.SyncContext{Out: &out}
+	check := reg.MKImageVulnCheck(
+		&sc,
+		edges,
+		int(grafeaspb.Severity_HIGH),
+		func(edge reg.PromotionEdge) ([]*grafeaspb.Occurrence, error) {
+			return vulnerabilities[edge.Digest], nil
+		},
+	)
+	check.GitHubAnnotations = true
+	require.Error(t, check.Run())
+
+	// Only severe vulnerabilities are annotated, once all of them are known.
+	require.Equal(t, `::error title=CVE-2021-0001 in foo@sha256%3A000::CRITICAL vulnerability (fix available): bad
+::warning title=CVE-2021-0003 in bar@sha256%3A111::HIGH vulnerability (no fix available): bad
+`, out.String())
+}
+
+func TestGitHubAnnotation(t *testing.T) {
+	edge := reg.PromotionEdge{
+		SrcImageTag: reg.ImageTag{
+			ImageName: "foo",
+		},
+		Digest: "sha256:000",
+	}
+
+	tests := []struct {
+		name     string
+		level    string
+		occ      *grafeaspb.Occurrence
+		expected string
+	}{
+		{
+			"Fixable vulnerability",
+			"error",
+			&grafeaspb.Occurrence{
+				NoteName: "projects/goog-vulnz/notes/CVE-2021-0001",
+				Details: &grafeaspb.Occurrence_Vulnerability{
+					Vulnerability: &grafeaspb.VulnerabilityOccurrence{
+						Severity:         grafeaspb.Severity_CRITICAL,
+						FixAvailable:     true,
+						ShortDescription: "100% bad",
+					},
+				},
+			},
+			"::error title=CVE-2021-0001 in foo@sha256%3A000::CRITICAL vulnerability (fix available): 100%25 bad",
+		},
+		{
+			"Unfixable vulnerability",
+			"warning",
+			&grafeaspb.Occurrence{
+				NoteName: "projects/goog-vulnz/notes/CVE-2021-0002",
+				Details: &grafeaspb.Occurrence_Vulnerability{
+					Vulnerability: &grafeaspb.VulnerabilityOccurrence{
+						Severity:         grafeaspb.Severity_HIGH,
+						ShortDescription: "line one\nline two",
+					},
+				},
+			},
+			"::warning title=CVE-2021-0002 in foo@sha256%3A000::HIGH vulnerability (no fix available): line one%0Aline two",
+		},
+	}
+
+	for _, test := range tests {
+		got := reg.GitHubAnnotation(test.level, test.occ, &edge)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
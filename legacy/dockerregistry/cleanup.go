@@ -0,0 +1,258 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// CleanupRule names the tags which are superseded whenever Promoted is
+// promoted to a new digest, such as a 'stable-prev' tag left on the previous
+// 'stable' digest.
+type CleanupRule struct {
+	// Image restricts the rule to a single image; by default, the rule
+	// applies to every image.
+	Image      ImageName `yaml:"image,omitempty"`
+	Promoted   Tag       `yaml:"promoted"`
+	Superseded []Tag     `yaml:"superseded"`
+}
+
+// TagCleanup is a superseded tag to delete from a destination image.
+type TagCleanup struct {
+	Registry  RegistryContext
+	ImageName ImageName
+	Tag       Tag
+	// Digest is the digest the superseded tag points to.
+	Digest Digest
+	// SupersededBy is the promoted tag (as a PQIN) superseding Tag.
+	SupersededBy string
+	// PromotedDigest is the digest SupersededBy must point to before Tag is
+	// deleted.
+	PromotedDigest Digest
+}
+
+// ParseCleanupRulesYAML parses a YAML list of CleanupRules.
+func ParseCleanupRulesYAML(b []byte) ([]CleanupRule, error) {
+	var rules []CleanupRule
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if err := ValidateTag(rule.Promoted); err != nil {
+			return nil, fmt.Errorf("invalid cleanup rule: %w", err)
+		}
+
+		if len(rule.Superseded) == 0 {
+			return nil, fmt.Errorf(
+				"invalid cleanup rule for %q: no superseded tags",
+				rule.Promoted,
+			)
+		}
+
+		for _, tag := range rule.Superseded {
+			if err := ValidateTag(tag); err != nil {
+				return nil, fmt.Errorf("invalid cleanup rule: %w", err)
+			}
+
+			if tag == rule.Promoted {
+				return nil, fmt.Errorf(
+					"invalid cleanup rule for %q: a tag cannot supersede itself",
+					rule.Promoted,
+				)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// ParseCleanupRulesFromFile parses the CleanupRules stored in filePath.
+func ParseCleanupRulesFromFile(filePath string) ([]CleanupRule, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCleanupRulesYAML(b)
+}
+
+// PlanTagCleanup finds the superseded tags of the promotions matched by the
+// rules. In a real run, only successful promotions count; in a dry run, the
+// captured requests do, so that the cleanup can be previewed. Requests which
+// were not started before the deadline never count. A superseded tag is only
+// cleaned up if, according to the destination inventory read before the
+// promotion, it points to another digest than the one just promoted.
+func (sc *SyncContext) PlanTagCleanup(rules []CleanupRule) []TagCleanup {
+	cleanups := make([]TagCleanup, 0)
+	seen := make(map[string]interface{})
+
+	for _, result := range sc.PromotionResults {
+		req := result.Request
+		if len(result.Errors) > 0 || req.TagOp != Add ||
+			result.DeadlineReached || (result.Skipped && sc.Confirm) {
+			continue
+		}
+
+		promotedDigest := req.Digest
+		if transformed, ok := sc.TransformedDigest[req.Digest]; ok {
+			promotedDigest = transformed
+		}
+
+		for _, rule := range rules {
+			if rule.Promoted != req.Tag ||
+				(rule.Image != "" && rule.Image != req.ImageNameDest) {
+				continue
+			}
+
+			digestTags := sc.Inv[req.RegistryDest][req.ImageNameDest]
+			for _, superseded := range rule.Superseded {
+				for digest, tags := range digestTags {
+					if digest == promotedDigest {
+						continue
+					}
+
+					if _, ok := tags.ToTagSet()[superseded]; !ok {
+						continue
+					}
+
+					pqin := ToPQIN(req.RegistryDest, req.ImageNameDest, superseded)
+					if _, ok := seen[pqin]; ok {
+						continue
+					}
+					seen[pqin] = nil
+
+					cleanups = append(cleanups, TagCleanup{
+						Registry: RegistryContext{
+							Name:           req.RegistryDest,
+							ServiceAccount: req.ServiceAccount,
+						},
+						ImageName:      req.ImageNameDest,
+						Tag:            superseded,
+						Digest:         digest,
+						SupersededBy:   ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag),
+						PromotedDigest: promotedDigest,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(cleanups, func(i, j int) bool {
+		return cleanups[i].String() < cleanups[j].String()
+	})
+
+	return cleanups
+}
+
+// String describes the cleanup.
+func (c TagCleanup) String() string {
+	return fmt.Sprintf(
+		"%s (at %s, superseded by %s)",
+		ToPQIN(c.Registry.Name, c.ImageName, c.Tag),
+		c.Digest,
+		c.SupersededBy,
+	)
+}
+
+// CleanupTags deletes the superseded tags, each with the command produced by
+// mkProducer. A tag is only deleted once the tag superseding it has been
+// verified to point to the promoted digest, so that there is always a valid
+// tag to deploy from. Without sc.Confirm, the cleanups are only logged.
+func (sc *SyncContext) CleanupTags(
+	cleanups []TagCleanup,
+	mkProducer func(TagCleanup) stream.Producer,
+) error {
+	failures := make([]string, 0)
+
+	for _, cleanup := range cleanups {
+		// Nothing was promoted during a dry run, so there is nothing to
+		// verify either.
+		if !sc.Confirm {
+			logrus.Infof("Dry run: would delete superseded tag %s", cleanup)
+			continue
+		}
+
+		actual, err := crane.Digest(cleanup.SupersededBy, sc.copyOptions()...)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: verifying %s: %v", cleanup, cleanup.SupersededBy, err))
+			continue
+		}
+
+		if Digest(actual) != cleanup.PromotedDigest {
+			failures = append(failures, fmt.Sprintf(
+				"%s: %s points to %s, not the promoted %s",
+				cleanup,
+				cleanup.SupersededBy,
+				actual,
+				cleanup.PromotedDigest,
+			))
+			continue
+		}
+
+		if err := runProducer(mkProducer(cleanup)); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", cleanup, err))
+			continue
+		}
+
+		logrus.Infof("Deleted superseded tag %s", cleanup)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"unable to clean up %d superseded tags: %s",
+			len(failures),
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return nil
+}
+
+// runProducer runs the producer to completion. Its output is only reported if
+// it fails.
+func runProducer(producer stream.Producer) error {
+	stdout, stderr, err := producer.Produce()
+	if err != nil {
+		return err
+	}
+
+	out, err := ioutil.ReadAll(stdout)
+	if err != nil {
+		return err
+	}
+
+	errOut, err := ioutil.ReadAll(stderr)
+	if err != nil {
+		return err
+	}
+
+	if err := producer.Close(); err != nil {
+		return fmt.Errorf("%w: %s%s", err, out, errOut)
+	}
+
+	return nil
+}
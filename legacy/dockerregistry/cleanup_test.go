@@ -0,0 +1,242 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+func TestParseCleanupRulesYAML(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  []reg.CleanupRule
+		expectErr bool
+	}{
+		{
+			"Valid rules",
+			`- promoted: stable
+  superseded: [stable-prev]
+- image: foo
+  promoted: latest
+  superseded: [previous, older]
+`,
+			[]reg.CleanupRule{
+				{
+					Promoted:   "stable",
+					Superseded: []reg.Tag{"stable-prev"},
+				},
+				{
+					Image:      "foo",
+					Promoted:   "latest",
+					Superseded: []reg.Tag{"previous", "older"},
+				},
+			},
+			false,
+		},
+		{
+			"No superseded tags",
+			`- promoted: stable
+`,
+			nil,
+			true,
+		},
+		{
+			"Tag superseding itself",
+			`- promoted: stable
+  superseded: [stable]
+`,
+			nil,
+			true,
+		},
+		{
+			"Invalid tag",
+			`- promoted: stable
+  superseded: ["-prev"]
+`,
+			nil,
+			true,
+		},
+		{
+			"Unknown field",
+			`- promoted: stable
+  superseded: [stable-prev]
+  digest: sha256:0000000000000000000000000000000000000000000000000000000000000000
+`,
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.ParseCleanupRulesYAML([]byte(test.input))
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestCleanupTags(t *testing.T) {
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	dstName := reg.RegistryName(strings.TrimPrefix(dst.URL, "http://"))
+
+	img, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	digest, err := img.Digest()
+	require.Nil(t, err)
+
+	ref, err := name.ParseReference(string(dstName) + "/foo:stable")
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(ref, img))
+
+	newDigest := reg.Digest(digest.String())
+	oldDigest := reg.Digest("sha256:" + strings.Repeat("0", 64))
+	otherDigest := reg.Digest("sha256:" + strings.Repeat("1", 64))
+
+	mkResult := func(image reg.ImageName, tag reg.Tag) reg.PromotionResult {
+		return reg.PromotionResult{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/src",
+				RegistryDest:  dstName,
+				ImageNameSrc:  image,
+				ImageNameDest: image,
+				Digest:        newDigest,
+				Tag:           tag,
+			},
+		}
+	}
+
+	failed := mkResult("foo", "latest")
+	failed.Errors = reg.Errors{{Context: "copy", Error: nil}}
+
+	expired := mkResult("foo", "latest")
+	expired.Skipped = true
+	expired.DeadlineReached = true
+
+	captured := mkResult("bar", "latest")
+	captured.Skipped = true
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			dstName: reg.RegInvImage{
+				"foo": reg.DigestTags{
+					oldDigest:   reg.TagSlice{"stable", "stable-prev"},
+					otherDigest: reg.TagSlice{"previous"},
+				},
+				"bar": reg.DigestTags{
+					oldDigest:   reg.TagSlice{"stable-prev"},
+					otherDigest: reg.TagSlice{"previous"},
+				},
+			},
+		},
+		PromotionResults: []reg.PromotionResult{
+			mkResult("foo", "stable"),
+			mkResult("bar", "stable"),
+			failed,
+			expired,
+			captured,
+		},
+	}
+
+	rules := []reg.CleanupRule{
+		{
+			Image:      "foo",
+			Promoted:   "stable",
+			Superseded: []reg.Tag{"stable-prev", "missing"},
+		},
+		{
+			Promoted:   "latest",
+			Superseded: []reg.Tag{"previous"},
+		},
+	}
+
+	// During a dry run, the captured promotion of bar:latest is planned too.
+	require.Equal(t, []reg.TagCleanup{
+		{
+			Registry:       reg.RegistryContext{Name: dstName},
+			ImageName:      "bar",
+			Tag:            "previous",
+			Digest:         otherDigest,
+			SupersededBy:   string(dstName) + "/bar:latest",
+			PromotedDigest: newDigest,
+		},
+		{
+			Registry:       reg.RegistryContext{Name: dstName},
+			ImageName:      "foo",
+			Tag:            "stable-prev",
+			Digest:         oldDigest,
+			SupersededBy:   string(dstName) + "/foo:stable",
+			PromotedDigest: newDigest,
+		},
+	}, sc.PlanTagCleanup(rules))
+
+	// Only foo matches the image of the first rule, the promotion of foo for
+	// the second rule failed and then ran out of time, and bar was not
+	// promoted by a real run.
+	sc.Confirm = true
+	cleanups := sc.PlanTagCleanup(rules)
+	sc.Confirm = false
+	require.Equal(t, []reg.TagCleanup{
+		{
+			Registry:       reg.RegistryContext{Name: dstName},
+			ImageName:      "foo",
+			Tag:            "stable-prev",
+			Digest:         oldDigest,
+			SupersededBy:   string(dstName) + "/foo:stable",
+			PromotedDigest: newDigest,
+		},
+	}, cleanups)
+
+	var untagged []reg.Tag
+	mkProducer := func(cleanup reg.TagCleanup) stream.Producer {
+		untagged = append(untagged, cleanup.Tag)
+		var sr stream.Fake
+		return &sr
+	}
+
+	// Dry run.
+	require.Nil(t, sc.CleanupTags(cleanups, mkProducer))
+	require.Empty(t, untagged)
+
+	sc.Confirm = true
+	require.Nil(t, sc.CleanupTags(cleanups, mkProducer))
+	require.Equal(t, []reg.Tag{"stable-prev"}, untagged)
+
+	// The superseded tag is kept if the promoted tag points elsewhere.
+	untagged = nil
+	cleanups[0].PromotedDigest = otherDigest
+	require.Error(t, sc.CleanupTags(cleanups, mkProducer))
+	require.Empty(t, untagged)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"sort"
+
+	ggcrV1Types "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ClearRepositoryPlan lists every image ClearRepository deletes from the
+// registry regName, as read into sc.Inv: all manifest lists first, then the
+// remaining images. Images of unknown media type, and images uploaded within
+// sc.PruneMinAge, are skipped, as they are by ClearRepository.
+func (sc *SyncContext) ClearRepositoryPlan(regName RegistryName) ClearPlan {
+	plan := ClearPlan{
+		Repository: regName,
+		Images:     make([]ClearPlanImage, 0),
+	}
+
+	for _, registry := range sc.RegistryContexts {
+		if registry.Name != regName {
+			continue
+		}
+
+		for imageName, digestTags := range sc.Inv[registry.Name] {
+			for digest, tags := range digestTags {
+				mediaType, ok := sc.DigestMediaType[digest]
+				if !ok {
+					continue
+				}
+				if sc.uploadedWithin(registry.Name, digest, sc.PruneMinAge) {
+					continue
+				}
+
+				plan.Images = append(plan.Images, ClearPlanImage{
+					Image:     imageName,
+					Digest:    digest,
+					MediaType: string(mediaType),
+					Tags:      tags,
+					Command: GetDeleteCmd(
+						registry,
+						sc.UseServiceAccount,
+						imageName,
+						digest,
+						true,
+					),
+				})
+			}
+		}
+	}
+
+	isList := func(i int) bool {
+		return plan.Images[i].MediaType == string(ggcrV1Types.DockerManifestList)
+	}
+
+	sort.Slice(plan.Images, func(i, j int) bool {
+		if isList(i) != isList(j) {
+			return isList(i)
+		}
+
+		if plan.Images[i].Image != plan.Images[j].Image {
+			return plan.Images[i].Image < plan.Images[j].Image
+		}
+
+		return plan.Images[i].Digest < plan.Images[j].Digest
+	})
+
+	return plan
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	ggcrV1Types "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// failingProducer is a stream.Fake whose process fails.
+type failingProducer struct {
+	stream.Fake
+}
+
+func (p *failingProducer) Produce() (stdout, stderr io.Reader, err error) {
+	stdout, stderr, _ = p.Fake.Produce()
+	return stdout, stderr, errors.New("permission denied")
+}
+
+func TestClearRepositoryPlan(t *testing.T) {
+	rc := reg.RegistryContext{Name: "gcr.io/foo"}
+
+	sc := reg.SyncContext{
+		RegistryContexts: []reg.RegistryContext{
+			rc,
+			{Name: "gcr.io/bar"},
+		},
+		Inv: reg.MasterInventory{
+			"gcr.io/foo": reg.RegInvImage{
+				"a": reg.DigestTags{
+					"sha256:111": {"1.0"},
+					"sha256:222": {"2.0", "latest"},
+					"sha256:333": {},
+				},
+				"b": reg.DigestTags{
+					"sha256:444": {"1.0"},
+				},
+			},
+			"gcr.io/bar": reg.RegInvImage{
+				"a": reg.DigestTags{
+					"sha256:111": {"1.0"},
+				},
+			},
+		},
+		DigestMediaType: reg.DigestMediaType{
+			"sha256:111": ggcrV1Types.DockerManifestSchema2,
+			"sha256:222": ggcrV1Types.DockerManifestList,
+			"sha256:444": ggcrV1Types.DockerManifestSchema2,
+		},
+	}
+
+	deleteCmd := func(img reg.ImageName, digest reg.Digest) []string {
+		return reg.GetDeleteCmd(rc, false, img, digest, true)
+	}
+
+	require.Equal(
+		t,
+		reg.ClearPlan{
+			Repository: "gcr.io/foo",
+			Images: []reg.ClearPlanImage{
+				{
+					Image:     "a",
+					Digest:    "sha256:222",
+					MediaType: string(ggcrV1Types.DockerManifestList),
+					Tags:      reg.TagSlice{"2.0", "latest"},
+					Command:   deleteCmd("a", "sha256:222"),
+				},
+				{
+					Image:     "a",
+					Digest:    "sha256:111",
+					MediaType: string(ggcrV1Types.DockerManifestSchema2),
+					Tags:      reg.TagSlice{"1.0"},
+					Command:   deleteCmd("a", "sha256:111"),
+				},
+				{
+					Image:     "b",
+					Digest:    "sha256:444",
+					MediaType: string(ggcrV1Types.DockerManifestSchema2),
+					Tags:      reg.TagSlice{"1.0"},
+					Command:   deleteCmd("b", "sha256:444"),
+				},
+			},
+		},
+		sc.ClearRepositoryPlan("gcr.io/foo"),
+	)
+}
+
+func TestClearRepositoryPlanKeepsRecentImages(t *testing.T) {
+	rc := reg.RegistryContext{Name: "gcr.io/foo"}
+
+	sc := reg.SyncContext{
+		RegistryContexts: []reg.RegistryContext{rc, {Name: "gcr.io/bar"}},
+		Inv: reg.MasterInventory{
+			"gcr.io/foo": reg.RegInvImage{
+				"a": reg.DigestTags{
+					"sha256:111": {"1.0"},
+					"sha256:222": {"2.0"},
+				},
+			},
+		},
+		DigestMediaType: reg.DigestMediaType{
+			"sha256:111": ggcrV1Types.DockerManifestSchema2,
+			"sha256:222": ggcrV1Types.DockerManifestSchema2,
+		},
+		DigestUploaded: reg.DigestUploaded{
+			"gcr.io/foo": {
+				"sha256:111": time.Now().Add(-48 * time.Hour),
+				"sha256:222": time.Now().Add(-time.Minute),
+			},
+			// Only the upload time to the cleared registry counts.
+			"gcr.io/bar": {
+				"sha256:111": time.Now().Add(-time.Minute),
+			},
+		},
+		PruneMinAge: time.Hour,
+	}
+
+	require.Equal(
+		t,
+		reg.ClearPlan{
+			Repository: "gcr.io/foo",
+			Images: []reg.ClearPlanImage{
+				{
+					Image:     "a",
+					Digest:    "sha256:111",
+					MediaType: string(ggcrV1Types.DockerManifestSchema2),
+					Tags:      reg.TagSlice{"1.0"},
+					Command:   reg.GetDeleteCmd(rc, false, "a", "sha256:111", true),
+				},
+			},
+		},
+		sc.ClearRepositoryPlan("gcr.io/foo"),
+	)
+}
+
+func TestClearRepository(t *testing.T) {
+	sc := reg.SyncContext{
+		Confirm:          true,
+		RegistryContexts: []reg.RegistryContext{{Name: "gcr.io/foo"}},
+		Inv: reg.MasterInventory{
+			"gcr.io/foo": reg.RegInvImage{
+				"a": reg.DigestTags{
+					"sha256:111": {"1.0"},
+					"sha256:222": {"2.0"},
+				},
+			},
+		},
+		DigestMediaType: reg.DigestMediaType{
+			"sha256:111": ggcrV1Types.DockerManifestSchema2,
+			"sha256:222": ggcrV1Types.DockerManifestList,
+		},
+	}
+
+	deleted := make(chan reg.Digest, 2)
+	mkProducer := func(
+		_ reg.RegistryContext,
+		_ reg.ImageName,
+		digest reg.Digest,
+	) stream.Producer {
+		deleted <- digest
+		if digest == "sha256:111" {
+			return &failingProducer{stream.Fake{Bytes: []byte("[]")}}
+		}
+		return &stream.Fake{Bytes: []byte("[]")}
+	}
+
+	// The manifest list is deleted first, and the failed deletion does not
+	// go unnoticed.
+	err := sc.ClearRepository("gcr.io/foo", mkProducer, nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "1 errors clearing gcr.io/foo")
+	require.Contains(t, err.Error(), "deleting gcr.io/foo/a@sha256:111: running process: permission denied")
+
+	close(deleted)
+	order := make([]reg.Digest, 0, 2)
+	for digest := range deleted {
+		order = append(order, digest)
+	}
+	require.Equal(t, []reg.Digest{"sha256:222", "sha256:111"}, order)
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// NewClientCertTransport returns an HTTP transport which presents the client
+// certificate in certFile (with its private key in keyFile, both PEM
+// encoded) to registries which require mutual TLS. Otherwise, it behaves like
+// http.DefaultTransport.
+func NewClientCertTransport(certFile, keyFile string) (http.RoundTripper, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	return transport, nil
+}
+
+// transport returns the HTTP transport used to talk to the registries of the
+// SyncContext.
+func (sc *SyncContext) transport() http.RoundTripper {
+	if sc.Transport == nil {
+		return http.DefaultTransport
+	}
+
+	return sc.Transport
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import "sync"
+
+// forEachConcurrently calls check for every index below n, with as many
+// workers as ExecRequests uses. Checks write their outcome to the index they
+// are given, so results can be aggregated in a deterministic order regardless
+// of which check completes first.
+func (sc *SyncContext) forEachConcurrently(n int, check func(i int)) {
+	forEachConcurrently(sc.Threads, n, check)
+}
+
+// forEachConcurrently calls check for every index below n with the given
+// number of workers, or 10 workers if threads is not positive.
+func forEachConcurrently(threads, n int, check func(i int)) {
+	workers := 10
+	if threads > 0 {
+		workers = threads
+	}
+
+	indexes := make(chan int)
+	wg := new(sync.WaitGroup)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				check(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	wg.Wait()
+}
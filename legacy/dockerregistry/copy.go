@@ -0,0 +1,180 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrGoogle "github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	cr "github.com/google/go-containerregistry/pkg/v1/types"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/gcloud"
+)
+
+// ManifestListMediaTypes are the media types a manifest list can be converted
+// to, keyed by the name accepted on the command line.
+var ManifestListMediaTypes = map[string]cr.MediaType{
+	"docker": cr.DockerManifestList,
+	"oci":    cr.OCIImageIndex,
+}
+
+// CopyImage copies the image (or manifest list) at srcVertex to dstVertex. The
+// layer blobs of a single image are transferred with up to layerConcurrency
+// concurrent uploads (a value of 0 keeps the library default). The manifest is
+// only written once all of its blobs are present at the destination, so a
+// partially copied image is never visible there.
+func CopyImage(
+	srcVertex, dstVertex string,
+	layerConcurrency int,
+	opts ...crane.Option,
+) error {
+	if layerConcurrency > 0 {
+		opts = append(opts, func(o *crane.Options) {
+			o.Remote = append(o.Remote, remote.WithJobs(layerConcurrency))
+		})
+	}
+
+	return crane.Copy(srcVertex, dstVertex, opts...)
+}
+
+// ConvertManifestList copies the manifest list at srcVertex to dstVertex,
+// rewriting its media type to mediaType; the child images are copied as they
+// are. As the conversion changes the digest of the manifest list, a dstVertex
+// referencing a digest is written under the converted digest instead. It
+// returns the digest written to the destination.
+func ConvertManifestList(
+	srcVertex, dstVertex string,
+	mediaType cr.MediaType,
+	layerConcurrency int,
+	opts ...crane.Option,
+) (Digest, error) {
+	o := crane.GetOptions(opts...)
+	if layerConcurrency > 0 {
+		o.Remote = append(o.Remote, remote.WithJobs(layerConcurrency))
+	}
+
+	srcRef, err := name.ParseReference(srcVertex, o.Name...)
+	if err != nil {
+		return "", err
+	}
+
+	idx, err := remote.Index(srcRef, o.Remote...)
+	if err != nil {
+		return "", fmt.Errorf("reading manifest list %s: %w", srcVertex, err)
+	}
+
+	converted := mutate.IndexMediaType(idx, mediaType)
+	digest, err := converted.Digest()
+	if err != nil {
+		return "", fmt.Errorf("converting manifest list %s: %w", srcVertex, err)
+	}
+
+	dstRef, err := name.ParseReference(dstVertex, o.Name...)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := dstRef.(name.Digest); ok {
+		dstRef = dstRef.Context().Digest(digest.String())
+	}
+
+	if err := remote.WriteIndex(dstRef, converted, o.Remote...); err != nil {
+		return "", fmt.Errorf("writing manifest list %s: %w", dstRef, err)
+	}
+
+	return Digest(digest.String()), nil
+}
+
+// convertsManifestList returns true if the digest is a manifest list which
+// has to be converted to sc.ManifestListMediaType.
+func (sc *SyncContext) convertsManifestList(digest Digest) bool {
+	if sc.ManifestListMediaType == "" {
+		return false
+	}
+
+	mediaType, ok := sc.DigestMediaType[digest]
+	return ok && mediaType.IsIndex() && mediaType != sc.ManifestListMediaType
+}
+
+// copyOptions returns the crane options needed to authenticate against the
+// registries of the SyncContext.
+func (sc *SyncContext) copyOptions() []crane.Option {
+	opts := []crane.Option{crane.WithAuthFromKeychain(sc.keychain())}
+
+	if sc.Transport != nil {
+		opts = append(opts, crane.WithTransport(sc.Transport))
+	}
+
+	return opts
+}
+
+// keychain returns the keychain used to authenticate against the registries of
+// the SyncContext.
+func (sc *SyncContext) keychain() authn.Keychain {
+	keychain := authn.DefaultKeychain
+	if sc.TokenAuth != nil {
+		keychain = sc.TokenAuth.Keychain(sc.RegistryContexts)
+	}
+
+	if !sc.UseServiceAccount {
+		return keychain
+	}
+
+	return authn.NewMultiKeychain(
+		&serviceAccountKeychain{rcs: sc.RegistryContexts},
+		keychain,
+	)
+}
+
+// serviceAccountKeychain authenticates against the registries whose service
+// account is held in memory (see gcloud.LoadServiceAccountsFromSources) with
+// access tokens minted from its key. Other registries are left to the next
+// keychain.
+type serviceAccountKeychain struct {
+	rcs []RegistryContext
+}
+
+// Resolve implements authn.Keychain.
+func (kc *serviceAccountKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	var match *RegistryContext
+	for i := range kc.rcs {
+		rc := &kc.rcs[i]
+		name := string(rc.Name)
+		if target.String() != name && !strings.HasPrefix(target.String(), name+"/") {
+			continue
+		}
+		if match == nil || len(name) > len(match.Name) {
+			match = rc
+		}
+	}
+
+	if match == nil {
+		return authn.Anonymous, nil
+	}
+
+	ts, ok := gcloud.InMemoryTokenSource(match.ServiceAccount)
+	if !ok {
+		return authn.Anonymous, nil
+	}
+
+	return ggcrGoogle.NewTokenSourceAuthenticator(ts), nil
+}
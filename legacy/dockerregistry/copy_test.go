@@ -0,0 +1,210 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	ggcrV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// TestCopyImageLayerConcurrency copies a multi-layer image between two
+// in-memory registries and checks that every blob referenced by the manifest
+// is already present at the destination when the manifest is written.
+func TestCopyImageLayerConcurrency(t *testing.T) {
+	src := httptest.NewServer(registry.New())
+	defer src.Close()
+
+	dstRegistry := registry.New()
+
+	var (
+		mutex           sync.Mutex
+		manifestsPushed int
+		missingBlobs    []string
+	)
+
+	dst := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut &&
+				strings.Contains(r.URL.Path, "/manifests/") {
+				body, err := ioutil.ReadAll(r.Body)
+				require.Nil(t, err)
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+				manifest, err := ggcrV1.ParseManifest(bytes.NewReader(body))
+				require.Nil(t, err)
+
+				descriptors := append(
+					[]ggcrV1.Descriptor{manifest.Config},
+					manifest.Layers...,
+				)
+
+				mutex.Lock()
+				manifestsPushed++
+				for _, desc := range descriptors {
+					rec := httptest.NewRecorder()
+					dstRegistry.ServeHTTP(rec, httptest.NewRequest(
+						http.MethodHead,
+						"/v2/bar/blobs/"+desc.Digest.String(),
+						nil,
+					))
+					if rec.Code != http.StatusOK {
+						missingBlobs = append(missingBlobs, desc.Digest.String())
+					}
+				}
+				mutex.Unlock()
+			}
+
+			dstRegistry.ServeHTTP(w, r)
+		},
+	))
+	defer dst.Close()
+
+	const layers = 8
+	img, err := random.Image(1024, layers)
+	require.Nil(t, err)
+
+	srcVertex := strings.TrimPrefix(src.URL, "http://") + "/foo:1.0"
+	dstVertex := strings.TrimPrefix(dst.URL, "http://") + "/bar:1.0"
+
+	srcRef, err := name.ParseReference(srcVertex)
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(srcRef, img))
+
+	require.Nil(t, reg.CopyImage(srcVertex, dstVertex, 3))
+
+	require.Equal(t, 1, manifestsPushed)
+	require.Empty(t, missingBlobs)
+
+	expected, err := img.Digest()
+	require.Nil(t, err)
+
+	dstRef, err := name.ParseReference(dstVertex)
+	require.Nil(t, err)
+	got, err := remote.Image(dstRef)
+	require.Nil(t, err)
+	gotDigest, err := got.Digest()
+	require.Nil(t, err)
+	require.Equal(t, expected, gotDigest)
+
+	gotLayers, err := got.Layers()
+	require.Nil(t, err)
+	require.Len(t, gotLayers, layers)
+}
+
+func TestConvertManifestList(t *testing.T) {
+	src := httptest.NewServer(registry.New())
+	defer src.Close()
+
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	idx, err := random.Index(1024, 1, 2)
+	require.Nil(t, err)
+	idx = mutate.IndexMediaType(idx, types.OCIImageIndex)
+
+	srcDigest, err := idx.Digest()
+	require.Nil(t, err)
+
+	srcHost := strings.TrimPrefix(src.URL, "http://")
+	dstHost := strings.TrimPrefix(dst.URL, "http://")
+
+	srcRef, err := name.ParseReference(srcHost + "/foo:1.0")
+	require.Nil(t, err)
+	require.Nil(t, remote.WriteIndex(srcRef, idx))
+
+	tests := []struct {
+		name      string
+		dstVertex string
+	}{
+		{"Tagged", dstHost + "/bar:1.0"},
+		{"Tagless", dstHost + "/bar@" + srcDigest.String()},
+	}
+
+	for _, test := range tests {
+		got, err := reg.ConvertManifestList(
+			srcHost+"/foo@"+srcDigest.String(),
+			test.dstVertex,
+			types.DockerManifestList,
+			0,
+		)
+		require.Nil(t, err, test.name)
+		require.NotEqual(t, reg.Digest(srcDigest.String()), got, test.name)
+
+		dstRef, err := name.ParseReference(dstHost + "/bar@" + string(got))
+		require.Nil(t, err, test.name)
+		desc, err := remote.Get(dstRef)
+		require.Nil(t, err, test.name)
+		require.Equal(t, types.DockerManifestList, desc.MediaType, test.name)
+
+		dstIdx, err := desc.ImageIndex()
+		require.Nil(t, err, test.name)
+		manifest, err := dstIdx.IndexManifest()
+		require.Nil(t, err, test.name)
+		require.Len(t, manifest.Manifests, 2, test.name)
+	}
+
+	// Once the converted digest is recorded, later runs recognize both edges
+	// as already promoted.
+	converted, err := reg.ConvertManifestList(
+		srcHost+"/foo@"+srcDigest.String(),
+		dstHost+"/bar:1.0",
+		types.DockerManifestList,
+		0,
+	)
+	require.Nil(t, err)
+
+	edges := make(map[reg.PromotionEdge]interface{})
+	for _, tag := range []reg.Tag{"1.0", ""} {
+		edges[reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: reg.RegistryName(srcHost)},
+			SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+			Digest:      reg.Digest(srcDigest.String()),
+			DstRegistry: reg.RegistryContext{Name: reg.RegistryName(dstHost)},
+			DstImageTag: reg.ImageTag{ImageName: "bar", Tag: tag},
+		}] = nil
+	}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			reg.RegistryName(srcHost): reg.RegInvImage{
+				"foo": reg.DigestTags{reg.Digest(srcDigest.String()): reg.TagSlice{"1.0"}},
+			},
+		},
+		TransformedDigest: reg.TransformedDigest{reg.Digest(srcDigest.String()): converted},
+	}
+	require.Nil(t, sc.ReadDestinationsPerEdge(edges))
+
+	toPromote, clean := sc.GetPromotionCandidates(edges)
+	require.True(t, clean)
+	require.Empty(t, toPromote)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDeadlineReached is returned by Promote if the deadline of the run passed
+// before every request was started. The requests which were started have
+// finished, so the promotion is partial, but consistent.
+var ErrDeadlineReached = errors.New("deadline reached, partial promotion")
+
+// deadlineReached tells whether the deadline of the run has passed at now.
+func (sc *SyncContext) deadlineReached(now time.Time) bool {
+	return !sc.Deadline.IsZero() && !now.Before(sc.Deadline)
+}
+
+// UnstartedRequests lists the destinations of the requests which Promote did
+// not start because the deadline had passed, in order. They are what a
+// follow-up run has to promote.
+func (sc *SyncContext) UnstartedRequests() []string {
+	unstarted := make([]string, 0)
+	for _, result := range sc.PromotionResults {
+		if !result.DeadlineReached {
+			continue
+		}
+
+		unstarted = append(unstarted, sc.displayDestination(result.Request))
+	}
+	sort.Strings(unstarted)
+
+	return unstarted
+}
+
+// checkDeadline logs the requests left unstarted by the deadline, and returns
+// ErrDeadlineReached (mentioning err, the outcome of the requests which were
+// executed) if there are any.
+func (sc *SyncContext) checkDeadline(err error) error {
+	unstarted := sc.UnstartedRequests()
+	if len(unstarted) == 0 {
+		return nil
+	}
+
+	logrus.Warnf(
+		"The deadline %s was reached; %d requests were not started and are left for a follow-up run:",
+		sc.Deadline.Format(time.RFC3339),
+		len(unstarted),
+	)
+	for _, destination := range unstarted {
+		logrus.Warnf("  %s", destination)
+	}
+
+	msg := fmt.Sprintf("%d requests not started: %s", len(unstarted), strings.Join(unstarted, ", "))
+	if err != nil {
+		msg += fmt.Sprintf(" (and some of the started ones failed: %v)", err)
+	}
+
+	return fmt.Errorf("%w: %s", ErrDeadlineReached, msg)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestUnstartedRequests(t *testing.T) {
+	mkResult := func(
+		image reg.ImageName,
+		tag reg.Tag,
+		deadlineReached bool,
+	) reg.PromotionResult {
+		return reg.PromotionResult{
+			Request: reg.PromotionRequest{
+				RegistryDest:  "gcr.io/prod",
+				ImageNameDest: image,
+				Digest:        "sha256:111",
+				Tag:           tag,
+			},
+			Skipped:         deadlineReached,
+			DeadlineReached: deadlineReached,
+		}
+	}
+
+	sc := reg.SyncContext{
+		PromotionResults: []reg.PromotionResult{
+			mkResult("foo", "1.0", false),
+			mkResult("foo", "2.0", true),
+			mkResult("bar", "", true),
+			mkResult("bar", "1.0", true),
+		},
+	}
+
+	require.Equal(
+		t,
+		[]string{
+			"gcr.io/prod/bar:1.0",
+			"gcr.io/prod/bar@sha256:111",
+			"gcr.io/prod/foo:2.0",
+		},
+		sc.UnstartedRequests(),
+	)
+
+	require.Empty(t, (&reg.SyncContext{}).UnstartedRequests())
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+// edgeIdentity is what makes two edges identical: the same digest promoted
+// from the same source image to the same destination image and tag. Edges
+// which only differ in the credentials of their registries (e.g. manifests
+// of different teams using different service accounts for a registry) are
+// identical.
+type edgeIdentity struct {
+	srcRegistry, dstRegistry RegistryName
+	srcImage, dstImage       ImageName
+	tag                      Tag
+	digest                   Digest
+}
+
+// edgeSet collects the edges of manifests which may declare the same edges,
+// as merged team manifests do. Only the first of identical edges is kept, but
+// the manifest files declaring it are all recorded.
+type edgeSet struct {
+	edges map[PromotionEdge]interface{}
+	seen  map[edgeIdentity]PromotionEdge
+	// origins lists the manifest files declaring each kept edge.
+	origins    map[PromotionEdge][]string
+	duplicates int
+}
+
+func newEdgeSet() *edgeSet {
+	return &edgeSet{
+		edges:   make(map[PromotionEdge]interface{}),
+		seen:    make(map[edgeIdentity]PromotionEdge),
+		origins: make(map[PromotionEdge][]string),
+	}
+}
+
+// add adds the edge declared in the manifest file origin, unless an identical
+// edge was already added.
+func (s *edgeSet) add(edge PromotionEdge, origin string) {
+	id := edgeIdentity{
+		srcRegistry: edge.SrcRegistry.Name,
+		dstRegistry: edge.DstRegistry.Name,
+		srcImage:    edge.SrcImageTag.ImageName,
+		dstImage:    edge.DstImageTag.ImageName,
+		tag:         edge.DstImageTag.Tag,
+		digest:      edge.Digest,
+	}
+	if kept, ok := s.seen[id]; ok {
+		s.duplicates++
+		s.addOrigin(kept, origin)
+		return
+	}
+
+	s.seen[id] = edge
+	s.edges[edge] = nil
+	s.addOrigin(edge, origin)
+}
+
+func (s *edgeSet) addOrigin(edge PromotionEdge, origin string) {
+	if origin == "" {
+		return
+	}
+
+	for _, known := range s.origins[edge] {
+		if known == origin {
+			return
+		}
+	}
+
+	s.origins[edge] = append(s.origins[edge], origin)
+}
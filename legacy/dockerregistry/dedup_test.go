@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestToPromotionEdgesDeduplicates(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/foo", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/bar", ServiceAccount: "team-a"}
+	// Another team uses a different service account for the same registry.
+	otherDstRC := reg.RegistryContext{Name: "gcr.io/bar", ServiceAccount: "team-b"}
+
+	mkManifest := func(dst reg.RegistryContext, dmap reg.DigestTags) reg.Manifest {
+		mfest := reg.Manifest{
+			Registries: []reg.RegistryContext{srcRC, dst},
+			Images:     []reg.Image{{ImageName: "a", Dmap: dmap}},
+		}
+		require.Nil(t, mfest.Finalize())
+		return mfest
+	}
+	mkEdge := func(dst reg.RegistryContext, digest reg.Digest, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: srcRC,
+			SrcImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+			Digest:      digest,
+			DstRegistry: dst,
+			DstImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		mfests      []reg.Manifest
+		expected    map[reg.PromotionEdge]interface{}
+		expectedErr string
+	}{
+		{
+			name: "identical edges",
+			mfests: []reg.Manifest{
+				mkManifest(dstRC, reg.DigestTags{
+					"sha256:000": {"1.0"},
+					"sha256:111": {},
+				}),
+				mkManifest(dstRC, reg.DigestTags{
+					"sha256:000": {"1.0"},
+					"sha256:111": {},
+				}),
+			},
+			expected: map[reg.PromotionEdge]interface{}{
+				mkEdge(dstRC, "sha256:000", "1.0"): nil,
+				mkEdge(dstRC, "sha256:111", ""):    nil,
+			},
+		},
+		{
+			name: "identical edges with different credentials",
+			mfests: []reg.Manifest{
+				mkManifest(dstRC, reg.DigestTags{"sha256:000": {"1.0"}}),
+				mkManifest(otherDstRC, reg.DigestTags{"sha256:000": {"1.0", "1.0.0"}}),
+			},
+			// The first manifest wins.
+			expected: map[reg.PromotionEdge]interface{}{
+				mkEdge(dstRC, "sha256:000", "1.0"):        nil,
+				mkEdge(otherDstRC, "sha256:000", "1.0.0"): nil,
+			},
+		},
+		{
+			name: "conflicting edges",
+			mfests: []reg.Manifest{
+				mkManifest(dstRC, reg.DigestTags{"sha256:000": {"1.0"}}),
+				mkManifest(dstRC, reg.DigestTags{"sha256:111": {"1.0"}}),
+			},
+			expectedErr: "overlapping edges detected",
+		},
+	}
+
+	for _, test := range tests {
+		edges, err := reg.ToPromotionEdges(test.mfests)
+		if test.expectedErr != "" {
+			require.Error(t, err, test.name)
+			require.Contains(t, err.Error(), test.expectedErr, test.name)
+			continue
+		}
+
+		require.Nil(t, err, test.name)
+		require.Equal(t, test.expected, edges, test.name)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import "sort"
+
+// RegistryDelta lists the differences between the live contents of a source
+// and a destination registry. Backlog has what the source has but the
+// destination lacks (i.e. what is left to promote), and Drift what the
+// destination has but the source lacks. Promotion from Source to Destination
+// is complete when Backlog is empty.
+type RegistryDelta struct {
+	Source      RegistryName `json:"source" yaml:"source"`
+	Destination RegistryName `json:"destination" yaml:"destination"`
+	Backlog     []DeltaImage `json:"backlog" yaml:"backlog"`
+	Drift       []DeltaImage `json:"drift" yaml:"drift"`
+}
+
+// DeltaImage is a digest of an image present in only one of the registries of
+// a RegistryDelta, or present in both but missing some of its tags in one of
+// them. Tags lists the tags missing from the other registry.
+type DeltaImage struct {
+	Image  ImageName `json:"image" yaml:"image"`
+	Digest Digest    `json:"digest" yaml:"digest"`
+	Tags   TagSlice  `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// RegistryDelta compares the registries src and dst, as read into sc.Inv, and
+// returns the images of each which are missing from the other.
+func (sc *SyncContext) RegistryDelta(src, dst RegistryName) RegistryDelta {
+	return RegistryDelta{
+		Source:      src,
+		Destination: dst,
+		Backlog:     missingImages(sc.Inv[src], sc.Inv[dst]),
+		Drift:       missingImages(sc.Inv[dst], sc.Inv[src]),
+	}
+}
+
+// missingImages returns the digests and tags of a which are missing from b. A
+// digest which is in both, but lacks some of its tags in b, is returned with
+// just the missing tags.
+func missingImages(a, b RegInvImage) []DeltaImage {
+	missing := make([]DeltaImage, 0)
+	for imageName, digestTags := range a {
+		for digest, tags := range digestTags {
+			otherTags, ok := b[imageName][digest]
+			if !ok {
+				missing = append(missing, DeltaImage{
+					Image:  imageName,
+					Digest: digest,
+					Tags:   sortTags(tags),
+				})
+				continue
+			}
+
+			present := make(map[Tag]bool, len(otherTags))
+			for _, tag := range otherTags {
+				present[tag] = true
+			}
+
+			var missingTags TagSlice
+			for _, tag := range tags {
+				if !present[tag] {
+					missingTags = append(missingTags, tag)
+				}
+			}
+			if len(missingTags) > 0 {
+				missing = append(missing, DeltaImage{
+					Image:  imageName,
+					Digest: digest,
+					Tags:   sortTags(missingTags),
+				})
+			}
+		}
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		if missing[i].Image != missing[j].Image {
+			return missing[i].Image < missing[j].Image
+		}
+		return missing[i].Digest < missing[j].Digest
+	})
+
+	return missing
+}
+
+// sortTags returns a sorted copy of tags, or nil if there are none.
+func sortTags(tags TagSlice) TagSlice {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	sorted := append(TagSlice{}, tags...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestRegistryDelta(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      reg.RegInvImage
+		dst      reg.RegInvImage
+		expected reg.RegistryDelta
+	}{
+		{
+			name: "promotion complete",
+			src: reg.RegInvImage{
+				"foo": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+			},
+			dst: reg.RegInvImage{
+				"foo": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+			},
+			expected: reg.RegistryDelta{
+				Source:      "gcr.io/foo-staging",
+				Destination: "us.gcr.io/foo",
+				Backlog:     []reg.DeltaImage{},
+				Drift:       []reg.DeltaImage{},
+			},
+		},
+		{
+			name: "empty destination",
+			src: reg.RegInvImage{
+				"foo": reg.DigestTags{
+					"sha256:000": reg.TagSlice{"latest", "1.0"},
+					"sha256:111": reg.TagSlice{},
+				},
+			},
+			expected: reg.RegistryDelta{
+				Source:      "gcr.io/foo-staging",
+				Destination: "us.gcr.io/foo",
+				Backlog: []reg.DeltaImage{
+					{Image: "foo", Digest: "sha256:000", Tags: reg.TagSlice{"1.0", "latest"}},
+					{Image: "foo", Digest: "sha256:111"},
+				},
+				Drift: []reg.DeltaImage{},
+			},
+		},
+		{
+			name: "backlog and drift",
+			src: reg.RegInvImage{
+				"foo": reg.DigestTags{
+					"sha256:000": reg.TagSlice{"1.0", "latest"},
+					"sha256:111": reg.TagSlice{"1.1"},
+				},
+				"bar": reg.DigestTags{
+					"sha256:222": reg.TagSlice{"2.0"},
+				},
+			},
+			dst: reg.RegInvImage{
+				"foo": reg.DigestTags{
+					// Missing the "latest" tag.
+					"sha256:000": reg.TagSlice{"1.0"},
+					"sha256:333": reg.TagSlice{"0.9"},
+				},
+				"baz": reg.DigestTags{
+					"sha256:444": reg.TagSlice{},
+				},
+			},
+			expected: reg.RegistryDelta{
+				Source:      "gcr.io/foo-staging",
+				Destination: "us.gcr.io/foo",
+				Backlog: []reg.DeltaImage{
+					{Image: "bar", Digest: "sha256:222", Tags: reg.TagSlice{"2.0"}},
+					{Image: "foo", Digest: "sha256:000", Tags: reg.TagSlice{"latest"}},
+					{Image: "foo", Digest: "sha256:111", Tags: reg.TagSlice{"1.1"}},
+				},
+				Drift: []reg.DeltaImage{
+					{Image: "baz", Digest: "sha256:444"},
+					{Image: "foo", Digest: "sha256:333", Tags: reg.TagSlice{"0.9"}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{
+			Inv: reg.MasterInventory{
+				"gcr.io/foo-staging": test.src,
+				"us.gcr.io/foo":      test.dst,
+			},
+		}
+
+		got := sc.RegistryDelta("gcr.io/foo-staging", "us.gcr.io/foo")
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DestCheckInventory reads the full inventory of every destination
+	// repository to decide which edges still have to be promoted.
+	DestCheckInventory = "inventory"
+
+	// DestCheckPerEdge checks the existence of every destination vertex with
+	// a HEAD request instead of reading the destination repositories.
+	DestCheckPerEdge = "per-edge"
+)
+
+// DestCheckModes are the supported values of SyncContext.DestCheckMode.
+var DestCheckModes = []string{DestCheckInventory, DestCheckPerEdge}
+
+// destVertex is what a HEAD request found about the destination of an edge.
+type destVertex struct {
+	// tagDigest is the digest the destination tag points to, if it exists.
+	tagDigest Digest
+	// digestExists is true if the digest of the edge exists.
+	digestExists bool
+}
+
+// ReadDestinationsPerEdge records the destination vertices of the edges in
+// sc.Inv, using up to two HEAD requests per edge (the tag and the digest)
+// instead of listing the destination repositories. The resulting inventory
+// only holds what the edges need for GetPromotionCandidates, so it is much
+// cheaper to build for sparse promotions into huge registries. All failed
+// requests are reported together.
+func (sc *SyncContext) ReadDestinationsPerEdge(
+	edges map[PromotionEdge]interface{},
+) error {
+	edgeList := make([]PromotionEdge, 0, len(edges))
+	for edge := range edges {
+		edgeList = append(edgeList, edge)
+	}
+
+	vertices := make([]destVertex, len(edgeList))
+	errs := make([]error, len(edgeList))
+	sc.forEachConcurrently(len(edgeList), func(i int) {
+		vertices[i], errs[i] = sc.headDestination(edgeList[i])
+	})
+
+	failed := make([]string, 0)
+	for i, edge := range edgeList {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", sc.displayEdge(edge), errs[i]))
+			continue
+		}
+
+		if vertices[i].tagDigest != "" {
+			sc.recordDestination(edge, vertices[i].tagDigest, edge.DstImageTag.Tag)
+		}
+		if vertices[i].digestExists {
+			sc.recordDestination(edge, sc.transformedDigest(edge.Digest), "")
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf(
+			"checking %d destinations: %s",
+			len(failed),
+			strings.Join(failed, ", "),
+		)
+	}
+
+	logrus.Infof("Checked the destinations of %d edges", len(edgeList))
+	return nil
+}
+
+// headDestination looks up the destination tag and digest of the edge. The
+// digest is the one the image was transformed to, if any.
+func (sc *SyncContext) headDestination(edge PromotionEdge) (destVertex, error) {
+	var v destVertex
+	digest := sc.transformedDigest(edge.Digest)
+
+	if edge.DstImageTag.Tag != "" {
+		desc, err := crane.Head(
+			ToPQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName, edge.DstImageTag.Tag),
+			sc.copyOptions()...,
+		)
+		if err != nil && !isNotFound(err) {
+			return v, err
+		}
+		if err == nil {
+			v.tagDigest = Digest(desc.Digest.String())
+		}
+
+		// The tag already points to the digest, so the digest exists.
+		if v.tagDigest == digest {
+			v.digestExists = true
+			return v, nil
+		}
+	}
+
+	_, err := crane.Head(
+		ToFQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName, digest),
+		sc.copyOptions()...,
+	)
+	if err != nil && !isNotFound(err) {
+		return v, err
+	}
+	v.digestExists = err == nil
+
+	return v, nil
+}
+
+// recordDestination adds the digest (and tag, if not empty) to the inventory
+// of the destination repository of the edge.
+func (sc *SyncContext) recordDestination(edge PromotionEdge, digest Digest, tag Tag) {
+	if sc.Inv == nil {
+		sc.Inv = make(MasterInventory)
+	}
+
+	rii, ok := sc.Inv[edge.DstRegistry.Name]
+	if !ok {
+		rii = make(RegInvImage)
+		sc.Inv[edge.DstRegistry.Name] = rii
+	}
+
+	digestTags, ok := rii[edge.DstImageTag.ImageName]
+	if !ok {
+		digestTags = make(DigestTags)
+		rii[edge.DstImageTag.ImageName] = digestTags
+	}
+
+	tags, ok := digestTags[digest]
+	if !ok {
+		tags = TagSlice{}
+	}
+	if tag != "" {
+		for _, t := range tags {
+			if t == tag {
+				return
+			}
+		}
+		tags = append(tags, tag)
+	}
+	digestTags[digest] = tags
+}
+
+// getSourceRegistriesToRead is like getRegistriesToRead, but only collects the
+// source repositories of the edges.
+func getSourceRegistriesToRead(edges map[PromotionEdge]interface{}) []RegistryContext {
+	rcs := make(map[RegistryContext]interface{})
+	for edge := range edges {
+		srcReg := edge.SrcRegistry
+		srcReg.Name = srcReg.Name +
+			"/" +
+			RegistryName(edge.SrcImageTag.ImageName)
+
+		rcs[srcReg] = nil
+	}
+
+	rcsFinal := []RegistryContext{}
+	for rc := range rcs {
+		rcsFinal = append(rcsFinal, rc)
+	}
+
+	return rcsFinal
+}
+
+// isNotFound returns true if err is a registry response for a missing
+// manifest.
+func isNotFound(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound
+}
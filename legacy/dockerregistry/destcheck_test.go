@@ -0,0 +1,97 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestReadDestinationsPerEdge(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	dstRegName := reg.RegistryName(
+		strings.TrimPrefix(server.URL, "http://") + "/prod",
+	)
+
+	pushRandom := func(ref string) reg.Digest {
+		img, err := random.Image(256, 1)
+		require.Nil(t, err)
+		require.Nil(t, crane.Push(img, ref))
+
+		hash, err := img.Digest()
+		require.Nil(t, err)
+		return reg.Digest(hash.String())
+	}
+
+	promoted := pushRandom(string(dstRegName) + "/foo:1.0")
+	moved := pushRandom(string(dstRegName) + "/foo:2.0")
+	untagged := pushRandom(string(dstRegName) + "/foo:tmp")
+	missing := reg.Digest("sha256:" + strings.Repeat("0", 64))
+
+	mkEdge := func(digest reg.Digest, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/staging"},
+			SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: dstRegName},
+			DstImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge(promoted, "1.0"): nil,
+		mkEdge(missing, "2.0"):  nil,
+		mkEdge(untagged, ""):    nil,
+		mkEdge(missing, "3.0"):  nil,
+	}
+
+	sc := reg.SyncContext{}
+	require.Nil(t, sc.ReadDestinationsPerEdge(edges))
+
+	require.Equal(
+		t,
+		reg.DigestTags{
+			promoted: {"1.0"},
+			moved:    {"2.0"},
+			untagged: {},
+		},
+		sc.Inv[dstRegName]["foo"],
+	)
+
+	// An unreachable destination fails the check.
+	edges = map[reg.PromotionEdge]interface{}{
+		{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/staging"},
+			SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: "1.0"},
+			Digest:      promoted,
+			DstRegistry: reg.RegistryContext{Name: "localhost:1/prod"},
+			DstImageTag: reg.ImageTag{ImageName: "foo", Tag: "1.0"},
+		}: nil,
+	}
+	sc = reg.SyncContext{}
+	require.Error(t, sc.ReadDestinationsPerEdge(edges))
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ValidateDestinationPatterns checks that every pattern is a valid glob, as
+// understood by path.Match.
+func ValidateDestinationPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid destination pattern %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckAllowedDestinations checks that every destination registry of the
+// manifests matches at least one of the glob patterns (see path.Match; note
+// that '*' does not match '/'). All disallowed destinations are reported
+// together.
+func CheckAllowedDestinations(mfests []Manifest, patterns []string) error {
+	disallowed := make(map[RegistryName]interface{})
+	for _, mfest := range mfests {
+		for _, rc := range mfest.Registries {
+			if rc.Src {
+				continue
+			}
+
+			if !destinationAllowed(rc.Name, patterns) {
+				disallowed[rc.Name] = nil
+			}
+		}
+	}
+
+	if len(disallowed) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(disallowed))
+	for name := range disallowed {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf(
+		"destination registries not in the allowlist: %s",
+		strings.Join(names, ", "),
+	)
+}
+
+func destinationAllowed(name RegistryName, patterns []string) bool {
+	for _, pattern := range patterns {
+		// Invalid patterns are rejected by ValidateDestinationPatterns.
+		if ok, _ := path.Match(pattern, string(name)); ok {
+			return true
+		}
+	}
+
+	return false
+}
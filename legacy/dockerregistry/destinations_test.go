@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestCheckAllowedDestinations(t *testing.T) {
+	mfests := []reg.Manifest{
+		{
+			Registries: []reg.RegistryContext{
+				{Name: "gcr.io/foo-staging", Src: true},
+				{Name: "us.gcr.io/k8s-artifacts-prod"},
+				{Name: "eu.gcr.io/k8s-artifacts-prod"},
+			},
+		},
+		{
+			Registries: []reg.RegistryContext{
+				{Name: "gcr.io/bar-staging", Src: true},
+				{Name: "us.gcr.io/k8s-artifacts-prod/bar"},
+				{Name: "gcr.io/somewhere-else"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		patterns  []string
+		expectErr string
+	}{
+		{
+			"All destinations allowed",
+			[]string{
+				"*.gcr.io/k8s-artifacts-prod",
+				"*.gcr.io/k8s-artifacts-prod/*",
+				"gcr.io/somewhere-else",
+			},
+			"",
+		},
+		{
+			"Every disallowed destination is reported",
+			[]string{"us.gcr.io/k8s-artifacts-prod"},
+			"destination registries not in the allowlist: " +
+				"eu.gcr.io/k8s-artifacts-prod, " +
+				"gcr.io/somewhere-else, " +
+				"us.gcr.io/k8s-artifacts-prod/bar",
+		},
+		{
+			"Source registries are not checked",
+			[]string{"*.gcr.io/*", "*.gcr.io/*/*", "gcr.io/somewhere-else"},
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		err := reg.CheckAllowedDestinations(mfests, test.patterns)
+		if test.expectErr == "" {
+			require.Nil(t, err, test.name)
+			continue
+		}
+
+		require.NotNil(t, err, test.name)
+		require.Equal(t, test.expectErr, err.Error(), test.name)
+	}
+}
+
+func TestValidateDestinationPatterns(t *testing.T) {
+	require.Nil(t, reg.ValidateDestinationPatterns([]string{"*.gcr.io/foo"}))
+	require.NotNil(t, reg.ValidateDestinationPatterns([]string{"gcr.io/[foo"}))
+}
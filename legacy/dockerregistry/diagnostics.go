@@ -0,0 +1,299 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
+)
+
+// The codes of diagnostics. They are stable, so that tools rendering the
+// diagnostics can link them to documentation.
+const (
+	// DiagnosticInvalidOption is an option or combination of options which
+	// is not allowed.
+	DiagnosticInvalidOption = "invalid-option"
+	// DiagnosticInvalidDirectory is a thin manifest directory which does not
+	// have the expected structure.
+	DiagnosticInvalidDirectory = "invalid-directory-structure"
+	// DiagnosticInvalidManifest is a manifest which cannot be used for any
+	// other reason.
+	DiagnosticInvalidManifest = "invalid-manifest"
+	// DiagnosticUnreadableFile is a manifest or images file which cannot be
+	// read.
+	DiagnosticUnreadableFile = "unreadable-file"
+	// DiagnosticYAMLSyntax is a file which is not valid YAML.
+	DiagnosticYAMLSyntax = "yaml-syntax"
+	// DiagnosticYAMLSchema is a YAML field which is unknown or has the wrong
+	// type.
+	DiagnosticYAMLSchema = "yaml-schema"
+	// DiagnosticInvalidComponent is a registry or image entry which is
+	// missing a required field or has an invalid one.
+	DiagnosticInvalidComponent = "invalid-component"
+	// DiagnosticMissingSourceRegistry is a manifest without a source
+	// registry.
+	DiagnosticMissingSourceRegistry = "missing-source-registry"
+	// DiagnosticInvalidDigest is a digest which is not a sha256 digest.
+	DiagnosticInvalidDigest = "invalid-digest"
+	// DiagnosticInvalidTag is a tag which is not a valid image tag.
+	DiagnosticInvalidTag = "invalid-tag"
+	// DiagnosticInvalidEnvironment is an environment name which is not
+	// valid.
+	DiagnosticInvalidEnvironment = "invalid-environment"
+)
+
+// Diagnostic is a machine-readable validation problem, meant to be rendered
+// inline by tools such as review bots. The line is 0 if it is unknown.
+type Diagnostic struct {
+	Severity LintSeverity `json:"severity"`
+	Code     string       `json:"code"`
+	Message  string       `json:"message"`
+	File     string       `json:"file,omitempty"`
+	Line     int          `json:"line,omitempty"`
+}
+
+// yamlErrorLine matches the errors of the YAML parser which carry a line
+// number.
+var yamlErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// DiagnoseError turns an error into a single diagnostic.
+func DiagnoseError(code, file string, err error) Diagnostic {
+	return Diagnostic{
+		Severity: LintError,
+		Code:     code,
+		Message:  err.Error(),
+		File:     file,
+	}
+}
+
+// DiagnoseLintFindings turns the findings of LintManifests into diagnostics,
+// using their category as code.
+func DiagnoseLintFindings(findings []LintFinding) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0, len(findings))
+	for _, finding := range findings {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: finding.Severity,
+			Code:     finding.Category,
+			Message:  finding.Message,
+			File:     finding.Manifest,
+		})
+	}
+
+	return diagnostics
+}
+
+// DiagnoseManifestFile returns every problem which makes
+// ParseManifestFromFile reject the manifest file, instead of only the first
+// one.
+func DiagnoseManifestFile(filePath string) []Diagnostic {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return []Diagnostic{DiagnoseError(DiagnosticUnreadableFile, filePath, err)}
+	}
+
+	var mfest Manifest
+	if err := yaml.UnmarshalStrict(b, &mfest); err != nil {
+		return diagnoseYAML(filePath, err)
+	}
+
+	diagnostics := make([]Diagnostic, 0)
+	if err := validateRequiredComponents(mfest); err != nil {
+		for _, message := range strings.Split(err.Error(), "\n") {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: LintError,
+				Code:     DiagnosticInvalidComponent,
+				Message:  message,
+				File:     filePath,
+			})
+		}
+	}
+
+	return append(diagnostics, diagnoseImages(filePath, b, mfest.Images)...)
+}
+
+// DiagnoseThinManifests returns every problem which makes
+// ParseThinManifestsFromDir reject the thin manifest directory, instead of
+// only the first one.
+func DiagnoseThinManifests(dir string) []Diagnostic {
+	paths, err := findThinManifests(dir)
+	if err != nil {
+		return []Diagnostic{DiagnoseError(DiagnosticInvalidDirectory, dir, err)}
+	}
+
+	diagnostics := make([]Diagnostic, 0)
+	for _, path := range paths {
+		diagnostics = append(diagnostics, diagnoseThinManifestFile(path)...)
+	}
+
+	return diagnostics
+}
+
+func diagnoseThinManifestFile(filePath string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		diagnostics = append(
+			diagnostics,
+			DiagnoseError(DiagnosticUnreadableFile, filePath, err),
+		)
+	} else {
+		var thinManifest ThinManifest
+		if err := yaml.UnmarshalStrict(b, &thinManifest); err != nil {
+			diagnostics = append(diagnostics, diagnoseYAML(filePath, err)...)
+		} else if _, err := GetSrcRegistry(thinManifest.Registries); err != nil {
+			diagnostics = append(
+				diagnostics,
+				DiagnoseError(DiagnosticMissingSourceRegistry, filePath, err),
+			)
+		}
+	}
+
+	imagesPath := thinImagesPath(filePath)
+	b, err = ioutil.ReadFile(imagesPath)
+	if err != nil {
+		return append(
+			diagnostics,
+			DiagnoseError(DiagnosticUnreadableFile, imagesPath, err),
+		)
+	}
+
+	var images Images
+	if err := yaml.UnmarshalStrict(b, &images); err != nil {
+		diagnostics = append(diagnostics, diagnoseYAML(imagesPath, err)...)
+	}
+
+	return diagnostics
+}
+
+// diagnoseYAML turns an error of the YAML parser into diagnostics, one for
+// each problem it found.
+func diagnoseYAML(filePath string, err error) []Diagnostic {
+	code := DiagnosticYAMLSyntax
+	messages := []string{err.Error()}
+
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		code = DiagnosticYAMLSchema
+		messages = typeErr.Errors
+	}
+
+	diagnostics := make([]Diagnostic, 0, len(messages))
+	for _, message := range messages {
+		diagnostic := Diagnostic{
+			Severity: LintError,
+			Code:     code,
+			Message:  message,
+			File:     filePath,
+		}
+
+		if match := yamlErrorLine.FindStringSubmatch(message); match != nil {
+			diagnostic.Line, _ = strconv.Atoi(match[1])
+			diagnostic.Message = match[2]
+		}
+
+		diagnostics = append(diagnostics, diagnostic)
+	}
+
+	return diagnostics
+}
+
+// diagnoseImages is like validateImages, but reports every invalid digest,
+// tag and environment. Digests and their tags are located by the line of the
+// digest in the file.
+func diagnoseImages(filePath string, b []byte, images []Image) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	add := func(code string, line int, err error) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: LintError,
+			Code:     code,
+			Message:  err.Error(),
+			File:     filePath,
+			Line:     line,
+		})
+	}
+
+	for _, image := range images {
+		for _, environment := range image.Environments {
+			if err := ValidateEnvironment(environment); err != nil {
+				add(DiagnosticInvalidEnvironment, 0, err)
+			}
+		}
+
+		// The order of the digests in the file is lost in the map.
+		digests := make([]Digest, 0, len(image.Dmap))
+		for digest := range image.Dmap {
+			digests = append(digests, digest)
+		}
+		sort.Slice(digests, func(i, j int) bool {
+			return digests[i] < digests[j]
+		})
+
+		for _, digest := range digests {
+			line := lineOf(b, string(digest))
+			if err := ValidateDigest(digest); err != nil {
+				add(DiagnosticInvalidDigest, line, err)
+			}
+
+			for _, tag := range image.Dmap[digest] {
+				if err := ValidateTag(tag); err != nil {
+					add(DiagnosticInvalidTag, line, err)
+				}
+			}
+		}
+	}
+
+	return diagnostics
+}
+
+// lineOf returns the number of the first line of b which contains s, or 0.
+func lineOf(b []byte, s string) int {
+	if s == "" {
+		return 0
+	}
+
+	i := bytes.Index(b, []byte(s))
+	if i < 0 {
+		return 0
+	}
+
+	return bytes.Count(b[:i], []byte("\n")) + 1
+}
+
+// WriteDiagnostics writes the diagnostics as a JSON array to a filepath.
+func WriteDiagnostics(filePath string, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = make([]Diagnostic, 0)
+	}
+
+	b, err := json.MarshalIndent(diagnostics, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return upload.Write(filePath, append(b, '\n'))
+}
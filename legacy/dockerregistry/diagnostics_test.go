@@ -0,0 +1,222 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestDiagnoseManifestFile(t *testing.T) {
+	digest := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		manifest string
+		expected []reg.Diagnostic
+	}{
+		{
+			name: "valid",
+			manifest: `registries:
+- name: gcr.io/src
+  src: true
+- name: gcr.io/dst
+images:
+- name: foo
+  dmap:
+    "` + digest + `": ["1.0"]
+`,
+			expected: []reg.Diagnostic{},
+		},
+		{
+			name: "syntax-error",
+			manifest: `registries:
+- name: gcr.io/src
+  src: true
+ images: []
+`,
+			expected: []reg.Diagnostic{
+				{
+					Severity: reg.LintError,
+					Code:     reg.DiagnosticYAMLSyntax,
+					Message:  "did not find expected key",
+					Line:     3,
+				},
+			},
+		},
+		{
+			name: "unknown-fields",
+			manifest: `registries:
+- name: gcr.io/src
+  src: true
+  sourc: true
+images:
+- name: foo
+  dmp: {}
+`,
+			expected: []reg.Diagnostic{
+				{
+					Severity: reg.LintError,
+					Code:     reg.DiagnosticYAMLSchema,
+					Message:  "field sourc not found in type inventory.RegistryContext",
+					Line:     4,
+				},
+				{
+					Severity: reg.LintError,
+					Code:     reg.DiagnosticYAMLSchema,
+					Message:  "field dmp not found in type inventory.Image",
+					Line:     7,
+				},
+			},
+		},
+		{
+			name: "invalid-fields",
+			manifest: `registries:
+- name: gcr.io/dst
+images:
+- name: foo
+  dmap:
+    "` + digest + `": ["1.0", "-bad"]
+    "sha256:abc": ["2.0"]
+`,
+			expected: []reg.Diagnostic{
+				{
+					Severity: reg.LintError,
+					Code:     reg.DiagnosticInvalidComponent,
+					Message:  "source registry must be set",
+				},
+				{
+					Severity: reg.LintError,
+					Code:     reg.DiagnosticInvalidTag,
+					Message:  "invalid tag: -bad",
+					Line:     6,
+				},
+				{
+					Severity: reg.LintError,
+					Code:     reg.DiagnosticInvalidDigest,
+					Message:  "invalid digest: sha256:abc",
+					Line:     7,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, test.name+".yaml")
+		require.Nil(t, ioutil.WriteFile(path, []byte(test.manifest), 0o644))
+
+		for i := range test.expected {
+			test.expected[i].File = path
+		}
+
+		require.Equal(t, test.expected, reg.DiagnoseManifestFile(path), test.name)
+	}
+
+	missing := filepath.Join(dir, "missing.yaml")
+	got := reg.DiagnoseManifestFile(missing)
+	require.Len(t, got, 1)
+	require.Equal(t, reg.DiagnosticUnreadableFile, got[0].Code)
+	require.Equal(t, missing, got[0].File)
+}
+
+func TestDiagnoseThinManifests(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) string {
+		path = filepath.Join(dir, path)
+		require.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.Nil(t, ioutil.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	write("manifests/a/promoter-manifest.yaml", "registries:\n- name: gcr.io/src\n  src: true\n")
+	write("images/a/images.yaml", "- name: foo\n  dmap: {}\n")
+	b := write("manifests/b/promoter-manifest.yaml", "registries:\n- name: gcr.io/dst\n")
+	bImages := write("images/b/images.yaml", "- name: foo\n  tags: []\n")
+
+	require.Equal(t, []reg.Diagnostic{
+		{
+			Severity: reg.LintError,
+			Code:     reg.DiagnosticMissingSourceRegistry,
+			Message:  "could not find source registry",
+			File:     b,
+		},
+		{
+			Severity: reg.LintError,
+			Code:     reg.DiagnosticYAMLSchema,
+			Message:  "field tags not found in type inventory.Image",
+			File:     bImages,
+			Line:     2,
+		},
+	}, reg.DiagnoseThinManifests(dir))
+
+	got := reg.DiagnoseThinManifests(filepath.Join(dir, "missing"))
+	require.Len(t, got, 1)
+	require.Equal(t, reg.DiagnosticInvalidDirectory, got[0].Code)
+}
+
+func TestWriteDiagnostics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "diagnostics.json")
+
+	require.Nil(t, reg.WriteDiagnostics(path, nil))
+	b, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	require.Equal(t, "[]\n", string(b))
+
+	diagnostics := []reg.Diagnostic{
+		{
+			Severity: reg.LintError,
+			Code:     reg.DiagnosticInvalidTag,
+			Message:  "invalid tag: -bad",
+			File:     "promoter-manifest.yaml",
+			Line:     6,
+		},
+		{
+			Severity: reg.LintWarning,
+			Code:     "floating-tag",
+			Message:  "image foo is tagged \"latest\"",
+		},
+	}
+	require.Nil(t, reg.WriteDiagnostics(path, diagnostics))
+
+	b, err = ioutil.ReadFile(path)
+	require.Nil(t, err)
+
+	var got []map[string]interface{}
+	require.Nil(t, json.Unmarshal(b, &got))
+	require.Equal(t, []map[string]interface{}{
+		{
+			"severity": "error",
+			"code":     "invalid-tag",
+			"message":  "invalid tag: -bad",
+			"file":     "promoter-manifest.yaml",
+			"line":     float64(6),
+		},
+		{
+			"severity": "warning",
+			"code":     "floating-tag",
+			"message":  "image foo is tagged \"latest\"",
+		},
+	}, got)
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// PromotedDigests maps the destination image and tag (as a PQIN) of every
+// successful promotion to the digest reference (as a FQIN) found at the
+// destination, which is safe to pin deployments against. Every destination
+// is resolved again, so the digests are the ones actually present, even if
+// the image was rewritten while being promoted. Tagless promotions have no
+// image and tag to map from, and are left out. A tag which no longer points to
+// the promoted (or transformed) digest is an error.
+func (sc *SyncContext) PromotedDigests() (map[string]string, error) {
+	digests := make(map[string]string)
+	unresolved := make([]string, 0)
+	mismatched := make([]string, 0)
+
+	for _, result := range sc.PromotionResults {
+		req := result.Request
+		if result.Skipped || len(result.Errors) > 0 ||
+			req.TagOp == Delete || req.Tag == "" {
+			continue
+		}
+
+		pqin := ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag)
+
+		actual, err := crane.Digest(pqin, sc.copyOptions()...)
+		if err != nil {
+			unresolved = append(unresolved, fmt.Sprintf("%s (%v)", pqin, err))
+			continue
+		}
+
+		expected := req.Digest
+		if transformed, ok := sc.TransformedDigest[req.Digest]; ok {
+			expected = transformed
+		}
+		if Digest(actual) != expected {
+			mismatched = append(mismatched, fmt.Sprintf(
+				"%s points to %s instead of the promoted %s",
+				pqin,
+				actual,
+				expected,
+			))
+			continue
+		}
+
+		digests[pqin] = ToFQIN(req.RegistryDest, req.ImageNameDest, Digest(actual))
+	}
+
+	if len(unresolved) > 0 {
+		sort.Strings(unresolved)
+		return nil, fmt.Errorf(
+			"unable to resolve %d promoted images: %s",
+			len(unresolved),
+			strings.Join(unresolved, ", "),
+		)
+	}
+
+	// A tag moved by someone else must not be pinned in place of the
+	// promoted digest.
+	if len(mismatched) > 0 {
+		sort.Strings(mismatched)
+		return nil, fmt.Errorf(
+			"%d promoted tags no longer point to the promoted digest: %s",
+			len(mismatched),
+			strings.Join(mismatched, ", "),
+		)
+	}
+
+	return digests, nil
+}
+
+// PromotedImage is a digest promoted to a destination image, along with the
+// tags it was promoted with.
+type PromotedImage struct {
+	// Source is the promoted source image (as an FQIN).
+	Source string `json:"source"`
+	// Destination is the destination image, without tag or digest.
+	Destination string `json:"destination"`
+	// Digest is the digest written to the destination, which differs from
+	// the source digest if the image was rewritten while being promoted.
+	Digest Digest `json:"digest"`
+	Tags   []Tag  `json:"tags"`
+}
+
+// PromotedImages lists the images promoted successfully, in order. The
+// promotions of a digest to the same destination image with different tags
+// are merged.
+func (sc *SyncContext) PromotedImages() []PromotedImage {
+	byDestination := make(map[string]*PromotedImage)
+
+	for _, result := range sc.PromotionResults {
+		req := result.Request
+		if result.Skipped || len(result.Errors) > 0 || req.TagOp != Add {
+			continue
+		}
+
+		digest := sc.promotedDigest(req)
+		dst := ToFQIN(req.RegistryDest, req.ImageNameDest, digest)
+
+		image, ok := byDestination[dst]
+		if !ok {
+			image = &PromotedImage{
+				Source:      ToFQIN(req.RegistrySrc, req.ImageNameSrc, req.Digest),
+				Destination: string(req.RegistryDest) + "/" + string(req.ImageNameDest),
+				Digest:      digest,
+				Tags:        make([]Tag, 0),
+			}
+			byDestination[dst] = image
+		}
+
+		if req.Tag != "" {
+			image.Tags = append(image.Tags, req.Tag)
+		}
+	}
+
+	images := make([]PromotedImage, 0, len(byDestination))
+	for _, image := range byDestination {
+		sort.Slice(image.Tags, func(i, j int) bool {
+			return image.Tags[i] < image.Tags[j]
+		})
+		images = append(images, *image)
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Destination != images[j].Destination {
+			return images[i].Destination < images[j].Destination
+		}
+		return images[i].Digest < images[j].Digest
+	})
+
+	return images
+}
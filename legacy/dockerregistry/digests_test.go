@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestPromotedDigests(t *testing.T) {
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	dstName := reg.RegistryName(strings.TrimPrefix(dst.URL, "http://"))
+
+	img, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	digest, err := img.Digest()
+	require.Nil(t, err)
+
+	ref, err := name.ParseReference(string(dstName) + "/foo:1.0")
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(ref, img))
+
+	mkResult := func(tag reg.Tag, tagOp reg.TagOp) reg.PromotionResult {
+		return reg.PromotionResult{
+			Request: reg.PromotionRequest{
+				TagOp:         tagOp,
+				RegistrySrc:   "gcr.io/src",
+				RegistryDest:  dstName,
+				ImageNameSrc:  "foo",
+				ImageNameDest: "foo",
+				Digest:        reg.Digest(digest.String()),
+				Tag:           tag,
+			},
+		}
+	}
+
+	failed := mkResult("2.0", reg.Add)
+	failed.Errors = reg.Errors{{Context: "copy", Error: nil}}
+
+	skipped := mkResult("3.0", reg.Add)
+	skipped.Skipped = true
+
+	mismatched := mkResult("1.0", reg.Add)
+	mismatched.Request.Digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	tests := []struct {
+		name      string
+		results   []reg.PromotionResult
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			"Only successful tagged promotions",
+			[]reg.PromotionResult{
+				mkResult("1.0", reg.Add),
+				mkResult("", reg.Add),
+				mkResult("1.0", reg.Delete),
+				failed,
+				skipped,
+			},
+			map[string]string{
+				string(dstName) + "/foo:1.0": string(dstName) + "/foo@" + digest.String(),
+			},
+			false,
+		},
+		{
+			"Promoted tag points to another digest",
+			[]reg.PromotionResult{
+				mismatched,
+			},
+			nil,
+			true,
+		},
+		{
+			"Promoted tag missing at the destination",
+			[]reg.PromotionResult{
+				mkResult("1.0", reg.Add),
+				mkResult("4.0", reg.Add),
+			},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{PromotionResults: test.results}
+
+		got, err := sc.PromotedDigests()
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestPromotedImages(t *testing.T) {
+	mkResult := func(
+		image reg.ImageName,
+		digest reg.Digest,
+		tag reg.Tag,
+	) reg.PromotionResult {
+		return reg.PromotionResult{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/staging",
+				RegistryDest:  "gcr.io/prod",
+				ImageNameSrc:  image,
+				ImageNameDest: image,
+				Digest:        digest,
+				Tag:           tag,
+			},
+		}
+	}
+
+	failed := mkResult("bar", "sha256:222", "2.0")
+	failed.Errors = reg.Errors{{Context: "copy", Error: nil}}
+	skipped := mkResult("bar", "sha256:333", "3.0")
+	skipped.Skipped = true
+
+	sc := reg.SyncContext{
+		PromotionResults: []reg.PromotionResult{
+			mkResult("foo", "sha256:111", "latest"),
+			mkResult("foo", "sha256:111", "1.0"),
+			mkResult("bar", "sha256:111", ""),
+			failed,
+			skipped,
+		},
+		TransformedDigest: reg.TransformedDigest{"sha256:111": "sha256:999"},
+	}
+
+	require.Equal(t, []reg.PromotedImage{
+		{
+			Source:      "gcr.io/staging/bar@sha256:111",
+			Destination: "gcr.io/prod/bar",
+			Digest:      "sha256:999",
+			Tags:        []reg.Tag{},
+		},
+		{
+			Source:      "gcr.io/staging/foo@sha256:111",
+			Destination: "gcr.io/prod/foo",
+			Digest:      "sha256:999",
+			Tags:        []reg.Tag{"1.0", "latest"},
+		},
+	}, sc.PromotedImages())
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// shortDigest abbreviates a digest to its algorithm and first 12 characters,
+// like 'docker images' does.
+func shortDigest(digest string) string {
+	const shortLength = 12
+
+	i := strings.Index(digest, ":")
+	if i < 0 || len(digest)-i-1 <= shortLength {
+		return digest
+	}
+
+	return digest[:i+1+shortLength]
+}
+
+// displayDigest returns the digest as shown in human-readable output.
+func (sc *SyncContext) displayDigest(digest Digest) string {
+	if sc.ShortDigests {
+		return shortDigest(string(digest))
+	}
+
+	return string(digest)
+}
+
+// displayEdge describes the edge in human-readable output.
+func (sc *SyncContext) displayEdge(edge PromotionEdge) string {
+	edge.Digest = Digest(sc.displayDigest(edge.Digest))
+	return fmt.Sprintf("%v", edge)
+}
+
+// displayRequest describes the request in human-readable output, like
+// PromotionRequest.PrettyValue.
+func (sc *SyncContext) displayRequest(req PromotionRequest) string {
+	req.Digest = Digest(sc.displayDigest(req.Digest))
+	if req.DigestOld != "" {
+		req.DigestOld = Digest(sc.displayDigest(req.DigestOld))
+	}
+
+	return req.PrettyValue()
+}
+
+// displayDestination returns the destination of the request in
+// human-readable output: a PQIN, or an FQIN for tagless requests.
+func (sc *SyncContext) displayDestination(req PromotionRequest) string {
+	if len(req.Tag) > 0 {
+		return ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag)
+	}
+
+	return ToFQIN(req.RegistryDest, req.ImageNameDest, Digest(sc.displayDigest(req.Digest)))
+}
+
+// out returns the writer receiving the human-readable reports.
+func (sc *SyncContext) out() io.Writer {
+	if sc.Out != nil {
+		return sc.Out
+	}
+
+	return os.Stdout
+}
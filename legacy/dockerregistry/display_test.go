@@ -0,0 +1,53 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestPrintCapturedRequestsOut(t *testing.T) {
+	var out bytes.Buffer
+	sc := reg.SyncContext{Out: &out}
+
+	sc.PrintCapturedRequests(&reg.CapturedRequests{})
+	require.Equal(t, "No requests captured.\n", out.String())
+
+	out.Reset()
+	sc.PrintCapturedRequests(&reg.CapturedRequests{
+		reg.PromotionRequest{
+			TagOp:         reg.Add,
+			RegistrySrc:   "gcr.io/foo",
+			RegistryDest:  "gcr.io/bar",
+			ImageNameSrc:  "a",
+			ImageNameDest: "a",
+			Digest:        "sha256:000",
+			Tag:           "1.0",
+		}: 1,
+	})
+	require.Equal(
+		t,
+		"\ncaptured reqs summary:\n\n"+
+			"captured req: gcr.io/foo/a -> gcr.io/bar/a: Tag: '1.0' <ADD> sha256:000\n\n",
+		out.String(),
+	)
+}
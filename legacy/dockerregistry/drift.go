@@ -0,0 +1,85 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import "sort"
+
+// DriftReport lists the tags which exist in more than one of a set of
+// registries, which should be mirrors of each other, but point to different
+// digests in them.
+type DriftReport struct {
+	Registries []RegistryName `json:"registries" yaml:"registries"`
+	Drifts     []DigestDrift  `json:"drifts" yaml:"drifts"`
+}
+
+// DigestDrift is a tag of an image whose digest differs between registries.
+// Digests has the digest of the tag in every registry which has the tag.
+type DigestDrift struct {
+	Image   ImageName               `json:"image" yaml:"image"`
+	Tag     Tag                     `json:"tag" yaml:"tag"`
+	Digests map[RegistryName]Digest `json:"digests" yaml:"digests"`
+}
+
+// FindDigestDrift compares the registries regNames, as read into sc.Inv, and
+// reports every tag which resolves to different digests in them. A tag which
+// is missing from some of the registries is not drift, as long as all the
+// registries which have it agree on its digest.
+func (sc *SyncContext) FindDigestDrift(regNames []RegistryName) DriftReport {
+	report := DriftReport{
+		Registries: regNames,
+		Drifts:     make([]DigestDrift, 0),
+	}
+
+	digests := make(map[ImageTag]map[RegistryName]Digest)
+	for _, regName := range regNames {
+		for imageName, digestTags := range sc.Inv[regName] {
+			for digest, tags := range digestTags {
+				for _, tag := range tags {
+					imageTag := ImageTag{ImageName: imageName, Tag: tag}
+					if digests[imageTag] == nil {
+						digests[imageTag] = make(map[RegistryName]Digest)
+					}
+					digests[imageTag][regName] = digest
+				}
+			}
+		}
+	}
+
+	for imageTag, byRegistry := range digests {
+		distinct := make(map[Digest]struct{})
+		for _, digest := range byRegistry {
+			distinct[digest] = struct{}{}
+		}
+
+		if len(distinct) > 1 {
+			report.Drifts = append(report.Drifts, DigestDrift{
+				Image:   imageTag.ImageName,
+				Tag:     imageTag.Tag,
+				Digests: byRegistry,
+			})
+		}
+	}
+
+	sort.Slice(report.Drifts, func(i, j int) bool {
+		if report.Drifts[i].Image != report.Drifts[j].Image {
+			return report.Drifts[i].Image < report.Drifts[j].Image
+		}
+		return report.Drifts[i].Tag < report.Drifts[j].Tag
+	})
+
+	return report
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestFindDigestDrift(t *testing.T) {
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			"us.gcr.io/foo": reg.RegInvImage{
+				"bar": reg.DigestTags{
+					"sha256:000": reg.TagSlice{"1.0", "latest"},
+					"sha256:111": reg.TagSlice{"1.1"},
+					"sha256:222": reg.TagSlice{},
+				},
+				"baz": reg.DigestTags{
+					"sha256:333": reg.TagSlice{"2.0"},
+				},
+			},
+			"eu.gcr.io/foo": reg.RegInvImage{
+				"bar": reg.DigestTags{
+					"sha256:000": reg.TagSlice{"1.0"},
+					// Drifted from us.gcr.io.
+					"sha256:444": reg.TagSlice{"latest"},
+					"sha256:555": reg.TagSlice{},
+				},
+			},
+			"asia.gcr.io/foo": reg.RegInvImage{
+				"bar": reg.DigestTags{
+					"sha256:000": reg.TagSlice{"1.0"},
+					"sha256:444": reg.TagSlice{"latest"},
+				},
+				"baz": reg.DigestTags{
+					"sha256:666": reg.TagSlice{"2.0"},
+				},
+			},
+			// Not compared.
+			"gcr.io/other": reg.RegInvImage{
+				"bar": reg.DigestTags{
+					"sha256:777": reg.TagSlice{"1.0"},
+				},
+			},
+		},
+	}
+
+	regNames := []reg.RegistryName{"us.gcr.io/foo", "eu.gcr.io/foo", "asia.gcr.io/foo"}
+	require.Equal(t, reg.DriftReport{
+		Registries: regNames,
+		Drifts: []reg.DigestDrift{
+			{
+				Image: "bar",
+				Tag:   "latest",
+				Digests: map[reg.RegistryName]reg.Digest{
+					"us.gcr.io/foo":   "sha256:000",
+					"eu.gcr.io/foo":   "sha256:444",
+					"asia.gcr.io/foo": "sha256:444",
+				},
+			},
+			{
+				Image: "baz",
+				Tag:   "2.0",
+				Digests: map[reg.RegistryName]reg.Digest{
+					"us.gcr.io/foo":   "sha256:333",
+					"asia.gcr.io/foo": "sha256:666",
+				},
+			},
+		},
+	}, sc.FindDigestDrift(regNames))
+
+	// Mirrors which agree have no drift.
+	require.Empty(t, sc.FindDigestDrift([]reg.RegistryName{"us.gcr.io/foo"}).Drifts)
+}
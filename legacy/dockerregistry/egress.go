@@ -0,0 +1,94 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io"
+)
+
+// bytesPerGiB is the unit egress is priced in.
+const bytesPerGiB = 1 << 30
+
+// EgressAssumptions explains what an EgressEstimate does and does not take
+// into account.
+const EgressAssumptions = `This is a planning aid, not a bill. It assumes that:
+  - every image not yet found in a destination registry is copied in full
+    from its source registry, at the image size recorded while reading the
+    registries (images of unknown size count as 0 bytes);
+  - the same rate applies to every destination, regardless of its region or
+    cloud;
+  - nothing is deducted for layers shared between images, or for blobs
+    mounted within a storage group.`
+
+// EgressEstimate is the projected transfer into a destination registry, and
+// what it costs.
+type EgressEstimate struct {
+	Registry RegistryName
+	Bytes    int64
+	Cost     float64
+}
+
+// EstimateEgressCost prices the bytes each projection adds to its registry
+// at ratePerGiB.
+func EstimateEgressCost(
+	projections []StorageProjection,
+	ratePerGiB float64,
+) []EgressEstimate {
+	estimates := make([]EgressEstimate, 0, len(projections))
+	for _, p := range projections {
+		estimates = append(estimates, EgressEstimate{
+			Registry: p.Registry,
+			Bytes:    p.Added,
+			Cost:     float64(p.Added) / bytesPerGiB * ratePerGiB,
+		})
+	}
+
+	return estimates
+}
+
+// WriteEgressEstimate writes the estimates, their total and the assumptions
+// they are based on.
+func WriteEgressEstimate(
+	w io.Writer,
+	estimates []EgressEstimate,
+	ratePerGiB float64,
+) {
+	var totalBytes int64
+	var totalCost float64
+
+	fmt.Fprintf(w, "Estimated egress cost (at %.4f per GiB):\n", ratePerGiB)
+	for _, e := range estimates {
+		fmt.Fprintf(
+			w,
+			"  %s: %.2f GiB, %.2f\n",
+			e.Registry,
+			float64(e.Bytes)/bytesPerGiB,
+			e.Cost,
+		)
+
+		totalBytes += e.Bytes
+		totalCost += e.Cost
+	}
+	fmt.Fprintf(
+		w,
+		"  total: %.2f GiB, %.2f\n",
+		float64(totalBytes)/bytesPerGiB,
+		totalCost,
+	)
+	fmt.Fprintln(w, EgressAssumptions)
+}
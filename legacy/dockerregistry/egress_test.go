@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestEstimateEgressCost(t *testing.T) {
+	estimates := reg.EstimateEgressCost(
+		[]reg.StorageProjection{
+			{Registry: "eu.gcr.io/prod", Current: 1 << 30, Added: 2 << 30},
+			{Registry: "us.gcr.io/prod", Current: 0, Added: 1 << 29},
+		},
+		0.12,
+	)
+
+	require.Equal(
+		t,
+		[]reg.EgressEstimate{
+			{Registry: "eu.gcr.io/prod", Bytes: 2 << 30, Cost: 0.24},
+			{Registry: "us.gcr.io/prod", Bytes: 1 << 29, Cost: 0.06},
+		},
+		estimates,
+	)
+
+	var out bytes.Buffer
+	reg.WriteEgressEstimate(&out, estimates, 0.12)
+	require.Equal(
+		t,
+		`Estimated egress cost (at 0.1200 per GiB):
+  eu.gcr.io/prod: 2.00 GiB, 0.24
+  us.gcr.io/prod: 0.50 GiB, 0.06
+  total: 2.50 GiB, 0.30
+`+reg.EgressAssumptions+"\n",
+		out.String(),
+	)
+}
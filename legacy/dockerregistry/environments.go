@@ -0,0 +1,77 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// validEnvironment matches the environment names accepted in manifests, such
+// as 'staging' or 'prod-eu'.
+var validEnvironment = regexp.MustCompile(`^[\w][\w.-]{0,62}$`)
+
+// ValidateEnvironment validates the name of an environment.
+func ValidateEnvironment(environment string) error {
+	if !validEnvironment.MatchString(environment) {
+		return fmt.Errorf("invalid environment: %q", environment)
+	}
+
+	return nil
+}
+
+// SelectEnvironment removes the images which are restricted to other
+// environments than environment from every manifest, so that only the images
+// meant for it are promoted. Images without environments are kept. The
+// removed images are returned, as the manifest file and image name.
+func SelectEnvironment(mfests []Manifest, environment string) []string {
+	removed := make([]string, 0)
+
+	for i := range mfests {
+		images := make([]Image, 0, len(mfests[i].Images))
+		for _, image := range mfests[i].Images {
+			if image.isFor(environment) {
+				images = append(images, image)
+				continue
+			}
+
+			removed = append(
+				removed,
+				fmt.Sprintf("%s: %s", mfests[i].Filepath, image.ImageName),
+			)
+		}
+
+		mfests[i].Images = images
+	}
+
+	return removed
+}
+
+// isFor tells whether the image is promoted for the environment.
+func (img Image) isFor(environment string) bool {
+	if len(img.Environments) == 0 {
+		return true
+	}
+
+	for _, e := range img.Environments {
+		if e == environment {
+			return true
+		}
+	}
+
+	return false
+}
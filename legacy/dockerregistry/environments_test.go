@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestSelectEnvironment(t *testing.T) {
+	mkImage := func(name reg.ImageName, environments ...string) reg.Image {
+		return reg.Image{
+			ImageName:    name,
+			Dmap:         reg.DigestTags{"sha256:000": {"1.0"}},
+			Environments: environments,
+		}
+	}
+
+	tests := []struct {
+		name            string
+		environment     string
+		expectedImages  []reg.Image
+		expectedRemoved []string
+	}{
+		{
+			"Staging",
+			"staging",
+			[]reg.Image{
+				mkImage("all"),
+				mkImage("staging", "dev", "staging"),
+			},
+			[]string{"manifests/a/promoter-manifest.yaml: prod"},
+		},
+		{
+			"Prod",
+			"prod",
+			[]reg.Image{
+				mkImage("all"),
+				mkImage("prod", "prod"),
+			},
+			[]string{"manifests/a/promoter-manifest.yaml: staging"},
+		},
+		{
+			"Unknown environment",
+			"qa",
+			[]reg.Image{
+				mkImage("all"),
+			},
+			[]string{
+				"manifests/a/promoter-manifest.yaml: staging",
+				"manifests/a/promoter-manifest.yaml: prod",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		mfests := []reg.Manifest{
+			{
+				Filepath: "manifests/a/promoter-manifest.yaml",
+				Images: []reg.Image{
+					mkImage("all"),
+					mkImage("staging", "dev", "staging"),
+					mkImage("prod", "prod"),
+				},
+			},
+		}
+
+		removed := reg.SelectEnvironment(mfests, test.environment)
+		require.Equal(t, test.expectedImages, mfests[0].Images, test.name)
+		require.Equal(t, test.expectedRemoved, removed, test.name)
+	}
+}
+
+func TestValidateEnvironment(t *testing.T) {
+	require.Nil(t, reg.ValidateEnvironment("prod-eu"))
+	require.Error(t, reg.ValidateEnvironment(""))
+	require.Error(t, reg.ValidateEnvironment("-prod"))
+	require.Error(t, reg.ValidateEnvironment("prod/eu"))
+}
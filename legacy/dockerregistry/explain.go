@@ -0,0 +1,220 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Explainer traces a single image through the computation of the promotion
+// edges, recording for each of its edges the outcome of every stage.
+type Explainer struct {
+	// ShortDigests abbreviates the digests of the traced edges.
+	ShortDigests bool
+
+	repo   string
+	tag    Tag
+	digest Digest
+
+	edges   []PromotionEdge
+	steps   map[PromotionEdge][]string
+	dropped map[PromotionEdge]string
+}
+
+// NewExplainer creates an Explainer for the image reference, which is an image
+// name as used in the manifests, or a source or destination repository,
+// optionally followed by ':<tag>' or '@<digest>'.
+func NewExplainer(ref string) *Explainer {
+	e := &Explainer{
+		repo:    ref,
+		steps:   make(map[PromotionEdge][]string),
+		dropped: make(map[PromotionEdge]string),
+	}
+
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		e.repo, e.digest = ref[:i], Digest(ref[i+1:])
+	} else if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		e.repo, e.tag = ref[:i], Tag(ref[i+1:])
+	}
+
+	return e
+}
+
+// matches returns true if the edge promotes the explained image.
+func (e *Explainer) matches(edge PromotionEdge) bool {
+	if e.tag != "" && e.tag != edge.SrcImageTag.Tag {
+		return false
+	}
+
+	if e.digest != "" && e.digest != edge.Digest {
+		return false
+	}
+
+	return e.repo == string(edge.SrcImageTag.ImageName) ||
+		e.repo == ToLQIN(edge.SrcRegistry.Name, edge.SrcImageTag.ImageName) ||
+		e.repo == ToLQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName)
+}
+
+// Manifests records the edges of the explained image found in the manifests.
+func (e *Explainer) Manifests(edges map[PromotionEdge]interface{}) {
+	for edge := range edges {
+		if e.matches(edge) {
+			e.edges = append(e.edges, edge)
+			e.steps[edge] = []string{"[ok] found in the manifests"}
+		}
+	}
+
+	sort.Slice(e.edges, func(i, j int) bool {
+		return describeEdge(e.edges[i]) < describeEdge(e.edges[j])
+	})
+}
+
+// Stage records which of the edges of the explained image made it through the
+// named stage.
+func (e *Explainer) Stage(name string, remaining map[PromotionEdge]interface{}) {
+	for _, edge := range e.edges {
+		if _, ok := e.dropped[edge]; ok {
+			continue
+		}
+
+		if _, ok := remaining[edge]; ok {
+			e.steps[edge] = append(e.steps[edge], "[ok] kept by "+name)
+			continue
+		}
+
+		e.steps[edge] = append(e.steps[edge], "[no] dropped by "+name)
+		e.dropped[edge] = name
+	}
+}
+
+// Inventory records what the registries read into sc hold for the source
+// and destination of every remaining edge of the explained image, following
+// the same decisions as GetPromotionCandidates.
+func (e *Explainer) Inventory(sc *SyncContext) {
+	for _, edge := range e.edges {
+		if _, ok := e.dropped[edge]; ok {
+			continue
+		}
+
+		edge := edge
+		e.steps[edge] = append(e.steps[edge], e.inventorySteps(sc, &edge)...)
+	}
+}
+
+func (e *Explainer) inventorySteps(sc *SyncContext, edge *PromotionEdge) []string {
+	for _, ignored := range sc.InvIgnore {
+		if ignored == edge.SrcImageTag.ImageName {
+			e.dropped[*edge] = "source image could not be read"
+			return []string{"[no] source image could not be read"}
+		}
+	}
+
+	sp, dp := sc.vertexProps(*edge)
+
+	if dp.PqinDigestMatch {
+		e.dropped[*edge] = "already promoted"
+		return []string{"[no] destination tag already points to the digest"}
+	}
+
+	if edge.DstImageTag.Tag == "" && dp.DigestExists {
+		e.dropped[*edge] = "already promoted"
+		return []string{"[no] digest already exists in the destination"}
+	}
+
+	if !sp.DigestExists {
+		e.dropped[*edge] = "source digest is lost"
+		return []string{"[no] digest not found in the source"}
+	}
+
+	steps := []string{"[ok] digest exists in the source"}
+
+	switch {
+	case dp.PqinExists && dp.DigestExists:
+		e.dropped[*edge] = "tag move conflict"
+		steps = append(steps, fmt.Sprintf(
+			"[no] destination tag %s already points to another digest",
+			edge.DstImageTag.Tag,
+		))
+	case dp.PqinExists:
+		steps = append(steps, fmt.Sprintf(
+			"[ok] destination tag points to %s; moving it",
+			dp.BadDigest,
+		))
+	case dp.DigestExists:
+		steps = append(steps, fmt.Sprintf(
+			"[ok] digest exists in the destination with tags %v; adding the tag",
+			dp.OtherTags,
+		))
+	default:
+		steps = append(steps, "[ok] neither the digest nor the tag exist in the destination")
+	}
+
+	return steps
+}
+
+// describeEdge renders an edge as its source and destination.
+func describeEdge(edge PromotionEdge) string {
+	dst := ToLQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName)
+	if edge.DstImageTag.Tag != "" {
+		dst = ToPQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName, edge.DstImageTag.Tag)
+	}
+
+	return fmt.Sprintf(
+		"%s -> %s",
+		ToFQIN(edge.SrcRegistry.Name, edge.SrcImageTag.ImageName, edge.Digest),
+		dst,
+	)
+}
+
+// String renders the trace.
+func (e *Explainer) String() string {
+	var b strings.Builder
+
+	ref := e.repo
+	if e.tag != "" {
+		ref += ":" + string(e.tag)
+	} else if e.digest != "" {
+		ref += "@" + string(e.digest)
+	}
+
+	if len(e.edges) == 0 {
+		fmt.Fprintf(&b, "%s: [no] not found in the manifests\n", ref)
+		return b.String()
+	}
+
+	for _, edge := range e.edges {
+		shown := edge
+		if e.ShortDigests {
+			shown.Digest = Digest(shortDigest(string(edge.Digest)))
+		}
+
+		fmt.Fprintf(&b, "%s\n", describeEdge(shown))
+		for _, step := range e.steps[edge] {
+			fmt.Fprintf(&b, "  %s\n", step)
+		}
+
+		if stage, ok := e.dropped[edge]; ok {
+			fmt.Fprintf(&b, "  => will not be promoted (%s)\n", stage)
+		} else {
+			fmt.Fprintf(&b, "  => will be promoted\n")
+		}
+	}
+
+	return b.String()
+}
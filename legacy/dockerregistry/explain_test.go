@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestExplainer(t *testing.T) {
+	srcRC := reg.RegistryContext{
+		Name: "gcr.io/foo",
+		Src:  true,
+	}
+	dstRC := reg.RegistryContext{
+		Name: "gcr.io/bar",
+	}
+
+	mkEdge := func(tag reg.Tag, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: srcRC,
+			SrcImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+			Digest:      digest,
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("1.0", "sha256:111"): nil,
+		mkEdge("2.0", "sha256:222"): nil,
+	}
+
+	tests := []struct {
+		name      string
+		ref       string
+		selection map[reg.PromotionEdge]interface{}
+		dst       reg.DigestTags
+		expected  string
+	}{
+		{
+			"Not in the manifests",
+			"b:1.0",
+			nil,
+			nil,
+			"b:1.0: [no] not found in the manifests\n",
+		},
+		{
+			"Regular promotion",
+			"gcr.io/bar/a:1.0",
+			nil,
+			nil,
+			`gcr.io/foo/a@sha256:111 -> gcr.io/bar/a:1.0
+  [ok] found in the manifests
+  [ok] digest exists in the source
+  [ok] neither the digest nor the tag exist in the destination
+  [ok] kept by edge filtering
+  => will be promoted
+`,
+		},
+		{
+			"Already promoted",
+			"a@sha256:111",
+			nil,
+			reg.DigestTags{"sha256:111": {"1.0"}},
+			`gcr.io/foo/a@sha256:111 -> gcr.io/bar/a:1.0
+  [ok] found in the manifests
+  [no] destination tag already points to the digest
+  => will not be promoted (already promoted)
+`,
+		},
+		{
+			"Tag move conflict",
+			"a:2.0",
+			nil,
+			reg.DigestTags{
+				"sha256:222": {"other"},
+				"sha256:333": {"2.0"},
+			},
+			`gcr.io/foo/a@sha256:222 -> gcr.io/bar/a:2.0
+  [ok] found in the manifests
+  [ok] digest exists in the source
+  [no] destination tag 2.0 already points to another digest
+  => will not be promoted (tag move conflict)
+`,
+		},
+		{
+			"Dropped by the selection",
+			"gcr.io/foo/a",
+			map[reg.PromotionEdge]interface{}{
+				mkEdge("2.0", "sha256:222"): nil,
+			},
+			reg.DigestTags{"sha256:222": {"other"}},
+			`gcr.io/foo/a@sha256:111 -> gcr.io/bar/a:1.0
+  [ok] found in the manifests
+  [no] dropped by the selection file
+  => will not be promoted (the selection file)
+gcr.io/foo/a@sha256:222 -> gcr.io/bar/a:2.0
+  [ok] found in the manifests
+  [ok] kept by the selection file
+  [ok] digest exists in the source
+  [ok] digest exists in the destination with tags [other]; adding the tag
+  [ok] kept by edge filtering
+  => will be promoted
+`,
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{
+			Inv: reg.MasterInventory{
+				srcRC.Name: reg.RegInvImage{
+					"a": reg.DigestTags{
+						"sha256:111": {"1.0"},
+						"sha256:222": {"2.0"},
+					},
+				},
+				dstRC.Name: reg.RegInvImage{},
+			},
+		}
+		if test.dst != nil {
+			sc.Inv[dstRC.Name]["a"] = test.dst
+		}
+
+		remaining := edges
+		explainer := reg.NewExplainer(test.ref)
+		explainer.Manifests(edges)
+		if test.selection != nil {
+			remaining = test.selection
+			explainer.Stage("the selection file", remaining)
+		}
+
+		candidates, _ := sc.GetPromotionCandidates(remaining)
+		explainer.Inventory(&sc)
+		explainer.Stage("edge filtering", candidates)
+
+		require.Equal(t, test.expected, explainer.String(), test.name)
+	}
+}
+
+func TestExplainerShortDigests(t *testing.T) {
+	digest := reg.Digest("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	edge := reg.PromotionEdge{
+		SrcRegistry: reg.RegistryContext{Name: "gcr.io/foo", Src: true},
+		SrcImageTag: reg.ImageTag{ImageName: "a", Tag: "1.0"},
+		Digest:      digest,
+		DstRegistry: reg.RegistryContext{Name: "gcr.io/bar"},
+		DstImageTag: reg.ImageTag{ImageName: "a", Tag: "1.0"},
+	}
+
+	// The explained reference keeps the full digest; only the displayed
+	// edges are abbreviated.
+	explainer := reg.NewExplainer("a@" + string(digest))
+	explainer.ShortDigests = true
+	explainer.Manifests(map[reg.PromotionEdge]interface{}{edge: nil})
+
+	require.Equal(t, `gcr.io/foo/a@sha256:0123456789ab -> gcr.io/bar/a:1.0
+  [ok] found in the manifests
+  => will be promoted
+`, explainer.String())
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// ExtraTagPolicyIgnore does not look for extra destination tags.
+	ExtraTagPolicyIgnore = "ignore"
+
+	// ExtraTagPolicyWarn logs a warning for every extra destination tag.
+	ExtraTagPolicyWarn = "warn"
+
+	// ExtraTagPolicyReport records the extra destination tags in the
+	// collected logs (and so in the JSON summary), and writes them out.
+	ExtraTagPolicyReport = "report"
+)
+
+// ExtraTagPolicies are the supported policies for extra destination tags.
+var ExtraTagPolicies = []string{
+	ExtraTagPolicyIgnore,
+	ExtraTagPolicyWarn,
+	ExtraTagPolicyReport,
+}
+
+// ExtraTag is a tag of a destination image which no manifest declares.
+type ExtraTag struct {
+	Registry RegistryName `json:"registry"`
+	Image    ImageName    `json:"image"`
+	Tag      Tag          `json:"tag"`
+	Digest   Digest       `json:"digest"`
+}
+
+// String returns the tag as a PQIN, along with its digest.
+func (t ExtraTag) String() string {
+	return fmt.Sprintf("%s (at %s)", ToPQIN(t.Registry, t.Image, t.Tag), t.Digest)
+}
+
+// FindExtraTags returns the tags of the destination images of the edges, as
+// read into sc.Inv, which none of the edges declares. Only the destination
+// images of the edges are looked at, and cosign attachment tags are left out,
+// as they are not declared by manifests. The tags are sorted.
+func (sc *SyncContext) FindExtraTags(
+	edges map[PromotionEdge]interface{},
+) []ExtraTag {
+	type destImage struct {
+		registry RegistryName
+		image    ImageName
+	}
+
+	declared := make(map[destImage]TagSet)
+	for edge := range edges {
+		dst := destImage{edge.DstRegistry.Name, edge.DstImageTag.ImageName}
+		if declared[dst] == nil {
+			declared[dst] = make(TagSet)
+		}
+
+		declared[dst][edge.DstImageTag.Tag] = nil
+	}
+
+	extras := make([]ExtraTag, 0)
+	for dst, tags := range declared {
+		for digest, tagSlice := range sc.Inv[dst.registry][dst.image] {
+			for _, tag := range tagSlice {
+				if _, ok := tags[tag]; ok {
+					continue
+				}
+
+				if _, ok := CosignAttachmentSubject(tag); ok {
+					continue
+				}
+
+				extras = append(extras, ExtraTag{
+					Registry: dst.registry,
+					Image:    dst.image,
+					Tag:      tag,
+					Digest:   digest,
+				})
+			}
+		}
+	}
+
+	sort.Slice(extras, func(i, j int) bool {
+		return extras[i].String() < extras[j].String()
+	})
+
+	return extras
+}
+
+// HandleExtraTags surfaces the extra destination tags according to the
+// policy (one of ExtraTagPolicies). It never changes the registries.
+func (sc *SyncContext) HandleExtraTags(extras []ExtraTag, policy string) {
+	switch policy {
+	case ExtraTagPolicyWarn:
+		for _, extra := range extras {
+			logrus.Warnf("Destination tag %s is not declared by any manifest", extra)
+		}
+	case ExtraTagPolicyReport:
+		sc.Logs.ExtraTags = append(sc.Logs.ExtraTags, extras...)
+
+		w := sc.out()
+		fmt.Fprintf(w, "Undeclared destination tags: %d\n", len(extras))
+		for _, extra := range extras {
+			fmt.Fprintf(w, "  %s\n", extra)
+		}
+	}
+}
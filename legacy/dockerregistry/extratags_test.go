@@ -0,0 +1,86 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestFindExtraTags(t *testing.T) {
+	digest := reg.Digest("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	otherDigest := reg.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+
+	mkEdge := func(image reg.ImageName, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src"},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/dst"},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("foo", "1.0"): nil,
+		mkEdge("foo", "1.1"): nil,
+		mkEdge("bar", "2.0"): nil,
+	}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			"gcr.io/dst": reg.RegInvImage{
+				"foo": reg.DigestTags{
+					digest:      reg.TagSlice{"1.0", "1.1", "latest"},
+					otherDigest: reg.TagSlice{"0.9", "sha256-0000000000000000000000000000000000000000000000000000000000000000.sig"},
+				},
+				"bar": reg.DigestTags{
+					digest: reg.TagSlice{"2.0"},
+				},
+				// Not the destination of any edge.
+				"baz": reg.DigestTags{
+					digest: reg.TagSlice{"3.0"},
+				},
+			},
+		},
+	}
+
+	extras := sc.FindExtraTags(edges)
+	require.Equal(t, []reg.ExtraTag{
+		{Registry: "gcr.io/dst", Image: "foo", Tag: "0.9", Digest: otherDigest},
+		{Registry: "gcr.io/dst", Image: "foo", Tag: "latest", Digest: digest},
+	}, extras)
+
+	var out bytes.Buffer
+	sc.Out = &out
+
+	// Warnings are only logged.
+	sc.HandleExtraTags(extras, reg.ExtraTagPolicyWarn)
+	require.Empty(t, out.String())
+	require.Empty(t, sc.Logs.ExtraTags)
+
+	sc.HandleExtraTags(extras, reg.ExtraTagPolicyReport)
+	require.Equal(t, `Undeclared destination tags: 2
+  gcr.io/dst/foo:0.9 (at `+string(otherDigest)+`)
+  gcr.io/dst/foo:latest (at `+string(digest)+`)
+`, out.String())
+	require.Equal(t, extras, sc.Logs.ExtraTags)
+}
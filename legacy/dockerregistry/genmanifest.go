@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PlaceholderDestRegistry is the destination registry of a generated
+// manifest, which has to be replaced before the manifest is used.
+const PlaceholderDestRegistry = RegistryName("REPLACE-ME.example.com/destination")
+
+// GenerateManifest creates a promoter manifest which promotes the images in
+// the snapshot rii of srcRegistry, pinned to their current digests and tags,
+// to the PlaceholderDestRegistry. If prefix is not empty, only the images
+// whose name starts with it are included. This jump-starts adopting the
+// promoter for an existing registry.
+func GenerateManifest(
+	srcRegistry RegistryName,
+	rii RegInvImage,
+	prefix string,
+) (Manifest, error) {
+	m := Manifest{
+		Registries: []RegistryContext{
+			{Name: srcRegistry, Src: true},
+			{Name: PlaceholderDestRegistry},
+		},
+		Images: make([]Image, 0, len(rii)),
+	}
+
+	for imageName, digestTags := range rii {
+		if !strings.HasPrefix(string(imageName), prefix) {
+			continue
+		}
+
+		dmap := make(DigestTags, len(digestTags))
+		for digest, tags := range digestTags {
+			sorted := append(TagSlice{}, tags...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			dmap[digest] = sorted
+		}
+
+		m.Images = append(m.Images, Image{ImageName: imageName, Dmap: dmap})
+	}
+
+	sort.Slice(m.Images, func(i, j int) bool {
+		return m.Images[i].ImageName < m.Images[j].ImageName
+	})
+
+	if err := m.Validate(); err != nil {
+		return m, fmt.Errorf("generated manifest is invalid: %w", err)
+	}
+
+	return m, nil
+}
+
+// ToYAML renders the fields of the manifest which are stored in YAML.
+func (m *Manifest) ToYAML() (string, error) {
+	b, err := yaml.Marshal(struct {
+		Registries            []RegistryContext `yaml:"registries,omitempty"`
+		Images                []Image           `yaml:"images,omitempty"`
+		DefaultServiceAccount string            `yaml:"defaultServiceAccount,omitempty"`
+	}{
+		Registries:            m.Registries,
+		Images:                m.Images,
+		DefaultServiceAccount: m.DefaultServiceAccount,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
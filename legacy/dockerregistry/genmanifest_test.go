@@ -0,0 +1,84 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestGenerateManifest(t *testing.T) {
+	digestA := reg.Digest("sha256:" + strings.Repeat("a", 64))
+	digestB := reg.Digest("sha256:" + strings.Repeat("b", 64))
+	digestC := reg.Digest("sha256:" + strings.Repeat("c", 64))
+
+	rii := reg.RegInvImage{
+		"kube/apiserver": {
+			digestA: {"v1.1", "v1.0"},
+			digestB: {},
+		},
+		"kube/scheduler": {
+			digestC: {"v1.0"},
+		},
+		"other": {
+			digestC: {"latest"},
+		},
+	}
+
+	m, err := reg.GenerateManifest("gcr.io/staging", rii, "kube/")
+	require.Nil(t, err)
+	require.Equal(
+		t,
+		[]reg.Image{
+			{
+				ImageName: "kube/apiserver",
+				Dmap: reg.DigestTags{
+					digestA: {"v1.0", "v1.1"},
+					digestB: {},
+				},
+			},
+			{
+				ImageName: "kube/scheduler",
+				Dmap: reg.DigestTags{
+					digestC: {"v1.0"},
+				},
+			},
+		},
+		m.Images,
+	)
+
+	// The generated manifest is valid.
+	out, err := m.ToYAML()
+	require.Nil(t, err)
+	parsed, err := reg.ParseManifestYAML([]byte(out))
+	require.Nil(t, err)
+	require.Equal(t, m.Registries, parsed.Registries)
+	require.Equal(t, reg.PlaceholderDestRegistry, parsed.Registries[1].Name)
+
+	all, err := reg.GenerateManifest("gcr.io/staging", rii, "")
+	require.Nil(t, err)
+	require.Len(t, all.Images, 3)
+
+	_, err = reg.GenerateManifest("gcr.io/staging", reg.RegInvImage{
+		"foo": {"sha256:bad": {}},
+	}, "")
+	require.Error(t, err)
+}
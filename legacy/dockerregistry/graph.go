@@ -0,0 +1,111 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DependencyGraph renders the images of rii as a Graphviz DOT graph. Every
+// digest is a node, and so is every tag (as image:tag). Tags point to their
+// digests, and manifest lists point to their child images, labelled with the
+// platform of each child. This shows which tags are affected by deleting a
+// digest. ReadGCRManifestLists() must have been called beforehand for the
+// manifest lists to be linked to their children.
+func (sc *SyncContext) DependencyGraph(rii RegInvImage) string {
+	var b strings.Builder
+
+	// Digests may be shared by several images; label each digest node with
+	// all of them.
+	digestImages := make(map[Digest][]string)
+	tagEdges := make([]string, 0)
+	for imageName, digestTags := range rii {
+		for digest, tags := range digestTags {
+			digestImages[digest] = append(digestImages[digest], string(imageName))
+
+			for _, tag := range tags {
+				tagEdges = append(tagEdges, fmt.Sprintf(
+					"  %q [shape=box];\n  %q -> %q;\n",
+					string(imageName)+":"+string(tag),
+					string(imageName)+":"+string(tag),
+					digest,
+				))
+			}
+		}
+	}
+
+	listEdges := make([]string, 0)
+	for list, platforms := range sc.ListPlatforms {
+		if _, ok := digestImages[list]; !ok {
+			continue
+		}
+
+		for _, platform := range platforms {
+			if _, ok := digestImages[platform.Digest]; !ok {
+				digestImages[platform.Digest] = nil
+			}
+
+			listEdges = append(listEdges, fmt.Sprintf(
+				"  %q -> %q [label=%q];\n",
+				list,
+				platform.Digest,
+				platform.Platform,
+			))
+		}
+	}
+
+	digests := make([]string, 0, len(digestImages))
+	for digest := range digestImages {
+		digests = append(digests, string(digest))
+	}
+	sort.Strings(digests)
+	sort.Strings(tagEdges)
+	sort.Strings(listEdges)
+
+	b.WriteString("digraph images {\n")
+
+	for _, digest := range digests {
+		images := digestImages[Digest(digest)]
+		sort.Strings(images)
+
+		label := shortDigest(digest)
+		if len(images) > 0 {
+			label = strings.Join(images, "\n") + "\n" + label
+		}
+
+		shape := "ellipse"
+		if _, ok := sc.ListPlatforms[Digest(digest)]; ok {
+			shape = "doubleoctagon"
+		}
+
+		fmt.Fprintf(&b, "  %q [label=%q, shape=%s];\n", digest, label, shape)
+	}
+
+	for _, edge := range tagEdges {
+		b.WriteString(edge)
+	}
+
+	for _, edge := range listEdges {
+		b.WriteString(edge)
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
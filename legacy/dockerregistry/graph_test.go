@@ -0,0 +1,69 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	const (
+		list  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		amd64 = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+		arm64 = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+	)
+
+	sc := reg.SyncContext{
+		ListPlatforms: reg.ListPlatforms{
+			list: {
+				{Platform: "linux/amd64", Digest: amd64},
+				{Platform: "linux/arm64", Digest: arm64},
+			},
+		},
+	}
+
+	rii := reg.RegInvImage{
+		"foo": reg.DigestTags{
+			list:  {"1.0", "stable"},
+			amd64: {},
+		},
+		"bar": reg.DigestTags{
+			amd64: {"1.0"},
+		},
+	}
+
+	expected := `digraph images {
+  "` + list + `" [label="foo\nsha256:111111111111", shape=doubleoctagon];
+  "` + amd64 + `" [label="bar\nfoo\nsha256:222222222222", shape=ellipse];
+  "` + arm64 + `" [label="sha256:333333333333", shape=ellipse];
+  "bar:1.0" [shape=box];
+  "bar:1.0" -> "` + amd64 + `";
+  "foo:1.0" [shape=box];
+  "foo:1.0" -> "` + list + `";
+  "foo:stable" [shape=box];
+  "foo:stable" -> "` + list + `";
+  "` + list + `" -> "` + amd64 + `" [label="linux/amd64"];
+  "` + list + `" -> "` + arm64 + `" [label="linux/arm64"];
+}
+`
+
+	require.Equal(t, expected, sc.DependencyGraph(rii))
+}
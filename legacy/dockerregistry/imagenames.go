@@ -0,0 +1,211 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validImageName matches the repository paths accepted by registries.
+var validImageName = regexp.MustCompile(
+	`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`,
+)
+
+// imageNameRule rewrites the image names matching pattern.
+type imageNameRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// ImageNameMap rewrites source image names to the image names used at the
+// destinations. Its rules are tried in order, and the first rule whose
+// pattern matches the whole source image name wins. Image names matched by no
+// rule are kept.
+type ImageNameMap []imageNameRule
+
+// ParseImageNameMap parses rules of the form '<pattern>=<replacement>', where
+// pattern is a regular expression matching the whole source image name and
+// replacement may refer to its capture groups (as in '${1}'), e.g.
+// 'old-org/(.*)=new-org/${1}'.
+func ParseImageNameMap(rules []string) (ImageNameMap, error) {
+	m := make(ImageNameMap, 0, len(rules))
+	for _, rule := range rules {
+		i := strings.Index(rule, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf(
+				"image name rule %q must have the form <pattern>=<replacement>",
+				rule,
+			)
+		}
+
+		pattern, err := regexp.Compile("^(?:" + rule[:i] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid image name rule %q: %w", rule, err)
+		}
+
+		m = append(m, imageNameRule{
+			pattern:     pattern,
+			replacement: rule[i+1:],
+		})
+	}
+
+	return m, nil
+}
+
+// Rewrite returns the destination image name of the source image name.
+func (m ImageNameMap) Rewrite(name ImageName) (ImageName, error) {
+	for _, rule := range m {
+		if !rule.pattern.MatchString(string(name)) {
+			continue
+		}
+
+		rewritten := rule.pattern.ReplaceAllString(string(name), rule.replacement)
+		if !validImageName.MatchString(rewritten) {
+			return "", fmt.Errorf(
+				"image name %s is rewritten to the invalid image name %q",
+				name,
+				rewritten,
+			)
+		}
+
+		return ImageName(rewritten), nil
+	}
+
+	return name, nil
+}
+
+// RewriteEdges rewrites the destination image names of the edges. It is an
+// error for two edges to promote different digests to the same destination
+// image and tag after the rewrite; all such conflicts are reported together.
+func (m ImageNameMap) RewriteEdges(
+	edges map[PromotionEdge]interface{},
+) (map[PromotionEdge]interface{}, error) {
+	if len(m) == 0 {
+		return edges, nil
+	}
+
+	rewritten := make(map[PromotionEdge]interface{})
+	for edge := range edges {
+		dstImageName, err := m.Rewrite(edge.DstImageTag.ImageName)
+		if err != nil {
+			return nil, err
+		}
+
+		edge.DstImageTag.ImageName = dstImageName
+		rewritten[edge] = nil
+	}
+
+	// The digests (and their sources) promoted to each destination tag.
+	sources := make(map[string]map[Digest][]string)
+	for edge := range rewritten {
+		if edge.DstImageTag.Tag == "" {
+			continue
+		}
+
+		dst := ToPQIN(
+			edge.DstRegistry.Name,
+			edge.DstImageTag.ImageName,
+			edge.DstImageTag.Tag,
+		)
+		if sources[dst] == nil {
+			sources[dst] = make(map[Digest][]string)
+		}
+
+		sources[dst][edge.Digest] = append(
+			sources[dst][edge.Digest],
+			ToFQIN(edge.SrcRegistry.Name, edge.SrcImageTag.ImageName, edge.Digest),
+		)
+	}
+
+	conflicts := make([]string, 0)
+	for dst, digests := range sources {
+		if len(digests) < 2 {
+			continue
+		}
+
+		srcs := make([]string, 0)
+		for _, fqins := range digests {
+			srcs = append(srcs, fqins...)
+		}
+		sort.Strings(srcs)
+
+		conflicts = append(conflicts, fmt.Sprintf(
+			"%s (from %s)",
+			dst,
+			strings.Join(srcs, ", "),
+		))
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, fmt.Errorf(
+			"%d destination images are promoted from different digests after rewriting image names: %s",
+			len(conflicts),
+			strings.Join(conflicts, "; "),
+		)
+	}
+
+	return CheckOverlappingEdges(rewritten)
+}
+
+// NamingPolicy is a regular expression which the whole name of every
+// destination image has to match.
+type NamingPolicy struct {
+	expr    string
+	pattern *regexp.Regexp
+}
+
+// ParseNamingPolicy parses the regular expression of a NamingPolicy.
+func ParseNamingPolicy(expr string) (*NamingPolicy, error) {
+	pattern, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid naming policy %q: %w", expr, err)
+	}
+
+	return &NamingPolicy{expr: expr, pattern: pattern}, nil
+}
+
+// Check returns an error listing every destination image of the edges whose
+// name does not match the policy.
+func (p *NamingPolicy) Check(edges map[PromotionEdge]interface{}) error {
+	violations := make(map[string]interface{})
+	for edge := range edges {
+		if !p.pattern.MatchString(string(edge.DstImageTag.ImageName)) {
+			violations[ToLQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName)] = nil
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(violations))
+	for name := range violations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf(
+		"%d destination images do not match the naming policy %q: %s",
+		len(names),
+		p.expr,
+		strings.Join(names, ", "),
+	)
+}
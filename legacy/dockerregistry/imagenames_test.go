@@ -0,0 +1,153 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestImageNameMapRewrite(t *testing.T) {
+	m, err := reg.ParseImageNameMap([]string{
+		"old-org/(.*)=new-org/${1}",
+		"legacy-([a-z]+)=${1}",
+		"bad=Bad_Name",
+	})
+	require.Nil(t, err)
+
+	tests := []struct {
+		name      string
+		input     reg.ImageName
+		expected  reg.ImageName
+		expectErr bool
+	}{
+		{"Capture group", "old-org/foo/bar", "new-org/foo/bar", false},
+		{"Second rule", "legacy-baz", "baz", false},
+		{"Pattern must match the whole name", "x/legacy-baz", "x/legacy-baz", false},
+		{"Unmapped", "foo", "foo", false},
+		{"Invalid result", "bad", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := m.Rewrite(test.input)
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestParseImageNameMapInvalid(t *testing.T) {
+	for _, rule := range []string{"no-separator", "=foo", "(unclosed=foo"} {
+		_, err := reg.ParseImageNameMap([]string{rule})
+		require.Error(t, err, rule)
+	}
+}
+
+func TestImageNameMapRewriteEdges(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/src", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/dst"}
+
+	mkEdge := func(image reg.ImageName, digest reg.Digest, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: srcRC,
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      digest,
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+	rewritten := func(edge reg.PromotionEdge, image reg.ImageName) reg.PromotionEdge {
+		edge.DstImageTag.ImageName = image
+		return edge
+	}
+
+	m, err := reg.ParseImageNameMap([]string{"(old|older)/(.*)=new/${2}"})
+	require.Nil(t, err)
+
+	fooOld := mkEdge("old/foo", "sha256:111", "1.0")
+	bar := mkEdge("bar", "sha256:222", "1.0")
+
+	got, err := m.RewriteEdges(map[reg.PromotionEdge]interface{}{
+		fooOld: nil,
+		bar:    nil,
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[reg.PromotionEdge]interface{}{
+		rewritten(fooOld, "new/foo"): nil,
+		bar:                          nil,
+	}, got)
+
+	// Two sources promoting different digests to the same destination tag.
+	_, err = m.RewriteEdges(map[reg.PromotionEdge]interface{}{
+		fooOld:                                   nil,
+		mkEdge("older/foo", "sha256:333", "1.0"): nil,
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "gcr.io/dst/new/foo:1.0")
+	require.Contains(t, err.Error(), "gcr.io/src/older/foo@sha256:333")
+
+	// The same digest from two sources is not a conflict.
+	_, err = m.RewriteEdges(map[reg.PromotionEdge]interface{}{
+		fooOld:                                   nil,
+		mkEdge("older/foo", "sha256:111", "1.0"): nil,
+	})
+	require.Nil(t, err)
+}
+
+func TestNamingPolicyCheck(t *testing.T) {
+	mkEdge := func(image reg.ImageName, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src", Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      "sha256:111",
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/dst"},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	_, err := reg.ParseNamingPolicy("(unclosed")
+	require.Error(t, err)
+
+	policy, err := reg.ParseNamingPolicy("(team-a|team-b)/[a-z0-9-]+")
+	require.Nil(t, err)
+
+	require.Nil(t, policy.Check(map[reg.PromotionEdge]interface{}{
+		mkEdge("team-a/foo", "1.0"): nil,
+		mkEdge("team-b/bar", "1.0"): nil,
+	}))
+
+	// The policy must match the whole name, and every image is listed once.
+	err = policy.Check(map[reg.PromotionEdge]interface{}{
+		mkEdge("team-a/foo", "1.0"):     nil,
+		mkEdge("team-c/foo", "1.0"):     nil,
+		mkEdge("team-c/foo", "1.1"):     nil,
+		mkEdge("team-a/foo/bar", "1.0"): nil,
+	})
+	require.Error(t, err)
+	require.Equal(
+		t,
+		`2 destination images do not match the naming policy "(team-a|team-b)/[a-z0-9-]+": gcr.io/dst/team-a/foo/bar, gcr.io/dst/team-c/foo`,
+		err.Error(),
+	)
+}
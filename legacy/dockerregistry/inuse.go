@@ -0,0 +1,208 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// InUseImage is an image found running in a cluster, pinned to the digest it
+// runs with. Tag is empty if the image was referenced by digest only.
+type InUseImage struct {
+	Repository string
+	Tag        Tag
+	Digest     Digest
+}
+
+// ParseInUseImages parses a list of image references, one per line, as
+// gathered from the pod specs of running clusters. Every reference must be
+// pinned to a digest: "<repository>[:<tag>]@<digest>". Empty lines and lines
+// starting with '#' are ignored, as are duplicate references.
+func ParseInUseImages(b []byte) ([]InUseImage, error) {
+	images := make([]InUseImage, 0)
+	seen := make(map[InUseImage]interface{})
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		image, err := parseInUseImage(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+
+		if _, ok := seen[image]; ok {
+			continue
+		}
+		seen[image] = nil
+		images = append(images, image)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+func parseInUseImage(ref string) (InUseImage, error) {
+	var image InUseImage
+
+	i := strings.LastIndex(ref, "@")
+	if i < 0 {
+		return image, fmt.Errorf("image %q is not pinned to a digest", ref)
+	}
+
+	image.Digest = Digest(ref[i+1:])
+	if err := ValidateDigest(image.Digest); err != nil {
+		return image, fmt.Errorf("image %q: %w", ref, err)
+	}
+
+	image.Repository = ref[:i]
+	if j := strings.LastIndex(image.Repository, ":"); j > strings.LastIndex(image.Repository, "/") {
+		image.Tag = Tag(image.Repository[j+1:])
+		image.Repository = image.Repository[:j]
+
+		if err := ValidateTag(image.Tag); err != nil {
+			return image, fmt.Errorf("image %q: %w", ref, err)
+		}
+	}
+
+	if !strings.Contains(image.Repository, "/") {
+		return image, fmt.Errorf("image %q has no registry", ref)
+	}
+
+	return image, nil
+}
+
+// ParseInUseImagesFromFile parses the in-use images from a filepath.
+func ParseInUseImagesFromFile(filePath string) ([]InUseImage, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseInUseImages(b)
+}
+
+// UseInUseImages replaces the images of every manifest with the in-use images
+// found in its source registry, so that exactly those are promoted to the
+// manifest's destinations, pinned to their running digests. The references
+// of images outside of all source registries are returned.
+func UseInUseImages(mfests []Manifest, images []InUseImage) []string {
+	matched := make(map[InUseImage]interface{})
+
+	for i := range mfests {
+		if mfests[i].SrcRegistry == nil {
+			continue
+		}
+
+		prefix := string(mfests[i].SrcRegistry.Name) + "/"
+		dmaps := make(map[ImageName]DigestTags)
+
+		for _, image := range images {
+			if !strings.HasPrefix(image.Repository, prefix) {
+				continue
+			}
+			matched[image] = nil
+
+			imageName := ImageName(strings.TrimPrefix(image.Repository, prefix))
+			if dmaps[imageName] == nil {
+				dmaps[imageName] = make(DigestTags)
+			}
+
+			tags := dmaps[imageName][image.Digest]
+			if tags == nil {
+				tags = TagSlice{}
+			}
+			if image.Tag != "" {
+				tags = append(tags, image.Tag)
+			}
+			dmaps[imageName][image.Digest] = tags
+		}
+
+		mfests[i].Images = make([]Image, 0, len(dmaps))
+		for imageName, dmap := range dmaps {
+			mfests[i].Images = append(mfests[i].Images, Image{
+				ImageName: imageName,
+				Dmap:      dmap,
+			})
+		}
+
+		sort.Slice(mfests[i].Images, func(a, b int) bool {
+			return mfests[i].Images[a].ImageName < mfests[i].Images[b].ImageName
+		})
+	}
+
+	unmatched := make([]string, 0)
+	for _, image := range images {
+		if _, ok := matched[image]; !ok {
+			unmatched = append(unmatched, image.String())
+		}
+	}
+	sort.Strings(unmatched)
+
+	return unmatched
+}
+
+// MissingInUseImages returns the in-use images of the manifests' source
+// registries which are not found in the inventory.
+func MissingInUseImages(
+	mfests []Manifest,
+	images []InUseImage,
+	mi MasterInventory,
+) []string {
+	missing := make([]string, 0)
+
+	for _, mfest := range mfests {
+		if mfest.SrcRegistry == nil {
+			continue
+		}
+
+		prefix := string(mfest.SrcRegistry.Name) + "/"
+		for _, image := range images {
+			if !strings.HasPrefix(image.Repository, prefix) {
+				continue
+			}
+
+			imageName := ImageName(strings.TrimPrefix(image.Repository, prefix))
+			if _, ok := mi[mfest.SrcRegistry.Name][imageName][image.Digest]; !ok {
+				missing = append(missing, image.String())
+			}
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
+
+// String returns the image reference.
+func (image InUseImage) String() string {
+	if image.Tag == "" {
+		return image.Repository + "@" + string(image.Digest)
+	}
+
+	return image.Repository + ":" + string(image.Tag) + "@" + string(image.Digest)
+}
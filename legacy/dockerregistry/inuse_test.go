@@ -0,0 +1,133 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+var (
+	inUseDigestA = reg.Digest("sha256:" + strings.Repeat("a", 64))
+	inUseDigestB = reg.Digest("sha256:" + strings.Repeat("b", 64))
+)
+
+func TestParseInUseImages(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    []reg.InUseImage
+		expectedErr bool
+	}{
+		{
+			"Tagged and untagged references",
+			`# gathered from pod specs
+gcr.io/foo/bar:1.0@` + string(inUseDigestA) + `
+
+localhost:5000/baz@` + string(inUseDigestB) + `
+gcr.io/foo/bar:1.0@` + string(inUseDigestA) + `
+`,
+			[]reg.InUseImage{
+				{Repository: "gcr.io/foo/bar", Tag: "1.0", Digest: inUseDigestA},
+				{Repository: "localhost:5000/baz", Digest: inUseDigestB},
+			},
+			false,
+		},
+		{
+			"Not pinned to a digest",
+			"gcr.io/foo/bar:1.0\n",
+			nil,
+			true,
+		},
+		{
+			"Invalid digest",
+			"gcr.io/foo/bar@sha256:abc\n",
+			nil,
+			true,
+		},
+		{
+			"No registry",
+			"bar@" + string(inUseDigestA) + "\n",
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.ParseInUseImages([]byte(test.input))
+		if test.expectedErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.Nil(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestUseInUseImages(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/foo", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/bar"}
+
+	mfests := []reg.Manifest{
+		{
+			Registries: []reg.RegistryContext{srcRC, dstRC},
+			Images: []reg.Image{
+				{
+					ImageName: "unused",
+					Dmap:      reg.DigestTags{inUseDigestA: {"1.0"}},
+				},
+			},
+			SrcRegistry: &srcRC,
+		},
+	}
+
+	images := []reg.InUseImage{
+		{Repository: "gcr.io/foo/a", Tag: "1.0", Digest: inUseDigestA},
+		{Repository: "gcr.io/foo/a", Tag: "stable", Digest: inUseDigestA},
+		{Repository: "gcr.io/foo/b/c", Digest: inUseDigestB},
+		{Repository: "docker.io/library/nginx", Tag: "latest", Digest: inUseDigestB},
+	}
+
+	ignored := reg.UseInUseImages(mfests, images)
+	require.Equal(t, []string{"docker.io/library/nginx:latest@" + string(inUseDigestB)}, ignored)
+	require.Equal(t, []reg.Image{
+		{
+			ImageName: "a",
+			Dmap:      reg.DigestTags{inUseDigestA: {"1.0", "stable"}},
+		},
+		{
+			ImageName: "b/c",
+			Dmap:      reg.DigestTags{inUseDigestB: {}},
+		},
+	}, mfests[0].Images)
+
+	mi := reg.MasterInventory{
+		srcRC.Name: reg.RegInvImage{
+			"a": reg.DigestTags{inUseDigestA: {"1.0"}},
+		},
+	}
+	require.Equal(
+		t,
+		[]string{"gcr.io/foo/b/c@" + string(inUseDigestB)},
+		reg.MissingInUseImages(mfests, images, mi),
+	)
+}
@@ -30,8 +30,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
-	"github.com/google/go-containerregistry/pkg/crane"
 	ggcrV1 "github.com/google/go-containerregistry/pkg/v1"
 	ggcrV1Google "github.com/google/go-containerregistry/pkg/v1/google"
 	ggcrV1Types "github.com/google/go-containerregistry/pkg/v1/types"
@@ -72,7 +70,10 @@ func MakeSyncContext(
 		RegistryContexts:  make([]RegistryContext, 0),
 		DigestMediaType:   make(DigestMediaType),
 		DigestImageSize:   make(DigestImageSize),
+		DigestUploaded:    make(DigestUploaded),
 		ParentDigest:      make(ParentDigest),
+		ListPlatforms:     make(ListPlatforms),
+		TransformedDigest: make(TransformedDigest),
 	}
 
 	registriesSeen := make(map[RegistryContext]interface{})
@@ -87,11 +88,25 @@ func MakeSyncContext(
 		sc.RegistryContexts = append(sc.RegistryContexts, r)
 	}
 
-	// Sort the list for determinism. We first sort it alphabetically, then sort
-	// it by length (reverse order, so that the longest registry names come
-	// first). This is so that we try to match the leading prefix against the
-	// longest registry names first. We sort alphabetically first because we
-	// want the final order to be deterministic.
+	sc.sortRegistryContexts()
+
+	// Populate access tokens for all registries listed in the manifest.
+	if useSvcAcc {
+		err := sc.PopulateTokens()
+		if err != nil {
+			return SyncContext{}, err
+		}
+	}
+
+	return sc, nil
+}
+
+// sortRegistryContexts sorts the registries for determinism. We first sort them
+// alphabetically, then sort them by length (reverse order, so that the longest
+// registry names come first). This is so that we try to match the leading
+// prefix against the longest registry names first. We sort alphabetically
+// first because we want the final order to be deterministic.
+func (sc *SyncContext) sortRegistryContexts() {
 	sort.Slice(
 		sc.RegistryContexts,
 		func(i, j int) bool {
@@ -105,16 +120,6 @@ func MakeSyncContext(
 			return len(sc.RegistryContexts[i].Name) > len(sc.RegistryContexts[j].Name)
 		},
 	)
-
-	// Populate access tokens for all registries listed in the manifest.
-	if useSvcAcc {
-		err := sc.PopulateTokens()
-		if err != nil {
-			return SyncContext{}, err
-		}
-	}
-
-	return sc, nil
 }
 
 // LogJSONSummary logs the SyncContext's Logs as a prettified JSON.
@@ -128,6 +133,39 @@ func (sc *SyncContext) LogJSONSummary() {
 	}
 }
 
+// LogTimings logs how long each stage of the promotion took.
+func (sc *SyncContext) LogTimings() {
+	logrus.Info(sc.Timings.String())
+}
+
+// String returns a human readable breakdown of the Timings. As images are
+// copied concurrently, the copy times per destination add up to more than the
+// total copy time.
+func (t *Timings) String() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, "Timings:")
+	fmt.Fprintf(&b, "  reading registries: %v\n", t.ReadRegistries)
+	fmt.Fprintf(&b, "  computing edges:    %v\n", t.ComputeEdges)
+	fmt.Fprintf(&b, "  copying:            %v\n", t.Copy)
+
+	destinations := make([]string, 0, len(t.CopyByDestination))
+	for registryName := range t.CopyByDestination {
+		destinations = append(destinations, string(registryName))
+	}
+	sort.Strings(destinations)
+
+	for _, destination := range destinations {
+		fmt.Fprintf(
+			&b,
+			"    %s: %v\n",
+			destination,
+			t.CopyByDestination[RegistryName(destination)],
+		)
+	}
+
+	return b.String()
+}
+
 // ParseManifestFromFile parses a Manifest from a filepath.
 func ParseManifestFromFile(filePath string) (Manifest, error) {
 	var mfest Manifest
@@ -170,13 +208,7 @@ func ParseThinManifestFromFile(filePath string) (Manifest, error) {
 		return empty, err
 	}
 
-	// Get directory name holding this thin manifest.
-	subProject := filepath.Base(filepath.Dir(filePath))
-	imagesPath := filepath.Join(filepath.Dir(filePath),
-		"../../images",
-		subProject,
-		"images.yaml")
-	images, err := ParseImagesFromFile(imagesPath)
+	images, err := ParseImagesFromFile(thinImagesPath(filePath))
 	if err != nil {
 		return empty, err
 	}
@@ -184,6 +216,7 @@ func ParseThinManifestFromFile(filePath string) (Manifest, error) {
 	mfest.Filepath = filePath
 	mfest.Images = images
 	mfest.Registries = thinManifest.Registries
+	mfest.DefaultServiceAccount = thinManifest.DefaultServiceAccount
 
 	err = mfest.Finalize()
 	if err != nil {
@@ -193,6 +226,17 @@ func ParseThinManifestFromFile(filePath string) (Manifest, error) {
 	return mfest, nil
 }
 
+// thinImagesPath returns the path of the images file which belongs to a thin
+// manifest file.
+func thinImagesPath(filePath string) string {
+	// Get directory name holding this thin manifest.
+	subProject := filepath.Base(filepath.Dir(filePath))
+	return filepath.Join(filepath.Dir(filePath),
+		"../../images",
+		subProject,
+		"images.yaml")
+}
+
 // ParseImagesFromFile parses an Images type from a file.
 func ParseImagesFromFile(filePath string) (Images, error) {
 	var images Images
@@ -211,10 +255,17 @@ func ParseImagesFromFile(filePath string) (Images, error) {
 	return images, nil
 }
 
-// Finalize finalizes a Manifest by populating extra fields.
+// Finalize finalizes a Manifest by populating extra fields. Registries without
+// a service account inherit the DefaultServiceAccount of the Manifest.
 // TODO: ST1016: methods on the same type should have the same receiver name
 // nolint: stylecheck
 func (m *Manifest) Finalize() error {
+	for i := range m.Registries {
+		if m.Registries[i].ServiceAccount == "" {
+			m.Registries[i].ServiceAccount = m.DefaultServiceAccount
+		}
+	}
+
 	// Perform semantic checks (beyond just YAML validation).
 	srcRegistry, err := GetSrcRegistry(m.Registries)
 	if err != nil {
@@ -230,17 +281,77 @@ func (m *Manifest) Finalize() error {
 // registry (there can only be 1 source registry).
 func ParseThinManifestsFromDir(
 	dir string,
+) ([]Manifest, error) {
+	return ParseThinManifestsFromDirConcurrently(dir, 0)
+}
+
+// ParseThinManifestsFromDirConcurrently is like ParseThinManifestsFromDir, but
+// parses the manifest files with the given number of threads (or the default
+// of 10 if not positive). The manifests are returned in the order of their
+// paths, and the errors of all files which cannot be parsed are reported
+// together, so that the result does not depend on the scheduling.
+func ParseThinManifestsFromDirConcurrently(
+	dir string,
+	threads int,
 ) ([]Manifest, error) {
 	mfests := make([]Manifest, 0)
 
+	paths, err := findThinManifests(dir)
+	if err != nil {
+		return mfests, err
+	}
+
+	// Parse the manifests concurrently; each result is stored in the slot of
+	// its path, which keeps the walk order.
+	parsed := make([]Manifest, len(paths))
+	errs := make([]error, len(paths))
+	forEachConcurrently(threads, len(paths), func(i int) {
+		parsed[i], errs[i] = ParseThinManifestFromFile(paths[i])
+	})
+
+	failed := make([]string, 0)
+	for i, path := range paths {
+		if errs[i] != nil {
+			logrus.Errorf("could not parse manifest file '%s'\n", path)
+			failed = append(failed, fmt.Sprintf("%s: %v", path, errs[i]))
+			continue
+		}
+
+		mfests = append(mfests, parsed[i])
+	}
+
+	switch len(failed) {
+	case 0:
+		return mfests, nil
+	case 1:
+		// Keep the error of a single broken manifest as it is.
+		for _, err := range errs {
+			if err != nil {
+				return mfests, err
+			}
+		}
+	}
+
+	return mfests, fmt.Errorf(
+		"could not parse %d manifest files:\n  %s",
+		len(failed),
+		strings.Join(failed, "\n  "),
+	)
+}
+
+// findThinManifests returns the paths of all thin manifest files within a
+// directory, after checking its structure.
+func findThinManifests(dir string) ([]string, error) {
 	// Check that the thin manifests dir follows a regular, predefined format.
 	// This is to ensure that there isn't any funny business going on around
 	// paths.
 	if err := ValidateThinManifestDirectoryStructure(dir); err != nil {
-		return mfests, err
+		return nil, err
 	}
 
-	var parseAsManifest filepath.WalkFunc = func(
+	paths := make([]string, 0)
+
+	var findManifest filepath.WalkFunc = func(
 		path string,
 		info os.FileInfo,
 		err error,
@@ -272,29 +383,22 @@ func ParseThinManifestsFromDir(
 				path)
 		}
 
-		mfest, errParse := ParseThinManifestFromFile(path)
-		if errParse != nil {
-			logrus.Errorf("could not parse manifest file '%s'\n", path)
-			return errParse
-		}
-
-		// Save successful parse result.
-		mfests = append(mfests, mfest)
+		paths = append(paths, path)
 
 		return nil
 	}
 
 	// Only look at manifests starting with the "manifests" subfolder (no need
 	// to walk any other toplevel subfolder).
-	if err := filepath.Walk(filepath.Join(dir, "manifests"), parseAsManifest); err != nil {
-		return mfests, err
+	if err := filepath.Walk(filepath.Join(dir, "manifests"), findManifest); err != nil {
+		return nil, err
 	}
 
-	if len(mfests) == 0 {
+	if len(paths) == 0 {
 		return nil, fmt.Errorf("no manifests found in dir: %s", dir)
 	}
 
-	return mfests, nil
+	return paths, nil
 }
 
 // ValidateThinManifestDirectoryStructure enforces a particular directory
@@ -386,9 +490,11 @@ func validateIsDirectory(dir string) error {
 }
 
 // ToPromotionEdges converts a list of manifests to a set of edges we want to
-// try promoting.
+// try promoting. An edge declared by several manifests is only kept once,
+// while edges promoting different digests to the same destination are an
+// error (see CheckOverlappingEdges).
 func ToPromotionEdges(mfests []Manifest) (map[PromotionEdge]interface{}, error) {
-	edges := make(map[PromotionEdge]interface{})
+	edges := newEdgeSet()
 	for _, mfest := range mfests {
 		for _, image := range mfest.Images {
 			for digest, tagArray := range image.Dmap {
@@ -405,7 +511,7 @@ func ToPromotionEdges(mfests []Manifest) (map[PromotionEdge]interface{}, error)
 								image.ImageName,
 								digest,
 								tag)
-							edges[edge] = nil
+							edges.add(edge, mfest.Filepath)
 						}
 					} else {
 						// If this digest does not have any associated tags, still create
@@ -418,14 +524,21 @@ func ToPromotionEdges(mfests []Manifest) (map[PromotionEdge]interface{}, error)
 							"",
 						)
 
-						edges[edge] = nil
+						edges.add(edge, mfest.Filepath)
 					}
 				}
 			}
 		}
 	}
 
-	return CheckOverlappingEdges(edges)
+	if edges.duplicates > 0 {
+		logrus.Infof(
+			"Deduplicated %d identical edges declared more than once in the manifests",
+			edges.duplicates,
+		)
+	}
+
+	return checkOverlappingEdges(edges.edges, edges.origins)
 }
 
 func mkPromotionEdge(
@@ -483,11 +596,12 @@ func (sc *SyncContext) GetPromotionCandidates(edges map[PromotionEdge]interface{
 			continue
 		}
 
-		sp, dp := edge.VertexProps(&sc.Inv)
+		sp, dp := sc.vertexProps(edge)
+		shown := sc.displayEdge(edge)
 
 		// If dst vertex exists, NOP.
 		if dp.PqinDigestMatch {
-			logrus.Infof("edge %v: skipping because it was already promoted (case 1)\n", edge)
+			sc.logSampledf(edge, "edge %v: skipping because it was already promoted (case 1)\n", shown)
 			continue
 		}
 
@@ -496,7 +610,7 @@ func (sc *SyncContext) GetPromotionCandidates(edges map[PromotionEdge]interface{
 		if edge.DstImageTag.Tag == "" && dp.DigestExists {
 			// Still, log a warning if the source is missing the image.
 			if !sp.DigestExists {
-				logrus.Errorf("edge %v: skipping %s/%s@%s because it was already promoted, but it is still _LOST_ (can't find it in src registry! please backfill it!)\n", edge, edge.SrcRegistry.Name, edge.SrcImageTag.ImageName, edge.Digest)
+				logrus.Errorf("edge %v: skipping %s/%s@%s because it was already promoted, but it is still _LOST_ (can't find it in src registry! please backfill it!)\n", shown, edge.SrcRegistry.Name, edge.SrcImageTag.ImageName, sc.displayDigest(edge.Digest))
 			}
 			continue
 		}
@@ -504,7 +618,7 @@ func (sc *SyncContext) GetPromotionCandidates(edges map[PromotionEdge]interface{
 		// If src vertex missing, LOST && NOP. We just need the digest to exist
 		// in src (we don't care if it points to the wrong tag).
 		if !sp.DigestExists {
-			logrus.Errorf("edge %v: skipping %s/%s@%s because it is _LOST_ (can't find it in src registry!)\n", edge, edge.SrcRegistry.Name, edge.SrcImageTag.ImageName, edge.Digest)
+			logrus.Errorf("edge %v: skipping %s/%s@%s because it is _LOST_ (can't find it in src registry!)\n", shown, edge.SrcRegistry.Name, edge.SrcImageTag.ImageName, sc.displayDigest(edge.Digest))
 			continue
 		}
 
@@ -514,10 +628,10 @@ func (sc *SyncContext) GetPromotionCandidates(edges map[PromotionEdge]interface{
 				// a different tag, then it's an error.
 				if dp.PqinDigestMatch {
 					// NOP (already promoted).
-					logrus.Infof("edge %v: skipping because it was already promoted (case 2)\n", edge)
+					sc.logSampledf(edge, "edge %v: skipping because it was already promoted (case 2)\n", shown)
 					continue
 				} else {
-					logrus.Errorf("edge %v: tag %s: ERROR: tag move detected from %s to %s", edge, edge.DstImageTag.Tag, edge.Digest, *sc.getDigestForTag(edge.DstImageTag.Tag))
+					logrus.Errorf("edge %v: tag %s: ERROR: tag move detected from %s to %s", shown, edge.DstImageTag.Tag, sc.displayDigest(edge.Digest), sc.displayDigest(*sc.getDigestForTag(edge.DstImageTag.Tag)))
 					clean = false
 					// We continue instead of returning early, because we want
 					// to see and log as many errors as possible as we go
@@ -526,16 +640,16 @@ func (sc *SyncContext) GetPromotionCandidates(edges map[PromotionEdge]interface{
 				}
 			} else {
 				// Pqin points to the wrong digest.
-				logrus.Warnf("edge %v: tag %s points to the wrong digest; moving\n", edge, dp.BadDigest)
+				logrus.Warnf("edge %v: tag %s points to the wrong digest; moving\n", shown, sc.displayDigest(dp.BadDigest))
 			}
 		} else {
 			if dp.DigestExists {
 				// Digest exists in dst, but the pqin we desire does not
 				// exist. Just add the pqin to this existing digest.
-				logrus.Infof("edge %v: digest %q already exists, but does not have the pqin we want (%s)\n", edge, edge.Digest, dp.OtherTags)
+				sc.logSampledf(edge, "edge %v: digest %q already exists, but does not have the pqin we want (%s)\n", shown, sc.displayDigest(edge.Digest), dp.OtherTags)
 			} else {
 				// Neither the digest nor the pqin exists in dst.
-				logrus.Infof("edge %v: regular promotion (neither digest nor pqin exists in dst)\n", edge)
+				sc.logSampledf(edge, "edge %v: regular promotion (neither digest nor pqin exists in dst)\n", shown)
 			}
 		}
 
@@ -573,6 +687,15 @@ func (sc *SyncContext) getDigestForTag(inputTag Tag) *Digest {
 // shouldn't own).
 func CheckOverlappingEdges(
 	edges map[PromotionEdge]interface{}) (map[PromotionEdge]interface{}, error) {
+	return checkOverlappingEdges(edges, nil)
+}
+
+// checkOverlappingEdges is CheckOverlappingEdges, naming the manifest files
+// declaring the conflicting edges (as listed in origins) in the error.
+func checkOverlappingEdges(
+	edges map[PromotionEdge]interface{},
+	origins map[PromotionEdge][]string,
+) (map[PromotionEdge]interface{}, error) {
 	// Build up a "promotionIntent". This will be checked below.
 	promotionIntent := make(map[string]map[Digest][]PromotionEdge)
 	checked := make(map[PromotionEdge]interface{})
@@ -603,8 +726,10 @@ func CheckOverlappingEdges(
 		}
 	}
 
-	// Review the promotionIntent to ensure that there are no issues.
-	overlapError := false
+	// Review the promotionIntent to ensure that there are no issues. All
+	// conflicts are collected (sorted, so that reruns report them in the
+	// same order) before failing.
+	conflicts := make([]string, 0)
 	emptyEdgeListError := false
 	for pqin, digestToEdges := range promotionIntent {
 		if len(digestToEdges) < 2 {
@@ -628,22 +753,20 @@ func CheckOverlappingEdges(
 				}
 			}
 		} else {
-			logrus.Errorf("multiple edges want to promote *different* images (digests) to the same destination endpoint %v:", pqin)
-			for digest, edgeList := range digestToEdges {
-				logrus.Errorf("  for digest %v:\n", digest)
-
-				// TODO(lint): rangeValCopy: each iteration copies 192 bytes (consider pointers or indexing)
-				//nolint:gocritic
-				for _, edge := range edgeList {
-					logrus.Errorf("%v\n", edge)
-				}
-			}
-			overlapError = true
+			conflicts = append(conflicts, describeOverlap(pqin, digestToEdges, origins))
 		}
 	}
 
-	if overlapError {
-		return nil, fmt.Errorf("overlapping edges detected")
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		for _, conflict := range conflicts {
+			logrus.Errorf("multiple edges want to promote *different* images (digests) to the same destination endpoint %s", conflict)
+		}
+
+		return nil, fmt.Errorf(
+			"overlapping edges detected:\n  %s",
+			strings.Join(conflicts, "\n  "),
+		)
 	}
 
 	if emptyEdgeListError {
@@ -749,6 +872,12 @@ func (m Manifest) Validate() error {
 
 func validateImages(images []Image) error {
 	for _, image := range images {
+		for _, environment := range image.Environments {
+			if err := ValidateEnvironment(environment); err != nil {
+				return err
+			}
+		}
+
 		for digest, tagSlice := range image.Dmap {
 			if err := ValidateDigest(digest); err != nil {
 				return err
@@ -846,6 +975,17 @@ func validateRequiredComponents(m Manifest) error {
 			)
 		}
 
+		if registry.Provider != "" && registry.Provider != ProviderTokenAuth {
+			errs = append(
+				errs,
+				fmt.Sprintf(
+					"registries: unknown provider %q for %s",
+					registry.Provider,
+					registry.Name,
+				),
+			)
+		}
+
 		// TODO(lint): SA4010: this result of append is never used, except maybe in other appends
 		//nolint:staticcheck
 		knownRegistries = append(knownRegistries, registry.Name)
@@ -975,6 +1115,8 @@ func (riid *RegInvImageDigest) PrettyValue() string {
 
 func getRegistryTagsWrapper(
 	req stream.ExternalRequest,
+	rc *stream.RetryClassifier,
+	budget *stream.RetryBudget,
 ) (*ggcrV1Google.Tags, error) {
 	var googleTags *ggcrV1Google.Tags
 
@@ -986,17 +1128,7 @@ func getRegistryTagsWrapper(
 		return retryErr
 	}
 
-	b := stream.BackoffDefault()
-	notify := func(err error, t time.Duration) {
-		logrus.Errorf("error: %v happened at time: %v", err, t)
-	}
-
-	err := backoff.RetryNotify(
-		retryFn,
-		b,
-		notify,
-	)
-	if err != nil {
+	if err := rc.RetryWithBudget(retryFn, budget); err != nil {
 		logrus.Error(err)
 		return nil, err
 	}
@@ -1028,6 +1160,8 @@ func getRegistryTagsFrom(req stream.ExternalRequest,
 
 func getGCRManifestListWrapper(
 	req stream.ExternalRequest,
+	rc *stream.RetryClassifier,
+	budget *stream.RetryBudget,
 ) (*ggcrV1.IndexManifest, error) {
 	var gcrManifestList *ggcrV1.IndexManifest
 
@@ -1039,17 +1173,7 @@ func getGCRManifestListWrapper(
 		return retryErr
 	}
 
-	b := stream.BackoffDefault()
-	notify := func(err error, t time.Duration) {
-		logrus.Errorf("error: %v happened at time: %v", err, t)
-	}
-
-	err := backoff.RetryNotify(
-		retryFn,
-		b,
-		notify,
-	)
-	if err != nil {
+	if err := rc.RetryWithBudget(retryFn, budget); err != nil {
 		logrus.Error(err)
 		return nil, err
 	}
@@ -1176,6 +1300,14 @@ func ParseContainerParts(s string) (
 		}
 	}
 
+	if IsArtifactRegistry(RegistryName(parts[0])) {
+		// LOCATION-docker.pkg.dev/PROJECT/REPOSITORY/IMAGE
+		if len(parts) <= 3 {
+			goto InvalidString
+		}
+		return strings.Join(parts[0:3], "/"), strings.Join(parts[3:], "/"), nil
+	}
+
 	switch parts[0] {
 	case "gcr.io", "asia.gcr.io", "eu.gcr.io", "us.gcr.io":
 		if len(parts) == 2 {
@@ -1198,6 +1330,18 @@ InvalidString:
 // access tokens.
 func (sc *SyncContext) PopulateTokens() error {
 	for _, rc := range sc.RegistryContexts {
+		// These registries do not accept GCR access tokens.
+		if rc.Provider == ProviderTokenAuth {
+			continue
+		}
+
+		if rc.ServiceAccount == "" {
+			return fmt.Errorf(
+				"no service account set for %s; set 'service-account' for the registry or 'defaultServiceAccount' for its manifest",
+				rc.Name,
+			)
+		}
+
 		token, err := gcloud.GetServiceAccountToken(rc.ServiceAccount, sc.UseServiceAccount)
 		if err != nil {
 			logrus.Errorf(
@@ -1217,14 +1361,17 @@ func (sc *SyncContext) PopulateTokens() error {
 
 // GetTokenKeyDomainRepoPath splits a string by '/'. It's OK to do this because
 // the RegistryName is already parsed against a Regex. (Maybe we should store
-// the repo path separately when we do the initial parse...).
+// the repo path separately when we do the initial parse...). The key is the
+// root repository, which for Artifact Registry includes the repository name
+// (e.g. "us-docker.pkg.dev/project/repository").
 func GetTokenKeyDomainRepoPath(registryName RegistryName) (key, domain, repoPath string) {
 	s := string(registryName)
 	i := strings.IndexByte(s, '/')
-	if strings.Count(s, "/") < 2 {
+	depth := rootRepoDepth(registryName)
+	if strings.Count(s, "/") < depth {
 		key = s
 	} else {
-		key = strings.Join(strings.Split(s, "/")[0:2], "/")
+		key = strings.Join(strings.Split(s, "/")[0:depth], "/")
 	}
 
 	// key, domain, repository path
@@ -1259,11 +1406,21 @@ func GetTokenKeyDomainRepoPath(registryName RegistryName) (key, domain, repoPath
 // NOTE: Repository names may overlap with image names. e.g., it may be in the
 // example above that there are images named gcr.io/google-containers/foo:2.0
 // and gcr.io/google-containers/foo/baz:2.0.
+//
+// Repositories which cannot be read are left out of sc.Inv and their images
+// ignored from promotion, but once sc.RetryBudget is exhausted, the inventory
+// is too incomplete to go on with, and an error matching
+// stream.ErrRetryBudgetExhausted is returned.
 func (sc *SyncContext) ReadRegistries(
 	toRead []RegistryContext,
 	recurse bool,
 	mkProducer func(*SyncContext, RegistryContext) stream.Producer,
-) {
+) error {
+	start := time.Now()
+	defer func() {
+		sc.Timings.ReadRegistries += time.Since(start)
+	}()
+
 	// Collect all images in sc.Inv (the src and dest registry names found in
 	// the manifest).
 	var populateRequests PopulateRequests = func(
@@ -1292,9 +1449,19 @@ func (sc *SyncContext) ReadRegistries(
 		for req := range reqs {
 			reqRes := RequestResult{Context: req}
 
+			rName := req.RequestParams.(RegistryContext).Name
+
 			// Now run the request (make network HTTP call with
-			// ExponentialBackoff()).
-			tagsStruct, err := getRegistryTagsWrapper(req)
+			// ExponentialBackoff()), unless the repository was already read
+			// before the snapshot was restarted.
+			tagsStruct, ok := sc.SnapshotCheckpointer.Lookup(rName)
+			var err error
+			if !ok {
+				tagsStruct, err = getRegistryTagsWrapper(req, sc.RetryClassifier, sc.RetryBudget)
+				if err == nil {
+					sc.SnapshotCheckpointer.Record(rName, tagsStruct)
+				}
+			}
 			if err != nil {
 				// Skip this request if it has unrecoverable errors (even after
 				// ExponentialBackoff).
@@ -1311,14 +1478,13 @@ func (sc *SyncContext) ReadRegistries(
 				// "foo" from a destination registry, do not bother trying to
 				// promote it for all registries
 				mutex.Lock()
-				sc.IgnoreFromPromotion(req.RequestParams.(RegistryContext).Name)
+				sc.IgnoreFromPromotion(rName)
 				mutex.Unlock()
 
 				continue
 			}
 
 			// Process the current repo.
-			rName := req.RequestParams.(RegistryContext).Name
 			digestTags := make(DigestTags)
 
 			for digest, mfestInfo := range tagsStruct.Manifests {
@@ -1356,6 +1522,15 @@ func (sc *SyncContext) ReadRegistries(
 				currentRepo[imageName] = digestTags
 
 				mutex.Lock()
+				// Store the upload times. The same digest may have been
+				// pushed to each registry at a different time.
+				if sc.DigestUploaded[rootReg] == nil {
+					sc.DigestUploaded[rootReg] = make(map[Digest]time.Time)
+				}
+				for digest, mfestInfo := range tagsStruct.Manifests {
+					sc.DigestUploaded[rootReg][Digest(digest)] = mfestInfo.Uploaded
+				}
+
 				existingRegEntry := sc.Inv[rootReg]
 				if len(existingRegEntry) == 0 {
 					sc.Inv[rootReg] = currentRepo
@@ -1383,6 +1558,8 @@ func (sc *SyncContext) ReadRegistries(
 						ServiceAccount: parentRC.ServiceAccount,
 						// Inherit the token as well.
 						Token: parentRC.Token,
+						// Inherit the way to authenticate.
+						Provider: parentRC.Provider,
 						// Don't need src, because we are just reading data
 						// (don't care if it's the source reg or not).
 					}
@@ -1407,7 +1584,13 @@ func (sc *SyncContext) ReadRegistries(
 
 	// TODO(lint): Check error return value
 	//nolint:errcheck
-	sc.ExecRequests(populateRequests, processRequest)
+	sc.execRequests(sc.EffectiveReadThreads(), populateRequests, processRequest)
+
+	if err := sc.RetryBudget.Err(); err != nil {
+		return fmt.Errorf("reading registries: %w", err)
+	}
+
+	return nil
 }
 
 // ReadGCRManifestLists reads all manifest lists and populates the ParentDigest
@@ -1419,6 +1602,11 @@ func (sc *SyncContext) ReadRegistries(
 func (sc *SyncContext) ReadGCRManifestLists(
 	mkProducer func(*SyncContext, *GCRManifestListContext) stream.Producer,
 ) {
+	start := time.Now()
+	defer func() {
+		sc.Timings.ReadRegistries += time.Since(start)
+	}()
+
 	// Collect all images in sc.Inv (the src and dest registry names found in
 	// the manifest).
 	var populateRequests PopulateRequests = func(
@@ -1478,7 +1666,7 @@ func (sc *SyncContext) ReadGCRManifestLists(
 
 			// Now run the request (make network HTTP call with
 			// ExponentialBackoff()).
-			gcrManifestList, err := getGCRManifestListWrapper(req)
+			gcrManifestList, err := getGCRManifestListWrapper(req, sc.RetryClassifier, sc.RetryBudget)
 			if err != nil {
 				// Skip this request if it has unrecoverable errors (even after
 				// ExponentialBackoff).
@@ -1496,12 +1684,22 @@ func (sc *SyncContext) ReadGCRManifestLists(
 			//nolint:errcheck
 			gmlc := req.RequestParams.(GCRManifestListContext)
 
+			platforms := make([]PlatformDigest, 0, len(gcrManifestList.Manifests))
 			for _, gManifest := range gcrManifestList.Manifests {
 				mutex.Lock()
 				sc.ParentDigest[Digest((gManifest.Digest.Algorithm)+":"+(gManifest.Digest.Hex))] = gmlc.Digest
 				mutex.Unlock()
+
+				platforms = append(platforms, PlatformDigest{
+					Platform: platformString(gManifest.Platform),
+					Digest:   Digest(gManifest.Digest.String()),
+				})
 			}
 
+			mutex.Lock()
+			sc.ListPlatforms[gmlc.Digest] = platforms
+			mutex.Unlock()
+
 			reqRes.Errors = Errors{}
 			requestResults <- reqRes
 		}
@@ -1509,7 +1707,7 @@ func (sc *SyncContext) ReadGCRManifestLists(
 
 	// TODO(lint): Check error return value
 	//nolint:errcheck
-	sc.ExecRequests(populateRequests, processRequest)
+	sc.execRequests(sc.EffectiveReadThreads(), populateRequests, processRequest)
 }
 
 // FilterByTag removes all images in RegInvImage that do not match the
@@ -1538,7 +1736,10 @@ func FilterByTag(rii RegInvImage, filterTag string) RegInvImage {
 }
 
 // RemoveChildDigestEntries removes all tagless images in RegInvImage that are
-// referenced by ManifestLists in the Registries.
+// referenced by ManifestLists in the Registries. Children which are tagged on
+// their own, and the manifest lists, are kept. The result is meant for review;
+// it is not sufficient for a byte-for-byte copy of the registry, as the
+// removed children are only reachable through their manifest lists.
 func (sc *SyncContext) RemoveChildDigestEntries(rii RegInvImage) RegInvImage {
 	filtered := make(RegInvImage)
 	for imageName, digestTags := range rii {
@@ -1562,6 +1763,87 @@ func (sc *SyncContext) RemoveChildDigestEntries(rii RegInvImage) RegInvImage {
 	return filtered
 }
 
+// ManifestListChildren returns, for every manifest list found in rii, the
+// sorted child digests referenced by it. It relies on ParentDigest, so
+// ReadGCRManifestLists() must have been called beforehand.
+func (sc *SyncContext) ManifestListChildren(rii RegInvImage) map[Digest][]Digest {
+	lists := make(map[Digest]interface{})
+	for _, digestTags := range rii {
+		for digest := range digestTags {
+			lists[digest] = nil
+		}
+	}
+
+	children := make(map[Digest][]Digest)
+	for child, parent := range sc.ParentDigest {
+		if _, ok := lists[parent]; !ok {
+			continue
+		}
+
+		children[parent] = append(children[parent], child)
+	}
+
+	for parent := range children {
+		sort.Slice(children[parent], func(i, j int) bool {
+			return children[parent][i] < children[parent][j]
+		})
+	}
+
+	return children
+}
+
+// ManifestListReports returns a report of every ManifestList found in rii,
+// sorted by image name and digest. It relies on ListPlatforms, so
+// ReadGCRManifestLists() must have been called beforehand.
+func (sc *SyncContext) ManifestListReports(rii RegInvImage) []ManifestListReport {
+	reports := make([]ManifestListReport, 0)
+	for imageName, digestTags := range rii {
+		for digest, tags := range digestTags {
+			platforms, ok := sc.ListPlatforms[digest]
+			if !ok {
+				continue
+			}
+
+			sortedTags := make(TagSlice, len(tags))
+			copy(sortedTags, tags)
+			sort.Slice(sortedTags, func(i, j int) bool {
+				return sortedTags[i] < sortedTags[j]
+			})
+
+			reports = append(reports, ManifestListReport{
+				Image:     imageName,
+				Tags:      sortedTags,
+				Digest:    digest,
+				Platforms: platforms,
+			})
+		}
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Image != reports[j].Image {
+			return reports[i].Image < reports[j].Image
+		}
+
+		return reports[i].Digest < reports[j].Digest
+	})
+
+	return reports
+}
+
+// platformString formats a platform as os/architecture[/variant].
+func platformString(p *ggcrV1.Platform) string {
+	if p == nil {
+		return "unknown"
+	}
+
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+
+	return s
+}
+
 // SplitByKnownRegistries splits a registry name into a RegistryName and
 // ImageName. The purpose of this function is to split a long image path into 2
 // pieces --- the repository and the image name. We can't just split by the last
@@ -1612,6 +1894,37 @@ func MkReadRepositoryCmdReal(
 
 	tokenKey, domain, repoPath := GetTokenKeyDomainRepoPath(rc.Name)
 
+	if rc.Provider == ProviderTokenAuth {
+		if sc.TokenAuth == nil {
+			logrus.Fatalf("no token-auth credentials for '%s'\n", rc.Name)
+		}
+
+		return &tokenAuthTagsProducer{
+			ta:       sc.TokenAuth,
+			domain:   domain,
+			repoPath: repoPath,
+		}
+	}
+
+	if sc.UseServiceAccount {
+		token, ok := sc.Tokens[RootRepo(tokenKey)]
+		if !ok {
+			logrus.Fatalf("access token for key '%s' not found\n", tokenKey)
+		}
+
+		rc.Token = token
+	}
+
+	// Only registries are listed recursively; their images are then read
+	// with the tags/list API below like any other repository.
+	if IsArtifactRegistry(rc.Name) && sc.isRegistryName(rc.Name) {
+		return &artifactRegistryListProducer{
+			transport:    sc.Transport,
+			token:        rc.Token,
+			registryName: rc.Name,
+		}
+	}
+
 	httpReq, err := http.NewRequest(
 		"GET",
 		fmt.Sprintf("https://%s/v2/%s/tags/list", domain, repoPath),
@@ -1625,18 +1938,13 @@ func MkReadRepositoryCmdReal(
 	}
 
 	if sc.UseServiceAccount {
-		token, ok := sc.Tokens[RootRepo(tokenKey)]
-		if !ok {
-			logrus.Fatalf("access token for key '%s' not found\n", tokenKey)
-		}
-
-		rc.Token = token
 		bearer := "Bearer " + string(rc.Token)
 
 		httpReq.Header.Add("Authorization", bearer)
 	}
 
 	sh.Req = httpReq
+	sh.Transport = sc.Transport
 	return &sh
 }
 
@@ -1676,6 +1984,27 @@ func MkReadManifestListCmdReal(sc *SyncContext, gmlc *GCRManifestListContext) st
 		)
 	}
 
+	if gmlc.RegistryContext.Provider == ProviderTokenAuth {
+		if sc.TokenAuth == nil {
+			logrus.Fatalf(
+				"no token-auth credentials for '%s'\n",
+				gmlc.RegistryContext.Name,
+			)
+		}
+
+		httpReq.Header.Set("Accept", string(ggcrV1Types.DockerManifestList))
+
+		return &tokenAuthHTTP{
+			ta:  sc.TokenAuth,
+			req: httpReq,
+			scope: fmt.Sprintf(
+				"repository:%s/%s:pull",
+				repoPath,
+				gmlc.ImageName,
+			),
+		}
+	}
+
 	if sc.UseServiceAccount {
 		token, ok := sc.Tokens[RootRepo(tokenKey)]
 		if !ok {
@@ -1687,20 +2016,61 @@ func MkReadManifestListCmdReal(sc *SyncContext, gmlc *GCRManifestListContext) st
 	}
 
 	sh.Req = httpReq
+	sh.Transport = sc.Transport
 	return &sh
 }
 
+// EffectiveReadThreads returns the number of workers used to read registries.
+func (sc *SyncContext) EffectiveReadThreads() int {
+	if sc.ReadThreads > 0 {
+		return sc.ReadThreads
+	}
+
+	return sc.Threads
+}
+
+// EffectiveWriteThreads returns the number of workers used to promote (or
+// delete) images.
+func (sc *SyncContext) EffectiveWriteThreads() int {
+	if sc.WriteThreads > 0 {
+		return sc.WriteThreads
+	}
+
+	return sc.Threads
+}
+
 // ExecRequests uses the Worker Pool pattern, where MaxConcurrentRequests
 // determines the number of workers to spawn.
 func (sc *SyncContext) ExecRequests(
 	populateRequests PopulateRequests,
 	processRequest ProcessRequest,
+) error {
+	return sc.execRequests(sc.Threads, populateRequests, processRequest)
+}
+
+// execRequests is ExecRequests with the given number of workers (or 10, if it
+// is not positive).
+func (sc *SyncContext) execRequests(
+	threads int,
+	populateRequests PopulateRequests,
+	processRequest ProcessRequest,
+) error {
+	return sc.execRampedRequests(threads, 0, populateRequests, processRequest)
+}
+
+// execRampedRequests is execRequests, but ramps the number of workers up from
+// 1 over the given duration (see RampUpWorkers).
+func (sc *SyncContext) execRampedRequests(
+	threads int,
+	ramp time.Duration,
+	populateRequests PopulateRequests,
+	processRequest ProcessRequest,
 ) error {
 	// Run requests.
 	MaxConcurrentRequests := 10
 
-	if sc.Threads > 0 {
-		MaxConcurrentRequests = sc.Threads
+	if threads > 0 {
+		MaxConcurrentRequests = threads
 	}
 
 	mutex := &sync.Mutex{}
@@ -1728,7 +2098,7 @@ func (sc *SyncContext) ExecRequests(
 					reqRes.Errors,
 				)
 			} else {
-				logrus.Infof("Request %v: OK\n", reqRes.Context.RequestParams)
+				sc.logSampledf(reqRes.Context.RequestParams, "Request %v: OK\n", reqRes.Context.RequestParams)
 			}
 
 			// Log the HTTP request to GCR.
@@ -1737,9 +2107,9 @@ func (sc *SyncContext) ExecRequests(
 			wg.Add(-1)
 		}
 	}()
-	for w := 0; w < MaxConcurrentRequests; w++ {
+	stopRamp := RampUpWorkers(MaxConcurrentRequests, ramp, func() {
 		go processRequest(sc, reqs, requestResults, wg, mutex)
-	}
+	})
 	// This can't be a goroutine, because the semaphore could be 0 by the time
 	// wg.Wait() is called. So we need to block against the initial "seeding" of
 	// workloads into the reqs channel.
@@ -1747,6 +2117,7 @@ func (sc *SyncContext) ExecRequests(
 
 	// Wait for all workers to finish draining the jobs.
 	wg.Wait()
+	stopRamp()
 	close(reqs)
 
 	// Close requestResults channel because no more new jobs are being created
@@ -1981,7 +2352,7 @@ func (sc *SyncContext) ValidateEdges(edges map[PromotionEdge]interface{}) error
 // check is limited to detecting attempted tag moves in the destination
 // registry.
 func (sc *SyncContext) ValidateEdge(edge *PromotionEdge) error {
-	_, dp := edge.VertexProps(&sc.Inv)
+	_, dp := sc.vertexProps(*edge)
 
 	if dp.PqinExists {
 		if !dp.DigestExists {
@@ -2083,21 +2454,56 @@ func (sc *SyncContext) FilterPromotionEdges(
 	edges map[PromotionEdge]interface{},
 	readRepos bool,
 ) (map[PromotionEdge]interface{}, bool) {
+	edges, ok := sc.readPromotionEdges(edges, readRepos)
+	if !ok {
+		return nil, false
+	}
+
+	start := time.Now()
+	defer func() {
+		sc.Timings.ComputeEdges += time.Since(start)
+	}()
+
+	return sc.GetPromotionCandidates(edges)
+}
+
+// readPromotionEdges reads the registries the edges need (unless readRepos is
+// false) and applies the source fallbacks, so that the edges can be compared
+// against the inventory.
+func (sc *SyncContext) readPromotionEdges(
+	edges map[PromotionEdge]interface{},
+	readRepos bool,
+) (map[PromotionEdge]interface{}, bool) {
+	perEdge := readRepos && sc.DestCheckMode == DestCheckPerEdge
+
 	if readRepos {
 		regs := getRegistriesToRead(edges)
+		if perEdge {
+			regs = getSourceRegistriesToRead(edges)
+		}
 		for _, reg := range regs {
 			logrus.Info("reading this reg:", reg)
 		}
 
-		sc.ReadRegistries(
+		if err := sc.ReadRegistries(
 			regs,
 			// Do not read these registries recursively, because we already know
 			// exactly which repositories to read (getRegistriesToRead()).
 			false,
-			MkReadRepositoryCmdReal)
+			MkReadRepositoryCmdReal); err != nil {
+			logrus.Error(err)
+			return nil, false
+		}
 	}
 
-	return sc.GetPromotionCandidates(edges)
+	if perEdge {
+		if err := sc.ReadDestinationsPerEdge(edges); err != nil {
+			logrus.Error(err)
+			return nil, false
+		}
+	}
+
+	return sc.applySourceFallbacks(edges, readRepos), true
 }
 
 // EdgesToRegInvImage takes the destination endpoints of all edges and converts
@@ -2148,6 +2554,33 @@ func EdgesToRegInvImage(
 	return rii
 }
 
+// describeOverlap describes the digests which multiple edges want to promote
+// to the destination pqin, along with the manifest files declaring them (or,
+// if origins does not know the edge, the source image it comes from).
+func describeOverlap(
+	pqin string,
+	digestToEdges map[Digest][]PromotionEdge,
+	origins map[PromotionEdge][]string,
+) string {
+	sources := make([]string, 0)
+	for digest, edgeList := range digestToEdges {
+		for i := range edgeList {
+			from := strings.Join(origins[edgeList[i]], ", ")
+			if from == "" {
+				from = ToPQIN(
+					edgeList[i].SrcRegistry.Name,
+					edgeList[i].SrcImageTag.ImageName,
+					edgeList[i].SrcImageTag.Tag,
+				)
+			}
+			sources = append(sources, fmt.Sprintf("%s (from %s)", digest, from))
+		}
+	}
+	sort.Strings(sources)
+
+	return fmt.Sprintf("%s: %s", pqin, strings.Join(sources, ", "))
+}
+
 // getRegistriesToRead collects all unique Docker repositories we want to read
 // from. This way, we don't have to read the entire Docker registry, but only
 // those paths that we are thinking of modifying.
@@ -2203,7 +2636,7 @@ func (sc *SyncContext) Promote(
 
 	logrus.Info("Pending promotions:")
 	for edge := range edges {
-		logrus.Infof("  %v\n", edge)
+		sc.logSampledf(edge, "  %v\n", sc.displayEdge(edge))
 	}
 
 	// If we detect that we have malformed edges, such as a tag move attempt, we
@@ -2212,6 +2645,13 @@ func (sc *SyncContext) Promote(
 		return err
 	}
 
+	// Tracks the first copy of each digest into a storage group.
+	crossMounts := make(map[crossMountKey]*crossMount)
+
+	if sc.Confirm {
+		sc.Batcher.expect(edges)
+	}
+
 	var (
 		populateRequests = MKPopulateRequestsForPromotionEdges(
 			edges,
@@ -2229,6 +2669,8 @@ func (sc *SyncContext) Promote(
 			for req := range reqs {
 				reqRes := RequestResult{Context: req}
 				errors := make(Errors, 0)
+				mountedFrom := ""
+				var shadow *ShadowOutcome
 				// If we're adding or moving (i.e., creating a new image or
 				// overwriting), do not bother shelling out to gcloud. Instead just
 				// use the gcrane.doCopy() method directly.
@@ -2236,6 +2678,46 @@ func (sc *SyncContext) Promote(
 				// TODO: Check result of type assertion
 				//nolint:errcheck
 				rpr := req.RequestParams.(PromotionRequest)
+				sc.Batcher.Acquire(rpr.RegistryDest)
+				start := time.Now()
+				sc.tracef(rpr, "starting request %s", strings.TrimSpace(rpr.PrettyValue()))
+
+				if sc.deadlineReached(start) {
+					sc.tracef(rpr, "skipping request: the deadline was reached")
+					sc.Batcher.Release(rpr.RegistryDest)
+					mutex.Lock()
+					sc.PromotionResults = append(sc.PromotionResults, PromotionResult{
+						Request:         rpr,
+						Skipped:         true,
+						DeadlineReached: true,
+					})
+					mutex.Unlock()
+
+					requestResults <- reqRes
+					continue
+				}
+
+				if err := sc.Breaker.Acquire(rpr.RegistryDest); err != nil {
+					logrus.Error(err)
+					sc.tracef(rpr, "skipping request: %v", err)
+					sc.Batcher.Release(rpr.RegistryDest)
+					errors = append(errors, Error{
+						Context: "circuit breaker",
+						Error:   err,
+					})
+
+					mutex.Lock()
+					sc.PromotionResults = append(sc.PromotionResults, PromotionResult{
+						Request: rpr,
+						Errors:  errors,
+					})
+					mutex.Unlock()
+
+					reqRes.Errors = errors
+					requestResults <- reqRes
+					continue
+				}
+
 				switch rpr.TagOp {
 				case Add:
 					srcVertex := ToFQIN(rpr.RegistrySrc, rpr.ImageNameSrc, rpr.Digest)
@@ -2258,15 +2740,123 @@ func (sc *SyncContext) Promote(
 						)
 					}
 
-					if err := crane.Copy(srcVertex, dstVertex); err != nil {
+					if err := sc.reverifySourceTag(rpr); err != nil {
 						logrus.Error(err)
 						errors = append(
 							errors,
 							Error{
-								Context: "running writeImage()",
+								Context: "re-verifying the source tag",
 								Error:   err,
 							},
 						)
+					} else if len(sc.ShadowCommand) > 0 {
+						sc.tracef(rpr, "running the shadow command for %s", dstVertex)
+						outcome := sc.RunShadowCommand(rpr, srcVertex, dstVertex)
+						shadow = &outcome
+						if outcome.Error != nil {
+							logrus.Error(outcome.Error)
+							errors = append(
+								errors,
+								Error{
+									Context: "running the shadow command",
+									Error:   outcome.Error,
+								},
+							)
+						}
+					} else if len(sc.TransformerPlugin) > 0 {
+						sc.tracef(rpr, "transforming %s to %s", srcVertex, dstVertex)
+						original, transformed, err := TransformAndPush(
+							sc.TransformerPlugin,
+							srcVertex,
+							dstVertex,
+							sc.copyOptions()...,
+						)
+						if err != nil {
+							logrus.Error(err)
+							errors = append(
+								errors,
+								Error{
+									Context: "running TransformAndPush()",
+									Error:   err,
+								},
+							)
+						} else {
+							mutex.Lock()
+							sc.TransformedDigest[original] = transformed
+							mutex.Unlock()
+						}
+					} else if sc.upgradesSchemaV1(rpr.Digest) {
+						sc.tracef(rpr, "upgrading %s to schema v2 at %s", srcVertex, dstVertex)
+						upgraded, err := UpgradeSchemaV1(
+							srcVertex,
+							dstVertex,
+							sc.LayerConcurrency,
+							sc.copyOptions()...,
+						)
+						if err != nil {
+							logrus.Error(err)
+							errors = append(
+								errors,
+								Error{
+									Context: "running UpgradeSchemaV1()",
+									Error:   err,
+								},
+							)
+						} else {
+							logrus.Infof(
+								"Upgraded schema v1 image %s to schema v2: %s -> %s",
+								dstVertex,
+								rpr.Digest,
+								upgraded,
+							)
+							mutex.Lock()
+							sc.TransformedDigest[rpr.Digest] = upgraded
+							mutex.Unlock()
+						}
+					} else if sc.convertsManifestList(rpr.Digest) {
+						sc.tracef(rpr, "converting manifest list %s to %s", srcVertex, dstVertex)
+						converted, err := ConvertManifestList(
+							srcVertex,
+							dstVertex,
+							sc.ManifestListMediaType,
+							sc.LayerConcurrency,
+							sc.copyOptions()...,
+						)
+						if err != nil {
+							logrus.Error(err)
+							errors = append(
+								errors,
+								Error{
+									Context: "running ConvertManifestList()",
+									Error:   err,
+								},
+							)
+						} else {
+							mutex.Lock()
+							sc.TransformedDigest[rpr.Digest] = converted
+							mutex.Unlock()
+						}
+					} else {
+						var err error
+						mountedFrom, err = sc.copyImageToStorageGroup(
+							crossMounts,
+							mutex,
+							rpr,
+							srcVertex,
+							dstVertex,
+						)
+						if err != nil {
+							logrus.Error(err)
+							errors = append(
+								errors,
+								Error{
+									Context: "running writeImage()",
+									Error:   err,
+								},
+							)
+						} else if mountedFrom != "" {
+							sc.logSampledf(rpr, "mounted %s from %s", dstVertex, mountedFrom)
+						}
 					}
 				case Move:
 					logrus.Infof("tag moves are no longer supported")
@@ -2274,6 +2864,34 @@ func (sc *SyncContext) Promote(
 					logrus.Infof("deletions are no longer supported")
 				}
 
+				sc.Breaker.Release(rpr.RegistryDest, len(errors) > 0)
+				sc.Batcher.Release(rpr.RegistryDest)
+				duration := time.Since(start)
+				for _, e := range errors {
+					sc.tracef(rpr, "%s: %v", e.Context, e.Error)
+				}
+				sc.tracef(rpr, "finished request in %s with %d errors", duration, len(errors))
+
+				mutex.Lock()
+				sc.PromotionResults = append(sc.PromotionResults, PromotionResult{
+					Request:     rpr,
+					Duration:    duration,
+					Errors:      errors,
+					MountedFrom: mountedFrom,
+					Shadow:      shadow,
+					BytesPerSecond: sc.copyThroughput(
+						rpr, duration, mountedFrom, shadow, errors,
+					),
+				})
+				sc.Timings.CopyByDestination[rpr.RegistryDest] += duration
+				mutex.Unlock()
+
+				// An edge copied by the shadow command is not promoted by the
+				// promoter, so a resumed run must not skip it.
+				if len(errors) == 0 && shadow == nil {
+					sc.Checkpointer.Record(rpr)
+				}
+
 				reqRes.Errors = errors
 				requestResults <- reqRes
 			}
@@ -2293,8 +2911,39 @@ func (sc *SyncContext) Promote(
 		processRequest = *customProcessRequest
 	}
 
+	if sc.Timings.CopyByDestination == nil {
+		sc.Timings.CopyByDestination = make(map[RegistryName]time.Duration)
+	}
+
 	sc.PrintCapturedRequests(&captured)
-	return sc.ExecRequests(populateRequests, processRequest)
+	start := time.Now()
+	err := sc.execRampedRequests(
+		sc.EffectiveWriteThreads(),
+		sc.ConcurrencyRamp,
+		populateRequests,
+		processRequest,
+	)
+	sc.Timings.Copy += time.Since(start)
+
+	// Write the final checkpoint even if some requests failed, so that a
+	// rerun does not repeat the successful ones.
+	if cpErr := sc.Checkpointer.Flush(); cpErr != nil {
+		logrus.Errorf("Unable to write checkpoint: %v", cpErr)
+	}
+
+	// Requests captured during a dry run were never executed.
+	for pr := range captured {
+		sc.PromotionResults = append(sc.PromotionResults, PromotionResult{
+			Request: pr,
+			Skipped: true,
+		})
+	}
+
+	if deadlineErr := sc.checkDeadline(err); deadlineErr != nil {
+		return deadlineErr
+	}
+
+	return err
 }
 
 // PrintCapturedRequests pretty-prints all given PromotionRequests.
@@ -2310,18 +2959,19 @@ func (sc *SyncContext) PrintCapturedRequests(capReqs *CapturedRequests) {
 	sort.Slice(prs, func(i, j int) bool {
 		return prs[i].PrettyValue() < prs[j].PrettyValue()
 	})
+	out := sc.out()
 	if len(prs) > 0 {
-		fmt.Println("")
-		fmt.Println("captured reqs summary:")
-		fmt.Println("")
+		fmt.Fprintln(out, "")
+		fmt.Fprintln(out, "captured reqs summary:")
+		fmt.Fprintln(out, "")
 		// TODO: Consider pointers or indexing (rangeValCopy)
 		// nolint: gocritic
 		for _, pr := range prs {
-			fmt.Printf("captured req: %v", pr.PrettyValue())
+			fmt.Fprintf(out, "captured req: %v", sc.displayRequest(pr))
 		}
-		fmt.Println("")
+		fmt.Fprintln(out, "")
 	} else {
-		fmt.Println("No requests captured.")
+		fmt.Fprintln(out, "No requests captured.")
 	}
 }
 
@@ -2389,6 +3039,7 @@ func MkRequestCapturer(captured *CapturedRequests) ProcessRequest {
 }
 
 // GarbageCollect deletes all images that are not referenced by Docker tags.
+// Images uploaded more recently than sc.PruneMinAge are kept.
 func (sc *SyncContext) GarbageCollect(
 	mfest Manifest,
 	mkProducer func(RegistryContext, ImageName, Digest) stream.Producer,
@@ -2410,6 +3061,17 @@ func (sc *SyncContext) GarbageCollect(
 						continue
 					}
 
+					if sc.uploadedWithin(registry.Name, digest, sc.PruneMinAge) {
+						logrus.Infof(
+							"skipping deletion of %s/%s@%s: uploaded less than %s ago",
+							registry.Name,
+							imageName,
+							digest,
+							sc.PruneMinAge,
+						)
+						continue
+					}
+
 					var req stream.ExternalRequest
 					req.StreamProducer = mkProducer(
 						registry,
@@ -2477,12 +3139,32 @@ func (sc *SyncContext) GarbageCollect(
 	}
 
 	sc.PrintCapturedRequests(&captured)
-	err := sc.ExecRequests(populateRequests, processRequest)
+	err := sc.execRequests(sc.EffectiveWriteThreads(), populateRequests, processRequest)
 	if err != nil {
 		logrus.Info(err)
 	}
 }
 
+// uploadedWithin returns true if the digest is known to have been uploaded to
+// the registry less than age ago. Digests without an upload time are never
+// considered recent.
+func (sc *SyncContext) uploadedWithin(
+	registryName RegistryName,
+	digest Digest,
+	age time.Duration,
+) bool {
+	if age <= 0 {
+		return false
+	}
+
+	uploaded, ok := sc.DigestUploaded[registryName][digest]
+	if !ok || uploaded.IsZero() {
+		return false
+	}
+
+	return time.Since(uploaded) < age
+}
+
 func supportedMediaType(v string) (ggcrV1Types.MediaType, error) {
 	switch ggcrV1Types.MediaType(v) {
 	case ggcrV1Types.DockerManifestList:
@@ -2500,6 +3182,8 @@ func supportedMediaType(v string) (ggcrV1Types.MediaType, error) {
 }
 
 // ClearRepository wipes out all Docker images from a registry! Use with caution.
+// Images uploaded more recently than sc.PruneMinAge are kept. It returns an
+// error listing every deletion which failed.
 //
 // TODO: Maybe split this into 2 parts, so that each part can be unit-tested
 // separately (deletion of manifest lists vs deletion of other media types).
@@ -2507,7 +3191,7 @@ func (sc *SyncContext) ClearRepository(
 	regName RegistryName,
 	mkProducer func(RegistryContext, ImageName, Digest) stream.Producer,
 	customProcessRequest *ProcessRequest,
-) {
+) error {
 	// deleteRequestsPopulator returns a PopulateRequests that
 	// varies by a predicate. Closure city!
 	deleteRequestsPopulator := func(
@@ -2535,6 +3219,16 @@ func (sc *SyncContext) ClearRepository(
 							fmt.Printf("skipping digest %s mediaType %s\n", digest, mediaType)
 							continue
 						}
+						if sc.uploadedWithin(registry.Name, digest, sc.PruneMinAge) {
+							logrus.Infof(
+								"skipping deletion of %s/%s@%s: uploaded less than %s ago",
+								registry.Name,
+								imageName,
+								digest,
+								sc.PruneMinAge,
+							)
+							continue
+						}
 						var req stream.ExternalRequest
 						req.StreamProducer = mkProducer(
 							registry,
@@ -2579,6 +3273,17 @@ func (sc *SyncContext) ClearRepository(
 			for _, json := range jsons {
 				logrus.Info("DELETED image:", json)
 			}
+
+			// TODO: Check result of type assertion
+			//nolint:errcheck
+			rpr := req.RequestParams.(PromotionRequest)
+			for i := range errors {
+				errors[i].Context = fmt.Sprintf(
+					"deleting %s: %s",
+					ToFQIN(rpr.RegistryDest, rpr.ImageNameDest, rpr.Digest),
+					errors[i].Context,
+				)
+			}
 			reqRes.Errors = errors
 			requestResults <- reqRes
 		}
@@ -2617,16 +3322,26 @@ func (sc *SyncContext) ClearRepository(
 	// Avoid the GCR error that complains if you try to delete an image which is
 	// referenced by a DockerManifestList, by first deleting all such manifest
 	// lists.
+	failedBefore := len(sc.Logs.Errors)
 	deleteManifestLists := deleteRequestsPopulator(isEqualTo(ggcrV1Types.DockerManifestList))
-	err := sc.ExecRequests(deleteManifestLists, processRequest)
-	if err != nil {
-		logrus.Info(err)
-	}
+	listsErr := sc.execRequests(sc.EffectiveWriteThreads(), deleteManifestLists, processRequest)
 	deleteOthers := deleteRequestsPopulator(isNotEqualTo(ggcrV1Types.DockerManifestList))
-	err = sc.ExecRequests(deleteOthers, processRequest)
-	if err != nil {
-		logrus.Info(err)
+	othersErr := sc.execRequests(sc.EffectiveWriteThreads(), deleteOthers, processRequest)
+	if listsErr == nil && othersErr == nil {
+		return nil
+	}
+
+	failures := make([]string, 0)
+	for _, e := range sc.Logs.Errors[failedBefore:] {
+		failures = append(failures, fmt.Sprintf("%s: %v", e.Context, e.Error))
 	}
+
+	return fmt.Errorf(
+		"%d errors clearing %s: %s",
+		len(failures),
+		regName,
+		strings.Join(failures, "; "),
+	)
 }
 
 // GetWriteCmd generates a gcloud command that is used to make modifications to
@@ -2644,6 +3359,18 @@ func GetWriteCmd(
 	var cmd []string
 
 	switch tp {
+	case Add:
+		// Only adds the tag to the digest already in the destination; no
+		// image data is copied.
+		cmd = []string{
+			"gcloud",
+			"--quiet",
+			"container",
+			"images",
+			"add-tag",
+			ToFQIN(dest.Name, destImageName, digest),
+			ToPQIN(dest.Name, destImageName, tag),
+		}
 	case Delete:
 		cmd = []string{
 			"gcloud",
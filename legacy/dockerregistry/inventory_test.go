@@ -23,6 +23,7 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	cr "github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/stretchr/testify/require"
@@ -296,6 +297,40 @@ func TestParseThinManifestsFromDir(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"Registries inherit the default service account",
+			"default-service-account",
+			[]reg.Manifest{
+				{
+					Registries: []reg.RegistryContext{
+						{
+							Name:           "gcr.io/foo-staging",
+							ServiceAccount: "sa@robot.com",
+							Src:            true,
+						},
+						{
+							Name:           "us.gcr.io/some-prod",
+							ServiceAccount: "prod@robot.com",
+						},
+						{
+							Name:           "eu.gcr.io/some-prod",
+							ServiceAccount: "sa@robot.com",
+						},
+					},
+					Images: []reg.Image{
+						{
+							ImageName: "foo-controller",
+							Dmap: reg.DigestTags{
+								"sha256:c3d310f4741b3642497da8826e0986db5e02afc9777a2b8e668c8e41034128c1": {"1.0"},
+							},
+						},
+					},
+					DefaultServiceAccount: "sa@robot.com",
+					Filepath:              "manifests/a/promoter-manifest.yaml",
+				},
+			},
+			nil,
+		},
 		{
 			"Multiple (with 'rebase')",
 			"multiple-rebases",
@@ -551,6 +586,11 @@ func TestValidateThinManifestsFromDir(t *testing.T) {
 		mfests, errParse := reg.ParseThinManifestsFromDir(fixtureDir)
 		require.Nil(t, errParse)
 
+		// Parsing concurrently yields the manifests in the same order.
+		serial, errParse := reg.ParseThinManifestsFromDirConcurrently(fixtureDir, 1)
+		require.Nil(t, errParse)
+		require.Equal(t, serial, mfests)
+
 		_, edgeErr := reg.ToPromotionEdges(mfests)
 		require.Nil(t, edgeErr)
 	}
@@ -572,7 +612,27 @@ func TestValidateThinManifestsFromDir(t *testing.T) {
 		{
 			"overlapping-destination-vertices-different-digest",
 			nil,
-			fmt.Errorf("overlapping edges detected"),
+			fmt.Errorf(
+				"overlapping edges detected:\n"+
+					"  asia.gcr.io/some-prod/foo-controller:1.0: sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa (from %[1]s), "+
+					"sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb (from %[2]s)\n"+
+					"  eu.gcr.io/some-prod/foo-controller:1.0: sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa (from %[1]s), "+
+					"sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb (from %[2]s)\n"+
+					"  us.gcr.io/some-prod/foo-controller:1.0: sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa (from %[1]s), "+
+					"sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb (from %[2]s)",
+				filepath.Join(pwd, "invalid/overlapping-destination-vertices-different-digest/manifests/a/promoter-manifest.yaml"),
+				filepath.Join(pwd, "invalid/overlapping-destination-vertices-different-digest/manifests/b/promoter-manifest.yaml"),
+			),
+		},
+		{
+			// Every broken manifest is reported, not only the first one.
+			"multiple-parse-failures",
+			fmt.Errorf(
+				"could not parse 2 manifest files:\n  %s: could not find source registry\n  %s: could not find source registry",
+				filepath.Join(pwd, "invalid/multiple-parse-failures/manifests/a/promoter-manifest.yaml"),
+				filepath.Join(pwd, "invalid/multiple-parse-failures/manifests/b/promoter-manifest.yaml"),
+			),
+			nil,
 		},
 		{
 			"malformed-directory-tree-structure",
@@ -931,6 +991,29 @@ func TestCommandGeneration(t *testing.T) {
 	}
 
 	require.Equal(t, expected, got)
+
+	got = reg.GetWriteCmd(
+		destRC,
+		false,
+		srcRegName,
+		srcImageName,
+		destImageName,
+		digest,
+		tag,
+		reg.Add,
+	)
+
+	expected = []string{
+		"gcloud",
+		"--quiet",
+		"container",
+		"images",
+		"add-tag",
+		reg.ToFQIN(destRC.Name, destImageName, digest),
+		reg.ToPQIN(destRC.Name, destImageName, tag),
+	}
+
+	require.Equal(t, expected, got)
 }
 
 // TestReadRegistries tests reading images and tags from a registry.
@@ -1150,6 +1233,7 @@ func TestReadRegistries(t *testing.T) {
 			Inv:              map[reg.RegistryName]reg.RegInvImage{fakeRegName: nil},
 			DigestMediaType:  make(reg.DigestMediaType),
 			DigestImageSize:  make(reg.DigestImageSize),
+			DigestUploaded:   make(reg.DigestUploaded),
 		}
 
 		// test is used to pin the "test" variable from the outer "range"
@@ -1240,6 +1324,7 @@ func TestReadGManifestLists(t *testing.T) {
 			},
 			DigestImageSize: make(reg.DigestImageSize),
 			ParentDigest:    make(reg.ParentDigest),
+			ListPlatforms:   make(reg.ListPlatforms),
 		}
 
 		// test is used to pin the "test" variable from the outer "range"
@@ -1260,6 +1345,151 @@ func TestReadGManifestLists(t *testing.T) {
 		got := sc.ParentDigest
 		expected := test.expectedOutput
 		require.Equal(t, expected, got)
+
+		require.Equal(
+			t,
+			reg.ListPlatforms{
+				"sha256:0000000000000000000000000000000000000000000000000000000000000000": {
+					{
+						Platform: "linux/amd64",
+						Digest:   "sha256:0bd88bcba94f800715fca33ffc4bde430646a7c797237313cbccdcdef9f80f2d",
+					},
+					{
+						Platform: "linux/s390x",
+						Digest:   "sha256:0ad4f92011b2fa5de88a6e6a2d8b97f38371246021c974760e5fc54b9b7069e5",
+					},
+				},
+			},
+			sc.ListPlatforms,
+		)
+	}
+}
+
+func TestManifestListChildren(t *testing.T) {
+	tests := []struct {
+		name     string
+		rii      reg.RegInvImage
+		parents  reg.ParentDigest
+		expected map[reg.Digest][]reg.Digest
+	}{
+		{
+			"No manifest lists",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0"},
+				},
+			},
+			reg.ParentDigest{},
+			map[reg.Digest][]reg.Digest{},
+		},
+		{
+			"Children of other images are ignored",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0"},
+					"sha256:aaa": {},
+					"sha256:bbb": {},
+				},
+			},
+			reg.ParentDigest{
+				"sha256:bbb": "sha256:000",
+				"sha256:aaa": "sha256:000",
+				"sha256:ccc": "sha256:111",
+			},
+			map[reg.Digest][]reg.Digest{
+				"sha256:000": {"sha256:aaa", "sha256:bbb"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{
+			ParentDigest: test.parents,
+		}
+
+		got := sc.ManifestListChildren(test.rii)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestManifestListReports(t *testing.T) {
+	tests := []struct {
+		name          string
+		rii           reg.RegInvImage
+		listPlatforms reg.ListPlatforms
+		expected      []reg.ManifestListReport
+	}{
+		{
+			"No manifest lists",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0"},
+				},
+			},
+			reg.ListPlatforms{},
+			[]reg.ManifestListReport{},
+		},
+		{
+			"Manifest lists are sorted by image and digest",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:bbb": {"2.0", "latest"},
+					"sha256:aaa": {"1.0"},
+					"sha256:001": {},
+				},
+				"bar": {
+					"sha256:ccc": {"3.0"},
+				},
+			},
+			reg.ListPlatforms{
+				"sha256:aaa": {
+					{Platform: "linux/amd64", Digest: "sha256:001"},
+				},
+				"sha256:bbb": {
+					{Platform: "linux/amd64", Digest: "sha256:002"},
+					{Platform: "linux/arm/v7", Digest: "sha256:003"},
+				},
+				"sha256:ccc": {
+					{Platform: "linux/s390x", Digest: "sha256:004"},
+				},
+			},
+			[]reg.ManifestListReport{
+				{
+					Image:  "bar",
+					Tags:   reg.TagSlice{"3.0"},
+					Digest: "sha256:ccc",
+					Platforms: []reg.PlatformDigest{
+						{Platform: "linux/s390x", Digest: "sha256:004"},
+					},
+				},
+				{
+					Image:  "foo",
+					Tags:   reg.TagSlice{"1.0"},
+					Digest: "sha256:aaa",
+					Platforms: []reg.PlatformDigest{
+						{Platform: "linux/amd64", Digest: "sha256:001"},
+					},
+				},
+				{
+					Image:  "foo",
+					Tags:   reg.TagSlice{"2.0", "latest"},
+					Digest: "sha256:bbb",
+					Platforms: []reg.PlatformDigest{
+						{Platform: "linux/amd64", Digest: "sha256:002"},
+						{Platform: "linux/arm/v7", Digest: "sha256:003"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{
+			ListPlatforms: test.listPlatforms,
+		}
+
+		got := sc.ManifestListReports(test.rii)
+		require.Equal(t, test.expected, got, test.name)
 	}
 }
 
@@ -1276,6 +1506,16 @@ func TestGetTokenKeyDomainRepoPath(t *testing.T) {
 			"gcr.io/foo/bar",
 			[3]string{"gcr.io/foo", "gcr.io", "foo/bar"},
 		},
+		{
+			"artifact registry",
+			"us-central1-docker.pkg.dev/foo/bar/baz",
+			[3]string{"us-central1-docker.pkg.dev/foo/bar", "us-central1-docker.pkg.dev", "foo/bar/baz"},
+		},
+		{
+			"artifact registry root repository",
+			"us-docker.pkg.dev/foo/bar",
+			[3]string{"us-docker.pkg.dev/foo/bar", "us-docker.pkg.dev", "foo/bar"},
+		},
 	}
 
 	for _, test := range tests {
@@ -1948,7 +2188,11 @@ func TestCheckOverlappingEdges(t *testing.T) {
 				}: nil,
 			},
 			nil,
-			fmt.Errorf("overlapping edges detected"),
+			fmt.Errorf(
+				"overlapping edges detected:\n" +
+					"  gcr.io/bar/a:0.9: sha256:000 (from gcr.io/foo/a:0.9), " +
+					"sha256:111 (from gcr.io/foo/b:0.9)",
+			),
 		},
 		{ // nolint: dupl
 			"Basic case (two tagless edges (different digests, same PQIN), no overlap)",
@@ -2910,7 +3154,7 @@ func TestValidateEdges(t *testing.T) {
 					},
 				},
 			},
-			fmt.Errorf("[edge &{{gcr.io/src robot  true} {a 1.0} sha256:222 {gcr.io/dst robot  false} {a 1.0}}: tag '1.0' in dest points to sha256:111, not sha256:222 (as per the manifest), but tag moves are not supported; skipping]"),
+			fmt.Errorf("[edge &{{gcr.io/src robot  true } {a 1.0} sha256:222 {gcr.io/dst robot  false } {a 1.0}}: tag '1.0' in dest points to sha256:111, not sha256:222 (as per the manifest), but tag moves are not supported; skipping]"),
 		},
 	}
 
@@ -3052,6 +3296,82 @@ func TestGarbageCollection(t *testing.T) {
 				}: 1,
 			},
 		},
+		{
+			"Recently uploaded images are not garbage collected",
+			reg.Manifest{
+				Registries: registries,
+				Images: []reg.Image{
+					{
+						ImageName: "a",
+						Dmap: reg.DigestTags{
+							"sha256:333": {"0.8"},
+						},
+					},
+				},
+			},
+			reg.SyncContext{
+				Inv: reg.MasterInventory{
+					"gcr.io/bar": {
+						"a": {
+							"sha256:111": nil,
+							"sha256:222": nil,
+							"sha256:333": {"0.8"},
+						},
+						"z": {
+							"sha256:000": nil,
+						},
+					},
+					"gcr.io/cat": {
+						"a": {
+							"sha256:111": nil,
+						},
+					},
+				},
+				DigestUploaded: reg.DigestUploaded{
+					"gcr.io/bar": {
+						"sha256:000": time.Now().Add(-48 * time.Hour),
+						"sha256:111": time.Now().Add(-time.Minute),
+						"sha256:333": time.Now().Add(-time.Minute),
+					},
+					"gcr.io/cat": {
+						"sha256:111": time.Now().Add(-48 * time.Hour),
+					},
+				},
+				PruneMinAge: time.Hour,
+			},
+			reg.CapturedRequests{
+				reg.PromotionRequest{
+					TagOp:          reg.Delete,
+					RegistrySrc:    srcRegName,
+					RegistryDest:   registries[2].Name,
+					ServiceAccount: registries[2].ServiceAccount,
+					ImageNameSrc:   "",
+					ImageNameDest:  "a",
+					Digest:         "sha256:111",
+					Tag:            "",
+				}: 1,
+				reg.PromotionRequest{
+					TagOp:          reg.Delete,
+					RegistrySrc:    srcRegName,
+					RegistryDest:   registries[1].Name,
+					ServiceAccount: registries[1].ServiceAccount,
+					ImageNameSrc:   "",
+					ImageNameDest:  "a",
+					Digest:         "sha256:222",
+					Tag:            "",
+				}: 1,
+				reg.PromotionRequest{
+					TagOp:          reg.Delete,
+					RegistrySrc:    srcRegName,
+					RegistryDest:   registries[1].Name,
+					ServiceAccount: registries[1].ServiceAccount,
+					ImageNameSrc:   "",
+					ImageNameDest:  "z",
+					Digest:         "sha256:000",
+					Tag:            "",
+				}: 1,
+			},
+		},
 	}
 
 	captured := make(reg.CapturedRequests)
@@ -3289,6 +3609,330 @@ func TestSnapshot(t *testing.T) {
 	}
 }
 
+func TestParseSnapshotYAML(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    reg.MasterInventory
+		expectedErr bool
+	}{
+		{
+			"Plain snapshot",
+			`- name: foo
+  dmap:
+    "sha256:000": ["1.0"]
+`,
+			reg.MasterInventory{
+				"": {
+					"foo": {
+						"sha256:000": {"1.0"},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Snapshot keyed by registry",
+			`gcr.io/foo:
+- name: foo
+  dmap:
+    "sha256:000": ["1.0"]
+gcr.io/bar:
+- name: bar
+  dmap:
+    "sha256:111": []
+`,
+			reg.MasterInventory{
+				"gcr.io/foo": {
+					"foo": {
+						"sha256:000": {"1.0"},
+					},
+				},
+				"gcr.io/bar": {
+					"bar": {
+						"sha256:111": {},
+					},
+				},
+			},
+			false,
+		},
+		{
+			"Malformed snapshot",
+			`foo: bar`,
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.ParseSnapshotYAML([]byte(test.input))
+		if test.expectedErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.Nil(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestCheckSnapshotDelta(t *testing.T) {
+	baseline := reg.RegInvImage{
+		"foo": {
+			"sha256:000": {"1.0"},
+			"sha256:111": {"1.1"},
+		},
+		"bar": {
+			"sha256:222": {},
+			"sha256:333": {"latest"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		current         reg.RegInvImage
+		maxDelta        float64
+		expectedAdded   int
+		expectedRemoved int
+		expectedErr     bool
+	}{
+		{
+			"No change",
+			baseline,
+			0,
+			0,
+			0,
+			false,
+		},
+		{
+			"Moved tags are not counted",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.1"},
+					"sha256:111": {"1.0"},
+				},
+				"bar": {
+					"sha256:222": {"latest"},
+					"sha256:333": {},
+				},
+			},
+			0,
+			0,
+			0,
+			false,
+		},
+		{
+			"One addition within threshold",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0"},
+					"sha256:111": {"1.1"},
+					"sha256:444": {"1.2"},
+				},
+				"bar": {
+					"sha256:222": {},
+					"sha256:333": {"latest"},
+				},
+			},
+			25,
+			1,
+			0,
+			false,
+		},
+		{
+			"Mass deletion exceeds threshold",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0"},
+				},
+			},
+			50,
+			0,
+			3,
+			true,
+		},
+		{
+			"Digest moved to another image counts twice",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0"},
+					"sha256:111": {"1.1"},
+				},
+				"baz": {
+					"sha256:222": {},
+					"sha256:333": {"latest"},
+				},
+			},
+			99,
+			2,
+			2,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		added, removed := reg.SnapshotDelta(baseline, test.current)
+		require.Equal(t, test.expectedAdded, added, test.name)
+		require.Equal(t, test.expectedRemoved, removed, test.name)
+
+		err := reg.CheckSnapshotDelta(baseline, test.current, test.maxDelta)
+		if test.expectedErr {
+			require.Error(t, err, test.name)
+		} else {
+			require.Nil(t, err, test.name)
+		}
+	}
+
+	require.Nil(t, reg.CheckSnapshotDelta(reg.RegInvImage{}, reg.RegInvImage{}, 0))
+	require.Error(t, reg.CheckSnapshotDelta(reg.RegInvImage{}, baseline, 100))
+}
+
+func TestSnapshotHash(t *testing.T) {
+	snapshot := reg.RegInvImage{
+		"foo": {
+			"sha256:000": {"1.0", "latest"},
+			"sha256:111": {"1.1"},
+		},
+		"bar": {
+			"sha256:222": {},
+		},
+	}
+
+	hash, err := reg.SnapshotHash(snapshot)
+	require.Nil(t, err)
+	require.Regexp(t, "^sha256:[0-9a-f]{64}$", hash)
+
+	tests := []struct {
+		name     string
+		snapshot reg.RegInvImage
+		same     bool
+	}{
+		{
+			"Tag order and duplicates do not matter",
+			reg.RegInvImage{
+				"bar": {
+					"sha256:222": {},
+				},
+				"foo": {
+					"sha256:111": {"1.1"},
+					"sha256:000": {"latest", "1.0", "latest"},
+				},
+			},
+			true,
+		},
+		{
+			"Moved tag",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0"},
+					"sha256:111": {"1.1", "latest"},
+				},
+				"bar": {
+					"sha256:222": {},
+				},
+			},
+			false,
+		},
+		{
+			"Digest moved to another image",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0", "latest"},
+					"sha256:111": {"1.1"},
+					"sha256:222": {},
+				},
+			},
+			false,
+		},
+		{
+			"Removed digest",
+			reg.RegInvImage{
+				"foo": {
+					"sha256:000": {"1.0", "latest"},
+				},
+				"bar": {
+					"sha256:222": {},
+				},
+			},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.SnapshotHash(test.snapshot)
+		require.Nil(t, err, test.name)
+		require.Equal(t, test.same, got == hash, test.name)
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := reg.RegInvImage{
+		"foo": {
+			"sha256:000": {"1.0", "latest"},
+			"sha256:111": {"1.1"},
+		},
+		"bar": {
+			"sha256:222": {"stable"},
+		},
+	}
+
+	after := reg.RegInvImage{
+		"foo": {
+			"sha256:000": {"1.0"},
+			"sha256:111": {"1.1"},
+			"sha256:333": {"1.2", "latest"},
+		},
+		"baz": {
+			"sha256:444": {},
+		},
+	}
+
+	changes := reg.DiffSnapshots(before, after)
+	require.Equal(t, []reg.SnapshotChange{
+		{Kind: reg.DigestRemoved, Image: "bar", Digest: "sha256:222"},
+		{Kind: reg.TagRemoved, Image: "bar", Tag: "stable", Digest: "sha256:222"},
+		{Kind: reg.DigestAdded, Image: "baz", Digest: "sha256:444"},
+		{Kind: reg.DigestAdded, Image: "foo", Digest: "sha256:333"},
+		{Kind: reg.TagAdded, Image: "foo", Tag: "1.2", Digest: "sha256:333"},
+		{
+			Kind:           reg.TagMoved,
+			Image:          "foo",
+			Tag:            "latest",
+			Digest:         "sha256:333",
+			PreviousDigest: "sha256:000",
+		},
+	}, changes)
+
+	require.Equal(
+		t,
+		"moved-tag foo:latest sha256:000 -> sha256:333",
+		changes[5].String(),
+	)
+	require.Empty(t, reg.DiffSnapshots(before, before))
+}
+
+func TestTimingsString(t *testing.T) {
+	timings := reg.Timings{
+		ReadRegistries: 2 * time.Second,
+		ComputeEdges:   5 * time.Millisecond,
+		Copy:           time.Minute,
+		CopyByDestination: map[reg.RegistryName]time.Duration{
+			"us.gcr.io/bar": 90 * time.Second,
+			"eu.gcr.io/bar": 80 * time.Second,
+		},
+	}
+
+	expected := `Timings:
+  reading registries: 2s
+  computing edges:    5ms
+  copying:            1m0s
+    eu.gcr.io/bar: 1m20s
+    us.gcr.io/bar: 1m30s
+`
+
+	require.Equal(t, expected, timings.String())
+}
+
 func TestParseContainerParts(t *testing.T) {
 	type ContainerParts struct {
 		registry   string
@@ -3332,6 +3976,22 @@ func TestParseContainerParts(t *testing.T) {
 				nil,
 			},
 		},
+		{
+			"us-central1-docker.pkg.dev/google-containers/images/foo",
+			ContainerParts{
+				"us-central1-docker.pkg.dev/google-containers/images",
+				"foo",
+				nil,
+			},
+		},
+		{
+			"europe-docker.pkg.dev/google-containers/images/foo/bar",
+			ContainerParts{
+				"europe-docker.pkg.dev/google-containers/images",
+				"foo/bar",
+				nil,
+			},
+		},
 	}
 
 	for _, test := range shouldBeValid {
@@ -3376,6 +4036,15 @@ func TestParseContainerParts(t *testing.T) {
 				fmt.Errorf("invalid string '%s'", "gcr.io/google-containers"),
 			},
 		},
+		{
+			// Artifact Registry repository (missing image name).
+			"us-docker.pkg.dev/google-containers/images",
+			ContainerParts{
+				"",
+				"",
+				fmt.Errorf("invalid string '%s'", "us-docker.pkg.dev/google-containers/images"),
+			},
+		},
 		{
 			// Naked vanity domain (missing image name).
 			"k8s.gcr.io",
@@ -3638,6 +4307,39 @@ func TestPopulateExtraFields(t *testing.T) {
 	}
 }
 
+func TestEffectiveThreads(t *testing.T) {
+	tests := []struct {
+		name          string
+		sc            reg.SyncContext
+		expectedRead  int
+		expectedWrite int
+	}{
+		{
+			"Threads only",
+			reg.SyncContext{Threads: 10},
+			10,
+			10,
+		},
+		{
+			"Read threads only",
+			reg.SyncContext{Threads: 10, ReadThreads: 50},
+			50,
+			10,
+		},
+		{
+			"Read and write threads",
+			reg.SyncContext{Threads: 10, ReadThreads: 50, WriteThreads: 2},
+			50,
+			2,
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expectedRead, test.sc.EffectiveReadThreads(), test.name)
+		require.Equal(t, test.expectedWrite, test.sc.EffectiveWriteThreads(), test.name)
+	}
+}
+
 // Helper functions.
 
 func bazelTestPath(testName string, paths ...string) string {
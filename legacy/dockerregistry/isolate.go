@@ -0,0 +1,286 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// unknownManifest names the origin of edges which do not come from any of the
+// manifests, which only happens if they were added after the origins were
+// recorded.
+const unknownManifest = "<unknown manifest>"
+
+// edgeDestination identifies an edge by what it writes, which unlike its
+// source is not changed by source fallbacks.
+type edgeDestination struct {
+	registry  RegistryName
+	imageName ImageName
+	tag       Tag
+	digest    Digest
+}
+
+// ManifestOrigins records which manifest(s) every promotion edge comes from.
+// A manifest is identified by its file path.
+type ManifestOrigins map[edgeDestination][]string
+
+// NewManifestOrigins computes the edges of each manifest on its own (with
+// their destination image names rewritten by the imageNameMap) and records
+// where they come from.
+func NewManifestOrigins(
+	mfests []Manifest,
+	imageNameMap ImageNameMap,
+) (ManifestOrigins, error) {
+	origins := make(ManifestOrigins)
+
+	for i := range mfests {
+		name := mfests[i].Filepath
+		if name == "" {
+			name = fmt.Sprintf("manifest #%d", i+1)
+		}
+
+		edges, err := ToPromotionEdges(mfests[i : i+1])
+		if err != nil {
+			return nil, fmt.Errorf("converting %s to edges: %w", name, err)
+		}
+
+		edges, err = imageNameMap.RewriteEdges(edges)
+		if err != nil {
+			return nil, fmt.Errorf("rewriting the edges of %s: %w", name, err)
+		}
+
+		for edge := range edges {
+			dst := edgeDestination{
+				registry:  edge.DstRegistry.Name,
+				imageName: edge.DstImageTag.ImageName,
+				tag:       edge.DstImageTag.Tag,
+				digest:    edge.Digest,
+			}
+			origins[dst] = append(origins[dst], name)
+		}
+	}
+
+	return origins, nil
+}
+
+// Of returns the manifests the edge comes from.
+func (o ManifestOrigins) Of(edge PromotionEdge) []string {
+	return o.of(edgeDestination{
+		registry:  edge.DstRegistry.Name,
+		imageName: edge.DstImageTag.ImageName,
+		tag:       edge.DstImageTag.Tag,
+		digest:    edge.Digest,
+	})
+}
+
+func (o ManifestOrigins) of(dst edgeDestination) []string {
+	if names, ok := o[dst]; ok {
+		return names
+	}
+
+	return []string{unknownManifest}
+}
+
+// group splits the edges by the manifest they come from. An edge coming from
+// several manifests is part of each of their groups.
+func (o ManifestOrigins) group(
+	edges map[PromotionEdge]interface{},
+) map[string]map[PromotionEdge]interface{} {
+	groups := make(map[string]map[PromotionEdge]interface{})
+
+	for edge := range edges {
+		for _, name := range o.Of(edge) {
+			if groups[name] == nil {
+				groups[name] = make(map[PromotionEdge]interface{})
+			}
+			groups[name][edge] = nil
+		}
+	}
+
+	return groups
+}
+
+// ManifestFailures maps each manifest whose edges were not attempted to the
+// reason why.
+type ManifestFailures map[string]string
+
+// Names returns the failed manifests in order.
+func (f ManifestFailures) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// FilterPromotionEdgesIsolated is like FilterPromotionEdges, except that the
+// edges of each manifest are checked on their own. A manifest whose edges
+// would make FilterPromotionEdges (or the tag move check of Promote) fail is
+// recorded in the returned ManifestFailures and all its edges are dropped,
+// including those which other manifests share, while the edges of every
+// other manifest are kept. It returns false only if the registries could not
+// be read.
+func (sc *SyncContext) FilterPromotionEdgesIsolated(
+	edges map[PromotionEdge]interface{},
+	readRepos bool,
+	origins ManifestOrigins,
+) (map[PromotionEdge]interface{}, ManifestFailures, bool) {
+	edges, ok := sc.readPromotionEdges(edges, readRepos)
+	if !ok {
+		return nil, nil, false
+	}
+
+	start := time.Now()
+	defer func() {
+		sc.Timings.ComputeEdges += time.Since(start)
+	}()
+
+	groups := origins.group(edges)
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := make(ManifestFailures)
+	candidates := make(map[PromotionEdge]interface{})
+	for _, name := range names {
+		toPromote, clean := sc.GetPromotionCandidates(groups[name])
+		if !clean {
+			failures[name] = "edge filtering failed"
+			continue
+		}
+
+		if err := sc.ValidateEdges(toPromote); err != nil {
+			failures[name] = err.Error()
+			continue
+		}
+
+		for edge := range toPromote {
+			candidates[edge] = nil
+		}
+	}
+
+	for edge := range candidates {
+		for _, name := range origins.Of(edge) {
+			if _, failed := failures[name]; failed {
+				delete(candidates, edge)
+				break
+			}
+		}
+	}
+
+	return candidates, failures, true
+}
+
+type manifestOutcome struct {
+	promoted  int
+	skipped   int
+	unstarted int
+	failed    []string
+}
+
+// ReportResultsByManifest writes the outcome of every promotion request,
+// grouped by the manifest(s) the request comes from. Manifests whose edges
+// were not attempted at all are listed with the reason why.
+func (sc *SyncContext) ReportResultsByManifest(
+	origins ManifestOrigins,
+	failures ManifestFailures,
+) {
+	outcomes := make(map[string]*manifestOutcome)
+	for name := range failures {
+		outcomes[name] = &manifestOutcome{}
+	}
+
+	for _, result := range sc.PromotionResults {
+		req := result.Request
+		names := origins.of(edgeDestination{
+			registry:  req.RegistryDest,
+			imageName: req.ImageNameDest,
+			tag:       req.Tag,
+			digest:    req.Digest,
+		})
+
+		for _, name := range names {
+			outcome := outcomes[name]
+			if outcome == nil {
+				outcome = &manifestOutcome{}
+				outcomes[name] = outcome
+			}
+
+			switch {
+			case len(result.Errors) > 0:
+				messages := make([]string, 0, len(result.Errors))
+				for _, e := range result.Errors {
+					messages = append(messages, fmt.Sprintf("%s: %v", e.Context, e.Error))
+				}
+
+				outcome.failed = append(outcome.failed, fmt.Sprintf(
+					"%s@%s: %s",
+					ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag),
+					sc.displayDigest(req.Digest),
+					strings.Join(messages, "; "),
+				))
+			case result.DeadlineReached:
+				outcome.unstarted++
+			case result.Skipped:
+				outcome.skipped++
+			default:
+				outcome.promoted++
+			}
+		}
+	}
+
+	names := make([]string, 0, len(outcomes))
+	for name := range outcomes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := sc.out()
+	fmt.Fprintln(w, "Results by manifest:")
+	for _, name := range names {
+		if reason, failed := failures[name]; failed {
+			fmt.Fprintf(w, "  %s: not attempted: %s\n", name, reason)
+			continue
+		}
+
+		outcome := outcomes[name]
+		fmt.Fprintf(
+			w,
+			"  %s: %d promoted, %d dry run, %d failed",
+			name,
+			outcome.promoted,
+			outcome.skipped,
+			len(outcome.failed),
+		)
+		if outcome.unstarted > 0 {
+			fmt.Fprintf(w, ", %d not started (deadline reached)", outcome.unstarted)
+		}
+		fmt.Fprintln(w)
+
+		sort.Strings(outcome.failed)
+		for _, failed := range outcome.failed {
+			fmt.Fprintf(w, "    FAILED %s\n", failed)
+		}
+	}
+}
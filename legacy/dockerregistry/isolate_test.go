@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestFilterPromotionEdgesIsolated(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/staging", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/prod"}
+
+	mfests := []reg.Manifest{
+		{
+			Filepath:    "manifests/a/promoter-manifest.yaml",
+			Registries:  []reg.RegistryContext{srcRC, dstRC},
+			SrcRegistry: &srcRC,
+			Images: []reg.Image{
+				{
+					ImageName: "foo",
+					Dmap:      reg.DigestTags{"sha256:111": {"1.0"}},
+				},
+			},
+		},
+		{
+			Filepath:    "manifests/b/promoter-manifest.yaml",
+			Registries:  []reg.RegistryContext{srcRC, dstRC},
+			SrcRegistry: &srcRC,
+			Images: []reg.Image{
+				{
+					ImageName: "bar",
+					Dmap: reg.DigestTags{
+						"sha256:333": {"1.0"},
+						"sha256:444": {"2.0"},
+					},
+				},
+			},
+		},
+	}
+
+	edges, err := reg.ToPromotionEdges(mfests)
+	require.Nil(t, err)
+
+	origins, err := reg.NewManifestOrigins(mfests, nil)
+	require.Nil(t, err)
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			"gcr.io/staging": {
+				"foo": {"sha256:111": {"1.0"}},
+				"bar": {
+					"sha256:333": {"1.0"},
+					"sha256:444": {"2.0"},
+				},
+			},
+			// foo:1.0 already points to another digest, which would be a
+			// tag move.
+			"gcr.io/prod": {
+				"foo": {"sha256:222": {"1.0"}},
+			},
+		},
+	}
+
+	candidates, failures, ok := sc.FilterPromotionEdgesIsolated(
+		edges,
+		false,
+		origins,
+	)
+	require.True(t, ok)
+	require.Equal(
+		t,
+		[]string{"manifests/a/promoter-manifest.yaml"},
+		failures.Names(),
+	)
+	require.Len(t, candidates, 2)
+	for edge := range candidates {
+		require.Equal(t, reg.ImageName("bar"), edge.DstImageTag.ImageName)
+		require.Equal(
+			t,
+			[]string{"manifests/b/promoter-manifest.yaml"},
+			origins.Of(edge),
+		)
+	}
+
+	// Without isolation, the tag move fails the whole promotion.
+	toPromote, clean := sc.FilterPromotionEdges(edges, false)
+	require.True(t, clean)
+	require.Error(t, sc.ValidateEdges(toPromote))
+
+	var out bytes.Buffer
+	sc.Out = &out
+	sc.PromotionResults = []reg.PromotionResult{
+		{
+			Request: reg.PromotionRequest{
+				RegistryDest:  "gcr.io/prod",
+				ImageNameDest: "bar",
+				Digest:        "sha256:333",
+				Tag:           "1.0",
+			},
+		},
+		{
+			Request: reg.PromotionRequest{
+				RegistryDest:  "gcr.io/prod",
+				ImageNameDest: "bar",
+				Digest:        "sha256:444",
+				Tag:           "2.0",
+			},
+			Errors: reg.Errors{
+				{Context: "copy", Error: errors.New("denied")},
+			},
+		},
+	}
+	sc.ReportResultsByManifest(origins, failures)
+
+	require.Equal(
+		t,
+		`Results by manifest:
+  manifests/a/promoter-manifest.yaml: not attempted: `+failures["manifests/a/promoter-manifest.yaml"]+`
+  manifests/b/promoter-manifest.yaml: 1 promoted, 0 dry run, 1 failed
+    FAILED gcr.io/prod/bar:2.0@sha256:444: copy: denied
+`,
+		out.String(),
+	)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// WriteJUnit writes the given promotion results to w as a JUnit XML report.
+// Every promotion request becomes a testcase, which is named after the
+// destination image and whose classname is derived from the destination
+// registry. Failed requests are reported as failures and requests which were
+// only captured during a dry run as skipped.
+func WriteJUnit(w io.Writer, results []PromotionResult) error {
+	sorted := make([]PromotionResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Request.PrettyValue() < sorted[j].Request.PrettyValue()
+	})
+
+	suite := junitTestSuite{
+		Name:      "promotion",
+		Tests:     len(sorted),
+		TestCases: make([]junitTestCase, 0, len(sorted)),
+	}
+
+	var total time.Duration
+	for i := range sorted {
+		result := &sorted[i]
+		total += result.Duration
+
+		testCase := junitTestCase{
+			Name:      junitTestCaseName(&result.Request),
+			Classname: strings.ReplaceAll(string(result.Request.RegistryDest), "/", "."),
+			Time:      junitSeconds(result.Duration),
+		}
+
+		switch {
+		case len(result.Errors) > 0:
+			suite.Failures++
+
+			messages := make([]string, 0, len(result.Errors))
+			for _, e := range result.Errors {
+				messages = append(messages, fmt.Sprintf("%s: %v", e.Context, e.Error))
+			}
+
+			testCase.Failure = &junitFailure{
+				Message:  messages[0],
+				Contents: strings.Join(messages, "\n"),
+			}
+		case result.DeadlineReached:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{Message: "deadline reached"}
+		case result.Skipped:
+			suite.Skipped++
+			testCase.Skipped = &junitSkipped{Message: "dry run"}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	suite.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return fmt.Errorf("encoding JUnit report: %w", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitTestCaseName returns the destination image of a promotion request,
+// including its tag (if any) and digest.
+func junitTestCaseName(pr *PromotionRequest) string {
+	if pr.Tag == "" {
+		return ToFQIN(pr.RegistryDest, pr.ImageNameDest, pr.Digest)
+	}
+
+	return fmt.Sprintf(
+		"%s@%s",
+		ToPQIN(pr.RegistryDest, pr.ImageNameDest, pr.Tag),
+		pr.Digest,
+	)
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	results := []reg.PromotionResult{
+		{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/foo",
+				RegistryDest:  "us.gcr.io/bar",
+				ImageNameSrc:  "b",
+				ImageNameDest: "b",
+				Digest:        "sha256:111",
+			},
+			Duration: 250 * time.Millisecond,
+			Errors: reg.Errors{
+				{
+					Context: "running writeImage()",
+					Error:   errors.New("unauthorized <denied>"),
+				},
+			},
+		},
+		{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/foo",
+				RegistryDest:  "us.gcr.io/bar",
+				ImageNameSrc:  "a",
+				ImageNameDest: "a",
+				Digest:        "sha256:000",
+				Tag:           "1.0",
+			},
+			Duration: 1500 * time.Millisecond,
+		},
+		{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/foo",
+				RegistryDest:  "eu.gcr.io/bar",
+				ImageNameSrc:  "c",
+				ImageNameDest: "c",
+				Digest:        "sha256:222",
+				Tag:           "2.0",
+			},
+			Skipped: true,
+		},
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="promotion" tests="3" failures="1" skipped="1" time="1.750">
+    <testcase name="us.gcr.io/bar/a:1.0@sha256:000" classname="us.gcr.io.bar" time="1.500"></testcase>
+    <testcase name="us.gcr.io/bar/b@sha256:111" classname="us.gcr.io.bar" time="0.250">
+      <failure message="running writeImage(): unauthorized &lt;denied&gt;">running writeImage(): unauthorized &lt;denied&gt;</failure>
+    </testcase>
+    <testcase name="eu.gcr.io/bar/c:2.0@sha256:222" classname="eu.gcr.io.bar" time="0.000">
+      <skipped message="dry run"></skipped>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+
+	var b bytes.Buffer
+	require.Nil(t, reg.WriteJUnit(&b, results))
+	require.Equal(t, expected, b.String())
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LintSeverity ranks the findings of LintManifests.
+type LintSeverity string
+
+const (
+	// LintWarning marks a finding which is most likely unintended.
+	LintWarning LintSeverity = "warning"
+	// LintError marks a finding which makes the promotion misbehave or
+	// fail.
+	LintError LintSeverity = "error"
+)
+
+// LintFinding is a best practice violated by a manifest.
+type LintFinding struct {
+	Manifest string
+	Category string
+	Severity LintSeverity
+	Message  string
+}
+
+// String renders the finding as a single line.
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s: [%s] %s: %s", f.Manifest, f.Severity, f.Category, f.Message)
+}
+
+// LintManifests checks the (already valid) manifests against best practices
+// which the schema does not enforce: floating 'latest' tags, registries
+// without a service account, destinations nested in other destinations and
+// images listed more than once. Missing service accounts are only errors if
+// authRequired is true.
+func LintManifests(mfests []Manifest, authRequired bool) []LintFinding {
+	findings := make([]LintFinding, 0)
+
+	for i := range mfests {
+		mfest := &mfests[i]
+		add := func(category string, severity LintSeverity, format string, args ...interface{}) {
+			findings = append(findings, LintFinding{
+				Manifest: mfest.Filepath,
+				Category: category,
+				Severity: severity,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		seen := make(map[ImageName]interface{})
+		for _, image := range mfest.Images {
+			if _, ok := seen[image.ImageName]; ok {
+				add("duplicate-image", LintError, "image %s is listed more than once", image.ImageName)
+			}
+			seen[image.ImageName] = nil
+
+			for digest, tags := range image.Dmap {
+				for _, tag := range tags {
+					if tag == latestTag {
+						add(
+							"floating-tag",
+							LintWarning,
+							"image %s@%s is tagged %q, which does not pin a release",
+							image.ImageName,
+							digest,
+							tag,
+						)
+					}
+				}
+			}
+		}
+
+		severity := LintWarning
+		if authRequired {
+			severity = LintError
+		}
+
+		for _, registry := range mfest.Registries {
+			if registry.ServiceAccount == "" && registry.Provider != ProviderTokenAuth {
+				add("missing-service-account", severity, "registry %s has no service account", registry.Name)
+			}
+
+			if registry.Src {
+				continue
+			}
+
+			for _, other := range mfest.Registries {
+				if other.Src || other.Name == registry.Name {
+					continue
+				}
+
+				if strings.HasPrefix(string(registry.Name), string(other.Name)+"/") {
+					add(
+						"overlapping-destinations",
+						LintWarning,
+						"destination %s is nested in destination %s",
+						registry.Name,
+						other.Name,
+					)
+				}
+			}
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].String() < findings[j].String()
+	})
+
+	return findings
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestLintManifests(t *testing.T) {
+	const digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+	clean := reg.Manifest{
+		Filepath: "clean.yaml",
+		Registries: []reg.RegistryContext{
+			{Name: "gcr.io/src", ServiceAccount: "sa@src", Src: true},
+			{Name: "gcr.io/foo", ServiceAccount: "sa@foo"},
+			{Name: "gcr.io/bar", ServiceAccount: "sa@bar"},
+		},
+		Images: []reg.Image{
+			{ImageName: "a", Dmap: reg.DigestTags{digest: {"1.0"}}},
+		},
+	}
+
+	messy := reg.Manifest{
+		Filepath: "messy.yaml",
+		Registries: []reg.RegistryContext{
+			{Name: "gcr.io/src", ServiceAccount: "sa@src", Src: true},
+			{Name: "gcr.io/foo", ServiceAccount: "sa@foo"},
+			{Name: "gcr.io/foo/mirror"},
+		},
+		Images: []reg.Image{
+			{ImageName: "a", Dmap: reg.DigestTags{digest: {"1.0", "latest"}}},
+			{ImageName: "a", Dmap: reg.DigestTags{digest: {"1.0"}}},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		mfests       []reg.Manifest
+		authRequired bool
+		expected     []reg.LintFinding
+	}{
+		{
+			"Clean manifest",
+			[]reg.Manifest{clean},
+			true,
+			[]reg.LintFinding{},
+		},
+		{
+			"Everything wrong",
+			[]reg.Manifest{clean, messy},
+			false,
+			[]reg.LintFinding{
+				{
+					Manifest: "messy.yaml",
+					Category: "duplicate-image",
+					Severity: reg.LintError,
+					Message:  "image a is listed more than once",
+				},
+				{
+					Manifest: "messy.yaml",
+					Category: "floating-tag",
+					Severity: reg.LintWarning,
+					Message:  `image a@` + digest + ` is tagged "latest", which does not pin a release`,
+				},
+				{
+					Manifest: "messy.yaml",
+					Category: "missing-service-account",
+					Severity: reg.LintWarning,
+					Message:  "registry gcr.io/foo/mirror has no service account",
+				},
+				{
+					Manifest: "messy.yaml",
+					Category: "overlapping-destinations",
+					Severity: reg.LintWarning,
+					Message:  "destination gcr.io/foo/mirror is nested in destination gcr.io/foo",
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(
+			t,
+			test.expected,
+			reg.LintManifests(test.mfests, test.authRequired),
+			test.name,
+		)
+	}
+}
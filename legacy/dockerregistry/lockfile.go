@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
+)
+
+// Lockfile pins the digests which may be promoted for every destination
+// image, similar to the lockfile of a package manager. It is meant to be
+// committed next to the manifests, so that any digest change has to go
+// through review as an explicit lockfile update.
+type Lockfile map[ImageName][]Digest
+
+// LockfileFromEdges records the digest of every edge in a Lockfile.
+func LockfileFromEdges(edges map[PromotionEdge]interface{}) Lockfile {
+	digests := make(map[ImageName]map[Digest]interface{})
+	for edge := range edges {
+		name := edge.DstImageTag.ImageName
+		if digests[name] == nil {
+			digests[name] = make(map[Digest]interface{})
+		}
+		digests[name][edge.Digest] = nil
+	}
+
+	lock := make(Lockfile)
+	for name, set := range digests {
+		for digest := range set {
+			lock[name] = append(lock[name], digest)
+		}
+		sort.Slice(lock[name], func(i, j int) bool {
+			return lock[name][i] < lock[name][j]
+		})
+	}
+
+	return lock
+}
+
+// ParseLockfileFromFile parses a Lockfile from a filepath.
+func ParseLockfileFromFile(filePath string) (Lockfile, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var lock Lockfile
+	if err := yaml.UnmarshalStrict(b, &lock); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// WriteToFile writes the Lockfile to a filepath, replacing any previous
+// version of it.
+func (l Lockfile) WriteToFile(filePath string) error {
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	return upload.Write(filePath, b)
+}
+
+// Check returns an error listing every destination image and digest of the
+// edges which is not pinned by the Lockfile.
+func (l Lockfile) Check(edges map[PromotionEdge]interface{}) error {
+	pinned := make(map[ImageName]map[Digest]interface{})
+	for name, digests := range l {
+		pinned[name] = make(map[Digest]interface{})
+		for _, digest := range digests {
+			pinned[name][digest] = nil
+		}
+	}
+
+	violations := make(map[string]interface{})
+	for edge := range edges {
+		name := edge.DstImageTag.ImageName
+		if _, ok := pinned[name][edge.Digest]; !ok {
+			violations[fmt.Sprintf("%s@%s", name, edge.Digest)] = nil
+		}
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	unlocked := make([]string, 0, len(violations))
+	for violation := range violations {
+		unlocked = append(unlocked, violation)
+	}
+	sort.Strings(unlocked)
+
+	return fmt.Errorf(
+		"%d digests are not pinned by the lockfile (update it to promote them): %s",
+		len(unlocked),
+		strings.Join(unlocked, ", "),
+	)
+}
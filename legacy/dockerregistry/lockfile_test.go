@@ -0,0 +1,98 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestLockfile(t *testing.T) {
+	mkEdge := func(image reg.ImageName, tag reg.Tag, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src", Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/dst"},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	locked := map[reg.PromotionEdge]interface{}{
+		mkEdge("foo", "1.0", "sha256:222"): nil,
+		mkEdge("foo", "1.1", "sha256:111"): nil,
+		mkEdge("bar", "1.0", "sha256:333"): nil,
+	}
+
+	lock := reg.LockfileFromEdges(locked)
+	require.Equal(t, reg.Lockfile{
+		"foo": {"sha256:111", "sha256:222"},
+		"bar": {"sha256:333"},
+	}, lock)
+
+	path := filepath.Join(t.TempDir(), "promoter.lock")
+	require.Nil(t, lock.WriteToFile(path))
+
+	got, err := reg.ParseLockfileFromFile(path)
+	require.Nil(t, err)
+	require.Equal(t, lock, got)
+
+	tests := []struct {
+		name     string
+		edges    map[reg.PromotionEdge]interface{}
+		expected string
+	}{
+		{
+			name:  "pinned digests",
+			edges: locked,
+		},
+		{
+			name: "new tag of a pinned digest",
+			edges: map[reg.PromotionEdge]interface{}{
+				mkEdge("foo", "latest", "sha256:222"): nil,
+			},
+		},
+		{
+			name: "changed and new digests",
+			edges: map[reg.PromotionEdge]interface{}{
+				mkEdge("foo", "1.0", "sha256:444"): nil,
+				mkEdge("bar", "1.0", "sha256:111"): nil,
+				mkEdge("baz", "1.0", "sha256:555"): nil,
+				mkEdge("baz", "1.1", "sha256:555"): nil,
+			},
+			expected: "3 digests are not pinned by the lockfile (update it to promote them): bar@sha256:111, baz@sha256:555, foo@sha256:444",
+		},
+	}
+
+	for _, test := range tests {
+		err := got.Check(test.edges)
+		if test.expected == "" {
+			require.Nil(t, err, test.name)
+			continue
+		}
+
+		require.Error(t, err, test.name)
+		require.Equal(t, test.expected, err.Error(), test.name)
+	}
+
+	_, err = reg.ParseLockfileFromFile(filepath.Join(t.TempDir(), "missing.lock"))
+	require.Error(t, err)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logSampled reports whether the routine logs about subject, a PromotionEdge
+// or a PromotionRequest, are emitted given sc.LogSampleRate. The decision only
+// depends on the destination and digest, so the logs of an edge and of the
+// request promoting it are either all kept or all dropped. With
+// sc.TraceEdge, only the traced edges are logged instead. Other subjects are
+// always logged.
+func (sc *SyncContext) logSampled(subject interface{}) bool {
+	if sc.TraceEdge != nil {
+		switch subject.(type) {
+		case PromotionEdge, PromotionRequest:
+			return sc.traced(subject)
+		default:
+			return true
+		}
+	}
+
+	if sc.LogSampleRate <= 1 {
+		return true
+	}
+
+	var key string
+	switch s := subject.(type) {
+	case PromotionEdge:
+		key = ToPQIN(s.DstRegistry.Name, s.DstImageTag.ImageName, s.DstImageTag.Tag) +
+			"@" + string(s.Digest)
+	case PromotionRequest:
+		key = ToPQIN(s.RegistryDest, s.ImageNameDest, s.Tag) +
+			"@" + string(s.Digest)
+	default:
+		return true
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	return binary.BigEndian.Uint32(sum[:4])%uint32(sc.LogSampleRate) == 0
+}
+
+// logSampledf logs routine, per-edge progress about subject at info level,
+// if it is sampled (see logSampled). Warnings, errors and summaries must be
+// logged directly, so that they are never dropped.
+func (sc *SyncContext) logSampledf(subject interface{}, format string, args ...interface{}) {
+	if sc.logSampled(subject) {
+		logrus.Infof(format, args...)
+	}
+}
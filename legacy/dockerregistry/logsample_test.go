@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestLogSampleRate(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/foo", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/bar"}
+
+	edges := make(map[reg.PromotionEdge]interface{})
+	digests := reg.DigestTags{}
+	for i := 0; i < 100; i++ {
+		digest := reg.Digest(fmt.Sprintf("sha256:%03d", i))
+		tag := reg.Tag(fmt.Sprintf("1.%d", i))
+		digests[digest] = reg.TagSlice{tag}
+		edges[reg.PromotionEdge{
+			SrcRegistry: srcRC,
+			SrcImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+			Digest:      digest,
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+		}] = nil
+	}
+
+	// candidateLogs returns the messages (without their timestamps) logged
+	// for the edges to promote.
+	candidateLogs := func(rate int) map[string]bool {
+		out := logrus.StandardLogger().Out
+		defer logrus.SetOutput(out)
+
+		var buf bytes.Buffer
+		logrus.SetOutput(&buf)
+
+		sc := reg.SyncContext{
+			Inv: reg.MasterInventory{
+				srcRC.Name: reg.RegInvImage{"a": digests},
+				dstRC.Name: reg.RegInvImage{},
+			},
+			LogSampleRate: rate,
+		}
+
+		candidates, clean := sc.GetPromotionCandidates(edges)
+		require.True(t, clean)
+		require.Len(t, candidates, len(edges))
+
+		logged := make(map[string]bool)
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if i := strings.Index(line, "msg="); i >= 0 &&
+				strings.Contains(line, "regular promotion") {
+				logged[line[i:]] = true
+			}
+		}
+
+		return logged
+	}
+
+	require.Len(t, candidateLogs(1), len(edges))
+
+	sampled := candidateLogs(10)
+	require.NotEmpty(t, sampled)
+	require.Less(t, len(sampled), len(edges)/2)
+
+	// The same edges are logged every time.
+	require.Equal(t, sampled, candidateLogs(10))
+}
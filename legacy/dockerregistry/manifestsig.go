@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestSignatureSuffix is appended to the path of a manifest file to get
+// the path of its detached signature, as written by
+// 'cosign sign-blob --output-signature'.
+const ManifestSignatureSuffix = ".sig"
+
+// VerifyFile checks the detached signature of the file at filePath, which is
+// read from filePath+ManifestSignatureSuffix and holds the base64 encoded
+// signature of the file's contents.
+func (v *SignatureVerifier) VerifyFile(filePath string) error {
+	payload, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	return v.VerifyDetached(payload, filePath+ManifestSignatureSuffix)
+}
+
+// VerifyDetached checks that the file at sigPath holds the base64 encoded
+// signature of payload. Callers which go on to parse the payload should pass
+// the very bytes they parse, instead of reading the file again.
+func (v *SignatureVerifier) VerifyDetached(payload []byte, sigPath string) error {
+	encoded, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("reading signature: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(
+		strings.TrimSpace(string(encoded)),
+	)
+	if err != nil {
+		return fmt.Errorf("malformed signature in %s: %w", sigPath, err)
+	}
+
+	return v.verifySignature(payload, signature)
+}
+
+// VerifyManifestFiles checks the detached signature of every file, so that
+// they can be trusted before they are parsed. All files failing verification
+// are reported together, by name.
+func VerifyManifestFiles(verifier *SignatureVerifier, filePaths []string) error {
+	failed := make([]string, 0)
+	for _, filePath := range filePaths {
+		if err := verifier.VerifyFile(filePath); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", filePath, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf(
+			"%d manifest files failed signature verification: %s",
+			len(failed),
+			strings.Join(failed, ", "),
+		)
+	}
+
+	return nil
+}
+
+// ThinManifestFiles returns every file of the thin manifest directory dir
+// which determines what is promoted: the promoter manifests and the image
+// lists they refer to.
+func ThinManifestFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(
+		filepath.Join(dir, "manifests", "*", "promoter-manifest.yaml"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := filepath.Glob(
+		filepath.Join(dir, "images", "*", "images.yaml"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	files = append(files, images...)
+	sort.Strings(files)
+
+	return files, nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestVerifyManifestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest-signatures-")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.Nil(t, err)
+
+	verifier, err := reg.NewSignatureVerifier(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKey,
+	}))
+	require.Nil(t, err)
+
+	// writeManifest writes a manifest file and, if key is not nil, its
+	// detached signature.
+	writeManifest := func(name string, key *ecdsa.PrivateKey) string {
+		filePath := filepath.Join(dir, name)
+		contents := []byte("registries: []\nimages: []\n")
+		require.Nil(t, ioutil.WriteFile(filePath, contents, 0o644))
+
+		if key != nil {
+			sum := sha256.Sum256(contents)
+			signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+			require.Nil(t, err)
+			require.Nil(t, ioutil.WriteFile(
+				filePath+reg.ManifestSignatureSuffix,
+				[]byte(base64.StdEncoding.EncodeToString(signature)+"\n"),
+				0o644,
+			))
+		}
+
+		return filePath
+	}
+
+	signed := writeManifest("signed.yaml", key)
+	unsigned := writeManifest("unsigned.yaml", nil)
+	wrongKey := writeManifest("wrong-key.yaml", otherKey)
+	tampered := writeManifest("tampered.yaml", key)
+	require.Nil(t, ioutil.WriteFile(tampered, []byte("registries: []\n"), 0o644))
+
+	require.Nil(t, reg.VerifyManifestFiles(verifier, []string{signed}))
+
+	err = reg.VerifyManifestFiles(
+		verifier,
+		[]string{signed, unsigned, wrongKey, tampered},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "3 manifest files failed signature verification")
+	require.Contains(t, err.Error(), unsigned)
+	require.Contains(t, err.Error(), wrongKey)
+	require.Contains(t, err.Error(), tampered)
+	require.NotContains(t, err.Error(), signed+" ")
+}
+
+func TestThinManifestFiles(t *testing.T) {
+	dir := bazelTestPath("TestParseThinManifestsFromDir", "multiple-rebases")
+
+	files, err := reg.ThinManifestFiles(dir)
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "images", "a", "images.yaml"),
+		filepath.Join(dir, "images", "b", "images.yaml"),
+		filepath.Join(dir, "manifests", "a", "promoter-manifest.yaml"),
+		filepath.Join(dir, "manifests", "b", "promoter-manifest.yaml"),
+	}, files)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WriteMarkdownSummary writes the given promotion results to w as a summary
+// in GitHub-flavored markdown, for attaching to release notes or pull
+// requests. It contains the number of promoted, failed and skipped requests,
+// the duration of the promotion and the version of the promoter, followed by
+// a table of all requests and the errors of the failed ones.
+func WriteMarkdownSummary(
+	w io.Writer,
+	results []PromotionResult,
+	duration time.Duration,
+	toolVersion string,
+) error {
+	sorted := make([]PromotionResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Request.PrettyValue() < sorted[j].Request.PrettyValue()
+	})
+
+	var promoted, failed, skipped int
+	for i := range sorted {
+		switch markdownStatus(&sorted[i]) {
+		case "failed":
+			failed++
+		case "promoted":
+			promoted++
+		default:
+			skipped++
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("## Image promotion summary\n\n")
+	b.WriteString("| Requests | Promoted | Failed | Skipped | Duration | Version |\n")
+	b.WriteString("| ---: | ---: | ---: | ---: | --- | --- |\n")
+	fmt.Fprintf(
+		&b,
+		"| %d | %d | %d | %d | %s | %s |\n",
+		len(sorted),
+		promoted,
+		failed,
+		skipped,
+		duration.Round(time.Millisecond),
+		markdownCode(toolVersion),
+	)
+
+	if len(sorted) > 0 {
+		b.WriteString("\n| Image | Tag | Source digest | Destination | Status |\n")
+		b.WriteString("| --- | --- | --- | --- | --- |\n")
+	}
+	for i := range sorted {
+		pr := &sorted[i].Request
+		fmt.Fprintf(
+			&b,
+			"| %s | %s | %s | %s | %s |\n",
+			markdownCode(string(pr.ImageNameSrc)),
+			markdownCode(string(pr.Tag)),
+			markdownCode(string(pr.Digest)),
+			markdownCode(junitTestCaseName(pr)),
+			markdownStatus(&sorted[i]),
+		)
+	}
+
+	if failed > 0 {
+		b.WriteString("\n### Failures\n\n")
+	}
+	for i := range sorted {
+		result := &sorted[i]
+		if len(result.Errors) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "- %s\n", markdownCode(junitTestCaseName(&result.Request)))
+		for _, e := range result.Errors {
+			fmt.Fprintf(
+				&b,
+				"  - %s: %s\n",
+				markdownEscape(e.Context),
+				markdownEscape(fmt.Sprint(e.Error)),
+			)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownStatus returns the status of a promotion request shown in the
+// markdown summary.
+func markdownStatus(result *PromotionResult) string {
+	switch {
+	case len(result.Errors) > 0:
+		return "failed"
+	case result.DeadlineReached:
+		return "skipped (deadline reached)"
+	case result.Skipped:
+		return "skipped (dry run)"
+	default:
+		return "promoted"
+	}
+}
+
+// markdownCode renders s as inline code, which is left empty for an empty s.
+// Image references contain no backticks or pipes, so they need no escaping.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return "`" + s + "`"
+}
+
+// markdownEscape makes free text, such as error messages, safe to put in a
+// markdown list or table.
+func markdownEscape(s string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		"|", "\\|",
+		"*", "\\*",
+		"_", "\\_",
+		"`", "\\`",
+		"<", "&lt;",
+		"\r", "",
+		"\n", " ",
+	).Replace(s)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestWriteMarkdownSummary(t *testing.T) {
+	results := []reg.PromotionResult{
+		{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/foo",
+				RegistryDest:  "us.gcr.io/bar",
+				ImageNameSrc:  "b",
+				ImageNameDest: "b",
+				Digest:        "sha256:111",
+			},
+			Errors: reg.Errors{
+				{
+					Context: "running writeImage()",
+					Error:   errors.New("unauthorized | <denied>"),
+				},
+			},
+		},
+		{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/foo",
+				RegistryDest:  "us.gcr.io/bar",
+				ImageNameSrc:  "a",
+				ImageNameDest: "a",
+				Digest:        "sha256:000",
+				Tag:           "1.0",
+			},
+		},
+		{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   "gcr.io/foo",
+				RegistryDest:  "eu.gcr.io/bar",
+				ImageNameSrc:  "c",
+				ImageNameDest: "c",
+				Digest:        "sha256:222",
+				Tag:           "2.0",
+			},
+			Skipped:         true,
+			DeadlineReached: true,
+		},
+	}
+
+	expected := "## Image promotion summary\n" +
+		"\n" +
+		"| Requests | Promoted | Failed | Skipped | Duration | Version |\n" +
+		"| ---: | ---: | ---: | ---: | --- | --- |\n" +
+		"| 3 | 1 | 1 | 1 | 1m2.5s | `v3.4.0` |\n" +
+		"\n" +
+		"| Image | Tag | Source digest | Destination | Status |\n" +
+		"| --- | --- | --- | --- | --- |\n" +
+		"| `a` | `1.0` | `sha256:000` | `us.gcr.io/bar/a:1.0@sha256:000` | promoted |\n" +
+		"| `b` |  | `sha256:111` | `us.gcr.io/bar/b@sha256:111` | failed |\n" +
+		"| `c` | `2.0` | `sha256:222` | `eu.gcr.io/bar/c:2.0@sha256:222` | skipped (deadline reached) |\n" +
+		"\n" +
+		"### Failures\n" +
+		"\n" +
+		"- `us.gcr.io/bar/b@sha256:111`\n" +
+		"  - running writeImage(): unauthorized \\| &lt;denied>\n"
+
+	var b bytes.Buffer
+	require.Nil(t, reg.WriteMarkdownSummary(&b, results, 62500*time.Millisecond, "v3.4.0"))
+	require.Equal(t, expected, b.String())
+
+	// Nothing to promote still renders the counts.
+	b.Reset()
+	require.Nil(t, reg.WriteMarkdownSummary(&b, nil, time.Second, ""))
+	require.Equal(
+		t,
+		"## Image promotion summary\n"+
+			"\n"+
+			"| Requests | Promoted | Failed | Skipped | Duration | Version |\n"+
+			"| ---: | ---: | ---: | ---: | --- | --- |\n"+
+			"| 0 | 0 | 0 | 0 | 1s |  |\n",
+		b.String(),
+	)
+}
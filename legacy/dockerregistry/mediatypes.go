@@ -0,0 +1,93 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cr "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultDeprecatedMediaTypes are the manifest media types which are always
+// considered deprecated.
+var DefaultDeprecatedMediaTypes = []cr.MediaType{
+	cr.DockerManifestSchema1,
+	cr.DockerManifestSchema1Signed,
+}
+
+// CheckDeprecatedMediaTypes looks up the media type of the source image of
+// every edge, and logs a warning for each one which uses
+// DefaultDeprecatedMediaTypes or one of the extra deprecated media types. If
+// reject is true, such images are reported as an error instead. Images whose
+// media type is unknown, and schema v1 images which are upgraded to schema v2
+// while being promoted, are not checked.
+func (sc *SyncContext) CheckDeprecatedMediaTypes(
+	edges map[PromotionEdge]interface{},
+	extra []cr.MediaType,
+	reject bool,
+) error {
+	deprecated := make(map[cr.MediaType]interface{})
+	for _, mediaType := range DefaultDeprecatedMediaTypes {
+		deprecated[mediaType] = nil
+	}
+	for _, mediaType := range extra {
+		deprecated[mediaType] = nil
+	}
+
+	found := make(map[string]cr.MediaType)
+	for edge := range edges {
+		mediaType, ok := sc.DigestMediaType[edge.Digest]
+		if !ok || sc.upgradesSchemaV1(edge.Digest) {
+			continue
+		}
+
+		if _, ok := deprecated[mediaType]; ok {
+			found[ToFQIN(
+				edge.SrcRegistry.Name,
+				edge.SrcImageTag.ImageName,
+				edge.Digest,
+			)] = mediaType
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	images := make([]string, 0, len(found))
+	for image, mediaType := range found {
+		images = append(images, fmt.Sprintf("%s (%s)", image, mediaType))
+	}
+	sort.Strings(images)
+
+	if reject {
+		return fmt.Errorf(
+			"%d source images use deprecated media types: %s",
+			len(images),
+			strings.Join(images, ", "),
+		)
+	}
+
+	for _, image := range images {
+		logrus.Warnf("Source image uses a deprecated media type: %s", image)
+	}
+
+	return nil
+}
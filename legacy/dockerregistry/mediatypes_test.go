@@ -0,0 +1,117 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	cr "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestCheckDeprecatedMediaTypes(t *testing.T) {
+	mkEdge := func(image reg.ImageName, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/foo", Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/bar"},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("a", "sha256:000"): nil,
+		mkEdge("b", "sha256:111"): nil,
+		mkEdge("c", "sha256:222"): nil,
+	}
+
+	tests := []struct {
+		name            string
+		digestMediaType reg.DigestMediaType
+		extra           []cr.MediaType
+		reject          bool
+		expectErr       string
+	}{
+		{
+			"No deprecated media types",
+			reg.DigestMediaType{
+				"sha256:000": cr.DockerManifestSchema2,
+				"sha256:111": cr.DockerManifestList,
+			},
+			nil,
+			true,
+			"",
+		},
+		{
+			"Deprecated media types only warn by default",
+			reg.DigestMediaType{
+				"sha256:000": cr.DockerManifestSchema1,
+			},
+			nil,
+			false,
+			"",
+		},
+		{
+			"Schema v1 is rejected",
+			reg.DigestMediaType{
+				"sha256:000": cr.DockerManifestSchema1,
+				"sha256:111": cr.DockerManifestSchema1Signed,
+				"sha256:222": cr.DockerManifestSchema2,
+			},
+			nil,
+			true,
+			"2 source images use deprecated media types: " +
+				"gcr.io/foo/a@sha256:000 (application/vnd.docker.distribution.manifest.v1+json), " +
+				"gcr.io/foo/b@sha256:111 (application/vnd.docker.distribution.manifest.v1+prettyjws)",
+		},
+		{
+			"Extra deprecated media types",
+			reg.DigestMediaType{
+				"sha256:222": cr.DockerManifestSchema2,
+			},
+			[]cr.MediaType{cr.DockerManifestSchema2},
+			true,
+			"1 source images use deprecated media types: " +
+				"gcr.io/foo/c@sha256:222 (application/vnd.docker.distribution.manifest.v2+json)",
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{DigestMediaType: test.digestMediaType}
+		err := sc.CheckDeprecatedMediaTypes(edges, test.extra, test.reject)
+		if test.expectErr == "" {
+			require.Nil(t, err, test.name)
+			continue
+		}
+
+		require.NotNil(t, err, test.name)
+		require.Equal(t, test.expectErr, err.Error(), test.name)
+	}
+
+	// Schema v1 images are not pushed as such if they are upgraded.
+	sc := reg.SyncContext{
+		DigestMediaType: reg.DigestMediaType{
+			"sha256:000": cr.DockerManifestSchema1,
+			"sha256:111": cr.DockerManifestSchema1Signed,
+		},
+		UpgradeSchemaV1: true,
+	}
+	require.Nil(t, sc.CheckDeprecatedMediaTypes(edges, nil, true))
+}
@@ -0,0 +1,304 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// SourceTagRemoval removes the source tags of a digest once it has been moved
+// to all its destinations.
+type SourceTagRemoval struct {
+	Registry  RegistryContext
+	ImageName ImageName
+	Digest    Digest
+	Tags      []Tag
+	// DeleteDigest is set if no other tag refers to Digest, so that the image
+	// itself is deleted once its tags are removed.
+	DeleteDigest bool
+	// Destinations are the promoted destination images (as PQINs), which
+	// must point to PromotedDigest before anything is removed.
+	Destinations   []string
+	PromotedDigest Digest
+}
+
+// sourceImage identifies a digest in a source image.
+type sourceImage struct {
+	registry RegistryName
+	image    ImageName
+	digest   Digest
+}
+
+// PlanSourceTagRemovals finds the source tags which can be removed after the
+// promotion of sc.PromotionResults. During a dry run, the requests which were
+// only captured count as promoted, so that the removals are planned as in a
+// real run. A source tag is only removed if it pointed to the promoted digest
+// when the source was read, and if every edge declared from it, whether or
+// not it was promoted by this run, is now at its destination. The digest
+// itself is only deleted if all its tags are removed and it is not part of a
+// manifest list.
+func (sc *SyncContext) PlanSourceTagRemovals(
+	declared map[PromotionEdge]interface{},
+) []SourceTagRemoval {
+	removals := make(map[sourceImage]*SourceTagRemoval)
+	failed := make(map[string]interface{})
+	promoted := make(map[string]interface{})
+
+	for _, result := range sc.PromotionResults {
+		req := result.Request
+		if req.TagOp != Add || req.Tag == "" {
+			continue
+		}
+
+		srcPQIN := ToPQIN(req.RegistrySrc, req.ImageNameSrc, req.Tag)
+		if len(result.Errors) > 0 || result.DeadlineReached {
+			failed[srcPQIN] = nil
+			continue
+		}
+		promoted[ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag)] = nil
+
+		src := sourceImage{req.RegistrySrc, req.ImageNameSrc, req.Digest}
+		if _, ok := sc.Inv[src.registry][src.image][src.digest].ToTagSet()[req.Tag]; !ok {
+			continue
+		}
+
+		removal, ok := removals[src]
+		if !ok {
+			removal = &SourceTagRemoval{
+				Registry:       sc.registryContext(src.registry),
+				ImageName:      src.image,
+				Digest:         src.digest,
+				PromotedDigest: sc.promotedDigest(req),
+			}
+			removals[src] = removal
+		}
+
+		removal.Tags = append(removal.Tags, req.Tag)
+		removal.Destinations = append(
+			removal.Destinations,
+			ToPQIN(req.RegistryDest, req.ImageNameDest, req.Tag),
+		)
+	}
+
+	// An edge which was dropped before the promotion (by a selection, or as
+	// its source is unsigned, for example) still needs the source tag,
+	// unless its destination already had it.
+	for edge := range declared {
+		if edge.SrcImageTag.Tag == "" {
+			continue
+		}
+
+		dstPQIN := ToPQIN(
+			edge.DstRegistry.Name,
+			edge.DstImageTag.ImageName,
+			edge.DstImageTag.Tag,
+		)
+		if _, ok := promoted[dstPQIN]; ok {
+			continue
+		}
+
+		dstTags := sc.Inv[edge.DstRegistry.Name][edge.DstImageTag.ImageName][edge.Digest]
+		if _, ok := dstTags.ToTagSet()[edge.DstImageTag.Tag]; ok {
+			continue
+		}
+
+		failed[ToPQIN(
+			edge.SrcRegistry.Name,
+			edge.SrcImageTag.ImageName,
+			edge.SrcImageTag.Tag,
+		)] = nil
+	}
+
+	planned := make([]SourceTagRemoval, 0, len(removals))
+	for src, removal := range removals {
+		tags := make([]Tag, 0, len(removal.Tags))
+		for tag := range TagSlice(removal.Tags).ToTagSet() {
+			if _, ok := failed[ToPQIN(src.registry, src.image, tag)]; !ok {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			continue
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+		_, isChild := sc.ParentDigest[src.digest]
+		removal.Tags = tags
+		removal.DeleteDigest = !isChild &&
+			len(tags) == len(sc.Inv[src.registry][src.image][src.digest])
+		removal.Destinations = uniqueStrings(removal.Destinations)
+		planned = append(planned, *removal)
+	}
+
+	sort.Slice(planned, func(i, j int) bool {
+		return planned[i].String() < planned[j].String()
+	})
+
+	return planned
+}
+
+// registryContext returns the context of the registry, with its service
+// account.
+func (sc *SyncContext) registryContext(name RegistryName) RegistryContext {
+	for _, rc := range sc.RegistryContexts {
+		if rc.Name == name {
+			return rc
+		}
+	}
+
+	return RegistryContext{Name: name}
+}
+
+// uniqueStrings returns the sorted set of strs.
+func uniqueStrings(strs []string) []string {
+	set := make(map[string]interface{})
+	unique := make([]string, 0, len(strs))
+	for _, s := range strs {
+		if _, ok := set[s]; !ok {
+			set[s] = nil
+			unique = append(unique, s)
+		}
+	}
+	sort.Strings(unique)
+
+	return unique
+}
+
+// String describes the removal.
+func (r SourceTagRemoval) String() string {
+	pqins := make([]string, 0, len(r.Tags))
+	for _, tag := range r.Tags {
+		pqins = append(pqins, ToPQIN(r.Registry.Name, r.ImageName, tag))
+	}
+
+	s := fmt.Sprintf("%s (at %s)", strings.Join(pqins, ", "), r.Digest)
+	if r.DeleteDigest {
+		s += ", deleting " + ToFQIN(r.Registry.Name, r.ImageName, r.Digest)
+	}
+
+	return s
+}
+
+// RemoveSourceTags removes the source tags (and, where planned, deletes the
+// digests) with the commands produced by mkUntagProducer and
+// mkDeleteProducer. Nothing is removed unless every destination has been
+// verified to point to the promoted digest, and each source tag to still
+// point to the moved digest. The digest is deleted without deleting tags, so
+// that the registry refuses to delete it if a tag was added in the meantime.
+// Without sc.Confirm, the removals are only logged.
+func (sc *SyncContext) RemoveSourceTags(
+	removals []SourceTagRemoval,
+	mkUntagProducer func(SourceTagRemoval, Tag) stream.Producer,
+	mkDeleteProducer func(SourceTagRemoval) stream.Producer,
+) error {
+	failures := make([]string, 0)
+
+	for _, removal := range removals {
+		// Nothing was promoted during a dry run, so there is nothing to
+		// verify either.
+		if !sc.Confirm {
+			logrus.Infof("Dry run: would remove source tags %s", removal)
+			continue
+		}
+
+		if err := sc.verifyRemoval(removal); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", removal, err))
+			continue
+		}
+
+		removed := true
+		for _, tag := range removal.Tags {
+			if err := runProducer(mkUntagProducer(removal, tag)); err != nil {
+				failures = append(failures, fmt.Sprintf(
+					"%s: removing %s: %v",
+					removal,
+					ToPQIN(removal.Registry.Name, removal.ImageName, tag),
+					err,
+				))
+				removed = false
+				break
+			}
+		}
+
+		if removed && removal.DeleteDigest {
+			if err := runProducer(mkDeleteProducer(removal)); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", removal, err))
+				continue
+			}
+		}
+
+		if removed {
+			logrus.Infof("Removed source tags %s", removal)
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"unable to remove the source tags of %d images: %s",
+			len(failures),
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return nil
+}
+
+// verifyRemoval checks that every destination of the removal points to the
+// promoted digest, and every source tag still to the moved digest.
+func (sc *SyncContext) verifyRemoval(removal SourceTagRemoval) error {
+	for _, dst := range removal.Destinations {
+		actual, err := crane.Digest(dst, sc.copyOptions()...)
+		if err != nil {
+			return fmt.Errorf("verifying %s: %w", dst, err)
+		}
+
+		if Digest(actual) != removal.PromotedDigest {
+			return fmt.Errorf(
+				"%s points to %s, not the promoted %s",
+				dst,
+				actual,
+				removal.PromotedDigest,
+			)
+		}
+	}
+
+	for _, tag := range removal.Tags {
+		src := ToPQIN(removal.Registry.Name, removal.ImageName, tag)
+		actual, err := crane.Digest(src, sc.copyOptions()...)
+		if err != nil {
+			return fmt.Errorf("verifying %s: %w", src, err)
+		}
+
+		if Digest(actual) != removal.Digest {
+			return fmt.Errorf(
+				"%s now points to %s, not the moved %s",
+				src,
+				actual,
+				removal.Digest,
+			)
+		}
+	}
+
+	return nil
+}
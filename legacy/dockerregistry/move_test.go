@@ -0,0 +1,188 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+func TestRemoveSourceTags(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	srcName := reg.RegistryName(host + "/src")
+	dstName := reg.RegistryName(host + "/dst")
+
+	img, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	digest, err := img.Digest()
+	require.Nil(t, err)
+
+	for _, image := range []string{"src/foo:1.0", "dst/foo:1.0", "src/bar:2.0", "dst/bar:2.0"} {
+		ref, err := name.ParseReference(host + "/" + image)
+		require.Nil(t, err)
+		require.Nil(t, remote.Write(ref, img))
+	}
+
+	movedDigest := reg.Digest(digest.String())
+	otherDigest := reg.Digest("sha256:" + strings.Repeat("0", 64))
+
+	mkResult := func(image reg.ImageName, tag reg.Tag) reg.PromotionResult {
+		return reg.PromotionResult{
+			Request: reg.PromotionRequest{
+				TagOp:         reg.Add,
+				RegistrySrc:   srcName,
+				RegistryDest:  dstName,
+				ImageNameSrc:  image,
+				ImageNameDest: image,
+				Digest:        movedDigest,
+				Tag:           tag,
+			},
+		}
+	}
+
+	failed := mkResult("foo", "1.1")
+	failed.Errors = reg.Errors{{Context: "copy", Error: nil}}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			srcName: reg.RegInvImage{
+				"foo": reg.DigestTags{
+					movedDigest: reg.TagSlice{"1.0", "1.1"},
+				},
+				"bar": reg.DigestTags{
+					movedDigest: reg.TagSlice{"2.0"},
+				},
+			},
+		},
+		PromotionResults: []reg.PromotionResult{
+			mkResult("foo", "1.0"),
+			mkResult("bar", "2.0"),
+			mkResult("baz", "3.0"),
+			failed,
+		},
+	}
+
+	mkEdge := func(image reg.ImageName, tag reg.Tag, dst reg.RegistryName) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: srcName},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      movedDigest,
+			DstRegistry: reg.RegistryContext{Name: dst},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	declared := map[reg.PromotionEdge]interface{}{
+		mkEdge("foo", "1.0", dstName): nil,
+		mkEdge("foo", "1.1", dstName): nil,
+		mkEdge("bar", "2.0", dstName): nil,
+	}
+
+	// The promotion of foo:1.1 failed, so the foo digest keeps a tag and is
+	// not deleted. baz:3.0 is not in the source inventory.
+	removals := sc.PlanSourceTagRemovals(declared)
+	require.Equal(t, []reg.SourceTagRemoval{
+		{
+			Registry:       reg.RegistryContext{Name: srcName},
+			ImageName:      "bar",
+			Digest:         movedDigest,
+			Tags:           []reg.Tag{"2.0"},
+			DeleteDigest:   true,
+			Destinations:   []string{string(dstName) + "/bar:2.0"},
+			PromotedDigest: movedDigest,
+		},
+		{
+			Registry:       reg.RegistryContext{Name: srcName},
+			ImageName:      "foo",
+			Digest:         movedDigest,
+			Tags:           []reg.Tag{"1.0"},
+			Destinations:   []string{string(dstName) + "/foo:1.0"},
+			PromotedDigest: movedDigest,
+		},
+	}, removals)
+
+	// A digest which is part of a manifest list is never deleted.
+	sc.ParentDigest = reg.ParentDigest{movedDigest: otherDigest}
+	require.False(t, sc.PlanSourceTagRemovals(declared)[0].DeleteDigest)
+	sc.ParentDigest = nil
+
+	// bar:2.0 is also declared to another destination, which was not
+	// promoted by this run, so it keeps its source tag until that
+	// destination has it.
+	mirrorName := reg.RegistryName(host + "/mirror")
+	declared[mkEdge("bar", "2.0", mirrorName)] = nil
+	planned := sc.PlanSourceTagRemovals(declared)
+	require.Len(t, planned, 1)
+	require.Equal(t, reg.ImageName("foo"), planned[0].ImageName)
+
+	sc.Inv[mirrorName] = reg.RegInvImage{
+		"bar": reg.DigestTags{movedDigest: reg.TagSlice{"2.0"}},
+	}
+	require.Equal(t, removals, sc.PlanSourceTagRemovals(declared))
+	delete(sc.Inv, mirrorName)
+
+	var untagged []string
+	var deleted []reg.ImageName
+	mkUntagProducer := func(removal reg.SourceTagRemoval, tag reg.Tag) stream.Producer {
+		untagged = append(untagged, string(removal.ImageName)+":"+string(tag))
+		var sr stream.Fake
+		return &sr
+	}
+	mkDeleteProducer := func(removal reg.SourceTagRemoval) stream.Producer {
+		deleted = append(deleted, removal.ImageName)
+		var sr stream.Fake
+		return &sr
+	}
+
+	// Dry run.
+	require.Nil(t, sc.RemoveSourceTags(removals, mkUntagProducer, mkDeleteProducer))
+	require.Empty(t, untagged)
+	require.Empty(t, deleted)
+
+	sc.Confirm = true
+	require.Nil(t, sc.RemoveSourceTags(removals, mkUntagProducer, mkDeleteProducer))
+	require.Equal(t, []string{"bar:2.0", "foo:1.0"}, untagged)
+	require.Equal(t, []reg.ImageName{"bar"}, deleted)
+
+	// Nothing is removed if a destination does not hold the promoted digest.
+	untagged = nil
+	deleted = nil
+	removals[0].PromotedDigest = otherDigest
+	require.Error(t, sc.RemoveSourceTags(removals[:1], mkUntagProducer, mkDeleteProducer))
+	require.Empty(t, untagged)
+	require.Empty(t, deleted)
+
+	// Nor if a source tag was moved to another digest in the meantime.
+	removals[0].PromotedDigest = movedDigest
+	removals[0].Digest = otherDigest
+	require.Error(t, sc.RemoveSourceTags(removals[:1], mkUntagProducer, mkDeleteProducer))
+	require.Empty(t, untagged)
+	require.Empty(t, deleted)
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MultiTagPolicyAll promotes every tag of a digest, including the tag
+	// aliases derived from them.
+	MultiTagPolicyAll = "all"
+
+	// MultiTagPolicyManifestOnly promotes only the tags written in the
+	// manifests, so no tag aliases are derived.
+	MultiTagPolicyManifestOnly = "manifest-only"
+
+	// MultiTagPolicyPrimary promotes only the highest tag of each digest.
+	MultiTagPolicyPrimary = "primary"
+)
+
+// MultiTagPolicies are the supported policies for digests with more than one
+// tag.
+var MultiTagPolicies = []string{
+	MultiTagPolicyAll,
+	MultiTagPolicyManifestOnly,
+	MultiTagPolicyPrimary,
+}
+
+// versionTag matches tags which look like a (semantic) version, such as
+// 'v1.2.3', '1.2' or 'v1.2.3-rc.1'.
+var versionTag = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([\w.-]+))?$`)
+
+// ApplyMultiTagPolicy returns the edges which the policy promotes. Only
+// MultiTagPolicyPrimary removes edges: of the edges promoting a digest to
+// the same destination image, it keeps the one with the highest tag.
+func ApplyMultiTagPolicy(
+	edges map[PromotionEdge]interface{},
+	policy string,
+) map[PromotionEdge]interface{} {
+	if policy != MultiTagPolicyPrimary {
+		return edges
+	}
+
+	type destination struct {
+		registry RegistryName
+		image    ImageName
+		digest   Digest
+	}
+
+	primaries := make(map[destination]PromotionEdge)
+	for edge := range edges {
+		dst := destination{
+			registry: edge.DstRegistry.Name,
+			image:    edge.DstImageTag.ImageName,
+			digest:   edge.Digest,
+		}
+
+		primary, ok := primaries[dst]
+		if !ok || compareTags(edge.DstImageTag.Tag, primary.DstImageTag.Tag) > 0 {
+			primaries[dst] = edge
+		}
+	}
+
+	kept := make(map[PromotionEdge]interface{})
+	for _, edge := range primaries {
+		kept[edge] = nil
+	}
+
+	return kept
+}
+
+// compareTags orders tags by version if both look like one, with versions
+// above any other tag, and lexicographically otherwise. A release is higher
+// than its pre-releases.
+func compareTags(a, b Tag) int {
+	va := versionTag.FindStringSubmatch(string(a))
+	vb := versionTag.FindStringSubmatch(string(b))
+
+	switch {
+	case va != nil && vb == nil:
+		return 1
+	case va == nil && vb != nil:
+		return -1
+	case va != nil && vb != nil:
+		for i := 1; i <= 3; i++ {
+			// Missing components count as 0.
+			na, _ := strconv.Atoi(va[i])
+			nb, _ := strconv.Atoi(vb[i])
+			if na != nb {
+				if na > nb {
+					return 1
+				}
+				return -1
+			}
+		}
+
+		switch {
+		case va[4] == "" && vb[4] != "":
+			return 1
+		case va[4] != "" && vb[4] == "":
+			return -1
+		case va[4] != vb[4]:
+			return strings.Compare(va[4], vb[4])
+		}
+	}
+
+	return strings.Compare(string(a), string(b))
+}
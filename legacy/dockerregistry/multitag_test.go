@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestApplyMultiTagPolicy(t *testing.T) {
+	mkEdge := func(dst reg.RegistryName, tag reg.Tag, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src", Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: dst},
+			DstImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+		}
+	}
+
+	mkEdges := func(edges ...reg.PromotionEdge) map[reg.PromotionEdge]interface{} {
+		m := make(map[reg.PromotionEdge]interface{})
+		for _, edge := range edges {
+			m[edge] = nil
+		}
+		return m
+	}
+
+	tests := []struct {
+		name     string
+		edges    map[reg.PromotionEdge]interface{}
+		policy   string
+		expected map[reg.PromotionEdge]interface{}
+	}{
+		{
+			name: "all",
+			edges: mkEdges(
+				mkEdge("gcr.io/dst", "1.0", "sha256:111"),
+				mkEdge("gcr.io/dst", "latest", "sha256:111"),
+			),
+			policy: reg.MultiTagPolicyAll,
+			expected: mkEdges(
+				mkEdge("gcr.io/dst", "1.0", "sha256:111"),
+				mkEdge("gcr.io/dst", "latest", "sha256:111"),
+			),
+		},
+		{
+			name: "manifest-only",
+			edges: mkEdges(
+				mkEdge("gcr.io/dst", "1.0", "sha256:111"),
+				mkEdge("gcr.io/dst", "latest", "sha256:111"),
+			),
+			policy: reg.MultiTagPolicyManifestOnly,
+			expected: mkEdges(
+				mkEdge("gcr.io/dst", "1.0", "sha256:111"),
+				mkEdge("gcr.io/dst", "latest", "sha256:111"),
+			),
+		},
+		{
+			name: "primary by version",
+			edges: mkEdges(
+				mkEdge("gcr.io/dst", "v1.9.0", "sha256:111"),
+				mkEdge("gcr.io/dst", "v1.10.0", "sha256:111"),
+				mkEdge("gcr.io/dst", "v1.10.0-rc.1", "sha256:111"),
+				mkEdge("gcr.io/dst", "v1.10", "sha256:111"),
+				mkEdge("gcr.io/dst", "latest", "sha256:111"),
+				mkEdge("gcr.io/dst", "v0.1", "sha256:222"),
+				mkEdge("gcr.io/dst", "1.0-alpha", "sha256:222"),
+			),
+			policy: reg.MultiTagPolicyPrimary,
+			expected: mkEdges(
+				mkEdge("gcr.io/dst", "v1.10.0", "sha256:111"),
+				mkEdge("gcr.io/dst", "1.0-alpha", "sha256:222"),
+			),
+		},
+		{
+			name: "primary lexicographically",
+			edges: mkEdges(
+				mkEdge("gcr.io/dst", "beta", "sha256:111"),
+				mkEdge("gcr.io/dst", "alpha", "sha256:111"),
+				mkEdge("gcr.io/dst", "", "sha256:222"),
+			),
+			policy: reg.MultiTagPolicyPrimary,
+			expected: mkEdges(
+				mkEdge("gcr.io/dst", "beta", "sha256:111"),
+				mkEdge("gcr.io/dst", "", "sha256:222"),
+			),
+		},
+		{
+			name: "primary for each destination",
+			edges: mkEdges(
+				mkEdge("gcr.io/dst-a", "1.0", "sha256:111"),
+				mkEdge("gcr.io/dst-a", "1.1", "sha256:111"),
+				mkEdge("gcr.io/dst-b", "1.0", "sha256:111"),
+			),
+			policy: reg.MultiTagPolicyPrimary,
+			expected: mkEdges(
+				mkEdge("gcr.io/dst-a", "1.1", "sha256:111"),
+				mkEdge("gcr.io/dst-b", "1.0", "sha256:111"),
+			),
+		},
+	}
+
+	for _, test := range tests {
+		got := reg.ApplyMultiTagPolicy(test.edges, test.policy)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// cosignAttachmentTag matches the tags cosign gives to the signatures,
+// attestations and SBOMs of an image: its digest, with the ':' replaced by a
+// '-', followed by the kind of attachment.
+var cosignAttachmentTag = regexp.MustCompile(
+	`^(sha256|sha512)-([0-9a-f]+)\.(sig|att|sbom)$`,
+)
+
+// CosignAttachmentSubject returns the digest of the image the cosign
+// attachment tag belongs to. It returns false if tag is not an attachment tag.
+func CosignAttachmentSubject(tag Tag) (Digest, bool) {
+	match := cosignAttachmentTag.FindStringSubmatch(string(tag))
+	if match == nil {
+		return "", false
+	}
+
+	return Digest(match[1] + ":" + match[2]), true
+}
+
+// OrphanReport lists the cosign attachments of a registry whose subject
+// images no longer exist.
+type OrphanReport struct {
+	Registry RegistryName         `json:"registry" yaml:"registry"`
+	Orphans  []OrphanedAttachment `json:"orphans" yaml:"orphans"`
+}
+
+// OrphanedAttachment is the image holding cosign attachments (signatures,
+// attestations or SBOMs) of images which no longer exist in its repository.
+type OrphanedAttachment struct {
+	Image    ImageName `json:"image" yaml:"image"`
+	Digest   Digest    `json:"digest" yaml:"digest"`
+	Tags     TagSlice  `json:"tags" yaml:"tags"`
+	Subjects []Digest  `json:"subjects" yaml:"subjects"`
+}
+
+// FindOrphanedAttachments reports the cosign attachments of the registry
+// regName, as read into sc.Inv, whose subject digests are no longer found in
+// their repository. An image only counts as orphaned if all of its tags are
+// attachment tags of missing images, so that images which are still in use
+// under another tag are never reported.
+func (sc *SyncContext) FindOrphanedAttachments(regName RegistryName) OrphanReport {
+	report := OrphanReport{
+		Registry: regName,
+		Orphans:  make([]OrphanedAttachment, 0),
+	}
+
+	for imageName, digestTags := range sc.Inv[regName] {
+		for digest, tags := range digestTags {
+			if len(tags) == 0 {
+				continue
+			}
+
+			subjects := make([]Digest, 0, len(tags))
+			for _, tag := range tags {
+				subject, ok := CosignAttachmentSubject(tag)
+				if !ok {
+					break
+				}
+
+				if _, exists := digestTags[subject]; exists {
+					break
+				}
+
+				subjects = append(subjects, subject)
+			}
+
+			if len(subjects) != len(tags) {
+				continue
+			}
+
+			sortedTags := make(TagSlice, len(tags))
+			copy(sortedTags, tags)
+			sort.Slice(sortedTags, func(i, j int) bool {
+				return sortedTags[i] < sortedTags[j]
+			})
+			sort.Slice(subjects, func(i, j int) bool {
+				return subjects[i] < subjects[j]
+			})
+
+			report.Orphans = append(report.Orphans, OrphanedAttachment{
+				Image:    imageName,
+				Digest:   digest,
+				Tags:     sortedTags,
+				Subjects: subjects,
+			})
+		}
+	}
+
+	sort.Slice(report.Orphans, func(i, j int) bool {
+		if report.Orphans[i].Image != report.Orphans[j].Image {
+			return report.Orphans[i].Image < report.Orphans[j].Image
+		}
+
+		return report.Orphans[i].Digest < report.Orphans[j].Digest
+	})
+
+	return report
+}
+
+// DeleteOrphanedAttachments deletes the orphaned attachments of the report,
+// along with their tags, with the commands produced by mkProducer. All
+// failures are reported together. Without sc.Confirm, the deletions are only
+// logged.
+func (sc *SyncContext) DeleteOrphanedAttachments(
+	report OrphanReport,
+	mkProducer func(RegistryContext, ImageName, Digest) stream.Producer,
+) error {
+	registry := RegistryContext{Name: report.Registry}
+	for _, rc := range sc.RegistryContexts {
+		if rc.Name == report.Registry {
+			registry = rc
+			break
+		}
+	}
+
+	failures := make([]string, 0)
+	for _, orphan := range report.Orphans {
+		fqin := ToFQIN(registry.Name, orphan.Image, orphan.Digest)
+
+		if !sc.Confirm {
+			logrus.Infof("Dry run: would delete orphaned attachment %s", fqin)
+			continue
+		}
+
+		err := runProducer(mkProducer(registry, orphan.Image, orphan.Digest))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", fqin, err))
+			continue
+		}
+
+		logrus.Infof("Deleted orphaned attachment %s", fqin)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf(
+			"unable to delete %d orphaned attachments: %s",
+			len(failures),
+			strings.Join(failures, "; "),
+		)
+	}
+
+	return nil
+}
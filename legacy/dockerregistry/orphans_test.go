@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+func TestCosignAttachmentSubject(t *testing.T) {
+	tests := []struct {
+		tag      reg.Tag
+		expected reg.Digest
+		ok       bool
+	}{
+		{"sha256-abc123.sig", "sha256:abc123", true},
+		{"sha256-abc123.att", "sha256:abc123", true},
+		{"sha256-abc123.sbom", "sha256:abc123", true},
+		{"sha256-abc123.txt", "", false},
+		{"sha256-abc123", "", false},
+		{"v1.0.sig", "", false},
+		{"latest", "", false},
+	}
+
+	for _, test := range tests {
+		subject, ok := reg.CosignAttachmentSubject(test.tag)
+		require.Equal(t, test.ok, ok, string(test.tag))
+		require.Equal(t, test.expected, subject, string(test.tag))
+	}
+}
+
+func TestFindOrphanedAttachments(t *testing.T) {
+	registry := reg.RegistryContext{Name: "gcr.io/foo"}
+
+	sc := reg.SyncContext{
+		RegistryContexts: []reg.RegistryContext{registry},
+		Inv: reg.MasterInventory{
+			"gcr.io/foo": reg.RegInvImage{
+				"bar": reg.DigestTags{
+					"sha256:000": reg.TagSlice{"1.0"},
+					// Attachments of an existing image.
+					"sha256:a00": reg.TagSlice{"sha256-000.sig"},
+					"sha256:a01": reg.TagSlice{"sha256-000.att"},
+					// Attachments of deleted images.
+					"sha256:a02": reg.TagSlice{"sha256-111.sig"},
+					"sha256:a03": reg.TagSlice{"sha256-222.sbom", "sha256-111.sbom"},
+					// Still tagged otherwise.
+					"sha256:a04": reg.TagSlice{"sha256-333.sig", "keep"},
+					// Untagged images are not attachments.
+					"sha256:a05": reg.TagSlice{},
+				},
+				"baz": reg.DigestTags{
+					// The subject exists in another repository only.
+					"sha256:a06": reg.TagSlice{"sha256-000.sig"},
+				},
+			},
+		},
+	}
+
+	report := sc.FindOrphanedAttachments("gcr.io/foo")
+	require.Equal(t, reg.OrphanReport{
+		Registry: "gcr.io/foo",
+		Orphans: []reg.OrphanedAttachment{
+			{
+				Image:    "bar",
+				Digest:   "sha256:a02",
+				Tags:     reg.TagSlice{"sha256-111.sig"},
+				Subjects: []reg.Digest{"sha256:111"},
+			},
+			{
+				Image:    "bar",
+				Digest:   "sha256:a03",
+				Tags:     reg.TagSlice{"sha256-111.sbom", "sha256-222.sbom"},
+				Subjects: []reg.Digest{"sha256:111", "sha256:222"},
+			},
+			{
+				Image:    "baz",
+				Digest:   "sha256:a06",
+				Tags:     reg.TagSlice{"sha256-000.sig"},
+				Subjects: []reg.Digest{"sha256:000"},
+			},
+		},
+	}, report)
+
+	deleted := []reg.Digest{}
+	mkProducer := func(
+		rc reg.RegistryContext,
+		imageName reg.ImageName,
+		digest reg.Digest,
+	) stream.Producer {
+		require.Equal(t, registry, rc)
+		deleted = append(deleted, digest)
+		var sr stream.Fake
+		return &sr
+	}
+
+	// Dry run.
+	require.Nil(t, sc.DeleteOrphanedAttachments(report, mkProducer))
+	require.Empty(t, deleted)
+
+	sc.Confirm = true
+	require.Nil(t, sc.DeleteOrphanedAttachments(report, mkProducer))
+	require.Equal(t, []reg.Digest{"sha256:a02", "sha256:a03", "sha256:a06"}, deleted)
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// PlanNewImage is the promotion of an image which does not exist at
+	// the destination yet.
+	PlanNewImage = "new-image"
+
+	// PlanNewTag is the promotion of a tag which does not exist for the
+	// image at the destination yet (or, for a promotion by digest only, of
+	// a digest which does not exist there yet).
+	PlanNewTag = "new-tag"
+
+	// PlanRetag is the promotion of a tag which exists at the destination,
+	// but points to another digest.
+	PlanRetag = "retag"
+)
+
+// PlanAction is a change a promotion makes at its destination.
+type PlanAction struct {
+	Kind        string `json:"kind"`
+	Destination string `json:"destination"`
+	Digest      Digest `json:"digest"`
+	// Previous is the digest the tag pointed to, for a retag.
+	Previous Digest `json:"previous,omitempty"`
+}
+
+// Plan counts the actions of a promotion by their kind.
+type Plan struct {
+	NewImages int          `json:"newImages"`
+	NewTags   int          `json:"newTags"`
+	Retags    int          `json:"retags"`
+	Actions   []PlanAction `json:"actions"`
+}
+
+// PlanEdges classifies the edges still to be promoted against the
+// destination inventory in sc.Inv. With DestCheckPerEdge, the inventory only
+// knows the tag and digest of each edge, so an image is only known to exist
+// if one of them does.
+func (sc *SyncContext) PlanEdges(edges map[PromotionEdge]interface{}) *Plan {
+	plan := &Plan{Actions: make([]PlanAction, 0, len(edges))}
+	for edge := range edges {
+		edge := edge
+		dp := edge.VertexPropsFor(&edge.DstRegistry, &edge.DstImageTag, &sc.Inv)
+
+		action := PlanAction{
+			Destination: ToLQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName),
+			Digest:      edge.Digest,
+		}
+		if edge.DstImageTag.Tag != "" {
+			action.Destination = ToPQIN(
+				edge.DstRegistry.Name,
+				edge.DstImageTag.ImageName,
+				edge.DstImageTag.Tag,
+			)
+		}
+
+		_, imageExists := sc.Inv[edge.DstRegistry.Name][edge.DstImageTag.ImageName]
+		switch {
+		case dp.PqinExists && !dp.PqinDigestMatch:
+			action.Kind = PlanRetag
+			action.Previous = dp.BadDigest
+			plan.Retags++
+		case imageExists:
+			action.Kind = PlanNewTag
+			plan.NewTags++
+		default:
+			action.Kind = PlanNewImage
+			plan.NewImages++
+		}
+
+		plan.Actions = append(plan.Actions, action)
+	}
+
+	sort.Slice(plan.Actions, func(i, j int) bool {
+		if plan.Actions[i].Destination != plan.Actions[j].Destination {
+			return plan.Actions[i].Destination < plan.Actions[j].Destination
+		}
+		return plan.Actions[i].Digest < plan.Actions[j].Digest
+	})
+
+	return plan
+}
+
+// ReportPlan writes the plan of the edges out, and records it in the
+// collected logs (and so in the JSON summary).
+func (sc *SyncContext) ReportPlan(edges map[PromotionEdge]interface{}) {
+	plan := sc.PlanEdges(edges)
+	sc.Logs.Plan = plan
+
+	w := sc.out()
+	fmt.Fprintf(
+		w,
+		"Planned changes: %d %s, %d %s, %d %s\n",
+		plan.NewImages, PlanNewImage,
+		plan.NewTags, PlanNewTag,
+		plan.Retags, PlanRetag,
+	)
+	for _, action := range plan.Actions {
+		fmt.Fprintf(
+			w,
+			"  %s: %s (at %s)",
+			action.Kind,
+			action.Destination,
+			sc.displayDigest(action.Digest),
+		)
+		if action.Previous != "" {
+			fmt.Fprintf(w, " (was %s)", sc.displayDigest(action.Previous))
+		}
+		fmt.Fprintln(w)
+	}
+}
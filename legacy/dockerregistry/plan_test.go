@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestPlanEdges(t *testing.T) {
+	digest := reg.Digest("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+	otherDigest := reg.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+
+	mkEdge := func(image reg.ImageName, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src"},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/dst"},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("foo", "1.1"): nil,
+		mkEdge("foo", "1.0"): nil,
+		mkEdge("foo", ""):    nil,
+		mkEdge("bar", "2.0"): nil,
+		mkEdge("baz", "3.0"): nil,
+	}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			"gcr.io/dst": reg.RegInvImage{
+				"foo": reg.DigestTags{
+					otherDigest: reg.TagSlice{"1.0"},
+				},
+				"baz": reg.DigestTags{
+					otherDigest: reg.TagSlice{"2.0"},
+				},
+			},
+		},
+	}
+
+	expected := &reg.Plan{
+		NewImages: 1,
+		NewTags:   3,
+		Retags:    1,
+		Actions: []reg.PlanAction{
+			{Kind: reg.PlanNewImage, Destination: "gcr.io/dst/bar:2.0", Digest: digest},
+			{Kind: reg.PlanNewTag, Destination: "gcr.io/dst/baz:3.0", Digest: digest},
+			{Kind: reg.PlanNewTag, Destination: "gcr.io/dst/foo", Digest: digest},
+			{Kind: reg.PlanRetag, Destination: "gcr.io/dst/foo:1.0", Digest: digest, Previous: otherDigest},
+			{Kind: reg.PlanNewTag, Destination: "gcr.io/dst/foo:1.1", Digest: digest},
+		},
+	}
+	require.Equal(t, expected, sc.PlanEdges(edges))
+
+	var out bytes.Buffer
+	sc.Out = &out
+	sc.ShortDigests = true
+
+	sc.ReportPlan(edges)
+	require.Equal(t, expected, sc.Logs.Plan)
+	require.Equal(t, `Planned changes: 1 new-image, 3 new-tag, 1 retag
+  new-image: gcr.io/dst/bar:2.0 (at sha256:000000000000)
+  new-tag: gcr.io/dst/baz:3.0 (at sha256:000000000000)
+  new-tag: gcr.io/dst/foo (at sha256:000000000000)
+  retag: gcr.io/dst/foo:1.0 (at sha256:000000000000) (was sha256:111111111111)
+  new-tag: gcr.io/dst/foo:1.1 (at sha256:000000000000)
+`, out.String())
+}
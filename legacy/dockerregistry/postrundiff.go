@@ -0,0 +1,119 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// DestinationChanges are the changes a run made to a destination registry.
+type DestinationChanges struct {
+	Registry RegistryName     `json:"registry" yaml:"registry"`
+	Changes  []SnapshotChange `json:"changes" yaml:"changes"`
+}
+
+// DestinationSnapshot reads the destination repositories of the edges and
+// returns their snapshot, keyed by registry. The inventory of sc is left as
+// it is, so that snapshots can be taken before and after a promotion to see
+// what it changed (see DiffDestinations). It fails if any repository cannot
+// be read, as the snapshot would then be incomplete.
+func (sc *SyncContext) DestinationSnapshot(
+	edges map[PromotionEdge]interface{},
+	mkProducer func(*SyncContext, RegistryContext) stream.Producer,
+) (MasterInventory, error) {
+	reader := *sc
+	reader.Inv = make(MasterInventory)
+	reader.InvIgnore = nil
+	reader.Logs = CollectedLogs{}
+	reader.SnapshotCheckpointer = nil
+
+	reader.ReadRegistries(getDestinationRegistriesToRead(edges), false, mkProducer)
+	if len(reader.Logs.Errors) > 0 {
+		return nil, fmt.Errorf(
+			"%d destination repositories could not be read",
+			len(reader.Logs.Errors),
+		)
+	}
+
+	snapshot := make(MasterInventory)
+	for edge := range edges {
+		rii, ok := snapshot[edge.DstRegistry.Name]
+		if !ok {
+			rii = make(RegInvImage)
+			snapshot[edge.DstRegistry.Name] = rii
+		}
+
+		if digestTags, ok := reader.Inv[edge.DstRegistry.Name][edge.DstImageTag.ImageName]; ok {
+			rii[edge.DstImageTag.ImageName] = digestTags
+		}
+	}
+
+	return snapshot, nil
+}
+
+// getDestinationRegistriesToRead is like getRegistriesToRead, but only
+// collects the destination repositories of the edges.
+func getDestinationRegistriesToRead(edges map[PromotionEdge]interface{}) []RegistryContext {
+	rcs := make(map[RegistryContext]interface{})
+	for edge := range edges {
+		dstReg := edge.DstRegistry
+		dstReg.Name = dstReg.Name +
+			"/" +
+			RegistryName(edge.DstImageTag.ImageName)
+
+		rcs[dstReg] = nil
+	}
+
+	rcsFinal := []RegistryContext{}
+	for rc := range rcs {
+		rcsFinal = append(rcsFinal, rc)
+	}
+
+	return rcsFinal
+}
+
+// DiffDestinations classifies the changes between the snapshots of the
+// destination registries taken before and after a run (see DiffSnapshots).
+// Every registry of either snapshot is listed, sorted by name, even if
+// nothing changed in it.
+func DiffDestinations(before, after MasterInventory) []DestinationChanges {
+	registries := make([]RegistryName, 0, len(after))
+	for name := range after {
+		registries = append(registries, name)
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			registries = append(registries, name)
+		}
+	}
+	sort.Slice(registries, func(i, j int) bool {
+		return registries[i] < registries[j]
+	})
+
+	diff := make([]DestinationChanges, 0, len(registries))
+	for _, name := range registries {
+		diff = append(diff, DestinationChanges{
+			Registry: name,
+			Changes:  DiffSnapshots(before[name], after[name]),
+		})
+	}
+
+	return diff
+}
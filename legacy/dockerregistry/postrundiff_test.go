@@ -0,0 +1,173 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// fakeListing is the listing of the repository gcr.io/bar/<name> with the
+// given manifests, each with at most one tag.
+func fakeListing(name string, tags map[string]string) string {
+	manifests := ""
+	for digest, tag := range tags {
+		if manifests != "" {
+			manifests += ","
+		}
+		tagList := "[]"
+		if tag != "" {
+			tagList = fmt.Sprintf("[%q]", tag)
+		}
+		manifests += fmt.Sprintf(`%q: {
+      "imageSizeBytes": "12875324",
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "tag": %s,
+      "timeCreatedMs": "1501774217070",
+      "timeUploadedMs": "1552917295327"
+    }`, digest, tagList)
+	}
+
+	return fmt.Sprintf(
+		`{"child": [], "manifest": {%s}, "name": "bar/%s", "tags": []}`,
+		manifests,
+		name,
+	)
+}
+
+func TestDestinationSnapshot(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/foo", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/bar"}
+	mkEdge := func(image reg.ImageName, digest reg.Digest, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: srcRC,
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      digest,
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("a", "sha256:111", "1.0"): nil,
+		mkEdge("b", "sha256:222", "2.0"): nil,
+	}
+
+	sc := reg.SyncContext{
+		RegistryContexts: []reg.RegistryContext{srcRC, dstRC},
+		Inv: reg.MasterInventory{
+			"gcr.io/bar": reg.RegInvImage{
+				"a": reg.DigestTags{"sha256:999": reg.TagSlice{"stale"}},
+			},
+		},
+		DigestMediaType: make(reg.DigestMediaType),
+		DigestImageSize: make(reg.DigestImageSize),
+		DigestUploaded:  make(reg.DigestUploaded),
+	}
+	snapshot := func(listings map[string]string) (reg.MasterInventory, error) {
+		return sc.DestinationSnapshot(
+			edges,
+			func(sc *reg.SyncContext, rc reg.RegistryContext) stream.Producer {
+				return &stream.Fake{Bytes: []byte(listings[string(rc.Name)])}
+			},
+		)
+	}
+
+	before, err := snapshot(map[string]string{
+		"gcr.io/bar/a": fakeListing("a", map[string]string{"sha256:000": "1.0"}),
+		"gcr.io/bar/b": fakeListing("b", nil),
+	})
+	require.Nil(t, err)
+	require.Equal(t, reg.MasterInventory{
+		"gcr.io/bar": reg.RegInvImage{
+			"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+		},
+	}, before)
+
+	after, err := snapshot(map[string]string{
+		"gcr.io/bar/a": fakeListing("a", map[string]string{
+			"sha256:000": "",
+			"sha256:111": "1.0",
+		}),
+		"gcr.io/bar/b": fakeListing("b", map[string]string{"sha256:222": "2.0"}),
+	})
+	require.Nil(t, err)
+
+	// The inventory of the promotion is left as it is.
+	require.Equal(t, reg.TagSlice{"stale"}, sc.Inv["gcr.io/bar"]["a"]["sha256:999"])
+
+	require.Equal(t, []reg.DestinationChanges{
+		{
+			Registry: "gcr.io/bar",
+			Changes: []reg.SnapshotChange{
+				{Kind: reg.DigestAdded, Image: "a", Digest: "sha256:111"},
+				{
+					Kind:           reg.TagMoved,
+					Image:          "a",
+					Tag:            "1.0",
+					Digest:         "sha256:111",
+					PreviousDigest: "sha256:000",
+				},
+				{Kind: reg.DigestAdded, Image: "b", Digest: "sha256:222"},
+				{Kind: reg.TagAdded, Image: "b", Tag: "2.0", Digest: "sha256:222"},
+			},
+		},
+	}, reg.DiffDestinations(before, after))
+
+	_, err = snapshot(map[string]string{
+		"gcr.io/bar/a": "not a listing",
+		"gcr.io/bar/b": fakeListing("b", nil),
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "destination repositories could not be read")
+}
+
+func TestDiffDestinations(t *testing.T) {
+	before := reg.MasterInventory{
+		"gcr.io/bar": reg.RegInvImage{
+			"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+		},
+		"gcr.io/cat": reg.RegInvImage{
+			"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+		},
+	}
+	after := reg.MasterInventory{
+		"gcr.io/bar": reg.RegInvImage{
+			"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0", "latest"}},
+		},
+		"gcr.io/cat": reg.RegInvImage{
+			"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+		},
+	}
+
+	require.Equal(t, []reg.DestinationChanges{
+		{
+			Registry: "gcr.io/bar",
+			Changes: []reg.SnapshotChange{
+				{Kind: reg.TagAdded, Image: "a", Tag: "latest", Digest: "sha256:000"},
+			},
+		},
+		{
+			Registry: "gcr.io/cat",
+			Changes:  []reg.SnapshotChange{},
+		},
+	}, reg.DiffDestinations(before, after))
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StorageProjection is the storage usage of a destination registry, before
+// and after a promotion.
+type StorageProjection struct {
+	Registry RegistryName
+	// Current is the size of all images found in the registry.
+	Current int64
+	// Added is the size of all images the promotion copies into the
+	// registry.
+	Added int64
+}
+
+// Total is the projected storage usage of the registry after the promotion.
+func (p StorageProjection) Total() int64 {
+	return p.Current + p.Added
+}
+
+// ProjectStorage computes the storage usage of every destination registry of
+// the edges, using the image sizes recorded while reading the registries. Each
+// digest is only counted once per registry, as registries deduplicate the
+// stored images. Only the repositories read into sc.Inv add to the current
+// usage.
+func (sc *SyncContext) ProjectStorage(
+	edges map[PromotionEdge]interface{},
+) []StorageProjection {
+	added := make(map[RegistryName]map[Digest]interface{})
+	for edge := range edges {
+		dst := edge.DstRegistry.Name
+		if _, ok := added[dst]; !ok {
+			added[dst] = make(map[Digest]interface{})
+		}
+
+		added[dst][edge.Digest] = nil
+	}
+
+	projections := make([]StorageProjection, 0, len(added))
+	for dst, digests := range added {
+		present := make(map[Digest]interface{})
+		for _, digestTags := range sc.Inv[dst] {
+			for digest := range digestTags {
+				present[digest] = nil
+			}
+		}
+
+		p := StorageProjection{Registry: dst}
+		for digest := range present {
+			p.Current += int64(sc.DigestImageSize[digest])
+		}
+
+		for digest := range digests {
+			if _, ok := present[digest]; ok {
+				continue
+			}
+
+			p.Added += int64(sc.DigestImageSize[digest])
+		}
+
+		projections = append(projections, p)
+	}
+
+	sort.Slice(projections, func(i, j int) bool {
+		return projections[i].Registry < projections[j].Registry
+	})
+
+	return projections
+}
+
+// CheckQuota reports the projected storage usage of every destination
+// registry against quotaBytes. It warns about the registries reaching
+// warnPercent of the quota, and fails for the registries exceeding the quota,
+// unless ignore is true.
+func CheckQuota(
+	projections []StorageProjection,
+	quotaBytes int64,
+	warnPercent int,
+	ignore bool,
+) error {
+	exceeded := make([]string, 0)
+
+	for _, p := range projections {
+		percent := p.Total() * 100 / quotaBytes
+		msg := fmt.Sprintf(
+			"%s: projected storage %d bytes (%d current + %d added), %d%% of the quota of %d bytes",
+			p.Registry,
+			p.Total(),
+			p.Current,
+			p.Added,
+			percent,
+			quotaBytes,
+		)
+
+		switch {
+		case p.Total() > quotaBytes && !ignore:
+			exceeded = append(exceeded, msg)
+		case p.Total() > quotaBytes || percent >= int64(warnPercent):
+			logrus.Warnf("Storage quota: %s", msg)
+		default:
+			logrus.Infof("Storage quota: %s", msg)
+		}
+	}
+
+	if len(exceeded) > 0 {
+		return fmt.Errorf(
+			"%d destination registries would exceed the storage quota: %s",
+			len(exceeded),
+			strings.Join(exceeded, "; "),
+		)
+	}
+
+	return nil
+}
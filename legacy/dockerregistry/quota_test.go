@@ -0,0 +1,190 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestProjectStorage(t *testing.T) {
+	mkEdge := func(dst reg.RegistryName, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src", Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: "a", Tag: reg.Tag(digest)},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: dst},
+			DstImageTag: reg.ImageTag{ImageName: "a", Tag: reg.Tag(digest)},
+		}
+	}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			"gcr.io/bar": reg.RegInvImage{
+				"a": reg.DigestTags{"sha256:111": {"old"}},
+				"b": reg.DigestTags{"sha256:111": {"old"}},
+			},
+		},
+		DigestImageSize: reg.DigestImageSize{
+			"sha256:111": 100,
+			"sha256:222": 20,
+			"sha256:333": 3,
+		},
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("gcr.io/bar", "sha256:111"): nil,
+		mkEdge("gcr.io/bar", "sha256:222"): nil,
+		mkEdge("gcr.io/foo", "sha256:222"): nil,
+		mkEdge("gcr.io/foo", "sha256:333"): nil,
+	}
+
+	require.Equal(
+		t,
+		[]reg.StorageProjection{
+			{Registry: "gcr.io/bar", Current: 100, Added: 20},
+			{Registry: "gcr.io/foo", Current: 0, Added: 23},
+		},
+		sc.ProjectStorage(edges),
+	)
+}
+
+func TestCheckQuota(t *testing.T) {
+	projections := []reg.StorageProjection{
+		{Registry: "gcr.io/bar", Current: 60, Added: 20},
+		{Registry: "gcr.io/foo", Current: 90, Added: 20},
+	}
+
+	tests := []struct {
+		name       string
+		quotaBytes int64
+		ignore     bool
+		expectErr  bool
+	}{
+		{
+			"Under the quota",
+			200,
+			false,
+			false,
+		},
+		{
+			"Exactly at the quota",
+			110,
+			false,
+			false,
+		},
+		{
+			"Over the quota",
+			100,
+			false,
+			true,
+		},
+		{
+			"Over the quota, but ignored",
+			100,
+			true,
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		err := reg.CheckQuota(projections, test.quotaBytes, 80, test.ignore)
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			require.Contains(t, err.Error(), "gcr.io/foo", test.name)
+			require.NotContains(t, err.Error(), "gcr.io/bar", test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+	}
+}
+
+func TestCheckQuotaHeadroom(t *testing.T) {
+	edges := map[reg.PromotionEdge]interface{}{
+		{DstRegistry: reg.RegistryContext{Name: "us-docker.pkg.dev/prod-b/images"}}: nil,
+		{DstRegistry: reg.RegistryContext{Name: "gcr.io/prod-a"}}:                   nil,
+		{DstRegistry: reg.RegistryContext{Name: "gcr.io/prod-a/mirror"}}:            nil,
+		{DstRegistry: reg.RegistryContext{Name: "localhost"}}:                       nil,
+	}
+	projects := reg.DestinationProjects(edges)
+	require.Equal(t, []string{"prod-a", "prod-b"}, projects)
+
+	mkProducer := func(usage map[string]int64, failing string) reg.QuotaUsageProducer {
+		return func(project, metric string) (reg.QuotaUsage, error) {
+			if project == failing {
+				return reg.QuotaUsage{}, errors.New("API unavailable")
+			}
+			return reg.QuotaUsage{
+				Project: project,
+				Metric:  metric,
+				Usage:   usage[project],
+				Limit:   1000,
+			}, nil
+		}
+	}
+
+	tests := []struct {
+		name        string
+		usage       map[string]int64
+		failing     string
+		strict      bool
+		expectedErr string
+	}{
+		{
+			name:  "Enough headroom",
+			usage: map[string]int64{"prod-a": 100, "prod-b": 900},
+		},
+		{
+			name:        "Too little headroom",
+			usage:       map[string]int64{"prod-a": 950, "prod-b": 100},
+			expectedErr: "1 projects have less than 10% quota headroom left: prod-a: requests at 950 of 1000, 5% free",
+		},
+		{
+			name:    "Unavailable quota only warns",
+			usage:   map[string]int64{"prod-a": 100},
+			failing: "prod-b",
+		},
+		{
+			name:        "Unavailable quota fails when strict",
+			usage:       map[string]int64{"prod-a": 100},
+			failing:     "prod-b",
+			strict:      true,
+			expectedErr: "unable to check the quota of 1 projects: prod-b (API unavailable)",
+		},
+	}
+
+	for _, test := range tests {
+		err := reg.CheckQuotaHeadroom(
+			projects,
+			"requests",
+			10,
+			test.strict,
+			mkProducer(test.usage, test.failing),
+		)
+		if test.expectedErr == "" {
+			require.Nil(t, err, test.name)
+		} else {
+			require.Error(t, err, test.name)
+			require.Equal(t, test.expectedErr, err.Error(), test.name)
+		}
+	}
+}
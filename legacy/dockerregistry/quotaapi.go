@@ -0,0 +1,238 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	monitoring "google.golang.org/api/monitoring/v3"
+)
+
+const (
+	// The Cloud Monitoring metrics holding the usage of allocation and rate
+	// quotas, in the order they are tried.
+	quotaAllocationUsageMetricType = "serviceruntime.googleapis.com/quota/allocation/usage"
+	quotaRateUsageMetricType       = "serviceruntime.googleapis.com/quota/rate/net_usage"
+
+	// quotaLimitMetricType is the Cloud Monitoring metric holding the limits
+	// of quotas.
+	quotaLimitMetricType = "serviceruntime.googleapis.com/quota/limit"
+
+	// quotaLookback is how far back the quota metrics are read.
+	quotaLookback = time.Hour
+)
+
+// QuotaUsage is the usage of a quota metric in a GCP project, against its
+// limit.
+type QuotaUsage struct {
+	Project string
+	Metric  string
+	Usage   int64
+	Limit   int64
+}
+
+// FreePercent is the share of the limit which is still available.
+func (q QuotaUsage) FreePercent() int64 {
+	if q.Limit <= 0 {
+		return 100
+	}
+
+	free := (q.Limit - q.Usage) * 100 / q.Limit
+	if free < 0 {
+		return 0
+	}
+
+	return free
+}
+
+// QuotaUsageProducer looks up the usage of the quota metric in the GCP
+// project, and allows for custom producers for testing.
+type QuotaUsageProducer func(project, metric string) (QuotaUsage, error)
+
+// DestinationProjects returns the GCP projects of the destination registries
+// of the edges (the first path component of their name), sorted.
+func DestinationProjects(edges map[PromotionEdge]interface{}) []string {
+	seen := make(map[string]interface{})
+	for edge := range edges {
+		parts := strings.Split(string(edge.DstRegistry.Name), "/")
+		if len(parts) < 2 {
+			logrus.Warnf(
+				"Cannot tell the GCP project of registry %s; not checking its quota",
+				edge.DstRegistry.Name,
+			)
+			continue
+		}
+
+		seen[parts[1]] = nil
+	}
+
+	projects := make([]string, 0, len(seen))
+	for project := range seen {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+
+	return projects
+}
+
+// CheckQuotaHeadroom fails if less than headroomPercent of the limit of the
+// quota metric is left in any of the projects. Projects whose quota cannot be
+// looked up only cause a warning, unless strict is true. All projects are
+// reported together.
+func CheckQuotaHeadroom(
+	projects []string,
+	metric string,
+	headroomPercent int,
+	strict bool,
+	producer QuotaUsageProducer,
+) error {
+	exhausted := make([]string, 0)
+	unavailable := make([]string, 0)
+
+	for _, project := range projects {
+		usage, err := producer(project, metric)
+		if err != nil {
+			unavailable = append(unavailable, fmt.Sprintf("%s (%v)", project, err))
+			continue
+		}
+
+		msg := fmt.Sprintf(
+			"%s: %s at %d of %d, %d%% free",
+			project,
+			metric,
+			usage.Usage,
+			usage.Limit,
+			usage.FreePercent(),
+		)
+		if usage.FreePercent() < int64(headroomPercent) {
+			exhausted = append(exhausted, msg)
+			continue
+		}
+
+		logrus.Infof("Quota headroom: %s", msg)
+	}
+
+	if len(unavailable) > 0 {
+		msg := fmt.Sprintf(
+			"unable to check the quota of %d projects: %s",
+			len(unavailable),
+			strings.Join(unavailable, ", "),
+		)
+		if strict {
+			return errors.New(msg)
+		}
+
+		logrus.Warn(msg)
+	}
+
+	if len(exhausted) > 0 {
+		return fmt.Errorf(
+			"%d projects have less than %d%% quota headroom left: %s",
+			len(exhausted),
+			headroomPercent,
+			strings.Join(exhausted, ", "),
+		)
+	}
+
+	return nil
+}
+
+// MkMonitoringQuotaProducer returns a QuotaUsageProducer which reads the
+// usage and the limit of quota metrics from the Cloud Monitoring API. The
+// latest usage is compared against the lowest limit of the metric.
+func MkMonitoringQuotaProducer(ctx context.Context) (QuotaUsageProducer, error) {
+	svc, err := monitoring.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating Cloud Monitoring client: %w", err)
+	}
+
+	return func(project, metric string) (QuotaUsage, error) {
+		usage := QuotaUsage{Project: project, Metric: metric}
+
+		end := time.Now()
+		start := end.Add(-quotaLookback)
+		latest := func(metricType string, pick func(current, value int64) bool) (int64, bool, error) {
+			resp, err := svc.Projects.TimeSeries.List("projects/" + project).
+				Filter(fmt.Sprintf(
+					"metric.type=%q AND metric.label.quota_metric=%q",
+					metricType,
+					metric,
+				)).
+				IntervalStartTime(start.Format(time.RFC3339)).
+				IntervalEndTime(end.Format(time.RFC3339)).
+				Context(ctx).
+				Do()
+			if err != nil {
+				return 0, false, err
+			}
+
+			var (
+				result int64
+				found  bool
+			)
+			for _, ts := range resp.TimeSeries {
+				// Points are returned newest first.
+				if len(ts.Points) == 0 || ts.Points[0].Value == nil ||
+					ts.Points[0].Value.Int64Value == nil {
+					continue
+				}
+
+				value := *ts.Points[0].Value.Int64Value
+				if !found || pick(result, value) {
+					result, found = value, true
+				}
+			}
+
+			return result, found, nil
+		}
+
+		higher := func(current, value int64) bool { return value > current }
+		lower := func(current, value int64) bool { return value < current }
+
+		limit, found, err := latest(quotaLimitMetricType, lower)
+		if err != nil {
+			return usage, fmt.Errorf("reading the limit of %s: %w", metric, err)
+		}
+		if !found {
+			return usage, fmt.Errorf("no limit found for quota metric %s", metric)
+		}
+		usage.Limit = limit
+
+		for _, metricType := range []string{
+			quotaAllocationUsageMetricType,
+			quotaRateUsageMetricType,
+		} {
+			value, found, err := latest(metricType, higher)
+			if err != nil {
+				return usage, fmt.Errorf("reading the usage of %s: %w", metric, err)
+			}
+			if found {
+				usage.Usage = value
+				return usage, nil
+			}
+		}
+
+		// Without any recorded usage, the quota has not been used recently.
+		return usage, nil
+	}, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RampUpWorkers calls start once for each of the workers of a worker pool.
+// With a positive ramp, only the first worker is started right away, and the
+// others are started at even intervals so that all of them are running once
+// ramp has passed; this slow start gives the registries time to scale up
+// before they see the full load. A ramp too short to be split into intervals
+// starts all the workers at once. The returned function stops the ramp (if it
+// is still going) and waits until no more workers can be started.
+func RampUpWorkers(workers int, ramp time.Duration, start func()) (stop func()) {
+	var interval time.Duration
+	if workers > 1 {
+		interval = ramp / time.Duration(workers-1)
+	}
+
+	if interval <= 0 {
+		for w := 0; w < workers; w++ {
+			start()
+		}
+
+		return func() {}
+	}
+
+	start()
+	logrus.Infof("Ramping up from 1 to %d workers over %v", workers, ramp)
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for started := 1; started < workers; {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				start()
+				started++
+				logrus.Infof("Ramped up to %d of %d workers", started, workers)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
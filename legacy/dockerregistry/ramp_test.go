@@ -0,0 +1,66 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestRampUpWorkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		ramp    time.Duration
+		initial int32
+	}{
+		{"no ramp", 4, 0, 4},
+		{"single worker", 1, time.Hour, 1},
+		{"ramp", 4, 30 * time.Millisecond, 1},
+		{"ramp shorter than the intervals", 4, 2 * time.Nanosecond, 4},
+	}
+
+	for _, test := range tests {
+		var started int32
+		stop := reg.RampUpWorkers(test.workers, test.ramp, func() {
+			atomic.AddInt32(&started, 1)
+		})
+		require.Equal(t, test.initial, atomic.LoadInt32(&started), test.name)
+
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt32(&started) == int32(test.workers)
+		}, time.Second, 5*time.Millisecond, test.name)
+
+		stop()
+		require.Equal(t, int32(test.workers), atomic.LoadInt32(&started), test.name)
+	}
+}
+
+func TestRampUpWorkersStop(t *testing.T) {
+	var started int32
+	stop := reg.RampUpWorkers(10, time.Hour, func() {
+		atomic.AddInt32(&started, 1)
+	})
+	stop()
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&started))
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ReplayEdges returns the edges listed by the checkpoint of a past run (see
+// Checkpointer), so that exactly those edges can be promoted again against
+// the current state of the registries. The digests are pinned as recorded,
+// not resolved from tags again. The registries of the entries must be
+// registries of sc, which provide their credentials.
+func (sc *SyncContext) ReplayEdges(cp *Checkpoint) (map[PromotionEdge]interface{}, error) {
+	// sc.RegistryContexts is sorted with the longest names first, as
+	// SplitRegistryImagePath expects.
+	knownRegistries := make([]RegistryName, 0, len(sc.RegistryContexts))
+	for _, rc := range sc.RegistryContexts {
+		knownRegistries = append(knownRegistries, rc.Name)
+	}
+
+	edges := make(map[PromotionEdge]interface{})
+	for _, entry := range cp.Completed {
+		edge, err := sc.replayEdge(entry, knownRegistries)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"replaying %s -> %s: %w",
+				entry.Source,
+				entry.Destination,
+				err,
+			)
+		}
+
+		edges[edge] = nil
+	}
+
+	return CheckOverlappingEdges(edges)
+}
+
+// replayEdge converts a CheckpointEntry back to the edge it was made of.
+func (sc *SyncContext) replayEdge(
+	entry CheckpointEntry,
+	knownRegistries []RegistryName,
+) (PromotionEdge, error) {
+	i := strings.LastIndexByte(entry.Source, '@')
+	if i < 0 {
+		return PromotionEdge{}, fmt.Errorf("source %q has no digest", entry.Source)
+	}
+
+	srcRegistry, srcImage, err := SplitRegistryImagePath(
+		RegistryImagePath(entry.Source[:i]),
+		knownRegistries,
+	)
+	if err != nil {
+		return PromotionEdge{}, err
+	}
+	digest := Digest(entry.Source[i+1:])
+
+	dstPath := entry.Destination
+	var tag Tag
+	if i := strings.LastIndexByte(dstPath, '@'); i >= 0 {
+		if Digest(dstPath[i+1:]) != digest {
+			return PromotionEdge{}, fmt.Errorf(
+				"destination digest differs from the source digest %s",
+				digest,
+			)
+		}
+		dstPath = dstPath[:i]
+	} else if i := strings.LastIndexByte(dstPath, ':'); i > strings.LastIndexByte(dstPath, '/') {
+		tag = Tag(dstPath[i+1:])
+		dstPath = dstPath[:i]
+	} else {
+		return PromotionEdge{}, fmt.Errorf(
+			"destination %q has neither a tag nor a digest",
+			entry.Destination,
+		)
+	}
+
+	dstRegistry, dstImage, err := SplitRegistryImagePath(
+		RegistryImagePath(dstPath),
+		knownRegistries,
+	)
+	if err != nil {
+		return PromotionEdge{}, err
+	}
+
+	return PromotionEdge{
+		SrcRegistry: sc.registryContext(srcRegistry),
+		SrcImageTag: ImageTag{ImageName: srcImage, Tag: tag},
+		Digest:      digest,
+		DstRegistry: sc.registryContext(dstRegistry),
+		DstImageTag: ImageTag{ImageName: dstImage, Tag: tag},
+	}, nil
+}
+
+// MissingSources returns the edges which cannot be promoted because their
+// source digest no longer exists in the inventory, sorted by their
+// destination. Edges whose destination is already in place are not missing
+// anything.
+func (sc *SyncContext) MissingSources(edges map[PromotionEdge]interface{}) []CheckpointEntry {
+	missing := make([]CheckpointEntry, 0)
+	for edge := range edges {
+		sp, dp := edge.VertexProps(&sc.Inv)
+		if sp.DigestExists || dp.PqinDigestMatch {
+			continue
+		}
+		if edge.DstImageTag.Tag == "" && dp.DigestExists {
+			continue
+		}
+
+		missing = append(missing, checkpointEntry(PromotionRequest{
+			RegistrySrc:   edge.SrcRegistry.Name,
+			RegistryDest:  edge.DstRegistry.Name,
+			ImageNameSrc:  edge.SrcImageTag.ImageName,
+			ImageNameDest: edge.DstImageTag.ImageName,
+			Digest:        edge.Digest,
+			Tag:           edge.DstImageTag.Tag,
+		}))
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].Destination < missing[j].Destination
+	})
+
+	return missing
+}
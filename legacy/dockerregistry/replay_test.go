@@ -0,0 +1,159 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestReplayEdges(t *testing.T) {
+	src := reg.RegistryContext{Name: "gcr.io/foo", Src: true}
+	dst := reg.RegistryContext{Name: "us.gcr.io/bar", ServiceAccount: "sa@example.com"}
+	sc := reg.SyncContext{
+		// Sorted with the longest names first.
+		RegistryContexts: []reg.RegistryContext{dst, src},
+	}
+
+	tests := []struct {
+		name        string
+		entries     []reg.CheckpointEntry
+		expected    map[reg.PromotionEdge]interface{}
+		expectedErr string
+	}{
+		{
+			name: "tagged and tagless edges",
+			entries: []reg.CheckpointEntry{
+				{
+					Source:      "gcr.io/foo/a/b@sha256:000",
+					Destination: "us.gcr.io/bar/a/b:1.0",
+				},
+				{
+					Source:      "gcr.io/foo/c@sha256:111",
+					Destination: "us.gcr.io/bar/c@sha256:111",
+				},
+			},
+			expected: map[reg.PromotionEdge]interface{}{
+				{
+					SrcRegistry: src,
+					SrcImageTag: reg.ImageTag{ImageName: "a/b", Tag: "1.0"},
+					Digest:      "sha256:000",
+					DstRegistry: dst,
+					DstImageTag: reg.ImageTag{ImageName: "a/b", Tag: "1.0"},
+				}: nil,
+				{
+					SrcRegistry: src,
+					SrcImageTag: reg.ImageTag{ImageName: "c"},
+					Digest:      "sha256:111",
+					DstRegistry: dst,
+					DstImageTag: reg.ImageTag{ImageName: "c"},
+				}: nil,
+			},
+		},
+		{
+			name: "source without digest",
+			entries: []reg.CheckpointEntry{
+				{Source: "gcr.io/foo/a:1.0", Destination: "us.gcr.io/bar/a:1.0"},
+			},
+			expectedErr: `source "gcr.io/foo/a:1.0" has no digest`,
+		},
+		{
+			name: "unknown registry",
+			entries: []reg.CheckpointEntry{
+				{Source: "gcr.io/foo/a@sha256:000", Destination: "eu.gcr.io/baz/a:1.0"},
+			},
+			expectedErr: "could not determine registry name for 'eu.gcr.io/baz/a'",
+		},
+		{
+			name: "destination digest mismatch",
+			entries: []reg.CheckpointEntry{
+				{Source: "gcr.io/foo/a@sha256:000", Destination: "us.gcr.io/bar/a@sha256:111"},
+			},
+			expectedErr: "destination digest differs from the source digest sha256:000",
+		},
+		{
+			name: "destination without tag",
+			entries: []reg.CheckpointEntry{
+				{Source: "gcr.io/foo/a@sha256:000", Destination: "us.gcr.io/bar/a"},
+			},
+			expectedErr: `destination "us.gcr.io/bar/a" has neither a tag nor a digest`,
+		},
+	}
+
+	for _, test := range tests {
+		edges, err := sc.ReplayEdges(&reg.Checkpoint{Completed: test.entries})
+		if test.expectedErr != "" {
+			require.Error(t, err, test.name)
+			require.Contains(t, err.Error(), test.expectedErr, test.name)
+			continue
+		}
+
+		require.Nil(t, err, test.name)
+		require.Equal(t, test.expected, edges, test.name)
+	}
+}
+
+func TestMissingSources(t *testing.T) {
+	src := reg.RegistryContext{Name: "gcr.io/foo", Src: true}
+	dst := reg.RegistryContext{Name: "us.gcr.io/bar"}
+	mkEdge := func(image reg.ImageName, digest reg.Digest, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: src,
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      digest,
+			DstRegistry: dst,
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			"gcr.io/foo": reg.RegInvImage{
+				"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+			},
+			"us.gcr.io/bar": reg.RegInvImage{
+				"b": reg.DigestTags{"sha256:111": reg.TagSlice{"1.0"}},
+				"c": reg.DigestTags{"sha256:222": reg.TagSlice{}},
+			},
+		},
+	}
+
+	missing := sc.MissingSources(map[reg.PromotionEdge]interface{}{
+		// The source exists.
+		mkEdge("a", "sha256:000", "1.0"): nil,
+		// The destination is already in place.
+		mkEdge("b", "sha256:111", "1.0"): nil,
+		mkEdge("c", "sha256:222", ""):    nil,
+		// Gone.
+		mkEdge("d", "sha256:333", "1.0"): nil,
+		mkEdge("c", "sha256:444", ""):    nil,
+	})
+
+	require.Equal(t, []reg.CheckpointEntry{
+		{
+			Source:      "gcr.io/foo/c@sha256:444",
+			Destination: "us.gcr.io/bar/c@sha256:444",
+		},
+		{
+			Source:      "gcr.io/foo/d@sha256:333",
+			Destination: "us.gcr.io/bar/d:1.0",
+		},
+	}, missing)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// ErrSourceTagMoved is the error of a request which was aborted because its
+// source tag no longer points to the digest pinned by the manifest.
+var ErrSourceTagMoved = errors.New("source tag moved")
+
+// VerifySourceTag resolves the source tag of the request again, and returns
+// ErrSourceTagMoved if it now points to a digest other than the one being
+// promoted. Tagless requests, and requests whose tag does not exist in the
+// source registry, have nothing to verify.
+func (sc *SyncContext) VerifySourceTag(req PromotionRequest) error {
+	if req.Tag == "" {
+		return nil
+	}
+
+	src := ToPQIN(req.RegistrySrc, req.ImageNameSrc, req.Tag)
+	actual, err := crane.Digest(src, sc.copyOptions()...)
+	if err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+
+		return fmt.Errorf("resolving %s: %w", src, err)
+	}
+
+	if Digest(actual) != req.Digest {
+		return fmt.Errorf(
+			"%w: %s now points to %s instead of %s",
+			ErrSourceTagMoved,
+			src,
+			sc.displayDigest(Digest(actual)),
+			sc.displayDigest(req.Digest),
+		)
+	}
+
+	return nil
+}
+
+// reverifySourceTag verifies the source tag of the request right before it is
+// copied, if sc.ReverifyBeforeCopy is set.
+func (sc *SyncContext) reverifySourceTag(req PromotionRequest) error {
+	if !sc.ReverifyBeforeCopy {
+		return nil
+	}
+
+	err := sc.VerifySourceTag(req)
+	sc.tracef(req, "re-verified the source tag: %v", err)
+	return err
+}
+
+// SourceTagMoves lists the errors of the requests which Promote aborted
+// because their source tag had moved, in order.
+func (sc *SyncContext) SourceTagMoves() []string {
+	moves := make([]string, 0)
+	for _, result := range sc.PromotionResults {
+		for _, e := range result.Errors {
+			if errors.Is(e.Error, ErrSourceTagMoved) {
+				moves = append(moves, e.Error.Error())
+			}
+		}
+	}
+	sort.Strings(moves)
+
+	return moves
+}
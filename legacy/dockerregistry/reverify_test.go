@@ -0,0 +1,88 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestVerifySourceTag(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	srcRegName := reg.RegistryName(
+		strings.TrimPrefix(server.URL, "http://") + "/staging",
+	)
+
+	pushRandom := func(ref string) reg.Digest {
+		img, err := random.Image(256, 1)
+		require.Nil(t, err)
+		require.Nil(t, crane.Push(img, ref))
+
+		hash, err := img.Digest()
+		require.Nil(t, err)
+		return reg.Digest(hash.String())
+	}
+
+	pinned := pushRandom(string(srcRegName) + "/foo:1.0")
+	pushRandom(string(srcRegName) + "/foo:2.0")
+
+	mkRequest := func(tag reg.Tag) reg.PromotionRequest {
+		return reg.PromotionRequest{
+			RegistrySrc:   srcRegName,
+			RegistryDest:  "gcr.io/prod",
+			ImageNameSrc:  "foo",
+			ImageNameDest: "foo",
+			Digest:        pinned,
+			Tag:           tag,
+		}
+	}
+
+	sc := reg.SyncContext{}
+
+	// The tag still points to the pinned digest.
+	require.Nil(t, sc.VerifySourceTag(mkRequest("1.0")))
+
+	// Tagless requests and tags missing from the source have nothing to
+	// verify.
+	require.Nil(t, sc.VerifySourceTag(mkRequest("")))
+	require.Nil(t, sc.VerifySourceTag(mkRequest("3.0")))
+
+	// The tag points to another digest.
+	err := sc.VerifySourceTag(mkRequest("2.0"))
+	require.Error(t, err)
+	require.True(t, errors.Is(err, reg.ErrSourceTagMoved))
+
+	sc.PromotionResults = []reg.PromotionResult{
+		{Request: mkRequest("1.0")},
+		{
+			Request: mkRequest("2.0"),
+			Errors:  reg.Errors{{Context: "re-verifying the source tag", Error: err}},
+		},
+	}
+	require.Equal(t, []string{err.Error()}, sc.SourceTagMoves())
+}
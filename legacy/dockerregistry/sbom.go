@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/sirupsen/logrus"
+)
+
+// cosignSBOMTagSuffix is appended to the digest of an image (with the ':'
+// replaced by a '-') to get the tag of the SBOM attached with 'cosign attach
+// sbom'.
+const cosignSBOMTagSuffix = ".sbom"
+
+// SBOMArtifactTypes are the artifact types of referrers which are accepted as
+// an SBOM.
+var SBOMArtifactTypes = []string{
+	"application/spdx+json",
+	"text/spdx",
+	"application/vnd.cyclonedx+json",
+	"application/vnd.cyclonedx+xml",
+	"application/vnd.syft+json",
+}
+
+// referrersIndex is the part of an OCI referrers index which describes the
+// artifacts referring to an image.
+type referrersIndex struct {
+	Manifests []struct {
+		ArtifactType string            `json:"artifactType"`
+		Annotations  map[string]string `json:"annotations"`
+	} `json:"manifests"`
+}
+
+// SBOMChecker checks that images have an SBOM attached, either as a referrer
+// with one of the SBOMArtifactTypes (found through the referrers tag schema),
+// or with the cosign tag scheme. The result of each image is cached for the
+// lifetime of the SBOMChecker.
+type SBOMChecker struct {
+	mutex sync.Mutex
+	cache map[string]error
+}
+
+// NewSBOMChecker creates an SBOMChecker.
+func NewSBOMChecker() *SBOMChecker {
+	return &SBOMChecker{cache: make(map[string]error)}
+}
+
+// Check returns nil if the image has an SBOM attached.
+func (c *SBOMChecker) Check(
+	registryName RegistryName,
+	imageName ImageName,
+	digest Digest,
+	opts ...crane.Option,
+) error {
+	key := ToFQIN(registryName, imageName, digest)
+
+	c.mutex.Lock()
+	err, ok := c.cache[key]
+	c.mutex.Unlock()
+	if ok {
+		return err
+	}
+
+	err = c.check(registryName, imageName, digest, opts...)
+
+	c.mutex.Lock()
+	c.cache[key] = err
+	c.mutex.Unlock()
+
+	return err
+}
+
+func (c *SBOMChecker) check(
+	registryName RegistryName,
+	imageName ImageName,
+	digest Digest,
+	opts ...crane.Option,
+) error {
+	digestTag := strings.Replace(string(digest), ":", "-", 1)
+
+	// Referrers of the image, as stored by registries without the referrers
+	// API.
+	b, err := crane.Manifest(
+		ToPQIN(registryName, imageName, Tag(digestTag)),
+		opts...,
+	)
+	if err == nil {
+		var index referrersIndex
+		if err := json.Unmarshal(b, &index); err != nil {
+			logrus.Debugf("malformed referrers index for %s: %v", digest, err)
+		}
+
+		for _, manifest := range index.Manifests {
+			for _, artifactType := range SBOMArtifactTypes {
+				if manifest.ArtifactType == artifactType {
+					return nil
+				}
+			}
+		}
+	}
+
+	if _, err := crane.Head(
+		ToPQIN(registryName, imageName, Tag(digestTag+cosignSBOMTagSuffix)),
+		opts...,
+	); err != nil {
+		return fmt.Errorf("no SBOM found: %w", err)
+	}
+
+	return nil
+}
+
+// FilterEdgesWithSBOM checks that the source image of every edge has an SBOM
+// attached. All images without an SBOM are reported together; they are either
+// dropped from the returned edges (if drop is true), or cause an error.
+func (sc *SyncContext) FilterEdgesWithSBOM(
+	edges map[PromotionEdge]interface{},
+	checker *SBOMChecker,
+	drop bool,
+) (map[PromotionEdge]interface{}, error) {
+	return sc.filterSourceEdges(
+		edges,
+		func(edge PromotionEdge) error {
+			return checker.Check(
+				edge.SrcRegistry.Name,
+				edge.SrcImageTag.ImageName,
+				edge.Digest,
+				sc.copyOptions()...,
+			)
+		},
+		drop,
+		"have no SBOM",
+	)
+}
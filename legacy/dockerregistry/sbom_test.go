@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// pushImageWithSBOM pushes a random image to repo, together with an SBOM
+// attached according to scheme ("cosign", "referrers" or "" for no SBOM).
+func pushImageWithSBOM(
+	t *testing.T,
+	server *httptest.Server,
+	repo string,
+	scheme string,
+) reg.Digest {
+	img, err := random.Image(512, 1)
+	require.Nil(t, err)
+	require.Nil(t, crane.Push(img, repo+":latest"))
+
+	hash, err := img.Digest()
+	require.Nil(t, err)
+	digestTag := strings.Replace(hash.String(), ":", "-", 1)
+
+	switch scheme {
+	case "cosign":
+		sbom, err := random.Image(128, 1)
+		require.Nil(t, err)
+		require.Nil(t, crane.Push(sbom, repo+":"+digestTag+".sbom"))
+	case "referrers":
+		sbom, err := random.Image(128, 1)
+		require.Nil(t, err)
+		require.Nil(t, crane.Push(sbom, repo+":sbom"))
+		sbomDigest, err := sbom.Digest()
+		require.Nil(t, err)
+
+		index := fmt.Sprintf(
+			`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":%q,"size":1,"artifactType":"application/spdx+json"}]}`,
+			sbomDigest.String(),
+		)
+		path := strings.TrimPrefix(repo, strings.TrimPrefix(server.URL, "http://")+"/")
+		req, err := http.NewRequest(
+			http.MethodPut,
+			server.URL+"/v2/"+path+"/manifests/"+digestTag,
+			bytes.NewBufferString(index),
+		)
+		require.Nil(t, err)
+		req.Header.Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	return reg.Digest(hash.String())
+}
+
+func TestFilterEdgesWithSBOM(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	srcRegName := reg.RegistryName(
+		strings.TrimPrefix(server.URL, "http://") + "/staging",
+	)
+
+	cosign := pushImageWithSBOM(t, server, string(srcRegName)+"/cosign", "cosign")
+	referrers := pushImageWithSBOM(t, server, string(srcRegName)+"/referrers", "referrers")
+	missing := pushImageWithSBOM(t, server, string(srcRegName)+"/missing", "")
+
+	mkEdge := func(image reg.ImageName, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: srcRegName},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: "latest"},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/prod"},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: "latest"},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("cosign", cosign):       nil,
+		mkEdge("referrers", referrers): nil,
+		mkEdge("missing", missing):     nil,
+	}
+
+	sc := reg.SyncContext{}
+	checker := reg.NewSBOMChecker()
+
+	_, err := sc.FilterEdgesWithSBOM(edges, checker, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 source images have no SBOM")
+	require.Contains(t, err.Error(), string(missing))
+
+	filtered, err := sc.FilterEdgesWithSBOM(edges, checker, true)
+	require.Nil(t, err)
+	require.Equal(t, map[reg.PromotionEdge]interface{}{
+		mkEdge("cosign", cosign):       nil,
+		mkEdge("referrers", referrers): nil,
+	}, filtered)
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	cr "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// schema1Manifest holds the parts of a Docker schema v1 manifest needed to
+// convert it to schema v2. Both lists are ordered from the topmost layer
+// down.
+type schema1Manifest struct {
+	FSLayers []struct {
+		BlobSum v1.Hash `json:"blobSum"`
+	} `json:"fsLayers"`
+	History []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+// v1Compatibility holds the history fields of a layer of a schema v1
+// manifest.
+type v1Compatibility struct {
+	Created         time.Time `json:"created"`
+	Author          string    `json:"author,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+	ContainerConfig struct {
+		Cmd []string `json:"Cmd"`
+	} `json:"container_config"`
+	ThrowAway bool `json:"throwaway,omitempty"`
+}
+
+// v1CompatibilityOnlyFields are the fields of the topmost v1Compatibility of a
+// schema v1 manifest which describe the layer rather than the image, and are
+// thus dropped from the converted image config.
+var v1CompatibilityOnlyFields = []string{
+	"id", "parent", "Size", "parent_id", "layer_id", "throwaway",
+}
+
+// UpgradeSchemaV1 copies the Docker schema v1 image at srcVertex to
+// dstVertex, converting it to schema v2: the image config is rebuilt from the
+// v1 history, and the layers are copied as they are. As the conversion
+// changes the digest of the image, a dstVertex referencing a digest is written
+// under the converted digest instead. It returns the digest written to the
+// destination.
+func UpgradeSchemaV1(
+	srcVertex, dstVertex string,
+	layerConcurrency int,
+	opts ...crane.Option,
+) (Digest, error) {
+	o := crane.GetOptions(opts...)
+	if layerConcurrency > 0 {
+		o.Remote = append(o.Remote, remote.WithJobs(layerConcurrency))
+	}
+
+	srcRef, err := name.ParseReference(srcVertex, o.Name...)
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := remote.Get(srcRef, o.Remote...)
+	if err != nil {
+		return "", fmt.Errorf("reading manifest %s: %w", srcVertex, err)
+	}
+
+	if desc.MediaType != cr.DockerManifestSchema1 &&
+		desc.MediaType != cr.DockerManifestSchema1Signed {
+		return "", fmt.Errorf(
+			"%s is not a schema v1 image (media type %s)",
+			srcVertex,
+			desc.MediaType,
+		)
+	}
+
+	img, err := upgradeSchema1Manifest(srcRef.Context(), desc.Manifest, o.Remote)
+	if err != nil {
+		return "", fmt.Errorf("converting %s to schema v2: %w", srcVertex, err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return "", fmt.Errorf("converting %s to schema v2: %w", srcVertex, err)
+	}
+
+	dstRef, err := name.ParseReference(dstVertex, o.Name...)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := dstRef.(name.Digest); ok {
+		dstRef = dstRef.Context().Digest(digest.String())
+	}
+
+	if err := remote.Write(dstRef, img, o.Remote...); err != nil {
+		return "", fmt.Errorf("writing image %s: %w", dstRef, err)
+	}
+
+	return Digest(digest.String()), nil
+}
+
+// upgradeSchema1Manifest builds the schema v2 image equivalent to the raw
+// schema v1 manifest, whose layers are read from repo. The diff IDs of the
+// layers are computed by reading them in full, as schema v1 does not record
+// them.
+func upgradeSchema1Manifest(
+	repo name.Repository,
+	raw []byte,
+	opts []remote.Option,
+) (v1.Image, error) {
+	var m schema1Manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, fmt.Errorf("parsing schema v1 manifest: %w", err)
+	}
+
+	if len(m.History) == 0 || len(m.FSLayers) != len(m.History) {
+		return nil, fmt.Errorf(
+			"schema v1 manifest has %d layers but %d history entries",
+			len(m.FSLayers),
+			len(m.History),
+		)
+	}
+
+	img := &schema1Image{layers: make(map[v1.Hash]v1.Layer)}
+	manifest := v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     cr.DockerManifestSchema2,
+	}
+	rootFS := v1.RootFS{Type: "layers", DiffIDs: []v1.Hash{}}
+	history := make([]v1.History, 0, len(m.History))
+
+	// Walk the layers from the bottom up, as schema v2 orders them.
+	for i := len(m.History) - 1; i >= 0; i-- {
+		var compat v1Compatibility
+		if err := json.Unmarshal([]byte(m.History[i].V1Compatibility), &compat); err != nil {
+			return nil, fmt.Errorf("parsing history entry %d: %w", i, err)
+		}
+
+		history = append(history, v1.History{
+			Author:     compat.Author,
+			Created:    v1.Time{Time: compat.Created},
+			CreatedBy:  strings.Join(compat.ContainerConfig.Cmd, " "),
+			Comment:    compat.Comment,
+			EmptyLayer: compat.ThrowAway,
+		})
+
+		if compat.ThrowAway {
+			continue
+		}
+
+		blobSum := m.FSLayers[i].BlobSum
+		layer, err := remote.Layer(repo.Digest(blobSum.String()), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("reading layer %s: %w", blobSum, err)
+		}
+
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return nil, fmt.Errorf("computing the diff ID of layer %s: %w", blobSum, err)
+		}
+
+		size, err := layer.Size()
+		if err != nil {
+			return nil, fmt.Errorf("reading the size of layer %s: %w", blobSum, err)
+		}
+
+		img.layers[blobSum] = layer
+		rootFS.DiffIDs = append(rootFS.DiffIDs, diffID)
+		manifest.Layers = append(manifest.Layers, v1.Descriptor{
+			MediaType: cr.DockerLayer,
+			Size:      size,
+			Digest:    blobSum,
+		})
+	}
+
+	// The topmost v1Compatibility holds the config of the image.
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(m.History[0].V1Compatibility), &config); err != nil {
+		return nil, fmt.Errorf("parsing image config: %w", err)
+	}
+
+	for _, field := range v1CompatibilityOnlyFields {
+		delete(config, field)
+	}
+
+	var err error
+	if config["rootfs"], err = json.Marshal(rootFS); err != nil {
+		return nil, err
+	}
+	if config["history"], err = json.Marshal(history); err != nil {
+		return nil, err
+	}
+
+	if img.config, err = json.Marshal(config); err != nil {
+		return nil, err
+	}
+
+	configDigest, configSize, err := v1.SHA256(bytes.NewReader(img.config))
+	if err != nil {
+		return nil, err
+	}
+	manifest.Config = v1.Descriptor{
+		MediaType: cr.DockerConfigJSON,
+		Size:      configSize,
+		Digest:    configDigest,
+	}
+
+	if img.manifest, err = json.Marshal(manifest); err != nil {
+		return nil, err
+	}
+
+	return partial.CompressedToImage(img)
+}
+
+// schema1Image is a schema v2 image converted from a schema v1 one, whose
+// layers are read from the source registry.
+type schema1Image struct {
+	config   []byte
+	manifest []byte
+	layers   map[v1.Hash]v1.Layer
+}
+
+var _ partial.CompressedImageCore = (*schema1Image)(nil)
+
+// RawConfigFile implements partial.CompressedImageCore.
+func (i *schema1Image) RawConfigFile() ([]byte, error) {
+	return i.config, nil
+}
+
+// MediaType implements partial.CompressedImageCore.
+func (i *schema1Image) MediaType() (cr.MediaType, error) {
+	return cr.DockerManifestSchema2, nil
+}
+
+// RawManifest implements partial.CompressedImageCore.
+func (i *schema1Image) RawManifest() ([]byte, error) {
+	return i.manifest, nil
+}
+
+// LayerByDigest implements partial.CompressedImageCore.
+func (i *schema1Image) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	if layer, ok := i.layers[h]; ok {
+		return layer, nil
+	}
+
+	return nil, fmt.Errorf("unknown blob %s", h)
+}
+
+// upgradesSchemaV1 returns true if the digest is a schema v1 image which has
+// to be converted to schema v2.
+func (sc *SyncContext) upgradesSchemaV1(digest Digest) bool {
+	if !sc.UpgradeSchemaV1 {
+		return false
+	}
+
+	mediaType, ok := sc.DigestMediaType[digest]
+	return ok &&
+		(mediaType == cr.DockerManifestSchema1 || mediaType == cr.DockerManifestSchema1Signed)
+}
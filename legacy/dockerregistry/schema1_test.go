@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	ggcrV1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// emptyGzipLayer is the digest schema v1 manifests use for the throwaway
+// layers of instructions which do not change the file system.
+const emptyGzipLayer = "sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4"
+
+func TestUpgradeSchemaV1(t *testing.T) {
+	src := httptest.NewServer(registry.New())
+	defer src.Close()
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	srcHost := strings.TrimPrefix(src.URL, "http://")
+	dstHost := strings.TrimPrefix(dst.URL, "http://")
+
+	srcRepo, err := name.NewRepository(srcHost + "/foo")
+	require.Nil(t, err)
+
+	layer, err := random.Layer(1024, types.DockerLayer)
+	require.Nil(t, err)
+	require.Nil(t, remote.WriteLayer(srcRepo, layer))
+
+	layerDigest, err := layer.Digest()
+	require.Nil(t, err)
+	diffID, err := layer.DiffID()
+	require.Nil(t, err)
+
+	// The history of a schema v1 manifest starts with the topmost layer,
+	// whose v1Compatibility also holds the config of the image.
+	schema1 := fmt.Sprintf(`{
+  "schemaVersion": 1,
+  "name": "foo",
+  "tag": "1.0",
+  "architecture": "amd64",
+  "fsLayers": [
+    {"blobSum": %q},
+    {"blobSum": %q}
+  ],
+  "history": [
+    {"v1Compatibility": %q},
+    {"v1Compatibility": %q}
+  ]
+}`,
+		emptyGzipLayer,
+		layerDigest,
+		`{"id":"b","parent":"a","created":"2016-01-02T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) CMD [\"sh\"]"]},"config":{"Cmd":["sh"]},"architecture":"amd64","os":"linux","throwaway":true}`,
+		`{"id":"a","created":"2016-01-01T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) ADD file:123 in /"]}}`,
+	)
+
+	srcRef, err := name.ParseReference(srcHost + "/foo:1.0")
+	require.Nil(t, err)
+	require.Nil(t, remote.Put(srcRef, &remote.Descriptor{
+		Descriptor: ggcrV1.Descriptor{MediaType: types.DockerManifestSchema1},
+		Manifest:   []byte(schema1),
+	}))
+
+	upgraded, err := reg.UpgradeSchemaV1(srcHost+"/foo:1.0", dstHost+"/bar:1.0", 0)
+	require.Nil(t, err)
+
+	dstRef, err := name.ParseReference(dstHost + "/bar:1.0")
+	require.Nil(t, err)
+	img, err := remote.Image(dstRef)
+	require.Nil(t, err)
+
+	digest, err := img.Digest()
+	require.Nil(t, err)
+	require.Equal(t, reg.Digest(digest.String()), upgraded)
+
+	mediaType, err := img.MediaType()
+	require.Nil(t, err)
+	require.Equal(t, types.DockerManifestSchema2, mediaType)
+
+	layers, err := img.Layers()
+	require.Nil(t, err)
+	require.Len(t, layers, 1)
+	gotDigest, err := layers[0].Digest()
+	require.Nil(t, err)
+	require.Equal(t, layerDigest, gotDigest)
+
+	config, err := img.ConfigFile()
+	require.Nil(t, err)
+	require.Equal(t, "amd64", config.Architecture)
+	require.Equal(t, "linux", config.OS)
+	require.Equal(t, []string{"sh"}, config.Config.Cmd)
+	require.Equal(t, []ggcrV1.Hash{diffID}, config.RootFS.DiffIDs)
+	require.Len(t, config.History, 2)
+	require.Equal(t, "/bin/sh -c #(nop) ADD file:123 in /", config.History[0].CreatedBy)
+	require.False(t, config.History[0].EmptyLayer)
+	require.True(t, config.History[1].EmptyLayer)
+
+	// Upgrading the same image again results in the same digest, which later
+	// runs find at the destination through the recorded digest.
+	again, err := reg.UpgradeSchemaV1(srcHost+"/foo:1.0", dstHost+"/bar:1.1", 0)
+	require.Nil(t, err)
+	require.Equal(t, upgraded, again)
+
+	srcDesc, err := crane.Head(srcHost + "/foo:1.0")
+	require.Nil(t, err)
+	srcDigest := reg.Digest(srcDesc.Digest.String())
+
+	edge := reg.PromotionEdge{
+		SrcRegistry: reg.RegistryContext{Name: reg.RegistryName(srcHost)},
+		SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: "1.0"},
+		Digest:      srcDigest,
+		DstRegistry: reg.RegistryContext{Name: reg.RegistryName(dstHost)},
+		DstImageTag: reg.ImageTag{ImageName: "bar", Tag: "1.0"},
+	}
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			reg.RegistryName(srcHost): reg.RegInvImage{
+				"foo": reg.DigestTags{srcDigest: reg.TagSlice{"1.0"}},
+			},
+			reg.RegistryName(dstHost): reg.RegInvImage{
+				"bar": reg.DigestTags{upgraded: reg.TagSlice{"1.0", "1.1"}},
+			},
+		},
+		TransformedDigest: reg.TransformedDigest{srcDigest: upgraded},
+	}
+
+	toPromote, clean := sc.GetPromotionCandidates(map[reg.PromotionEdge]interface{}{edge: nil})
+	require.True(t, clean)
+	require.Empty(t, toPromote)
+
+	// Images which are not schema v1 are not converted.
+	other, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	otherRef, err := name.ParseReference(srcHost + "/baz:1.0")
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(otherRef, other))
+
+	_, err = reg.UpgradeSchemaV1(srcHost+"/baz:1.0", dstHost+"/baz:1.0", 0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "is not a schema v1 image")
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Selection is the set of image:tag pairs approved for promotion. The
+// manifests define where images may be promoted to; a Selection restricts
+// which of them are actually promoted.
+type Selection map[ImageTag]interface{}
+
+// ParseSelectionYAML parses a Selection from a YAML list of "image:tag"
+// strings, e.g. ["foo-controller:1.0", "bar/baz:v2.3.4"].
+func ParseSelectionYAML(b []byte) (Selection, error) {
+	var entries []string
+	if err := yaml.UnmarshalStrict(b, &entries); err != nil {
+		return nil, err
+	}
+
+	selection := make(Selection)
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid selection entry %q; expected <image>:<tag>", entry)
+		}
+
+		tag := Tag(entry[i+1:])
+		if err := ValidateTag(tag); err != nil {
+			return nil, fmt.Errorf("invalid selection entry %q: %w", entry, err)
+		}
+
+		selection[ImageTag{
+			ImageName: ImageName(entry[:i]),
+			Tag:       tag,
+		}] = nil
+	}
+
+	return selection, nil
+}
+
+// ParseSelectionFromFile parses a Selection from a filepath.
+func ParseSelectionFromFile(filePath string) (Selection, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSelectionYAML(b)
+}
+
+// SelectPromotionEdges keeps only the edges whose source image and tag are
+// part of the selection. Entries of the selection which do not match any edge
+// are reported as an error, as they are most likely typos.
+func SelectPromotionEdges(
+	edges map[PromotionEdge]interface{},
+	selection Selection,
+) (map[PromotionEdge]interface{}, error) {
+	selected := make(map[PromotionEdge]interface{})
+	matched := make(map[ImageTag]interface{})
+
+	for edge := range edges {
+		if _, ok := selection[edge.SrcImageTag]; !ok {
+			continue
+		}
+
+		selected[edge] = nil
+		matched[edge.SrcImageTag] = nil
+	}
+
+	unmatched := make([]string, 0)
+	for imageTag := range selection {
+		if _, ok := matched[imageTag]; !ok {
+			unmatched = append(
+				unmatched,
+				fmt.Sprintf("%s:%s", imageTag.ImageName, imageTag.Tag),
+			)
+		}
+	}
+
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return nil, fmt.Errorf(
+			"selected images not found in the manifests: %s",
+			strings.Join(unmatched, ", "),
+		)
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestParseSelectionYAML(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  reg.Selection
+		expectErr bool
+	}{
+		{
+			"Basic",
+			`- foo:1.0
+- bar/baz:v2.3.4
+`,
+			reg.Selection{
+				{ImageName: "foo", Tag: "1.0"}:        nil,
+				{ImageName: "bar/baz", Tag: "v2.3.4"}: nil,
+			},
+			false,
+		},
+		{
+			"Missing tag",
+			`- foo
+`,
+			nil,
+			true,
+		},
+		{
+			"Invalid tag",
+			`- foo:.1
+`,
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.ParseSelectionYAML([]byte(test.input))
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestSelectPromotionEdges(t *testing.T) {
+	srcRC := reg.RegistryContext{
+		Name: "gcr.io/foo",
+		Src:  true,
+	}
+	dstRC := reg.RegistryContext{
+		Name: "gcr.io/bar",
+	}
+
+	mkEdge := func(image reg.ImageName, tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: srcRC,
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+			Digest:      "sha256:000",
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: tag},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("a", "1.0"): nil,
+		mkEdge("a", "2.0"): nil,
+		mkEdge("b", "1.0"): nil,
+	}
+
+	tests := []struct {
+		name      string
+		selection reg.Selection
+		expected  map[reg.PromotionEdge]interface{}
+		expectErr bool
+	}{
+		{
+			"Only selected edges are kept",
+			reg.Selection{
+				{ImageName: "a", Tag: "2.0"}: nil,
+				{ImageName: "b", Tag: "1.0"}: nil,
+			},
+			map[reg.PromotionEdge]interface{}{
+				mkEdge("a", "2.0"): nil,
+				mkEdge("b", "1.0"): nil,
+			},
+			false,
+		},
+		{
+			"Selected image not in the manifests",
+			reg.Selection{
+				{ImageName: "a", Tag: "2.0"}: nil,
+				{ImageName: "c", Tag: "1.0"}: nil,
+			},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.SelectPromotionEdges(edges, test.selection)
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
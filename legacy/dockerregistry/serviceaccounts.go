@@ -0,0 +1,89 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RegistryProject returns the GCP project hosting the registry, i.e. the first
+// path component of its name ("k8s-artifacts-prod" for
+// "us.gcr.io/k8s-artifacts-prod/foo"). Domain-scoped projects such as
+// "gcr.io/google.com/foo" are returned as "google.com:foo". It returns "" if
+// the name has no path.
+func RegistryProject(registryName RegistryName) string {
+	parts := strings.Split(string(registryName), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	if strings.Contains(parts[1], ".") && len(parts) > 2 {
+		return parts[1] + ":" + parts[2]
+	}
+
+	return parts[1]
+}
+
+// ResolveServiceAccounts sets the service account of every registry which has
+// none to the account activated for the registry's GCP project. accounts maps
+// project IDs to service accounts. Destination registries which are left
+// without a service account are reported as an error, as promoting to them
+// would fail.
+func ResolveServiceAccounts(mfests []Manifest, accounts map[string]string) error {
+	unresolved := make(map[RegistryName]interface{})
+
+	for i := range mfests {
+		for j := range mfests[i].Registries {
+			rc := &mfests[i].Registries[j]
+			if rc.ServiceAccount != "" {
+				continue
+			}
+
+			if account, ok := accounts[RegistryProject(rc.Name)]; ok {
+				rc.ServiceAccount = account
+
+				// SrcRegistry is a copy of the source registry.
+				src := mfests[i].SrcRegistry
+				if rc.Src && src != nil && src.Name == rc.Name {
+					src.ServiceAccount = account
+				}
+				continue
+			}
+
+			if !rc.Src {
+				unresolved[rc.Name] = nil
+			}
+		}
+	}
+
+	if len(unresolved) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(unresolved))
+	for name := range unresolved {
+		names = append(names, fmt.Sprintf("%s (project %q)", name, RegistryProject(name)))
+	}
+	sort.Strings(names)
+
+	return fmt.Errorf(
+		"no key file given for the project of destination registries: %s",
+		strings.Join(names, ", "),
+	)
+}
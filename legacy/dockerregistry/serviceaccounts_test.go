@@ -0,0 +1,106 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestRegistryProject(t *testing.T) {
+	tests := []struct {
+		input    reg.RegistryName
+		expected string
+	}{
+		{"gcr.io", ""},
+		{"gcr.io/foo", "foo"},
+		{"us.gcr.io/k8s-artifacts-prod/foo", "k8s-artifacts-prod"},
+		{"gcr.io/google.com/foo", "google.com:foo"},
+		{"us-docker.pkg.dev/foo/bar", "foo"},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, reg.RegistryProject(test.input), test.input)
+	}
+}
+
+func TestResolveServiceAccounts(t *testing.T) {
+	mkManifests := func() []reg.Manifest {
+		mfests := []reg.Manifest{
+			{
+				Registries: []reg.RegistryContext{
+					{Name: "gcr.io/foo-staging", Src: true},
+					{Name: "us.gcr.io/prod-a"},
+					{Name: "eu.gcr.io/prod-a/sub"},
+					{Name: "asia.gcr.io/prod-b", ServiceAccount: "explicit@robot.com"},
+				},
+			},
+		}
+		require.Nil(t, mfests[0].Finalize())
+		return mfests
+	}
+
+	tests := []struct {
+		name      string
+		accounts  map[string]string
+		expected  []reg.RegistryContext
+		expectErr string
+	}{
+		{
+			"Accounts are selected by project",
+			map[string]string{
+				"foo-staging": "staging@robot.com",
+				"prod-a":      "a@robot.com",
+				"prod-b":      "b@robot.com",
+			},
+			[]reg.RegistryContext{
+				{Name: "gcr.io/foo-staging", ServiceAccount: "staging@robot.com", Src: true},
+				{Name: "us.gcr.io/prod-a", ServiceAccount: "a@robot.com"},
+				{Name: "eu.gcr.io/prod-a/sub", ServiceAccount: "a@robot.com"},
+				{Name: "asia.gcr.io/prod-b", ServiceAccount: "explicit@robot.com"},
+			},
+			"",
+		},
+		{
+			"Destinations without a key are reported",
+			map[string]string{
+				"prod-b": "b@robot.com",
+			},
+			nil,
+			"no key file given for the project of destination registries: " +
+				`eu.gcr.io/prod-a/sub (project "prod-a"), ` +
+				`us.gcr.io/prod-a (project "prod-a")`,
+		},
+	}
+
+	for _, test := range tests {
+		mfests := mkManifests()
+		err := reg.ResolveServiceAccounts(mfests, test.accounts)
+		if test.expectErr != "" {
+			require.NotNil(t, err, test.name)
+			require.Equal(t, test.expectErr, err.Error(), test.name)
+			continue
+		}
+
+		require.Nil(t, err, test.name)
+		require.Equal(t, test.expected, mfests[0].Registries, test.name)
+		require.Equal(t, test.expected[0], *mfests[0].SrcRegistry, test.name)
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	grafeaspb "google.golang.org/genproto/googleapis/grafeas/v1"
+)
+
+// cvssRulePrefix marks a SeverityMapping rule which matches a range of CVSS
+// scores rather than a severity label.
+const cvssRulePrefix = "cvss:"
+
+// NormalizedSeverities are the severities a SeverityMapping maps to.
+var NormalizedSeverities = []grafeaspb.Severity{
+	grafeaspb.Severity_CRITICAL,
+	grafeaspb.Severity_HIGH,
+	grafeaspb.Severity_MEDIUM,
+	grafeaspb.Severity_LOW,
+}
+
+// SeverityMapping maps the severities reported by vulnerability scanners,
+// which label severities differently, to NormalizedSeverities, so that
+// vulnerabilities are gated and reported consistently. A vulnerability is
+// mapped by the first of:
+//
+//   - a rule for its severity label: the effective severity assigned by the
+//     source of the vulnerability (e.g. the distribution), or the severity if
+//     there is none;
+//   - a rule for a range of CVSS scores containing its CVSS score;
+//   - its label itself, if it is already a normalized severity;
+//   - the default severity, which is logged once for every such label.
+type SeverityMapping struct {
+	labels map[string]grafeaspb.Severity
+	ranges []cvssRange
+	dflt   grafeaspb.Severity
+	mutex  sync.Mutex
+	logged map[string]bool
+}
+
+// cvssRange maps the CVSS scores between min and max (inclusive) to a
+// severity.
+type cvssRange struct {
+	min, max float32
+	severity grafeaspb.Severity
+}
+
+// ParseSeverityMapping parses rules of the form 'LABEL=SEVERITY' (e.g.
+// 'MINIMAL=LOW') and 'cvss:MIN-MAX=SEVERITY' (e.g. 'cvss:9.0-10=CRITICAL'),
+// where SEVERITY is one of NormalizedSeverities, as is the default severity
+// dflt of unmapped vulnerabilities.
+func ParseSeverityMapping(rules []string, dflt string) (*SeverityMapping, error) {
+	m := &SeverityMapping{
+		labels: make(map[string]grafeaspb.Severity),
+		logged: make(map[string]bool),
+	}
+
+	var err error
+	if m.dflt, err = parseNormalizedSeverity(dflt); err != nil {
+		return nil, fmt.Errorf("default severity: %w", err)
+	}
+
+	for _, rule := range rules {
+		from, to, ok := cutRule(rule)
+		if !ok {
+			return nil, fmt.Errorf(
+				"severity mapping %q is not of the form LABEL=SEVERITY or %sMIN-MAX=SEVERITY",
+				rule,
+				cvssRulePrefix,
+			)
+		}
+
+		severity, err := parseNormalizedSeverity(to)
+		if err != nil {
+			return nil, fmt.Errorf("severity mapping %q: %w", rule, err)
+		}
+
+		if !strings.HasPrefix(strings.ToLower(from), cvssRulePrefix) {
+			m.labels[strings.ToUpper(from)] = severity
+			continue
+		}
+
+		scores := strings.SplitN(from[len(cvssRulePrefix):], "-", 2)
+		if len(scores) != 2 {
+			return nil, fmt.Errorf("severity mapping %q: invalid CVSS score range", rule)
+		}
+
+		r := cvssRange{severity: severity}
+		for i, bound := range []*float32{&r.min, &r.max} {
+			score, err := strconv.ParseFloat(strings.TrimSpace(scores[i]), 32)
+			if err != nil {
+				return nil, fmt.Errorf("severity mapping %q: invalid CVSS score: %w", rule, err)
+			}
+			*bound = float32(score)
+		}
+
+		if r.min > r.max {
+			return nil, fmt.Errorf("severity mapping %q: empty CVSS score range", rule)
+		}
+
+		m.ranges = append(m.ranges, r)
+	}
+
+	return m, nil
+}
+
+// cutRule splits a rule at its last '='.
+func cutRule(rule string) (from, to string, ok bool) {
+	i := strings.LastIndexByte(rule, '=')
+	if i <= 0 || i == len(rule)-1 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(rule[:i]), strings.TrimSpace(rule[i+1:]), true
+}
+
+// parseNormalizedSeverity parses one of NormalizedSeverities, ignoring case.
+func parseNormalizedSeverity(s string) (grafeaspb.Severity, error) {
+	for _, severity := range NormalizedSeverities {
+		if strings.EqualFold(s, severity.String()) {
+			return severity, nil
+		}
+	}
+
+	names := make([]string, 0, len(NormalizedSeverities))
+	for _, severity := range NormalizedSeverities {
+		names = append(names, severity.String())
+	}
+
+	return grafeaspb.Severity_SEVERITY_UNSPECIFIED, fmt.Errorf(
+		"unknown severity %q (must be one of %s)",
+		s,
+		strings.Join(names, ", "),
+	)
+}
+
+// Normalize returns the normalized severity of the vulnerability. A nil
+// SeverityMapping returns the severity of the vulnerability as it is.
+func (m *SeverityMapping) Normalize(
+	vuln *grafeaspb.VulnerabilityOccurrence,
+) grafeaspb.Severity {
+	if m == nil {
+		return vuln.GetSeverity()
+	}
+
+	label := vuln.GetEffectiveSeverity()
+	if label == grafeaspb.Severity_SEVERITY_UNSPECIFIED {
+		label = vuln.GetSeverity()
+	}
+
+	if severity, ok := m.labels[label.String()]; ok {
+		return severity
+	}
+
+	if score := vuln.GetCvssScore(); score > 0 {
+		for _, r := range m.ranges {
+			if score >= r.min && score <= r.max {
+				return r.severity
+			}
+		}
+	}
+
+	for _, severity := range NormalizedSeverities {
+		if label == severity {
+			return severity
+		}
+	}
+
+	m.mutex.Lock()
+	if !m.logged[label.String()] {
+		m.logged[label.String()] = true
+		logrus.Warnf(
+			"No severity mapping for %s vulnerabilities; treating them as %s",
+			label,
+			m.dflt,
+		)
+	}
+	m.mutex.Unlock()
+
+	return m.dflt
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	grafeaspb "google.golang.org/genproto/googleapis/grafeas/v1"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestParseSeverityMapping(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []string
+		dflt        string
+		expectedErr string
+	}{
+		{
+			name:  "valid rules",
+			rules: []string{"minimal=low", "cvss:9.0-10=CRITICAL"},
+			dflt:  "LOW",
+		},
+		{
+			name:        "unknown default",
+			dflt:        "SEVERE",
+			expectedErr: `default severity: unknown severity "SEVERE"`,
+		},
+		{
+			name:        "missing severity",
+			rules:       []string{"MINIMAL="},
+			dflt:        "LOW",
+			expectedErr: "is not of the form",
+		},
+		{
+			name:        "unknown severity",
+			rules:       []string{"MINIMAL=NEGLIGIBLE"},
+			dflt:        "LOW",
+			expectedErr: `unknown severity "NEGLIGIBLE"`,
+		},
+		{
+			name:        "invalid range",
+			rules:       []string{"cvss:9.0=CRITICAL"},
+			dflt:        "LOW",
+			expectedErr: "invalid CVSS score range",
+		},
+		{
+			name:        "invalid score",
+			rules:       []string{"cvss:high-10=CRITICAL"},
+			dflt:        "LOW",
+			expectedErr: "invalid CVSS score",
+		},
+		{
+			name:        "empty range",
+			rules:       []string{"cvss:10-9.0=CRITICAL"},
+			dflt:        "LOW",
+			expectedErr: "empty CVSS score range",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := reg.ParseSeverityMapping(test.rules, test.dflt)
+		if test.expectedErr == "" {
+			require.Nil(t, err, test.name)
+			continue
+		}
+
+		require.Error(t, err, test.name)
+		require.Contains(t, err.Error(), test.expectedErr, test.name)
+	}
+}
+
+func TestSeverityMappingNormalize(t *testing.T) {
+	mapping, err := reg.ParseSeverityMapping(
+		[]string{"MINIMAL=LOW", "cvss:9.0-10=CRITICAL"},
+		"MEDIUM",
+	)
+	require.Nil(t, err)
+
+	tests := []struct {
+		name     string
+		mapping  *reg.SeverityMapping
+		vuln     *grafeaspb.VulnerabilityOccurrence
+		expected grafeaspb.Severity
+	}{
+		{
+			name:    "label rule",
+			mapping: mapping,
+			vuln: &grafeaspb.VulnerabilityOccurrence{
+				Severity: grafeaspb.Severity_MINIMAL,
+			},
+			expected: grafeaspb.Severity_LOW,
+		},
+		{
+			name:    "effective severity takes precedence",
+			mapping: mapping,
+			vuln: &grafeaspb.VulnerabilityOccurrence{
+				Severity:          grafeaspb.Severity_HIGH,
+				EffectiveSeverity: grafeaspb.Severity_MINIMAL,
+			},
+			expected: grafeaspb.Severity_LOW,
+		},
+		{
+			name:    "CVSS range",
+			mapping: mapping,
+			vuln: &grafeaspb.VulnerabilityOccurrence{
+				Severity:  grafeaspb.Severity_HIGH,
+				CvssScore: 9.8,
+			},
+			expected: grafeaspb.Severity_CRITICAL,
+		},
+		{
+			name:    "normalized label",
+			mapping: mapping,
+			vuln: &grafeaspb.VulnerabilityOccurrence{
+				Severity:  grafeaspb.Severity_HIGH,
+				CvssScore: 7.5,
+			},
+			expected: grafeaspb.Severity_HIGH,
+		},
+		{
+			name:     "default",
+			mapping:  mapping,
+			vuln:     &grafeaspb.VulnerabilityOccurrence{},
+			expected: grafeaspb.Severity_MEDIUM,
+		},
+		{
+			name: "no mapping",
+			vuln: &grafeaspb.VulnerabilityOccurrence{
+				Severity: grafeaspb.Severity_MINIMAL,
+			},
+			expected: grafeaspb.Severity_MINIMAL,
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, test.mapping.Normalize(test.vuln), test.name)
+	}
+}
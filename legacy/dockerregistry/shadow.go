@@ -0,0 +1,131 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+)
+
+// The placeholders replaced in every argument of a shadow command.
+const (
+	ShadowSrcPlaceholder    = "{src}"
+	ShadowDstPlaceholder    = "{dst}"
+	ShadowDigestPlaceholder = "{digest}"
+)
+
+// ShadowOutcome is the outcome of a promotion request executed by a shadow
+// command instead of the promoter itself.
+type ShadowOutcome struct {
+	// Command is the command which was run, with its placeholders replaced.
+	Command []string
+	// Output holds the combined stdout and stderr of Command.
+	Output string
+	// Expected is the digest the promoter would have pushed, and Actual the
+	// digest found at the destination once Command has run.
+	Expected Digest
+	Actual   Digest
+	// Error is set if Command failed, if the destination could not be read,
+	// or if Actual differs from Expected.
+	Error error
+}
+
+// ParseShadowCommand splits the shadow command template into its arguments.
+// The template must refer to the destination with ShadowDstPlaceholder.
+func ParseShadowCommand(template string) ([]string, error) {
+	command := strings.Fields(template)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("empty shadow command")
+	}
+
+	if !strings.Contains(template, ShadowDstPlaceholder) {
+		return nil, fmt.Errorf(
+			"shadow command %q does not refer to the destination as %s",
+			template,
+			ShadowDstPlaceholder,
+		)
+	}
+
+	return command, nil
+}
+
+// ExpandShadowCommand replaces the placeholders in every argument of the
+// command. As the command is not run by a shell, the replaced values cannot
+// add arguments of their own.
+func ExpandShadowCommand(
+	command []string,
+	srcVertex, dstVertex string,
+	digest Digest,
+) []string {
+	replacer := strings.NewReplacer(
+		ShadowSrcPlaceholder, srcVertex,
+		ShadowDstPlaceholder, dstVertex,
+		ShadowDigestPlaceholder, string(digest),
+	)
+
+	expanded := make([]string, 0, len(command))
+	for _, arg := range command {
+		expanded = append(expanded, replacer.Replace(arg))
+	}
+
+	return expanded
+}
+
+// RunShadowCommand copies srcVertex to dstVertex with sc.ShadowCommand, and
+// compares the digest found at dstVertex with the one of the request.
+func (sc *SyncContext) RunShadowCommand(
+	req PromotionRequest,
+	srcVertex, dstVertex string,
+) ShadowOutcome {
+	outcome := ShadowOutcome{
+		Command:  ExpandShadowCommand(sc.ShadowCommand, srcVertex, dstVertex, req.Digest),
+		Expected: req.Digest,
+	}
+
+	// nolint: gosec
+	output, err := exec.Command(outcome.Command[0], outcome.Command[1:]...).CombinedOutput()
+	outcome.Output = string(output)
+	if err != nil {
+		outcome.Error = fmt.Errorf(
+			"running shadow command %q: %w",
+			strings.Join(outcome.Command, " "),
+			err,
+		)
+		return outcome
+	}
+
+	actual, err := crane.Digest(dstVertex, sc.copyOptions()...)
+	if err != nil {
+		outcome.Error = fmt.Errorf("reading %s: %w", dstVertex, err)
+		return outcome
+	}
+
+	outcome.Actual = Digest(actual)
+	if outcome.Actual != outcome.Expected {
+		outcome.Error = fmt.Errorf(
+			"shadow command pushed %s to %s, expected %s",
+			outcome.Actual,
+			dstVertex,
+			outcome.Expected,
+		)
+	}
+
+	return outcome
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestParseShadowCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			"Valid command",
+			"crane copy {src} {dst}",
+			[]string{"crane", "copy", "{src}", "{dst}"},
+			false,
+		},
+		{
+			"Empty command",
+			"  ",
+			nil,
+			true,
+		},
+		{
+			"No destination",
+			"crane copy {src}",
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.ParseShadowCommand(test.input)
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
+
+func TestExpandShadowCommand(t *testing.T) {
+	got := reg.ExpandShadowCommand(
+		[]string{"skopeo", "copy", "docker://{src}", "docker://{dst}", "--digest={digest}"},
+		"gcr.io/src/foo@sha256:000",
+		"gcr.io/dst/foo:1.0",
+		"sha256:000",
+	)
+	require.Equal(t, []string{
+		"skopeo",
+		"copy",
+		"docker://gcr.io/src/foo@sha256:000",
+		"docker://gcr.io/dst/foo:1.0",
+		"--digest=sha256:000",
+	}, got)
+}
+
+func TestRunShadowCommand(t *testing.T) {
+	dst := httptest.NewServer(registry.New())
+	defer dst.Close()
+
+	dstVertex := strings.TrimPrefix(dst.URL, "http://") + "/foo:1.0"
+
+	img, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	digest, err := img.Digest()
+	require.Nil(t, err)
+
+	// The shadow commands of this test do not copy anything, so the
+	// destination already holds the image.
+	ref, err := name.ParseReference(dstVertex)
+	require.Nil(t, err)
+	require.Nil(t, remote.Write(ref, img))
+
+	tests := []struct {
+		name      string
+		command   []string
+		digest    reg.Digest
+		expectErr bool
+	}{
+		{
+			"Expected digest",
+			[]string{"echo", "{src}", "{dst}"},
+			reg.Digest(digest.String()),
+			false,
+		},
+		{
+			"Failing command",
+			[]string{"false", "{dst}"},
+			reg.Digest(digest.String()),
+			true,
+		},
+		{
+			"Unexpected digest",
+			[]string{"echo", "{dst}"},
+			reg.Digest("sha256:" + strings.Repeat("0", 64)),
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		sc := reg.SyncContext{ShadowCommand: test.command}
+		req := reg.PromotionRequest{Digest: test.digest}
+
+		outcome := sc.RunShadowCommand(req, "gcr.io/src/foo@"+string(test.digest), dstVertex)
+		require.Equal(t, test.digest, outcome.Expected, test.name)
+		if test.expectErr {
+			require.Error(t, outcome.Error, test.name)
+			continue
+		}
+
+		require.NoError(t, outcome.Error, test.name)
+		require.Equal(t, test.digest, outcome.Actual, test.name)
+		require.Equal(t, "gcr.io/src/foo@"+string(test.digest)+" "+dstVertex+"\n", outcome.Output, test.name)
+	}
+}
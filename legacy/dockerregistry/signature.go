@@ -0,0 +1,310 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CosignSignatureAnnotation is the layer annotation holding the base64
+	// encoded signature of the layer's payload.
+	CosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// cosignSignatureTagSuffix is appended to the digest of an image (with
+	// the ':' replaced by a '-') to get the tag of its signatures.
+	cosignSignatureTagSuffix = ".sig"
+)
+
+// cosignPayload is the part of a cosign "simple signing" payload which binds
+// the signature to an image.
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// SignatureVerifier checks that images carry a valid cosign signature, made
+// with the key belonging to PublicKey. The verification result of each image
+// is cached for the lifetime of the SignatureVerifier.
+type SignatureVerifier struct {
+	PublicKey crypto.PublicKey
+
+	mutex sync.Mutex
+	cache map[string]error
+}
+
+// NewSignatureVerifier creates a SignatureVerifier for the PEM encoded public
+// key, as written by 'cosign generate-key-pair'.
+func NewSignatureVerifier(publicKeyPEM []byte) (*SignatureVerifier, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found")
+	}
+
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	return &SignatureVerifier{
+		PublicKey: publicKey,
+		cache:     make(map[string]error),
+	}, nil
+}
+
+// NewSignatureVerifierFromFile creates a SignatureVerifier for the PEM encoded
+// public key stored in filePath.
+func NewSignatureVerifierFromFile(filePath string) (*SignatureVerifier, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSignatureVerifier(b)
+}
+
+// Verify returns nil if the image has at least one valid signature.
+func (v *SignatureVerifier) Verify(
+	registryName RegistryName,
+	imageName ImageName,
+	digest Digest,
+	opts ...crane.Option,
+) error {
+	key := ToFQIN(registryName, imageName, digest)
+
+	v.mutex.Lock()
+	err, ok := v.cache[key]
+	v.mutex.Unlock()
+	if ok {
+		return err
+	}
+
+	err = v.verify(registryName, imageName, digest, opts...)
+
+	v.mutex.Lock()
+	v.cache[key] = err
+	v.mutex.Unlock()
+
+	return err
+}
+
+func (v *SignatureVerifier) verify(
+	registryName RegistryName,
+	imageName ImageName,
+	digest Digest,
+	opts ...crane.Option,
+) error {
+	sigTag := Tag(strings.Replace(string(digest), ":", "-", 1) + cosignSignatureTagSuffix)
+
+	img, err := crane.Pull(ToPQIN(registryName, imageName, sigTag), opts...)
+	if err != nil {
+		return fmt.Errorf("no signatures found: %w", err)
+	}
+
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("reading signatures: %w", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		encoded, ok := layer.Annotations[CosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			logrus.Debugf("malformed signature in %s: %v", layer.Digest, err)
+			continue
+		}
+
+		blob, err := img.LayerByDigest(layer.Digest)
+		if err != nil {
+			return fmt.Errorf("reading signature payload: %w", err)
+		}
+
+		rc, err := blob.Compressed()
+		if err != nil {
+			return fmt.Errorf("reading signature payload: %w", err)
+		}
+		payload, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("reading signature payload: %w", err)
+		}
+
+		if err := v.verifySignature(payload, signature); err != nil {
+			logrus.Debugf("invalid signature in %s: %v", layer.Digest, err)
+			continue
+		}
+
+		var p cosignPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			logrus.Debugf("malformed signature payload in %s: %v", layer.Digest, err)
+			continue
+		}
+
+		if p.Critical.Image.DockerManifestDigest != string(digest) {
+			logrus.Debugf(
+				"signature in %s is for %s",
+				layer.Digest,
+				p.Critical.Image.DockerManifestDigest,
+			)
+			continue
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("no valid signature found")
+}
+
+func (v *SignatureVerifier) verifySignature(payload, signature []byte) error {
+	hash := sha256.Sum256(payload)
+
+	switch publicKey := v.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(publicKey, hash[:], signature) {
+			return fmt.Errorf("invalid ECDSA signature")
+		}
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(publicKey, payload, signature) {
+			return fmt.Errorf("invalid ed25519 signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+
+	return nil
+}
+
+// FilterSignedEdges checks that the source image of every edge carries a valid
+// signature. All unsigned images are reported together; they are either
+// dropped from the returned edges (if drop is true), or cause an error.
+func (sc *SyncContext) FilterSignedEdges(
+	edges map[PromotionEdge]interface{},
+	verifier *SignatureVerifier,
+	drop bool,
+) (map[PromotionEdge]interface{}, error) {
+	return sc.filterSourceEdges(
+		edges,
+		func(edge PromotionEdge) error {
+			return verifier.Verify(
+				edge.SrcRegistry.Name,
+				edge.SrcImageTag.ImageName,
+				edge.Digest,
+				sc.copyOptions()...,
+			)
+		},
+		drop,
+		"are not signed",
+	)
+}
+
+// filterSourceEdges runs check against every edge concurrently. The source
+// images failing the check are reported together, described by problem; they
+// are either dropped from the returned edges (if drop is true), or cause an
+// error.
+func (sc *SyncContext) filterSourceEdges(
+	edges map[PromotionEdge]interface{},
+	check func(PromotionEdge) error,
+	drop bool,
+	problem string,
+) (map[PromotionEdge]interface{}, error) {
+	failed := make(map[string]error)
+	filtered := make(map[PromotionEdge]interface{})
+
+	// Check all edges concurrently; each error is recorded in the slot of
+	// its edge.
+	edgeList := make([]PromotionEdge, 0, len(edges))
+	for edge := range edges {
+		edgeList = append(edgeList, edge)
+	}
+
+	errs := make([]error, len(edgeList))
+	sc.forEachConcurrently(len(edgeList), func(i int) {
+		errs[i] = check(edgeList[i])
+	})
+
+	for i, edge := range edgeList {
+		if err := errs[i]; err != nil {
+			failed[ToFQIN(
+				edge.SrcRegistry.Name,
+				edge.SrcImageTag.ImageName,
+				edge.Digest,
+			)] = err
+			continue
+		}
+
+		filtered[edge] = nil
+	}
+
+	if len(failed) == 0 {
+		return filtered, nil
+	}
+
+	images := make([]string, 0, len(failed))
+	for image, err := range failed {
+		images = append(images, fmt.Sprintf("%s (%v)", image, err))
+	}
+	sort.Strings(images)
+
+	if !drop {
+		return nil, fmt.Errorf(
+			"%d source images %s: %s",
+			len(images),
+			problem,
+			strings.Join(images, ", "),
+		)
+	}
+
+	logrus.Warnf(
+		"Not promoting %d source images which %s: %s",
+		len(images),
+		problem,
+		strings.Join(images, ", "),
+	)
+
+	return filtered, nil
+}
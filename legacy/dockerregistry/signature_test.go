@@ -0,0 +1,144 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// pushSignedImage pushes a random image to repo and, if key is not nil, a
+// cosign signature for it.
+func pushSignedImage(
+	t *testing.T,
+	repo string,
+	key *ecdsa.PrivateKey,
+) reg.Digest {
+	img, err := random.Image(512, 1)
+	require.Nil(t, err)
+	require.Nil(t, crane.Push(img, repo+":latest"))
+
+	hash, err := img.Digest()
+	require.Nil(t, err)
+
+	if key == nil {
+		return reg.Digest(hash.String())
+	}
+
+	payload := []byte(fmt.Sprintf(
+		`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`,
+		repo,
+		hash.String(),
+	))
+	sum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	require.Nil(t, err)
+
+	sigImg, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer: static.NewLayer(
+			payload,
+			"application/vnd.dev.cosign.simplesigning.v1+json",
+		),
+		Annotations: map[string]string{
+			reg.CosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature),
+		},
+	})
+	require.Nil(t, err)
+
+	sigTag := strings.Replace(hash.String(), ":", "-", 1) + ".sig"
+	require.Nil(t, crane.Push(sigImg, repo+":"+sigTag))
+
+	return reg.Digest(hash.String())
+}
+
+func TestFilterSignedEdges(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	srcRegName := reg.RegistryName(
+		strings.TrimPrefix(server.URL, "http://") + "/staging",
+	)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.Nil(t, err)
+
+	verifier, err := reg.NewSignatureVerifier(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKey,
+	}))
+	require.Nil(t, err)
+
+	signed := pushSignedImage(t, string(srcRegName)+"/signed", key)
+	unsigned := pushSignedImage(t, string(srcRegName)+"/unsigned", nil)
+	wrongKey := pushSignedImage(t, string(srcRegName)+"/wrong-key", otherKey)
+
+	mkEdge := func(imageName reg.ImageName, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: srcRegName},
+			SrcImageTag: reg.ImageTag{ImageName: imageName, Tag: "latest"},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/prod"},
+			DstImageTag: reg.ImageTag{ImageName: imageName, Tag: "latest"},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("signed", signed):      nil,
+		mkEdge("unsigned", unsigned):  nil,
+		mkEdge("wrong-key", wrongKey): nil,
+	}
+
+	sc := reg.SyncContext{}
+
+	_, err = sc.FilterSignedEdges(edges, verifier, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "2 source images are not signed")
+	require.Contains(t, err.Error(), string(unsigned))
+	require.Contains(t, err.Error(), string(wrongKey))
+
+	filtered, err := sc.FilterSignedEdges(edges, verifier, true)
+	require.Nil(t, err)
+	require.Equal(
+		t,
+		map[reg.PromotionEdge]interface{}{mkEdge("signed", signed): nil},
+		filtered,
+	)
+}
@@ -0,0 +1,413 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ParseSnapshotYAML parses a previously captured snapshot. This is either the
+// output of '--snapshot' (a list of images), or a map of registry names to such
+// lists, which allows a single file to hold the inventory of several
+// registries. As the former does not record the registry it was taken from, it
+// is returned under the empty RegistryName.
+func ParseSnapshotYAML(b []byte) (MasterInventory, error) {
+	mi := make(MasterInventory)
+
+	byRegistry := make(map[RegistryName][]Image)
+	if err := yaml.UnmarshalStrict(b, &byRegistry); err == nil {
+		for registryName, images := range byRegistry {
+			mi[registryName] = imagesToRegInvImage(images)
+		}
+
+		return mi, nil
+	}
+
+	var images []Image
+	if err := yaml.UnmarshalStrict(b, &images); err != nil {
+		return nil, err
+	}
+
+	mi[""] = imagesToRegInvImage(images)
+	return mi, nil
+}
+
+func imagesToRegInvImage(images []Image) RegInvImage {
+	rii := make(RegInvImage)
+	for _, image := range images {
+		if rii[image.ImageName] == nil {
+			rii[image.ImageName] = make(DigestTags)
+		}
+
+		rii[image.ImageName].Overwrite(image.Dmap)
+	}
+
+	return rii
+}
+
+// LoadInventoryFromSnapshot populates the SyncContext's inventory from a
+// snapshot file instead of reading the registries over the network. A
+// snapshot without registry information is assumed to be of the (single)
+// source registry of the given manifests. A warning is logged for every
+// source registry missing from the snapshot, as well as for every registry in
+// the snapshot that is not mentioned by any manifest.
+func (sc *SyncContext) LoadInventoryFromSnapshot(
+	filePath string,
+	mfests []Manifest,
+) error {
+	b, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	mi, err := ParseSnapshotYAML(b)
+	if err != nil {
+		return fmt.Errorf("parsing snapshot %s: %w", filePath, err)
+	}
+
+	srcRegistries := make(map[RegistryName]interface{})
+	knownRegistries := make(map[RegistryName]interface{})
+	for _, mfest := range mfests {
+		if mfest.SrcRegistry != nil {
+			srcRegistries[mfest.SrcRegistry.Name] = nil
+		}
+
+		for _, rc := range mfest.Registries {
+			knownRegistries[rc.Name] = nil
+		}
+	}
+
+	if rii, ok := mi[""]; ok {
+		if len(srcRegistries) != 1 {
+			return fmt.Errorf(
+				"snapshot %s does not name its registry, but there are %d source registries",
+				filePath,
+				len(srcRegistries),
+			)
+		}
+
+		delete(mi, "")
+		for registryName := range srcRegistries {
+			mi[registryName] = rii
+		}
+	}
+
+	for registryName := range srcRegistries {
+		if _, ok := mi[registryName]; !ok {
+			logrus.Warnf(
+				"snapshot %s does not contain source registry %s",
+				filePath,
+				registryName,
+			)
+		}
+	}
+
+	for registryName, rii := range mi {
+		if _, ok := knownRegistries[registryName]; !ok {
+			logrus.Warnf(
+				"snapshot %s contains %s, which is not in any manifest",
+				filePath,
+				registryName,
+			)
+		}
+
+		sc.Inv[registryName] = rii
+	}
+
+	return nil
+}
+
+// SnapshotDelta compares two snapshots of the same registry and returns the
+// number of image digests which were added to and removed from baseline. Tag
+// moves are not counted, as they do not change the number of images.
+func SnapshotDelta(baseline, current RegInvImage) (added, removed int) {
+	for imageName, digestTags := range current {
+		for digest := range digestTags {
+			if _, ok := baseline[imageName][digest]; !ok {
+				added++
+			}
+		}
+	}
+
+	for imageName, digestTags := range baseline {
+		for digest := range digestTags {
+			if _, ok := current[imageName][digest]; !ok {
+				removed++
+			}
+		}
+	}
+
+	return added, removed
+}
+
+// CheckSnapshotDelta returns an error if the number of image digests added and
+// removed between baseline and current exceeds maxDelta percent of the number
+// of image digests in baseline. A drastic change like this usually indicates
+// an accidental mass deletion or duplication.
+func CheckSnapshotDelta(baseline, current RegInvImage, maxDelta float64) error {
+	added, removed := SnapshotDelta(baseline, current)
+
+	size := 0
+	for _, digestTags := range baseline {
+		size += len(digestTags)
+	}
+
+	if size == 0 {
+		if added+removed > 0 {
+			return fmt.Errorf(
+				"baseline snapshot is empty, but %d images were added",
+				added,
+			)
+		}
+
+		return nil
+	}
+
+	delta := float64(added+removed) * 100 / float64(size)
+	logrus.Infof(
+		"snapshot delta: %d added, %d removed, %d in baseline (%.2f%%)",
+		added,
+		removed,
+		size,
+		delta,
+	)
+
+	if delta > maxDelta {
+		return fmt.Errorf(
+			"snapshot delta of %.2f%% (%d added, %d removed, %d in baseline) exceeds the threshold of %.2f%%",
+			delta,
+			added,
+			removed,
+			size,
+			maxDelta,
+		)
+	}
+
+	return nil
+}
+
+// snapshotHashEntry is an image digest in the canonical serialization hashed
+// by SnapshotHash.
+type snapshotHashEntry struct {
+	Image  ImageName `json:"image"`
+	Digest Digest    `json:"digest"`
+	Tags   []Tag     `json:"tags"`
+}
+
+// SnapshotHash returns the sha256 digest of a canonical serialization of the
+// snapshot: its image digests (with their deduplicated tags), sorted by image
+// name and digest. Two snapshots have the same hash if and only if they hold
+// the same images, digests and tags, regardless of map iteration order.
+func SnapshotHash(rii RegInvImage) (string, error) {
+	entries := make([]snapshotHashEntry, 0)
+	for imageName, digestTags := range rii {
+		for digest, tags := range digestTags {
+			tagSet := tags.ToTagSet()
+
+			sorted := make([]Tag, 0, len(tagSet))
+			for tag := range tagSet {
+				sorted = append(sorted, tag)
+			}
+			sort.Slice(sorted, func(i, j int) bool {
+				return sorted[i] < sorted[j]
+			})
+
+			entries = append(entries, snapshotHashEntry{
+				Image:  imageName,
+				Digest: digest,
+				Tags:   sorted,
+			})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Image != entries[j].Image {
+			return entries[i].Image < entries[j].Image
+		}
+
+		return entries[i].Digest < entries[j].Digest
+	})
+
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b)), nil
+}
+
+// SnapshotChangeKind classifies a change between two snapshots.
+type SnapshotChangeKind string
+
+const (
+	// TagAdded is a tag which did not exist before.
+	TagAdded SnapshotChangeKind = "added-tag"
+
+	// TagRemoved is a tag which no longer exists.
+	TagRemoved SnapshotChangeKind = "removed-tag"
+
+	// TagMoved is a tag which points to a different digest than before. Tag
+	// moves mutate what an image reference resolves to, so they are the
+	// security relevant changes.
+	TagMoved SnapshotChangeKind = "moved-tag"
+
+	// DigestAdded is a digest which did not exist before.
+	DigestAdded SnapshotChangeKind = "new-digest"
+
+	// DigestRemoved is a digest which no longer exists.
+	DigestRemoved SnapshotChangeKind = "removed-digest"
+)
+
+// SnapshotChange is a single change between two snapshots of a registry. For
+// TagMoved, PreviousDigest is the digest the tag pointed to before.
+type SnapshotChange struct {
+	Kind           SnapshotChangeKind `json:"kind" yaml:"kind"`
+	Image          ImageName          `json:"image" yaml:"image"`
+	Tag            Tag                `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Digest         Digest             `json:"digest" yaml:"digest"`
+	PreviousDigest Digest             `json:"previousDigest,omitempty" yaml:"previousDigest,omitempty"`
+}
+
+// String returns a human-readable description of the change.
+func (c SnapshotChange) String() string {
+	switch c.Kind {
+	case TagMoved:
+		return fmt.Sprintf(
+			"%s %s:%s %s -> %s",
+			c.Kind,
+			c.Image,
+			c.Tag,
+			c.PreviousDigest,
+			c.Digest,
+		)
+	case TagAdded, TagRemoved:
+		return fmt.Sprintf("%s %s:%s %s", c.Kind, c.Image, c.Tag, c.Digest)
+	default:
+		return fmt.Sprintf("%s %s@%s", c.Kind, c.Image, c.Digest)
+	}
+}
+
+// DiffSnapshots classifies every change between two snapshots of the same
+// registry as an added, removed or moved tag, or an added or removed digest.
+// The changes are sorted by image, tag and digest.
+func DiffSnapshots(before, after RegInvImage) []SnapshotChange {
+	changes := make([]SnapshotChange, 0)
+
+	imageNames := make(map[ImageName]interface{})
+	for imageName := range before {
+		imageNames[imageName] = nil
+	}
+	for imageName := range after {
+		imageNames[imageName] = nil
+	}
+
+	for imageName := range imageNames {
+		beforeDigests := before[imageName]
+		afterDigests := after[imageName]
+
+		for digest := range afterDigests {
+			if _, ok := beforeDigests[digest]; !ok {
+				changes = append(changes, SnapshotChange{
+					Kind:   DigestAdded,
+					Image:  imageName,
+					Digest: digest,
+				})
+			}
+		}
+
+		for digest := range beforeDigests {
+			if _, ok := afterDigests[digest]; !ok {
+				changes = append(changes, SnapshotChange{
+					Kind:   DigestRemoved,
+					Image:  imageName,
+					Digest: digest,
+				})
+			}
+		}
+
+		beforeTags := tagsToDigests(beforeDigests)
+		afterTags := tagsToDigests(afterDigests)
+
+		for tag, digest := range afterTags {
+			previous, ok := beforeTags[tag]
+			switch {
+			case !ok:
+				changes = append(changes, SnapshotChange{
+					Kind:   TagAdded,
+					Image:  imageName,
+					Tag:    tag,
+					Digest: digest,
+				})
+			case previous != digest:
+				changes = append(changes, SnapshotChange{
+					Kind:           TagMoved,
+					Image:          imageName,
+					Tag:            tag,
+					Digest:         digest,
+					PreviousDigest: previous,
+				})
+			}
+		}
+
+		for tag, digest := range beforeTags {
+			if _, ok := afterTags[tag]; !ok {
+				changes = append(changes, SnapshotChange{
+					Kind:   TagRemoved,
+					Image:  imageName,
+					Tag:    tag,
+					Digest: digest,
+				})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Image != b.Image {
+			return a.Image < b.Image
+		}
+		if a.Tag != b.Tag {
+			return a.Tag < b.Tag
+		}
+		if a.Digest != b.Digest {
+			return a.Digest < b.Digest
+		}
+
+		return a.Kind < b.Kind
+	})
+
+	return changes
+}
+
+// tagsToDigests returns the digest each tag of an image points to.
+func tagsToDigests(digestTags DigestTags) map[Tag]Digest {
+	tags := make(map[Tag]Digest)
+	for digest, tagSlice := range digestTags {
+		for _, tag := range tagSlice {
+			tags[tag] = digest
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	ggcrV1Google "github.com/google/go-containerregistry/pkg/v1/google"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
+)
+
+// snapshotCheckpointInterval is the number of repositories read between two
+// writes of a snapshot checkpoint.
+const snapshotCheckpointInterval = 50
+
+// SnapshotCheckpoint holds the listings of the repositories read so far by a
+// snapshot, so that a restarted snapshot can reuse them instead of reading
+// the whole registry again. GCR lists a repository (its tags, manifests and
+// child repositories) in a single response, so a repository is either read
+// completely or not at all.
+type SnapshotCheckpoint struct {
+	Repositories map[RegistryName]*ggcrV1Google.Tags `json:"repositories"`
+}
+
+// SnapshotCheckpointer records the listing of every repository read by
+// ReadRegistries, and writes them as a SnapshotCheckpoint after every
+// snapshotCheckpointInterval repositories. The repositories of an existing
+// checkpoint are not read again; as their listings are processed exactly like
+// fresh ones, the resulting inventory is the same. A nil
+// *SnapshotCheckpointer records nothing.
+type SnapshotCheckpointer struct {
+	path string
+
+	mutex        sync.Mutex
+	repositories map[RegistryName]*ggcrV1Google.Tags
+	pending      int
+}
+
+// NewSnapshotCheckpointer creates a SnapshotCheckpointer writing to path. If
+// path holds the checkpoint of an earlier, interrupted snapshot, its
+// repositories are carried over.
+func NewSnapshotCheckpointer(path string) (*SnapshotCheckpointer, error) {
+	c := &SnapshotCheckpointer{
+		path:         path,
+		repositories: make(map[RegistryName]*ggcrV1Google.Tags),
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cp SnapshotCheckpoint
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, fmt.Errorf("parsing snapshot checkpoint %s: %w", path, err)
+	}
+
+	for repo, tags := range cp.Repositories {
+		c.repositories[repo] = tags
+	}
+	logrus.Infof(
+		"Resuming snapshot: %d repositories were already read according to %s",
+		len(c.repositories),
+		path,
+	)
+
+	return c, nil
+}
+
+// Lookup returns the recorded listing of the repository.
+func (c *SnapshotCheckpointer) Lookup(repo RegistryName) (*ggcrV1Google.Tags, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	tags, ok := c.repositories[repo]
+	return tags, ok
+}
+
+// Record records the listing of the repository, and writes the checkpoint if
+// snapshotCheckpointInterval repositories were recorded since it was last
+// written. A failure to write the checkpoint does not fail the snapshot; it is
+// only logged.
+func (c *SnapshotCheckpointer) Record(repo RegistryName, tags *ggcrV1Google.Tags) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.repositories[repo] = tags
+	c.pending++
+
+	if c.pending < snapshotCheckpointInterval {
+		return
+	}
+
+	if err := c.write(); err != nil {
+		logrus.Warnf("Unable to write snapshot checkpoint %s: %v", c.path, err)
+	}
+}
+
+// Flush writes the checkpoint if any repositories were recorded since it was
+// last written.
+func (c *SnapshotCheckpointer) Flush() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.pending == 0 {
+		return nil
+	}
+
+	return c.write()
+}
+
+// Remove deletes the checkpoint, once the snapshot it was written for is
+// complete.
+func (c *SnapshotCheckpointer) Remove() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	c.pending = 0
+	return nil
+}
+
+// write writes the checkpoint. The caller must hold the mutex.
+func (c *SnapshotCheckpointer) write() error {
+	b, err := json.Marshal(SnapshotCheckpoint{Repositories: c.repositories})
+	if err != nil {
+		return err
+	}
+
+	if err := upload.Write(c.path, b); err != nil {
+		return err
+	}
+
+	c.pending = 0
+	return nil
+}
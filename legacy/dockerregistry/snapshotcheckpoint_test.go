@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// recordingProducer is a stream.Fake which records that it was read.
+type recordingProducer struct {
+	stream.Fake
+	repo  string
+	mutex *sync.Mutex
+	read  *[]string
+}
+
+func (p *recordingProducer) Produce() (stdout, stderr io.Reader, err error) {
+	p.mutex.Lock()
+	*p.read = append(*p.read, p.repo)
+	p.mutex.Unlock()
+
+	return p.Fake.Produce()
+}
+
+func TestReadRegistriesResumesFromSnapshotCheckpoint(t *testing.T) {
+	const fakeRegName reg.RegistryName = "gcr.io/foo"
+
+	listings := map[string]string{
+		"gcr.io/foo": `{
+  "child": ["addon-resizer", "pause"],
+  "manifest": {},
+  "name": "foo",
+  "tags": []
+}`,
+		"gcr.io/foo/addon-resizer": `{
+  "child": [],
+  "manifest": {
+    "sha256:b5b2d91319f049143806baeacc886f82f621e9a2550df856b11b5c22db4570a7": {
+      "imageSizeBytes": "12875324",
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "tag": ["latest"],
+      "timeCreatedMs": "1501774217070",
+      "timeUploadedMs": "1552917295327"
+    }
+  },
+  "name": "foo/addon-resizer",
+  "tags": ["latest"]
+}`,
+		"gcr.io/foo/pause": `{
+  "child": [],
+  "manifest": {
+    "sha256:06fdf10aae2eeeac5a82c213e4693f82ab05b3b09b820fce95a7cac0bbdad534": {
+      "imageSizeBytes": "12875324",
+      "mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+      "tag": ["v1.2.3"],
+      "timeCreatedMs": "1501774217070",
+      "timeUploadedMs": "1552917295327"
+    }
+  },
+  "name": "foo/pause",
+  "tags": ["v1.2.3"]
+}`,
+	}
+
+	rcs := []reg.RegistryContext{{Name: fakeRegName}}
+	readSnapshot := func(
+		checkpointer *reg.SnapshotCheckpointer,
+		broken string,
+	) (reg.SyncContext, []string) {
+		sc := reg.SyncContext{
+			RegistryContexts:     rcs,
+			Inv:                  map[reg.RegistryName]reg.RegInvImage{fakeRegName: nil},
+			DigestMediaType:      make(reg.DigestMediaType),
+			DigestImageSize:      make(reg.DigestImageSize),
+			DigestUploaded:       make(reg.DigestUploaded),
+			SnapshotCheckpointer: checkpointer,
+		}
+
+		var mutex sync.Mutex
+		read := make([]string, 0)
+		mkProducer := func(sc *reg.SyncContext, rc reg.RegistryContext) stream.Producer {
+			p := recordingProducer{repo: string(rc.Name), mutex: &mutex, read: &read}
+			p.Bytes = []byte(listings[string(rc.Name)])
+			if string(rc.Name) == broken {
+				p.Bytes = []byte("not a listing")
+			}
+			return &p
+		}
+
+		sc.ReadRegistries(rcs, true, mkProducer)
+		sort.Strings(read)
+		return sc, read
+	}
+
+	fresh, _ := readSnapshot(nil, "")
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpointer, err := reg.NewSnapshotCheckpointer(path)
+	require.Nil(t, err)
+
+	interrupted, _ := readSnapshot(checkpointer, "gcr.io/foo/pause")
+	require.NotEmpty(t, interrupted.Logs.Errors)
+	require.Nil(t, checkpointer.Flush())
+
+	// Only the repository which failed is read again, and the result is the
+	// same as a fresh read.
+	checkpointer, err = reg.NewSnapshotCheckpointer(path)
+	require.Nil(t, err)
+
+	resumed, read := readSnapshot(checkpointer, "")
+	require.Equal(t, []string{"gcr.io/foo/pause"}, read)
+	require.Empty(t, resumed.Logs.Errors)
+	require.Equal(t, fresh.Inv, resumed.Inv)
+	require.Equal(t, fresh.DigestUploaded, resumed.DigestUploaded)
+
+	require.Nil(t, checkpointer.Remove())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AddSourceFallbacks registers the alternate source registries, in the order
+// they are tried in. Each fallback uses the service account activated for its
+// GCP project in accounts (as returned by gcloud.ActivateServiceAccounts), or
+// else the service account of the first source registry of the manifests.
+func (sc *SyncContext) AddSourceFallbacks(
+	names []RegistryName,
+	accounts map[string]string,
+) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	srcServiceAccount := ""
+	for _, rc := range sc.RegistryContexts {
+		if rc.Src {
+			srcServiceAccount = rc.ServiceAccount
+			break
+		}
+	}
+
+	for _, name := range names {
+		for _, rc := range sc.RegistryContexts {
+			if rc.Name == name {
+				return fmt.Errorf(
+					"source fallback %s is already a registry of the manifests",
+					name,
+				)
+			}
+		}
+
+		rc := RegistryContext{
+			Name:           name,
+			ServiceAccount: srcServiceAccount,
+			Src:            true,
+		}
+		if account, ok := accounts[RegistryProject(name)]; ok {
+			rc.ServiceAccount = account
+		}
+
+		sc.SourceFallbacks = append(sc.SourceFallbacks, rc)
+		sc.RegistryContexts = append(sc.RegistryContexts, rc)
+	}
+
+	// The fallbacks are read like any other registry, which requires them to
+	// be known when splitting up image paths and to have access tokens.
+	sc.sortRegistryContexts()
+
+	if sc.UseServiceAccount {
+		return sc.PopulateTokens()
+	}
+
+	return nil
+}
+
+// applySourceFallbacks rewrites the source of every edge whose digest is
+// missing from its source registry to the first fallback registry which has
+// the digest. If readRepos is true, the repositories of the fallbacks are read
+// first; otherwise they must already be part of sc.Inv. Edges which no fallback
+// can serve are returned unchanged.
+func (sc *SyncContext) applySourceFallbacks(
+	edges map[PromotionEdge]interface{},
+	readRepos bool,
+) map[PromotionEdge]interface{} {
+	if len(sc.SourceFallbacks) == 0 {
+		return edges
+	}
+
+	missing := make([]PromotionEdge, 0)
+	for edge := range edges {
+		edge := edge
+		sp := edge.VertexPropsFor(&edge.SrcRegistry, &edge.SrcImageTag, &sc.Inv)
+		if sp.DigestExists {
+			logrus.Debugf("edge %v: resolved source to %s", edge, edge.SrcRegistry.Name)
+			continue
+		}
+
+		missing = append(missing, edge)
+	}
+
+	if len(missing) == 0 {
+		return edges
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return fmt.Sprint(missing[i]) < fmt.Sprint(missing[j])
+	})
+
+	if readRepos {
+		rcs := make(map[RegistryContext]interface{})
+		for _, edge := range missing {
+			for _, fallback := range sc.SourceFallbacks {
+				rc := fallback
+				rc.Name = RegistryName(ToLQIN(fallback.Name, edge.SrcImageTag.ImageName))
+				rcs[rc] = nil
+			}
+		}
+
+		regs := make([]RegistryContext, 0, len(rcs))
+		for rc := range rcs {
+			regs = append(regs, rc)
+		}
+
+		// A fallback which cannot be read simply does not have the digest; it
+		// must not keep the image from being promoted from its primary source.
+		invIgnore := append([]ImageName{}, sc.InvIgnore...)
+		sc.ReadRegistries(regs, false, MkReadRepositoryCmdReal)
+		sc.InvIgnore = invIgnore
+	}
+
+	resolved := make(map[PromotionEdge]interface{}, len(edges))
+	for edge := range edges {
+		resolved[edge] = nil
+	}
+
+	for _, edge := range missing {
+		found := false
+		for _, fallback := range sc.SourceFallbacks {
+			rewritten := edge
+			rewritten.SrcRegistry = fallback
+
+			sp := rewritten.VertexPropsFor(
+				&rewritten.SrcRegistry,
+				&rewritten.SrcImageTag,
+				&sc.Inv,
+			)
+			if !sp.DigestExists {
+				continue
+			}
+
+			logrus.Infof(
+				"edge %v: digest missing from source %s; resolved source to fallback %s",
+				edge,
+				edge.SrcRegistry.Name,
+				fallback.Name,
+			)
+			delete(resolved, edge)
+			resolved[rewritten] = nil
+			found = true
+			break
+		}
+
+		if !found {
+			logrus.Warnf(
+				"edge %v: digest missing from source %s and all fallbacks",
+				edge,
+				edge.SrcRegistry.Name,
+			)
+		}
+	}
+
+	return resolved
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestSourceFallbacks(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/src", ServiceAccount: "sa@src", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/dst", ServiceAccount: "sa@dst"}
+
+	mkEdge := func(src reg.RegistryContext, tag reg.Tag, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: src,
+			SrcImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+			Digest:      digest,
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+		}
+	}
+
+	mirror1 := reg.RegistryContext{Name: "gcr.io/mirror1", ServiceAccount: "sa@src", Src: true}
+	mirror2 := reg.RegistryContext{Name: "gcr.io/mirror2", ServiceAccount: "sa@mirror2", Src: true}
+
+	sc := reg.SyncContext{
+		RegistryContexts: []reg.RegistryContext{srcRC, dstRC},
+		Inv: reg.MasterInventory{
+			"gcr.io/src": reg.RegInvImage{
+				"a": reg.DigestTags{"sha256:111": {"1.0"}},
+			},
+			"gcr.io/mirror1": reg.RegInvImage{
+				"a": reg.DigestTags{"sha256:222": {"2.0"}},
+			},
+			"gcr.io/mirror2": reg.RegInvImage{
+				"a": reg.DigestTags{
+					"sha256:222": {"2.0"},
+					"sha256:333": {"3.0"},
+				},
+			},
+			"gcr.io/dst": reg.RegInvImage{},
+		},
+	}
+
+	require.NoError(t, sc.AddSourceFallbacks(
+		[]reg.RegistryName{"gcr.io/mirror1", "gcr.io/mirror2"},
+		map[string]string{"mirror2": "sa@mirror2"},
+	))
+	require.Equal(t, []reg.RegistryContext{mirror1, mirror2}, sc.SourceFallbacks)
+
+	require.Error(
+		t,
+		sc.AddSourceFallbacks([]reg.RegistryName{"gcr.io/dst"}, nil),
+		"a registry of the manifests cannot be a fallback",
+	)
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge(srcRC, "1.0", "sha256:111"): nil,
+		mkEdge(srcRC, "2.0", "sha256:222"): nil,
+		mkEdge(srcRC, "3.0", "sha256:333"): nil,
+		mkEdge(srcRC, "4.0", "sha256:444"): nil,
+	}
+
+	got, ok := sc.FilterPromotionEdges(edges, false)
+	require.True(t, ok)
+	require.Equal(
+		t,
+		map[reg.PromotionEdge]interface{}{
+			// Found in the primary source.
+			mkEdge(srcRC, "1.0", "sha256:111"): nil,
+			// The first fallback having the digest wins.
+			mkEdge(mirror1, "2.0", "sha256:222"): nil,
+			mkEdge(mirror2, "3.0", "sha256:333"): nil,
+			// Not found anywhere (lost), so not promoted.
+		},
+		got,
+	)
+}
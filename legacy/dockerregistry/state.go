@@ -0,0 +1,152 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
+)
+
+// PromotionState records the inputs of the last successful promotion, so
+// that a scheduled run can tell cheaply whether there is anything new to
+// promote.
+type PromotionState struct {
+	// Signature is the PromotionSignature of the promotion.
+	Signature string `yaml:"signature"`
+	// Promoted is when the promotion finished.
+	Promoted time.Time `yaml:"promoted"`
+}
+
+// ParsePromotionStateFromFile parses a PromotionState from a filepath. It
+// returns nil if the file does not exist yet.
+func ParsePromotionStateFromFile(filePath string) (*PromotionState, error) {
+	b, err := ioutil.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state PromotionState
+	if err := yaml.UnmarshalStrict(b, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// WriteToFile writes the PromotionState to a filepath, replacing any previous
+// version of it.
+func (s *PromotionState) WriteToFile(filePath string) error {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return upload.Write(filePath, b)
+}
+
+// SourceRegistries returns the distinct source registries of the edges,
+// sorted by name.
+func SourceRegistries(edges map[PromotionEdge]interface{}) []RegistryContext {
+	seen := make(map[RegistryName]RegistryContext)
+	for edge := range edges {
+		seen[edge.SrcRegistry.Name] = edge.SrcRegistry
+	}
+
+	registries := make([]RegistryContext, 0, len(seen))
+	for _, rc := range seen {
+		registries = append(registries, rc)
+	}
+	sort.Slice(registries, func(i, j int) bool {
+		return registries[i].Name < registries[j].Name
+	})
+
+	return registries
+}
+
+// SourceRepositories returns the distinct source repositories of the edges
+// (their source registry, named after the image), sorted by name. Reading
+// them without recursion only reads the images which are promoted, instead of
+// the whole source registries.
+func SourceRepositories(edges map[PromotionEdge]interface{}) []RegistryContext {
+	seen := make(map[RegistryName]RegistryContext)
+	for edge := range edges {
+		rc := edge.SrcRegistry
+		rc.Name = rc.Name + "/" + RegistryName(edge.SrcImageTag.ImageName)
+		seen[rc.Name] = rc
+	}
+
+	repositories := make([]RegistryContext, 0, len(seen))
+	for _, rc := range seen {
+		repositories = append(repositories, rc)
+	}
+	sort.Slice(repositories, func(i, j int) bool {
+		return repositories[i].Name < repositories[j].Name
+	})
+
+	return repositories
+}
+
+// PromotionSignature returns a digest of the inputs of a promotion: the
+// edges, and the SnapshotHash of each of their source registries as read
+// into sc.Inv. It changes whenever an edge is added or removed, or an image,
+// digest or tag changes in a source registry. Changes made to the
+// destination registries outside of the promoter are not detected.
+func (sc *SyncContext) PromotionSignature(
+	edges map[PromotionEdge]interface{},
+) (string, error) {
+	promotions := make([]string, 0, len(edges))
+	for edge := range edges {
+		promotions = append(promotions, fmt.Sprintf(
+			"%s %s",
+			ToFQIN(edge.SrcRegistry.Name, edge.SrcImageTag.ImageName, edge.Digest),
+			ToPQIN(edge.DstRegistry.Name, edge.DstImageTag.ImageName, edge.DstImageTag.Tag),
+		))
+	}
+	sort.Strings(promotions)
+
+	sources := make(map[RegistryName]string)
+	for _, rc := range SourceRegistries(edges) {
+		hash, err := SnapshotHash(sc.Inv[rc.Name])
+		if err != nil {
+			return "", fmt.Errorf("hashing source registry %s: %w", rc.Name, err)
+		}
+		sources[rc.Name] = hash
+	}
+
+	b, err := json.Marshal(struct {
+		Edges   []string                `json:"edges"`
+		Sources map[RegistryName]string `json:"sources"`
+	}{promotions, sources})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(b)), nil
+}
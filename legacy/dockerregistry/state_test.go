@@ -0,0 +1,125 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestPromotionSignature(t *testing.T) {
+	mkEdge := func(image reg.ImageName, digest reg.Digest) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/foo", Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+			Digest:      digest,
+			DstRegistry: reg.RegistryContext{Name: "us.gcr.io/bar"},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("a", "sha256:000"): nil,
+	}
+	mkSyncContext := func(rii reg.RegInvImage) *reg.SyncContext {
+		return &reg.SyncContext{
+			Inv: reg.MasterInventory{
+				"gcr.io/foo": rii,
+				// Destinations are not part of the signature.
+				"us.gcr.io/bar": reg.RegInvImage{
+					"z": reg.DigestTags{"sha256:999": reg.TagSlice{"1.0"}},
+				},
+			},
+		}
+	}
+	source := reg.RegInvImage{
+		"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+	}
+
+	baseline, err := mkSyncContext(source).PromotionSignature(edges)
+	require.Nil(t, err)
+
+	sameSC := mkSyncContext(reg.RegInvImage{
+		"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+	})
+	sameSC.Inv["us.gcr.io/bar"] = reg.RegInvImage{}
+	same, err := sameSC.PromotionSignature(edges)
+	require.Nil(t, err)
+	require.Equal(t, baseline, same)
+
+	sourceChanged, err := mkSyncContext(reg.RegInvImage{
+		"a": reg.DigestTags{"sha256:000": reg.TagSlice{"1.0"}},
+		"b": reg.DigestTags{"sha256:111": reg.TagSlice{"2.0"}},
+	}).PromotionSignature(edges)
+	require.Nil(t, err)
+	require.NotEqual(t, baseline, sourceChanged)
+
+	edgesChanged, err := mkSyncContext(source).PromotionSignature(
+		map[reg.PromotionEdge]interface{}{
+			mkEdge("a", "sha256:000"): nil,
+			mkEdge("b", "sha256:111"): nil,
+		},
+	)
+	require.Nil(t, err)
+	require.NotEqual(t, baseline, edgesChanged)
+}
+
+func TestSourceRepositories(t *testing.T) {
+	mkEdge := func(src reg.RegistryName, image reg.ImageName, dst reg.RegistryName) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: src, Src: true},
+			SrcImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+			Digest:      "sha256:000",
+			DstRegistry: reg.RegistryContext{Name: dst},
+			DstImageTag: reg.ImageTag{ImageName: image, Tag: "1.0"},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("gcr.io/foo", "b", "us.gcr.io/bar"): nil,
+		mkEdge("gcr.io/foo", "a", "us.gcr.io/bar"): nil,
+		mkEdge("gcr.io/foo", "a", "eu.gcr.io/bar"): nil,
+	}
+
+	require.Equal(t, []reg.RegistryContext{
+		{Name: "gcr.io/foo/a", Src: true},
+		{Name: "gcr.io/foo/b", Src: true},
+	}, reg.SourceRepositories(edges))
+}
+
+func TestPromotionStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.yaml")
+
+	state, err := reg.ParsePromotionStateFromFile(path)
+	require.Nil(t, err)
+	require.Nil(t, state)
+
+	written := reg.PromotionState{
+		Signature: "sha256:000",
+		Promoted:  time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	require.Nil(t, written.WriteToFile(path))
+
+	state, err = reg.ParsePromotionStateFromFile(path)
+	require.Nil(t, err)
+	require.Equal(t, &written, state)
+}
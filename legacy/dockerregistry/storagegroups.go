@@ -0,0 +1,138 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// StorageGroups maps destination registries to the group of registries they
+// share their backing storage with. Within a group, a digest is only copied
+// from the source once; the other destinations mount its blobs from the first
+// copy. Registries not in the map are not part of any group.
+type StorageGroups map[RegistryName]int
+
+// ParseStorageGroups parses storage groups, each given as a comma separated
+// list of registry names. As blobs can only be mounted within a single
+// registry host, all registries of a group must be on the same host.
+func ParseStorageGroups(groups []string) (StorageGroups, error) {
+	sg := make(StorageGroups)
+	for i, group := range groups {
+		names := strings.Split(group, ",")
+		if len(names) < 2 {
+			return nil, fmt.Errorf(
+				"storage group %q must have at least 2 registries",
+				group,
+			)
+		}
+
+		host := ""
+		for _, name := range names {
+			registryName := RegistryName(strings.TrimSpace(name))
+			if registryName == "" {
+				return nil, fmt.Errorf("storage group %q has an empty registry name", group)
+			}
+
+			if _, ok := sg[registryName]; ok {
+				return nil, fmt.Errorf("registry %s is in more than one storage group", registryName)
+			}
+
+			_, domain, _ := GetTokenKeyDomainRepoPath(registryName)
+			if host == "" {
+				host = domain
+			} else if domain != host {
+				return nil, fmt.Errorf(
+					"storage group %q spans the hosts %s and %s",
+					group,
+					host,
+					domain,
+				)
+			}
+
+			sg[registryName] = i
+		}
+	}
+
+	return sg, nil
+}
+
+// crossMountKey identifies a digest promoted into a storage group.
+type crossMountKey struct {
+	group  int
+	digest Digest
+}
+
+// crossMount records the first copy of a digest into a storage group. Other
+// requests for the same key wait for it to finish.
+type crossMount struct {
+	once   sync.Once
+	vertex string
+	err    error
+}
+
+// copyImageToStorageGroup copies srcVertex to dstVertex. If the destination is
+// part of a storage group which already received the digest, the image is
+// copied from there instead, so that its blobs are mounted rather than
+// uploaded again. It returns the image mounted from, or "" for a full copy.
+func (sc *SyncContext) copyImageToStorageGroup(
+	crossMounts map[crossMountKey]*crossMount,
+	mutex *sync.Mutex,
+	rpr PromotionRequest,
+	srcVertex, dstVertex string,
+) (mountedFrom string, err error) {
+	group, ok := sc.StorageGroups[rpr.RegistryDest]
+	if !ok {
+		sc.tracef(rpr, "copying %s to %s", srcVertex, dstVertex)
+		return "", CopyImage(srcVertex, dstVertex, sc.LayerConcurrency, sc.copyOptions()...)
+	}
+
+	key := crossMountKey{group: group, digest: rpr.Digest}
+	mutex.Lock()
+	cm, ok := crossMounts[key]
+	if !ok {
+		cm = &crossMount{}
+		crossMounts[key] = cm
+	}
+	mutex.Unlock()
+
+	first := false
+	cm.once.Do(func() {
+		first = true
+		cm.vertex = ToFQIN(rpr.RegistryDest, rpr.ImageNameDest, rpr.Digest)
+		sc.tracef(rpr, "copying %s to %s, the first of storage group %d", srcVertex, dstVertex, group)
+		cm.err = CopyImage(srcVertex, dstVertex, sc.LayerConcurrency, sc.copyOptions()...)
+	})
+
+	if first {
+		return "", cm.err
+	}
+
+	// Do not depend on a failed copy; fall back to copying from the source.
+	if cm.err != nil {
+		sc.tracef(rpr, "copying %s to %s, as the copy to %s failed", srcVertex, dstVertex, cm.vertex)
+		return "", CopyImage(srcVertex, dstVertex, sc.LayerConcurrency, sc.copyOptions()...)
+	}
+
+	sc.tracef(rpr, "copying %s to %s to mount its blobs", cm.vertex, dstVertex)
+	if err := CopyImage(cm.vertex, dstVertex, sc.LayerConcurrency, sc.copyOptions()...); err != nil {
+		return "", err
+	}
+
+	return cm.vertex, nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestParseStorageGroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     []string
+		expected  reg.StorageGroups
+		expectErr bool
+	}{
+		{
+			"No groups",
+			[]string{},
+			reg.StorageGroups{},
+			false,
+		},
+		{
+			"Multiple groups",
+			[]string{
+				"us.gcr.io/k8s-artifacts-prod,us.gcr.io/k8s-artifacts-prod/mirror",
+				"eu.gcr.io/k8s-artifacts-prod, eu.gcr.io/k8s-artifacts-prod/mirror",
+			},
+			reg.StorageGroups{
+				"us.gcr.io/k8s-artifacts-prod":        0,
+				"us.gcr.io/k8s-artifacts-prod/mirror": 0,
+				"eu.gcr.io/k8s-artifacts-prod":        1,
+				"eu.gcr.io/k8s-artifacts-prod/mirror": 1,
+			},
+			false,
+		},
+		{
+			"Single registry",
+			[]string{"us.gcr.io/k8s-artifacts-prod"},
+			nil,
+			true,
+		},
+		{
+			"Registry in two groups",
+			[]string{
+				"us.gcr.io/a,us.gcr.io/b",
+				"us.gcr.io/b,us.gcr.io/c",
+			},
+			nil,
+			true,
+		},
+		{
+			"Different hosts",
+			[]string{"us.gcr.io/a,eu.gcr.io/a"},
+			nil,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := reg.ParseStorageGroups(test.input)
+		if test.expectErr {
+			require.Error(t, err, test.name)
+			continue
+		}
+
+		require.NoError(t, err, test.name)
+		require.Equal(t, test.expected, got, test.name)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TagSnapshot is a snapshot keyed by tag rather than by digest: for every
+// image, it maps each tag to the digest it points to, and lists the digests
+// which have no tag separately. Tags which point to the same digest each
+// appear with that digest.
+type TagSnapshot []ImageTagDigests
+
+// ImageTagDigests holds the tags and the untagged digests of an image in a
+// TagSnapshot.
+type ImageTagDigests struct {
+	Name     ImageName
+	Tags     map[Tag]Digest
+	Untagged []Digest
+}
+
+// ToTagSnapshot regroups the snapshot by tag. Images are sorted by name.
+func (rii RegInvImage) ToTagSnapshot() TagSnapshot {
+	snapshot := make(TagSnapshot, 0, len(rii))
+	for imageName, digestTags := range rii {
+		image := ImageTagDigests{
+			Name: imageName,
+			Tags: make(map[Tag]Digest),
+		}
+
+		for digest, tags := range digestTags {
+			if len(tags) == 0 {
+				image.Untagged = append(image.Untagged, digest)
+				continue
+			}
+
+			for _, tag := range tags {
+				image.Tags[tag] = digest
+			}
+		}
+
+		sort.Slice(image.Untagged, func(i, j int) bool {
+			return image.Untagged[i] < image.Untagged[j]
+		})
+
+		snapshot = append(snapshot, image)
+	}
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Name < snapshot[j].Name
+	})
+
+	return snapshot
+}
+
+// sortedTags returns the tags of the image, sorted alphabetically.
+func (image *ImageTagDigests) sortedTags() []Tag {
+	tags := make([]Tag, 0, len(image.Tags))
+	for tag := range image.Tags {
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
+
+// ToYAML displays a TagSnapshot as YAML: a list of images, each with a "tags"
+// map from tag to digest (sorted by tag) and, if there are any, an "untagged"
+// list of digests.
+func (s TagSnapshot) ToYAML() string {
+	var b strings.Builder
+	for i := range s {
+		image := &s[i]
+		fmt.Fprintf(&b, "- name: %s\n", image.Name)
+
+		if len(image.Tags) == 0 {
+			fmt.Fprintf(&b, "  tags: {}\n")
+		} else {
+			fmt.Fprintf(&b, "  tags:\n")
+			for _, tag := range image.sortedTags() {
+				fmt.Fprintf(&b, "    %q: %q\n", tag, image.Tags[tag])
+			}
+		}
+
+		if len(image.Untagged) > 0 {
+			digests := make([]string, 0, len(image.Untagged))
+			for _, digest := range image.Untagged {
+				digests = append(digests, fmt.Sprintf("%q", digest))
+			}
+			fmt.Fprintf(&b, "  untagged: [%s]\n", strings.Join(digests, ", "))
+		}
+	}
+
+	return b.String()
+}
+
+// ToCSV is like ToYAML, but prints one tag on each line, followed by the
+// image it points to. Untagged digests are printed with a "-" in place of the
+// tag.
+//
+// Example:
+// a:1.0,a@sha256:0000000000000000000000000000000000000000000000000000000000000000
+// a:latest,a@sha256:0000000000000000000000000000000000000000000000000000000000000000
+// -,a@sha256:1111111111111111111111111111111111111111111111111111111111111111
+func (s TagSnapshot) ToCSV() string {
+	var b strings.Builder
+	for i := range s {
+		image := &s[i]
+		for _, tag := range image.sortedTags() {
+			fmt.Fprintf(&b, "%s:%s,%s@%s\n", image.Name, tag, image.Name, image.Tags[tag])
+		}
+
+		for _, digest := range image.Untagged {
+			fmt.Fprintf(&b, "-,%s@%s\n", image.Name, digest)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestTagSnapshot(t *testing.T) {
+	rii := reg.RegInvImage{
+		"foo": reg.DigestTags{
+			"sha256:000": reg.TagSlice{"latest", "1.0"},
+			"sha256:111": reg.TagSlice{"0.9"},
+			"sha256:222": reg.TagSlice{},
+		},
+		"bar": reg.DigestTags{
+			"sha256:333": reg.TagSlice{},
+		},
+	}
+
+	snapshot := rii.ToTagSnapshot()
+	require.Equal(t, reg.TagSnapshot{
+		{
+			Name:     "bar",
+			Tags:     map[reg.Tag]reg.Digest{},
+			Untagged: []reg.Digest{"sha256:333"},
+		},
+		{
+			Name: "foo",
+			Tags: map[reg.Tag]reg.Digest{
+				"0.9":    "sha256:111",
+				"1.0":    "sha256:000",
+				"latest": "sha256:000",
+			},
+			Untagged: []reg.Digest{"sha256:222"},
+		},
+	}, snapshot)
+
+	tests := []struct {
+		name     string
+		render   func() string
+		expected string
+	}{
+		{
+			"yaml",
+			snapshot.ToYAML,
+			`- name: bar
+  tags: {}
+  untagged: ["sha256:333"]
+- name: foo
+  tags:
+    "0.9": "sha256:111"
+    "1.0": "sha256:000"
+    "latest": "sha256:000"
+  untagged: ["sha256:222"]
+`,
+		},
+		{
+			"csv",
+			snapshot.ToCSV,
+			`-,bar@sha256:333
+foo:0.9,foo@sha256:111
+foo:1.0,foo@sha256:000
+foo:latest,foo@sha256:000
+-,foo@sha256:222
+`,
+		},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, test.render(), test.name)
+	}
+}
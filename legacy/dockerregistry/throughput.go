@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// bytesPerMiB is the unit copy throughput is reported in.
+const bytesPerMiB = 1 << 20
+
+// copyThroughput returns the bytes per second at which the image of the
+// request was copied, based on the image size recorded while reading the
+// registries. It returns 0 (i.e. not measured) for failed requests, requests
+// which did not move the image through the promoter (blobs mounted within a
+// storage group, or copies left to the shadow command) and images of unknown
+// size, such as manifest lists.
+func (sc *SyncContext) copyThroughput(
+	rpr PromotionRequest,
+	duration time.Duration,
+	mountedFrom string,
+	shadow *ShadowOutcome,
+	errors Errors,
+) float64 {
+	if len(errors) > 0 || mountedFrom != "" || shadow != nil || duration <= 0 {
+		return 0
+	}
+
+	size := sc.DigestImageSize[rpr.Digest]
+	if size <= 0 {
+		return 0
+	}
+
+	return float64(size) / duration.Seconds()
+}
+
+// SlowestCopies returns the n results with the lowest measured throughput,
+// slowest first. Results whose throughput was not measured are left out.
+func SlowestCopies(results []PromotionResult, n int) []PromotionResult {
+	measured := make([]PromotionResult, 0, len(results))
+	for i := range results {
+		if results[i].BytesPerSecond > 0 {
+			measured = append(measured, results[i])
+		}
+	}
+
+	sort.SliceStable(measured, func(i, j int) bool {
+		return measured[i].BytesPerSecond < measured[j].BytesPerSecond
+	})
+
+	if n < len(measured) {
+		measured = measured[:n]
+	}
+
+	return measured
+}
+
+// WriteSlowestCopies writes the n slowest image copies of the results to w,
+// with their throughput, followed by the number of requests whose throughput
+// is not available because no bytes were moved by the promoter.
+func WriteSlowestCopies(w io.Writer, results []PromotionResult, n int) {
+	slowest := SlowestCopies(results, n)
+
+	var notMeasured int
+	for i := range results {
+		if results[i].BytesPerSecond == 0 && !results[i].Skipped {
+			notMeasured++
+		}
+	}
+
+	fmt.Fprintf(w, "Slowest %d image copies:\n", len(slowest))
+	for i := range slowest {
+		result := &slowest[i]
+		fmt.Fprintf(
+			w,
+			"  %s -> %s: %.2f MiB/s (%s)\n",
+			ToFQIN(result.Request.RegistrySrc, result.Request.ImageNameSrc, result.Request.Digest),
+			ToLQIN(result.Request.RegistryDest, result.Request.ImageNameDest),
+			result.BytesPerSecond/bytesPerMiB,
+			result.Duration.Round(time.Millisecond),
+		)
+	}
+
+	if notMeasured > 0 {
+		fmt.Fprintf(
+			w,
+			"  N/A for %d requests which failed, moved no bytes (e.g. mounted blobs) or have an unknown size\n",
+			notMeasured,
+		)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestSlowestCopies(t *testing.T) {
+	mkResult := func(image reg.ImageName, bytesPerSecond float64) reg.PromotionResult {
+		return reg.PromotionResult{
+			Request: reg.PromotionRequest{
+				RegistrySrc:   "gcr.io/foo",
+				RegistryDest:  "us.gcr.io/bar",
+				ImageNameSrc:  image,
+				ImageNameDest: image,
+				Digest:        "sha256:000",
+			},
+			Duration:       2 * time.Second,
+			BytesPerSecond: bytesPerSecond,
+		}
+	}
+
+	results := []reg.PromotionResult{
+		mkResult("fast", 8<<20),
+		mkResult("slow", 1<<20),
+		// Mounted, so not measured.
+		mkResult("mounted", 0),
+		mkResult("medium", 4<<20),
+	}
+
+	tests := []struct {
+		n        int
+		expected []reg.ImageName
+	}{
+		{1, []reg.ImageName{"slow"}},
+		{2, []reg.ImageName{"slow", "medium"}},
+		{10, []reg.ImageName{"slow", "medium", "fast"}},
+	}
+
+	for _, test := range tests {
+		got := make([]reg.ImageName, 0, len(test.expected))
+		for _, result := range reg.SlowestCopies(results, test.n) {
+			got = append(got, result.Request.ImageNameSrc)
+		}
+		require.Equal(t, test.expected, got, test.n)
+	}
+
+	var b bytes.Buffer
+	reg.WriteSlowestCopies(&b, results, 2)
+	require.Equal(
+		t,
+		`Slowest 2 image copies:
+  gcr.io/foo/slow@sha256:000 -> us.gcr.io/bar/slow: 1.00 MiB/s (2s)
+  gcr.io/foo/medium@sha256:000 -> us.gcr.io/bar/medium: 4.00 MiB/s (2s)
+  N/A for 1 requests which failed, moved no bytes (e.g. mounted blobs) or have an unknown size
+`,
+		b.String(),
+	)
+}
@@ -0,0 +1,485 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	ggcrV1Types "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+// ProviderTokenAuth is the RegistryContext provider for registries which
+// authenticate clients with the Docker registry token authentication
+// specification (a "WWW-Authenticate: Bearer realm=..." challenge), instead
+// of GCR access tokens.
+const ProviderTokenAuth = "token-auth"
+
+// defaultTokenExpiry is the token lifetime assumed if the token server does
+// not return "expires_in", as mandated by the specification.
+const defaultTokenExpiry = 60 * time.Second
+
+// TokenAuth performs the Docker registry bearer token exchange for registries
+// with the ProviderTokenAuth provider. Tokens are cached per registry and
+// scope until they expire.
+type TokenAuth struct {
+	Username string
+	Password string
+	Client   *http.Client
+
+	mutex  sync.Mutex
+	tokens map[string]cachedToken
+}
+
+type cachedToken struct {
+	token  string
+	expiry time.Time
+}
+
+// tokenResponse is the response of a token server.
+type tokenResponse struct {
+	Token       string    `json:"token"`
+	AccessToken string    `json:"access_token"`
+	ExpiresIn   int       `json:"expires_in"`
+	IssuedAt    time.Time `json:"issued_at"`
+}
+
+// NewTokenAuth creates a TokenAuth which authenticates against token servers
+// with the given credentials. Empty credentials request anonymous tokens.
+func NewTokenAuth(username, password string) *TokenAuth {
+	return &TokenAuth{
+		Username: username,
+		Password: password,
+		Client:   http.DefaultClient,
+		tokens:   make(map[string]cachedToken),
+	}
+}
+
+// Do sends req, which must not have a body, to the registry. A cached token
+// for scope is used if there is one; otherwise, or if the registry rejects
+// the cached token, the registry's Bearer challenge is answered with a new
+// token from its token server and the request is sent again.
+func (ta *TokenAuth) Do(req *http.Request, scope string) (*http.Response, error) {
+	key := req.URL.Host + " " + scope
+
+	if token, ok := ta.cachedToken(key); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := ta.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusUnauthorized {
+		return res, nil
+	}
+
+	challenge := res.Header.Get("WWW-Authenticate")
+	res.Body.Close()
+
+	token, err := ta.fetchToken(key, challenge, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	retry.Header.Set("Authorization", "Bearer "+token)
+
+	return ta.Client.Do(retry)
+}
+
+func (ta *TokenAuth) cachedToken(key string) (string, bool) {
+	ta.mutex.Lock()
+	defer ta.mutex.Unlock()
+
+	cached, ok := ta.tokens[key]
+	if !ok || !time.Now().Before(cached.expiry) {
+		delete(ta.tokens, key)
+		return "", false
+	}
+
+	return cached.token, true
+}
+
+// fetchToken answers a Bearer challenge by requesting a token for scope from
+// the token server named in the challenge, and caches it under key.
+func (ta *TokenAuth) fetchToken(key, challenge, scope string) (string, error) {
+	params, err := parseBearerChallenge(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", fmt.Errorf("parsing token realm %q: %w", params["realm"], err)
+	}
+
+	query := realm.Query()
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	if ta.Username != "" || ta.Password != "" {
+		req.SetBasicAuth(ta.Username, ta.Password)
+	}
+
+	res, err := ta.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting token from %s: %w", realm.Host, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"requesting token from %s: unexpected response code %d",
+			realm.Host,
+			res.StatusCode,
+		)
+	}
+
+	var tr tokenResponse
+	if err := json.NewDecoder(res.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+
+	token := tr.Token
+	if token == "" {
+		token = tr.AccessToken
+	}
+	if token == "" {
+		return "", fmt.Errorf("token server %s returned no token", realm.Host)
+	}
+
+	issuedAt := tr.IssuedAt
+	if issuedAt.IsZero() {
+		issuedAt = time.Now()
+	}
+
+	expiresIn := defaultTokenExpiry
+	if tr.ExpiresIn > 0 {
+		expiresIn = time.Duration(tr.ExpiresIn) * time.Second
+	}
+
+	ta.mutex.Lock()
+	ta.tokens[key] = cachedToken{
+		token:  token,
+		expiry: issuedAt.Add(expiresIn),
+	}
+	ta.mutex.Unlock()
+
+	return token, nil
+}
+
+var bearerChallengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseBearerChallenge parses the parameters of a
+// 'Bearer realm="...",service="...",scope="..."' challenge.
+func parseBearerChallenge(challenge string) (map[string]string, error) {
+	const prefix = "bearer "
+	if !strings.HasPrefix(strings.ToLower(challenge), prefix) {
+		return nil, fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	params := make(map[string]string)
+	for _, match := range bearerChallengeParam.FindAllStringSubmatch(
+		challenge[len(prefix):], -1,
+	) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+
+	if params["realm"] == "" {
+		return nil, fmt.Errorf("authentication challenge %q has no realm", challenge)
+	}
+
+	return params, nil
+}
+
+// Keychain returns an authn.Keychain which hands the credentials of ta to
+// the given registries, leaving the bearer token exchange for pull-push
+// promotion to go-containerregistry. All other registries are resolved with
+// authn.DefaultKeychain.
+func (ta *TokenAuth) Keychain(rcs []RegistryContext) authn.Keychain {
+	hosts := make(map[string]interface{})
+	for _, rc := range rcs {
+		if rc.Provider == ProviderTokenAuth {
+			_, domain, _ := GetTokenKeyDomainRepoPath(rc.Name)
+			hosts[domain] = nil
+		}
+	}
+
+	return authn.NewMultiKeychain(
+		&tokenAuthKeychain{ta: ta, hosts: hosts},
+		authn.DefaultKeychain,
+	)
+}
+
+type tokenAuthKeychain struct {
+	ta    *TokenAuth
+	hosts map[string]interface{}
+}
+
+// Resolve implements authn.Keychain.
+func (kc *tokenAuthKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if _, ok := kc.hosts[target.RegistryStr()]; !ok {
+		return authn.Anonymous, nil
+	}
+
+	return &authn.Basic{
+		Username: kc.ta.Username,
+		Password: kc.ta.Password,
+	}, nil
+}
+
+// tokenAuthTags is the subset of GCR's extended tags/list response (see
+// ggcrV1Google.Tags) which can be reconstructed from the standard registry API.
+// In particular, image sizes and push times are unknown.
+type tokenAuthTags struct {
+	Manifests map[string]*tokenAuthManifestInfo `json:"manifest"`
+	Name      string                            `json:"name"`
+	Tags      []string                          `json:"tags"`
+}
+
+type tokenAuthManifestInfo struct {
+	MediaType string   `json:"mediaType"`
+	Tags      []string `json:"tag"`
+}
+
+// tokenAuthTagsProducer reads a repository of a ProviderTokenAuth registry.
+// Such registries only implement the standard tags/list API, which does not
+// include digests, so every tag is resolved with a HEAD request and the result
+// is presented in the format of GCR's extended tags/list response.
+type tokenAuthTagsProducer struct {
+	ta       *TokenAuth
+	domain   string
+	repoPath string
+}
+
+// Produce implements stream.Producer.
+func (p *tokenAuthTagsProducer) Produce() (stdOut, stdErr io.Reader, err error) {
+	scope := fmt.Sprintf("repository:%s:pull", p.repoPath)
+
+	tags, err := p.listTags(scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := tokenAuthTags{
+		Name:      p.repoPath,
+		Tags:      tags,
+		Manifests: make(map[string]*tokenAuthManifestInfo),
+	}
+
+	for _, tag := range tags {
+		req, err := http.NewRequest(
+			http.MethodHead,
+			fmt.Sprintf("https://%s/v2/%s/manifests/%s", p.domain, p.repoPath, tag),
+			nil,
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Accept", strings.Join([]string{
+			string(ggcrV1Types.DockerManifestList),
+			string(ggcrV1Types.DockerManifestSchema2),
+			string(ggcrV1Types.OCIImageIndex),
+			string(ggcrV1Types.OCIManifestSchema1),
+		}, ","))
+
+		res, err := p.ta.Do(req, scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf(
+				"problems encountered: unexpected response code %d for %s/%s:%s",
+				res.StatusCode,
+				p.domain,
+				p.repoPath,
+				tag,
+			)
+		}
+
+		digest := res.Header.Get("Docker-Content-Digest")
+		if digest == "" {
+			logrus.Warnf("%s/%s:%s has no digest; skipping", p.domain, p.repoPath, tag)
+			continue
+		}
+
+		info, ok := result.Manifests[digest]
+		if !ok {
+			info = &tokenAuthManifestInfo{
+				MediaType: res.Header.Get("Content-Type"),
+			}
+			result.Manifests[digest] = info
+		}
+		info.Tags = append(info.Tags, tag)
+	}
+
+	b, err := json.Marshal(&result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bytes.NewReader(b), strings.NewReader(""), nil
+}
+
+// listTags returns all tags of the repository, following pagination links.
+func (p *tokenAuthTagsProducer) listTags(scope string) ([]string, error) {
+	tags := []string{}
+
+	next := fmt.Sprintf("https://%s/v2/%s/tags/list", p.domain, p.repoPath)
+	for next != "" {
+		req, err := http.NewRequest(http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := p.ta.Do(req, scope)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf(
+				"problems encountered: unexpected response code %d; body: %s",
+				res.StatusCode,
+				body,
+			)
+		}
+
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+
+		next, err = nextPage(req.URL, res.Header.Get("Link"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tags, nil
+}
+
+// nextPage resolves the target of a 'Link: <...>; rel="next"' header against
+// the URL of the current page. It returns an empty string on the last page.
+func nextPage(current *url.URL, link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+
+	start := strings.Index(link, "<")
+	end := strings.Index(link, ">")
+	if start < 0 || end < start {
+		return "", fmt.Errorf("malformed Link header %q", link)
+	}
+
+	target, err := current.Parse(link[start+1 : end])
+	if err != nil {
+		return "", fmt.Errorf("malformed Link header %q: %w", link, err)
+	}
+
+	return target.String(), nil
+}
+
+// Close implements stream.Producer.
+func (p *tokenAuthTagsProducer) Close() error {
+	return nil
+}
+
+var _ stream.Producer = &tokenAuthTagsProducer{}
+
+// tokenAuthHTTP is the ProviderTokenAuth counterpart of stream.HTTP.
+type tokenAuthHTTP struct {
+	ta    *TokenAuth
+	req   *http.Request
+	scope string
+	res   *http.Response
+}
+
+// Produce implements stream.Producer.
+func (h *tokenAuthHTTP) Produce() (stdOut, stdErr io.Reader, err error) {
+	res, err := h.ta.Do(h.req, h.scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if res.StatusCode == http.StatusOK {
+		h.res = res
+		return res.Body, strings.NewReader(""), nil
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"problems encountered: unexpected response code %d",
+			res.StatusCode,
+		)
+	}
+
+	return nil, nil, fmt.Errorf(
+		"problems encountered: unexpected response code %d; body: %s",
+		res.StatusCode,
+		body,
+	)
+}
+
+// Close implements stream.Producer.
+func (h *tokenAuthHTTP) Close() error {
+	if h.res == nil {
+		return nil
+	}
+
+	return h.res.Body.Close()
+}
+
+var _ stream.Producer = &tokenAuthHTTP{}
@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ggcrV1Google "github.com/google/go-containerregistry/pkg/v1/google"
+	cr "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// fakeTokenAuthRegistry is a registry which requires tokens from its own token
+// server, as described by the Docker registry token authentication
+// specification.
+type fakeTokenAuthRegistry struct {
+	mutex         sync.Mutex
+	tokenRequests int
+	issuedAt      time.Time
+}
+
+func (f *fakeTokenAuthRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("service") != "fake" ||
+			r.URL.Query().Get("scope") != "repository:foo/bar:pull" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.mutex.Lock()
+		f.tokenRequests++
+		fmt.Fprintf(
+			w,
+			`{"token": "token-%d", "expires_in": 300, "issued_at": %q}`,
+			f.tokenRequests,
+			f.issuedAt.Format(time.RFC3339),
+		)
+		f.mutex.Unlock()
+
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+		w.Header().Set(
+			"WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="https://%s/token",service="fake"`, r.Host),
+		)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v2/foo/bar/tags/list":
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/foo/bar/tags/list?last=1.0>; rel="next"`)
+			fmt.Fprint(w, `{"name": "foo/bar", "tags": ["1.0"]}`)
+		} else {
+			fmt.Fprint(w, `{"name": "foo/bar", "tags": ["latest"]}`)
+		}
+	case "/v2/foo/bar/manifests/1.0", "/v2/foo/bar/manifests/latest":
+		w.Header().Set("Docker-Content-Digest", "sha256:000")
+		w.Header().Set("Content-Type", string(cr.DockerManifestSchema2))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestTokenAuthReadRepository(t *testing.T) {
+	tests := []struct {
+		name                  string
+		issuedAt              time.Time
+		expectedTokenRequests int
+	}{
+		{
+			"Tokens are cached until they expire",
+			time.Now(),
+			1,
+		},
+		{
+			// Every request (two pages of tags and two tags) needs a new
+			// token.
+			"Expired tokens are not reused",
+			time.Now().Add(-time.Hour),
+			4,
+		},
+	}
+
+	for _, test := range tests {
+		fake := &fakeTokenAuthRegistry{issuedAt: test.issuedAt}
+		server := httptest.NewTLSServer(fake)
+
+		ta := reg.NewTokenAuth("user", "secret")
+		ta.Client = server.Client()
+
+		sc := reg.SyncContext{TokenAuth: ta}
+		rc := reg.RegistryContext{
+			Name:     reg.RegistryName(strings.TrimPrefix(server.URL, "https://") + "/foo/bar"),
+			Provider: reg.ProviderTokenAuth,
+		}
+
+		producer := reg.MkReadRepositoryCmdReal(&sc, rc)
+		stdout, _, err := producer.Produce()
+		require.Nil(t, err, test.name)
+
+		var tags ggcrV1Google.Tags
+		require.Nil(t, json.NewDecoder(stdout).Decode(&tags), test.name)
+		require.Nil(t, producer.Close(), test.name)
+
+		require.Equal(t, []string{"1.0", "latest"}, tags.Tags, test.name)
+		require.Len(t, tags.Manifests, 1, test.name)
+		require.Equal(
+			t,
+			[]string{"1.0", "latest"},
+			tags.Manifests["sha256:000"].Tags,
+			test.name,
+		)
+		require.Equal(
+			t,
+			string(cr.DockerManifestSchema2),
+			tags.Manifests["sha256:000"].MediaType,
+			test.name,
+		)
+		require.Equal(t, test.expectedTokenRequests, fake.tokenRequests, test.name)
+
+		server.Close()
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EdgeSelector selects the promotion edges, and the requests promoting them,
+// whose live execution is traced. Every field which is set has to match.
+type EdgeSelector struct {
+	// Src is the source image of the edge, either as 'registry/image' or
+	// as 'registry/image:tag'.
+	Src string
+	// Dst is the destination image of the edge, in the same form as Src.
+	Dst string
+	// Digest is the promoted digest, or a prefix of it (such as the short
+	// digests which are logged with --short-digests).
+	Digest Digest
+}
+
+// ParseEdgeSelector parses a comma-separated list of 'src=', 'dst=' and
+// 'digest=' selectors, such as 'dst=gcr.io/foo/bar:1.0,digest=sha256:abc'.
+func ParseEdgeSelector(s string) (*EdgeSelector, error) {
+	var sel EdgeSelector
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf(
+				"invalid edge selector %q: expected 'src=', 'dst=' or 'digest=' followed by a value",
+				part,
+			)
+		}
+
+		switch kv[0] {
+		case "src":
+			sel.Src = kv[1]
+		case "dst":
+			sel.Dst = kv[1]
+		case "digest":
+			if !strings.HasPrefix(kv[1], "sha256:") {
+				return nil, fmt.Errorf("invalid edge selector %q: the digest must start with 'sha256:'", part)
+			}
+			sel.Digest = Digest(kv[1])
+		default:
+			return nil, fmt.Errorf("invalid edge selector %q: unknown key %q", part, kv[0])
+		}
+	}
+
+	return &sel, nil
+}
+
+// Matches returns true if the edge is selected.
+func (sel *EdgeSelector) Matches(edge PromotionEdge) bool {
+	return sel.matches(
+		edge.SrcRegistry.Name,
+		edge.SrcImageTag.ImageName,
+		edge.SrcImageTag.Tag,
+		edge.DstRegistry.Name,
+		edge.DstImageTag.ImageName,
+		edge.DstImageTag.Tag,
+		edge.Digest,
+	)
+}
+
+// MatchesRequest returns true if the request promotes a selected edge.
+func (sel *EdgeSelector) MatchesRequest(req PromotionRequest) bool {
+	return sel.matches(
+		req.RegistrySrc,
+		req.ImageNameSrc,
+		req.Tag,
+		req.RegistryDest,
+		req.ImageNameDest,
+		req.Tag,
+		req.Digest,
+	)
+}
+
+func (sel *EdgeSelector) matches(
+	srcRegistry RegistryName,
+	srcImage ImageName,
+	srcTag Tag,
+	dstRegistry RegistryName,
+	dstImage ImageName,
+	dstTag Tag,
+	digest Digest,
+) bool {
+	return selectsImage(sel.Src, srcRegistry, srcImage, srcTag) &&
+		selectsImage(sel.Dst, dstRegistry, dstImage, dstTag) &&
+		strings.HasPrefix(string(digest), string(sel.Digest))
+}
+
+// selectsImage returns true if the selector is empty, or names the image
+// either with or without its tag.
+func selectsImage(selector string, registry RegistryName, image ImageName, tag Tag) bool {
+	if selector == "" || selector == ToLQIN(registry, image) {
+		return true
+	}
+
+	return tag != "" && selector == ToPQIN(registry, image, tag)
+}
+
+// traced returns true if subject, a PromotionEdge or a PromotionRequest, is
+// selected by sc.TraceEdge. Nothing is traced without sc.TraceEdge.
+func (sc *SyncContext) traced(subject interface{}) bool {
+	if sc.TraceEdge == nil {
+		return false
+	}
+
+	switch s := subject.(type) {
+	case PromotionEdge:
+		return sc.TraceEdge.Matches(s)
+	case PromotionRequest:
+		return sc.TraceEdge.MatchesRequest(s)
+	default:
+		return false
+	}
+}
+
+// tracef logs a step of the live execution of subject at info level, if it
+// is traced (see traced).
+func (sc *SyncContext) tracef(subject interface{}, format string, args ...interface{}) {
+	if sc.traced(subject) {
+		logrus.Infof("[trace] "+format, args...)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestEdgeSelector(t *testing.T) {
+	edge := reg.PromotionEdge{
+		SrcRegistry: reg.RegistryContext{Name: "gcr.io/foo", Src: true},
+		SrcImageTag: reg.ImageTag{ImageName: "a", Tag: "1.0"},
+		Digest:      "sha256:0123456789",
+		DstRegistry: reg.RegistryContext{Name: "gcr.io/bar"},
+		DstImageTag: reg.ImageTag{ImageName: "b", Tag: "1.0"},
+	}
+
+	tests := []struct {
+		selector  string
+		matches   bool
+		expectErr bool
+	}{
+		{"dst=gcr.io/bar/b", true, false},
+		{"dst=gcr.io/bar/b:1.0", true, false},
+		{"dst=gcr.io/bar/b:1.1", false, false},
+		{"dst=gcr.io/bar/a", false, false},
+		{"src=gcr.io/foo/a:1.0,dst=gcr.io/bar/b", true, false},
+		{"src=gcr.io/foo/b", false, false},
+		{"digest=sha256:0123", true, false},
+		{"dst=gcr.io/bar/b,digest=sha256:4567", false, false},
+		{"digest=0123", false, true},
+		{"dst=", false, true},
+		{"gcr.io/bar/b", false, true},
+		{"tag=1.0", false, true},
+	}
+
+	for _, test := range tests {
+		sel, err := reg.ParseEdgeSelector(test.selector)
+		if test.expectErr {
+			require.Error(t, err, test.selector)
+			continue
+		}
+
+		require.NoError(t, err, test.selector)
+		require.Equal(t, test.matches, sel.Matches(edge), test.selector)
+	}
+}
+
+func TestTraceEdge(t *testing.T) {
+	srcRC := reg.RegistryContext{Name: "gcr.io/foo", Src: true}
+	dstRC := reg.RegistryContext{Name: "gcr.io/bar"}
+
+	edges := make(map[reg.PromotionEdge]interface{})
+	digests := reg.DigestTags{}
+	for i := 0; i < 10; i++ {
+		digest := reg.Digest(fmt.Sprintf("sha256:%03d", i))
+		tag := reg.Tag(fmt.Sprintf("1.%d", i))
+		digests[digest] = reg.TagSlice{tag}
+		edges[reg.PromotionEdge{
+			SrcRegistry: srcRC,
+			SrcImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+			Digest:      digest,
+			DstRegistry: dstRC,
+			DstImageTag: reg.ImageTag{ImageName: "a", Tag: tag},
+		}] = nil
+	}
+
+	sel, err := reg.ParseEdgeSelector("dst=gcr.io/bar/a:1.7")
+	require.Nil(t, err)
+
+	out := logrus.StandardLogger().Out
+	defer logrus.SetOutput(out)
+
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			srcRC.Name: reg.RegInvImage{"a": digests},
+			dstRC.Name: reg.RegInvImage{},
+		},
+		// The trace replaces the sampling.
+		LogSampleRate: 1000,
+		TraceEdge:     sel,
+	}
+
+	candidates, clean := sc.GetPromotionCandidates(edges)
+	require.True(t, clean)
+	require.Len(t, candidates, len(edges))
+
+	logged := make([]string, 0)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.Contains(line, "regular promotion") {
+			logged = append(logged, line)
+		}
+	}
+
+	require.Len(t, logged, 1)
+	require.Contains(t, logged[0], "sha256:007")
+}
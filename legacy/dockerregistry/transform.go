@@ -0,0 +1,304 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/upload"
+)
+
+// TransformAndPush pulls the image at srcVertex, hands it to the transformer
+// plugin as a tarball of an OCI image layout on stdin, and pushes the image
+// found in the OCI image layout tarball written by the plugin to stdout to
+// dstVertex. It returns the digests of the original and the transformed image.
+//
+// The plugin is free to change the image in any way it likes, so the digest
+// pushed to the destination will most likely differ from the digest found in
+// the promoter manifest. Manifest lists are rejected, as the plugin only
+// receives a single image.
+func TransformAndPush(
+	plugin []string,
+	srcVertex, dstVertex string,
+	opts ...crane.Option,
+) (original, transformed Digest, err error) {
+	if len(plugin) == 0 {
+		return "", "", fmt.Errorf("no transformer plugin command given")
+	}
+
+	desc, err := crane.Head(srcVertex, opts...)
+	if err != nil {
+		return "", "", fmt.Errorf("getting descriptor of %s: %w", srcVertex, err)
+	}
+
+	if desc.MediaType.IsIndex() {
+		return "", "", fmt.Errorf(
+			"%s is a manifest list (%s), which cannot be transformed",
+			srcVertex,
+			desc.MediaType,
+		)
+	}
+
+	img, err := crane.Pull(srcVertex, opts...)
+	if err != nil {
+		return "", "", fmt.Errorf("pulling %s: %w", srcVertex, err)
+	}
+
+	originalHash, err := img.Digest()
+	if err != nil {
+		return "", "", fmt.Errorf("getting digest of %s: %w", srcVertex, err)
+	}
+	original = Digest(originalHash.String())
+
+	tmpDir, err := ioutil.TempDir("", "cip-transform-")
+	if err != nil {
+		return "", "", fmt.Errorf("creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	inDir := filepath.Join(tmpDir, "in")
+	outDir := filepath.Join(tmpDir, "out")
+
+	if err := crane.SaveOCI(img, inDir); err != nil {
+		return "", "", fmt.Errorf("writing OCI layout for %s: %w", srcVertex, err)
+	}
+
+	var stdin, stdout, stderr bytes.Buffer
+	if err := tarDirectory(inDir, &stdin); err != nil {
+		return "", "", fmt.Errorf("archiving OCI layout: %w", err)
+	}
+
+	// nolint: gosec
+	cmd := exec.Command(plugin[0], plugin[1:]...)
+	cmd.Stdin = &stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", "", fmt.Errorf(
+			"running transformer plugin %q: %s: %w",
+			strings.Join(plugin, " "),
+			stderr.String(),
+			err,
+		)
+	}
+
+	if err := untarDirectory(&stdout, outDir); err != nil {
+		return "", "", fmt.Errorf("extracting transformer plugin output: %w", err)
+	}
+
+	lp, err := layout.FromPath(outDir)
+	if err != nil {
+		return "", "", fmt.Errorf("reading transformer plugin output: %w", err)
+	}
+
+	index, err := lp.ImageIndex()
+	if err != nil {
+		return "", "", fmt.Errorf("reading transformer plugin output: %w", err)
+	}
+
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return "", "", fmt.Errorf("reading transformer plugin output: %w", err)
+	}
+
+	if len(indexManifest.Manifests) != 1 {
+		return "", "", fmt.Errorf(
+			"transformer plugin must output exactly one image, got %d",
+			len(indexManifest.Manifests),
+		)
+	}
+
+	transformedImg, err := index.Image(indexManifest.Manifests[0].Digest)
+	if err != nil {
+		return "", "", fmt.Errorf("reading transformed image: %w", err)
+	}
+
+	transformedHash, err := transformedImg.Digest()
+	if err != nil {
+		return "", "", fmt.Errorf("getting digest of transformed image: %w", err)
+	}
+	transformed = Digest(transformedHash.String())
+
+	logrus.Infof(
+		"transformed %s: original digest %s, transformed digest %s",
+		srcVertex,
+		original,
+		transformed,
+	)
+
+	if err := crane.Push(transformedImg, dstVertex, opts...); err != nil {
+		return "", "", fmt.Errorf("pushing transformed image to %s: %w", dstVertex, err)
+	}
+
+	return original, transformed, nil
+}
+
+// transformedDigest returns the digest the image with the digest is pushed
+// as, which differs if it was transformed when it was promoted.
+func (sc *SyncContext) transformedDigest(digest Digest) Digest {
+	if transformed, ok := sc.TransformedDigest[digest]; ok {
+		return transformed
+	}
+
+	return digest
+}
+
+// vertexProps is like edge.VertexProps, but looks the destination up under
+// the transformed digest of the image, if any.
+func (sc *SyncContext) vertexProps(edge PromotionEdge) (sp, dp VertexProperty) {
+	sp = edge.VertexPropsFor(&edge.SrcRegistry, &edge.SrcImageTag, &sc.Inv)
+
+	dstEdge := edge
+	dstEdge.Digest = sc.transformedDigest(edge.Digest)
+	dp = dstEdge.VertexPropsFor(&dstEdge.DstRegistry, &dstEdge.DstImageTag, &sc.Inv)
+
+	return sp, dp
+}
+
+// ParseTransformedDigestFromFile parses the digests recorded by
+// TransformedDigest.WriteToFile. It returns an empty TransformedDigest if the
+// file does not exist yet.
+func ParseTransformedDigestFromFile(filePath string) (TransformedDigest, error) {
+	td := make(TransformedDigest)
+
+	b, err := ioutil.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return td, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(b, &td); err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// WriteToFile records the digests, replacing any previous version of the
+// file. As the transformed digests differ from those of the manifests, later
+// runs need them to tell that an edge was already promoted.
+func (td TransformedDigest) WriteToFile(filePath string) error {
+	b, err := yaml.Marshal(td)
+	if err != nil {
+		return err
+	}
+
+	return upload.Write(filePath, b)
+}
+
+// tarDirectory writes all regular files below dir into w as a tar archive.
+func tarDirectory(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// untarDirectory extracts the tar archive read from r into dir.
+func untarDirectory(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Guard against archive entries escaping the target directory.
+		target := filepath.Join(dir, filepath.Clean("/"+hdr.Name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(0o755)); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), os.FileMode(0o755)); err != nil {
+				return err
+			}
+
+			f, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+
+			// nolint: gosec
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
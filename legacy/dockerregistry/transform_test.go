@@ -0,0 +1,156 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+// countingTransport counts the requests sent through it.
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTransformAndPush(t *testing.T) {
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	img, err := random.Image(1024, 1)
+	require.Nil(t, err)
+	digest, err := img.Digest()
+	require.Nil(t, err)
+	require.Nil(t, crane.Push(img, host+"/src/foo:1.0"))
+
+	index, err := random.Index(1024, 1, 2)
+	require.Nil(t, err)
+	ref, err := name.ParseReference(host + "/src/list:1.0")
+	require.Nil(t, err)
+	require.Nil(t, remote.WriteIndex(ref, index))
+
+	transport := &countingTransport{}
+
+	// cat hands the image back unchanged.
+	original, transformed, err := reg.TransformAndPush(
+		[]string{"cat"},
+		host+"/src/foo:1.0",
+		host+"/dst/foo:1.0",
+		crane.WithTransport(transport),
+	)
+	require.Nil(t, err)
+	require.Equal(t, reg.Digest(digest.String()), original)
+	require.Equal(t, original, transformed)
+	require.NotZero(t, atomic.LoadInt32(&transport.requests))
+
+	pushed, err := crane.Digest(host + "/dst/foo:1.0")
+	require.Nil(t, err)
+	require.Equal(t, string(transformed), pushed)
+
+	_, _, err = reg.TransformAndPush(
+		[]string{"cat"},
+		host+"/src/list:1.0",
+		host+"/dst/list:1.0",
+	)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "is a manifest list")
+
+	_, _, err = reg.TransformAndPush(
+		[]string{"false"},
+		host+"/src/foo:1.0",
+		host+"/dst/foo:1.1",
+	)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "running transformer plugin")
+}
+
+func TestTransformedDigestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transformed.yaml")
+
+	td, err := reg.ParseTransformedDigestFromFile(path)
+	require.Nil(t, err)
+	require.Empty(t, td)
+
+	td[reg.Digest("sha256:"+strings.Repeat("a", 64))] = reg.Digest("sha256:" + strings.Repeat("b", 64))
+	require.Nil(t, td.WriteToFile(path))
+
+	parsed, err := reg.ParseTransformedDigestFromFile(path)
+	require.Nil(t, err)
+	require.Equal(t, td, parsed)
+}
+
+func TestGetPromotionCandidatesTransformed(t *testing.T) {
+	original := reg.Digest("sha256:" + strings.Repeat("a", 64))
+	transformed := reg.Digest("sha256:" + strings.Repeat("b", 64))
+
+	mkEdge := func(tag reg.Tag) reg.PromotionEdge {
+		return reg.PromotionEdge{
+			SrcRegistry: reg.RegistryContext{Name: "gcr.io/src"},
+			SrcImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+			Digest:      original,
+			DstRegistry: reg.RegistryContext{Name: "gcr.io/dst"},
+			DstImageTag: reg.ImageTag{ImageName: "foo", Tag: tag},
+		}
+	}
+
+	edges := map[reg.PromotionEdge]interface{}{
+		mkEdge("1.0"): nil,
+		mkEdge(""):    nil,
+	}
+
+	sc := reg.SyncContext{
+		Inv: reg.MasterInventory{
+			"gcr.io/src": reg.RegInvImage{
+				"foo": reg.DigestTags{original: reg.TagSlice{"1.0"}},
+			},
+			"gcr.io/dst": reg.RegInvImage{
+				"foo": reg.DigestTags{transformed: reg.TagSlice{"1.0"}},
+			},
+		},
+		TransformedDigest: reg.TransformedDigest{},
+	}
+
+	// Without the transformed digest, the destination looks like it has
+	// another image.
+	toPromote, clean := sc.GetPromotionCandidates(edges)
+	require.True(t, clean)
+	require.Len(t, toPromote, 2)
+
+	sc.TransformedDigest[original] = transformed
+	toPromote, clean = sc.GetPromotionCandidates(edges)
+	require.True(t, clean)
+	require.Empty(t, toPromote)
+}
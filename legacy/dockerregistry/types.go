@@ -17,7 +17,10 @@ limitations under the License.
 package inventory
 
 import (
+	"io"
+	"net/http"
 	"sync"
+	"time"
 
 	cr "github.com/google/go-containerregistry/pkg/v1/types"
 	grafeaspb "google.golang.org/genproto/googleapis/grafeas/v1"
@@ -73,6 +76,11 @@ type CapturedRequests map[PromotionRequest]int
 // CollectedLogs holds all the Errors that are generated as the promoter runs.
 type CollectedLogs struct {
 	Errors Errors
+	// ExtraTags are the destination tags which no manifest declares, if
+	// they were reported (see ExtraTagPolicyReport).
+	ExtraTags []ExtraTag `json:",omitempty"`
+	// Plan classifies the changes of a dry run (see ReportPlan).
+	Plan *Plan `json:",omitempty"`
 }
 
 // SyncContext is the main data structure for performing the promotion.
@@ -87,8 +95,153 @@ type SyncContext struct {
 	Tokens            map[RootRepo]gcloud.Token
 	DigestMediaType   DigestMediaType
 	DigestImageSize   DigestImageSize
+	DigestUploaded    DigestUploaded
 	ParentDigest      ParentDigest
+	ListPlatforms     ListPlatforms
 	Logs              CollectedLogs
+
+	// TransformerPlugin is the command (and its arguments) that every image
+	// is piped through before being pushed to the destination. An empty
+	// value disables image transformation.
+	TransformerPlugin []string
+	TransformedDigest TransformedDigest
+
+	// ShadowCommand is the command (and its arguments, with the Shadow*
+	// placeholders) that copies every image in place of the promoter, so
+	// that an alternative copier can be compared with it. An empty value
+	// disables it.
+	ShadowCommand []string
+
+	// ManifestListMediaType is the media type manifest lists are written
+	// with at the destination. An empty value preserves the media type of
+	// the source.
+	ManifestListMediaType cr.MediaType
+
+	// SeverityMapping normalizes the severities of vulnerabilities before
+	// they are gated on or reported. If nil, severities are used as they are
+	// reported.
+	SeverityMapping *SeverityMapping
+
+	// UpgradeSchemaV1 converts the Docker schema v1 images which are promoted
+	// to schema v2. As this changes their digest, it is opt-in.
+	UpgradeSchemaV1 bool
+
+	// LayerConcurrency is the number of layers of a single image which are
+	// copied concurrently. A value of 0 uses the default of the underlying
+	// library.
+	LayerConcurrency int
+
+	// StorageGroups lists the destination registries which share their
+	// backing storage, so that a digest only needs to be copied into each
+	// group once.
+	StorageGroups StorageGroups
+
+	// SourceFallbacks are the alternate source registries tried, in order,
+	// for the edges whose digest is missing from their source registry.
+	SourceFallbacks []RegistryContext
+
+	// Breaker throttles and eventually aborts the promotions to destinations
+	// which keep failing. If nil, all destinations are always promoted to
+	// with full concurrency.
+	Breaker *DestinationBreaker
+
+	// Batcher paces the promotions to every destination in batches. If nil,
+	// the requests to a destination are started as soon as a thread is free.
+	Batcher *DestinationBatcher
+
+	// ConcurrencyRamp is the time over which the number of workers promoting
+	// images is ramped up from 1 to the configured maximum. A value of 0
+	// starts all of them at once.
+	ConcurrencyRamp time.Duration
+
+	// Checkpointer records the progress of Promote, so that a restarted run
+	// can resume from it. If nil, no checkpoint is written.
+	Checkpointer *Checkpointer
+
+	// ReverifyBeforeCopy resolves the source tag of every request again
+	// right before it is copied, and aborts the request if the tag no longer
+	// points to the digest being promoted.
+	ReverifyBeforeCopy bool
+
+	// Deadline bounds the whole promotion: once it has passed, Promote starts
+	// no new requests, but lets the requests in flight finish. A zero value
+	// means no deadline.
+	Deadline time.Time
+
+	// ShortDigests abbreviates the digests in human-readable output, such as
+	// the logged promotion edges. It never affects what is promoted, nor
+	// machine-readable output.
+	ShortDigests bool
+
+	// LogSampleRate only emits the routine per-edge logs of 1 in this many
+	// edges, chosen consistently by destination and digest. Warnings, errors
+	// and summaries are always logged. Values below 2 log every edge.
+	LogSampleRate int
+
+	// TraceEdge logs every step of the promotion of the edges it selects,
+	// and replaces LogSampleRate: the routine per-edge logs of all other
+	// edges are dropped. Warnings, errors and summaries are always logged.
+	TraceEdge *EdgeSelector
+
+	// DestCheckMode decides how FilterPromotionEdges finds out which
+	// destinations already exist: DestCheckInventory (or empty) reads the
+	// destination repositories, DestCheckPerEdge sends HEAD requests for the
+	// destination of every edge instead.
+	DestCheckMode string
+
+	// Out receives the human-readable reports, such as the requests captured
+	// in a dry run. If nil, they are written to stdout.
+	Out io.Writer
+
+	// PruneMinAge protects recently pushed images from garbage collection:
+	// digests uploaded within this window are never deleted. A value of 0
+	// disables the protection.
+	PruneMinAge time.Duration
+
+	// PromotionResults holds the outcome of every request executed (or, in a
+	// dry run, captured) by Promote.
+	PromotionResults []PromotionResult
+
+	// RetryClassifier decides which failed registry reads are retried. If
+	// nil, only stream.DefaultRetryableErrorPatterns are retried.
+	RetryClassifier *stream.RetryClassifier
+
+	// RetryBudget limits the total number of retries of registry reads
+	// across the whole run. If nil, retries are unlimited.
+	RetryBudget *stream.RetryBudget
+
+	// TokenAuth holds the credentials for registries with the
+	// ProviderTokenAuth provider.
+	TokenAuth *TokenAuth
+
+	// Transport is the HTTP transport used to talk to the registries, such
+	// as one presenting a client certificate (see NewClientCertTransport).
+	// It is shared by all registries; if nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// SnapshotCheckpointer records the repositories read by ReadRegistries,
+	// so that an interrupted read can be resumed. If nil, nothing is
+	// recorded.
+	SnapshotCheckpointer *SnapshotCheckpointer
+
+	// ReadThreads and WriteThreads override Threads for reading registries
+	// and for writing to them (promoting or deleting images), respectively.
+	// Threads is used instead of either of them if it is 0.
+	ReadThreads  int
+	WriteThreads int
+
+	// Timings records how long each stage of the promotion took.
+	Timings Timings
+}
+
+// Timings records the time spent reading registries, computing promotion
+// edges and copying images. CopyByDestination holds the cumulative time spent
+// copying to each destination registry.
+type Timings struct {
+	ReadRegistries    time.Duration
+	ComputeEdges      time.Duration
+	Copy              time.Duration
+	CopyByDestination map[RegistryName]time.Duration
 }
 
 // PreCheck represents a check function to run against a pull request that
@@ -107,6 +260,15 @@ type ImageVulnCheck struct {
 	PullEdges         map[PromotionEdge]interface{}
 	SeverityThreshold int
 	FakeVulnProducer  ImageVulnProducer
+
+	// GitHubAnnotations causes every severe vulnerability to be written to the
+	// output of the SyncContext as a GitHub Actions workflow command, so that
+	// it shows up in the summary of the workflow run.
+	GitHubAnnotations bool
+
+	// Results holds the outcome of scanning each source digest, once Run
+	// returns.
+	Results []ScanResult
 }
 
 // ImageSizeCheck implements the PreCheck interface and checks against
@@ -251,6 +413,30 @@ type PromotionRequest struct {
 	Tag            Tag
 }
 
+// PromotionResult is the outcome of a single PromotionRequest executed by
+// Promote. Skipped is set for requests which were only captured during a dry
+// run, or which were never started because the deadline of the run had
+// passed (in which case DeadlineReached is set too).
+type PromotionResult struct {
+	Request         PromotionRequest
+	Duration        time.Duration
+	Errors          Errors
+	Skipped         bool
+	DeadlineReached bool
+	// MountedFrom is the image whose blobs were mounted to satisfy the
+	// request, if its destination is in a storage group which had already
+	// received the digest. It is empty for a full copy from the source.
+	MountedFrom string
+	// Shadow is the outcome of SyncContext.ShadowCommand, if the request
+	// was executed by it.
+	Shadow *ShadowOutcome
+	// BytesPerSecond is the throughput of the copy, based on the image size
+	// recorded while reading the registries. It is 0 (N/A) if the request
+	// failed, moved no bytes through the promoter (e.g. mounted blobs) or
+	// the size of the image is unknown.
+	BytesPerSecond float64
+}
+
 // Manifest stores the information in a manifest file (describing the
 // desired state of a Docker Registry).
 type Manifest struct {
@@ -259,6 +445,9 @@ type Manifest struct {
 	// destination registries.
 	Registries []RegistryContext `yaml:"registries,omitempty"`
 	Images     []Image           `yaml:"images,omitempty"`
+	// DefaultServiceAccount is used for every registry which does not set
+	// its own service account.
+	DefaultServiceAccount string `yaml:"defaultServiceAccount,omitempty"`
 
 	// Hidden fields; these are data structure optimizations that are populated
 	// from the fields above. As they are redundant, there is no point in
@@ -275,6 +464,9 @@ type Manifest struct {
 // src/destination repos or the credentials tied to them.
 type ThinManifest struct {
 	Registries []RegistryContext `yaml:"registries,omitempty"`
+	// DefaultServiceAccount is used for every registry which does not set
+	// its own service account.
+	DefaultServiceAccount string `yaml:"defaultServiceAccount,omitempty"`
 	// Store actual image data somewhere else.
 	//
 	// NOTE: "ImagesPath" is deprecated. It does nothing and will be
@@ -315,6 +507,10 @@ type ThinManifest struct {
 type Image struct {
 	ImageName ImageName  `yaml:"name"`
 	Dmap      DigestTags `yaml:"dmap,omitempty"`
+	// Environments restricts the image to the promotions targeting one of
+	// these environments (see SelectEnvironment). An image without
+	// environments is promoted for every environment.
+	Environments []string `yaml:"environments,omitempty"`
 }
 
 // Images is a slice of Image types.
@@ -337,6 +533,11 @@ type RegistryContext struct {
 	ServiceAccount string       `yaml:"service-account,omitempty"`
 	Token          gcloud.Token `yaml:"-"`
 	Src            bool         `yaml:"src,omitempty"`
+	// Provider selects how to authenticate against the registry. The
+	// default is to use GCR access tokens; ProviderTokenAuth performs the
+	// Docker registry token exchange with the credentials of
+	// SyncContext.TokenAuth.
+	Provider string `yaml:"provider,omitempty"`
 }
 
 // GCRManifestListContext is used only for reading GCRManifestList information
@@ -364,10 +565,54 @@ type DigestMediaType map[Digest]cr.MediaType
 // DigestImageSize holds information about the size of an image in bytes.
 type DigestImageSize map[Digest]int
 
+// DigestUploaded holds the time at which a Digest was pushed to each registry.
+type DigestUploaded map[RegistryName]map[Digest]time.Time
+
 // ParentDigest holds a map of the digests of children to parent digests. It is
 // a reverse mapping of ManifestLists, which point to all the child manifests.
 type ParentDigest map[Digest]Digest
 
+// ListPlatforms holds the children of every ManifestList, together with the
+// platform each child is for.
+type ListPlatforms map[Digest][]PlatformDigest
+
+// PlatformDigest is a child of a ManifestList.
+type PlatformDigest struct {
+	Platform string `json:"platform" yaml:"platform"`
+	Digest   Digest `json:"digest" yaml:"digest"`
+}
+
+// ManifestListReport describes a ManifestList image: its tags, its digest and
+// the child images it references for each platform.
+type ManifestListReport struct {
+	Image     ImageName        `json:"image" yaml:"image"`
+	Tags      TagSlice         `json:"tags" yaml:"tags"`
+	Digest    Digest           `json:"digest" yaml:"digest"`
+	Platforms []PlatformDigest `json:"platforms" yaml:"platforms"`
+}
+
+// ClearPlan lists the images that clearing a repository deletes, in the
+// order they are deleted in.
+type ClearPlan struct {
+	Repository RegistryName     `json:"repository" yaml:"repository"`
+	Images     []ClearPlanImage `json:"images" yaml:"images"`
+}
+
+// ClearPlanImage is an image deleted when clearing a repository, along with
+// the command which deletes it.
+type ClearPlanImage struct {
+	Image     ImageName `json:"image" yaml:"image"`
+	Digest    Digest    `json:"digest" yaml:"digest"`
+	MediaType string    `json:"mediaType" yaml:"mediaType"`
+	Tags      TagSlice  `json:"tags" yaml:"tags"`
+	Command   []string  `json:"command" yaml:"command"`
+}
+
+// TransformedDigest is a map of the original digest of an image to the digest
+// of the image after it has been rewritten by a transformer plugin, or after
+// its media type has been converted.
+type TransformedDigest map[Digest]Digest
+
 // Digest is a string that contains the SHA256 hash of a Docker container image.
 type Digest string
 
@@ -0,0 +1,126 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	containeranalysis "cloud.google.com/go/containeranalysis/apiv1"
+	grafeaspb "google.golang.org/genproto/googleapis/grafeas/v1"
+)
+
+// VulnerableImage is an image of a snapshot with at least one vulnerability
+// finding, annotated with the highest severity among its findings.
+type VulnerableImage struct {
+	Image           ImageName `json:"image" yaml:"image"`
+	Digest          Digest    `json:"digest" yaml:"digest"`
+	Tags            TagSlice  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	HighestSeverity string    `json:"highestSeverity" yaml:"highestSeverity"`
+	Findings        int       `json:"findings" yaml:"findings"`
+}
+
+// FindVulnerableImages looks up the vulnerability findings of every image in
+// the snapshot rii of registryName concurrently, and returns the images with
+// at least one finding, sorted by image and digest. If producer is nil, the
+// findings are read from the Container Analysis API. All failed lookups are
+// reported together.
+func (sc *SyncContext) FindVulnerableImages(
+	registryName RegistryName,
+	rii RegInvImage,
+	producer ImageVulnProducer,
+) ([]VulnerableImage, error) {
+	if producer == nil {
+		client, err := containeranalysis.NewClient(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("NewClient: %v", err)
+		}
+		defer client.Close()
+		producer = mkRealVulnProducer(client)
+	}
+
+	images := make([]VulnerableImage, 0)
+	for imageName, digestTags := range rii {
+		for digest, tags := range digestTags {
+			images = append(images, VulnerableImage{
+				Image:  imageName,
+				Digest: digest,
+				Tags:   tags,
+			})
+		}
+	}
+
+	errs := make([]error, len(images))
+	sc.forEachConcurrently(len(images), func(i int) {
+		occurrences, err := producer(PromotionEdge{
+			SrcRegistry: RegistryContext{Name: registryName},
+			SrcImageTag: ImageTag{ImageName: images[i].Image},
+			Digest:      images[i].Digest,
+		})
+		if err != nil {
+			errs[i] = err
+			return
+		}
+
+		highest := grafeaspb.Severity_SEVERITY_UNSPECIFIED
+		for _, occ := range occurrences {
+			if severity := sc.SeverityMapping.Normalize(occ.GetVulnerability()); severity > highest {
+				highest = severity
+			}
+		}
+
+		images[i].Findings = len(occurrences)
+		images[i].HighestSeverity = highest.String()
+	})
+
+	failed := make([]string, 0)
+	vulnerable := make([]VulnerableImage, 0)
+	for i, image := range images {
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf(
+				"%s (%v)",
+				ToFQIN(registryName, image.Image, image.Digest),
+				errs[i],
+			))
+			continue
+		}
+
+		if image.Findings > 0 {
+			vulnerable = append(vulnerable, image)
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return nil, fmt.Errorf(
+			"looking up the vulnerabilities of %d images: %s",
+			len(failed),
+			strings.Join(failed, ", "),
+		)
+	}
+
+	sort.Slice(vulnerable, func(i, j int) bool {
+		if vulnerable[i].Image != vulnerable[j].Image {
+			return vulnerable[i].Image < vulnerable[j].Image
+		}
+		return vulnerable[i].Digest < vulnerable[j].Digest
+	})
+
+	return vulnerable, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inventory_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	grafeaspb "google.golang.org/genproto/googleapis/grafeas/v1"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+)
+
+func TestFindVulnerableImages(t *testing.T) {
+	mkOccurrence := func(severity grafeaspb.Severity) *grafeaspb.Occurrence {
+		return &grafeaspb.Occurrence{
+			Details: &grafeaspb.Occurrence_Vulnerability{
+				Vulnerability: &grafeaspb.VulnerabilityOccurrence{
+					Severity: severity,
+				},
+			},
+		}
+	}
+
+	rii := reg.RegInvImage{
+		"foo": {
+			"sha256:000": {"1.0"},
+			"sha256:111": {"2.0"},
+		},
+		"bar": {
+			"sha256:222": {},
+		},
+	}
+
+	findings := map[reg.Digest][]*grafeaspb.Occurrence{
+		"sha256:000": {
+			mkOccurrence(grafeaspb.Severity_LOW),
+			mkOccurrence(grafeaspb.Severity_HIGH),
+			mkOccurrence(grafeaspb.Severity_MEDIUM),
+		},
+		"sha256:222": {
+			mkOccurrence(grafeaspb.Severity_CRITICAL),
+		},
+	}
+
+	sc := reg.SyncContext{}
+	vulnerable, err := sc.FindVulnerableImages(
+		"gcr.io/foo",
+		rii,
+		func(edge reg.PromotionEdge) ([]*grafeaspb.Occurrence, error) {
+			require.Equal(t, reg.RegistryName("gcr.io/foo"), edge.SrcRegistry.Name)
+			return findings[edge.Digest], nil
+		},
+	)
+	require.Nil(t, err)
+	require.Equal(
+		t,
+		[]reg.VulnerableImage{
+			{
+				Image:           "bar",
+				Digest:          "sha256:222",
+				Tags:            reg.TagSlice{},
+				HighestSeverity: "CRITICAL",
+				Findings:        1,
+			},
+			{
+				Image:           "foo",
+				Digest:          "sha256:000",
+				Tags:            reg.TagSlice{"1.0"},
+				HighestSeverity: "HIGH",
+				Findings:        3,
+			},
+		},
+		vulnerable,
+	)
+
+	_, err = sc.FindVulnerableImages(
+		"gcr.io/foo",
+		rii,
+		func(edge reg.PromotionEdge) ([]*grafeaspb.Occurrence, error) {
+			if edge.Digest == "sha256:111" {
+				return nil, errors.New("permission denied")
+			}
+			return nil, nil
+		},
+	)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "gcr.io/foo/foo@sha256:111 (permission denied)")
+}
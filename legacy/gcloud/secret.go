@@ -0,0 +1,286 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcloud
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"sigs.k8s.io/release-utils/command"
+)
+
+const (
+	// CredentialSourceGCPSecretManager prefixes the name of a GCP Secret
+	// Manager secret, e.g. gcpsm://projects/<project>/secrets/<secret>. The
+	// latest version of the secret is used.
+	CredentialSourceGCPSecretManager = "gcpsm://"
+
+	// CredentialSourceVault prefixes the path of a Vault secret, optionally
+	// followed by '#<field>', e.g. vault://secret/promoter#key. The field
+	// defaults to vaultDefaultField.
+	CredentialSourceVault = "vault://"
+
+	vaultDefaultField = "key"
+
+	// cloudPlatformScope is the OAuth scope of the access tokens minted for
+	// in-memory service accounts, as used by gcloud for its own accounts.
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// FetchCredential fetches the key material referenced by the credential
+// source URI from its secret manager. The secret is only held in memory.
+func FetchCredential(source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, CredentialSourceGCPSecretManager):
+		secret := strings.TrimPrefix(source, CredentialSourceGCPSecretManager)
+		if secret == "" {
+			return nil, fmt.Errorf("credential source %s names no secret", source)
+		}
+
+		std, err := command.New(
+			"gcloud",
+			"secrets",
+			"versions",
+			"access",
+			"latest",
+			"--secret="+secret,
+		).RunSilentSuccessOutput()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"fetching %s from GCP Secret Manager (does the active account "+
+					"have the roles/secretmanager.secretAccessor role?): %w",
+				source,
+				err,
+			)
+		}
+
+		return []byte(std.Output()), nil
+
+	case strings.HasPrefix(source, CredentialSourceVault):
+		path := strings.TrimPrefix(source, CredentialSourceVault)
+		field := vaultDefaultField
+		if i := strings.LastIndex(path, "#"); i >= 0 {
+			path, field = path[:i], path[i+1:]
+		}
+		if path == "" || field == "" {
+			return nil, fmt.Errorf(
+				"credential source %s must look like %s<path>[#<field>]",
+				source,
+				CredentialSourceVault,
+			)
+		}
+
+		std, err := command.New(
+			"vault",
+			"kv",
+			"get",
+			"-field="+field,
+			path,
+		).RunSilentSuccessOutput()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"fetching %s from Vault (are VAULT_ADDR and VAULT_TOKEN set, "+
+					"and does the secret have the field %q?): %w",
+				source,
+				field,
+				err,
+			)
+		}
+
+		return []byte(std.Output()), nil
+	}
+
+	return nil, fmt.Errorf(
+		"unsupported credential source %s; expected %s<secret> or %s<path>",
+		source,
+		CredentialSourceGCPSecretManager,
+		CredentialSourceVault,
+	)
+}
+
+// LoadServiceAccountsFromSources is like ActivateServiceAccounts, but fetches
+// the JSON keys from the given CSV of credential source URIs instead of
+// reading them from files, and never writes them to disk: gcloud would store
+// activated keys in its configuration directory, so the accounts are not
+// activated at all. Instead, their access tokens are minted from the keys held
+// in memory (see GetServiceAccountToken, MaybeUseServiceAccount and
+// InMemoryTokenSource).
+//
+// The returned cleanup function forgets the accounts again, and removes the
+// short-lived access tokens handed to gcloud.
+func LoadServiceAccountsFromSources(
+	sources string,
+) (accounts map[string]string, cleanup func() error, err error) {
+	accounts = make(map[string]string)
+
+	r := csv.NewReader(strings.NewReader(sources))
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			forgetInMemoryAccounts()
+			return nil, nil, err
+		}
+
+		for _, source := range record {
+			keyJSON, err := FetchCredential(source)
+			if err == nil {
+				err = addInMemoryAccount(keyJSON)
+			}
+			if err != nil {
+				forgetInMemoryAccounts()
+				return nil, nil, fmt.Errorf(
+					"loading the service account of %s: %w",
+					source,
+					err,
+				)
+			}
+
+			key, err := ParseServiceAccountKey(keyJSON, source)
+			if err != nil {
+				logrus.Warnf("not selecting the service account by project: %v", err)
+				continue
+			}
+
+			addAccount(accounts, key)
+		}
+	}
+
+	return accounts, forgetInMemoryAccounts, nil
+}
+
+// inMemoryAccounts holds the token sources of the service accounts loaded by
+// LoadServiceAccountsFromSources, keyed by their email, and the directory of
+// the access token files handed to gcloud for them.
+var inMemoryAccounts = struct {
+	sync.Mutex
+	sources    map[string]oauth2.TokenSource
+	tokenDir   string
+	tokenFiles map[string]string
+	written    map[string]string
+}{
+	sources:    make(map[string]oauth2.TokenSource),
+	tokenFiles: make(map[string]string),
+	written:    make(map[string]string),
+}
+
+// addInMemoryAccount registers the service account of the JSON key.
+func addInMemoryAccount(keyJSON []byte) error {
+	cfg, err := google.JWTConfigFromJSON(keyJSON, cloudPlatformScope)
+	if err != nil {
+		return err
+	}
+
+	inMemoryAccounts.Lock()
+	defer inMemoryAccounts.Unlock()
+
+	if _, ok := inMemoryAccounts.sources[cfg.Email]; !ok {
+		inMemoryAccounts.sources[cfg.Email] = oauth2.ReuseTokenSource(
+			nil,
+			cfg.TokenSource(context.Background()),
+		)
+	}
+
+	return nil
+}
+
+// InMemoryTokenSource returns the token source of the service account, if it
+// was loaded by LoadServiceAccountsFromSources.
+func InMemoryTokenSource(account string) (oauth2.TokenSource, bool) {
+	inMemoryAccounts.Lock()
+	defer inMemoryAccounts.Unlock()
+
+	ts, ok := inMemoryAccounts.sources[account]
+	return ts, ok
+}
+
+// accessTokenFile returns the path of a file holding a current access token
+// of the in-memory service account, for gcloud's --access-token-file. The
+// file is rewritten whenever the token is refreshed.
+func accessTokenFile(account string, ts oauth2.TokenSource) (string, error) {
+	token, err := ts.Token()
+	if err != nil {
+		return "", err
+	}
+
+	inMemoryAccounts.Lock()
+	defer inMemoryAccounts.Unlock()
+
+	if inMemoryAccounts.tokenDir == "" {
+		dir, err := ioutil.TempDir("", "cip-access-tokens-")
+		if err != nil {
+			return "", err
+		}
+		inMemoryAccounts.tokenDir = dir
+	}
+
+	path, ok := inMemoryAccounts.tokenFiles[account]
+	if !ok {
+		path = filepath.Join(
+			inMemoryAccounts.tokenDir,
+			fmt.Sprintf("%d.token", len(inMemoryAccounts.tokenFiles)),
+		)
+		inMemoryAccounts.tokenFiles[account] = path
+	}
+
+	if inMemoryAccounts.written[account] == token.AccessToken {
+		return path, nil
+	}
+
+	// Replace the file atomically, as gcloud commands may be reading it.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(token.AccessToken), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	inMemoryAccounts.written[account] = token.AccessToken
+
+	return path, nil
+}
+
+// forgetInMemoryAccounts drops the in-memory service accounts, and removes
+// their access token files.
+func forgetInMemoryAccounts() error {
+	inMemoryAccounts.Lock()
+	defer inMemoryAccounts.Unlock()
+
+	dir := inMemoryAccounts.tokenDir
+	inMemoryAccounts.sources = make(map[string]oauth2.TokenSource)
+	inMemoryAccounts.tokenDir = ""
+	inMemoryAccounts.tokenFiles = make(map[string]string)
+	inMemoryAccounts.written = make(map[string]string)
+
+	if dir == "" {
+		return nil
+	}
+
+	return os.RemoveAll(dir)
+}
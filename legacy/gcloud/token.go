@@ -18,8 +18,10 @@ package gcloud
 
 import (
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -35,6 +37,16 @@ type Token string
 func GetServiceAccountToken(
 	serviceAccount string,
 	useServiceAccount bool) (Token, error) {
+	if ts, ok := InMemoryTokenSource(serviceAccount); ok && useServiceAccount {
+		token, err := ts.Token()
+		if err != nil {
+			logrus.Errorf("could not mint an access token for %s", serviceAccount)
+			return "", err
+		}
+
+		return Token(token.AccessToken), nil
+	}
+
 	args := []string{
 		"auth",
 		"print-access-token",
@@ -60,22 +72,39 @@ func GetServiceAccountToken(
 }
 
 // MaybeUseServiceAccount injects a '--account=...' argument to the command with
-// the given service account.
+// the given service account. Service accounts held in memory (see
+// LoadServiceAccountsFromSources) are unknown to gcloud, so it is handed a
+// short-lived access token of theirs with '--access-token-file=...' instead.
 func MaybeUseServiceAccount(
 	serviceAccount string,
 	useServiceAccount bool,
 	cmd []string) []string {
 	if useServiceAccount && len(serviceAccount) > 0 {
+		flag := fmt.Sprintf("--account=%v", serviceAccount)
+		if ts, ok := InMemoryTokenSource(serviceAccount); ok {
+			path, err := accessTokenFile(serviceAccount, ts)
+			if err != nil {
+				logrus.Errorf("could not mint an access token for %s: %v", serviceAccount, err)
+			} else {
+				flag = "--access-token-file=" + path
+			}
+		}
+
 		cmd = append(cmd, "")
 		copy(cmd[2:], cmd[1:])
-		cmd[1] = fmt.Sprintf("--account=%v", serviceAccount)
+		cmd[1] = flag
 	}
 	return cmd
 }
 
 // ActivateServiceAccounts uses the given CSV of JSON key filepaths to activate
-// the associated service accounts.
-func ActivateServiceAccounts(keyFilePaths string) error {
+// the associated service accounts. It returns the activated service accounts,
+// keyed by the GCP project they belong to. Mapping the accounts to projects is
+// best-effort: keys without a readable project_id are activated all the same,
+// and if several keys belong to the same project, the first one is used.
+func ActivateServiceAccounts(keyFilePaths string) (map[string]string, error) {
+	accounts := make(map[string]string)
+
 	r := csv.NewReader(strings.NewReader(keyFilePaths))
 	for {
 		record, err := r.Read()
@@ -83,16 +112,81 @@ func ActivateServiceAccounts(keyFilePaths string) error {
 			break
 		}
 		if err != nil {
-			logrus.Fatal(err)
+			return nil, err
 		}
 
 		for _, keyFilePath := range record {
 			if err := ActivateServiceAccount(keyFilePath); err != nil {
-				logrus.Fatal(err)
+				return nil, err
+			}
+
+			key, err := ReadServiceAccountKey(keyFilePath)
+			if err != nil {
+				logrus.Warnf("not selecting the service account by project: %v", err)
+				continue
 			}
+
+			addAccount(accounts, key)
+		}
+	}
+
+	return accounts, nil
+}
+
+// addAccount maps the project of the key to its service account, unless a
+// previous key already claimed the project.
+func addAccount(accounts map[string]string, key ServiceAccountKey) {
+	if other, ok := accounts[key.ProjectID]; ok {
+		if other != key.ClientEmail {
+			logrus.Infof(
+				"%s and %s both belong to project %s; using %s",
+				other,
+				key.ClientEmail,
+				key.ProjectID,
+				other,
+			)
 		}
+		return
+	}
+
+	accounts[key.ProjectID] = key.ClientEmail
+}
+
+// ServiceAccountKey holds the fields of a JSON service account key file which
+// identify the service account.
+type ServiceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	ProjectID   string `json:"project_id"`
+}
+
+// ReadServiceAccountKey reads the identity of a service account from its JSON
+// key file. The private key is not retained.
+func ReadServiceAccountKey(keyFilePath string) (ServiceAccountKey, error) {
+	b, err := ioutil.ReadFile(keyFilePath)
+	if err != nil {
+		return ServiceAccountKey{}, err
 	}
-	return nil
+
+	return ParseServiceAccountKey(b, keyFilePath)
+}
+
+// ParseServiceAccountKey reads the identity of a service account from its
+// JSON key, which was loaded from origin. The private key is not retained.
+func ParseServiceAccountKey(b []byte, origin string) (ServiceAccountKey, error) {
+	var key ServiceAccountKey
+
+	if err := json.Unmarshal(b, &key); err != nil {
+		return key, fmt.Errorf("parsing the service account key from %s: %w", origin, err)
+	}
+
+	if key.ClientEmail == "" || key.ProjectID == "" {
+		return key, fmt.Errorf(
+			"the service account key from %s has no client_email or project_id",
+			origin,
+		)
+	}
+
+	return key, nil
 }
 
 // ActivateServiceAccount activates the service account with gcloud.
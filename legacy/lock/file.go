@@ -0,0 +1,79 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// fileLock is a Lock backed by a file on the local filesystem. The lock is
+// held for as long as the file exists.
+type fileLock struct {
+	path string
+}
+
+// Acquire creates the lock file, failing if it already exists.
+func (l *fileLock) Acquire(timeout time.Duration) error {
+	return acquire(l.path, timeout, func() (bool, *Holder, error) {
+		f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if os.IsExist(err) {
+			// nolint: gosec
+			b, err := ioutil.ReadFile(l.path)
+			if err != nil {
+				// The lock may have been released in the meantime.
+				return false, nil, nil
+			}
+
+			return false, decodeHolder(b), nil
+		}
+		if err != nil {
+			return false, nil, fmt.Errorf("creating lock file %s: %w", l.path, err)
+		}
+
+		err = json.NewEncoder(f).Encode(newHolder())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// Do not leave behind a lock which nobody holds.
+			if removeErr := os.Remove(l.path); removeErr != nil {
+				return false, nil, fmt.Errorf(
+					"writing lock file %s: %v (and removing it: %v)",
+					l.path,
+					err,
+					removeErr,
+				)
+			}
+			return false, nil, fmt.Errorf("writing lock file %s: %w", l.path, err)
+		}
+
+		return true, nil, nil
+	})
+}
+
+// Release removes the lock file.
+func (l *fileLock) Release() error {
+	if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("removing lock file %s: %w", l.path, err)
+	}
+
+	return nil
+}
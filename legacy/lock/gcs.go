@@ -0,0 +1,120 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+
+	"sigs.k8s.io/release-sdk/object"
+)
+
+// gcsLock is a Lock backed by an object in a GCS bucket. The lock is held for
+// as long as the object exists. Object creation is made exclusive with a
+// "does not exist" precondition.
+type gcsLock struct {
+	url        string
+	bucket     string
+	object     string
+	generation int64
+}
+
+func newGCSLock(url string) (*gcsLock, error) {
+	path := strings.TrimPrefix(url, object.GcsPrefix)
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid GCS lock location %q", url)
+	}
+
+	return &gcsLock{
+		url:    url,
+		bucket: parts[0],
+		object: parts[1],
+	}, nil
+}
+
+// Acquire creates the lock object, failing if it already exists.
+func (l *gcsLock) Acquire(timeout time.Duration) error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("creating GCS client: %w", err)
+	}
+	defer client.Close()
+
+	obj := client.Bucket(l.bucket).Object(l.object)
+
+	return acquire(l.url, timeout, func() (bool, *Holder, error) {
+		w := obj.If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)
+		w.ContentType = "application/json"
+
+		if err := json.NewEncoder(w).Encode(newHolder()); err != nil {
+			w.Close()
+			return false, nil, fmt.Errorf("writing lock %s: %w", l.url, err)
+		}
+
+		err := w.Close()
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			r, err := obj.NewReader(ctx)
+			if err != nil {
+				// The lock may have been released in the meantime.
+				return false, nil, nil
+			}
+			defer r.Close()
+
+			b, err := ioutil.ReadAll(r)
+			if err != nil {
+				return false, nil, nil
+			}
+
+			return false, decodeHolder(b), nil
+		}
+		if err != nil {
+			return false, nil, fmt.Errorf("writing lock %s: %w", l.url, err)
+		}
+
+		l.generation = w.Attrs().Generation
+		return true, nil, nil
+	})
+}
+
+// Release deletes the lock object, as long as it is still the one we created.
+func (l *gcsLock) Release() error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("creating GCS client: %w", err)
+	}
+	defer client.Close()
+
+	obj := client.Bucket(l.bucket).Object(l.object)
+	if err := obj.If(storage.Conditions{GenerationMatch: l.generation}).Delete(ctx); err != nil {
+		return fmt.Errorf("deleting lock %s: %w", l.url, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"sigs.k8s.io/release-sdk/object"
+)
+
+// pollInterval is how long to wait between attempts to acquire a lock that is
+// currently held by someone else.
+const pollInterval = 5 * time.Second
+
+// Lock is an advisory lock used to serialize promoter runs against a shared
+// destination.
+type Lock interface {
+	// Acquire tries to take the lock, waiting up to timeout for the current
+	// holder (if any) to release it. A zero timeout fails immediately if the
+	// lock is held.
+	Acquire(timeout time.Duration) error
+
+	// Release gives up the lock.
+	Release() error
+}
+
+// Holder describes who holds a lock and since when. It is stored as the
+// contents of the lock so that stale locks can be diagnosed.
+type Holder struct {
+	Identity  string    `json:"identity"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// String returns a human readable representation of the Holder.
+func (h Holder) String() string {
+	return fmt.Sprintf("%s (since %s)", h.Identity, h.Timestamp.Format(time.RFC3339))
+}
+
+// New returns a Lock for the given location, which is either a local file path
+// or a 'gs://<bucket>/<object>' URL.
+func New(location string) (Lock, error) {
+	if strings.HasPrefix(location, object.GcsPrefix) {
+		return newGCSLock(location)
+	}
+
+	return &fileLock{path: location}, nil
+}
+
+// newHolder creates a Holder for the current process.
+func newHolder() Holder {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown-host"
+	}
+
+	return Holder{
+		Identity:  fmt.Sprintf("%s/%d", hostname, os.Getpid()),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+// acquire repeatedly calls tryAcquire until it succeeds, fails, or the timeout
+// expires. tryAcquire returns the current holder if the lock is taken.
+func acquire(
+	location string,
+	timeout time.Duration,
+	tryAcquire func() (acquired bool, current *Holder, err error),
+) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		acquired, current, err := tryAcquire()
+		if err != nil {
+			return err
+		}
+
+		if acquired {
+			logrus.Infof("Acquired lock %s", location)
+			return nil
+		}
+
+		holder := "unknown holder"
+		if current != nil {
+			holder = current.String()
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("lock %s is held by %s", location, holder)
+		}
+
+		logrus.Infof("Lock %s is held by %s; waiting", location, holder)
+
+		wait := pollInterval
+		if remaining < wait {
+			wait = remaining
+		}
+		time.Sleep(wait)
+	}
+}
+
+// decodeHolder parses the contents of a lock. Malformed contents are not an
+// error, as they only serve diagnostic purposes.
+func decodeHolder(b []byte) *Holder {
+	holder := Holder{}
+	if err := json.Unmarshal(b, &holder); err != nil {
+		return nil
+	}
+
+	return &holder
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lock_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/lock"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "promoter.lock")
+
+	first, err := lock.New(path)
+	require.Nil(t, err)
+	require.Nil(t, first.Acquire(0))
+
+	hostname, err := os.Hostname()
+	require.Nil(t, err)
+
+	// A second holder must fail fast and name the current holder.
+	second, err := lock.New(path)
+	require.Nil(t, err)
+	err = second.Acquire(0)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), hostname)
+
+	require.Nil(t, first.Release())
+	require.Nil(t, second.Acquire(0))
+	require.Nil(t, second.Release())
+}
+
+func TestNewGCSLock(t *testing.T) {
+	_, err := lock.New("gs://bucket-only")
+	require.Error(t, err)
+
+	_, err = lock.New("gs://bucket/path/to/promoter.lock")
+	require.Nil(t, err)
+}
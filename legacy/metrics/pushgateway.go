@@ -0,0 +1,90 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Gauge is a single metric value pushed to a Prometheus pushgateway.
+type Gauge struct {
+	Name  string
+	Help  string
+	Value float64
+}
+
+// pushTimeout bounds how long pushing metrics may delay the end of a run.
+const pushTimeout = 30 * time.Second
+
+// Push replaces the metrics of the job at the pushgateway found at
+// gatewayURL with the given gauges, in the Prometheus text exposition format.
+// The request is sent with transport (or http.DefaultTransport if nil).
+func Push(
+	gatewayURL, job string,
+	gauges []Gauge,
+	transport http.RoundTripper,
+) error {
+	if job == "" {
+		return fmt.Errorf("no job name given")
+	}
+
+	endpoint := strings.TrimRight(gatewayURL, "/") +
+		"/metrics/job/" + url.PathEscape(job)
+
+	var body bytes.Buffer
+	for _, g := range gauges {
+		fmt.Fprintf(&body, "# HELP %s %s\n", g.Name, escapeHelp(g.Help))
+		fmt.Fprintf(&body, "# TYPE %s gauge\n", g.Name)
+		fmt.Fprintf(&body, "%s %v\n", g.Name, g.Value)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := http.Client{Timeout: pushTimeout, Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushing metrics to %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf(
+			"pushing metrics to %s: %s: %s",
+			endpoint,
+			resp.Status,
+			strings.TrimSpace(string(msg)),
+		)
+	}
+
+	return nil
+}
+
+// escapeHelp escapes a HELP line as required by the text exposition format.
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
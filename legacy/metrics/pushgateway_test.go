@@ -0,0 +1,101 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	reg "sigs.k8s.io/promo-tools/v3/legacy/dockerregistry"
+	"sigs.k8s.io/promo-tools/v3/legacy/metrics"
+)
+
+func TestPush(t *testing.T) {
+	var (
+		gotMethod string
+		gotPath   string
+		gotBody   string
+	)
+
+	gateway := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			b, err := ioutil.ReadAll(r.Body)
+			require.Nil(t, err)
+
+			gotMethod = r.Method
+			gotPath = r.URL.EscapedPath()
+			gotBody = string(b)
+		},
+	))
+	defer gateway.Close()
+
+	err := metrics.Push(gateway.URL+"/", "cip promotion", []metrics.Gauge{
+		{Name: "cip_edges_promoted", Help: "Edges promoted.", Value: 3},
+		{Name: "cip_run_duration_seconds", Help: "Run\nduration.", Value: 1.5},
+	}, nil)
+	require.Nil(t, err)
+
+	require.Equal(t, http.MethodPut, gotMethod)
+	require.Equal(t, "/metrics/job/cip%20promotion", gotPath)
+	require.Equal(t, `# HELP cip_edges_promoted Edges promoted.
+# TYPE cip_edges_promoted gauge
+cip_edges_promoted 3
+# HELP cip_run_duration_seconds Run\nduration.
+# TYPE cip_run_duration_seconds gauge
+cip_run_duration_seconds 1.5
+`, gotBody)
+}
+
+func TestPushError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad metrics", http.StatusBadRequest)
+		},
+	))
+	defer gateway.Close()
+
+	err := metrics.Push(gateway.URL, "cip", nil, nil)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "bad metrics")
+}
+
+func TestPushAllowlist(t *testing.T) {
+	calls := 0
+	gateway := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+		},
+	))
+	defer gateway.Close()
+
+	// A pushgateway which is not in the allowlist is never pushed to.
+	allowlist, err := reg.ParseHostAllowlist([]string{"gcr.io"})
+	require.Nil(t, err)
+	err = metrics.Push(
+		gateway.URL,
+		"cip",
+		nil,
+		reg.NewAllowlistTransport(allowlist, nil),
+	)
+	require.Error(t, err)
+	require.ErrorIs(t, err, reg.ErrHostNotAllowed)
+	require.Equal(t, 0, calls)
+}
@@ -30,6 +30,8 @@ import (
 type HTTP struct {
 	Req *http.Request
 	Res *http.Response
+	// Transport sends the request; if nil, http.DefaultTransport is used.
+	Transport http.RoundTripper
 }
 
 const (
@@ -40,7 +42,8 @@ const (
 // stderr). In this case we equate the http.Respose "Body" with stdout.
 func (h *HTTP) Produce() (stdOut, stdErr io.Reader, err error) {
 	client := http.Client{
-		Timeout: time.Second * requestTimeoutSeconds,
+		Transport: h.Transport,
+		Timeout:   time.Second * requestTimeoutSeconds,
 	}
 
 	// TODO: Does Close() need to be handled in a separate method?
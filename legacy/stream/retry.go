@@ -0,0 +1,229 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRetryableErrorPatterns match the errors which are always considered
+// transient: rate limiting, server errors, timeouts, and connections which
+// were dropped or could not be established.
+var DefaultRetryableErrorPatterns = []string{
+	`\b429\b`,
+	`\b5\d\d\b`,
+	`(?i)time(d)?\s?out`,
+	`(?i)connection (reset|refused)`,
+	`(?i)broken pipe`,
+	`\bEOF\b`,
+	`(?i)temporary failure`,
+}
+
+// RetryClassifier decides whether a failed request should be retried, by
+// matching the error output against a list of regular expressions. A nil
+// *RetryClassifier only retries the DefaultRetryableErrorPatterns.
+type RetryClassifier struct {
+	patterns []*regexp.Regexp
+}
+
+var defaultRetryClassifier = &RetryClassifier{}
+
+func init() {
+	for _, pattern := range DefaultRetryableErrorPatterns {
+		defaultRetryClassifier.patterns = append(
+			defaultRetryClassifier.patterns,
+			regexp.MustCompile(pattern),
+		)
+	}
+}
+
+// NewRetryClassifier creates a RetryClassifier from the
+// DefaultRetryableErrorPatterns and the given additional patterns.
+func NewRetryClassifier(patterns []string) (*RetryClassifier, error) {
+	rc := &RetryClassifier{
+		patterns: append([]*regexp.Regexp{}, defaultRetryClassifier.patterns...),
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compiling retryable error pattern %q: %w", pattern, err)
+		}
+
+		rc.patterns = append(rc.patterns, re)
+	}
+
+	return rc, nil
+}
+
+// Match returns the first pattern matching err, or an empty string if err is
+// not retryable.
+func (rc *RetryClassifier) Match(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if rc == nil {
+		rc = defaultRetryClassifier
+	}
+
+	for _, re := range rc.patterns {
+		if re.MatchString(err.Error()) {
+			return re.String()
+		}
+	}
+
+	return ""
+}
+
+// ErrRetryBudgetExhausted is matched (with errors.Is) by the errors of the
+// requests which were not retried because the RetryBudget was exhausted.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// budgetExhaustedError is the last error of a request which was not retried
+// because the RetryBudget was exhausted.
+type budgetExhaustedError struct {
+	total int64
+	err   error
+}
+
+func (e *budgetExhaustedError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("retry budget of %d exhausted", e.total)
+	}
+
+	return fmt.Sprintf("retry budget of %d exhausted: %v", e.total, e.err)
+}
+
+func (e *budgetExhaustedError) Unwrap() error {
+	return e.err
+}
+
+func (e *budgetExhaustedError) Is(target error) bool {
+	return target == ErrRetryBudgetExhausted
+}
+
+// RetryBudget limits the total number of retries shared by all the requests
+// of a run, so that a failing registry is not hit by an unbounded number of
+// re-attempts. A nil *RetryBudget allows unlimited retries.
+type RetryBudget struct {
+	total int64
+	used  int64
+}
+
+// NewRetryBudget creates a RetryBudget allowing total retries. A total of 0
+// (or less) means unlimited retries, and returns nil.
+func NewRetryBudget(total int) *RetryBudget {
+	if total <= 0 {
+		return nil
+	}
+
+	return &RetryBudget{total: int64(total)}
+}
+
+// Take consumes one retry from the budget. It returns false once the budget is
+// exhausted.
+func (b *RetryBudget) Take() bool {
+	if b == nil {
+		return true
+	}
+
+	used := atomic.AddInt64(&b.used, 1)
+	if used > b.total {
+		return false
+	}
+
+	logrus.Infof(
+		"Retry budget: used %d of %d retries, %d remaining",
+		used,
+		b.total,
+		b.total-used,
+	)
+
+	return true
+}
+
+// Err returns an error matching ErrRetryBudgetExhausted once a retry was
+// refused because the budget was exhausted, so that the run can be aborted
+// instead of carrying on with what could be read.
+func (b *RetryBudget) Err() error {
+	if b == nil || atomic.LoadInt64(&b.used) <= b.total {
+		return nil
+	}
+
+	return &budgetExhaustedError{total: b.total}
+}
+
+// Remaining returns the number of retries left in the budget, or -1 if the
+// budget is unlimited.
+func (b *RetryBudget) Remaining() int {
+	if b == nil {
+		return -1
+	}
+
+	remaining := b.total - atomic.LoadInt64(&b.used)
+	if remaining < 0 {
+		return 0
+	}
+
+	return int(remaining)
+}
+
+// Retry calls fn until it succeeds, fails with an error which is not
+// retryable, or BackoffDefault gives up.
+func (rc *RetryClassifier) Retry(fn func() error) error {
+	return rc.RetryWithBudget(fn, nil)
+}
+
+// RetryWithBudget is like Retry, but draws every retry from budget. Once the
+// budget is exhausted, failures are no longer retried.
+func (rc *RetryClassifier) RetryWithBudget(fn func() error, budget *RetryBudget) error {
+	retryFn := func() error {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if rc.Match(err) == "" {
+			return backoff.Permanent(err)
+		}
+
+		if !budget.Take() {
+			return backoff.Permanent(&budgetExhaustedError{total: budget.total, err: err})
+		}
+
+		return err
+	}
+
+	notify := func(err error, t time.Duration) {
+		logrus.Errorf(
+			"error: %v happened at time: %v; retrying (matched %q)",
+			err,
+			t,
+			rc.Match(err),
+		)
+	}
+
+	return backoff.RetryNotify(retryFn, BackoffDefault(), notify)
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+func TestRetryClassifier(t *testing.T) {
+	rc, err := stream.NewRetryClassifier([]string{`(?i)registry is busy`})
+	require.Nil(t, err)
+
+	tests := []struct {
+		name            string
+		err             error
+		expectedDefault bool
+		expectedCustom  bool
+	}{
+		{
+			"No error",
+			nil,
+			false,
+			false,
+		},
+		{
+			"Rate limited",
+			errors.New("unexpected response code 429; body: slow down"),
+			true,
+			true,
+		},
+		{
+			"Server error",
+			errors.New("unexpected response code 503"),
+			true,
+			true,
+		},
+		{
+			"Timeout",
+			errors.New("Client.Timeout exceeded while awaiting headers"),
+			true,
+			true,
+		},
+		{
+			"Connection reset",
+			errors.New("read tcp 10.0.0.1:443: read: connection reset by peer"),
+			true,
+			true,
+		},
+		{
+			"Connection closed",
+			errors.New(`Get "https://gcr.io/v2/": unexpected EOF`),
+			true,
+			true,
+		},
+		{
+			"Connection refused",
+			errors.New("dial tcp 10.0.0.1:443: connect: connection refused"),
+			true,
+			true,
+		},
+		{
+			"DNS failure",
+			errors.New("dial tcp: lookup gcr.io: Temporary failure in name resolution"),
+			true,
+			true,
+		},
+		{
+			"Registry specific transient error",
+			errors.New("Registry is busy, try again later"),
+			false,
+			true,
+		},
+		{
+			"Permanent error",
+			errors.New("unexpected response code 404; body: not found"),
+			false,
+			false,
+		},
+	}
+
+	var defaultClassifier *stream.RetryClassifier
+	for _, test := range tests {
+		require.Equal(t, test.expectedDefault, defaultClassifier.Match(test.err) != "", test.name)
+		require.Equal(t, test.expectedCustom, rc.Match(test.err) != "", test.name)
+	}
+
+	_, err = stream.NewRetryClassifier([]string{"("})
+	require.Error(t, err)
+}
+
+func TestRetryClassifierRetry(t *testing.T) {
+	var defaultClassifier *stream.RetryClassifier
+
+	calls := 0
+	err := defaultClassifier.Retry(func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("unexpected response code 500")
+		}
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	permanent := errors.New("unexpected response code 404")
+	err = defaultClassifier.Retry(func() error {
+		calls++
+		return permanent
+	})
+	require.Equal(t, permanent, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestRetryBudget(t *testing.T) {
+	require.Nil(t, stream.NewRetryBudget(0))
+
+	var unlimited *stream.RetryBudget
+	require.True(t, unlimited.Take())
+	require.Equal(t, -1, unlimited.Remaining())
+
+	budget := stream.NewRetryBudget(1)
+	require.Equal(t, 1, budget.Remaining())
+	require.Nil(t, budget.Err())
+
+	var defaultClassifier *stream.RetryClassifier
+
+	calls := 0
+	err := defaultClassifier.RetryWithBudget(func() error {
+		calls++
+		return errors.New("unexpected response code 500")
+	}, budget)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "retry budget of 1 exhausted")
+	require.True(t, errors.Is(err, stream.ErrRetryBudgetExhausted))
+	require.Contains(t, err.Error(), "unexpected response code 500")
+	require.Equal(t, 2, calls)
+	require.Equal(t, 0, budget.Remaining())
+	require.True(t, errors.Is(budget.Err(), stream.ErrRetryBudgetExhausted))
+
+	// The exhausted budget is shared, so no further request is retried.
+	calls = 0
+	err = defaultClassifier.RetryWithBudget(func() error {
+		calls++
+		return errors.New("unexpected response code 503")
+	}, budget)
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
@@ -19,19 +19,40 @@ package stream
 import (
 	"io"
 	"os/exec"
+	"strings"
+
+	"github.com/sirupsen/logrus"
 )
 
+// redactedArgs are the command line options whose values identify the
+// credentials used by a command.
+var redactedArgs = []string{
+	"--account",
+	"--key-file",
+}
+
 // Subprocess can spawn a subprocess and read from it. It can be used to read
 // from an io.Reader that produces JSON, or whatever else.
 type Subprocess struct {
 	CmdInvocation []string
-	cmd           *exec.Cmd
+	// LogLevel, if not nil, is the level at which the command is logged
+	// before it is run.
+	LogLevel *logrus.Level
+	cmd      *exec.Cmd
 }
 
 // Produce runs the external process and returns two io.Readers (to stdout and
 // stderr).
 func (sp *Subprocess) Produce() (stdOut, stdErr io.Reader, err error) {
 	invocation := sp.CmdInvocation
+	if sp.LogLevel != nil {
+		logrus.StandardLogger().Logf(
+			*sp.LogLevel,
+			"executing %s",
+			strings.Join(RedactCommand(invocation), " "),
+		)
+	}
+
 	cmd := exec.Command(invocation[0], invocation[1:]...)
 	stdoutReader, err := cmd.StdoutPipe()
 	if err != nil {
@@ -58,3 +79,23 @@ func (sp *Subprocess) Close() error {
 	// See https://golang.org/pkg/os/exec/#Cmd.StdoutPipe.
 	return sp.cmd.Wait()
 }
+
+// RedactCommand returns a copy of the command, with the values of the options
+// naming service accounts or their key files replaced.
+func RedactCommand(invocation []string) []string {
+	redacted := make([]string, len(invocation))
+	copy(redacted, invocation)
+
+	for i, arg := range redacted {
+		for _, name := range redactedArgs {
+			switch {
+			case strings.HasPrefix(arg, name+"="):
+				redacted[i] = name + "=<redacted>"
+			case arg == name && i+1 < len(redacted):
+				redacted[i+1] = "<redacted>"
+			}
+		}
+	}
+
+	return redacted
+}
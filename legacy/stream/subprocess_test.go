@@ -0,0 +1,55 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stream_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/promo-tools/v3/legacy/stream"
+)
+
+func TestRedactCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		invocation []string
+		expected   []string
+	}{
+		{
+			"Nothing to redact",
+			[]string{"gcloud", "container", "images", "list"},
+			[]string{"gcloud", "container", "images", "list"},
+		},
+		{
+			"Service account",
+			[]string{"gcloud", "--account=foo@bar.iam.gserviceaccount.com", "container"},
+			[]string{"gcloud", "--account=<redacted>", "container"},
+		},
+		{
+			"Key file as separate argument",
+			[]string{"gcloud", "auth", "activate-service-account", "--key-file", "/secret/key.json"},
+			[]string{"gcloud", "auth", "activate-service-account", "--key-file", "<redacted>"},
+		},
+	}
+
+	for _, test := range tests {
+		invocation := append([]string{}, test.invocation...)
+		require.Equal(t, test.expected, stream.RedactCommand(test.invocation), test.name)
+		require.Equal(t, invocation, test.invocation, test.name)
+	}
+}
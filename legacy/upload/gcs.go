@@ -0,0 +1,64 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upload
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+)
+
+// writeGCS uploads b to a temporary object in bucket, copies it to name and
+// deletes the temporary object. GCS has no rename, but the copy is atomic.
+// The default application credentials are used.
+func writeGCS(bucket, name string, b []byte) error {
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("creating GCS client: %w", err)
+	}
+	defer client.Close()
+
+	tmp := client.Bucket(bucket).Object(tempName(name))
+	dst := client.Bucket(bucket).Object(name)
+
+	w := tmp.NewWriter(ctx)
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return fmt.Errorf("uploading gs://%s/%s: %w", bucket, tmp.ObjectName(), err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("uploading gs://%s/%s: %w", bucket, tmp.ObjectName(), err)
+	}
+	defer func() {
+		_ = tmp.Delete(ctx)
+	}()
+
+	if _, err := dst.CopierFrom(tmp).Run(ctx); err != nil {
+		return fmt.Errorf(
+			"copying gs://%s/%s to gs://%s/%s: %w",
+			bucket,
+			tmp.ObjectName(),
+			bucket,
+			name,
+			err,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upload
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// writeS3 uploads b to a temporary object in bucket with the AWS CLI, and
+// moves it to name. The AWS CLI resolves credentials with the default AWS
+// credential chain (environment, shared config, instance metadata, ...).
+func writeS3(bucket, name string, b []byte) error {
+	tmpURL := fmt.Sprintf("%s%s/%s", S3Prefix, bucket, tempName(name))
+	dstURL := fmt.Sprintf("%s%s/%s", S3Prefix, bucket, name)
+
+	if err := runAWS(bytes.NewReader(b), "s3", "cp", "-", tmpURL); err != nil {
+		return fmt.Errorf("uploading %s: %w", tmpURL, err)
+	}
+
+	if err := runAWS(nil, "s3", "mv", tmpURL, dstURL); err != nil {
+		// Do not leave the temporary object behind.
+		_ = runAWS(nil, "s3", "rm", tmpURL)
+		return fmt.Errorf("moving %s to %s: %w", tmpURL, dstURL, err)
+	}
+
+	return nil
+}
+
+// runAWS runs the AWS CLI with the given arguments and stdin.
+func runAWS(stdin *bytes.Reader, args ...string) error {
+	var stderr bytes.Buffer
+
+	cmd := exec.Command("aws", args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", err, stderr.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2021 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package upload
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/release-sdk/object"
+)
+
+// S3Prefix is the URL prefix of S3 objects.
+const S3Prefix = "s3://"
+
+// Write stores b at location, which is either a local file path, a
+// 'gs://<bucket>/<object>' URL or a 's3://<bucket>/<object>' URL. The data is
+// first written to a temporary file or object which is then renamed, so that
+// readers never see a partially written result.
+func Write(location string, b []byte) error {
+	switch {
+	case strings.HasPrefix(location, object.GcsPrefix):
+		bucket, name, err := splitURL(location, object.GcsPrefix)
+		if err != nil {
+			return err
+		}
+
+		return writeGCS(bucket, name, b)
+	case strings.HasPrefix(location, S3Prefix):
+		bucket, name, err := splitURL(location, S3Prefix)
+		if err != nil {
+			return err
+		}
+
+		return writeS3(bucket, name, b)
+	default:
+		return writeFile(location, b)
+	}
+}
+
+// splitURL splits a '<prefix><bucket>/<object>' URL into its bucket and object
+// name.
+func splitURL(url, prefix string) (bucket, name string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(url, prefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid location %q; expected %s<bucket>/<object>", url, prefix)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// tempName returns the name of the temporary object used while writing name.
+func tempName(name string) string {
+	return fmt.Sprintf("%s.tmp-%d-%d", name, os.Getpid(), time.Now().UnixNano())
+}
+
+// writeFile writes b to a temporary file next to path, and renames it to path.
+func writeFile(path string, b []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("creating temporary file for %s: %w", path, err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", f.Name(), err)
+	}
+
+	// Make sure the data is on disk before the rename makes it visible, so
+	// that a crash never leaves an empty file behind (e.g. a checkpoint).
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", f.Name(), err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", f.Name(), err)
+	}
+
+	// nolint: gosec
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return fmt.Errorf("setting permissions of %s: %w", f.Name(), err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("renaming %s to %s: %w", f.Name(), path, err)
+	}
+
+	return nil
+}
@@ -23,7 +23,11 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
@@ -37,18 +41,22 @@ import (
 	"sigs.k8s.io/release-utils/command"
 )
 
-const kpromoMain = "cmd/kpromo/main.go"
+const (
+	kpromoMain  = "cmd/kpromo/main.go"
+	fixturePath = "test-e2e/cip/fixture"
+)
 
 func main() {
-	// NOTE: We can't run the tests in parallel because we only have 1 pair of
-	// staging/prod GCRs.
-
 	testsPtr := flag.String(
 		"tests", "", "the e2e tests file (YAML) to load (REQUIRED)")
 	repoRootPtr := flag.String(
 		"repo-root", "", "the absolute path of the CIP git repository on disk")
 	keyFilePtr := flag.String(
 		"key-file", "", "the .json key file to use to activate the service account in the tests (tests only support using 1 service account)")
+	parallelPtr := flag.Int(
+		"parallel",
+		1,
+		"the number of tests to run concurrently; with more than 1, every test runs in its own namespace within the staging/prod GCRs")
 	helpPtr := flag.Bool(
 		"help",
 		false,
@@ -73,6 +81,10 @@ func main() {
 		logrus.Fatalf("-repo-root=... flag is required")
 	}
 
+	if *parallelPtr < 1 {
+		logrus.Fatalf("-parallel=... must be at least 1")
+	}
+
 	ts, err := readE2ETests(*testsPtr)
 	if err != nil {
 		logrus.Fatal(err)
@@ -84,47 +96,91 @@ func main() {
 		}
 	}
 
-	// Loop through each e2e test case.
-	for _, t := range ts {
-		fmt.Printf("\n===> Running e2e test '%s'...\n", t.Name)
-		if err := testSetup(*repoRootPtr, &t); err != nil {
-			logrus.Fatalf("error with test setup: %q", err)
+	// We only have 1 pair of staging/prod GCRs. Tests running concurrently
+	// are isolated from each other by giving each of them its own namespace
+	// (a repository prefix) within these GCRs.
+	if *parallelPtr > 1 {
+		runID := time.Now().UnixNano()
+		for i := range ts {
+			ts[i].Namespace = fmt.Sprintf("e2e-%d-%d", runID, i)
 		}
+	}
 
-		fmt.Println("checking snapshots BEFORE promotion:")
-		for _, snapshot := range t.Snapshots {
-			if err := checkSnapshot(snapshot.Name, snapshot.Before, *repoRootPtr, t.Registries); err != nil {
-				logrus.Fatalf("error checking snapshot before promotion for %s: %q", snapshot.Name, err)
-			}
-		}
+	// Run the e2e test cases, at most -parallel at a time.
+	errs := make([]error, len(ts))
+	sem := make(chan struct{}, *parallelPtr)
+	var wg sync.WaitGroup
+	for i := range ts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = runE2ETest(*repoRootPtr, &ts[i])
+		}(i)
+	}
+	wg.Wait()
 
-		err = runPromotion(*repoRootPtr, &t)
+	failed := 0
+	for i, err := range errs {
 		if err != nil {
-			logrus.Fatalf("error with promotion: %q", err)
+			logrus.Errorf("e2e test '%s' failed: %q", ts[i].Name, err)
+			failed++
 		}
+	}
 
-		fmt.Println("checking snapshots AFTER promotion:")
-		for _, snapshot := range t.Snapshots {
-			err := checkSnapshot(snapshot.Name, snapshot.After, *repoRootPtr, t.Registries)
-			if err != nil {
-				logrus.Fatalf("error checking snapshot for %s: %q", snapshot.Name, err)
+	if failed > 0 {
+		logrus.Fatalf("%d of %d e2e tests failed", failed, len(ts))
+	}
+}
+
+func runE2ETest(repoRoot string, t *E2ETest) error {
+	fmt.Printf("\n===> Running e2e test '%s'...\n", t.Name)
+	if err := testSetup(repoRoot, t); err != nil {
+		return errors.Wrap(err, "test setup")
+	}
+
+	// Do not leave namespaces behind in the shared GCRs.
+	if t.Namespace != "" {
+		defer func() {
+			if err := t.clearRepositories(); err != nil {
+				logrus.Errorf("cleaning up namespace %s: %q", t.Namespace, err)
 			}
+		}()
+	}
+
+	fmt.Printf("[%s] checking snapshots BEFORE promotion:\n", t.Name)
+	for _, snapshot := range t.Snapshots {
+		if err := checkSnapshot(t, snapshot.Name, snapshot.Before, repoRoot); err != nil {
+			return errors.Wrapf(err, "checking snapshot before promotion for %s", snapshot.Name)
 		}
+	}
+
+	if err := runPromotion(repoRoot, t); err != nil {
+		return errors.Wrap(err, "promotion")
+	}
 
-		fmt.Printf("\n===> e2e test '%s': OK\n", t.Name)
+	fmt.Printf("[%s] checking snapshots AFTER promotion:\n", t.Name)
+	for _, snapshot := range t.Snapshots {
+		if err := checkSnapshot(t, snapshot.Name, snapshot.After, repoRoot); err != nil {
+			return errors.Wrapf(err, "checking snapshot for %s", snapshot.Name)
+		}
 	}
+
+	fmt.Printf("\n===> e2e test '%s': OK\n", t.Name)
+	return nil
 }
 
 func checkSnapshot(
+	t *E2ETest,
 	repo reg.RegistryName,
 	expected []reg.Image,
 	repoRoot string,
-	rcs []reg.RegistryContext,
 ) error {
 	got, err := getSnapshot(
 		repoRoot,
-		repo,
-		rcs,
+		t.namespaced(repo),
+		t.registries(),
 	)
 	if err != nil {
 		return errors.Wrapf(err, "getting snapshot of %s", repo)
@@ -132,7 +188,19 @@ func checkSnapshot(
 
 	diff := cmp.Diff(got, expected)
 	if diff != "" {
-		fmt.Printf("the following diff exists: %s", diff)
+		fmt.Printf("[%s] the following diff exists: %s", t.Name, diff)
+
+		// Classify the differences, as a tag move is much more alarming
+		// than a missing image.
+		gotManifest := reg.Manifest{Images: got}
+		expectedManifest := reg.Manifest{Images: expected}
+		for _, change := range reg.DiffSnapshots(
+			expectedManifest.ToRegInvImage(),
+			gotManifest.ToRegInvImage(),
+		) {
+			fmt.Printf("[%s]   %s\n", t.Name, change)
+		}
+
 		return errors.Errorf("expected equivalent image sets")
 	}
 
@@ -146,9 +214,15 @@ func testSetup(repoRoot string, t *E2ETest) error {
 
 	goldenPush := fmt.Sprintf("%s/test-e2e/golden-images/push-golden.sh", repoRoot)
 
+	args := []string{}
+	if t.Namespace != "" {
+		args = append(args, "--namespace="+t.Namespace)
+	}
+
 	cmd := command.NewWithWorkDir(
 		repoRoot,
 		goldenPush,
+		args...,
 	)
 
 	logrus.Infof("executing %s\n", cmd.String())
@@ -168,7 +242,7 @@ func runPromotion(repoRoot string, t *E2ETest) error {
 			kpromoMain,
 		),
 		"cip",
-		"--confirm",
+		"--mode=apply",
 		"--log-level=debug",
 		"--use-service-account",
 		// There is no need to use -key-files=... because we already activated
@@ -176,11 +250,24 @@ func runPromotion(repoRoot string, t *E2ETest) error {
 		// flag.
 	}
 
+	// The fixtures name the shared registries; point the promotion at copies
+	// of them which name the namespaced registries instead.
+	fixtureDir := fmt.Sprintf("%s/%s", repoRoot, fixturePath)
+	if t.Namespace != "" {
+		var err error
+		fixtureDir, err = t.namespacedFixtures(fixtureDir)
+		if err != nil {
+			return errors.Wrap(err, "namespacing fixtures")
+		}
+		defer os.RemoveAll(fixtureDir)
+	}
+
 	argsFinal := []string{}
 
 	args = append(args, t.Invocation...)
 
 	for _, arg := range args {
+		arg = strings.ReplaceAll(arg, "$PWD/"+fixturePath, fixtureDir)
 		argsFinal = append(argsFinal, strings.ReplaceAll(arg, "$PWD", repoRoot))
 	}
 
@@ -253,7 +340,7 @@ func (t *E2ETest) clearRepositories() error {
 	// promotions will be done by the cip binary, not this tool.
 	sc, err := reg.MakeSyncContext(
 		[]reg.Manifest{
-			{Registries: t.Registries},
+			{Registries: t.registries()},
 		},
 		10,
 		true,
@@ -271,7 +358,7 @@ func (t *E2ETest) clearRepositories() error {
 		reg.MkReadRepositoryCmdReal)
 
 	// Clear ALL registries in the test manifest. Blank slate!
-	for _, rc := range t.Registries {
+	for _, rc := range t.registries() {
 		fmt.Println("CLEARING REPO", rc.Name)
 		clearRepository(rc.Name, &sc)
 	}
@@ -304,6 +391,97 @@ type E2ETest struct {
 	Registries []reg.RegistryContext `yaml:"registries,omitempty"`
 	Invocation []string              `yaml:"invocation,omitempty"`
 	Snapshots  []RegistrySnapshot    `yaml:"snapshots,omitempty"`
+
+	// Namespace is the repository prefix the test runs in within each of
+	// its registries, so that it does not interfere with concurrently
+	// running tests. An empty Namespace uses the registries as they are.
+	Namespace string `yaml:"-"`
+}
+
+// namespaced returns the name of the repository within the namespace of the
+// test. Names outside of the test registries are returned unchanged.
+func (t *E2ETest) namespaced(name reg.RegistryName) reg.RegistryName {
+	if t.Namespace == "" {
+		return name
+	}
+
+	for _, rc := range t.Registries {
+		if name == rc.Name {
+			return reg.RegistryName(string(rc.Name) + "/" + t.Namespace)
+		}
+
+		if rest := strings.TrimPrefix(string(name), string(rc.Name)+"/"); rest != string(name) {
+			return reg.RegistryName(string(rc.Name) + "/" + t.Namespace + "/" + rest)
+		}
+	}
+
+	return name
+}
+
+// registries returns the registries of the test, within its namespace.
+func (t *E2ETest) registries() []reg.RegistryContext {
+	rcs := make([]reg.RegistryContext, 0, len(t.Registries))
+	for _, rc := range t.Registries {
+		rc.Name = t.namespaced(rc.Name)
+		rcs = append(rcs, rc)
+	}
+
+	return rcs
+}
+
+// namespacedFixtures copies the fixtures in dir to a temporary directory,
+// replacing every reference to a test registry by its namespaced name. The
+// caller must remove the returned directory.
+func (t *E2ETest) namespacedFixtures(dir string) (string, error) {
+	tmpDir, err := ioutil.TempDir("", "cip-e2e-"+t.Namespace+"-")
+	if err != nil {
+		return "", err
+	}
+
+	replacers := make([]*regexp.Regexp, 0, len(t.Registries))
+	for _, rc := range t.Registries {
+		// Only match whole registry names, not the middle of another name.
+		replacers = append(replacers, regexp.MustCompile(
+			`(^|[^\w.-])`+regexp.QuoteMeta(string(rc.Name))+`([^\w.-]|$)`,
+		))
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmpDir, rel)
+
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		content := string(b)
+		for i, rc := range t.Registries {
+			content = replacers[i].ReplaceAllString(
+				content,
+				"${1}"+string(t.namespaced(rc.Name))+"${2}",
+			)
+		}
+
+		return ioutil.WriteFile(target, []byte(content), info.Mode())
+	})
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return "", err
+	}
+
+	return tmpDir, nil
 }
 
 // E2ETests is an array of E2ETest.
@@ -18,17 +18,19 @@
 # Images are loaded from local archives and pushed to the designated staging repo. When
 # passed the --audit flag, images will be tagged and pushed to
 # TEST_AUDIT_STAGING_IMG_REPOSITORY, otherwise defaulting to
-# TEST_STAGING_IMG_REPOSITORY (both defined in workspace_status.sh).
+# TEST_STAGING_IMG_REPOSITORY (both defined in workspace_status.sh). When
+# passed the --namespace=NAME flag, images are pushed below NAME within the
+# staging repo instead, so that concurrent e2e tests do not share images.
 #
 # Usage:
-#   ./push-golden.sh [--audit]
+#   ./push-golden.sh [--audit] [--namespace=NAME]
 
 set -o errexit
 set -o nounset
 set -o pipefail
 
 printUsage() {
-    >&2 echo "Usage: $0 [--audit]"
+    >&2 echo "Usage: $0 [--audit] [--namespace=NAME]"
 }
 
 repo_root=$(cd "$(dirname "${BASH_SOURCE[0]}")/../.." && pwd -P)
@@ -36,19 +38,26 @@ archive_path="${repo_root}/test-e2e/golden-images/archives"
 # Inject workspace variables
 source <(${repo_root}/workspace_status.sh inject)
 staging_repo="$TEST_STAGING_IMG_REPOSITORY"
+namespace=""
 
-if [[ $# == 1 ]]; then
-    if [[ "$1" == --audit ]]; then
-        staging_repo="$TEST_AUDIT_STAGING_IMG_REPOSITORY"
-    else
-        >&2 echo "ERROR: Malformed flag!"
-        printUsage
-        exit 1
-    fi
-elif (( $# > 1 )); then
-    >&2 echo "ERROR: Invalid number of arguments!"
-    printUsage
-    exit 1
+for arg in "$@"; do
+    case "$arg" in
+        --audit)
+            staging_repo="$TEST_AUDIT_STAGING_IMG_REPOSITORY"
+            ;;
+        --namespace=*)
+            namespace="${arg#--namespace=}"
+            ;;
+        *)
+            >&2 echo "ERROR: Malformed flag!"
+            printUsage
+            exit 1
+            ;;
+    esac
+done
+
+if [[ -n "$namespace" ]]; then
+    staging_repo="${staging_repo}/${namespace}"
 fi
 
 # Load archives.
@@ -57,8 +66,8 @@ docker load -i "${archive_path}/foo/1.0-linux_amd64.tar"
 docker load -i "${archive_path}/foo/1.0-linux_s390x.tar"
 docker load -i "${archive_path}/foo/NOTAG-0.tar"
 
-# Re-tag images (only for auditor)
-if [[ "$staging_repo" == "$TEST_AUDIT_STAGING_IMG_REPOSITORY" ]]; then
+# Re-tag images (only for auditor or a namespace)
+if [[ "$staging_repo" != "$TEST_STAGING_IMG_REPOSITORY" ]]; then
     docker tag "${TEST_STAGING_IMG_REPOSITORY}/golden-bar/bar:1.0" "${staging_repo}/golden-bar/bar:1.0"
     docker tag "${TEST_STAGING_IMG_REPOSITORY}/golden-foo/foo:1.0-linux_amd64" "${staging_repo}/golden-foo/foo:1.0-linux_amd64"
     docker tag "${TEST_STAGING_IMG_REPOSITORY}/golden-foo/foo:1.0-linux_s390x" "${staging_repo}/golden-foo/foo:1.0-linux_s390x"